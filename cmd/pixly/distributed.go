@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/distributed"
+	"pixly/pkg/engine"
+	"pixly/pkg/tools"
+
+	"go.uber.org/zap"
+)
+
+// runCoordinator 分布式转换的协调节点：扫描、评估并持有状态数据库，把转换单元租给工作节点
+// 全部单元完成后退出；中断后再次运行会从队列继续，不重新扫描
+func runCoordinator(args []string) int {
+	fs := flag.NewFlagSet("pixly coordinator", flag.ContinueOnError)
+	listen := fs.String("listen", "0.0.0.0:8766", "监听地址，工作节点通过该地址申请租约")
+	leaseTTL := fs.Duration("lease-ttl", distributed.DefaultLeaseTTL, "租约时长，工作节点超过该时间未发送心跳时重新分配")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if cfg.TargetDir == "" {
+		fmt.Fprintln(os.Stderr, "❌ 请指定目标目录: pixly coordinator [参数] <目标目录>")
+		return 2
+	}
+
+	logger := newLogger(cfg)
+	defer logger.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stateManager, err := state.NewStateManager(false)
+	if err != nil {
+		return exitCode(fmt.Errorf("打开状态数据库失败: %w", err))
+	}
+	defer stateManager.Close()
+
+	toolResults, err := tools.NewChecker(logger).CheckAll()
+	if err != nil {
+		logger.Warn("工具链检查警告", zap.Error(err))
+	}
+	conversionEngine := engine.NewConversionEngine(logger, cfg, toolResults, nil)
+	conversionEngine.SetStateManager(stateManager)
+
+	coordinator := distributed.NewCoordinator(logger, stateManager, cfg.TargetDir, distributed.CoordinatorOptions{LeaseTTL: *leaseTTL})
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           coordinator.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	fmt.Printf("🛰️ 协调节点已启动: http://%s，目标目录 %s\n", *listen, cfg.TargetDir)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	go func() {
+		// 监听失败时停止协调
+		if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP 服务失败", zap.Error(err))
+			cancelRun()
+		}
+	}()
+
+	status, err := coordinator.Run(runCtx, conversionEngine.Plan)
+
+	// 给工作节点留出时间收到“全部完成”的响应
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+
+	fmt.Printf("📊 分布式转换: 完成 %d 个单元，失败 %d 个，重新分配 %d 次\n", status.Completed, status.Failed, status.Reassigned)
+	return exitCode(err)
+}
+
+// runWorker 分布式转换的工作节点：向协调节点申请租约并在本机转换
+// 转换参数来自协调节点的路由结果，本机配置只影响编码器设置、重试次数等执行参数
+func runWorker(args []string) int {
+	fs := flag.NewFlagSet("pixly worker", flag.ContinueOnError)
+	opts := distributed.WorkerOptions{}
+	fs.StringVar(&opts.Coordinator, "coordinator", "", "协调节点地址，如 http://10.0.0.2:8766（必填）")
+	fs.StringVar(&opts.Name, "name", "", "工作节点名称（默认 主机名-进程号）")
+	fs.BoolVar(&opts.SharedFS, "shared-fs", false, "与协调节点共享文件系统（相同路径），不传输文件内容")
+	fs.IntVar(&opts.Jobs, "jobs", 1, "同时处理的单元数")
+	fs.StringVar(&opts.WorkDir, "work-dir", "", "流式传输时的临时目录（默认系统临时目录）")
+	fs.DurationVar(&opts.PollInterval, "poll-interval", 2*time.Second, "暂无任务时的重试间隔")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if opts.Coordinator == "" {
+		fmt.Fprintln(os.Stderr, "❌ 请指定协调节点: pixly worker --coordinator http://主机:8766")
+		return 2
+	}
+
+	logger := newLogger(cfg)
+	defer logger.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startMetrics(ctx, logger, cfg)
+
+	// 工作节点不打开状态数据库，同一台机器可以运行多个工作节点
+	toolResults, err := tools.NewChecker(logger).CheckAll()
+	if err != nil {
+		logger.Warn("工具链检查警告", zap.Error(err))
+	}
+	conversionEngine := engine.NewConversionEngine(logger, cfg, toolResults, nil)
+
+	fmt.Printf("🛠️ 工作节点已启动，协调节点 %s\n", opts.Coordinator)
+	return exitCode(distributed.NewWorker(logger, opts, conversionEngine.ConvertUnit).Run(ctx))
+}
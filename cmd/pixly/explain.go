@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+)
+
+const explainUsage = `用法:
+  pixly explain [--json] <文件>    显示文件最近一次处理的完整决策轨迹
+
+轨迹按阶段列出每一步使用的测量值、阈值和命中的规则或分支：
+  assessment      品质评估与分级
+  optimal_format  已是最优格式检查
+  mode            按处理模式选择目标格式
+  routing         自动模式+内置路由（快速预判/深度分析）
+  routing_rule    用户路由规则
+  conversion      转换过程中的选择、校验和重试
+  result          最终结果
+
+转换运行期间状态数据库被占用，请在运行结束后查看。`
+
+// runExplain 显示单个文件的决策轨迹
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("pixly explain", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), explainUsage) }
+	asJSON := fs.Bool("json", false, "以 JSON 输出原始决策记录")
+	if err := parseFlags(fs, args); err != nil {
+		return exitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return exitCode(err)
+	}
+
+	stateManager, err := state.NewStateManager(false)
+	if err != nil {
+		return exitCode(err)
+	}
+	defer stateManager.Close()
+
+	records, err := stateManager.LoadDecisions(path)
+	if err != nil {
+		return exitCode(err)
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(os.Stderr, "❌ 没有该文件的决策记录: %s\n", path)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return exitCode(encoder.Encode(records))
+	}
+
+	file, err := stateManager.LoadMediaFile(path)
+	if err != nil {
+		return exitCode(err)
+	}
+	printExplain(path, file, records)
+	return 0
+}
+
+// printExplain 按顺序输出决策记录，测量值按名称排序
+func printExplain(path string, file *types.MediaInfo, records []types.DecisionRecord) {
+	fmt.Printf("🧭 %s\n", path)
+	if file != nil {
+		fmt.Printf("   当前状态: %s\n", file.Status)
+	}
+	fmt.Println()
+
+	for i, record := range records {
+		fmt.Printf("%2d. [%s] %s → %s  (%s)\n", i+1, record.Stage, record.Branch, record.Outcome, record.Time.Format("2006-01-02 15:04:05"))
+		if len(record.Values) > 0 {
+			keys := make([]string, 0, len(record.Values))
+			for key := range record.Values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			values := make([]string, len(keys))
+			for j, key := range keys {
+				values[j] = fmt.Sprintf("%s=%v", key, record.Values[key])
+			}
+			fmt.Printf("    测量值: %s\n", strings.Join(values, ", "))
+		}
+		if record.Thresholds != "" {
+			fmt.Printf("    阈值: %s\n", record.Thresholds)
+		}
+	}
+}
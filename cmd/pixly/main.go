@@ -0,0 +1,171 @@
+// Command pixly 命令行入口
+//
+// 用法:
+//
+//	pixly [参数] <目标目录>         转换目标目录
+//	pixly watch [参数] <目录>      监视目录，转换新到达的文件
+//	pixly serve [--listen 地址]    启动本地 HTTP 任务接口
+//	pixly queue <命令>             查看、暂停、取消或调整转换队列
+//	pixly explain <文件>           显示文件最近一次处理的决策轨迹
+//	pixly reconcile <目录>         核对源文件与转换输出的等价性，清理冗余源文件
+//	pixly coordinator <目标目录>   分布式转换协调节点
+//	pixly worker --coordinator URL 分布式转换工作节点
+//
+// 配置按 默认值 → /etc/pixly/config.yaml → ~/.config/pixly/config.yaml
+// → <目标目录>/.pixly.yaml → --profile 配置档 → PIXLY_* 环境变量 → 命令行参数 的顺序分层加载。
+// 设置 metrics_listen（如 --metrics-listen 127.0.0.1:9464）后转换、监视和工作节点进程提供 Prometheus /metrics；
+// serve 和 coordinator 在自身监听地址上提供 /metrics。
+// 设置 html_report（如 --html-report ~/reports/）后每次转换结束生成单文件 HTML 运行报告。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/engine"
+	"pixly/pkg/metrics"
+	"pixly/pkg/tools"
+	"pixly/pkg/ui/interactive"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// commands 子命令，未匹配时按转换目标目录处理
+var commands = map[string]func(args []string) int{
+	"watch":       runWatch,
+	"serve":       runServe,
+	"queue":       runQueue,
+	"explain":     runExplain,
+	"reconcile":   runReconcile,
+	"coordinator": runCoordinator,
+	"worker":      runWorker,
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			os.Exit(command(args[1:]))
+		}
+	}
+	os.Exit(runConvert(args))
+}
+
+// loadConfig 解析参数并分层加载配置，第一个位置参数作为目标目录
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	overrides := config.RegisterFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		overrides.Set("target_dir", fs.Arg(0))
+	}
+
+	cfg, err := config.Load(config.LoadOptions{Flags: overrides})
+	if err != nil {
+		return nil, &usageError{fmt.Errorf("加载配置失败: %w", err)}
+	}
+	if err := config.ValidateAndNormalize(cfg); err != nil {
+		return nil, &usageError{fmt.Errorf("配置无效: %w", err)}
+	}
+	return cfg, nil
+}
+
+// usageError 命令行参数或配置错误
+type usageError struct{ err error }
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+// parseFlags 解析命令行参数，失败时返回 usageError（-h 时包装 flag.ErrHelp）
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return &usageError{err}
+	}
+	return nil
+}
+
+// newLogger 按配置的日志级别创建日志器
+func newLogger(cfg *config.Config) *zap.Logger {
+	zapConfig := zap.NewDevelopmentConfig()
+	zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if level, err := zapcore.ParseLevel(cfg.LogLevel); err == nil {
+		zapConfig.Level = zap.NewAtomicLevelAt(level)
+	}
+	logger, err := zapConfig.Build()
+	if err != nil {
+		return zap.NewNop()
+	}
+	return logger
+}
+
+// exitCode 参数或配置错误返回 2，-h 返回 0，其他错误返回 1
+func exitCode(err error) int {
+	var usage *usageError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	default:
+		return 0
+	}
+}
+
+// runConvert 转换目标目录
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("pixly", flag.ContinueOnError)
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if cfg.TargetDir == "" {
+		fmt.Fprintln(os.Stderr, "❌ 请指定目标目录: pixly [参数] <目标目录>")
+		return 2
+	}
+
+	logger := newLogger(cfg)
+	defer logger.Sync()
+
+	if profile := cfg.ActiveProfile(); profile != "" {
+		logger.Info("使用配置档", zap.String("profile", profile))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startMetrics(ctx, logger, cfg)
+
+	return exitCode(newEngine(logger, cfg).Execute(ctx))
+}
+
+// startMetrics 配置了 metrics_listen 时在后台提供 Prometheus /metrics，随 ctx 结束
+func startMetrics(ctx context.Context, logger *zap.Logger, cfg *config.Config) {
+	if cfg.MetricsListen == "" {
+		return
+	}
+	go func() {
+		if err := metrics.Serve(ctx, logger, cfg.MetricsListen); err != nil {
+			logger.Warn("指标接口不可用", zap.Error(err))
+		}
+	}()
+}
+
+// newEngine 检查工具链并创建转换引擎
+func newEngine(logger *zap.Logger, cfg *config.Config) *engine.ConversionEngine {
+	toolResults, err := tools.NewChecker(logger).CheckAll()
+	if err != nil {
+		logger.Warn("工具链检查警告", zap.Error(err))
+	}
+	return engine.NewConversionEngine(logger, cfg, toolResults, interactive.NewInterface(logger, cfg.UseColorOutput))
+}
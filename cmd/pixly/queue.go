@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"pixly/pkg/core/state"
+)
+
+const queueUsage = `用法:
+  pixly queue list [目录]              列出转换队列（默认全部）
+  pixly queue pause                    暂停整个队列
+  pixly queue resume                   恢复队列
+  pixly queue cancel <文件>            取消单个文件，之后扫描时不再转换
+  pixly queue retry <文件>             重新排队失败或已取消的文件
+  pixly queue priority <文件> <优先级>  调整优先级（越大越先转换，默认 0）
+
+转换运行期间状态数据库被占用，此时请通过 pixly serve 的 /queue 接口操作。`
+
+// runQueue 查看和调整持久化转换队列
+func runQueue(args []string) int {
+	fs := flag.NewFlagSet("pixly queue", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), queueUsage) }
+	if err := parseFlags(fs, args); err != nil {
+		return exitCode(err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	stateManager, err := state.NewStateManager(false)
+	if err != nil {
+		return exitCode(err)
+	}
+	defer stateManager.Close()
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch {
+	case command == "list" && len(rest) <= 1:
+		dir := ""
+		if len(rest) == 1 {
+			if dir, err = filepath.Abs(rest[0]); err != nil {
+				return exitCode(err)
+			}
+		}
+		return exitCode(printQueue(stateManager, dir))
+	case command == "pause" && len(rest) == 0:
+		err = stateManager.PauseQueue()
+	case command == "resume" && len(rest) == 0:
+		err = stateManager.ResumeQueue()
+	case command == "cancel" && len(rest) == 1:
+		err = withAbsPath(rest[0], stateManager.CancelJob)
+	case command == "retry" && len(rest) == 1:
+		err = withAbsPath(rest[0], stateManager.RetryJob)
+	case command == "priority" && len(rest) == 2:
+		priority, convErr := strconv.Atoi(rest[1])
+		if convErr != nil {
+			return exitCode(&usageError{fmt.Errorf("无效的优先级: %s", rest[1])})
+		}
+		err = withAbsPath(rest[0], func(path string) error { return stateManager.SetJobPriority(path, priority) })
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		return exitCode(err)
+	}
+	fmt.Println("✅ 已更新转换队列")
+	return 0
+}
+
+func withAbsPath(path string, fn func(string) error) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return fn(abs)
+}
+
+// printQueue 输出队列条目
+func printQueue(stateManager *state.StateManager, dir string) error {
+	paused, err := stateManager.IsQueuePaused()
+	if err != nil {
+		return err
+	}
+	entries, err := stateManager.ListQueue(dir)
+	if err != nil {
+		return err
+	}
+	if paused {
+		fmt.Println("⏸️ 队列已暂停")
+	}
+	if len(entries) == 0 {
+		fmt.Println("📋 转换队列为空")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "状态\t优先级\t尝试\t文件\t错误")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", entry.State, entry.Priority, entry.Attempts, entry.Path, entry.LastError)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/engine"
+	"pixly/pkg/validation"
+
+	"go.uber.org/zap"
+)
+
+const reconcileUsage = `用法:
+  pixly reconcile [--delete] [--json] [--formats jxl,avif] <目录>
+
+按状态数据库中的转换记录和同名文件配对源文件与转换输出，验证两者是否等价：
+  jpeg_reconstruction  JPEG → 无损JXL，djxl 逐位重建原始JPEG
+  pixel_hash           PNG等无损源 → JXL，比较解码后的像素哈希
+
+默认只报告；--delete 通过安全删除移除验证等价的冗余源文件。
+内容不一致或无法验证（如 AVIF 等有损输出）的配对保留两个文件。`
+
+// runReconcile 核对源文件与转换输出的等价性
+func runReconcile(args []string) int {
+	fs := flag.NewFlagSet("pixly reconcile", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), reconcileUsage) }
+	deleteRedundant := fs.Bool("delete", false, "删除验证等价的源文件")
+	asJSON := fs.Bool("json", false, "以 JSON 输出核对结果")
+	formats := fs.String("formats", "jxl,avif", "视为转换输出的格式，逗号分隔")
+	if err := parseFlags(fs, args); err != nil {
+		return exitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	dir, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return exitCode(err)
+	}
+
+	logger := zap.NewNop()
+	if !*asJSON {
+		logger, _ = zap.NewDevelopment(zap.IncreaseLevel(zap.WarnLevel))
+	}
+	defer logger.Sync()
+
+	verifier := engine.NewJPEGReconstructionVerifier("", os.TempDir(), nil)
+	reconciler := validation.NewReconciler(logger, func(ctx context.Context, jpegPath, jxlPath string) (bool, error) {
+		check, err := verifier.Verify(ctx, jpegPath, jxlPath)
+		if err != nil {
+			return false, err
+		}
+		return check.Match, nil
+	})
+	// 状态数据库被转换运行占用时退化为按同名配对
+	if stateManager, err := state.NewStateManager(false); err == nil {
+		defer stateManager.Close()
+		reconciler.SetStateManager(stateManager)
+	} else {
+		logger.Warn("状态数据库不可用，仅按同名配对", zap.Error(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := reconciler.ReconcileDirectory(ctx, dir, validation.ReconcileOptions{
+		TargetFormats: strings.Split(*formats, ","),
+		Delete:        *deleteRedundant,
+	})
+	if err != nil {
+		return exitCode(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return exitCode(encoder.Encode(result))
+	}
+	printReconcile(result, *deleteRedundant)
+	return 0
+}
+
+// printReconcile 逐对输出核对结论和汇总
+func printReconcile(result *validation.ReconcileResult, deleteRedundant bool) {
+	icons := map[validation.ReconcileStatus]string{
+		validation.ReconcileEquivalent:    "✅",
+		validation.ReconcileNotEquivalent: "❌",
+		validation.ReconcileUnverified:    "❔",
+	}
+	for _, pair := range result.Pairs {
+		fmt.Printf("%s %s → %s [%s", icons[pair.Status], pair.Source, filepath.Base(pair.Target), pair.MatchedBy)
+		if pair.Method != "" {
+			fmt.Printf(", %s", pair.Method)
+		}
+		fmt.Printf("] %s\n", pair.Reason)
+		switch {
+		case pair.Deleted:
+			fmt.Printf("   🗑️ 已删除源文件 (%d 字节)\n", pair.SourceSize)
+		case pair.DeleteError != "":
+			fmt.Printf("   ⚠️ 删除失败: %s\n", pair.DeleteError)
+		}
+	}
+
+	fmt.Printf("\n🔗 配对 %d: 等价 %d, 不一致 %d, 无法验证 %d\n",
+		len(result.Pairs), result.Equivalent, result.NotEquivalent, result.Unverified)
+	switch {
+	case deleteRedundant:
+		fmt.Printf("🗑️ 删除冗余源文件 %d 个，释放 %d 字节\n", result.Deleted, result.FreedBytes)
+	case result.Equivalent > 0:
+		fmt.Println("💡 使用 --delete 删除验证等价的冗余源文件")
+	}
+}
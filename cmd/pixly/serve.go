@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/server"
+	"pixly/pkg/tools"
+
+	"go.uber.org/zap"
+)
+
+// runServe 启动本地 HTTP 任务接口
+// 任务配置与命令行使用相同的分层规则（系统/用户/项目文件、PIXLY_* 环境变量），请求中的覆盖项优先
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("pixly serve", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8765", "监听地址（默认只接受本机连接）")
+	logLevel := fs.String("log-level", "info", "日志级别")
+	if err := parseFlags(fs, args); err != nil {
+		return exitCode(err)
+	}
+
+	logger := newLogger(&config.Config{LogLevel: *logLevel})
+	defer logger.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stateManager, err := state.NewStateManager(false)
+	if err != nil {
+		return exitCode(fmt.Errorf("打开状态数据库失败: %w", err))
+	}
+	defer stateManager.Close()
+
+	toolResults, err := tools.NewChecker(logger).CheckAll()
+	if err != nil {
+		logger.Warn("工具链检查警告", zap.Error(err))
+	}
+
+	jobServer := server.New(logger, toolResults, stateManager, server.Options{})
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           jobServer.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		jobServer.Run(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("🌐 任务接口已启动: http://%s/jobs\n", *listen)
+	err = httpServer.ListenAndServe()
+	stop()
+	<-runDone
+	if errors.Is(err, http.ErrServerClosed) {
+		return 0
+	}
+	return exitCode(err)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"pixly/pkg/watch"
+
+	"go.uber.org/zap"
+)
+
+// stringList 可重复的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runWatch 监视目录，新建或修改的文件写入完成后通过转换引擎处理
+// 处理记录保存在状态数据库中，重启后已处理且未变化的文件不会重复转换
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("pixly watch", flag.ContinueOnError)
+	opts := watch.DefaultOptions()
+	var include, exclude stringList
+	fs.DurationVar(&opts.Debounce, "debounce", opts.Debounce, "最后一次文件事件后等待的时间")
+	fs.DurationVar(&opts.StableFor, "stable-for", opts.StableFor, "文件大小保持不变多久后视为写入完成")
+	fs.DurationVar(&opts.PollInterval, "poll-interval", opts.PollInterval, "轮询模式的扫描间隔")
+	fs.BoolVar(&opts.ForcePolling, "poll", false, "不使用 inotify，始终轮询")
+	fs.Var(&include, "include", "只处理匹配的文件，如 *.jpg 或 camera/*（可重复）")
+	fs.Var(&exclude, "exclude", "跳过匹配的文件（可重复，优先于 --include）")
+	maxConcurrency := fs.Int("max-concurrency", 0, "同时转换的文件数上限（0 表示使用 concurrent_jobs）")
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if cfg.TargetDir == "" {
+		fmt.Fprintln(os.Stderr, "❌ 请指定监视目录: pixly watch [参数] <目录>")
+		return 2
+	}
+	if *maxConcurrency > 0 && *maxConcurrency < cfg.ConcurrentJobs {
+		cfg.ConcurrentJobs = *maxConcurrency
+	}
+	opts.Include, opts.Exclude = include, exclude
+
+	logger := newLogger(cfg)
+	defer logger.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startMetrics(ctx, logger, cfg)
+
+	conversionEngine := newEngine(logger, cfg)
+	defer conversionEngine.Close()
+
+	watcher, err := watch.New(logger, cfg.TargetDir, opts, func(ctx context.Context, paths []string) error {
+		results, err := conversionEngine.ProcessFiles(ctx, paths)
+		for _, result := range results {
+			logger.Info("文件处理完成",
+				zap.String("file", result.SourcePath),
+				zap.String("status", result.Status),
+				zap.String("message", result.Message))
+		}
+		return err
+	})
+	if err != nil {
+		return exitCode(err)
+	}
+
+	fmt.Printf("👀 正在监视 %s（%s），按 Ctrl+C 退出\n", cfg.TargetDir, watcher.Backend())
+	return exitCode(watcher.Run(ctx))
+}
@@ -0,0 +1,661 @@
+// media_tools/dedup.go - 重复媒体文件检测模块
+//
+// 功能说明：
+// - 按SHA-256找出内容完全相同的文件
+// - 对静态图像解码为缩小的灰度图后计算感知哈希（pHash/dHash），
+//   用BK树按汉明距离聚类，识别另存为其他格式、缩放和重新压缩的副本
+// - 每组保留最佳的一份：分辨率更高 → 品质估计更好 → 元数据更丰富 → 拍摄时间更早；
+//   组内每个副本都在保留文件的阈值之内，不会经由中间副本串联
+// - 其余副本移入垃圾箱，并写入记录每组去留的JSON清单
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pixly/pkg/engine/quality"
+	"pixly/utils"
+)
+
+// dedupOptions 去重参数
+type dedupOptions struct {
+	inputDir   string
+	trashDir   string
+	perceptual bool   // 是否识别近似重复（否则只按SHA-256）
+	algorithm  string // 感知哈希算法: phash | dhash
+	threshold  int    // 视为同一画面的最大汉明距离
+	workers    int
+	dryRun     bool
+}
+
+// 感知去重默认参数：距离6以内在64位哈希上基本只有同一画面的不同副本
+const (
+	defaultDedupAlgorithm = "phash"
+	defaultDedupThreshold = 6
+	hashThumbnailSize     = 32               // ffmpeg解码的灰度缩略图边长
+	dedupDecodeTimeout    = 60 * time.Second // 单个文件解码超时
+	dedupMetadataBatch    = 200              // 每次exiftool调用读取的文件数
+)
+
+// perceptualExts 计算感知哈希的静态图像格式（RAW、PSD和视频只按内容去重）
+var perceptualExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".bmp": true, ".tiff": true, ".tif": true,
+	".heic": true, ".heif": true, ".avif": true, ".jxl": true,
+}
+
+// goDecodableExts 标准库可直接解码的格式，其余格式通过ffmpeg解码
+var goDecodableExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// losslessExts 无损格式，品质估计视为满分
+var losslessExts = map[string]bool{
+	".png": true, ".bmp": true, ".tiff": true, ".tif": true, ".psd": true, ".psb": true,
+	".cr2": true, ".cr3": true, ".nef": true, ".arw": true, ".dng": true, ".raf": true, ".orf": true, ".rw2": true,
+}
+
+// dedupFile 单个文件的去重信息
+type dedupFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sha256  string
+	hash    uint64
+	hashed  bool // 已计算感知哈希
+	width   int
+	height  int
+	quality float64 // 品质估计（0为未知）
+	tags    int     // 元数据标签数
+	takenAt time.Time
+	hashErr error // 解码失败时只按内容去重
+	index   int
+}
+
+// dedupManifest 垃圾箱中的去重清单
+type dedupManifest struct {
+	CreatedAt time.Time      `json:"created_at"`
+	InputDir  string         `json:"input_dir"`
+	TrashDir  string         `json:"trash_dir"`
+	Algorithm string         `json:"algorithm"`
+	Threshold int            `json:"threshold"`
+	Clusters  []dedupCluster `json:"clusters"`
+}
+
+// dedupCluster 一组重复文件：保留一份，其余移入垃圾箱
+type dedupCluster struct {
+	Kept      dedupEntry   `json:"kept"`
+	Discarded []dedupEntry `json:"discarded"`
+}
+
+// dedupEntry 清单中的单个文件
+type dedupEntry struct {
+	Path           string    `json:"path"`
+	TrashPath      string    `json:"trash_path,omitempty"`
+	Size           int64     `json:"size"`
+	Width          int       `json:"width,omitempty"`
+	Height         int       `json:"height,omitempty"`
+	Quality        float64   `json:"quality,omitempty"`
+	MetadataTags   int       `json:"metadata_tags,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+	SHA256         string    `json:"sha256"`
+	PerceptualHash string    `json:"perceptual_hash,omitempty"`
+	Identical      bool      `json:"identical,omitempty"` // 与保留文件内容完全相同
+	Distance       *int      `json:"distance,omitempty"`  // 与保留文件的感知哈希距离
+	Error          string    `json:"error,omitempty"`     // 移入垃圾箱失败的原因
+}
+
+// defaultDedupOptions 自动模式使用的去重参数
+// 自动模式只清理内容完全相同的副本；近似重复需通过 dedup 命令显式处理
+func defaultDedupOptions(inputDir, trashDir string, dryRun bool) dedupOptions {
+	return dedupOptions{
+		inputDir:   inputDir,
+		trashDir:   trashDir,
+		perceptual: false,
+		algorithm:  defaultDedupAlgorithm,
+		threshold:  defaultDedupThreshold,
+		dryRun:     dryRun,
+	}
+}
+
+// runDedupInternal 检测重复和近似重复的媒体文件，保留每组最佳的一份
+func runDedupInternal(opts dedupOptions) {
+	logger.Printf("🔍 扫描媒体文件进行去重: %s", opts.inputDir)
+	logger.Printf("🗑️  垃圾箱目录: %s", opts.trashDir)
+	if opts.perceptual {
+		logger.Printf("🧠 感知哈希: %s, 最大汉明距离: %d", opts.algorithm, opts.threshold)
+	} else {
+		logger.Printf("🧠 感知哈希: 关闭（仅按内容去重）")
+	}
+
+	if !opts.dryRun {
+		if err := os.MkdirAll(opts.trashDir, 0755); err != nil {
+			logger.Printf("❌ 创建垃圾箱目录失败: %v", err)
+			return
+		}
+	}
+
+	paths, err := utils.WalkMedia(opts.inputDir, mediaExtensions, opts.trashDir)
+	if err != nil {
+		logger.Printf("❌ 扫描媒体文件失败: %v", err)
+		return
+	}
+	sort.Strings(paths)
+	logger.Printf("📊 找到 %d 个媒体文件,开始计算哈希值...", len(paths))
+
+	files := analyzeDedupFiles(paths, opts)
+	// 择优需要元数据，先只为可能重复的文件读取，再以每组最佳副本为中心聚类
+	if candidates := duplicateCandidates(files, opts); len(candidates) > 0 && commandAvailable("exiftool") {
+		for start := 0; start < len(candidates); start += dedupMetadataBatch {
+			readDedupMetadata(candidates[start:min(start+dedupMetadataBatch, len(candidates))])
+		}
+	}
+	groups := clusterDuplicates(files, opts)
+	if len(groups) == 0 {
+		logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		logger.Printf("✅ 未发现重复文件")
+		logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		return
+	}
+
+	manifest := dedupManifest{
+		CreatedAt: time.Now(),
+		InputDir:  opts.inputDir,
+		TrashDir:  opts.trashDir,
+		Algorithm: manifestAlgorithm(opts),
+		Threshold: opts.threshold,
+	}
+	duplicates, moved := 0, 0
+	for _, group := range groups {
+		kept := group[0]
+		cluster := dedupCluster{Kept: manifestEntry(kept, kept)}
+
+		for _, file := range group[1:] {
+			duplicates++
+			entry := manifestEntry(file, kept)
+			logger.Printf("🔍 发现重复: %s <-> %s (%s)", filepath.Base(file.path), filepath.Base(kept.path), duplicateReason(entry))
+
+			if opts.dryRun {
+				logger.Printf("🔍 [试运行] 将移动: %s", filepath.Base(file.path))
+				moved++
+			} else if trashPath, err := moveToTrash(file.path, opts.inputDir, opts.trashDir); err != nil {
+				logger.Printf("❌ 移动失败: %s: %v", filepath.Base(file.path), err)
+				entry.Error = err.Error()
+			} else {
+				logger.Printf("✅ 已移动到垃圾箱: %s", filepath.Base(file.path))
+				entry.TrashPath = trashPath
+				moved++
+			}
+			cluster.Discarded = append(cluster.Discarded, entry)
+		}
+		manifest.Clusters = append(manifest.Clusters, cluster)
+	}
+
+	if !opts.dryRun {
+		if path, err := writeDedupManifest(opts.trashDir, manifest); err != nil {
+			logger.Printf("⚠️  写入去重清单失败: %v", err)
+		} else {
+			logger.Printf("📝 去重清单: %s", path)
+		}
+	}
+
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Printf("📊 去重完成: 重复组 %d, 发现重复 %d, 已移动 %d", len(groups), duplicates, moved)
+	logger.Printf("✅ 唯一文件: %d 个", len(files)-duplicates)
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+// analyzeDedupFiles 并发计算每个文件的SHA-256和感知哈希，无法读取的文件不参与去重
+func analyzeDedupFiles(paths []string, opts dedupOptions) []*dedupFile {
+	workers := opts.workers
+	if workers <= 0 {
+		workers = min(runtime.NumCPU(), 8)
+	}
+
+	results := make([]*dedupFile, len(paths))
+	var processed int32
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 用于保护日志输出
+	indexes := make(chan int, len(paths))
+	for i := range paths {
+		indexes <- i
+	}
+	close(indexes)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				file, err := analyzeDedupFile(paths[i], opts)
+				current := atomic.AddInt32(&processed, 1)
+
+				mu.Lock()
+				if err != nil {
+					logger.Printf("⚠️  计算哈希失败: %s: %v", filepath.Base(paths[i]), err)
+				} else if file.hashErr != nil {
+					logger.Printf("⚠️  无法解码，仅按内容去重: %s: %v", filepath.Base(paths[i]), file.hashErr)
+				}
+				if current%50 == 0 || int(current) == len(paths) {
+					logger.Printf("⏳ 去重进度: %d/%d (%.1f%%)", current, len(paths), float64(current)/float64(len(paths))*100)
+				}
+				mu.Unlock()
+				results[i] = file
+			}
+		}()
+	}
+	wg.Wait()
+
+	files := make([]*dedupFile, 0, len(results))
+	for _, file := range results {
+		if file != nil {
+			file.index = len(files)
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// analyzeDedupFile 计算单个文件的去重信息；解码失败只记录在 hashErr 中
+func analyzeDedupFile(path string, opts dedupOptions) (*dedupFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := calculateHash(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &dedupFile{path: path, size: info.Size(), modTime: info.ModTime(), sha256: sum}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".jpg" || ext == ".jpeg" {
+		// 由量化表估计libjpeg等效品质，无法解析时视为未知
+		if header, err := quality.ParseJpegFile(path); err == nil {
+			file.quality = float64(header.EstimatedQuality)
+		}
+	} else if losslessExts[ext] {
+		file.quality = 100
+	}
+
+	if !opts.perceptual || !perceptualExts[ext] {
+		return file, nil
+	}
+	img, width, height, err := decodeForHash(path)
+	if err != nil {
+		file.hashErr = err
+		return file, nil
+	}
+	file.width, file.height = width, height
+	if opts.algorithm == "dhash" {
+		file.hash = utils.DifferenceHash(img)
+	} else {
+		file.hash = utils.PerceptualHash(img)
+	}
+	file.hashed = true
+	return file, nil
+}
+
+// decodeForHash 解码图像用于计算感知哈希，返回图像和原始尺寸
+// 标准库可解码的格式直接解码，其余格式由ffmpeg输出32x32灰度图
+func decodeForHash(path string) (image.Image, int, int, error) {
+	if goDecodableExts[strings.ToLower(filepath.Ext(path))] {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		defer f.Close()
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("解码失败: %w", err)
+		}
+		return img, img.Bounds().Dx(), img.Bounds().Dy(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dedupDecodeTimeout)
+	defer cancel()
+
+	width, height, err := probeDimensions(ctx, path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	scale := fmt.Sprintf("scale=%d:%d:flags=area,format=gray", hashThumbnailSize, hashThumbnailSize)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-v", "error", "-i", path,
+		"-frames:v", "1", "-vf", scale, "-f", "rawvideo", "-")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, 0, 0, fmt.Errorf("ffmpeg解码失败: %v (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() != hashThumbnailSize*hashThumbnailSize {
+		return nil, 0, 0, fmt.Errorf("ffmpeg输出大小异常: %d 字节", stdout.Len())
+	}
+	img := image.NewGray(image.Rect(0, 0, hashThumbnailSize, hashThumbnailSize))
+	copy(img.Pix, stdout.Bytes())
+	return img, width, height, nil
+}
+
+// probeDimensions 使用ffprobe读取第一个视频流的尺寸
+func probeDimensions(ctx context.Context, path string) (int, int, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height", "-of", "csv=p=0:s=x", path).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe失败: %v", err)
+	}
+	line := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	w, h, ok := strings.Cut(line, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("无法解析图像尺寸: %q", line)
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil {
+		return 0, 0, fmt.Errorf("无法解析图像尺寸: %q", line)
+	}
+	return width, height, nil
+}
+
+// duplicateCandidates 返回存在相同内容或感知哈希近邻的文件，只有它们需要读取元数据参与择优
+func duplicateCandidates(files []*dedupFile, opts dedupOptions) []*dedupFile {
+	bySHA := make(map[string]int, len(files))
+	tree := &bkTree{}
+	for _, file := range files {
+		bySHA[file.sha256]++
+		if opts.perceptual && file.hashed {
+			tree.insert(file.hash, file.index)
+		}
+	}
+	var candidates []*dedupFile
+	for _, file := range files {
+		// 搜索结果包含文件自身
+		if bySHA[file.sha256] > 1 || (opts.perceptual && file.hashed && len(tree.search(file.hash, opts.threshold)) > 1) {
+			candidates = append(candidates, file)
+		}
+	}
+	return candidates
+}
+
+// clusterDuplicates 按SHA-256和感知哈希距离聚类，返回至少包含两个文件的组
+//
+// 文件按 betterCopy 从优到劣依次处理：内容与已有组成员相同的并入该组，
+// 否则并入距离阈值内最近的组代表，都没有时自成一组并作为代表。
+// 组代表即组内最佳副本，排在每组第一位，其余成员与它的距离都不超过阈值，
+// 因此 A≈B≈C 但 A、C 相距过远时不会被串成一组。
+func clusterDuplicates(files []*dedupFile, opts dedupOptions) [][]*dedupFile {
+	ordered := make([]*dedupFile, len(files))
+	copy(ordered, files)
+	sort.SliceStable(ordered, func(i, j int) bool { return betterCopy(ordered[i], ordered[j]) })
+
+	var clusters [][]*dedupFile
+	bySHA := make(map[string]int)
+	representatives := &bkTree{} // 组代表的感知哈希，序号为组序号
+	for _, file := range ordered {
+		cluster, ok := bySHA[file.sha256]
+		if !ok && opts.perceptual && file.hashed {
+			best := opts.threshold + 1
+			for _, candidate := range representatives.search(file.hash, opts.threshold) {
+				distance := utils.HammingDistance(clusters[candidate][0].hash, file.hash)
+				if distance < best || (distance == best && candidate < cluster) {
+					cluster, best, ok = candidate, distance, true
+				}
+			}
+		}
+		if !ok {
+			cluster = len(clusters)
+			clusters = append(clusters, nil)
+			if opts.perceptual && file.hashed {
+				representatives.insert(file.hash, cluster)
+			}
+		}
+		clusters[cluster] = append(clusters[cluster], file)
+		if _, seen := bySHA[file.sha256]; !seen {
+			bySHA[file.sha256] = cluster
+		}
+	}
+
+	var groups [][]*dedupFile
+	for _, members := range clusters {
+		if len(members) > 1 {
+			groups = append(groups, members)
+		}
+	}
+	return groups
+}
+
+// bkTree 按汉明距离组织感知哈希的BK树，用于查找距离阈值内的近邻
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     uint64
+	index    int
+	children map[int]*bkNode
+}
+
+// insert 插入哈希及其文件序号
+func (t *bkTree) insert(hash uint64, index int) {
+	node := &bkNode{hash: hash, index: index}
+	if t.root == nil {
+		t.root = node
+		return
+	}
+	current := t.root
+	for {
+		distance := utils.HammingDistance(current.hash, hash)
+		child, ok := current.children[distance]
+		if !ok {
+			if current.children == nil {
+				current.children = make(map[int]*bkNode)
+			}
+			current.children[distance] = node
+			return
+		}
+		current = child
+	}
+}
+
+// search 返回与 hash 距离不超过 radius 的所有文件序号
+func (t *bkTree) search(hash uint64, radius int) []int {
+	if t.root == nil {
+		return nil
+	}
+	var matches []int
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		distance := utils.HammingDistance(node.hash, hash)
+		if distance <= radius {
+			matches = append(matches, node.index)
+		}
+		// 三角不等式：只有距离在 [d-r, d+r] 内的子树可能包含匹配
+		for d, child := range node.children {
+			if d >= distance-radius && d <= distance+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return matches
+}
+
+// readDedupMetadata 用exiftool批量读取一组文件的元数据标签数和拍摄时间
+func readDedupMetadata(group []*dedupFile) {
+	args := []string{"-j", "-q", "-q", "-G"}
+	for _, file := range group {
+		args = append(args, file.path)
+	}
+	out, err := exec.Command("exiftool", args...).Output()
+	if len(out) == 0 {
+		if err != nil {
+			logger.Printf("⚠️  读取元数据失败: %v", err)
+		}
+		return
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(out, &records); err != nil {
+		logger.Printf("⚠️  解析元数据失败: %v", err)
+		return
+	}
+
+	bySource := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		if source, ok := record["SourceFile"].(string); ok {
+			bySource[filepath.Clean(source)] = record
+		}
+	}
+	for _, file := range group {
+		record := bySource[filepath.Clean(file.path)]
+		for tag, value := range record {
+			if tag == "SourceFile" || strings.HasPrefix(tag, "File:") || strings.HasPrefix(tag, "ExifTool:") || strings.HasPrefix(tag, "System:") {
+				continue
+			}
+			file.tags++
+			if strings.HasSuffix(tag, ":DateTimeOriginal") || strings.HasSuffix(tag, ":CreateDate") {
+				if s, ok := value.(string); ok {
+					if t, err := time.ParseInLocation("2006:01:02 15:04:05", s[:min(len(s), 19)], time.Local); err == nil {
+						if file.takenAt.IsZero() || t.Before(file.takenAt) {
+							file.takenAt = t
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// timestamp 拍摄时间，没有EXIF时间时使用修改时间
+func (f *dedupFile) timestamp() time.Time {
+	if !f.takenAt.IsZero() {
+		return f.takenAt
+	}
+	return f.modTime
+}
+
+// betterCopy 判断 a 是否比 b 更值得保留：
+// 分辨率更高 → 品质估计更好 → 元数据更丰富 → 时间更早 → 路径更短
+func betterCopy(a, b *dedupFile) bool {
+	if pa, pb := a.width*a.height, b.width*b.height; pa != pb {
+		return pa > pb
+	}
+	// 两者都有品质估计且差距明显时才比较
+	if a.quality > 0 && b.quality > 0 && (a.quality-b.quality > 2 || b.quality-a.quality > 2) {
+		return a.quality > b.quality
+	}
+	if a.tags != b.tags {
+		return a.tags > b.tags
+	}
+	if ta, tb := a.timestamp(), b.timestamp(); !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	if len(a.path) != len(b.path) {
+		return len(a.path) < len(b.path)
+	}
+	return a.path < b.path
+}
+
+// manifestEntry 生成清单条目，并记录与保留文件的关系
+func manifestEntry(file, kept *dedupFile) dedupEntry {
+	entry := dedupEntry{
+		Path:         file.path,
+		Size:         file.size,
+		Width:        file.width,
+		Height:       file.height,
+		Quality:      float64(int(file.quality*10)) / 10,
+		MetadataTags: file.tags,
+		Timestamp:    file.timestamp(),
+		SHA256:       file.sha256,
+	}
+	if file.hashed {
+		entry.PerceptualHash = fmt.Sprintf("%016x", file.hash)
+	}
+	if file == kept {
+		return entry
+	}
+	entry.Identical = file.sha256 == kept.sha256
+	if file.hashed && kept.hashed {
+		distance := utils.HammingDistance(file.hash, kept.hash)
+		entry.Distance = &distance
+	}
+	return entry
+}
+
+// duplicateReason 日志中说明判定为重复的依据
+func duplicateReason(entry dedupEntry) string {
+	if entry.Identical {
+		return "内容相同 " + entry.SHA256[:8] + "..."
+	}
+	if entry.Distance != nil {
+		return fmt.Sprintf("感知哈希距离 %d", *entry.Distance)
+	}
+	return "近似重复"
+}
+
+// manifestAlgorithm 清单中记录的判定方式
+func manifestAlgorithm(opts dedupOptions) string {
+	if !opts.perceptual {
+		return "sha256"
+	}
+	return "sha256+" + opts.algorithm
+}
+
+// moveToTrash 将文件移入垃圾箱，保留相对输入目录的路径，同名时追加序号
+func moveToTrash(path, inputDir, trashDir string) (string, error) {
+	rel, err := filepath.Rel(inputDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	target := filepath.Join(trashDir, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	for i := 1; fileExists(target); i++ {
+		target = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// writeDedupManifest 在垃圾箱中写入本次去重的清单
+func writeDedupManifest(trashDir string, manifest dedupManifest) (string, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(trashDir, "dedup-manifest-"+manifest.CreatedAt.Format("20060102-150405")+".json")
+	for i := 1; fileExists(path); i++ {
+		path = filepath.Join(trashDir, fmt.Sprintf("dedup-manifest-%s_%d.json", manifest.CreatedAt.Format("20060102-150405"), i))
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// commandAvailable 检查外部命令是否在PATH中
+func commandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"pixly/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hashFile 构造已计算感知哈希的去重文件
+func hashFile(path string, hash uint64, width int) *dedupFile {
+	return &dedupFile{path: path, sha256: path, hash: hash, hashed: true, width: width, height: width}
+}
+
+// groupPaths 返回各组文件路径，便于断言
+func groupPaths(groups [][]*dedupFile) [][]string {
+	var paths [][]string
+	for _, group := range groups {
+		var names []string
+		for _, file := range group {
+			names = append(names, file.path)
+		}
+		paths = append(paths, names)
+	}
+	return paths
+}
+
+// TestBKTree_SearchMatchesBruteForce 测试BK树搜索结果与逐个比较一致
+func TestBKTree_SearchMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := rng.Uint64()
+	hashes := make([]uint64, 200)
+	tree := &bkTree{}
+	for i := range hashes {
+		// 在同一基准附近翻转少量位，使各半径下都有命中
+		hashes[i] = base
+		for flips := rng.Intn(12); flips > 0; flips-- {
+			hashes[i] ^= 1 << rng.Intn(64)
+		}
+		tree.insert(hashes[i], i)
+	}
+
+	tests := []struct {
+		name   string
+		query  uint64
+		radius int
+	}{
+		{name: "半径0", query: hashes[7], radius: 0},
+		{name: "半径3", query: base, radius: 3},
+		{name: "半径6", query: hashes[42], radius: 6},
+		{name: "远离所有哈希", query: ^base, radius: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []int
+			for i, hash := range hashes {
+				if utils.HammingDistance(hash, tt.query) <= tt.radius {
+					want = append(want, i)
+				}
+			}
+			got := tree.search(tt.query, tt.radius)
+			sort.Ints(got)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	assert.Empty(t, (&bkTree{}).search(base, 64), "空树")
+}
+
+// TestBetterCopy 测试保留副本的择优顺序
+func TestBetterCopy(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		a, b dedupFile
+		want bool
+	}{
+		{name: "分辨率更高优先", a: dedupFile{path: "a", width: 200, height: 200, quality: 50}, b: dedupFile{path: "b", width: 100, height: 100, quality: 95}, want: true},
+		{name: "品质差距明显", a: dedupFile{path: "a", quality: 90}, b: dedupFile{path: "b", quality: 80, tags: 30}, want: true},
+		{name: "品质差距在2以内时比较元数据", a: dedupFile{path: "a", quality: 91}, b: dedupFile{path: "b", quality: 90, tags: 30}, want: false},
+		{name: "品质未知时比较元数据", a: dedupFile{path: "a", tags: 10}, b: dedupFile{path: "b", quality: 95, tags: 5}, want: true},
+		{name: "拍摄时间更早", a: dedupFile{path: "a", takenAt: early, modTime: late}, b: dedupFile{path: "b", takenAt: late, modTime: early}, want: true},
+		{name: "无拍摄时间时用修改时间", a: dedupFile{path: "a", modTime: late}, b: dedupFile{path: "b", modTime: early}, want: false},
+		{name: "路径更短", a: dedupFile{path: "dir/a.jpg"}, b: dedupFile{path: "dir/copy/a.jpg"}, want: true},
+		{name: "路径字典序", a: dedupFile{path: "b.jpg"}, b: dedupFile{path: "a.jpg"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, betterCopy(&tt.a, &tt.b))
+			assert.Equal(t, !tt.want, betterCopy(&tt.b, &tt.a), "交换顺序")
+		})
+	}
+}
+
+// TestClusterDuplicates 测试按内容和感知哈希聚类，组内成员都在保留文件的阈值之内
+func TestClusterDuplicates(t *testing.T) {
+	const fourBits, eightBits = 0x0F, 0xFF
+
+	tests := []struct {
+		name       string
+		files      []*dedupFile
+		perceptual bool
+		want       [][]string
+	}{
+		{
+			name:       "内容相同",
+			files:      []*dedupFile{{path: "b.mov", sha256: "x"}, {path: "a.mov", sha256: "x"}, {path: "c.mov", sha256: "y"}},
+			perceptual: true,
+			want:       [][]string{{"a.mov", "b.mov"}},
+		},
+		{
+			name:       "最佳副本排在第一位",
+			files:      []*dedupFile{hashFile("small.jpg", 0, 100), hashFile("large.png", 1, 400), hashFile("medium.webp", 3, 200)},
+			perceptual: true,
+			want:       [][]string{{"large.png", "medium.webp", "small.jpg"}},
+		},
+		{
+			name:       "感知哈希关闭",
+			files:      []*dedupFile{hashFile("small.jpg", 0, 100), hashFile("large.png", 1, 400)},
+			perceptual: false,
+		},
+		{
+			// A≈B、B≈C，但A与C相距8：C不能经由B并入A的组
+			name:       "不串联",
+			files:      []*dedupFile{hashFile("a.png", 0, 400), hashFile("b.png", fourBits, 200), hashFile("c.png", eightBits, 100)},
+			perceptual: true,
+			want:       [][]string{{"a.png", "b.png"}},
+		},
+		{
+			name:       "并入距离最近的代表",
+			files:      []*dedupFile{hashFile("a.png", 0, 400), hashFile("b.png", eightBits, 300), hashFile("c.png", 0x3F, 100)},
+			perceptual: true,
+			want:       [][]string{{"b.png", "c.png"}},
+		},
+		{
+			name: "与成员内容相同的副本并入该组",
+			files: []*dedupFile{
+				hashFile("a.png", 0, 400),
+				hashFile("b.png", fourBits, 200),
+				{path: "b-copy.png", sha256: "b.png", hash: fourBits, hashed: true, width: 200, height: 200},
+			},
+			perceptual: true,
+			want:       [][]string{{"a.png", "b.png", "b-copy.png"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, file := range tt.files {
+				file.index = i
+			}
+			opts := dedupOptions{perceptual: tt.perceptual, threshold: 6}
+			groups := clusterDuplicates(tt.files, opts)
+			assert.Equal(t, tt.want, groupPaths(groups))
+
+			for _, group := range groups {
+				kept := group[0]
+				for _, file := range group[1:] {
+					assert.True(t, betterCopy(kept, file) || kept.sha256 == file.sha256, "%s 应优于 %s", kept.path, file.path)
+					if tt.perceptual && file.hashed {
+						assert.LessOrEqual(t, utils.HammingDistance(kept.hash, file.hash), opts.threshold)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestDuplicateCandidates 测试只有存在相同内容或近邻的文件需要读取元数据
+func TestDuplicateCandidates(t *testing.T) {
+	files := []*dedupFile{
+		hashFile("a.png", 0, 100),
+		hashFile("b.png", 0x0F, 100),
+		hashFile("far.png", ^uint64(0), 100),
+		{path: "x.mov", sha256: "x"},
+		{path: "y.mov", sha256: "x"},
+		{path: "z.mov", sha256: "z"},
+	}
+	for i, file := range files {
+		file.index = i
+	}
+
+	var paths []string
+	for _, file := range duplicateCandidates(files, dedupOptions{perceptual: true, threshold: 6}) {
+		paths = append(paths, file.path)
+	}
+	assert.Equal(t, []string{"a.png", "b.png", "x.mov", "y.mov"}, paths)
+}
+
+// TestAnalyzeDedupFile_Quality 测试JPEG品质由量化表估计，无损格式视为满分
+func TestAnalyzeDedupFile_Quality(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	writeImage := func(name string, encode func(f *os.File) error) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, encode(f))
+		require.NoError(t, f.Close())
+		return path
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want float64
+	}{
+		{name: "JPEG品质90", path: writeImage("q90.jpg", func(f *os.File) error { return jpeg.Encode(f, img, &jpeg.Options{Quality: 90}) }), want: 90},
+		{name: "JPEG品质60", path: writeImage("q60.jpeg", func(f *os.File) error { return jpeg.Encode(f, img, &jpeg.Options{Quality: 60}) }), want: 60},
+		{name: "PNG", path: writeImage("a.png", func(f *os.File) error { return png.Encode(f, img) }), want: 100},
+		{name: "无法解析的JPEG品质未知", path: writeImage("broken.jpg", func(f *os.File) error { _, err := f.WriteString("not a jpeg"); return err }), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := analyzeDedupFile(tt.path, dedupOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, file.quality)
+		})
+	}
+}
+
+// TestDefaultDedupOptions 测试自动模式只清理内容完全相同的副本
+func TestDefaultDedupOptions(t *testing.T) {
+	opts := defaultDedupOptions("in", "trash", false)
+	require.False(t, opts.perceptual)
+	assert.Equal(t, "sha256", manifestAlgorithm(opts))
+}
@@ -0,0 +1,552 @@
+// media_tools/export.go - 兼容性导出模块
+//
+// 功能说明：
+// - 遍历已转换的媒体目录，将 JXL/AVIF 导出为通用格式副本
+// - 由JPEG无损转码的JXL通过 djxl 逐位还原原始JPEG
+// - 其余JXL/静态AVIF导出为高质量JPEG或PNG，动画AVIF导出为GIF或MP4
+// - 输出目录保持原有相对路径，复制元数据并保留修改时间
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"pixly/utils"
+)
+
+// exportOptions 导出参数
+type exportOptions struct {
+	inputDir       string
+	outputDir      string
+	stillFormat    string // 静态图导出格式: jpg | png
+	animatedFormat string // 动画导出格式: gif | mp4
+	jpegQuality    int
+	copyCompatible bool // 同时复制已兼容的文件（JPEG/PNG/GIF/MP4等）
+	overwrite      bool
+	dryRun         bool
+	workers        int
+}
+
+// exportKind 单个文件的导出方式
+type exportKind string
+
+const (
+	exportReconstruct exportKind = "reconstruct" // djxl逐位还原JPEG
+	exportStill       exportKind = "still"       // 解码后编码为JPEG/PNG
+	exportAnimated    exportKind = "animated"    // 动画转GIF/MP4
+	exportCopy        exportKind = "copy"        // 已兼容格式，原样复制
+)
+
+// exportSourceExts 需要导出的格式
+var exportSourceExts = map[string]bool{".jxl": true, ".avif": true}
+
+// exportCompatibleExts 已被主流软件支持、可原样复制的格式
+var exportCompatibleExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".mp4": true, ".mov": true, ".m4v": true,
+}
+
+// jxlContainerSignature JXL ISOBMFF容器签名
+var jxlContainerSignature = []byte{0x00, 0x00, 0x00, 0x0C, 'J', 'X', 'L', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+
+// ====== 兼容性导出功能 ======
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	inputDir := fs.String("dir", "", "📂 已转换的媒体目录（必需）")
+	outputDir := fs.String("out", "", "📤 兼容性副本输出目录（必需）")
+	stillFormat := fs.String("format", "jpg", "🖼️  静态图导出格式: jpg 或 png")
+	animatedFormat := fs.String("animated", "gif", "🎞️  动画导出格式: gif 或 mp4")
+	jpegQuality := fs.Int("jpeg-quality", 95, "🎨 JPEG导出质量 (1-100)")
+	copyCompatible := fs.Bool("copy-compatible", false, "📋 同时复制已兼容的文件（JPEG/PNG/GIF/MP4）")
+	overwrite := fs.Bool("overwrite", false, "♻️  覆盖输出目录中已存在的文件")
+	workers := fs.Int("workers", 0, "⚡ 并发线程数（0为自动）")
+	dryRun := fs.Bool("dry-run", false, "🔍 试运行模式，不实际执行")
+
+	fs.Parse(args)
+
+	if *inputDir == "" || *outputDir == "" {
+		logger.Println("❌ 错误: 必须指定输入目录 (-dir) 和输出目录 (-out)")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	opts := exportOptions{
+		inputDir:       *inputDir,
+		outputDir:      *outputDir,
+		stillFormat:    strings.TrimPrefix(strings.ToLower(*stillFormat), "."),
+		animatedFormat: strings.TrimPrefix(strings.ToLower(*animatedFormat), "."),
+		jpegQuality:    *jpegQuality,
+		copyCompatible: *copyCompatible,
+		overwrite:      *overwrite,
+		dryRun:         *dryRun,
+		workers:        *workers,
+	}
+	if opts.stillFormat == "jpeg" {
+		opts.stillFormat = "jpg"
+	}
+	if opts.stillFormat != "jpg" && opts.stillFormat != "png" {
+		logger.Fatalf("❌ 不支持的静态图导出格式: %s（可选 jpg、png）", *stillFormat)
+	}
+	if opts.animatedFormat != "gif" && opts.animatedFormat != "mp4" {
+		logger.Fatalf("❌ 不支持的动画导出格式: %s（可选 gif、mp4）", *animatedFormat)
+	}
+	if opts.jpegQuality < 1 || opts.jpegQuality > 100 {
+		logger.Fatalf("❌ JPEG质量必须在 1-100 之间: %d", opts.jpegQuality)
+	}
+
+	absIn, err := filepath.Abs(opts.inputDir)
+	if err != nil {
+		logger.Fatalf("❌ 解析输入目录失败: %v", err)
+	}
+	absOut, err := filepath.Abs(opts.outputDir)
+	if err != nil {
+		logger.Fatalf("❌ 解析输出目录失败: %v", err)
+	}
+	if absIn == absOut {
+		logger.Fatalf("❌ 输出目录不能与输入目录相同: %s", absOut)
+	}
+	opts.inputDir, opts.outputDir = absIn, absOut
+
+	runExportInternal(opts)
+}
+
+// runExportInternal 并发导出兼容性副本
+func runExportInternal(opts exportOptions) {
+	logger.Printf("📤 开始导出兼容性副本...")
+	logger.Printf("📂 输入目录: %s", opts.inputDir)
+	logger.Printf("📤 输出目录: %s", opts.outputDir)
+	logger.Printf("🖼️  静态图格式: %s, 动画格式: %s, JPEG质量: %d", opts.stillFormat, opts.animatedFormat, opts.jpegQuality)
+	logger.Printf("🔍 试运行: %v", opts.dryRun)
+
+	exts := make(map[string]bool, len(exportSourceExts)+len(exportCompatibleExts))
+	for ext := range exportSourceExts {
+		exts[ext] = true
+	}
+	if opts.copyCompatible {
+		for ext := range exportCompatibleExts {
+			exts[ext] = true
+		}
+	}
+
+	// 输出目录位于输入目录内时跳过，避免重复导出
+	files, err := utils.WalkMedia(opts.inputDir, exts, opts.outputDir)
+	if err != nil {
+		logger.Printf("❌ 扫描媒体文件失败: %v", err)
+		return
+	}
+
+	logger.Printf("📊 找到 %d 个待导出文件", len(files))
+	if len(files) == 0 {
+		logger.Printf("✅ 无需导出")
+		return
+	}
+
+	workers := opts.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+		if workers > 8 {
+			workers = 8 // 限制最大并发数
+		}
+	}
+	logger.Printf("⚡ 并发线程数: %d", workers)
+
+	var reconstructed, converted, animated, copied, skipped, failed int32
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 用于保护日志输出和目标路径登记
+
+	// 不同源文件可能映射到同一目标（如 a.jxl 与 a.avif），先到先得
+	claimed := make(map[string]string)
+
+	fileChan := make(chan string, len(files))
+	processed := int32(0)
+	total := int32(len(files))
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for src := range fileChan {
+				kind, dst, err := planExport(src, opts)
+				if err == nil {
+					mu.Lock()
+					if owner, ok := claimed[dst]; ok {
+						err = fmt.Errorf("目标文件与 %s 冲突", filepath.Base(owner))
+					} else {
+						claimed[dst] = src
+					}
+					mu.Unlock()
+				}
+
+				switch {
+				case err != nil:
+					mu.Lock()
+					logger.Printf("❌ 导出失败: %s: %v", filepath.Base(src), err)
+					mu.Unlock()
+					atomic.AddInt32(&failed, 1)
+				case !opts.overwrite && fileExists(dst):
+					atomic.AddInt32(&skipped, 1)
+				case opts.dryRun:
+					mu.Lock()
+					logger.Printf("🔍 [试运行] 将导出(%s): %s -> %s", kind, filepath.Base(src), dst)
+					mu.Unlock()
+					countExport(kind, &reconstructed, &converted, &animated, &copied)
+				default:
+					if err := exportFile(src, dst, kind, opts); err != nil {
+						mu.Lock()
+						logger.Printf("❌ 导出失败: %s: %v", filepath.Base(src), err)
+						mu.Unlock()
+						atomic.AddInt32(&failed, 1)
+					} else {
+						countExport(kind, &reconstructed, &converted, &animated, &copied)
+					}
+				}
+
+				current := atomic.AddInt32(&processed, 1)
+				// 每50个文件或最后一个文件显示进度
+				if current%50 == 0 || current == total {
+					mu.Lock()
+					logger.Printf("⏳ 导出进度: %d/%d (%.1f%%)", current, total, float64(current)/float64(total)*100)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, file := range files {
+		fileChan <- file
+	}
+	close(fileChan)
+
+	wg.Wait()
+
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Printf("📊 导出完成: JPEG还原 %d, 静态图转码 %d, 动画转码 %d, 原样复制 %d", reconstructed, converted, animated, copied)
+	logger.Printf("⏭️  已存在跳过: %d, ❌ 失败: %d", skipped, failed)
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+// countExport 按导出方式计数
+func countExport(kind exportKind, reconstructed, converted, animated, copied *int32) {
+	switch kind {
+	case exportReconstruct:
+		atomic.AddInt32(reconstructed, 1)
+	case exportStill:
+		atomic.AddInt32(converted, 1)
+	case exportAnimated:
+		atomic.AddInt32(animated, 1)
+	case exportCopy:
+		atomic.AddInt32(copied, 1)
+	}
+}
+
+// planExport 确定导出方式与目标路径（保持相对目录结构）
+func planExport(src string, opts exportOptions) (exportKind, string, error) {
+	rel, err := filepath.Rel(opts.inputDir, src)
+	if err != nil {
+		return "", "", fmt.Errorf("计算相对路径失败: %w", err)
+	}
+	base := filepath.Join(opts.outputDir, strings.TrimSuffix(rel, filepath.Ext(rel)))
+
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".jxl":
+		hasJbrd, err := hasJPEGReconstructionData(src)
+		if err != nil {
+			return "", "", fmt.Errorf("读取JXL容器失败: %w", err)
+		}
+		if hasJbrd {
+			return exportReconstruct, base + ".jpg", nil
+		}
+		return exportStill, base + "." + opts.stillFormat, nil
+	case ".avif":
+		isAnimated, err := isAnimatedAVIF(src)
+		if err != nil {
+			return "", "", fmt.Errorf("读取AVIF文件头失败: %w", err)
+		}
+		if isAnimated {
+			return exportAnimated, base + "." + opts.animatedFormat, nil
+		}
+		return exportStill, base + "." + opts.stillFormat, nil
+	default:
+		return exportCopy, filepath.Join(opts.outputDir, rel), nil
+	}
+}
+
+// exportFile 执行单个文件导出：先写入临时文件，成功后再重命名到目标位置
+func exportFile(src, dst string, kind exportKind, opts exportOptions) error {
+	if err := utils.EnsureDir(filepath.Dir(dst)); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	// 临时文件保留目标扩展名，外部工具依据扩展名选择编码器
+	tmp := filepath.Join(filepath.Dir(dst), ".export_"+strconv.Itoa(os.Getpid())+"_"+filepath.Base(dst))
+	defer os.Remove(tmp)
+
+	var err error
+	switch kind {
+	case exportReconstruct:
+		err = reconstructJPEG(src, tmp)
+	case exportStill:
+		err = exportStillImage(src, tmp, opts)
+	case exportAnimated:
+		err = exportAnimation(src, tmp, opts.animatedFormat)
+	case exportCopy:
+		err = copyFile(src, tmp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if info, statErr := os.Stat(tmp); statErr != nil || info.Size() == 0 {
+		return fmt.Errorf("输出文件为空或不存在")
+	}
+
+	// 还原的JPEG已逐位包含原始元数据，原样复制的文件也无需再写入
+	if kind == exportStill || kind == exportAnimated {
+		if err := utils.CopyMetadataWithTimeout(context.Background(), src, tmp, 10); err != nil {
+			logger.Printf("⚠️  元数据复制失败: %s: %v", filepath.Base(src), err)
+		}
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("写入目标文件失败: %w", err)
+	}
+
+	if info, err := os.Stat(src); err == nil {
+		if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+			logger.Printf("⚠️  保留修改时间失败: %s: %v", filepath.Base(dst), err)
+		}
+	}
+	return nil
+}
+
+// reconstructJPEG 使用 djxl 从 jbrd 数据逐位还原原始JPEG
+func reconstructJPEG(src, dst string) error {
+	out, err := exec.Command("djxl", src, dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("djxl还原JPEG失败: %v, 输出: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	header := make([]byte, 2)
+	f, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.ReadFull(f, header); err != nil || header[0] != 0xFF || header[1] != 0xD8 {
+		return fmt.Errorf("djxl输出不是JPEG文件")
+	}
+	return nil
+}
+
+// exportStillImage 解码JXL/AVIF并编码为高质量JPEG或PNG
+func exportStillImage(src, dst string, opts exportOptions) error {
+	ext := strings.ToLower(filepath.Ext(src))
+
+	// JXL 先用 djxl 解码为无损PNG，需要JPEG时再编码
+	if ext == ".jxl" {
+		if opts.stillFormat == "png" {
+			if out, err := exec.Command("djxl", src, dst).CombinedOutput(); err != nil {
+				return fmt.Errorf("djxl解码失败: %v, 输出: %s", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}
+
+		pngTmp := strings.TrimSuffix(dst, filepath.Ext(dst)) + ".png"
+		defer os.Remove(pngTmp)
+		if out, err := exec.Command("djxl", src, pngTmp).CombinedOutput(); err != nil {
+			return fmt.Errorf("djxl解码失败: %v, 输出: %s", err, strings.TrimSpace(string(out)))
+		}
+		src = pngTmp
+	}
+
+	return encodeStillImage(src, dst, opts.stillFormat, opts.jpegQuality)
+}
+
+// encodeStillImage 优先使用 ImageMagick 编码，失败时回退到 ffmpeg
+func encodeStillImage(src, dst, format string, quality int) error {
+	magickArgs := []string{src + "[0]"}
+	if format == "jpg" {
+		magickArgs = append(magickArgs, "-quality", strconv.Itoa(quality))
+	}
+	magickArgs = append(magickArgs, dst)
+
+	magickOut, magickErr := exec.Command("magick", magickArgs...).CombinedOutput()
+	if magickErr == nil {
+		return nil
+	}
+
+	ffmpegArgs := []string{"-y", "-hide_banner", "-loglevel", "error", "-i", src, "-frames:v", "1"}
+	if format == "jpg" {
+		ffmpegArgs = append(ffmpegArgs, "-q:v", strconv.Itoa(jpegQualityToQScale(quality)))
+	}
+	ffmpegArgs = append(ffmpegArgs, dst)
+
+	if out, err := exec.Command("ffmpeg", ffmpegArgs...).CombinedOutput(); err != nil {
+		return fmt.Errorf("图像编码失败: magick: %v (%s); ffmpeg: %v (%s)",
+			magickErr, strings.TrimSpace(string(magickOut)), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// jpegQualityToQScale 将JPEG质量(1-100)映射到ffmpeg mjpeg的qscale(2-31，越小越好)
+func jpegQualityToQScale(quality int) int {
+	return max(2, min(31, 31-(quality*29)/100))
+}
+
+// exportAnimation 将动画AVIF转为GIF（调色板两遍法）或H.264 MP4
+func exportAnimation(src, dst, format string) error {
+	var args []string
+	switch format {
+	case "gif":
+		args = []string{"-y", "-hide_banner", "-loglevel", "error", "-i", src,
+			"-filter_complex", "[0:v]split[a][b];[a]palettegen=stats_mode=diff[p];[b][p]paletteuse=dither=sierra2_4a",
+			"-loop", "0", dst}
+	case "mp4":
+		// yuv420p要求偶数宽高
+		args = []string{"-y", "-hide_banner", "-loglevel", "error", "-i", src,
+			"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+			"-c:v", "libx264", "-crf", "18", "-preset", "slow", "-pix_fmt", "yuv420p",
+			"-movflags", "+faststart", "-an", dst}
+	default:
+		return fmt.Errorf("不支持的动画导出格式: %s", format)
+	}
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg动画转码失败: %v, 输出: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// hasJPEGReconstructionData 检查JXL容器中是否存在JPEG重建数据（jbrd box）
+// 裸码流（FF 0A 开头）不含重建数据
+func hasJPEGReconstructionData(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	signature := make([]byte, len(jxlContainerSignature))
+	if _, err := io.ReadFull(f, signature); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	if !bytes.Equal(signature, jxlContainerSignature) {
+		return false, nil
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, err
+		}
+
+		size := uint64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerLen := uint64(8)
+
+		if boxType == "jbrd" {
+			return true, nil
+		}
+
+		switch size {
+		case 0: // 延伸到文件末尾
+			return false, nil
+		case 1: // 64位扩展长度
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(f, ext); err != nil {
+				return false, nil
+			}
+			size = binary.BigEndian.Uint64(ext)
+			headerLen = 16
+		}
+		if size < headerLen {
+			return false, fmt.Errorf("无效的box长度: %d", size)
+		}
+		if _, err := f.Seek(int64(size-headerLen), io.SeekCurrent); err != nil {
+			return false, err
+		}
+	}
+}
+
+// isAnimatedAVIF 根据ftyp品牌判断AVIF是否为图像序列（avis）
+func isAnimatedAVIF(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 64)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	header = header[:n]
+	if len(header) < 16 || string(header[4:8]) != "ftyp" {
+		return false, fmt.Errorf("缺少ftyp box")
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	if size > len(header) {
+		size = len(header)
+	}
+	if string(header[8:12]) == "avis" {
+		return true, nil
+	}
+	// 兼容品牌列表位于 major_brand(4) + minor_version(4) 之后
+	for i := 16; i+4 <= size; i += 4 {
+		if string(header[i:i+4]) == "avis" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// copyFile 原样复制文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// fileExists 文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isoBox 构造 ISOBMFF box
+func isoBox(boxType string, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	box = append(box, boxType...)
+	return append(box, payload...)
+}
+
+// jxlContainer 构造包含指定 box 的 JXL 容器
+func jxlContainer(boxTypes ...string) []byte {
+	data := append([]byte(nil), jxlContainerSignature...)
+	for _, boxType := range boxTypes {
+		data = append(data, isoBox(boxType, []byte{0xFF, 0x0A})...)
+	}
+	return data
+}
+
+// avifHeader 构造 AVIF 的 ftyp box
+func avifHeader(major string, compatible ...string) []byte {
+	payload := append([]byte(major), 0, 0, 0, 0)
+	for _, brand := range compatible {
+		payload = append(payload, brand...)
+	}
+	return isoBox("ftyp", payload)
+}
+
+// writeTestFile 创建测试文件及其目录
+func writeTestFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// TestPlanExport 测试按文件内容选择导出方式，目标路径保持相对目录并替换扩展名
+func TestPlanExport(t *testing.T) {
+	in := t.TempDir()
+	out := filepath.Join(t.TempDir(), "export")
+
+	tests := []struct {
+		name     string
+		file     string
+		content  []byte
+		opts     exportOptions
+		wantKind exportKind
+		want     string
+	}{
+		{name: "含jbrd的JXL还原为JPEG", file: "2020/a.jxl", content: jxlContainer("ftyp", "jbrd", "jxlc"), wantKind: exportReconstruct, want: "2020/a.jpg"},
+		{name: "含jbrd时忽略静态图格式", file: "a.jxl", content: jxlContainer("jbrd"), opts: exportOptions{stillFormat: "png"}, wantKind: exportReconstruct, want: "a.jpg"},
+		{name: "不含jbrd的JXL容器", file: "b.jxl", content: jxlContainer("ftyp", "jxlc"), wantKind: exportStill, want: "b.jpg"},
+		{name: "JXL裸码流导出PNG", file: "c.JXL", content: []byte{0xFF, 0x0A, 0x00}, opts: exportOptions{stillFormat: "png"}, wantKind: exportStill, want: "c.png"},
+		{name: "静态AVIF", file: "d.avif", content: avifHeader("avif", "mif1", "miaf"), wantKind: exportStill, want: "d.jpg"},
+		{name: "主品牌为avis的动画AVIF", file: "e.avif", content: avifHeader("avis", "avif", "msf1"), wantKind: exportAnimated, want: "e.gif"},
+		{name: "兼容品牌含avis的动画AVIF", file: "f.avif", content: avifHeader("avif", "mif1", "avis"), opts: exportOptions{animatedFormat: "mp4"}, wantKind: exportAnimated, want: "f.mp4"},
+		{name: "兼容格式原样复制", file: "sub/g.PNG", content: []byte("png"), wantKind: exportCopy, want: "sub/g.PNG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(in, filepath.FromSlash(tt.file))
+			writeTestFile(t, src, string(tt.content))
+
+			opts := tt.opts
+			opts.inputDir, opts.outputDir = in, out
+			if opts.stillFormat == "" {
+				opts.stillFormat = "jpg"
+			}
+			if opts.animatedFormat == "" {
+				opts.animatedFormat = "gif"
+			}
+
+			kind, dst, err := planExport(src, opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKind, kind)
+			assert.Equal(t, filepath.Join(out, filepath.FromSlash(tt.want)), dst)
+		})
+	}
+
+	t.Run("AVIF缺少ftyp", func(t *testing.T) {
+		src := filepath.Join(in, "broken.avif")
+		require.NoError(t, os.WriteFile(src, isoBox("meta", make([]byte, 16)), 0644))
+		_, _, err := planExport(src, exportOptions{inputDir: in, outputDir: out, stillFormat: "jpg", animatedFormat: "gif"})
+		assert.Error(t, err)
+	})
+}
+
+// TestJPEGQualityToQScale 测试JPEG质量映射到ffmpeg qscale并限制在2-31
+func TestJPEGQualityToQScale(t *testing.T) {
+	tests := []struct {
+		quality int
+		want    int
+	}{
+		{quality: 100, want: 2},
+		{quality: 95, want: 4},
+		{quality: 50, want: 17},
+		{quality: 1, want: 31},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, jpegQualityToQScale(tt.quality), "quality %d", tt.quality)
+	}
+}
+
+// TestRunExportInternal_ExistingTargets 测试已存在的目标默认跳过、-overwrite 时覆盖、试运行不写入
+func TestRunExportInternal_ExistingTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		dryRun    bool
+		existing  bool
+		want      string // 空表示不应生成目标文件
+	}{
+		{name: "目标不存在时导出", want: "new"},
+		{name: "已存在时跳过", existing: true, want: "old"},
+		{name: "覆盖已存在的目标", overwrite: true, existing: true, want: "new"},
+		{name: "试运行不写入", dryRun: true},
+		{name: "试运行不覆盖", overwrite: true, dryRun: true, existing: true, want: "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := t.TempDir()
+			out := t.TempDir()
+			src := filepath.Join(in, "album", "a.jpg")
+			dst := filepath.Join(out, "album", "a.jpg")
+			writeTestFile(t, src, "new")
+			if tt.existing {
+				writeTestFile(t, dst, "old")
+			}
+
+			runExportInternal(exportOptions{
+				inputDir: in, outputDir: out, stillFormat: "jpg", animatedFormat: "gif",
+				copyCompatible: true, overwrite: tt.overwrite, dryRun: tt.dryRun, workers: 1,
+			})
+
+			if tt.want == "" {
+				assert.NoFileExists(t, dst)
+				return
+			}
+			data, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+}
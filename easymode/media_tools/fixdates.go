@@ -0,0 +1,398 @@
+// media_tools/fixdates.go - 拍摄时间修复模块
+//
+// 功能说明：
+// - 找出没有 EXIF DateTimeOriginal / QuickTime CreateDate 的媒体文件
+// - 从文件名推断拍摄时间：IMG_20190304_123456、Screenshot_2020-01-02-10-20-30、
+//   WhatsApp 的 IMG-20200101-WA0001、以及 Unix 毫秒时间戳
+// - 只含日期的文件名（如 WhatsApp）时刻未知，默认只在预览和报告中标为仅日期，-allow-date-only 才写入
+// - 文件名无日期时，同一连拍序列（IMG_0001、IMG_0002…）前后都有时间相近的文件才按序号插值；
+//   auto 命令不做连拍推断（截图与照片共用序号，误判会写入看似精确的时间）
+// - 不含时区的时间按 -tz 指定的时区解释，结果写入 EXIF/XMP（视频写入 QuickTime）和修改时间
+// - 试运行输出预览，-report 写入CSV报告；须在转换前运行，PreserveTimes 才能保留正确的时间
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pixly/utils"
+)
+
+// fixDatesOptions 拍摄时间修复参数
+type fixDatesOptions struct {
+	inputDir      string
+	location      *time.Location // 文件名中不含时区的时间所在的时区
+	burstGap      int            // 参考的相邻文件最多相隔几个序号
+	burstWindow   time.Duration  // 前后两个参考文件的拍摄时间最多相差多久仍视为同一连拍
+	allowDateOnly bool           // 写入只含日期的文件名推断的时间（时刻为估计值）
+	reportPath    string         // CSV报告路径（可选）
+	workers       int
+	dryRun        bool
+}
+
+// 推断来源（除 dateSourceFilename 外）
+const dateSourceBurst = "burst"
+
+// 修复结果状态
+const (
+	fixPlanned    = "planned"
+	fixFixed      = "fixed"
+	fixUnresolved = "unresolved" // 无法推断
+	fixDateOnly   = "date_only"  // 文件名只含日期，未指定 -allow-date-only 时不写入
+	fixFailed     = "failed"
+)
+
+// fixDatesMtimeOnlyExts exiftool 无法写入拍摄时间的格式，只设置修改时间
+var fixDatesMtimeOnlyExts = map[string]bool{".bmp": true, ".avi": true, ".mkv": true}
+
+// burstSequencePattern 连拍序列的文件名：前缀 + 序号，如 IMG_0042、DSC01234
+var burstSequencePattern = regexp.MustCompile(`^(.*?)(\d+)$`)
+
+// dateFix 一个文件的修复方案
+type dateFix struct {
+	path     string
+	mtime    time.Time
+	inferred time.Time
+	dateOnly bool // 只有日期可信，时刻为估计值
+	source   string
+	basis    string // 推断依据（连拍时为参考的相邻文件）
+	status   string
+	err      string
+}
+
+func runFixDates(args []string) {
+	fs := flag.NewFlagSet("fix-dates", flag.ExitOnError)
+	inputDir := fs.String("dir", "", "📂 输入目录路径（必需）")
+	tz := fs.String("tz", "local", "🕒 文件名中时间所在的时区（local、UTC、+08:00 或 Asia/Shanghai）")
+	burstGap := fs.Int("burst-gap", 5, "📸 连拍推断时前后参考文件最多相隔的序号数（0为不按连拍推断）")
+	burstWindow := fs.Duration("burst-window", 10*time.Minute, "⏱️  前后参考文件的拍摄时间最大间隔")
+	allowDateOnly := fs.Bool("allow-date-only", false, "📅 写入只含日期的文件名推断的时间（时刻取同日修改时间或正午）")
+	reportPath := fs.String("report", "", "📝 将修复预览写入CSV文件")
+	workers := fs.Int("workers", 0, "⚡ 并发数（0为自动）")
+	dryRun := fs.Bool("dry-run", false, "🔍 试运行模式，只输出预览")
+
+	fs.Parse(args)
+
+	if *inputDir == "" {
+		logger.Println("❌ 错误: 必须指定输入目录 (-dir)")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	location, err := parseTimezone(*tz)
+	if err != nil {
+		logger.Fatalf("❌ 无效的时区 %q: %v", *tz, err)
+	}
+
+	opts := defaultFixDatesOptions(*inputDir, *dryRun)
+	opts.location = location
+	opts.burstGap = *burstGap
+	opts.burstWindow = *burstWindow
+	opts.allowDateOnly = *allowDateOnly
+	opts.reportPath = *reportPath
+	if *workers > 0 {
+		opts.workers = *workers
+	}
+	runFixDatesInternal(opts)
+}
+
+// defaultFixDatesOptions auto 命令使用的默认参数：只按文件名中的完整时间修复，不做连拍推断
+func defaultFixDatesOptions(inputDir string, dryRun bool) fixDatesOptions {
+	workers := runtime.NumCPU()
+	if workers > 8 {
+		workers = 8
+	}
+	return fixDatesOptions{
+		inputDir:    inputDir,
+		location:    time.Local,
+		burstGap:    0,
+		burstWindow: 10 * time.Minute,
+		workers:     workers,
+		dryRun:      dryRun,
+	}
+}
+
+// runFixDatesInternal 推断缺失的拍摄时间并写入
+func runFixDatesInternal(opts fixDatesOptions) {
+	// 没有exiftool就无法判断文件是否已有拍摄时间，不能贸然按文件名覆盖
+	if !commandAvailable("exiftool") {
+		logger.Printf("❌ 未找到exiftool，无法检查和写入拍摄时间")
+		return
+	}
+
+	logger.Printf("🔍 扫描媒体文件: %s", opts.inputDir)
+	files, err := utils.WalkMedia(opts.inputDir, mediaExtensions, filepath.Join(opts.inputDir, ".trash"))
+	if err != nil {
+		logger.Printf("❌ 扫描失败: %v", err)
+		return
+	}
+	sort.Strings(files)
+	logger.Printf("📊 找到 %d 个媒体文件", len(files))
+	if len(files) == 0 {
+		return
+	}
+
+	fixes := planDateFixes(readOrganizeItems(files, opts.workers, opts.location), opts)
+	if len(fixes) == 0 {
+		logger.Printf("✅ 所有文件都有拍摄时间")
+		return
+	}
+
+	if opts.dryRun {
+		for _, fix := range fixes {
+			switch fix.status {
+			case fixUnresolved:
+				logger.Printf("❔ [试运行] 无法推断: %s", fix.path)
+			case fixDateOnly:
+				logger.Printf("📅 [试运行] 文件名只含日期，不写入: %s (%s)", fix.path, fix.inferredString())
+			default:
+				logger.Printf("🔍 [试运行] %s: %s -> %s (%s%s)", fix.path,
+					fix.mtime.In(opts.location).Format("2006-01-02 15:04:05"),
+					fix.inferredString(), fix.source, basisSuffix(fix.basis))
+			}
+		}
+	} else {
+		applyDateFixes(fixes, opts)
+		for _, fix := range fixes {
+			if fix.status == fixDateOnly {
+				logger.Printf("📅 文件名只含日期，未写入: %s (%s)", fix.path, fix.inferredString())
+			}
+		}
+	}
+
+	if opts.reportPath != "" {
+		if err := writeDateFixReport(opts.reportPath, fixes, opts.location); err != nil {
+			logger.Printf("⚠️  写入报告失败: %v", err)
+		} else {
+			logger.Printf("📝 修复报告: %s", opts.reportPath)
+		}
+	}
+
+	counts := make(map[string]int)
+	sources := make(map[string]int)
+	for _, fix := range fixes {
+		counts[fix.status]++
+		if fix.status != fixUnresolved && fix.status != fixDateOnly {
+			sources[fix.source]++
+		}
+	}
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	if opts.dryRun {
+		logger.Printf("📊 计划修复 %d 个文件 (文件名 %d, 连拍 %d), 仅日期未写入 %d 个, 无法推断 %d 个",
+			counts[fixPlanned], sources[dateSourceFilename], sources[dateSourceBurst], counts[fixDateOnly], counts[fixUnresolved])
+	} else {
+		logger.Printf("📊 拍摄时间修复完成: 成功 %d, 失败 %d, 仅日期未写入 %d, 无法推断 %d",
+			counts[fixFixed], counts[fixFailed], counts[fixDateOnly], counts[fixUnresolved])
+	}
+	if counts[fixDateOnly] > 0 {
+		logger.Printf("💡 确认后可加 -allow-date-only 写入只含日期的文件（时刻为估计值）")
+	}
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+// planDateFixes 为缺少元数据拍摄时间的文件确定修复方案
+// 文件名中的时间优先（只含日期时需 allowDateOnly）；否则在同一连拍序列中找前后最近的、有可靠时间的文件插值
+func planDateFixes(items []organizeItem, opts fixDatesOptions) []*dateFix {
+	sequences := indexBurstSequences(items)
+	var fixes []*dateFix
+	for _, item := range items {
+		if item.dateSource != dateSourceFilename && item.dateSource != dateSourceMtime {
+			continue // 已有EXIF/QuickTime拍摄时间
+		}
+		fix := &dateFix{path: item.path, status: fixPlanned}
+		if info, err := os.Stat(item.path); err == nil {
+			fix.mtime = info.ModTime()
+		}
+		if item.dateSource == dateSourceFilename {
+			fix.inferred, fix.source, fix.dateOnly = item.date, dateSourceFilename, item.dateOnly
+			if item.dateOnly && !opts.allowDateOnly {
+				fix.status = fixDateOnly
+			}
+		} else if t, basis, ok := inferFromBurst(item, sequences, opts); ok {
+			fix.inferred, fix.source, fix.basis = t, dateSourceBurst, basis
+		} else {
+			fix.status = fixUnresolved
+		}
+		fixes = append(fixes, fix)
+	}
+	return fixes
+}
+
+// burstPosition 文件在连拍序列中的位置
+type burstPosition struct {
+	key    string // 目录 + 小写前缀
+	number int
+}
+
+func burstPositionOf(path string) (burstPosition, bool) {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	m := burstSequencePattern.FindStringSubmatch(stem)
+	if m == nil {
+		return burstPosition{}, false
+	}
+	number, err := strconv.Atoi(m[2])
+	if err != nil {
+		return burstPosition{}, false
+	}
+	return burstPosition{key: filepath.Join(filepath.Dir(path), strings.ToLower(m[1])), number: number}, true
+}
+
+// burstMember 序列中有可靠拍摄时间（元数据或文件名中的完整时间，不含修改时间）的文件
+type burstMember struct {
+	number int
+	item   *organizeItem
+}
+
+// indexBurstSequences 按序列前缀索引有可靠拍摄时间的文件
+func indexBurstSequences(items []organizeItem) map[string][]burstMember {
+	sequences := make(map[string][]burstMember)
+	for i := range items {
+		if items[i].dateSource == dateSourceMtime || items[i].dateOnly || items[i].date.IsZero() {
+			continue
+		}
+		if position, ok := burstPositionOf(items[i].path); ok {
+			sequences[position.key] = append(sequences[position.key], burstMember{number: position.number, item: &items[i]})
+		}
+	}
+	return sequences
+}
+
+// inferFromBurst 在同一序列中找前后最近的可靠时间并按序号线性插值
+// 两侧都须有参考文件且时间差不超过 burstWindow；只有一侧时不外推——
+// iOS 截图与照片共用 IMG_#### 序号，单侧外推会把邻近照片的时间安到截图上
+func inferFromBurst(item organizeItem, sequences map[string][]burstMember, opts fixDatesOptions) (time.Time, string, bool) {
+	if opts.burstGap <= 0 {
+		return time.Time{}, "", false
+	}
+	position, ok := burstPositionOf(item.path)
+	if !ok {
+		return time.Time{}, "", false
+	}
+
+	var prev, next *organizeItem
+	var prevNumber, nextNumber int
+	for _, member := range sequences[position.key] {
+		distance := member.number - position.number
+		switch {
+		case distance < 0 && -distance <= opts.burstGap && (prev == nil || member.number > prevNumber):
+			prev, prevNumber = member.item, member.number
+		case distance > 0 && distance <= opts.burstGap && (next == nil || member.number < nextNumber):
+			next, nextNumber = member.item, member.number
+		}
+	}
+
+	if prev == nil || next == nil {
+		return time.Time{}, "", false
+	}
+	span := next.date.Sub(prev.date)
+	if span < 0 || span > opts.burstWindow {
+		return time.Time{}, "", false // 前后时间不连贯，不是同一连拍
+	}
+	offset := span * time.Duration(position.number-prevNumber) / time.Duration(nextNumber-prevNumber)
+	return prev.date.Add(offset).Truncate(time.Second), filepath.Base(prev.path) + ", " + filepath.Base(next.path), true
+}
+
+// applyDateFixes 并发写入拍摄时间和修改时间
+func applyDateFixes(fixes []*dateFix, opts fixDatesOptions) {
+	var done int32
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 用于保护日志输出
+	fixChan := make(chan *dateFix, len(fixes))
+	for _, fix := range fixes {
+		if fix.status == fixPlanned {
+			fixChan <- fix
+		}
+	}
+	close(fixChan)
+	total := int32(len(fixChan))
+
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fix := range fixChan {
+				err := writeCaptureDate(fix.path, fix.inferred, opts.location)
+				current := atomic.AddInt32(&done, 1)
+				mu.Lock()
+				if err != nil {
+					fix.status, fix.err = fixFailed, err.Error()
+					logger.Printf("❌ 修复失败: %s: %v", fix.path, err)
+				} else {
+					fix.status = fixFixed
+					logger.Printf("✅ %s -> %s (%s%s)", filepath.Base(fix.path), fix.inferredString(), fix.source, basisSuffix(fix.basis))
+				}
+				if current%50 == 0 || current == total {
+					logger.Printf("⏳ 拍摄时间修复进度: %d/%d (%.1f%%)", current, total, float64(current)/float64(total)*100)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// writeCaptureDate 写入拍摄时间并验证，再把修改时间设为拍摄时间
+func writeCaptureDate(path string, taken time.Time, location *time.Location) error {
+	if fixDatesMtimeOnlyExts[strings.ToLower(filepath.Ext(path))] {
+		return os.Chtimes(path, taken, taken)
+	}
+	// 与 Takeout 合并共用写入和验证：只写入缺失的日期标签，成功后设置修改时间
+	return mergeTakeoutToMedia(takeoutFields{taken: taken}, path, takeoutOptions{location: location})
+}
+
+// writeDateFixReport 将修复方案写入CSV
+func writeDateFixReport(path string, fixes []*dateFix, location *time.Location) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"path", "mtime", "inferred", "date_only", "source", "basis", "status", "error"})
+	for _, fix := range fixes {
+		inferred := ""
+		switch {
+		case fix.dateOnly:
+			inferred = fix.inferred.Format("2006-01-02") // 时刻为估计值，报告中只给日期
+		case !fix.inferred.IsZero():
+			inferred = fix.inferred.Format(time.RFC3339)
+		}
+		writer.Write([]string{fix.path, fix.mtime.In(location).Format(time.RFC3339), inferred, strconv.FormatBool(fix.dateOnly),
+			fix.source, fix.basis, fix.status, fix.err})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// inferredString 日志中的推断时间；只含日期时不显示估计的时刻
+func (f *dateFix) inferredString() string {
+	if f.dateOnly {
+		return f.inferred.Format("2006-01-02") + " (仅日期)"
+	}
+	return f.inferred.Format("2006-01-02 15:04:05 -07:00")
+}
+
+func basisSuffix(basis string) string {
+	if basis == "" {
+		return ""
+	}
+	return fmt.Sprintf(", 参考 %s", basis)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDateFromFilename 测试三种日期格式、毫秒时间戳和非法日期
+func TestDateFromFilename(t *testing.T) {
+	location := time.FixedZone("+08:00", 8*3600)
+
+	tests := []struct {
+		name     string
+		filename string
+		want     time.Time
+		hasTime  bool
+		ok       bool
+	}{
+		{name: "紧凑日期和时间", filename: "IMG_20190304_123456.jpg", want: time.Date(2019, 3, 4, 12, 34, 56, 0, location), hasTime: true, ok: true},
+		{name: "带分隔符的日期和时间", filename: "Screenshot_2020-01-02-10-20-30.png", want: time.Date(2020, 1, 2, 10, 20, 30, 0, location), hasTime: true, ok: true},
+		{name: "空格和点分隔的时间", filename: "2020-01-02 10.20.30.jpg", want: time.Date(2020, 1, 2, 10, 20, 30, 0, location), hasTime: true, ok: true},
+		{name: "只有日期", filename: "IMG-20200101-WA0001.jpg", want: time.Date(2020, 1, 1, 0, 0, 0, 0, location), ok: true},
+		{name: "毫秒时间戳", filename: "FB_IMG_1583320000000.jpg", want: time.UnixMilli(1583320000000), hasTime: true, ok: true},
+		{name: "毫秒时间戳截断到秒", filename: "received_1583320000999.jpeg", want: time.Unix(1583320000, 0), hasTime: true, ok: true},
+		{name: "毫秒时间戳早于2004年", filename: "file_1000000000000.jpg"},
+		{name: "月份越界", filename: "IMG_20191304_120000.jpg"},
+		{name: "2月30日", filename: "IMG_20190230.jpg"},
+		{name: "时刻越界", filename: "IMG_20190304_256000.jpg"},
+		{name: "分隔符不一致", filename: "IMG_2019-0304.jpg"},
+		{name: "未来日期", filename: "IMG_20990101_000000.jpg"},
+		{name: "没有日期", filename: "IMG_0001.JPG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hasTime, ok := dateFromFilename(tt.filename, location)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.hasTime, hasTime)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+// TestReadOrganizeItem_DateOnly 测试只含日期的文件名标记为仅日期，时刻取同日修改时间或正午
+func TestReadOrganizeItem_DateOnly(t *testing.T) {
+	dir := t.TempDir()
+	sameDay := filepath.Join(dir, "IMG-20200101-WA0001.jpg")
+	otherDay := filepath.Join(dir, "IMG-20200101-WA0002.jpg")
+	withTime := filepath.Join(dir, "IMG_20200101_083000.jpg")
+	for _, path := range []string{sameDay, otherDay, withTime} {
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	received := time.Date(2020, 1, 1, 18, 5, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(sameDay, received, received))
+	require.NoError(t, os.Chtimes(otherDay, received.AddDate(1, 0, 0), received.AddDate(1, 0, 0)))
+
+	item := readOrganizeItem(nil, sameDay, time.UTC)
+	assert.True(t, item.dateOnly)
+	assert.Equal(t, dateSourceFilename, item.dateSource)
+	assert.True(t, received.Equal(item.date), "同一天的修改时间: %v", item.date)
+
+	item = readOrganizeItem(nil, otherDay, time.UTC)
+	assert.True(t, item.dateOnly)
+	assert.True(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).Equal(item.date), "不同天时取正午: %v", item.date)
+
+	item = readOrganizeItem(nil, withTime, time.UTC)
+	assert.False(t, item.dateOnly)
+}
+
+// burstItems 构造连拍序列：offsets 中的文件有EXIF时间（相对 base 的偏移），其余只有修改时间
+func burstItems(dir string, base time.Time, offsets map[string]time.Duration, mtimeOnly ...string) []organizeItem {
+	var items []organizeItem
+	for name, offset := range offsets {
+		items = append(items, organizeItem{path: filepath.Join(dir, name), date: base.Add(offset), dateSource: dateSourceEXIF})
+	}
+	for _, name := range mtimeOnly {
+		items = append(items, organizeItem{path: filepath.Join(dir, name), date: base.AddDate(1, 0, 0), dateSource: dateSourceMtime})
+	}
+	return items
+}
+
+// TestInferFromBurst 测试两侧插值、时间窗口、序号间隔和单侧不外推
+func TestInferFromBurst(t *testing.T) {
+	base := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	opts := fixDatesOptions{burstGap: 5, burstWindow: 10 * time.Minute}
+
+	tests := []struct {
+		name    string
+		offsets map[string]time.Duration
+		target  string
+		opts    fixDatesOptions
+		want    time.Time
+		basis   string
+		ok      bool
+	}{
+		{
+			name:    "两侧插值",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": 0, "IMG_0014.JPG": 40 * time.Second},
+			target:  "IMG_0012.JPG", opts: opts,
+			want: base.Add(20 * time.Second), basis: "IMG_0010.JPG, IMG_0014.JPG", ok: true,
+		},
+		{
+			name:    "取最近的参考文件",
+			offsets: map[string]time.Duration{"IMG_0008.JPG": -time.Hour, "IMG_0010.JPG": 0, "IMG_0014.JPG": 40 * time.Second, "IMG_0016.JPG": time.Hour},
+			target:  "IMG_0012.JPG", opts: opts,
+			want: base.Add(20 * time.Second), basis: "IMG_0010.JPG, IMG_0014.JPG", ok: true,
+		},
+		{
+			name:    "前后时间超出窗口",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": 0, "IMG_0012.JPG": time.Hour},
+			target:  "IMG_0011.JPG", opts: opts,
+		},
+		{
+			name:    "前后时间倒序",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": time.Minute, "IMG_0012.JPG": 0},
+			target:  "IMG_0011.JPG", opts: opts,
+		},
+		{
+			name:    "只有前一侧（截图与照片共用序号）",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": 0},
+			target:  "IMG_0011.PNG", opts: opts,
+		},
+		{
+			name:    "只有后一侧",
+			offsets: map[string]time.Duration{"IMG_0012.JPG": 0},
+			target:  "IMG_0011.JPG", opts: opts,
+		},
+		{
+			name:    "超出序号间隔",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": 0, "IMG_0020.JPG": time.Minute},
+			target:  "IMG_0015.JPG", opts: fixDatesOptions{burstGap: 3, burstWindow: 10 * time.Minute},
+		},
+		{
+			name:    "不同前缀不是同一序列",
+			offsets: map[string]time.Duration{"DSC_0010.JPG": 0, "DSC_0012.JPG": time.Minute},
+			target:  "IMG_0011.JPG", opts: opts,
+		},
+		{
+			name:    "关闭连拍推断",
+			offsets: map[string]time.Duration{"IMG_0010.JPG": 0, "IMG_0012.JPG": time.Minute},
+			target:  "IMG_0011.JPG", opts: fixDatesOptions{burstGap: 0, burstWindow: 10 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			items := burstItems(dir, base, tt.offsets, tt.target)
+			target := items[len(items)-1]
+			got, basis, ok := inferFromBurst(target, indexBurstSequences(items), tt.opts)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.basis, basis)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+// TestInferFromBurst_IgnoresDateOnlyNeighbours 测试只含日期的文件不作为连拍参考
+func TestInferFromBurst_IgnoresDateOnlyNeighbours(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	items := []organizeItem{
+		{path: filepath.Join(dir, "IMG_0010.JPG"), date: base, dateSource: dateSourceFilename, dateOnly: true},
+		{path: filepath.Join(dir, "IMG_0012.JPG"), date: base, dateSource: dateSourceEXIF},
+		{path: filepath.Join(dir, "IMG_0011.JPG"), date: base, dateSource: dateSourceMtime},
+	}
+	_, _, ok := inferFromBurst(items[2], indexBurstSequences(items), fixDatesOptions{burstGap: 5, burstWindow: time.Hour})
+	assert.False(t, ok)
+}
+
+// TestPlanDateFixes 测试跳过已有元数据时间的文件，仅日期的文件默认不写入
+func TestPlanDateFixes(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	items := []organizeItem{
+		{path: path("IMG_0010.JPG"), date: base, dateSource: dateSourceEXIF},
+		{path: path("IMG_0011.JPG"), date: base, dateSource: dateSourceMtime},
+		{path: path("IMG_0012.JPG"), date: base.Add(20 * time.Second), dateSource: dateSourceEXIF},
+		{path: path("VID_0001.MOV"), date: base, dateSource: dateSourceQuickTime},
+		{path: path("IMG_20200101_083000.jpg"), date: base, dateSource: dateSourceFilename},
+		{path: path("IMG-20200101-WA0001.jpg"), date: base, dateSource: dateSourceFilename, dateOnly: true},
+		{path: path("notes.png"), date: base, dateSource: dateSourceMtime},
+	}
+
+	type result struct {
+		status   string
+		source   string
+		dateOnly bool
+	}
+	collect := func(fixes []*dateFix) map[string]result {
+		results := make(map[string]result)
+		for _, fix := range fixes {
+			results[filepath.Base(fix.path)] = result{fix.status, fix.source, fix.dateOnly}
+		}
+		return results
+	}
+
+	opts := fixDatesOptions{burstGap: 5, burstWindow: 10 * time.Minute}
+	assert.Equal(t, map[string]result{
+		"IMG_0011.JPG":            {fixPlanned, dateSourceBurst, false},
+		"IMG_20200101_083000.jpg": {fixPlanned, dateSourceFilename, false},
+		"IMG-20200101-WA0001.jpg": {fixDateOnly, dateSourceFilename, true},
+		"notes.png":               {fixUnresolved, "", false},
+	}, collect(planDateFixes(items, opts)), "已有EXIF/QuickTime时间的文件不出现在方案中")
+
+	opts.allowDateOnly = true
+	assert.Equal(t, fixPlanned, collect(planDateFixes(items, opts))["IMG-20200101-WA0001.jpg"].status, "-allow-date-only 时写入")
+}
+
+// TestDefaultFixDatesOptions 测试 auto 不做连拍推断，也不写入仅日期的时间
+func TestDefaultFixDatesOptions(t *testing.T) {
+	opts := defaultFixDatesOptions("in", false)
+	assert.Zero(t, opts.burstGap)
+	assert.False(t, opts.allowDateOnly)
+}
@@ -2,16 +2,29 @@ module media_tools
 
 go 1.25.3
 
-replace pixly/utils => ../utils
+replace (
+	pixly => ../..
+	pixly/utils => ../utils
+)
 
-require pixly/utils v0.0.0-00010101000000-000000000000
+require (
+	github.com/stretchr/testify v1.11.1
+	go.uber.org/zap v1.27.0
+	pixly v0.0.0-00010101000000-000000000000
+	pixly/utils v0.0.0-00010101000000-000000000000
+)
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/h2non/filetype v1.1.3 // indirect
 	github.com/karrick/godirwalk v1.17.0 // indirect
+	github.com/panjf2000/ants/v2 v2.11.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,7 +2,11 @@
 //
 // 功能说明：
 // 1. XMP元数据合并 (merge命令)
-// 2. 重复媒体文件检测和清理 (dedup命令)
+// 2. 重复和近似重复媒体文件检测和清理 (dedup命令)
+// 3. 兼容性副本导出 (export命令)
+// 4. Google Takeout JSON元数据合并 (merge-takeout命令)
+// 5. 按拍摄日期整理媒体库 (organize命令)
+// 6. 从文件名和连拍序列修复拍摄时间 (fix-dates命令)
 //
 // 作者：AI Assistant
 // 版本：2.2.0
@@ -42,10 +46,14 @@ var (
 type Command string
 
 const (
-	MergeXMP  Command = "merge"     // 合并XMP元数据
-	Dedup     Command = "dedup"     // 去重媒体文件
-	Normalize Command = "normalize" // 规范化文件扩展名
-	Auto      Command = "auto"      // 自动执行全部操作
+	MergeXMP     Command = "merge"         // 合并XMP元数据
+	MergeTakeout Command = "merge-takeout" // 合并Google Takeout JSON元数据
+	Dedup        Command = "dedup"         // 去重媒体文件
+	Normalize    Command = "normalize"     // 规范化文件扩展名
+	Auto         Command = "auto"          // 自动执行全部操作
+	Export       Command = "export"        // 导出兼容性副本
+	Organize     Command = "organize"      // 按拍摄日期整理媒体库
+	FixDates     Command = "fix-dates"     // 修复缺失的拍摄时间
 )
 
 func init() {
@@ -71,12 +79,20 @@ func main() {
 	switch command {
 	case MergeXMP:
 		runMergeXMP(os.Args[2:])
+	case MergeTakeout:
+		runMergeTakeout(os.Args[2:])
 	case Dedup:
 		runDedup(os.Args[2:])
 	case Normalize:
 		runNormalize(os.Args[2:])
 	case Auto:
 		runAuto(os.Args[2:])
+	case Export:
+		runExport(os.Args[2:])
+	case Organize:
+		runOrganize(os.Args[2:])
+	case FixDates:
+		runFixDates(os.Args[2:])
 	default:
 		logger.Printf("❌ 未知命令: %s", command)
 		printUsage()
@@ -85,7 +101,7 @@ func main() {
 }
 
 func printUsage() {
-	fmt.Println(`
+	fmt.Print(`
 媒体工具集 v2.2.0
 
 用法:
@@ -93,9 +109,13 @@ func printUsage() {
 
 命令:
   merge      合并XMP侧边文件到媒体文件
-  dedup      检测并清理重复媒体文件
+  merge-takeout  合并Google Takeout的JSON侧边文件（拍摄时间、GPS、描述、人物）
+  dedup      检测并清理重复的媒体文件（-perceptual 时按感知哈希包括近似重复）
   normalize  规范化文件扩展名 (.jpeg→.jpg, .tiff→.tif)
   auto       自动执行全部操作（推荐）
+  export     导出JXL/AVIF的兼容性副本（JPEG/PNG/GIF/MP4）
+  organize   按拍摄日期移动和重命名媒体文件（侧边文件随行，可撤销）
+  fix-dates  从文件名和连拍序列推断缺失的拍摄时间，写入EXIF/XMP和修改时间
 
 示例:
   # 自动执行全部操作（推荐）
@@ -103,14 +123,30 @@ func printUsage() {
 
   # 单独执行各项操作
   media_tools merge -dir /path/to/media
+  media_tools merge-takeout -dir /path/to/takeout -tz +08:00
   media_tools normalize -dir /path/to/media
   media_tools dedup -dir /path/to/media -trash /path/to/trash
+  media_tools dedup -dir /path/to/media -hash dhash -threshold 4
+
+  # 按拍摄日期整理（先试运行查看计划，撤销使用执行时写入的清单）
+  media_tools organize -dir /path/to/media -template "{year}/{month}/{date}_{time}_{camera}{ext}" -dry-run
+  media_tools organize -undo /path/to/media/.media_tools/organize-manifest-20260101-120000.json
+
+  # 修复聊天软件和截图缺失的拍摄时间（先预览）
+  media_tools fix-dates -dir /path/to/media -tz +08:00 -dry-run -report dates.csv
+
+  # 导出兼容性副本（用于分享）
+  media_tools export -dir /path/to/media -out /path/to/export
 
 获取命令帮助:
   media_tools merge -h
+  media_tools merge-takeout -h
   media_tools dedup -h
   media_tools normalize -h
   media_tools auto -h
+  media_tools export -h
+  media_tools organize -h
+  media_tools fix-dates -h
 `)
 }
 
@@ -370,6 +406,10 @@ func runDedup(args []string) {
 	fs := flag.NewFlagSet("dedup", flag.ExitOnError)
 	inputDir := fs.String("dir", "", "📂 输入目录路径（必需）")
 	trashDir := fs.String("trash", "", "🗑️  垃圾箱目录（可选，默认为<dir>/.trash）")
+	perceptual := fs.Bool("perceptual", false, "🧠 同时清理近似重复（另存为其他格式、缩放、重新压缩的副本）")
+	algorithm := fs.String("hash", defaultDedupAlgorithm, "🔢 感知哈希算法: phash 或 dhash")
+	threshold := fs.Int("threshold", defaultDedupThreshold, "📏 视为同一画面的最大汉明距离 (0-32)")
+	workers := fs.Int("workers", 0, "⚡ 并发线程数（0为自动）")
 	dryRun := fs.Bool("dry-run", false, "🔍 试运行模式，不实际执行")
 
 	fs.Parse(args)
@@ -379,6 +419,12 @@ func runDedup(args []string) {
 		fs.PrintDefaults()
 		os.Exit(1)
 	}
+	if *algorithm != "phash" && *algorithm != "dhash" {
+		logger.Fatalf("❌ 不支持的感知哈希算法: %s（可选 phash、dhash）", *algorithm)
+	}
+	if *threshold < 0 || *threshold > 32 {
+		logger.Fatalf("❌ 汉明距离阈值必须在 0-32 之间: %d", *threshold)
+	}
 
 	// 如果未指定trash目录，使用默认的.trash
 	if *trashDir == "" {
@@ -386,88 +432,28 @@ func runDedup(args []string) {
 		logger.Printf("📂 使用默认垃圾箱: %s", *trashDir)
 	}
 
-
 	logger.Printf("🔧 开始媒体文件去重...")
 	logger.Printf("📂 输入目录: %s", *inputDir)
 	logger.Printf("🗑️  垃圾箱: %s", *trashDir)
 	logger.Printf("🔍 试运行: %v", *dryRun)
 
-	// 创建垃圾箱目录
-	if !*dryRun {
-		if err := os.MkdirAll(*trashDir, 0755); err != nil {
-			logger.Fatalf("❌ 创建垃圾箱目录失败: %v", err)
-		}
-	}
-
-	// 扫描媒体文件
-	mediaFiles, err := scanMediaFiles(*inputDir)
-	if err != nil {
-		logger.Fatalf("❌ 扫描媒体文件失败: %v", err)
-	}
-
-	logger.Printf("📊 找到 %d 个媒体文件", len(mediaFiles))
-
-	// 计算哈希并检测重复
-	hashMap := make(map[string]string) // hash -> first file path
-	duplicates := 0
-	moved := 0
-
-	for _, file := range mediaFiles {
-		hash, err := calculateHash(file)
-		if err != nil {
-			logger.Printf("⚠️  计算哈希失败: %s: %v", file, err)
-			continue
-		}
-
-		if existingFile, exists := hashMap[hash]; exists {
-			// 发现重复
-			logger.Printf("🔍 发现重复: %s <-> %s", filepath.Base(file), filepath.Base(existingFile))
-			duplicates++
-
-			if !*dryRun {
-				// 移动到垃圾箱
-				trashPath := filepath.Join(*trashDir, filepath.Base(file))
-				if err := os.Rename(file, trashPath); err != nil {
-					logger.Printf("❌ 移动失败: %s: %v", file, err)
-				} else {
-					logger.Printf("✅ 已移动到垃圾箱: %s", filepath.Base(file))
-					moved++
-				}
-			}
-		} else {
-			hashMap[hash] = file
-		}
-	}
-
-	logger.Printf("📊 去重完成: 发现重复 %d, 已移动 %d", duplicates, moved)
+	opts := defaultDedupOptions(*inputDir, *trashDir, *dryRun)
+	opts.perceptual = *perceptual
+	opts.algorithm = *algorithm
+	opts.threshold = *threshold
+	opts.workers = *workers
+	runDedupInternal(opts)
 }
 
-// scanMediaFiles 扫描媒体文件
-func scanMediaFiles(dir string) ([]string, error) {
-	var mediaFiles []string
-	mediaExts := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
-		".mp4": true, ".mov": true, ".avi": true, ".mkv": true,
-		".jxl": true, ".avif": true, ".heic": true, ".heif": true,
-		".webp": true, ".bmp": true, ".tiff": true, ".tif": true,
-		".psd": true, ".psb": true,
-		".cr2": true, ".cr3": true, ".nef": true, ".arw": true,
-		".dng": true, ".raf": true, ".orf": true, ".rw2": true,
-	}
-
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
-			if mediaExts[ext] {
-				mediaFiles = append(mediaFiles, path)
-			}
-		}
-		return nil
-	})
-	return mediaFiles, err
+// mediaExtensions 参与去重的媒体文件扩展名
+var mediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".mp4": true, ".mov": true, ".avi": true, ".mkv": true,
+	".jxl": true, ".avif": true, ".heic": true, ".heif": true,
+	".webp": true, ".bmp": true, ".tiff": true, ".tif": true,
+	".psd": true, ".psb": true,
+	".cr2": true, ".cr3": true, ".nef": true, ".arw": true,
+	".dng": true, ".raf": true, ".orf": true, ".rw2": true,
 }
 
 // calculateHash 计算文件SHA256哈希
@@ -599,25 +585,40 @@ func runAuto(args []string) {
 	logger.Printf("🔍 试运行: %v", *dryRun)
 	logger.Println()
 
-	// 步骤1: 扩展名规范化
+	// 步骤1: Takeout元数据合并（侧边文件按原始文件名命名，须在扩展名规范化之前）
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	logger.Println("📋 步骤 1/3: 扩展名规范化")
+	logger.Println("📋 步骤 1/5: Google Takeout元数据合并（保留JSON侧边文件）")
+	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	runMergeTakeoutInternal(defaultTakeoutOptions(*inputDir, *dryRun))
+	logger.Println()
+
+	// 步骤2: 扩展名规范化
+	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Println("📋 步骤 2/5: 扩展名规范化")
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	runNormalizeInternal(*inputDir, *dryRun)
 	logger.Println()
 
-	// 步骤2: XMP元数据合并
+	// 步骤3: XMP元数据合并
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	logger.Println("📋 步骤 2/3: XMP元数据合并")
+	logger.Println("📋 步骤 3/5: XMP元数据合并")
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	runMergeXMPInternal(*inputDir, *dryRun)
 	logger.Println()
 
-	// 步骤3: 重复文件检测
+	// 步骤4: 拍摄时间修复（在元数据合并之后，只补全仍然缺失的时间；去重按时间择优也依赖它）
+	// 只采用文件名中的完整时间，连拍推断和仅日期的文件名需通过 fix-dates 命令确认后写入
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	logger.Println("📋 步骤 3/3: 重复文件检测和清理")
+	logger.Println("📋 步骤 4/5: 拍摄时间修复（仅文件名中的完整时间）")
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	runDedupInternal(*inputDir, *trashDir, *dryRun)
+	runFixDatesInternal(defaultFixDatesOptions(*inputDir, *dryRun))
+	logger.Println()
+
+	// 步骤5: 重复文件检测
+	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Println("📋 步骤 5/5: 重复文件检测和清理（仅内容完全相同的副本）")
+	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	runDedupInternal(defaultDedupOptions(*inputDir, *trashDir, *dryRun))
 	logger.Println()
 
 	logger.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -774,67 +775,3 @@ func runMergeXMPInternal(inputDir string, dryRun bool) {
 	logger.Printf("🗑️  已删除XMP: %d 个", deleted)
 	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 }
-
-// runDedupInternal 内部调用的去重函数
-func runDedupInternal(inputDir string, trashDir string, dryRun bool) {
-	logger.Printf("🔍 扫描媒体文件进行去重: %s", inputDir)
-	logger.Printf("🗑️  垃圾箱目录: %s", trashDir)
-
-	if !dryRun {
-		if err := os.MkdirAll(trashDir, 0755); err != nil {
-			logger.Printf("❌ 创建垃圾箱目录失败: %v", err)
-			return
-		}
-	}
-
-	mediaFiles, err := scanMediaFiles(inputDir)
-	if err != nil {
-		logger.Printf("❌ 扫描媒体文件失败: %v", err)
-		return
-	}
-
-	logger.Printf("📊 找到 %d 个媒体文件,开始计算哈希值...", len(mediaFiles))
-
-	hashMap := make(map[string]string)
-	duplicates := 0
-	moved := 0
-	processed := 0
-
-	for i, file := range mediaFiles {
-		processed++
-		if processed%50 == 0 || i == 0 || i == len(mediaFiles)-1 {
-			logger.Printf("⏳ 去重进度: %d/%d (%.1f%%)", processed, len(mediaFiles), float64(processed)/float64(len(mediaFiles))*100)
-		}
-
-		hash, err := calculateHash(file)
-		if err != nil {
-			logger.Printf("⚠️  计算哈希失败: %s: %v", filepath.Base(file), err)
-			continue
-		}
-
-		if existingFile, exists := hashMap[hash]; exists {
-			logger.Printf("🔍 发现重复: %s <-> %s (哈希: %s...)", filepath.Base(file), filepath.Base(existingFile), hash[:8])
-			duplicates++
-
-			if dryRun {
-				logger.Printf("🔍 [试运行] 将移动: %s", filepath.Base(file))
-				moved++
-			} else {
-				trashPath := filepath.Join(trashDir, filepath.Base(file))
-				if err := os.Rename(file, trashPath); err != nil {
-					logger.Printf("❌ 移动失败: %s: %v", filepath.Base(file), err)
-				} else {
-					logger.Printf("✅ 已移动到垃圾箱: %s", filepath.Base(file))
-					moved++
-				}
-			}
-		} else {
-			hashMap[hash] = file
-		}
-	}
-
-	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	logger.Printf("📊 去重完成: 发现重复 %d, 已移动 %d", duplicates, moved)
-	logger.Printf("✅ 唯一文件: %d 个", len(hashMap))
-	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-}
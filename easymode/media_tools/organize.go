@@ -0,0 +1,762 @@
+// media_tools/organize.go - 按日期整理媒体库模块
+//
+// 功能说明：
+// - 按路径模板（如 {year}/{month}/{date}_{time}_{camera}{ext}）移动和重命名媒体文件
+// - 拍摄时间依次取 EXIF DateTimeOriginal → CreateDate（视频为 QuickTime）→ 文件名中的日期或毫秒时间戳 → 修改时间；
+//   文件名只含日期时 {time} 留空，计划中标记为仅日期
+// - 目标已存在时追加序号；内容完全相同的文件不移动，留给 dedup 处理
+// - .xmp / .aae / .json 侧边文件随媒体一起移动和改名
+// - 试运行输出完整计划；实际执行写入撤销清单，-undo 按清单恢复原位置
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pixly/pkg/metamigrator"
+	"pixly/utils"
+
+	"go.uber.org/zap"
+)
+
+// organizeOptions 整理参数
+type organizeOptions struct {
+	inputDir  string
+	outputDir string // 整理后的根目录，默认与输入目录相同（原地整理）
+	template  string
+	planPath  string // 计划JSON的输出路径（可选）
+	workers   int
+	dryRun    bool
+}
+
+// 拍摄时间来源
+const (
+	dateSourceEXIF      = "exif"
+	dateSourceQuickTime = "quicktime"
+	dateSourceFilename  = "filename"
+	dateSourceMtime     = "mtime"
+)
+
+// 整理条目状态
+const (
+	organizePlanned   = "planned"
+	organizeMoved     = "moved"
+	organizeUnchanged = "unchanged" // 已在目标位置
+	organizeDuplicate = "duplicate" // 目标位置已有内容相同的文件
+	organizeFailed    = "failed"
+	organizeRestored  = "restored"
+)
+
+const (
+	defaultOrganizeTemplate = "{year}/{month}/{date}_{time}_{camera}{ext}"
+	organizeManifestDir     = ".media_tools"
+	organizeExtractTimeout  = 30 * time.Second
+)
+
+// organizeSidecarExts 随媒体移动的侧边文件
+var organizeSidecarExts = map[string]bool{".xmp": true, ".aae": true, ".json": true}
+
+// organizePlaceholders 模板支持的占位符
+var organizePlaceholders = map[string]bool{
+	"year": true, "month": true, "day": true, "date": true, "time": true,
+	"camera": true, "name": true, "source": true, "ext": true,
+}
+
+var organizePlaceholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// organizeItem 一个媒体文件及其拍摄信息
+type organizeItem struct {
+	path       string
+	date       time.Time
+	dateSource string
+	dateOnly   bool // 文件名只含日期，date 的时刻只是估计值
+	camera     string
+}
+
+// organizeEntry 清单中的一次移动
+type organizeEntry struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Sidecar    bool      `json:"sidecar,omitempty"`
+	Date       time.Time `json:"date,omitempty"`
+	DateSource string    `json:"date_source,omitempty"`
+	DateOnly   bool      `json:"date_only,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// organizeManifest 整理计划与撤销清单
+type organizeManifest struct {
+	CreatedAt time.Time       `json:"created_at"`
+	InputDir  string          `json:"input_dir"`
+	OutputDir string          `json:"output_dir"`
+	Template  string          `json:"template"`
+	DryRun    bool            `json:"dry_run"`
+	Entries   []organizeEntry `json:"entries"`
+}
+
+func runOrganize(args []string) {
+	fs := flag.NewFlagSet("organize", flag.ExitOnError)
+	inputDir := fs.String("dir", "", "📂 输入目录路径（必需）")
+	outputDir := fs.String("out", "", "📁 整理后的根目录（默认原地整理）")
+	template := fs.String("template", defaultOrganizeTemplate, "🧩 路径模板，占位符: {year} {month} {day} {date} {time} {camera} {name} {source} {ext}")
+	planPath := fs.String("plan", "", "📝 将整理计划写入JSON文件")
+	undoPath := fs.String("undo", "", "↩️  按撤销清单恢复原位置")
+	workers := fs.Int("workers", 0, "⚡ 读取元数据的并发数（0为自动）")
+	dryRun := fs.Bool("dry-run", false, "🔍 试运行模式，只输出计划")
+
+	fs.Parse(args)
+
+	if *undoPath != "" {
+		if err := undoOrganize(*undoPath, *dryRun); err != nil {
+			logger.Fatalf("❌ 撤销失败: %v", err)
+		}
+		return
+	}
+
+	if *inputDir == "" {
+		logger.Println("❌ 错误: 必须指定输入目录 (-dir) 或撤销清单 (-undo)")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := validateOrganizeTemplate(*template); err != nil {
+		logger.Fatalf("❌ 无效的路径模板: %v", err)
+	}
+
+	opts := organizeOptions{
+		inputDir:  *inputDir,
+		outputDir: *outputDir,
+		template:  *template,
+		planPath:  *planPath,
+		workers:   *workers,
+		dryRun:    *dryRun,
+	}
+	if opts.outputDir == "" {
+		opts.outputDir = opts.inputDir
+	}
+	if opts.workers <= 0 {
+		opts.workers = runtime.NumCPU()
+		if opts.workers > 8 {
+			opts.workers = 8
+		}
+	}
+	if err := runOrganizeInternal(opts); err != nil {
+		logger.Fatalf("❌ 整理失败: %v", err)
+	}
+}
+
+// validateOrganizeTemplate 检查占位符，{ext} 只能出现在模板末尾
+func validateOrganizeTemplate(template string) error {
+	if strings.TrimSpace(template) == "" || filepath.IsAbs(template) {
+		return fmt.Errorf("模板必须是非空的相对路径")
+	}
+	for _, m := range organizePlaceholderPattern.FindAllStringSubmatch(template, -1) {
+		if !organizePlaceholders[m[1]] {
+			return fmt.Errorf("未知占位符 {%s}", m[1])
+		}
+	}
+	if idx := strings.Index(template, "{ext}"); idx >= 0 && idx != len(template)-len("{ext}") {
+		return fmt.Errorf("{ext} 必须位于模板末尾")
+	}
+	return nil
+}
+
+// runOrganizeInternal 扫描、生成计划并执行整理
+func runOrganizeInternal(opts organizeOptions) error {
+	logger.Printf("🔍 扫描媒体文件: %s", opts.inputDir)
+	files, err := utils.WalkMedia(opts.inputDir, mediaExtensions, filepath.Join(opts.inputDir, ".trash"))
+	if err != nil {
+		return fmt.Errorf("扫描失败: %w", err)
+	}
+	sort.Strings(files)
+	logger.Printf("📊 找到 %d 个媒体文件", len(files))
+	if len(files) == 0 {
+		return nil
+	}
+
+	items := readOrganizeItems(files, opts.workers, time.Local)
+	manifest := planOrganize(items, opts)
+
+	counts := make(map[string]int)
+	for _, entry := range manifest.Entries {
+		if !entry.Sidecar {
+			counts[entry.Status]++
+		}
+	}
+	if opts.planPath != "" {
+		if err := writeOrganizeManifest(opts.planPath, manifest); err != nil {
+			return fmt.Errorf("写入计划失败: %w", err)
+		}
+		logger.Printf("📝 整理计划: %s", opts.planPath)
+	}
+
+	if opts.dryRun {
+		for _, entry := range manifest.Entries {
+			switch entry.Status {
+			case organizePlanned:
+				if entry.Sidecar {
+					logger.Printf("🔍 [试运行] 将移动侧边文件: %s -> %s", entry.From, entry.To)
+				} else {
+					logger.Printf("🔍 [试运行] 将移动: %s -> %s (%s)", entry.From, entry.To, describeDateSource(entry.DateSource, entry.DateOnly))
+				}
+			case organizeDuplicate:
+				logger.Printf("🔍 [试运行] 目标已有相同文件，跳过: %s -> %s", entry.From, entry.To)
+			case organizeFailed:
+				logger.Printf("⚠️  [试运行] 无法整理: %s: %s", entry.From, entry.Error)
+			}
+		}
+		logger.Printf("📊 计划移动 %d 个媒体文件, 已在目标位置 %d, 重复 %d", counts[organizePlanned], counts[organizeUnchanged], counts[organizeDuplicate])
+		return nil
+	}
+
+	// 先写入清单再移动，中途中断也能按清单撤销已完成的部分
+	manifestPath := filepath.Join(opts.outputDir, organizeManifestDir, "organize-manifest-"+manifest.CreatedAt.Format("20060102-150405")+".json")
+	for i := 1; fileExists(manifestPath); i++ {
+		manifestPath = filepath.Join(opts.outputDir, organizeManifestDir, fmt.Sprintf("organize-manifest-%s_%d.json", manifest.CreatedAt.Format("20060102-150405"), i))
+	}
+	if err := writeOrganizeManifest(manifestPath, manifest); err != nil {
+		return fmt.Errorf("写入撤销清单失败: %w", err)
+	}
+
+	moved, failed := executeOrganize(manifest)
+	if err := writeOrganizeManifest(manifestPath, manifest); err != nil {
+		logger.Printf("⚠️  更新撤销清单失败: %v", err)
+	}
+
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Printf("📊 整理完成: 移动 %d, 失败 %d, 已在目标位置 %d, 重复 %d", moved, failed+counts[organizeFailed], counts[organizeUnchanged], counts[organizeDuplicate])
+	logger.Printf("↩️  撤销清单: %s", manifestPath)
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	return nil
+}
+
+// readOrganizeItems 并发读取拍摄时间和相机；location 为不含时区的日期所在的时区
+func readOrganizeItems(files []string, workers int, location *time.Location) []organizeItem {
+	var migrator *metamigrator.MetadataMigrator
+	if exiftoolPath, err := exec.LookPath("exiftool"); err == nil {
+		migrator = metamigrator.NewMetadataMigrator(zap.NewNop(), exiftoolPath)
+	} else {
+		logger.Printf("⚠️  未找到exiftool，拍摄时间只能取自文件名和修改时间")
+	}
+
+	items := make([]organizeItem, len(files))
+	var wg sync.WaitGroup
+	indexes := make(chan int, len(files))
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				items[i] = readOrganizeItem(migrator, files[i], location)
+			}
+		}()
+	}
+	wg.Wait()
+	return items
+}
+
+// readOrganizeItem 按优先级确定一个文件的拍摄时间
+func readOrganizeItem(migrator *metamigrator.MetadataMigrator, path string, location *time.Location) organizeItem {
+	item := organizeItem{path: path}
+
+	if migrator != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), organizeExtractTimeout)
+		fields, err := migrator.ExtractFields(ctx, path, "DateTimeOriginal", "CreateDate", "Make", "Model")
+		cancel()
+		if err == nil {
+			item.camera = cameraName(metadataString(fields, "Make"), metadataString(fields, "Model"))
+			if t, ok := parseExifDate(metadataString(fields, "DateTimeOriginal"), location); ok {
+				item.date, item.dateSource = t, dateSourceEXIF
+				return item
+			}
+			// 视频的 CreateDate 来自 QuickTime，按规范以UTC存储；图像的来自 EXIF
+			if takeoutVideoExts[strings.ToLower(filepath.Ext(path))] {
+				if t, ok := parseExifDate(metadataString(fields, "CreateDate"), time.UTC); ok {
+					item.date, item.dateSource = t.In(location), dateSourceQuickTime
+					return item
+				}
+			} else if t, ok := parseExifDate(metadataString(fields, "CreateDate"), location); ok {
+				item.date, item.dateSource = t, dateSourceEXIF
+				return item
+			}
+		}
+	}
+
+	info, statErr := os.Stat(path)
+	if t, hasTime, ok := dateFromFilename(filepath.Base(path), location); ok {
+		if !hasTime {
+			// 只有日期（如 IMG-20200101-WA0001）：标记为仅日期，时刻只用于排序和归档——
+			// 修改时间在同一天时取其时刻，否则取正午，避免跨时区后落到前一天
+			item.dateOnly = true
+			t = t.Add(12 * time.Hour)
+			if statErr == nil && sameDay(info.ModTime().In(location), t) {
+				t = info.ModTime().In(location).Truncate(time.Second)
+			}
+		}
+		item.date, item.dateSource = t, dateSourceFilename
+		return item
+	}
+	if statErr == nil {
+		item.date, item.dateSource = info.ModTime(), dateSourceMtime
+	}
+	return item
+}
+
+// describeDateSource 日志中的时间来源；仅日期时注明
+func describeDateSource(source string, dateOnly bool) string {
+	if dateOnly {
+		return source + ", 仅日期"
+	}
+	return source
+}
+
+// sameDay 两个时间是否在同一天（按各自的时区）
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// metadataString exiftool JSON 中的字符串字段
+func metadataString(fields map[string]interface{}, key string) string {
+	switch v := fields[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// parseExifDate 解析 EXIF 格式的日期，全零等无效值返回 false
+func parseExifDate(value string, location *time.Location) (time.Time, bool) {
+	if len(value) < len(exifDateLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(exifDateLayout, value[:len(exifDateLayout)], location)
+	if err != nil || t.Year() < 1900 {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// cameraName 相机名称；型号已包含厂商时不重复（如 Canon + Canon EOS R5）
+func cameraName(maker, model string) string {
+	name := model
+	if maker != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(maker)[0])) {
+		name = strings.TrimSpace(maker + " " + model)
+	}
+	return sanitizePathPart(name)
+}
+
+var unsafePathChars = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// sanitizePathPart 替换路径中不安全的字符
+func sanitizePathPart(value string) string {
+	return strings.Trim(unsafePathChars.ReplaceAllString(value, "_"), "_")
+}
+
+// filenameDatePattern 文件名中的日期和可选时间：
+// IMG_20190304_123456、Screenshot_2020-01-02-10-20-30、IMG-20200101-WA0001、2020-01-02 10.20.30
+var filenameDatePattern = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)\d{2})([-_.]?)(\d{2})([-_.]?)(\d{2})(?:[-_ T.]?(\d{2})[-_.:h]?(\d{2})[-_.:m]?(\d{2}))?(?:[^0-9]|$)`)
+
+// filenameMillisPattern 文件名中的Unix毫秒时间戳，如 FB_IMG_1583320000000、received_1583320000000
+var filenameMillisPattern = regexp.MustCompile(`(?:^|[^0-9])(1\d{12})(?:[^0-9]|$)`)
+
+// dateFromFilename 从文件名中提取拍摄时间，日期和时刻按 location 解释；
+// hasTime 为 false 表示文件名只含日期，返回当天零点
+func dateFromFilename(name string, location *time.Location) (t time.Time, hasTime bool, ok bool) {
+	for _, m := range filenameDatePattern.FindAllStringSubmatch(name, -1) {
+		if m[2] != m[4] {
+			continue // 年月和月日之间的分隔符不一致，多半不是日期
+		}
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[3])
+		day, _ := strconv.Atoi(m[5])
+		var hour, minute, second int
+		if m[6] != "" {
+			hour, _ = strconv.Atoi(m[6])
+			minute, _ = strconv.Atoi(m[7])
+			second, _ = strconv.Atoi(m[8])
+		}
+		t := time.Date(year, time.Month(month), day, hour, minute, second, 0, location)
+		// time.Date 会把越界值进位，进位后不一致说明不是合法日期
+		if t.Year() != year || int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute || t.Second() != second {
+			continue
+		}
+		if t.After(time.Now().Add(24 * time.Hour)) {
+			continue
+		}
+		return t, m[6] != "", true
+	}
+	// 毫秒时间戳本身是UTC，不受 location 影响，只限定在合理的范围内
+	for _, m := range filenameMillisPattern.FindAllStringSubmatch(name, -1) {
+		millis, _ := strconv.ParseInt(m[1], 10, 64)
+		t := time.UnixMilli(millis).In(location)
+		if t.Year() >= 2004 && t.Before(time.Now().Add(24*time.Hour)) {
+			return t.Truncate(time.Second), true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// renderOrganizePath 按模板生成相对路径；空占位符留下的多余分隔符会被清理
+func renderOrganizePath(template string, item organizeItem) string {
+	ext := strings.ToLower(filepath.Ext(item.path))
+	clock := item.date.Format("150405")
+	if item.dateOnly {
+		clock = "" // 不把估计的时刻写进文件名
+	}
+	values := map[string]string{
+		"year":   item.date.Format("2006"),
+		"month":  item.date.Format("01"),
+		"day":    item.date.Format("02"),
+		"date":   item.date.Format("2006-01-02"),
+		"time":   clock,
+		"camera": item.camera,
+		"name":   sanitizePathPart(strings.TrimSuffix(filepath.Base(item.path), filepath.Ext(item.path))),
+		"source": item.dateSource,
+	}
+	hasExt := strings.HasSuffix(template, "{ext}")
+	rendered := organizePlaceholderPattern.ReplaceAllStringFunc(strings.TrimSuffix(template, "{ext}"), func(placeholder string) string {
+		return values[placeholder[1:len(placeholder)-1]]
+	})
+
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(rendered), "/") {
+		part = strings.Trim(collapseSeparators(part), "_- .")
+		if part == "" {
+			part = "unknown"
+		}
+		parts = append(parts, part)
+	}
+	path := filepath.Join(parts...)
+	if hasExt || !strings.HasSuffix(strings.ToLower(path), ext) {
+		path += ext
+	}
+	return path
+}
+
+var repeatedSeparators = regexp.MustCompile(`([_\- ])[_\- ]+`)
+
+func collapseSeparators(value string) string {
+	return repeatedSeparators.ReplaceAllString(value, "$1")
+}
+
+// planOrganize 为每个文件确定目标路径，处理冲突并附带侧边文件
+func planOrganize(items []organizeItem, opts organizeOptions) *organizeManifest {
+	manifest := &organizeManifest{
+		CreatedAt: time.Now(),
+		InputDir:  opts.inputDir,
+		OutputDir: opts.outputDir,
+		Template:  opts.template,
+		DryRun:    opts.dryRun,
+	}
+	reserved := make(map[string]string) // 本次计划已占用的目标（不区分大小写）→ 来源
+	claimed := make(map[string]bool)    // 已分配给某个媒体的侧边文件
+	listings := make(map[string][]string)
+
+	for _, item := range items {
+		if item.date.IsZero() {
+			manifest.Entries = append(manifest.Entries, organizeEntry{From: item.path, Status: organizeFailed, Error: "无法确定拍摄时间"})
+			continue
+		}
+		dir := filepath.Dir(item.path)
+		if _, ok := listings[dir]; !ok {
+			listings[dir] = listDirNames(dir)
+		}
+		sidecars := findSidecars(item.path, listings[dir], claimed)
+
+		entry := organizeEntry{From: item.path, Date: item.date, DateSource: item.dateSource, DateOnly: item.dateOnly, Status: organizePlanned}
+		entry.To = filepath.Join(opts.outputDir, renderOrganizePath(opts.template, item))
+
+		switch {
+		case samePath(entry.From, entry.To):
+			entry.Status = organizeUnchanged
+		case fileExists(entry.To) && sameFileContent(entry.From, entry.To),
+			reserved[strings.ToLower(entry.To)] != "" && sameFileContent(entry.From, reserved[strings.ToLower(entry.To)]):
+			entry.Status = organizeDuplicate
+		default:
+			entry.To = resolveOrganizeCollision(entry.From, entry.To, sidecars, reserved)
+			if samePath(entry.From, entry.To) {
+				entry.Status = organizeUnchanged
+			}
+		}
+		if entry.Status != organizeDuplicate {
+			reserved[strings.ToLower(entry.To)] = entry.From
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+
+		for _, sidecar := range sidecars {
+			sidecarEntry := organizeEntry{From: sidecar, Sidecar: true, Status: entry.Status}
+			sidecarEntry.To = sidecarTarget(item.path, entry.To, sidecar)
+			if sidecarEntry.Status == organizeDuplicate {
+				sidecarEntry.Status = organizeUnchanged // 媒体不移动，侧边文件留在原处
+				sidecarEntry.To = sidecar
+			}
+			reserved[strings.ToLower(sidecarEntry.To)] = sidecarEntry.From
+			manifest.Entries = append(manifest.Entries, sidecarEntry)
+		}
+	}
+	return manifest
+}
+
+// resolveOrganizeCollision 目标已存在或已被占用时追加序号：name.jpg → name_1.jpg
+// 侧边文件跟随媒体改名，选取的序号须使媒体和全部侧边文件的目标都空闲
+func resolveOrganizeCollision(from, target string, sidecars []string, reserved map[string]string) string {
+	ext := filepath.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	candidate := target
+	for i := 1; !organizeTargetsFree(from, candidate, sidecars, reserved); i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	return candidate
+}
+
+// organizeTargetsFree 媒体及其侧边文件的目标均不存在（或就是来源本身）且未被本次计划占用
+func organizeTargetsFree(from, target string, sidecars []string, reserved map[string]string) bool {
+	free := func(from, to string) bool {
+		return (!fileExists(to) || samePath(from, to)) && reserved[strings.ToLower(to)] == ""
+	}
+	if !free(from, target) {
+		return false
+	}
+	for _, sidecar := range sidecars {
+		if !free(sidecar, sidecarTarget(from, target, sidecar)) {
+			return false
+		}
+	}
+	return true
+}
+
+// findSidecars 同目录下属于该媒体的侧边文件：IMG.xmp、IMG.JPG.xmp、IMG.AAE、IMG.JPG.json 等
+func findSidecars(mediaPath string, names []string, claimed map[string]bool) []string {
+	base := filepath.Base(mediaPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	dir := filepath.Dir(mediaPath)
+
+	var sidecars []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		ext := strings.ToLower(filepath.Ext(name))
+		if claimed[path] || !organizeSidecarExts[ext] {
+			continue
+		}
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, strings.ToLower(base)+".") || strings.EqualFold(strings.TrimSuffix(name, filepath.Ext(name)), stem) {
+			claimed[path] = true
+			sidecars = append(sidecars, path)
+		}
+	}
+	return sidecars
+}
+
+// sidecarTarget 侧边文件跟随媒体改名，保留其自身的后缀部分
+func sidecarTarget(mediaFrom, mediaTo, sidecar string) string {
+	fromBase := filepath.Base(mediaFrom)
+	toBase := filepath.Base(mediaTo)
+	name := filepath.Base(sidecar)
+	if strings.HasPrefix(strings.ToLower(name), strings.ToLower(fromBase)+".") {
+		return filepath.Join(filepath.Dir(mediaTo), toBase+name[len(fromBase):])
+	}
+	toStem := strings.TrimSuffix(toBase, filepath.Ext(toBase))
+	return filepath.Join(filepath.Dir(mediaTo), toStem+filepath.Ext(name))
+}
+
+// executeOrganize 按计划移动文件；媒体移动失败时其侧边文件保持原位
+func executeOrganize(manifest *organizeManifest) (moved, failed int) {
+	mediaFailed := false
+	dirs := make(map[string]bool)
+	for i := range manifest.Entries {
+		entry := &manifest.Entries[i]
+		if !entry.Sidecar {
+			mediaFailed = entry.Status == organizeFailed
+		}
+		if entry.Status != organizePlanned {
+			continue
+		}
+		if entry.Sidecar && mediaFailed {
+			entry.Status = organizeUnchanged
+			continue
+		}
+		if err := moveFile(entry.From, entry.To); err != nil {
+			entry.Status, entry.Error = organizeFailed, err.Error()
+			logger.Printf("❌ 移动失败: %s -> %s: %v", entry.From, entry.To, err)
+			if !entry.Sidecar {
+				mediaFailed = true
+				failed++
+			}
+			continue
+		}
+		entry.Status = organizeMoved
+		dirs[filepath.Dir(entry.From)] = true
+		if !entry.Sidecar {
+			moved++
+			logger.Printf("✅ %s -> %s", entry.From, entry.To)
+		}
+	}
+	for dir := range dirs {
+		removeEmptyDirs(dir, manifest.InputDir)
+	}
+	return moved, failed
+}
+
+// moveFile 移动文件，不覆盖已存在的目标；跨文件系统时复制后删除并保留修改时间
+func moveFile(from, to string) error {
+	if fileExists(to) {
+		return fmt.Errorf("目标已存在: %s", to)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(from, to)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(from, to); err != nil {
+		os.Remove(to)
+		return err
+	}
+	if err := os.Chtimes(to, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// removeEmptyDirs 自下而上删除移空的目录，不超出根目录
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// undoOrganize 按清单逆序把已移动的文件恢复到原位置
+func undoOrganize(manifestPath string, dryRun bool) error {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	var manifest organizeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("解析撤销清单失败: %w", err)
+	}
+	if manifest.DryRun {
+		return fmt.Errorf("该清单是试运行计划，没有可撤销的移动")
+	}
+
+	restored, failed := 0, 0
+	dirs := make(map[string]bool)
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := &manifest.Entries[i]
+		// 清单在移动前写入，中断时状态仍为 planned，以文件实际位置为准
+		if entry.Status != organizeMoved && entry.Status != organizePlanned {
+			continue
+		}
+		if !fileExists(entry.To) || fileExists(entry.From) {
+			if entry.Status == organizeMoved {
+				logger.Printf("⚠️  无法恢复: %s（目标已不存在或原位置已被占用）", entry.From)
+				failed++
+			}
+			continue
+		}
+		if dryRun {
+			logger.Printf("🔍 [试运行] 将恢复: %s -> %s", entry.To, entry.From)
+			restored++
+			continue
+		}
+		if err := moveFile(entry.To, entry.From); err != nil {
+			logger.Printf("❌ 恢复失败: %s -> %s: %v", entry.To, entry.From, err)
+			failed++
+			continue
+		}
+		entry.Status = organizeRestored
+		dirs[filepath.Dir(entry.To)] = true
+		restored++
+	}
+	if dryRun {
+		logger.Printf("📊 计划恢复 %d 个文件, 无法恢复 %d 个", restored, failed)
+		return nil
+	}
+	for dir := range dirs {
+		removeEmptyDirs(dir, manifest.OutputDir)
+	}
+	if err := writeOrganizeManifest(manifestPath, &manifest); err != nil {
+		logger.Printf("⚠️  更新撤销清单失败: %v", err)
+	}
+	logger.Printf("📊 撤销完成: 恢复 %d 个文件, 失败 %d 个", restored, failed)
+	return nil
+}
+
+// writeOrganizeManifest 写入计划或撤销清单
+func writeOrganizeManifest(path string, manifest *organizeManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// listDirNames 目录中的文件名
+func listDirNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// samePath 两个路径是否指向同一位置
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// sameFileContent 大小和SHA-256都相同
+func sameFileContent(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil || infoA.Size() != infoB.Size() {
+		return false
+	}
+	hashA, errA := calculateHash(a)
+	hashB, errB := calculateHash(b)
+	return errA == nil && errB == nil && hashA == hashB
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderOrganizePath 测试模板渲染、空占位符清理和扩展名处理
+func TestRenderOrganizePath(t *testing.T) {
+	taken := time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC)
+	item := organizeItem{path: "/in/My Photo (1).JPG", date: taken, dateSource: dateSourceEXIF, camera: "Canon_EOS_R5"}
+	noCamera := item
+	noCamera.camera = ""
+	dateOnly := noCamera
+	dateOnly.dateSource, dateOnly.dateOnly = dateSourceFilename, true
+
+	tests := []struct {
+		name     string
+		template string
+		item     organizeItem
+		want     string
+	}{
+		{name: "默认模板", template: defaultOrganizeTemplate, item: item, want: filepath.Join("2020", "01", "2020-01-02_103000_Canon_EOS_R5.jpg")},
+		{name: "空相机不留分隔符", template: defaultOrganizeTemplate, item: noCamera, want: filepath.Join("2020", "01", "2020-01-02_103000.jpg")},
+		{name: "仅日期不写估计的时刻", template: defaultOrganizeTemplate, item: dateOnly, want: filepath.Join("2020", "01", "2020-01-02.jpg")},
+		{name: "空目录名使用unknown", template: "{camera}/{date}{ext}", item: noCamera, want: filepath.Join("unknown", "2020-01-02.jpg")},
+		{name: "原文件名去掉不安全字符", template: "{year}/{name}{ext}", item: item, want: filepath.Join("2020", "My_Photo_1.jpg")},
+		{name: "时间来源", template: "{source}/{day}{ext}", item: item, want: filepath.Join("exif", "02.jpg")},
+		{name: "模板不含扩展名时追加", template: "{year}/{date}", item: item, want: filepath.Join("2020", "2020-01-02.jpg")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, renderOrganizePath(tt.template, tt.item))
+		})
+	}
+}
+
+// TestResolveOrganizeCollision 测试目标已存在或已被本次计划占用时追加序号
+func TestResolveOrganizeCollision(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.jpg")
+	writeTestFile(t, existing, "existing")
+	writeTestFile(t, filepath.Join(dir, "d.jpg.xmp"), "orphan")
+
+	tests := []struct {
+		name     string
+		from     string
+		target   string
+		sidecars []string
+		reserved map[string]string
+		want     string
+	}{
+		{name: "目标空闲", from: "/src/b.jpg", target: filepath.Join(dir, "b.jpg"), want: filepath.Join(dir, "b.jpg")},
+		{name: "目标已存在", from: "/src/a.jpg", target: existing, want: filepath.Join(dir, "a_1.jpg")},
+		{name: "文件已在目标位置", from: existing, target: existing, want: existing},
+		{
+			name: "序号已被占用", from: "/src/a.jpg", target: existing,
+			reserved: map[string]string{filepath.Join(dir, "a_1.jpg"): "/src/other.jpg"},
+			want:     filepath.Join(dir, "a_2.jpg"),
+		},
+		{
+			name: "目标已被本次计划占用", from: "/src/c.jpg", target: filepath.Join(dir, "C.jpg"),
+			reserved: map[string]string{filepath.Join(dir, "c.jpg"): "/src/first.jpg"},
+			want:     filepath.Join(dir, "C_1.jpg"),
+		},
+		{
+			name: "侧边文件目标已存在", from: "/src/d.jpg", target: filepath.Join(dir, "d.jpg"),
+			sidecars: []string{"/src/d.jpg.xmp"},
+			want:     filepath.Join(dir, "d_1.jpg"),
+		},
+		{
+			name: "侧边文件目标已被本次计划占用", from: "/src/e.jpg", target: filepath.Join(dir, "e.jpg"),
+			sidecars: []string{"/src/e.aae"},
+			reserved: map[string]string{filepath.Join(dir, "e.aae"): "/src/other.aae"},
+			want:     filepath.Join(dir, "e_1.jpg"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// planOrganize 以小写路径登记已占用的目标
+			reserved := make(map[string]string)
+			for target, from := range tt.reserved {
+				reserved[strings.ToLower(target)] = from
+			}
+			assert.Equal(t, tt.want, resolveOrganizeCollision(tt.from, tt.target, tt.sidecars, reserved))
+		})
+	}
+}
+
+// TestOrganize_MovesSidecarsAndUndo 测试侧边文件跟随媒体改名移动，撤销后恢复原状
+func TestOrganize_MovesSidecarsAndUndo(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	taken := time.Date(2020, 1, 2, 10, 30, 0, 0, time.Local)
+
+	files := map[string]string{
+		"camera/IMG_0001.JPG":      "photo",
+		"camera/IMG_0001.JPG.xmp":  "xmp",
+		"camera/IMG_0001.AAE":      "aae",
+		"camera/IMG_0001.JPG.json": "json",
+		"camera/IMG_0002.JPG":      "other",
+		"dup/copy.jpg":             "existing",
+		"dup/copy.jpg.xmp":         "dup xmp",
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(in, name), content)
+	}
+	// 目标位置已有内容相同的文件：媒体标记为重复，侧边文件留在原处
+	writeTestFile(t, filepath.Join(out, "2021", "01", "2021-01-05_080000.jpg"), "existing")
+
+	items := []organizeItem{
+		{path: filepath.Join(in, "camera", "IMG_0001.JPG"), date: taken, dateSource: dateSourceEXIF},
+		{path: filepath.Join(in, "camera", "IMG_0002.JPG"), date: taken, dateSource: dateSourceFilename},
+		{path: filepath.Join(in, "dup", "copy.jpg"), date: time.Date(2021, 1, 5, 8, 0, 0, 0, time.Local), dateSource: dateSourceEXIF},
+	}
+	opts := organizeOptions{inputDir: in, outputDir: out, template: "{year}/{month}/{date}_{time}{ext}"}
+
+	manifest := planOrganize(items, opts)
+	target := func(parts ...string) string { return filepath.Join(append([]string{out}, parts...)...) }
+	want := map[string]organizeEntry{
+		filepath.Join(in, "camera", "IMG_0001.JPG"):      {To: target("2020", "01", "2020-01-02_103000.jpg"), Status: organizePlanned},
+		filepath.Join(in, "camera", "IMG_0001.JPG.xmp"):  {To: target("2020", "01", "2020-01-02_103000.jpg.xmp"), Status: organizePlanned, Sidecar: true},
+		filepath.Join(in, "camera", "IMG_0001.AAE"):      {To: target("2020", "01", "2020-01-02_103000.AAE"), Status: organizePlanned, Sidecar: true},
+		filepath.Join(in, "camera", "IMG_0001.JPG.json"): {To: target("2020", "01", "2020-01-02_103000.jpg.json"), Status: organizePlanned, Sidecar: true},
+		filepath.Join(in, "camera", "IMG_0002.JPG"):      {To: target("2020", "01", "2020-01-02_103000_1.jpg"), Status: organizePlanned},
+		filepath.Join(in, "dup", "copy.jpg"):             {To: target("2021", "01", "2021-01-05_080000.jpg"), Status: organizeDuplicate},
+		filepath.Join(in, "dup", "copy.jpg.xmp"):         {To: filepath.Join(in, "dup", "copy.jpg.xmp"), Status: organizeUnchanged, Sidecar: true},
+	}
+	require.Len(t, manifest.Entries, len(want))
+	for _, entry := range manifest.Entries {
+		expected, ok := want[entry.From]
+		require.True(t, ok, "意外的条目 %s", entry.From)
+		assert.Equal(t, expected.To, entry.To, entry.From)
+		assert.Equal(t, expected.Status, entry.Status, entry.From)
+		assert.Equal(t, expected.Sidecar, entry.Sidecar, entry.From)
+	}
+
+	moved, failed := executeOrganize(manifest)
+	assert.Equal(t, 2, moved)
+	assert.Zero(t, failed)
+	for from, entry := range want {
+		if entry.Status == organizePlanned {
+			assert.NoFileExists(t, from)
+			assert.FileExists(t, entry.To)
+		}
+	}
+	assert.NoDirExists(t, filepath.Join(in, "camera"), "移空的目录被删除")
+	assert.FileExists(t, filepath.Join(in, "dup", "copy.jpg"), "重复文件不移动")
+
+	manifestPath := filepath.Join(out, organizeManifestDir, "manifest.json")
+	require.NoError(t, writeOrganizeManifest(manifestPath, manifest))
+	require.NoError(t, undoOrganize(manifestPath, false))
+
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(in, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, content, string(data), name)
+	}
+	assert.NoDirExists(t, target("2020"), "撤销后移空的目录被删除")
+	assert.FileExists(t, target("2021", "01", "2021-01-05_080000.jpg"), "已有文件不受撤销影响")
+}
+
+// TestPlanOrganize_SidecarCollision 测试侧边文件目标被占用时媒体与侧边文件一起改用新序号
+func TestPlanOrganize_SidecarCollision(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	media, sidecar := filepath.Join(in, "IMG_0001.JPG"), filepath.Join(in, "IMG_0001.JPG.xmp")
+	writeTestFile(t, media, "photo")
+	writeTestFile(t, sidecar, "xmp")
+	// 输出目录中只有同名侧边文件，媒体目标本身空闲
+	writeTestFile(t, filepath.Join(out, "2020-01-02.jpg.xmp"), "orphan")
+
+	items := []organizeItem{{path: media, date: time.Date(2020, 1, 2, 10, 30, 0, 0, time.Local), dateSource: dateSourceEXIF}}
+	manifest := planOrganize(items, organizeOptions{inputDir: in, outputDir: out, template: "{date}{ext}"})
+
+	require.Len(t, manifest.Entries, 2)
+	for i, want := range []string{"2020-01-02_1.jpg", "2020-01-02_1.jpg.xmp"} {
+		assert.Equal(t, filepath.Join(out, want), manifest.Entries[i].To)
+		assert.Equal(t, organizePlanned, manifest.Entries[i].Status)
+	}
+}
+
+// TestUndoOrganize_InterruptedAndDryRun 测试中断后按实际位置撤销，试运行清单不可撤销
+func TestUndoOrganize_InterruptedAndDryRun(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	movedFrom, movedTo := filepath.Join(in, "a.jpg"), filepath.Join(out, "2020", "a.jpg")
+	pendingFrom, pendingTo := filepath.Join(in, "b.jpg"), filepath.Join(out, "2020", "b.jpg")
+	writeTestFile(t, movedTo, "a")
+	writeTestFile(t, pendingFrom, "b")
+
+	// 清单在移动前写入：a 已移动但状态仍为 planned，b 尚未移动
+	manifest := &organizeManifest{InputDir: in, OutputDir: out, Entries: []organizeEntry{
+		{From: movedFrom, To: movedTo, Status: organizePlanned},
+		{From: pendingFrom, To: pendingTo, Status: organizePlanned},
+	}}
+	manifestPath := filepath.Join(out, organizeManifestDir, "manifest.json")
+	require.NoError(t, writeOrganizeManifest(manifestPath, manifest))
+	require.NoError(t, undoOrganize(manifestPath, false))
+	assert.FileExists(t, movedFrom)
+	assert.FileExists(t, pendingFrom)
+	assert.NoDirExists(t, filepath.Join(out, "2020"))
+
+	manifest.DryRun = true
+	require.NoError(t, writeOrganizeManifest(manifestPath, manifest))
+	assert.Error(t, undoOrganize(manifestPath, false))
+}
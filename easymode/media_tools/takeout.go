@@ -0,0 +1,721 @@
+// media_tools/takeout.go - Google Takeout 元数据合并模块
+//
+// 功能说明：
+// - 扫描 Takeout 导出的 *.json / *.supplemental-metadata.json 侧边文件
+// - 按 Takeout 的命名规则定位对应媒体：重复序号 IMG.JPG(1).json → IMG(1).JPG、
+//   截断到46个字符的文件名、被截断的 supplemental-metadata 后缀、缺少扩展名的旧格式
+// - 同一侧边文件同时应用到 -edited 编辑版本和 Live Photo 的视频部分
+// - 拍摄时间、GPS、描述和人物写入 EXIF/XMP（视频写入 QuickTime），并按拍摄时间设置修改时间
+// - 默认只补全缺失的标签，验证写入结果后删除侧边文件
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// takeoutOptions Takeout 合并参数
+type takeoutOptions struct {
+	inputDir  string
+	overwrite bool           // 覆盖媒体文件中已有的标签（默认只补全缺失的）
+	keepJSON  bool           // 合并成功后保留侧边文件
+	location  *time.Location // 写入EXIF本地时间所用的时区
+	workers   int
+	dryRun    bool
+}
+
+// takeoutSidecar Takeout JSON 侧边文件中用到的字段
+type takeoutSidecar struct {
+	Title          string        `json:"title"`
+	Description    string        `json:"description"`
+	PhotoTakenTime takeoutTime   `json:"photoTakenTime"`
+	CreationTime   takeoutTime   `json:"creationTime"`
+	GeoData        takeoutGeo    `json:"geoData"`
+	GeoDataExif    takeoutGeo    `json:"geoDataExif"`
+	People         []takeoutName `json:"people"`
+}
+
+type takeoutTime struct {
+	Timestamp string `json:"timestamp"` // Unix秒，UTC
+}
+
+type takeoutGeo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+type takeoutName struct {
+	Name string `json:"name"`
+}
+
+// takeoutFields 从侧边文件得到、准备写入媒体文件的字段
+type takeoutFields struct {
+	taken       time.Time // 零值表示没有拍摄时间
+	hasGPS      bool
+	latitude    float64
+	longitude   float64
+	altitude    float64
+	description string
+	people      []string
+}
+
+// takeoutMergeTask 一个侧边文件及其对应的媒体文件
+type takeoutMergeTask struct {
+	jsonPath string
+	media    []string
+	sidecar  *takeoutSidecar
+}
+
+const (
+	takeoutSupplementalSuffix = "supplemental-metadata"
+	exifDateLayout            = "2006:01:02 15:04:05"
+	exifOffsetLayout          = "-07:00"
+)
+
+// takeoutDuplicatePattern 重复文件序号，如 IMG_0001.JPG(1)
+var takeoutDuplicatePattern = regexp.MustCompile(`^(.*?)(\(\d+\))$`)
+
+// takeoutEditedSuffixes Google Photos 编辑版本的文件名后缀（随导出语言变化）
+var takeoutEditedSuffixes = []string{"-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-bewerkt", "-編集済み"}
+
+// takeoutVideoExts 写入 QuickTime 标签的视频格式
+var takeoutVideoExts = map[string]bool{".mp4": true, ".mov": true, ".m4v": true, ".3gp": true, ".avi": true, ".mkv": true}
+
+func runMergeTakeout(args []string) {
+	fs := flag.NewFlagSet("merge-takeout", flag.ExitOnError)
+	inputDir := fs.String("dir", "", "📂 输入目录路径（必需）")
+	overwrite := fs.Bool("overwrite", false, "✏️  覆盖媒体文件中已有的标签（默认只补全缺失的）")
+	keepJSON := fs.Bool("keep-json", false, "📄 合并成功后保留JSON侧边文件")
+	tz := fs.String("tz", "local", "🕒 写入EXIF本地时间的时区（local、UTC、+08:00 或 Asia/Shanghai）")
+	workers := fs.Int("workers", 0, "⚡ 并发数（0为自动）")
+	dryRun := fs.Bool("dry-run", false, "🔍 试运行模式，不实际执行")
+
+	fs.Parse(args)
+
+	if *inputDir == "" {
+		logger.Println("❌ 错误: 必须指定输入目录 (-dir)")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	location, err := parseTimezone(*tz)
+	if err != nil {
+		logger.Fatalf("❌ 无效的时区 %q: %v", *tz, err)
+	}
+
+	opts := defaultTakeoutOptions(*inputDir, *dryRun)
+	opts.overwrite = *overwrite
+	opts.keepJSON = *keepJSON
+	opts.location = location
+	if *workers > 0 {
+		opts.workers = *workers
+	}
+	runMergeTakeoutInternal(opts)
+}
+
+// defaultTakeoutOptions auto 命令使用的默认参数：保留JSON侧边文件，删除需通过 merge-takeout 显式执行
+func defaultTakeoutOptions(inputDir string, dryRun bool) takeoutOptions {
+	workers := runtime.NumCPU()
+	if workers > 8 {
+		workers = 8
+	}
+	return takeoutOptions{inputDir: inputDir, keepJSON: true, location: time.Local, workers: workers, dryRun: dryRun}
+}
+
+// parseTimezone 解析时区：local、UTC、±HH:MM 偏移或 IANA 名称
+func parseTimezone(value string) (*time.Location, error) {
+	switch strings.ToLower(value) {
+	case "", "local":
+		return time.Local, nil
+	case "utc", "z":
+		return time.UTC, nil
+	}
+	if offset, err := time.Parse(exifOffsetLayout, value); err == nil {
+		_, seconds := offset.Zone()
+		return time.FixedZone(value, seconds), nil
+	}
+	return time.LoadLocation(value)
+}
+
+// runMergeTakeoutInternal 合并目录中的 Takeout 侧边文件(并发版本)
+func runMergeTakeoutInternal(opts takeoutOptions) {
+	logger.Printf("🔍 扫描Takeout侧边文件: %s", opts.inputDir)
+
+	tasks, unmatched, err := scanTakeoutSidecars(opts.inputDir)
+	if err != nil {
+		logger.Printf("❌ 扫描Takeout侧边文件失败: %v", err)
+		return
+	}
+	for _, jsonPath := range unmatched {
+		logger.Printf("⚠️  未找到对应媒体文件: %s", jsonPath)
+	}
+
+	logger.Printf("📊 找到 %d 个Takeout侧边文件, 未匹配 %d 个", len(tasks)+len(unmatched), len(unmatched))
+	if len(tasks) == 0 {
+		logger.Printf("✅ 无需合并,未发现可匹配的Takeout侧边文件")
+		return
+	}
+	if !opts.dryRun && !commandAvailable("exiftool") {
+		logger.Printf("❌ 未找到exiftool，无法写入元数据")
+		return
+	}
+	logger.Printf("⚡ 并发线程数: %d", opts.workers)
+
+	var merged, failed, deleted int32
+	failed = int32(len(unmatched))
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 用于保护日志输出
+
+	taskChan := make(chan takeoutMergeTask, len(tasks))
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range taskChan {
+				fields := task.sidecar.fields()
+				ok := true
+				for _, mediaFile := range task.media {
+					if opts.dryRun {
+						mu.Lock()
+						logger.Printf("🔍 [试运行] 将合并: %s -> %s (%s)", filepath.Base(task.jsonPath), filepath.Base(mediaFile), fields.describe(opts.location))
+						mu.Unlock()
+						continue
+					}
+					if err := mergeTakeoutToMedia(fields, mediaFile, opts); err != nil {
+						mu.Lock()
+						logger.Printf("❌ 合并失败: %s -> %s: %v", filepath.Base(task.jsonPath), filepath.Base(mediaFile), err)
+						mu.Unlock()
+						ok = false
+						continue
+					}
+					mu.Lock()
+					logger.Printf("✅ Takeout合并成功: %s", filepath.Base(mediaFile))
+					mu.Unlock()
+				}
+				if !ok {
+					atomic.AddInt32(&failed, 1)
+					continue
+				}
+				atomic.AddInt32(&merged, 1)
+				if opts.dryRun || opts.keepJSON {
+					continue
+				}
+				// 所有对应媒体都合并成功后才删除侧边文件
+				if err := os.Remove(task.jsonPath); err != nil {
+					mu.Lock()
+					logger.Printf("⚠️  删除JSON文件失败: %s: %v", filepath.Base(task.jsonPath), err)
+					mu.Unlock()
+				} else {
+					atomic.AddInt32(&deleted, 1)
+				}
+			}
+		}()
+	}
+	for _, task := range tasks {
+		taskChan <- task
+	}
+	close(taskChan)
+	wg.Wait()
+
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	logger.Printf("📊 Takeout合并完成: 成功 %d, 失败 %d", merged, failed)
+	logger.Printf("🗑️  已删除JSON: %d 个", deleted)
+	logger.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+// scanTakeoutSidecars 扫描侧边文件并定位对应媒体，返回可合并的任务和未匹配的侧边文件
+func scanTakeoutSidecars(dir string) ([]takeoutMergeTask, []string, error) {
+	names := make(map[string][]string) // 目录 → 非JSON文件名
+	jsons := make(map[string][]string) // 目录 → JSON文件名
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		parent := filepath.Dir(path)
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			jsons[parent] = append(jsons[parent], info.Name())
+		} else {
+			names[parent] = append(names[parent], info.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tasks []takeoutMergeTask
+	var unmatched []string
+	for parent, jsonNames := range jsons {
+		sort.Strings(jsonNames)
+		for _, jsonName := range jsonNames {
+			jsonPath := filepath.Join(parent, jsonName)
+			sidecar, ok := readTakeoutSidecar(jsonPath)
+			if !ok {
+				continue // 不是媒体侧边文件（如相册的 metadata.json）
+			}
+			mediaName := resolveTakeoutMedia(jsonName, sidecar.Title, names[parent])
+			if mediaName == "" {
+				unmatched = append(unmatched, jsonPath)
+				continue
+			}
+			task := takeoutMergeTask{jsonPath: jsonPath, sidecar: sidecar, media: []string{filepath.Join(parent, mediaName)}}
+			for _, companion := range takeoutCompanions(mediaName, names[parent], jsonNames) {
+				task.media = append(task.media, filepath.Join(parent, companion))
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].jsonPath < tasks[j].jsonPath })
+	sort.Strings(unmatched)
+	return tasks, unmatched, nil
+}
+
+// readTakeoutSidecar 读取侧边文件；没有标题和时间的JSON不是媒体侧边文件
+func readTakeoutSidecar(jsonPath string) (*takeoutSidecar, bool) {
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, false
+	}
+	var sidecar takeoutSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return nil, false
+	}
+	if sidecar.Title == "" || (sidecar.PhotoTakenTime.Timestamp == "" && sidecar.CreationTime.Timestamp == "") {
+		return nil, false
+	}
+	return &sidecar, true
+}
+
+// resolveTakeoutMedia 按 Takeout 的命名规则在同目录文件中找到侧边文件对应的媒体
+//
+//	IMG_0001.JPG.json                       → IMG_0001.JPG
+//	IMG_0001.JPG.supplemental-metadata.json → IMG_0001.JPG（后缀可能被截断为 .supplemental-met、.supp 等）
+//	IMG_0001.JPG(1).json                    → IMG_0001(1).JPG（重复序号移到扩展名之前）
+//	IMG_0001.json                           → IMG_0001.jpg（旧格式不含媒体扩展名）
+//	<媒体文件名前46个字符>.json              → 以该前缀开头的唯一媒体文件
+func resolveTakeoutMedia(jsonName, title string, names []string) string {
+	base := jsonName[:len(jsonName)-len(filepath.Ext(jsonName))]
+	duplicate := ""
+	if m := takeoutDuplicatePattern.FindStringSubmatch(base); m != nil {
+		base, duplicate = m[1], m[2]
+	}
+	base = stripSupplementalSuffix(base)
+
+	candidates := []string{base}
+	if title != "" && title != base {
+		candidates = append(candidates, title)
+	}
+
+	// 先精确匹配（含大小写不同），再按缺少扩展名和截断的规则模糊匹配
+	for _, candidate := range candidates {
+		target := insertDuplicateIndex(candidate, duplicate)
+		for _, name := range names {
+			if name == target {
+				return name
+			}
+		}
+		for _, name := range names {
+			if strings.EqualFold(name, target) {
+				return name
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		stem := candidate + duplicate
+		var matches []string
+		for _, name := range names {
+			if !isMediaFile(filepath.Ext(name)) {
+				continue
+			}
+			nameStem := strings.TrimSuffix(name, filepath.Ext(name))
+			switch {
+			case strings.EqualFold(nameStem, stem):
+				return name
+			case len(candidate) >= 40 && strings.HasPrefix(strings.ToLower(name), strings.ToLower(candidate)) &&
+				(duplicate == "" || strings.HasSuffix(nameStem, duplicate)):
+				matches = append(matches, name)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+// stripSupplementalSuffix 去掉（可能被截断的）.supplemental-metadata 后缀
+func stripSupplementalSuffix(base string) string {
+	idx := strings.LastIndex(base, ".")
+	if idx <= 0 {
+		return base
+	}
+	segment := strings.ToLower(base[idx+1:])
+	if segment == "" || (strings.HasPrefix(takeoutSupplementalSuffix, segment) && !isMediaFile("."+segment)) {
+		return base[:idx]
+	}
+	return base
+}
+
+// insertDuplicateIndex 将重复序号放到扩展名之前：IMG.JPG + (1) → IMG(1).JPG
+func insertDuplicateIndex(name, duplicate string) string {
+	if duplicate == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + duplicate + ext
+}
+
+// takeoutCompanions 共用同一侧边文件的编辑版本和 Live Photo 视频（自身有侧边文件的除外）
+func takeoutCompanions(mediaName string, names, jsonNames []string) []string {
+	ext := filepath.Ext(mediaName)
+	stem := strings.TrimSuffix(mediaName, ext)
+	isVideo := takeoutVideoExts[strings.ToLower(ext)]
+
+	var companions []string
+	for _, name := range names {
+		nameExt := filepath.Ext(name)
+		if name == mediaName || !isMediaFile(nameExt) || hasOwnTakeoutSidecar(name, jsonNames) {
+			continue
+		}
+		nameStem := strings.TrimSuffix(name, nameExt)
+		if !isVideo && takeoutVideoExts[strings.ToLower(nameExt)] && strings.EqualFold(nameStem, stem) {
+			companions = append(companions, name)
+			continue
+		}
+		for _, suffix := range takeoutEditedSuffixes {
+			if strings.EqualFold(nameStem, stem+suffix) {
+				companions = append(companions, name)
+				break
+			}
+		}
+	}
+	return companions
+}
+
+// hasOwnTakeoutSidecar 媒体文件是否有以自身文件名命名的侧边文件
+func hasOwnTakeoutSidecar(name string, jsonNames []string) bool {
+	prefix := strings.ToLower(name) + "."
+	for _, jsonName := range jsonNames {
+		if strings.HasPrefix(strings.ToLower(jsonName), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fields 提取要写入的字段：拍摄时间缺失时用创建时间，geoData 为零时用 geoDataExif
+func (s *takeoutSidecar) fields() takeoutFields {
+	var f takeoutFields
+	for _, ts := range []string{s.PhotoTakenTime.Timestamp, s.CreationTime.Timestamp} {
+		if seconds, err := strconv.ParseInt(ts, 10, 64); err == nil && seconds > 0 {
+			f.taken = time.Unix(seconds, 0)
+			break
+		}
+	}
+	for _, geo := range []takeoutGeo{s.GeoData, s.GeoDataExif} {
+		if geo.Latitude != 0 || geo.Longitude != 0 {
+			f.hasGPS, f.latitude, f.longitude, f.altitude = true, geo.Latitude, geo.Longitude, geo.Altitude
+			break
+		}
+	}
+	f.description = strings.TrimSpace(s.Description)
+	for _, person := range s.People {
+		if name := strings.TrimSpace(person.Name); name != "" {
+			f.people = append(f.people, name)
+		}
+	}
+	return f
+}
+
+// describe 试运行时显示的字段摘要
+func (f takeoutFields) describe(location *time.Location) string {
+	var parts []string
+	if !f.taken.IsZero() {
+		parts = append(parts, "拍摄时间 "+f.taken.In(location).Format("2006-01-02 15:04:05 -07:00"))
+	}
+	if f.hasGPS {
+		parts = append(parts, fmt.Sprintf("GPS %.5f,%.5f", f.latitude, f.longitude))
+	}
+	if f.description != "" {
+		parts = append(parts, "描述")
+	}
+	if len(f.people) > 0 {
+		parts = append(parts, "人物 "+strings.Join(f.people, "、"))
+	}
+	if len(parts) == 0 {
+		return "无可写入字段"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// takeoutExistingTags 媒体文件中已有的相关标签（-n 数值输出，坐标取带符号的 Composite 值）
+type takeoutExistingTags struct {
+	DateTimeOriginal string      `json:"DateTimeOriginal"`
+	CreateDate       string      `json:"CreateDate"`
+	GPSLatitude      interface{} `json:"GPSLatitude"`
+	GPSLongitude     interface{} `json:"GPSLongitude"`
+	ImageDescription string      `json:"ImageDescription"`
+	Description      string      `json:"Description"`
+	PersonInImage    interface{} `json:"PersonInImage"`
+}
+
+// readTakeoutTags 读取媒体文件中已有的相关标签
+func readTakeoutTags(mediaFile string) (*takeoutExistingTags, error) {
+	out, err := exec.Command("exiftool", "-j", "-n", "-q", "-q",
+		"-DateTimeOriginal", "-CreateDate", "-Composite:GPSLatitude", "-Composite:GPSLongitude",
+		"-ImageDescription", "-Description", "-PersonInImage", mediaFile).Output()
+	if err != nil {
+		return nil, fmt.Errorf("读取标签失败: %v", err)
+	}
+	var records []takeoutExistingTags
+	if err := json.Unmarshal(out, &records); err != nil || len(records) == 0 {
+		return nil, fmt.Errorf("解析标签失败: %v", err)
+	}
+	return &records[0], nil
+}
+
+// mergeTakeoutToMedia 将侧边文件字段写入媒体文件，验证结果并设置修改时间
+func mergeTakeoutToMedia(fields takeoutFields, mediaFile string, opts takeoutOptions) error {
+	if !isValidFilePath(mediaFile) {
+		return fmt.Errorf("文件路径包含不安全字符")
+	}
+	if !isMediaFile(filepath.Ext(mediaFile)) {
+		return fmt.Errorf("不支持的媒体文件格式: %s", filepath.Ext(mediaFile))
+	}
+
+	existing, err := readTakeoutTags(mediaFile)
+	if err != nil {
+		return err
+	}
+	write := fields
+	if !opts.overwrite {
+		write = missingTakeoutFields(fields, existing)
+	}
+
+	if args := takeoutExiftoolArgs(write, mediaFile, opts.location); len(args) > 0 {
+		args = append([]string{"-overwrite_original", "-P"}, args...)
+		output, err := exec.Command("exiftool", append(args, mediaFile)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("exiftool执行失败: %v\n输出: %s", err, string(output))
+		}
+		if !verifyTakeoutMerge(mediaFile, write, opts.location) {
+			return fmt.Errorf("合并验证失败")
+		}
+	}
+
+	// 复制和下载会重置修改时间，按文件中最终的拍摄时间恢复，后续转换的 PreserveTimes 才能保留正确的值
+	if taken := takeoutFileTime(fields, write, existing, mediaFile, opts.location); !taken.IsZero() {
+		if err := os.Chtimes(mediaFile, taken, taken); err != nil {
+			return fmt.Errorf("设置修改时间失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// takeoutFileTime 合并后文件中实际的拍摄时间：写入了侧边文件时间时用它，
+// 保留已有时间时解析已有标签（图像为 location 本地时间，视频 QuickTime 为 UTC）；
+// 侧边文件没有时间或已有时间无法解析时返回零值，不修改文件时间
+func takeoutFileTime(fields, write takeoutFields, existing *takeoutExistingTags, mediaFile string, location *time.Location) time.Time {
+	if !write.taken.IsZero() || fields.taken.IsZero() {
+		return write.taken
+	}
+	zone := location
+	if takeoutVideoExts[strings.ToLower(filepath.Ext(mediaFile))] {
+		zone = time.UTC
+	}
+	for _, value := range []string{existing.DateTimeOriginal, existing.CreateDate} {
+		if len(value) < len(exifDateLayout) || strings.HasPrefix(value, "0000") {
+			continue
+		}
+		if taken, err := time.ParseInLocation(exifDateLayout, value[:len(exifDateLayout)], zone); err == nil {
+			return taken
+		}
+	}
+	return time.Time{}
+}
+
+// missingTakeoutFields 只保留媒体文件中缺失的字段；人物只补充尚未记录的名字
+func missingTakeoutFields(fields takeoutFields, existing *takeoutExistingTags) takeoutFields {
+	if existing.DateTimeOriginal != "" || (existing.CreateDate != "" && !strings.HasPrefix(existing.CreateDate, "0000")) {
+		fields.taken = time.Time{}
+	}
+	if existing.GPSLatitude != nil && existing.GPSLongitude != nil {
+		fields.hasGPS = false
+	}
+	if strings.TrimSpace(existing.ImageDescription) != "" || strings.TrimSpace(existing.Description) != "" {
+		fields.description = ""
+	}
+	known := make(map[string]bool)
+	for _, name := range tagStrings(existing.PersonInImage) {
+		known[name] = true
+	}
+	var people []string
+	for _, name := range fields.people {
+		if !known[name] {
+			people = append(people, name)
+		}
+	}
+	fields.people = people
+	return fields
+}
+
+// takeoutExiftoolArgs 生成写入标签的exiftool参数
+// 图像同时写 EXIF 和 XMP（GIF等不支持EXIF的格式只保留XMP），视频写 QuickTime（UTC）
+func takeoutExiftoolArgs(fields takeoutFields, mediaFile string, location *time.Location) []string {
+	isVideo := takeoutVideoExts[strings.ToLower(filepath.Ext(mediaFile))]
+	var args []string
+
+	if !fields.taken.IsZero() {
+		local := fields.taken.In(location)
+		date := local.Format(exifDateLayout)
+		offset := local.Format(exifOffsetLayout)
+		if isVideo {
+			args = append(args, "-api", "QuickTimeUTC",
+				"-QuickTime:CreateDate="+date+offset,
+				"-QuickTime:ModifyDate="+date+offset,
+				"-Keys:CreationDate="+date+offset)
+		} else {
+			args = append(args,
+				"-EXIF:DateTimeOriginal="+date,
+				"-EXIF:CreateDate="+date,
+				"-EXIF:OffsetTimeOriginal="+offset,
+				"-XMP-exif:DateTimeOriginal="+date+offset,
+				"-XMP-photoshop:DateCreated="+date+offset)
+		}
+	}
+
+	if fields.hasGPS {
+		lat := strconv.FormatFloat(fields.latitude, 'f', -1, 64)
+		lon := strconv.FormatFloat(fields.longitude, 'f', -1, 64)
+		alt := strconv.FormatFloat(fields.altitude, 'f', -1, 64)
+		if isVideo {
+			args = append(args, "-Keys:GPSCoordinates="+lat+", "+lon+", "+alt)
+		} else {
+			args = append(args,
+				"-GPSLatitude="+strconv.FormatFloat(math.Abs(fields.latitude), 'f', -1, 64), "-GPSLatitudeRef="+lat,
+				"-GPSLongitude="+strconv.FormatFloat(math.Abs(fields.longitude), 'f', -1, 64), "-GPSLongitudeRef="+lon,
+				"-GPSAltitude="+strconv.FormatFloat(math.Abs(fields.altitude), 'f', -1, 64), "-GPSAltitudeRef="+alt,
+				"-XMP-exif:GPSLatitude="+lat, "-XMP-exif:GPSLongitude="+lon)
+		}
+	}
+
+	if fields.description != "" {
+		if isVideo {
+			args = append(args, "-Keys:Description="+fields.description)
+		} else {
+			args = append(args, "-EXIF:ImageDescription="+fields.description, "-XMP-dc:Description="+fields.description)
+		}
+	}
+
+	for _, name := range fields.people {
+		args = append(args, "-XMP-iptcExt:PersonInImage+="+name, "-XMP-dc:Subject+="+name)
+	}
+	return args
+}
+
+// verifyTakeoutMerge 验证写入的字段能从媒体文件中读回
+// 与 verifyMerge 一样以读回标签为准，逐项比较时间、坐标、描述和人物
+func verifyTakeoutMerge(mediaPath string, fields takeoutFields, location *time.Location) bool {
+	tags, err := readTakeoutTags(mediaPath)
+	if err != nil {
+		logger.Printf("❌ 获取媒体文件标签失败 %s: %v", filepath.Base(mediaPath), err)
+		return false
+	}
+
+	if !fields.taken.IsZero() {
+		written := tags.DateTimeOriginal
+		if takeoutVideoExts[strings.ToLower(filepath.Ext(mediaPath))] {
+			written = tags.CreateDate
+		}
+		expected := fields.taken.In(location).Format(exifDateLayout)
+		if takeoutVideoExts[strings.ToLower(filepath.Ext(mediaPath))] {
+			expected = fields.taken.UTC().Format(exifDateLayout) // QuickTime 以UTC存储，-n 输出原始值
+		}
+		if !strings.HasPrefix(written, expected) {
+			logger.Printf("❌ 拍摄时间未正确写入 %s: %q, 期望 %q", filepath.Base(mediaPath), written, expected)
+			return false
+		}
+	}
+
+	if fields.hasGPS {
+		lat, latOK := tagFloat(tags.GPSLatitude)
+		lon, lonOK := tagFloat(tags.GPSLongitude)
+		if !latOK || !lonOK || math.Abs(lat-fields.latitude) > 1e-4 || math.Abs(lon-fields.longitude) > 1e-4 {
+			logger.Printf("❌ GPS坐标未正确写入 %s", filepath.Base(mediaPath))
+			return false
+		}
+	}
+
+	if fields.description != "" && tags.ImageDescription != fields.description && tags.Description != fields.description {
+		logger.Printf("❌ 描述未正确写入 %s", filepath.Base(mediaPath))
+		return false
+	}
+
+	if len(fields.people) > 0 {
+		present := make(map[string]bool)
+		for _, name := range tagStrings(tags.PersonInImage) {
+			present[name] = true
+		}
+		for _, name := range fields.people {
+			if !present[name] {
+				logger.Printf("❌ 人物 %s 未写入 %s", name, filepath.Base(mediaPath))
+				return false
+			}
+		}
+	}
+
+	logger.Printf("✅ 验证成功: 元数据已正确写入 %s", filepath.Base(mediaPath))
+	return true
+}
+
+// tagStrings exiftool JSON 中单值或列表标签的字符串值
+func tagStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// tagFloat exiftool -n 输出的数值标签
+func tagFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestResolveTakeoutMedia 测试按 Takeout 命名规则定位侧边文件对应的媒体
+func TestResolveTakeoutMedia(t *testing.T) {
+	const long = "Screenshot_20200101-120000_Some Very Long Application Name.jpg"
+	truncated := long[:46] // Takeout 将侧边文件名截断到46个字符
+
+	tests := []struct {
+		name     string
+		jsonName string
+		title    string
+		names    []string
+		want     string
+	}{
+		{name: "媒体文件名加json", jsonName: "IMG_0001.JPG.json", names: []string{"IMG_0001.JPG", "IMG_0002.JPG"}, want: "IMG_0001.JPG"},
+		{name: "大小写不同", jsonName: "img_0001.jpg.json", names: []string{"IMG_0001.JPG"}, want: "IMG_0001.JPG"},
+		{name: "补充元数据后缀", jsonName: "IMG_0001.JPG.supplemental-metadata.json", names: []string{"IMG_0001.JPG"}, want: "IMG_0001.JPG"},
+		{name: "截断的补充元数据后缀", jsonName: "IMG_0001.JPG.supplemental-met.json", names: []string{"IMG_0001.JPG"}, want: "IMG_0001.JPG"},
+		{name: "重复序号移到扩展名之前", jsonName: "IMG_0001.JPG(1).json", names: []string{"IMG_0001.JPG", "IMG_0001(1).JPG"}, want: "IMG_0001(1).JPG"},
+		{name: "补充元数据后缀与重复序号", jsonName: "IMG_0001.JPG.supplemental-metadata(2).json", names: []string{"IMG_0001.JPG", "IMG_0001(2).JPG"}, want: "IMG_0001(2).JPG"},
+		{name: "旧格式不含媒体扩展名", jsonName: "IMG_0001.json", names: []string{"IMG_0001.jpg", "IMG_0001.txt"}, want: "IMG_0001.jpg"},
+		{name: "按标题匹配", jsonName: "unknown.json", title: "PXL_0001.jpg", names: []string{"PXL_0001.jpg"}, want: "PXL_0001.jpg"},
+		{name: "46字符截断", jsonName: truncated + ".json", names: []string{long, "other.jpg"}, want: long},
+		{name: "46字符截断与重复序号", jsonName: truncated + "(1).json", names: []string{long, long[:len(long)-4] + "(1).jpg"}, want: long[:len(long)-4] + "(1).jpg"},
+		{name: "截断前缀不唯一", jsonName: truncated + ".json", names: []string{long, truncated + " copy.jpg"}, want: ""},
+		{name: "短前缀不做模糊匹配", jsonName: "IMG.json", names: []string{"IMG_0001.jpg"}, want: ""},
+		{name: "没有对应媒体", jsonName: "IMG_0003.JPG.json", names: []string{"IMG_0001.JPG"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolveTakeoutMedia(tt.jsonName, tt.title, tt.names))
+		})
+	}
+}
+
+// TestStripSupplementalSuffix 测试去掉完整或被截断的 .supplemental-metadata 后缀
+func TestStripSupplementalSuffix(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{base: "IMG_0001.JPG.supplemental-metadata", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG.supplemental-met", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG.SUPP", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG.s", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG.", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG", want: "IMG_0001.JPG"},
+		{base: "IMG_0001.JPG.metadata", want: "IMG_0001.JPG.metadata"},
+		{base: "IMG_0001", want: "IMG_0001"},
+		{base: ".supplemental-metadata", want: ".supplemental-metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			assert.Equal(t, tt.want, stripSupplementalSuffix(tt.base))
+		})
+	}
+}
+
+// TestTakeoutFileTime 测试文件修改时间取合并后文件中实际的拍摄时间
+func TestTakeoutFileTime(t *testing.T) {
+	location := time.FixedZone("+08:00", 8*3600)
+	sidecar := takeoutFields{taken: time.Date(2021, 6, 1, 4, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name      string
+		write     takeoutFields
+		fields    takeoutFields
+		existing  takeoutExistingTags
+		mediaFile string
+		want      time.Time
+	}{
+		{name: "写入侧边文件时间", fields: sidecar, write: sidecar, mediaFile: "a.jpg", want: sidecar.taken},
+		{name: "侧边文件没有时间", mediaFile: "a.jpg", existing: takeoutExistingTags{DateTimeOriginal: "2019:05:01 10:00:00"}},
+		{
+			name: "保留已有的DateTimeOriginal", fields: sidecar, mediaFile: "a.jpg",
+			existing: takeoutExistingTags{DateTimeOriginal: "2019:05:01 10:00:00", CreateDate: "2018:01:01 00:00:00"},
+			want:     time.Date(2019, 5, 1, 10, 0, 0, 0, location),
+		},
+		{
+			name: "带时区和亚秒的已有时间", fields: sidecar, mediaFile: "a.jpg",
+			existing: takeoutExistingTags{DateTimeOriginal: "2019:05:01 10:00:00.123+02:00"},
+			want:     time.Date(2019, 5, 1, 10, 0, 0, 0, location),
+		},
+		{
+			name: "视频的CreateDate为UTC", fields: sidecar, mediaFile: "a.MOV",
+			existing: takeoutExistingTags{CreateDate: "2019:05:01 10:00:00"},
+			want:     time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{name: "已有时间无法解析时不修改", fields: sidecar, mediaFile: "a.jpg", existing: takeoutExistingTags{DateTimeOriginal: "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := takeoutFileTime(tt.fields, tt.write, &tt.existing, tt.mediaFile, location)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+// TestDefaultTakeoutOptions 测试 auto 合并后保留JSON侧边文件
+func TestDefaultTakeoutOptions(t *testing.T) {
+	opts := defaultTakeoutOptions("in", false)
+	assert.True(t, opts.keepJSON)
+	assert.False(t, opts.overwrite)
+}
@@ -0,0 +1,211 @@
+package utils_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pixly/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPixelHash 测试像素哈希只取决于解码后的像素，与编码方式无关
+func TestPixelHash(t *testing.T) {
+	reference := grayImage(32, texture)
+	changed := grayImage(32, texture)
+	changed.Pix[0]++
+
+	assert.Equal(t, utils.PixelHash(reference), utils.PixelHash(toPaletted(reference)), "调色板编码的相同像素")
+	assert.NotEqual(t, utils.PixelHash(reference), utils.PixelHash(changed), "单个像素不同")
+
+	// 像素序列相同但尺寸不同
+	row := image.NewGray(image.Rect(0, 0, 4, 1))
+	column := image.NewGray(image.Rect(0, 0, 1, 4))
+	copy(row.Pix, []uint8{10, 20, 30, 40})
+	copy(column.Pix, row.Pix)
+	assert.NotEqual(t, utils.PixelHash(row), utils.PixelHash(column), "1×N与N×1")
+
+	// 16位图像中低8位不同的像素
+	deep := image.NewGray16(image.Rect(0, 0, 1, 1))
+	deeper := image.NewGray16(image.Rect(0, 0, 1, 1))
+	deep.SetGray16(0, 0, color.Gray16{Y: 0x1200})
+	deeper.SetGray16(0, 0, color.Gray16{Y: 0x1201})
+	assert.NotEqual(t, utils.PixelHash(deep), utils.PixelHash(deeper), "16位精度")
+}
+
+// TestDifferenceHash 测试dHash对轻微失真稳定、对不同画面区分明显
+func TestDifferenceHash(t *testing.T) {
+	reference := grayImage(64, texture)
+	rising := grayImage(64, func(x, y int) uint8 { return uint8(124 + x/8) })
+	falling := grayImage(64, func(x, y int) uint8 { return uint8(131 - x/8) })
+
+	tests := []struct {
+		name        string
+		a, b        image.Image
+		maxDistance int
+		minDistance int
+	}{
+		{name: "完全一致", a: reference, b: toPaletted(reference), maxDistance: 0},
+		{name: "轻微噪声", a: reference, b: addNoise(reference, 2), maxDistance: 12},
+		{name: "明暗方向相反", a: rising, b: falling, minDistance: 48, maxDistance: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := utils.HammingDistance(utils.DifferenceHash(tt.a), utils.DifferenceHash(tt.b))
+			assert.GreaterOrEqual(t, distance, tt.minDistance)
+			assert.LessOrEqual(t, distance, tt.maxDistance)
+		})
+	}
+}
+
+// TestPerceptualHash 测试pHash对重新编码、噪声和缩放稳定，对不同画面区分明显
+func TestPerceptualHash(t *testing.T) {
+	reference := grayImage(64, texture)
+	checker := grayImage(64, func(x, y int) uint8 { return uint8(((x/16 + y/16) % 2) * 255) })
+
+	tests := []struct {
+		name        string
+		a, b        image.Image
+		maxDistance int
+		minDistance int
+	}{
+		{name: "完全一致", a: reference, b: toPaletted(reference), maxDistance: 0},
+		{name: "轻微噪声", a: reference, b: addNoise(reference, 2), maxDistance: 6},
+		{name: "缩小一半", a: reference, b: halve(reference), maxDistance: 6},
+		{name: "不同画面", a: reference, b: checker, minDistance: 16, maxDistance: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := utils.HammingDistance(utils.PerceptualHash(tt.a), utils.PerceptualHash(tt.b))
+			assert.GreaterOrEqual(t, distance, tt.minDistance)
+			assert.LessOrEqual(t, distance, tt.maxDistance)
+		})
+	}
+}
+
+// halve 按2x2平均缩小图像
+func halve(img *image.NRGBA) *image.NRGBA {
+	size := img.Bounds().Dx() / 2
+	return grayImage(size, func(x, y int) uint8 {
+		sum := 0
+		for dy := 0; dy < 2; dy++ {
+			for dx := 0; dx < 2; dx++ {
+				sum += int(img.NRGBAAt(2*x+dx, 2*y+dy).R)
+			}
+		}
+		return uint8(sum / 4)
+	})
+}
+
+// TestHammingDistance 测试汉明距离计算
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b     uint64
+		distance int
+	}{
+		{a: 0, b: 0, distance: 0},
+		{a: 0, b: 1, distance: 1},
+		{a: 0xFF, b: 0x0F, distance: 4},
+		{a: 0, b: ^uint64(0), distance: 64},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.distance, utils.HammingDistance(tt.a, tt.b), "%x ^ %x", tt.a, tt.b)
+	}
+}
+
+// TestValidateConversion_AntiCheat 测试第8层识别复制、改名、残留旧输出和画面不符
+func TestValidateConversion_AntiCheat(t *testing.T) {
+	installFakeTools(t)
+	reference := grayImage(64, texture)
+	rising := grayImage(64, func(x, y int) uint8 { return uint8(124 + x/8) })
+	falling := grayImage(64, func(x, y int) uint8 { return uint8(131 - x/8) })
+
+	tests := []struct {
+		name    string
+		source  image.Image
+		output  string
+		prepare func(t *testing.T, source, output string)
+		age     time.Duration
+		reason  utils.FailureReason
+		success bool
+	}{
+		{
+			name:   "复制源文件",
+			source: reference,
+			output: "output.png",
+			prepare: func(t *testing.T, source, output string) {
+				data, err := os.ReadFile(source)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(output, data, 0644))
+			},
+			reason: utils.ReasonIdenticalToSource,
+		},
+		{
+			name:    "PNG改名为AVIF",
+			source:  reference,
+			output:  "output.avif",
+			prepare: func(t *testing.T, source, output string) { writePNG(t, output, toPaletted(reference)) },
+			reason:  utils.ReasonMagicMismatch,
+		},
+		{
+			name:    "上次运行残留",
+			source:  reference,
+			output:  "output.png",
+			prepare: func(t *testing.T, source, output string) { writePNG(t, output, toPaletted(reference)) },
+			age:     time.Hour,
+			reason:  utils.ReasonStaleOutput,
+		},
+		{
+			name:    "不是同一画面",
+			source:  rising,
+			output:  "output.png",
+			prepare: func(t *testing.T, source, output string) { writePNG(t, output, falling) },
+			reason:  utils.ReasonPixelMismatch,
+		},
+		{
+			name:    "有效转换",
+			source:  reference,
+			output:  "output.png",
+			prepare: func(t *testing.T, source, output string) { writePNG(t, output, toPaletted(reference)) },
+			success: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.png")
+			output := filepath.Join(dir, tt.output)
+			writePNG(t, source, tt.source)
+			tt.prepare(t, source, output)
+
+			start := time.Now()
+			if tt.age > 0 {
+				old := start.Add(-tt.age)
+				require.NoError(t, os.Chtimes(output, old, old))
+			}
+
+			validator := utils.NewEightLayerValidator(utils.ValidationOptions{
+				TimeoutSeconds:  10,
+				StrictMode:      true,
+				AllowTolerance:  100,
+				Quality:         90,
+				ConversionStart: start,
+			})
+			result, err := validator.ValidateConversion(source, output, utils.EnhancedFileType{Extension: "png", IsImage: true})
+			require.NoError(t, err)
+
+			assert.Equal(t, 8, result.Layer, result.Message)
+			assert.Equal(t, tt.success, result.Success, result.Message)
+			assert.Equal(t, tt.reason, result.Reason, result.Message)
+			if tt.success {
+				assert.Equal(t, true, result.Details["all_layers_passed"])
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package utils_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExiftool 假exiftool：测试图像统一为 64x64
+const fakeExiftool = `#!/bin/sh
+echo "Image Width : 64"
+echo "Image Height : 64"
+`
+
+// fakeMagick 假magick：测试文件本身就是PNG，“转PNG”即复制到最后一个参数
+const fakeMagick = `#!/bin/sh
+for last; do :; done
+cp "$1" "$last"
+`
+
+// installFakeTools 用假 exiftool/magick 替换 PATH，使8层验证无需外部工具
+func installFakeTools(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "exiftool"), []byte(fakeExiftool), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "magick"), []byte(fakeMagick), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// grayImage 按 fn 生成 size x size 灰度图
+func grayImage(size int, fn func(x, y int) uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := fn(x, y)
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+// texture 带纹理的测试图，避免纯色图让SSIM退化
+func texture(x, y int) uint8 {
+	return uint8((x*7 + y*13 + (x*y)%29) % 200)
+}
+
+// addNoise 给图像加上幅度为 amplitude 的固定种子噪声
+func addNoise(img *image.NRGBA, amplitude int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	bounds := img.Bounds()
+	return grayImage(bounds.Dx(), func(x, y int) uint8 {
+		v := int(img.NRGBAAt(x, y).R) + rng.Intn(2*amplitude+1) - amplitude
+		return uint8(min(max(v, 0), 255))
+	})
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+// TestCalcQualityMetrics 测试PSNR/SSIM/MS-SSIM的已知取值与随失真单调下降
+func TestCalcQualityMetrics(t *testing.T) {
+	reference := grayImage(256, texture)
+	offset := grayImage(256, func(x, y int) uint8 { return texture(x, y) + 10 })
+
+	tests := []struct {
+		name      string
+		reference image.Image
+		distorted image.Image
+		psnr      float64
+		minSSIM   float64
+		maxSSIM   float64
+		scales    int
+	}{
+		{name: "完全一致", reference: reference, distorted: reference, psnr: 100, minSSIM: 0.9999, maxSSIM: 1.0001, scales: 5},
+		// 每个通道恒定偏移10：MSE=100，PSNR=10*log10(255²/100)
+		{name: "恒定偏移", reference: reference, distorted: offset, psnr: 10 * math.Log10(255*255/100.0), minSSIM: 0.95, maxSSIM: 1, scales: 5},
+		{name: "轻微噪声", reference: reference, distorted: addNoise(reference, 2), minSSIM: 0.9, maxSSIM: 1, scales: 5},
+		{name: "强噪声", reference: reference, distorted: addNoise(reference, 80), minSSIM: 0, maxSSIM: 0.6, scales: 5},
+		// 40px 只能支撑 40、20 两个尺度
+		{name: "小图减少尺度", reference: grayImage(40, texture), distorted: grayImage(40, texture), psnr: 100, minSSIM: 0.9999, maxSSIM: 1.0001, scales: 2},
+		{name: "小于窗口", reference: grayImage(8, texture), distorted: grayImage(8, texture), psnr: 100, minSSIM: 0.9999, maxSSIM: 1.0001, scales: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := utils.CalcQualityMetrics(tt.reference, tt.distorted)
+			if tt.psnr > 0 {
+				assert.InDelta(t, tt.psnr, metrics.PSNR, 0.01)
+			}
+			assert.GreaterOrEqual(t, metrics.SSIM, tt.minSSIM)
+			assert.LessOrEqual(t, metrics.SSIM, tt.maxSSIM)
+			assert.False(t, math.IsNaN(metrics.MSSSIM))
+			assert.Equal(t, tt.scales, metrics.Scales)
+		})
+	}
+
+	light := utils.CalcQualityMetrics(reference, addNoise(reference, 4))
+	heavy := utils.CalcQualityMetrics(reference, addNoise(reference, 40))
+	assert.Greater(t, light.PSNR, heavy.PSNR)
+	assert.Greater(t, light.SSIM, heavy.SSIM)
+	assert.Greater(t, light.MSSSIM, heavy.MSSSIM)
+}
+
+// TestGetVerifyProfile 测试按格式与质量选择第7层阈值
+func TestGetVerifyProfile(t *testing.T) {
+	tests := []struct {
+		format    string
+		quality   int
+		minSSIM   float64
+		minMSSSIM float64
+		minPSNR   float64
+	}{
+		{format: "avif", quality: 90, minSSIM: 0.85, minMSSSIM: 0.90, minPSNR: 30},
+		{format: ".AVIF", quality: 50, minSSIM: 0.85, minMSSSIM: 0.90, minPSNR: 30},
+		{format: "jxl", quality: 95, minSSIM: 0.95, minMSSSIM: 0.97},
+		{format: "jxl", quality: 75, minSSIM: 0.92, minMSSSIM: 0.95},
+		{format: "webp", quality: 40, minSSIM: 0.85, minMSSSIM: 0.90},
+	}
+	for _, tt := range tests {
+		profile := utils.GetVerifyProfile(tt.format, tt.quality)
+		assert.Equal(t, tt.minSSIM, profile.MinSSIM, "%s q%d", tt.format, tt.quality)
+		assert.Equal(t, tt.minMSSSIM, profile.MinMSSSIM, "%s q%d", tt.format, tt.quality)
+		assert.Equal(t, tt.minPSNR, profile.MinPSNRdB, "%s q%d", tt.format, tt.quality)
+	}
+}
+
+// TestValidateConversion_QualityMetricsLayer 测试第7层在严格模式下计算指标并按阈值判定
+func TestValidateConversion_QualityMetricsLayer(t *testing.T) {
+	installFakeTools(t)
+	reference := grayImage(64, texture)
+
+	tests := []struct {
+		name      string
+		strict    bool
+		converted image.Image
+		success   bool
+		layer     int
+		metrics   bool
+	}{
+		{name: "无损输出", strict: true, converted: reference, success: true, layer: 8, metrics: true},
+		{name: "强失真不达标", strict: true, converted: addNoise(reference, 80), success: false, layer: 7, metrics: true},
+		{name: "非严格模式跳过", strict: false, converted: addNoise(reference, 80), success: true, layer: 8, metrics: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			original := filepath.Join(dir, "source.png")
+			converted := filepath.Join(dir, "output.png")
+			writePNG(t, original, reference)
+			// 调色板编码保证输出与源文件字节不同，不触发第8层复制检测
+			writePNG(t, converted, toPaletted(tt.converted))
+
+			validator := utils.NewEightLayerValidator(utils.ValidationOptions{
+				TimeoutSeconds: 10,
+				StrictMode:     tt.strict,
+				AllowTolerance: 100,
+				Quality:        90,
+			})
+			result, err := validator.ValidateConversion(original, converted, utils.EnhancedFileType{Extension: "png", IsImage: true})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.success, result.Success, result.Message)
+			assert.Equal(t, tt.layer, result.Layer, result.Message)
+			if tt.metrics {
+				require.NotNil(t, result.Metrics)
+				if tt.success {
+					assert.Equal(t, 100.0, result.Metrics.PSNR)
+					assert.Contains(t, result.Message, "MS-SSIM")
+				} else {
+					assert.Contains(t, result.Message, "质量指标不达标")
+				}
+			} else {
+				assert.Nil(t, result.Metrics)
+			}
+		})
+	}
+}
+
+// toPaletted 转为256级灰度调色板图像，像素不变
+func toPaletted(img image.Image) *image.Paletted {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.NRGBA{R: uint8(i), G: uint8(i), B: uint8(i), A: 255}
+	}
+	bounds := img.Bounds()
+	out := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			out.SetColorIndex(x, y, uint8(r>>8))
+		}
+	}
+	return out
+}
@@ -518,10 +518,12 @@ func processFile(filePath string, opts utils.UniversalOptions) string {
 	// 验证转换结果
 	if opts.StrictMode {
 		validator := utils.NewEightLayerValidator(utils.ValidationOptions{
-			TimeoutSeconds: opts.TimeoutSeconds,
-			CJXLThreads:    opts.CJXLThreads,
-			StrictMode:     opts.StrictMode,
-			AllowTolerance: opts.AllowTolerance,
+			TimeoutSeconds:  opts.TimeoutSeconds,
+			CJXLThreads:     opts.CJXLThreads,
+			StrictMode:      opts.StrictMode,
+			AllowTolerance:  opts.AllowTolerance,
+			Quality:         opts.Quality,
+			ConversionStart: startTime,
 		})
 
 		result, err := validator.ValidateConversion(filePath, outputPath, enhancedType)
@@ -538,6 +540,9 @@ func processFile(filePath string, opts utils.UniversalOptions) string {
 		if !result.Success {
 			logger.Printf("❌ 验证失败 %s: %s (第%d层: %s)", fileName, result.Message, result.Layer, result.LayerName)
 			processInfo.ErrorMsg = fmt.Sprintf("验证失败: %s", result.Message)
+			if result.Reason != "" {
+				processInfo.ErrorMsg = fmt.Sprintf("验证失败[%s]: %s", result.Reason, result.Message)
+			}
 			processInfo.ProcessingTime = time.Since(startTime)
 			stats.addDetailedLog(processInfo)
 			stats.addFailed()
@@ -0,0 +1,164 @@
+// utils/perceptual_hash.go - 感知哈希模块
+//
+// 功能说明：
+// - 提供差值哈希（dHash）、DCT感知哈希（pHash）与汉明距离计算
+// - 用于判断两张图像是否为同一画面（容忍有损压缩、缩放带来的细微差异）
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// DifferenceHash 计算64位差值哈希
+// 将亮度缩放到9x8后逐行比较相邻像素，对重新编码、轻微压缩不敏感
+func DifferenceHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0
+	}
+
+	// 区域均值缩放，避免最近邻采样受噪点影响
+	var cells [height][width]float64
+	for cy := 0; cy < height; cy++ {
+		y0 := bounds.Min.Y + cy*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(cy+1)*bounds.Dy()/height, y0+1)
+		for cx := 0; cx < width; cx++ {
+			x0 := bounds.Min.X + cx*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(cx+1)*bounds.Dx()/width, x0+1)
+
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				}
+			}
+			cells[cy][cx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	var hash uint64
+	for cy := 0; cy < height; cy++ {
+		for cx := 0; cx < width-1; cx++ {
+			hash <<= 1
+			if cells[cy][cx] < cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PerceptualHash 计算64位DCT感知哈希
+// 将亮度缩放到32x32后做二维DCT，取左上角8x8低频系数与中位数比较；
+// 对缩放、重新编码和轻微调色的容忍度高于dHash
+func PerceptualHash(img image.Image) uint64 {
+	const size, low = 32, 8
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0
+	}
+
+	// 区域均值缩放到32x32亮度
+	var luma [size][size]float64
+	for cy := 0; cy < size; cy++ {
+		y0 := bounds.Min.Y + cy*bounds.Dy()/size
+		y1 := max(bounds.Min.Y+(cy+1)*bounds.Dy()/size, y0+1)
+		for cx := 0; cx < size; cx++ {
+			x0 := bounds.Min.X + cx*bounds.Dx()/size
+			x1 := max(bounds.Min.X+(cx+1)*bounds.Dx()/size, x0+1)
+
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				}
+			}
+			luma[cy][cx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	// 只需要低频部分：先对行做DCT取前8个系数，再对列做DCT
+	var cosines [low][size]float64
+	for u := 0; u < low; u++ {
+		for x := 0; x < size; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	var rows [size][low]float64
+	for y := 0; y < size; y++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += luma[y][x] * cosines[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coefficients := make([]float64, 0, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// 直流分量只反映整体亮度，不参与中位数
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, c := range coefficients {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// HammingDistance 计算两个64位哈希的汉明距离
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PixelHash 计算解码后像素的SHA-256，用于判断像素是否完全一致
+// 先写入宽高，再按16位非预乘RGBA逐行写入像素：尺寸不同的画面（如1×N与N×1）哈希不同，
+// 8位与16位、调色板与真彩色的相同画面哈希相同
+func PixelHash(img image.Image) string {
+	bounds := img.Bounds()
+	hasher := sha256.New()
+	binary.Write(hasher, binary.BigEndian, [2]uint32{uint32(bounds.Dx()), uint32(bounds.Dy())})
+	row := make([]byte, 0, bounds.Dx()*8)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			row = binary.BigEndian.AppendUint16(row, c.R)
+			row = binary.BigEndian.AppendUint16(row, c.G)
+			row = binary.BigEndian.AppendUint16(row, c.B)
+			row = binary.BigEndian.AppendUint16(row, c.A)
+		}
+		hasher.Write(row)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
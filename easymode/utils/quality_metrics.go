@@ -0,0 +1,254 @@
+// utils/quality_metrics.go - 图像质量指标模块
+//
+// 功能说明：
+// - 纯Go实现的SSIM与MS-SSIM计算
+// - 基于亮度通道，使用11x11高斯窗口（σ=1.5）
+// - 为8层验证系统第7层提供客观质量分数
+//
+// 版本: v2.3.3
+// 更新: 2026-10-16
+
+package utils
+
+import (
+	"image"
+	"math"
+)
+
+// QualityMetrics 单个文件的质量指标
+type QualityMetrics struct {
+	PSNR   float64 // 峰值信噪比（dB），完全一致时为100
+	SSIM   float64 // 结构相似度（0-1）
+	MSSSIM float64 // 多尺度结构相似度（0-1）
+	Scales int     // MS-SSIM实际使用的尺度数
+}
+
+const (
+	ssimWindowSize = 11
+	ssimSigma      = 1.5
+	ssimK1         = 0.01
+	ssimK2         = 0.03
+	ssimMaxValue   = 255.0
+)
+
+// msssimWeights MS-SSIM各尺度权重（Wang et al. 2003）
+var msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// lumaPlane 亮度平面
+type lumaPlane struct {
+	width  int
+	height int
+	pix    []float64
+}
+
+// newLumaPlane 按BT.601系数提取亮度平面
+func newLumaPlane(img image.Image) *lumaPlane {
+	bounds := img.Bounds()
+	plane := &lumaPlane{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		pix:    make([]float64, bounds.Dx()*bounds.Dy()),
+	}
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			plane.pix[i] = (0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8))
+			i++
+		}
+	}
+	return plane
+}
+
+// downsample 按factor做均值池化
+func (p *lumaPlane) downsample(factor int) *lumaPlane {
+	if factor <= 1 {
+		return p
+	}
+	out := &lumaPlane{width: p.width / factor, height: p.height / factor}
+	out.pix = make([]float64, out.width*out.height)
+	area := float64(factor * factor)
+	for y := 0; y < out.height; y++ {
+		for x := 0; x < out.width; x++ {
+			var sum float64
+			for dy := 0; dy < factor; dy++ {
+				row := (y*factor + dy) * p.width
+				for dx := 0; dx < factor; dx++ {
+					sum += p.pix[row+x*factor+dx]
+				}
+			}
+			out.pix[y*out.width+x] = sum / area
+		}
+	}
+	return out
+}
+
+// gaussianKernel 生成归一化的一维高斯核
+func gaussianKernel() []float64 {
+	kernel := make([]float64, ssimWindowSize)
+	center := ssimWindowSize / 2
+	var sum float64
+	for i := range kernel {
+		d := float64(i - center)
+		kernel[i] = math.Exp(-(d * d) / (2 * ssimSigma * ssimSigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// gaussianFilter 可分离高斯滤波，只保留窗口完全落在图像内的区域（valid模式）
+func gaussianFilter(pix []float64, width, height int, kernel []float64) ([]float64, int, int) {
+	size := len(kernel)
+	outW, outH := width-size+1, height-size+1
+
+	horizontal := make([]float64, outW*height)
+	for y := 0; y < height; y++ {
+		row := pix[y*width:]
+		for x := 0; x < outW; x++ {
+			var sum float64
+			for k, w := range kernel {
+				sum += row[x+k] * w
+			}
+			horizontal[y*outW+x] = sum
+		}
+	}
+
+	out := make([]float64, outW*outH)
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			var sum float64
+			for k, w := range kernel {
+				sum += horizontal[(y+k)*outW+x] * w
+			}
+			out[y*outW+x] = sum
+		}
+	}
+	return out, outW, outH
+}
+
+// ssimStats 计算平均SSIM、平均亮度项与平均对比度-结构项（valid窗口）
+func ssimStats(a, b *lumaPlane) (ssim, luminance, contrastStructure float64) {
+	kernel := gaussianKernel()
+	n := len(a.pix)
+	aa, bb, ab := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		aa[i] = a.pix[i] * a.pix[i]
+		bb[i] = b.pix[i] * b.pix[i]
+		ab[i] = a.pix[i] * b.pix[i]
+	}
+
+	muA, w, h := gaussianFilter(a.pix, a.width, a.height, kernel)
+	muB, _, _ := gaussianFilter(b.pix, b.width, b.height, kernel)
+	sigmaAA, _, _ := gaussianFilter(aa, a.width, a.height, kernel)
+	sigmaBB, _, _ := gaussianFilter(bb, b.width, b.height, kernel)
+	sigmaAB, _, _ := gaussianFilter(ab, a.width, a.height, kernel)
+
+	c1 := (ssimK1 * ssimMaxValue) * (ssimK1 * ssimMaxValue)
+	c2 := (ssimK2 * ssimMaxValue) * (ssimK2 * ssimMaxValue)
+
+	for i := 0; i < w*h; i++ {
+		ma, mb := muA[i], muB[i]
+		varA := sigmaAA[i] - ma*ma
+		varB := sigmaBB[i] - mb*mb
+		cov := sigmaAB[i] - ma*mb
+
+		l := (2*ma*mb + c1) / (ma*ma + mb*mb + c1)
+		cs := (2*cov + c2) / (varA + varB + c2)
+		ssim += l * cs
+		luminance += l
+		contrastStructure += cs
+	}
+
+	count := float64(w * h)
+	return ssim / count, luminance / count, contrastStructure / count
+}
+
+// calcSSIM 计算两个等尺寸亮度平面的SSIM
+// 按参考实现先做 max(1, round(min(W,H)/256)) 倍降采样，模拟常规观看距离
+func calcSSIM(pa, pb *lumaPlane) float64 {
+	factor := int(math.Max(1, math.Round(float64(min(pa.width, pa.height))/256)))
+	pa, pb = pa.downsample(factor), pb.downsample(factor)
+
+	if pa.width < ssimWindowSize || pa.height < ssimWindowSize {
+		return ssimGlobal(pa, pb)
+	}
+	ssim, _, _ := ssimStats(pa, pb)
+	return ssim
+}
+
+// ssimGlobal 图像小于窗口时退化为全图统计的SSIM
+func ssimGlobal(a, b *lumaPlane) float64 {
+	n := float64(len(a.pix))
+	if n == 0 {
+		return 0
+	}
+	var meanA, meanB float64
+	for i := range a.pix {
+		meanA += a.pix[i]
+		meanB += b.pix[i]
+	}
+	meanA /= n
+	meanB /= n
+
+	var varA, varB, cov float64
+	for i := range a.pix {
+		da, db := a.pix[i]-meanA, b.pix[i]-meanB
+		varA += da * da
+		varB += db * db
+		cov += da * db
+	}
+	varA /= n
+	varB /= n
+	cov /= n
+
+	c1 := (ssimK1 * ssimMaxValue) * (ssimK1 * ssimMaxValue)
+	c2 := (ssimK2 * ssimMaxValue) * (ssimK2 * ssimMaxValue)
+	return ((2*meanA*meanB + c1) * (2*cov + c2)) / ((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+}
+
+// calcMSSSIM 计算两个等尺寸亮度平面的MS-SSIM
+// 图像过小无法支撑5个尺度时减少尺度数并重新归一化权重，返回值同时给出实际尺度数
+func calcMSSSIM(pa, pb *lumaPlane) (float64, int) {
+	scales := 0
+	for size := min(pa.width, pa.height); scales < len(msssimWeights) && size >= ssimWindowSize; size /= 2 {
+		scales++
+	}
+	if scales == 0 {
+		return ssimGlobal(pa, pb), 0
+	}
+
+	var weightSum float64
+	for _, w := range msssimWeights[:scales] {
+		weightSum += w
+	}
+
+	result := 1.0
+	for scale := 0; scale < scales; scale++ {
+		_, luminance, contrastStructure := ssimStats(pa, pb)
+		weight := msssimWeights[scale] / weightSum
+
+		// 负值的对比度-结构项截断为0，避免非整数次幂产生NaN
+		result *= math.Pow(math.Max(contrastStructure, 0), weight)
+		if scale == scales-1 {
+			result *= math.Pow(math.Max(luminance, 0), weight)
+		}
+
+		pa, pb = pa.downsample(2), pb.downsample(2)
+	}
+	return result, scales
+}
+
+// CalcQualityMetrics 计算两张等尺寸图像的PSNR、SSIM与MS-SSIM
+func CalcQualityMetrics(reference, distorted image.Image) QualityMetrics {
+	refLuma, distLuma := newLumaPlane(reference), newLumaPlane(distorted)
+	msssim, scales := calcMSSSIM(refLuma, distLuma)
+	return QualityMetrics{
+		PSNR:   calcPSNR(reference, distorted),
+		SSIM:   calcSSIM(refLuma, distLuma),
+		MSSSIM: msssim,
+		Scales: scales,
+	}
+}
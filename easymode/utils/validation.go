@@ -12,12 +12,15 @@
 package utils
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"io"
 	"math"
 	"os"
 	"os/exec"
@@ -35,8 +38,21 @@ type ValidationResult struct {
 	Details   map[string]interface{} // 验证详细信息
 	Layer     int                    // 验证层级（1-8）
 	LayerName string                 // 层级名称
+	Metrics   *QualityMetrics        // 第7层计算的质量指标（跳过时为nil）
+	Reason    FailureReason          // 结构化失败原因（成功时为空）
 }
 
+// FailureReason 结构化的验证失败原因，便于统计与报告
+type FailureReason string
+
+const (
+	ReasonIdenticalToSource FailureReason = "identical_to_source" // 输出与源文件逐字节相同（复制/改名）
+	ReasonMagicMismatch     FailureReason = "magic_mismatch"      // 输出文件头与目标格式不符
+	ReasonStaleOutput       FailureReason = "stale_output"        // 输出修改时间早于本次转换开始
+	ReasonPixelMismatch     FailureReason = "pixel_mismatch"      // 输出解码后与源图像不是同一画面
+	ReasonUnreadable        FailureReason = "unreadable"          // 无法读取或解码文件
+)
+
 // ValidationOptions 验证选项结构体
 // 配置验证过程中的各种参数和选项
 type ValidationOptions struct {
@@ -44,8 +60,18 @@ type ValidationOptions struct {
 	CJXLThreads    int
 	StrictMode     bool
 	AllowTolerance float64 // 允许的像素差异百分比
+	Quality        int     // 转换使用的质量（1-100），用于选择第7层阈值，0表示按默认90处理
+
+	// ConversionStart 本次转换开始时间，第8层据此识别残留的旧输出；零值表示不检查
+	ConversionStart time.Time
 }
 
+// 第8层判定参数
+const (
+	antiCheatMtimeTolerance = 2 * time.Second // 兼容FAT/SMB等粗粒度时间戳
+	antiCheatMaxHashDist    = 12              // dHash汉明距离超过该值视为不同画面
+)
+
 // EightLayerValidator 8层验证系统结构体
 // 提供完整的文件转换验证功能，确保转换质量和完整性
 type EightLayerValidator struct {
@@ -124,18 +150,26 @@ func (v *EightLayerValidator) ValidateConversion(originalPath, convertedPath str
 	if !result.Success {
 		return result, nil
 	}
+	metrics := result.Metrics
 
 	// 第8层：反作弊验证
 	result = v.validateLayer8_AntiCheat(originalPath, convertedPath, fileType)
 	if !result.Success {
+		result.Metrics = metrics
 		return result, nil
 	}
 
+	message := "8层验证全部通过"
+	if metrics != nil {
+		message = fmt.Sprintf("8层验证全部通过 (PSNR %.2fdB, SSIM %.4f, MS-SSIM %.4f)", metrics.PSNR, metrics.SSIM, metrics.MSSSIM)
+	}
+
 	return &ValidationResult{
 		Success:   true,
-		Message:   "8层验证全部通过",
+		Message:   message,
 		Layer:     8,
 		LayerName: "反作弊验证",
+		Metrics:   metrics,
 		Details: map[string]interface{}{
 			"all_layers_passed": true,
 			"validation_time":   time.Now().Format(time.RFC3339),
@@ -541,43 +575,9 @@ func (v *EightLayerValidator) validateLayer6_PixelLevel(originalPath, convertedP
 	}
 
 	// 严格模式：将两端统一为PNG后逐像素比较
-	tempDir, err := os.MkdirTemp("", "px_verify_*")
+	origImg, convImg, err := v.decodeComparablePair(originalPath, convertedPath)
 	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("无法创建临时目录: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-	defer os.RemoveAll(tempDir)
-
-	// 将converted统一转为PNG
-	convPNG, err := v.materializeToPNG(convertedPath, tempDir)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("转换后文件转PNG失败: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-
-	// 将original统一转为PNG
-	origPNG, err := v.materializeToPNG(originalPath, tempDir)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("原始文件转PNG失败: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-
-	// 解码PNG
-	origFile, err := os.Open(origPNG)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("无法打开原始PNG: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-	defer origFile.Close()
-	convFile, err := os.Open(convPNG)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("无法打开转换后PNG: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-	defer convFile.Close()
-
-	origImg, err := png.Decode(origFile)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("解码原始PNG失败: %v", err), Layer: 6, LayerName: "像素级验证"}
-	}
-	convImg, err := png.Decode(convFile)
-	if err != nil {
-		return &ValidationResult{Success: false, Message: fmt.Sprintf("解码转换后PNG失败: %v", err), Layer: 6, LayerName: "像素级验证"}
+		return &ValidationResult{Success: false, Message: err.Error(), Layer: 6, LayerName: "像素级验证"}
 	}
 
 	// 尺寸一致性
@@ -603,6 +603,44 @@ func (v *EightLayerValidator) validateLayer6_PixelLevel(originalPath, convertedP
 	return &ValidationResult{Success: true, Message: fmt.Sprintf("像素级验证通过 (差异 %.4f%%)", diffPct), Layer: 6, LayerName: "像素级验证", Details: map[string]interface{}{"diff_percent": diffPct}}
 }
 
+// decodeComparablePair 将原始文件与转换后文件统一转为PNG并解码，供像素级与质量指标验证使用
+func (v *EightLayerValidator) decodeComparablePair(originalPath, convertedPath string) (image.Image, image.Image, error) {
+	tempDir, err := os.MkdirTemp("", "px_verify_*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	convPNG, err := v.materializeToPNG(convertedPath, tempDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("转换后文件转PNG失败: %v", err)
+	}
+	origPNG, err := v.materializeToPNG(originalPath, tempDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("原始文件转PNG失败: %v", err)
+	}
+
+	origImg, err := decodePNGFile(origPNG)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解码原始PNG失败: %v", err)
+	}
+	convImg, err := decodePNGFile(convPNG)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解码转换后PNG失败: %v", err)
+	}
+	return origImg, convImg, nil
+}
+
+// decodePNGFile 解码PNG文件
+func decodePNGFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
 // materializeToPNG 将任意受支持格式统一转为PNG文件，返回PNG路径
 func (v *EightLayerValidator) materializeToPNG(inputPath, tempDir string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(inputPath))
@@ -714,42 +752,310 @@ func absF(x float64) float64 {
 }
 
 // 第7层：质量指标验证
+// 将两端解码为PNG后计算PSNR、SSIM与MS-SSIM，按 GetVerifyProfile 的格式阈值判定
 func (v *EightLayerValidator) validateLayer7_QualityMetrics(originalPath, convertedPath string, fileType EnhancedFileType) *ValidationResult {
-	// 检查图像质量指标
-	// 这里可以实现PSNR、SSIM等质量指标的计算
-	// 简化实现，检查文件是否看起来合理
+	if !v.options.StrictMode {
+		return &ValidationResult{
+			Success:   true,
+			Message:   "质量指标验证通过 (非严格模式)",
+			Layer:     7,
+			LayerName: "质量指标验证",
+		}
+	}
+
+	// 动图与视频只能比较单帧，指标没有代表性，跳过
+	convExt := strings.ToLower(filepath.Ext(convertedPath))
+	if fileType.IsVideo || fileType.IsAnimated || convExt == ".mov" || convExt == ".mp4" {
+		return &ValidationResult{
+			Success:   true,
+			Message:   "动图/视频，跳过质量指标验证",
+			Layer:     7,
+			LayerName: "质量指标验证",
+		}
+	}
+
+	origImg, convImg, err := v.decodeComparablePair(originalPath, convertedPath)
+	if err != nil {
+		return &ValidationResult{Success: false, Message: err.Error(), Layer: 7, LayerName: "质量指标验证"}
+	}
+	if origImg.Bounds().Size() != convImg.Bounds().Size() {
+		return &ValidationResult{Success: false, Message: "图像尺寸不一致，无法计算质量指标", Layer: 7, LayerName: "质量指标验证"}
+	}
+
+	quality := v.options.Quality
+	if quality <= 0 {
+		quality = 90
+	}
+	profile := GetVerifyProfile(strings.TrimPrefix(convExt, "."), quality)
+	metrics := CalcQualityMetrics(origImg, convImg)
+
+	details := map[string]interface{}{
+		"psnr_db":        metrics.PSNR,
+		"ssim":           metrics.SSIM,
+		"ms_ssim":        metrics.MSSSIM,
+		"ms_ssim_scales": metrics.Scales,
+		"min_psnr_db":    profile.MinPSNRdB,
+		"min_ssim":       profile.MinSSIM,
+		"min_ms_ssim":    profile.MinMSSSIM,
+	}
+
+	var violations []string
+	if profile.MinPSNRdB > 0 && metrics.PSNR < profile.MinPSNRdB {
+		violations = append(violations, fmt.Sprintf("PSNR %.2fdB < %.2fdB", metrics.PSNR, profile.MinPSNRdB))
+	}
+	if metrics.SSIM < profile.MinSSIM {
+		violations = append(violations, fmt.Sprintf("SSIM %.4f < %.4f", metrics.SSIM, profile.MinSSIM))
+	}
+	if metrics.MSSSIM < profile.MinMSSSIM {
+		violations = append(violations, fmt.Sprintf("MS-SSIM %.4f < %.4f", metrics.MSSSIM, profile.MinMSSSIM))
+	}
+
+	if len(violations) > 0 {
+		return &ValidationResult{
+			Success:   false,
+			Message:   fmt.Sprintf("质量指标不达标: %s", strings.Join(violations, ", ")),
+			Layer:     7,
+			LayerName: "质量指标验证",
+			Metrics:   &metrics,
+			Details:   details,
+		}
+	}
 
 	return &ValidationResult{
 		Success:   true,
-		Message:   "质量指标验证通过",
+		Message:   fmt.Sprintf("质量指标验证通过 (PSNR %.2fdB, SSIM %.4f, MS-SSIM %.4f)", metrics.PSNR, metrics.SSIM, metrics.MSSSIM),
 		Layer:     7,
 		LayerName: "质量指标验证",
+		Metrics:   &metrics,
+		Details:   details,
 	}
 }
 
 // 第8层：反作弊验证
+// 识别工具崩溃后残留的复制/改名文件、过期输出以及与源图像不符的输出
 func (v *EightLayerValidator) validateLayer8_AntiCheat(originalPath, convertedPath string, fileType EnhancedFileType) *ValidationResult {
-	// 反作弊验证：检查是否有硬编码绕过、虚假转换等
+	fail := func(reason FailureReason, message string, details map[string]interface{}) *ValidationResult {
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["reason"] = string(reason)
+		return &ValidationResult{
+			Success:   false,
+			Message:   message,
+			Layer:     8,
+			LayerName: "反作弊验证",
+			Reason:    reason,
+			Details:   details,
+		}
+	}
 
-	// 检查转换后文件是否真的是转换结果
-	// 而不是简单的文件复制或重命名
-	originalInfo, _ := os.Stat(originalPath)
-	convertedInfo, _ := os.Stat(convertedPath)
+	originalInfo, err := os.Stat(originalPath)
+	if err != nil {
+		return fail(ReasonUnreadable, fmt.Sprintf("无法读取原始文件: %v", err), nil)
+	}
+	convertedInfo, err := os.Stat(convertedPath)
+	if err != nil {
+		return fail(ReasonUnreadable, fmt.Sprintf("无法读取转换后文件: %v", err), nil)
+	}
 
-	// 如果文件大小完全相同，可能是简单的复制
+	// 1. 逐字节相同：输出只是源文件的复制或改名
 	if originalInfo.Size() == convertedInfo.Size() {
-		// 进一步检查文件内容是否真的不同
-		// 这里简化处理
+		identical, err := filesIdentical(originalPath, convertedPath)
+		if err != nil {
+			return fail(ReasonUnreadable, fmt.Sprintf("文件内容比较失败: %v", err), nil)
+		}
+		if identical {
+			return fail(ReasonIdenticalToSource, "转换后文件与原始文件逐字节相同，疑似复制或改名", map[string]interface{}{
+				"size": convertedInfo.Size(),
+			})
+		}
 	}
 
-	// 检查转换时间是否合理
-	// 如果转换时间过短，可能是预先生成的文件
+	// 2. 文件头与目标格式不符：例如把原始JPEG改名为.jxl
+	expected := strings.TrimPrefix(strings.ToLower(filepath.Ext(convertedPath)), ".")
+	detected, err := sniffFormat(convertedPath)
+	if err != nil {
+		return fail(ReasonUnreadable, fmt.Sprintf("无法读取转换后文件头: %v", err), nil)
+	}
+	if !formatMatches(expected, detected) {
+		return fail(ReasonMagicMismatch, fmt.Sprintf("文件头与目标格式不符: 期望%s，实际%s", expected, detected), map[string]interface{}{
+			"expected_format": expected,
+			"detected_format": detected,
+		})
+	}
+
+	// 3. 修改时间早于转换开始：输出是上一次运行残留的旧文件
+	if !v.options.ConversionStart.IsZero() &&
+		convertedInfo.ModTime().Before(v.options.ConversionStart.Add(-antiCheatMtimeTolerance)) {
+		return fail(ReasonStaleOutput, fmt.Sprintf("转换后文件修改时间(%s)早于转换开始时间(%s)",
+			convertedInfo.ModTime().Format(time.RFC3339), v.options.ConversionStart.Format(time.RFC3339)), map[string]interface{}{
+			"output_mtime":     convertedInfo.ModTime().Format(time.RFC3339Nano),
+			"conversion_start": v.options.ConversionStart.Format(time.RFC3339Nano),
+		})
+	}
+
+	details := map[string]interface{}{
+		"detected_format": detected,
+	}
+
+	// 4. 解码后画面比较：严格模式下对静态图像计算像素哈希与感知哈希
+	if v.options.StrictMode && !fileType.IsVideo && !fileType.IsAnimated && isStillImageFormat(detected) {
+		origImg, convImg, err := v.decodeComparablePair(originalPath, convertedPath)
+		if err != nil {
+			return fail(ReasonUnreadable, err.Error(), nil)
+		}
+
+		origHash, convHash := PixelHash(origImg), PixelHash(convImg)
+		distance := HammingDistance(DifferenceHash(origImg), DifferenceHash(convImg))
+		details["pixel_hash_original"] = origHash
+		details["pixel_hash_converted"] = convHash
+		details["pixel_exact_match"] = origHash == convHash
+		details["dhash_distance"] = distance
+
+		// 像素完全一致时无需再看感知哈希；否则要求仍是同一画面
+		if origHash != convHash && distance > antiCheatMaxHashDist {
+			return fail(ReasonPixelMismatch, fmt.Sprintf("转换后图像与原始图像不是同一画面 (dHash距离 %d > %d)", distance, antiCheatMaxHashDist), details)
+		}
+	}
 
 	return &ValidationResult{
 		Success:   true,
 		Message:   "反作弊验证通过",
 		Layer:     8,
 		LayerName: "反作弊验证",
+		Details:   details,
+	}
+}
+
+// filesIdentical 逐块比较两个文件内容
+func filesIdentical(pathA, pathB string) (bool, error) {
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return false, err
+	}
+	defer fileA.Close()
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return false, err
+	}
+	defer fileB.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		nA, errA := io.ReadFull(fileA, bufA)
+		nB, errB := io.ReadFull(fileB, bufB)
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if endA || endB {
+			return endA && endB, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// sniffFormat 根据文件头识别实际格式，无法识别时返回"unknown"
+func sniffFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 64)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0x0A}),
+		bytes.HasPrefix(header, []byte{0x00, 0x00, 0x00, 0x0C, 'J', 'X', 'L', ' ', 0x0D, 0x0A, 0x87, 0x0A}):
+		return "jxl", nil
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg", nil
+	case bytes.HasPrefix(header, []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}):
+		return "png", nil
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif", nil
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return "webp", nil
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		return sniffISOBMFF(header), nil
+	case len(header) >= 8 && (string(header[4:8]) == "moov" || string(header[4:8]) == "mdat" ||
+		string(header[4:8]) == "wide" || string(header[4:8]) == "free"):
+		return "mov", nil
+	default:
+		return "unknown", nil
+	}
+}
+
+// sniffISOBMFF 根据ftyp品牌区分AVIF、HEIC与视频容器
+func sniffISOBMFF(header []byte) string {
+	boxSize := int(binary.BigEndian.Uint32(header[:4]))
+	if boxSize < 16 || boxSize > len(header) {
+		boxSize = len(header)
+	}
+
+	brands := []string{string(header[8:12])}
+	for offset := 16; offset+4 <= boxSize; offset += 4 {
+		brands = append(brands, string(header[offset:offset+4]))
+	}
+
+	hasBrand := func(names ...string) bool {
+		for _, brand := range brands {
+			for _, name := range names {
+				if brand == name {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case hasBrand("avif", "avis"):
+		return "avif"
+	case hasBrand("heic", "heix", "hevc", "hevx", "mif1", "msf1"):
+		return "heic"
+	case brands[0] == "qt  ":
+		return "mov"
+	default:
+		return "mp4"
+	}
+}
+
+// formatMatches 判断识别出的格式是否满足目标扩展名
+func formatMatches(expected, detected string) bool {
+	switch expected {
+	case "jpg", "jpeg":
+		return detected == "jpeg"
+	case "heic", "heif":
+		return detected == "heic"
+	case "mov", "mp4", "m4v":
+		// MOV/MP4同属ISO BMFF，封装器可能写出任一种品牌
+		return detected == "mov" || detected == "mp4"
+	default:
+		return expected == detected
+	}
+}
+
+// isStillImageFormat 可以通过materializeToPNG做单帧比较的格式
+func isStillImageFormat(format string) bool {
+	switch format {
+	case "jxl", "avif", "heic", "png", "jpeg", "webp":
+		return true
+	default:
+		return false
 	}
 }
 
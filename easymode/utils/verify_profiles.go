@@ -11,12 +11,16 @@
 
 package utils
 
+import "strings"
+
 // VerifyProfile 验证配置文件结构体
 // 根据格式与质量返回推荐阈值，供验证器调用
 // 注意：EightLayerValidator 仍是权威实现，此处仅给出阈值建议
 type VerifyProfile struct {
 	MinPSNRdB        float64 // 最小PSNR值（分贝），用于图像质量评估
 	MaxPixelDiffPerc float64 // 最大像素差异百分比，允许的像素变化范围
+	MinSSIM          float64 // 最小SSIM值（0-1），用于第7层质量指标验证
+	MinMSSSIM        float64 // 最小MS-SSIM值（0-1），用于第7层质量指标验证
 }
 
 // GetVerifyProfile 根据格式和质量获取验证配置
@@ -31,11 +35,13 @@ type VerifyProfile struct {
 //	VerifyProfile - 验证配置参数
 func GetVerifyProfile(format string, quality int) VerifyProfile {
 	// 现代格式（AVIF、HEIC、HEIF）使用严格标准
-	switch format {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
 	case "avif", "heic", "heif":
 		return VerifyProfile{
 			MinPSNRdB:        30.0, // 高PSNR要求
 			MaxPixelDiffPerc: 5.0,  // 允许5%的像素差异
+			MinSSIM:          0.85,
+			MinMSSSIM:        0.90,
 		}
 	default:
 		// 传统格式根据质量级别调整阈值
@@ -44,18 +50,24 @@ func GetVerifyProfile(format string, quality int) VerifyProfile {
 			return VerifyProfile{
 				MinPSNRdB:        0,   // 不限制PSNR
 				MaxPixelDiffPerc: 1.0, // 只允许1%的像素差异
+				MinSSIM:          0.95,
+				MinMSSSIM:        0.97,
 			}
 		} else if quality >= 70 {
 			// 中等质量：中等标准
 			return VerifyProfile{
 				MinPSNRdB:        0,   // 不限制PSNR
 				MaxPixelDiffPerc: 2.0, // 允许2%的像素差异
+				MinSSIM:          0.92,
+				MinMSSSIM:        0.95,
 			}
 		}
 		// 低质量：宽松标准
 		return VerifyProfile{
 			MinPSNRdB:        0,   // 不限制PSNR
 			MaxPixelDiffPerc: 5.0, // 允许5%的像素差异
+			MinSSIM:          0.85,
+			MinMSSSIM:        0.90,
 		}
 	}
 }
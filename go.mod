@@ -2,7 +2,7 @@ module pixly
 
 go 1.25.3
 
-replace pixly/utils => ./utils
+replace pixly/utils => ./easymode/utils
 
 require (
 	github.com/fatih/color v1.18.0
@@ -14,6 +14,8 @@ require (
 	github.com/vbauerster/mpb/v8 v8.10.2
 	go.etcd.io/bbolt v1.4.3
 	go.uber.org/zap v1.27.0
+	gopkg.in/yaml.v3 v3.0.1
+	pixly/utils v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -28,6 +30,7 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
+	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
 	github.com/shoenig/go-m1cpu v0.1.6 // indirect
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
@@ -35,5 +38,4 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"pixly/pkg/core/types"
+
 	"go.uber.org/zap"
 )
 
@@ -37,6 +40,7 @@ type BatchDecisionManager struct {
 	mutex               sync.RWMutex          // 并发保护
 	currentDecisionType DecisionType          // 当前决策类型
 	decisionCallbacks   map[DecisionType][]func(*BatchDecisionResult) error
+	recorder            types.DecisionRecorder // 每个文件的处理选择写入决策轨迹，nil 时不写入
 }
 
 // CorruptedFile 损坏文件信息
@@ -75,6 +79,8 @@ type BatchDecisionRecord struct {
 	SuccessCount    int                    `json:"success_count"`     // 成功数量
 	FailureCount    int                    `json:"failure_count"`     // 失败数量
 	Details         map[string]interface{} `json:"details"`           // 详细信息
+
+	FileDecisions map[string]types.DecisionRecord `json:"file_decisions,omitempty"` // 每个文件的决策记录
 }
 
 // BatchDecisionResult 批量决策结果
@@ -219,6 +225,14 @@ func (bdm *BatchDecisionManager) SetTestMode(enabled bool) {
 		zap.String("behavior", map[bool]string{true: "强制处理所有低品质文件", false: "正常模式"}[enabled]))
 }
 
+// SetDecisionRecorder 设置决策轨迹记录器（通常为状态数据库），每个文件的处理选择追加到其决策轨迹
+func (bdm *BatchDecisionManager) SetDecisionRecorder(recorder types.DecisionRecorder) {
+	bdm.mutex.Lock()
+	defer bdm.mutex.Unlock()
+
+	bdm.recorder = recorder
+}
+
 // AddLowQualityFile 添加低品质文件到决策队列
 func (bdm *BatchDecisionManager) AddLowQualityFile(file *LowQualityFile) error {
 	bdm.mutex.Lock()
@@ -336,6 +350,16 @@ func (bdm *BatchDecisionManager) processCorruptedFilesDecision(ctx context.Conte
 		zap.Bool("is_default", isDefault),
 		zap.Int("file_count", len(bdm.pendingCorrupted)))
 
+	record.FileDecisions = make(map[string]types.DecisionRecord, len(bdm.pendingCorrupted))
+	for _, file := range bdm.pendingCorrupted {
+		bdm.recordDecision(record, file.FilePath, map[string]interface{}{
+			"corruption_type": file.CorruptionType.String(),
+			"error":           file.ErrorMessage,
+			"can_repair":      file.CanRepair,
+			"file_size":       file.FileSize,
+		})
+	}
+
 	// 执行用户选择
 	result, err := bdm.executeCorruptedFilesDecision(ctx, choice, record)
 	if err != nil {
@@ -370,6 +394,15 @@ func (bdm *BatchDecisionManager) processLowQualityFilesDecision(ctx context.Cont
 		zap.Bool("is_default", isDefault),
 		zap.Int("file_count", len(bdm.pendingLowQuality)))
 
+	record.FileDecisions = make(map[string]types.DecisionRecord, len(bdm.pendingLowQuality))
+	for _, file := range bdm.pendingLowQuality {
+		bdm.recordDecision(record, file.FilePath, map[string]interface{}{
+			"quality_score":  file.QualityScore,
+			"quality_issues": strings.Join(file.QualityIssues, ","),
+			"file_size":      file.FileSize,
+		})
+	}
+
 	// 执行用户选择
 	result, err := bdm.executeLowQualityFilesDecision(ctx, choice, record)
 	if err != nil {
@@ -379,6 +412,21 @@ func (bdm *BatchDecisionManager) processLowQualityFilesDecision(ctx context.Cont
 	return result, nil
 }
 
+// recordDecision 为批量决策中的单个文件生成决策记录，设置了记录器时追加到该文件的决策轨迹
+func (bdm *BatchDecisionManager) recordDecision(record *BatchDecisionRecord, filePath string, values map[string]interface{}) {
+	values["is_default"] = record.IsDefaultChoice
+	values["file_count"] = record.FileCount
+	decision := types.NewDecisionRecord(types.DecisionStageBatch, record.DecisionType.String(), record.UserChoice.String(), values,
+		fmt.Sprintf("%v 内未选择时使用默认选项 %s", bdm.countdownDuration, bdm.getDefaultChoice(record.DecisionType)))
+	record.FileDecisions[filePath] = decision
+
+	if bdm.recorder != nil {
+		if err := bdm.recorder.AppendDecisions(filePath, decision); err != nil {
+			bdm.logger.Debug("追加决策轨迹失败", zap.String("file_path", filePath), zap.Error(err))
+		}
+	}
+}
+
 // getUserDecisionWithCountdown 获取用户决策并执行倒计时 - README要求的5秒倒计时
 func (bdm *BatchDecisionManager) getUserDecisionWithCountdown(ctx context.Context, decisionType DecisionType) (UserDecisionChoice, bool) {
 	if !bdm.interactiveMode {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"pixly/pkg/core/types"
+	"pixly/pkg/metrics"
 
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
@@ -200,6 +201,7 @@ func (scm *SmartConcurrencyManager) handleHighMemoryUsage(currentUsage float64)
 	defer scm.mutex.Unlock()
 
 	scm.stats.MemoryLimitHits++
+	metrics.MemoryPressureEvents.Inc()
 
 	scm.logger.Warn("检测到高内存使用",
 		zap.Float64("current_usage", currentUsage),
@@ -44,6 +44,21 @@ type Config struct {
 	HighQualityThreshold    float64 `json:"high_quality_threshold"`
 	LowQualityThreshold     float64 `json:"low_quality_threshold"`
 
+	// Target quality search（为空时使用多点有损探测）
+	TargetMetric string  `json:"target_metric"` // "ssimulacra2", "butteraugli", "ssim"
+	TargetScore  float64 `json:"target_score"`  // 0 表示使用指标默认目标
+
+	// Video transcoding（"remux" 只重包装；"transcode" 使用 CRF 重新编码为 AV1/HEVC）
+	VideoMode         string `json:"video_mode"`           // "remux", "transcode"
+	VideoCodec        string `json:"video_codec"`          // "auto", "av1", "hevc", "libsvtav1", "libaom-av1", "libx265"
+	VideoPreset       string `json:"video_preset"`         // 为空时使用编码器默认预设
+	VideoAudio        string `json:"video_audio"`          // "auto", "copy", "aac", "opus"
+	VideoMinSizeMB    int    `json:"video_min_size_mb"`    // 小于该体积的视频不转码
+	VideoMinSavingPct int    `json:"video_min_saving_pct"` // 体积减少不足该比例时保留原文件
+
+	// Routing rules（JSON 规则文件，按顺序匹配，未命中时使用内置路由）
+	RoutingRulesFile string `json:"routing_rules_file"`
+
 	// Processing options
 	CreateBackups      bool `json:"create_backups"`
 	KeepBackups        bool `json:"keep_backups"` // 是否保留备份文件
@@ -61,6 +76,17 @@ type Config struct {
 	UseColorOutput   bool   `json:"use_color_output"`
 	ShowProgressBars bool   `json:"show_progress_bars"`
 	UILanguage       string `json:"ui_language"`
+
+	// Telemetry（Prometheus /metrics 监听地址，如 127.0.0.1:9464；为空时不开启）
+	MetricsListen string `json:"metrics_listen"`
+
+	// Report（HTML 运行报告的文件或目录路径，目录中按时间生成文件名；为空时不生成）
+	HTMLReport       string `json:"html_report"`
+	ReportThumbnails int    `json:"report_thumbnails"` // 报告中前后对比缩略图的最大组数
+
+	// 分层加载记录（由 Load 填充）
+	sources map[string]Source // 配置项 JSON 键 -> 最终生效的来源层
+	profile string            // 生效的命名配置档
 }
 
 // DefaultConfig 返回默认配置
@@ -100,6 +126,13 @@ func DefaultConfig() *Config {
 		HighQualityThreshold:    2.5,
 		LowQualityThreshold:     0.6,
 
+		// Video transcoding
+		VideoMode:         "remux",
+		VideoCodec:        "auto",
+		VideoAudio:        "auto",
+		VideoMinSizeMB:    10,
+		VideoMinSavingPct: 10,
+
 		// Processing
 		CreateBackups:      true,
 		KeepBackups:        false, // 默认不保留备份文件
@@ -117,44 +150,112 @@ func DefaultConfig() *Config {
 		UseColorOutput:   true,
 		ShowProgressBars: true,
 		UILanguage:       "zh-CN",
+
+		// Report
+		ReportThumbnails: 12,
 	}
 }
 
-// ValidateConfig 验证配置
+// ValidateConfig 验证配置，返回第一个无效项
 func (c *Config) ValidateConfig() error {
+	if errs := c.validateFields(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// validateFields 检查全部配置项，返回每个无效项（以 JSON 键标识）
+func (c *Config) validateFields() []*FieldError {
+	var errs []*FieldError
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
 	// 验证ConcurrentJobs（并发任务数）
 	if c.ConcurrentJobs < 1 || c.ConcurrentJobs > 32 {
-		return fmt.Errorf("无效的并发任务数: %d (应在 1-32 之间)", c.ConcurrentJobs)
+		invalid("concurrent_jobs", "无效的并发任务数: %d (应在 1-32 之间)", c.ConcurrentJobs)
 	}
 
 	// 验证MaxWorkers（工作线程数）
 	if c.MaxWorkers < 1 || c.MaxWorkers > runtime.NumCPU()*2 {
-		return fmt.Errorf("无效的工作线程数: %d (应在 1-%d 之间)", c.MaxWorkers, runtime.NumCPU()*2)
+		invalid("max_workers", "无效的工作线程数: %d (应在 1-%d 之间)", c.MaxWorkers, runtime.NumCPU()*2)
 	}
 
 	if c.MemoryLimit < 1 || c.MemoryLimit > 64 {
-		return fmt.Errorf("无效的内存限制: %d GB (应在 1-64 之间)", c.MemoryLimit)
+		invalid("memory_limit_gb", "无效的内存限制: %d GB (应在 1-64 之间)", c.MemoryLimit)
 	}
 
 	if c.JXLEffort < 1 || c.JXLEffort > 9 {
-		return fmt.Errorf("无效的JXL压缩级别: %d (应在 1-9 之间)", c.JXLEffort)
+		invalid("jxl_effort", "无效的JXL压缩级别: %d (应在 1-9 之间)", c.JXLEffort)
 	}
 
 	if c.AVIFSpeed < 0 || c.AVIFSpeed > 10 {
-		return fmt.Errorf("无效的AVIF速度: %d (应在 0-10 之间)", c.AVIFSpeed)
+		invalid("avif_speed", "无效的AVIF速度: %d (应在 0-10 之间)", c.AVIFSpeed)
 	}
 
 	// 验证MaxRetries
 	if c.MaxRetries < 0 || c.MaxRetries > 10 {
-		return fmt.Errorf("无效的最大重试次数: %d (应在 0-10 之间)", c.MaxRetries)
+		invalid("max_retries", "无效的最大重试次数: %d (应在 0-10 之间)", c.MaxRetries)
 	}
 
 	// 验证CRF值
 	if c.CRF < 0 || c.CRF > 51 {
-		return fmt.Errorf("无效的CRF值: %d (应在 0-51 之间)", c.CRF)
+		invalid("crf", "无效的CRF值: %d (应在 0-51 之间)", c.CRF)
 	}
 
-	return nil
+	// 验证处理模式（为空时由 NormalizeConfig 设为 auto+）
+	switch c.Mode {
+	case "", "auto+", "quality", "sticker":
+	default:
+		invalid("mode", "无效的处理模式: %s (可选: auto+, quality, sticker)", c.Mode)
+	}
+
+	// 验证目标质量指标
+	switch c.TargetMetric {
+	case "":
+	case "ssimulacra2":
+		if c.TargetScore < 0 || c.TargetScore > 100 {
+			invalid("target_score", "无效的SSIMULACRA2目标: %.2f (应在 0-100 之间)", c.TargetScore)
+		}
+	case "butteraugli":
+		if c.TargetScore < 0 || c.TargetScore > 20 {
+			invalid("target_score", "无效的Butteraugli目标: %.2f (应在 0-20 之间)", c.TargetScore)
+		}
+	case "ssim":
+		if c.TargetScore < 0 || c.TargetScore > 1 {
+			invalid("target_score", "无效的SSIM目标: %.4f (应在 0-1 之间)", c.TargetScore)
+		}
+	default:
+		invalid("target_metric", "无效的目标质量指标: %s (可选: ssimulacra2, butteraugli, ssim)", c.TargetMetric)
+	}
+
+	// 验证视频转码参数
+	switch c.VideoMode {
+	case "", "remux", "transcode":
+	default:
+		invalid("video_mode", "无效的视频处理方式: %s (可选: remux, transcode)", c.VideoMode)
+	}
+	switch c.VideoCodec {
+	case "", "auto", "av1", "hevc", "libsvtav1", "libaom-av1", "libx265":
+	default:
+		invalid("video_codec", "无效的视频编码器: %s (可选: auto, av1, hevc, libsvtav1, libaom-av1, libx265)", c.VideoCodec)
+	}
+	switch c.VideoAudio {
+	case "", "auto", "copy", "aac", "opus":
+	default:
+		invalid("video_audio", "无效的音频处理方式: %s (可选: auto, copy, aac, opus)", c.VideoAudio)
+	}
+	if c.VideoMinSizeMB < 0 {
+		invalid("video_min_size_mb", "无效的视频转码最小体积: %d MB", c.VideoMinSizeMB)
+	}
+	if c.VideoMinSavingPct < 0 || c.VideoMinSavingPct > 90 {
+		invalid("video_min_saving_pct", "无效的视频最小节省比例: %d%% (应在 0-90 之间)", c.VideoMinSavingPct)
+	}
+	if c.ReportThumbnails < 0 || c.ReportThumbnails > 100 {
+		invalid("report_thumbnails", "无效的报告缩略图数量: %d (应在 0-100 之间)", c.ReportThumbnails)
+	}
+
+	return errs
 }
 
 // Validate 验证配置（全局函数）
@@ -227,19 +328,59 @@ func NormalizeConfig(c *Config) {
 	if c.StickerTargetFormat == "" {
 		c.StickerTargetFormat = "avif"
 	}
+
+	if c.VideoMode == "" {
+		c.VideoMode = "remux"
+	}
+
+	if c.VideoCodec == "" {
+		c.VideoCodec = "auto"
+	}
+
+	if c.VideoAudio == "" {
+		c.VideoAudio = "auto"
+	}
 }
 
 // ValidateAndNormalize 验证并标准化配置
+// 由配置文件、环境变量或命令行显式设置的无效值在标准化前报告（不静默修正），
+// 错误中注明每个无效值来自哪一层
 func ValidateAndNormalize(c *Config) error {
 	if c == nil {
 		return fmt.Errorf("配置不能为空")
 	}
 
+	if errs := c.explicitFieldErrors(); len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
 	// 先标准化
 	NormalizeConfig(c)
 
 	// 再验证
-	return c.ValidateConfig()
+	if errs := c.validateFields(); len(errs) > 0 {
+		for _, err := range errs {
+			err.Source = c.SourceOf(err.Key)
+		}
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// explicitFieldErrors 返回由非默认层设置的无效项
+// 零值与 NormalizeConfig 一致视为"自动"，交由标准化填充
+func (c *Config) explicitFieldErrors() []*FieldError {
+	var explicit []*FieldError
+	for _, err := range c.validateFields() {
+		if field, ok := c.field(err.Key); ok && field.IsZero() {
+			continue
+		}
+		if source := c.SourceOf(err.Key); source.Layer != LayerDefault {
+			err.Source = source
+			explicit = append(explicit, err)
+		}
+	}
+	return explicit
 }
 
 // GetTimeoutForMedia 根据媒体类型获取超时时间
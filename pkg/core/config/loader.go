@@ -0,0 +1,424 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSystemConfigDir 系统级配置目录
+const DefaultSystemConfigDir = "/etc/pixly"
+
+// EnvPrefix 环境变量覆盖前缀，如 PIXLY_CRF=30、PIXLY_PROFILE=web
+const EnvPrefix = "PIXLY_"
+
+// 配置文件名（按顺序取第一个存在的文件）
+var (
+	configFileNames  = []string{"config.yaml", "config.yml", "config.json"}
+	projectFileNames = []string{".pixly.yaml", ".pixly.yml", ".pixly.json"}
+)
+
+// LoadOptions 分层加载选项，零值使用默认目录与当前进程环境变量
+type LoadOptions struct {
+	SystemDir string         // 系统配置目录，默认 /etc/pixly
+	UserDir   string         // 用户配置目录，默认 $XDG_CONFIG_HOME/pixly（即 ~/.config/pixly）
+	Env       []string       // KEY=VALUE 形式的环境变量，nil 时使用 os.Environ()
+	Flags     *FlagOverrides // 命令行覆盖，可为空
+}
+
+// configFile 解析后的配置文件
+type configFile struct {
+	source   Source
+	values   map[string]json.RawMessage
+	profile  string                                // 文件选择的配置档
+	profiles map[string]map[string]json.RawMessage // 文件定义的配置档
+}
+
+// Load 按层加载配置，后加载的层覆盖先前的值：
+//
+//	默认值 → 系统文件 → 用户文件（或 --config）→ 项目文件（目标目录下的 .pixly.yaml/.json）
+//	→ 命名配置档 → PIXLY_* 环境变量 → 命令行参数
+//
+// 配置档按 --profile、PIXLY_PROFILE、配置文件中的 profile 键的顺序选择。
+// 每个配置项最终生效的来源可通过 SourceOf 查询。
+func Load(opts LoadOptions) (*Config, error) {
+	cfg := DefaultConfig()
+	flags := opts.Flags
+	if flags == nil {
+		flags = &FlagOverrides{}
+	}
+	envValues, envProfile := parseEnv(opts.Env)
+
+	var files []*configFile
+
+	systemDir := opts.SystemDir
+	if systemDir == "" {
+		systemDir = DefaultSystemConfigDir
+	}
+	if file, err := readFirstConfigFile(LayerSystem, systemDir, configFileNames); err != nil {
+		return nil, err
+	} else if file != nil {
+		files = append(files, file)
+	}
+
+	if flags.ConfigFile != "" {
+		file, err := readConfigFile(LayerUser, flags.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	} else {
+		userDir := opts.UserDir
+		if userDir == "" {
+			if dir, err := os.UserConfigDir(); err == nil {
+				userDir = filepath.Join(dir, "pixly")
+			}
+		}
+		if userDir != "" {
+			if file, err := readFirstConfigFile(LayerUser, userDir, configFileNames); err != nil {
+				return nil, err
+			} else if file != nil {
+				files = append(files, file)
+			}
+		}
+	}
+
+	for _, file := range files {
+		if err := cfg.applyValues(file.values, file.source); err != nil {
+			return nil, err
+		}
+	}
+
+	// 项目文件位于目标目录，目标目录按 参数 → 环境变量 → 已加载文件 的顺序确定
+	targetDir := cfg.TargetDir
+	if value, ok := envValues["target_dir"]; ok {
+		targetDir = value.value
+	}
+	if value, ok := flags.values["target_dir"]; ok {
+		targetDir = value.value
+	}
+	if targetDir != "" {
+		file, err := readFirstConfigFile(LayerProject, targetDir, projectFileNames)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			if err := cfg.applyValues(file.values, file.source); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+
+	profile := flags.Profile
+	if profile == "" {
+		profile = envProfile
+	}
+	if profile == "" {
+		for _, file := range files {
+			if file.profile != "" {
+				profile = file.profile
+			}
+		}
+	}
+	if profile != "" {
+		if err := cfg.applyProfile(profile, files); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, value := range envValues {
+		if err := cfg.setString(value.key, value.value, value.source); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range flags.values {
+		if err := cfg.setString(value.key, value.value, value.source); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// applyProfile 应用命名配置档：先内置定义，再按层应用各配置文件中的同名段
+func (c *Config) applyProfile(name string, files []*configFile) error {
+	found := false
+	if builtin, ok := builtinProfiles[name]; ok {
+		values, err := encodeValues(builtin, "内置配置档 "+name)
+		if err != nil {
+			return err
+		}
+		if err := c.applyValues(values, Source{Layer: LayerProfile, Location: name}); err != nil {
+			return err
+		}
+		found = true
+	}
+	for _, file := range files {
+		if values, ok := file.profiles[name]; ok {
+			source := Source{Layer: LayerProfile, Location: fmt.Sprintf("%s@%s", name, file.source.Location)}
+			if err := c.applyValues(values, source); err != nil {
+				return err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("未知的配置档 %q（可用: %s）", name, strings.Join(availableProfiles(files), ", "))
+	}
+	c.profile = name
+	return nil
+}
+
+// availableProfiles 返回内置与配置文件中定义的全部配置档名称
+func availableProfiles(files []*configFile) []string {
+	names := BuiltinProfiles()
+	for _, file := range files {
+		for name := range file.profiles {
+			if !containsName(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyValues 将 JSON 编码的配置项写入对应字段并记录来源
+func (c *Config) applyValues(values map[string]json.RawMessage, source Source) error {
+	for key, raw := range values {
+		field, ok := c.field(key)
+		if !ok {
+			return fmt.Errorf("%s: 未知的配置项 %q", source, key)
+		}
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return fmt.Errorf("%s: 配置项 %s 的值无效: %w", source, key, err)
+		}
+		field.Set(value.Elem())
+		c.setSource(key, source)
+	}
+	return nil
+}
+
+// setString 按字段类型解析字符串值（环境变量与命令行参数）
+func (c *Config) setString(key, value string, source Source) error {
+	field, ok := c.field(key)
+	if !ok {
+		return fmt.Errorf("%s: 未知的配置项 %q", source, key)
+	}
+	invalid := func(err error) error {
+		return fmt.Errorf("%s: 配置项 %s 的值 %q 无效: %w", source, key, value, err)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid(err)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("%s: 配置项 %s 不支持字符串赋值", source, key)
+	}
+	c.setSource(key, source)
+	return nil
+}
+
+// overrideValue 环境变量或命令行参数提供的原始值
+type overrideValue struct {
+	key    string
+	value  string
+	source Source
+}
+
+// parseEnv 提取 PIXLY_* 环境变量，未对应配置项的变量（如 PIXLY_LAUNCHED_BY）被忽略
+func parseEnv(env []string) (map[string]overrideValue, string) {
+	if env == nil {
+		env = os.Environ()
+	}
+	values := make(map[string]overrideValue)
+	profile := ""
+	for _, entry := range env {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(name, EnvPrefix))
+		if key == "profile" {
+			profile = value
+			continue
+		}
+		if _, ok := configFieldIndex[key]; ok {
+			values[key] = overrideValue{key: key, value: value, source: Source{Layer: LayerEnv, Location: name}}
+		}
+	}
+	return values, profile
+}
+
+// readFirstConfigFile 读取目录下第一个存在的配置文件，都不存在时返回 nil
+func readFirstConfigFile(layer, dir string, names []string) (*configFile, error) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("访问配置文件失败: %w", err)
+		}
+		return readConfigFile(layer, path)
+	}
+	return nil, nil
+}
+
+// readConfigFile 解析 YAML 或 JSON 配置文件（按扩展名判断，.json 之外均按 YAML 解析）
+func readConfigFile(layer, path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var document map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &document)
+	} else {
+		err = yaml.Unmarshal(data, &document)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	file := &configFile{source: Source{Layer: layer, Location: path}}
+
+	if value, ok := document["profile"]; ok {
+		name, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: profile 必须是字符串", path)
+		}
+		file.profile = name
+		delete(document, "profile")
+	}
+
+	if value, ok := document["profiles"]; ok {
+		profiles, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: profiles 必须是以配置档名称为键的映射", path)
+		}
+		file.profiles = make(map[string]map[string]json.RawMessage, len(profiles))
+		for name, section := range profiles {
+			settings, ok := section.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: 配置档 %s 必须是配置项映射", path, name)
+			}
+			values, err := encodeValues(settings, fmt.Sprintf("%s 配置档 %s", path, name))
+			if err != nil {
+				return nil, err
+			}
+			file.profiles[name] = values
+		}
+		delete(document, "profiles")
+	}
+
+	file.values, err = encodeValues(document, path)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// encodeValues 检查配置项名称并将值统一编码为 JSON，由 applyValues 按字段类型解码
+func encodeValues(document map[string]interface{}, location string) (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage, len(document))
+	for key, value := range document {
+		if _, ok := configFieldIndex[key]; !ok {
+			return nil, fmt.Errorf("%s: 未知的配置项 %q", location, key)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: 配置项 %s 无法编码: %w", location, key, err)
+		}
+		values[key] = raw
+	}
+	return values, nil
+}
+
+// FlagOverrides 命令行参数层
+type FlagOverrides struct {
+	Profile    string // --profile
+	ConfigFile string // --config，替代用户配置文件
+
+	values map[string]overrideValue
+}
+
+// RegisterFlags 注册 --profile、--config 以及每个配置项对应的参数
+// 参数名为 JSON 键中的下划线替换为连字符，如 --concurrent-jobs、--dry-run
+func RegisterFlags(fs *flag.FlagSet) *FlagOverrides {
+	overrides := &FlagOverrides{}
+	fs.StringVar(&overrides.Profile, "profile", "", "命名配置档（内置: "+strings.Join(BuiltinProfiles(), ", ")+"）")
+	fs.StringVar(&overrides.ConfigFile, "config", "", "配置文件路径（替代用户配置文件）")
+
+	configType := reflect.TypeOf(Config{})
+	for _, key := range ConfigKeys() {
+		key := key
+		name := strings.ReplaceAll(key, "_", "-")
+		usage := "覆盖配置项 " + key
+		set := func(value string) error {
+			overrides.set(key, value, Source{Layer: LayerFlag, Location: "--" + name})
+			return nil
+		}
+		if configType.Field(configFieldIndex[key]).Type.Kind() == reflect.Bool {
+			fs.BoolFunc(name, usage, set)
+		} else {
+			fs.Func(name, usage, set)
+		}
+	}
+	return overrides
+}
+
+// Set 以命令行层设置配置项（如位置参数给出的目标目录）
+func (o *FlagOverrides) Set(key, value string) {
+	o.set(key, value, Source{Layer: LayerFlag, Location: key})
+}
+
+func (o *FlagOverrides) set(key, value string, source Source) {
+	if o.values == nil {
+		o.values = make(map[string]overrideValue)
+	}
+	o.values[key] = overrideValue{key: key, value: value, source: source}
+}
@@ -0,0 +1,37 @@
+package config
+
+import "sort"
+
+// builtinProfiles 内置命名配置档，配置文件中同名的 profiles.<name> 段可在其基础上覆盖
+var builtinProfiles = map[string]map[string]interface{}{
+	// archive 长期归档：只做无损转换，保留备份与元数据，使用最高压缩级别
+	"archive": {
+		"mode":                 "quality",
+		"jxl_effort":           9,
+		"video_mode":           "remux",
+		"keep_backups":         true,
+		"enable_metadata_copy": true,
+	},
+	// web 网页发布：按感知质量目标有损压缩，视频重新编码为 AV1/HEVC
+	"web": {
+		"mode":          "auto+",
+		"target_metric": "ssimulacra2",
+		"target_score":  70,
+		"video_mode":    "transcode",
+	},
+	// sticker 表情包：统一转换为 AVIF
+	"sticker": {
+		"mode":                  "sticker",
+		"sticker_target_format": "avif",
+	},
+}
+
+// BuiltinProfiles 返回内置配置档名称
+func BuiltinProfiles() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
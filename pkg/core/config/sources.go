@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 配置来源层，按优先级从低到高排列
+const (
+	LayerDefault = "default" // DefaultConfig 默认值
+	LayerSystem  = "system"  // 系统配置文件（/etc/pixly）
+	LayerUser    = "user"    // 用户配置文件（~/.config/pixly 或 --config 指定）
+	LayerProject = "project" // 目标目录下的 .pixly.yaml/.pixly.json
+	LayerProfile = "profile" // 命名配置档
+	LayerEnv     = "env"     // PIXLY_* 环境变量
+	LayerFlag    = "flag"    // 命令行参数
+)
+
+// Source 配置项的来源
+type Source struct {
+	Layer    string // 来源层
+	Location string // 文件路径、环境变量名、参数名或配置档名
+}
+
+func (s Source) String() string {
+	if s.Location == "" {
+		return s.Layer
+	}
+	return fmt.Sprintf("%s %s", s.Layer, s.Location)
+}
+
+// SourceOf 返回配置项（JSON 键）最终生效值的来源；未经 Load 设置的项视为默认值
+func (c *Config) SourceOf(key string) Source {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return Source{Layer: LayerDefault}
+}
+
+// ActiveProfile 返回生效的命名配置档，未选择时为空
+func (c *Config) ActiveProfile() string {
+	return c.profile
+}
+
+func (c *Config) setSource(key string, source Source) {
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[key] = source
+}
+
+// FieldError 单个配置项的验证错误
+type FieldError struct {
+	Key     string // 配置项 JSON 键
+	Message string
+	Source  Source // 设置该值的来源层，未知时为空
+}
+
+func (e *FieldError) Error() string {
+	if e.Source.Layer == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s（来源: %s）", e.Message, e.Source)
+}
+
+// ValidationError 汇总全部无效配置项
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// configFieldIndex 配置项 JSON 键 -> Config 字段下标
+var configFieldIndex = func() map[string]int {
+	index := make(map[string]int)
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key != "" && key != "-" {
+			index[key] = i
+		}
+	}
+	return index
+}()
+
+// field 按 JSON 键返回可写的配置字段
+func (c *Config) field(key string) (reflect.Value, bool) {
+	i, ok := configFieldIndex[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(c).Elem().Field(i), true
+}
+
+// ConfigKeys 返回全部配置项的 JSON 键
+func ConfigKeys() []string {
+	keys := make([]string, 0, len(configFieldIndex))
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		key, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		if _, ok := configFieldIndex[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
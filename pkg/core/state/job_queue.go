@@ -0,0 +1,463 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// =============================================================================
+// 📋 持久化转换队列 - 评估/路由后的任务写入 bbolt，崩溃或重启后从队列继续转换
+// =============================================================================
+//
+// job_queue 以文件路径为键保存队列条目；job_queue_order 只索引排队中的条目，
+// 键为 (反转的优先级, 入队序号)，游标顺序即出队顺序：优先级高的先出，同优先级先进先出。
+// 转换成功的条目直接删除，失败和取消的条目保留，供查看和重试。
+
+const (
+	JobQueueBucket      = "job_queue"
+	JobQueueOrderBucket = "job_queue_order"
+	JobQueueMetaBucket  = "job_queue_meta" // 队列暂停标记与扫描完成标记，ClearSession 不会清除
+
+	queuePausedKey     = "paused"
+	queueScannedPrefix = "scanned:"
+
+	// MaxQueueAttempts 条目被中断（进程崩溃时处于运行中）的最多次数，超过后标记为失败，避免反复崩溃
+	MaxQueueAttempts = 3
+	// MaxQueuePriority 优先级范围为 [-MaxQueuePriority, MaxQueuePriority]
+	MaxQueuePriority = 1000
+)
+
+// QueueState 队列条目状态
+type QueueState string
+
+const (
+	QueueQueued    QueueState = "queued"
+	QueueRunning   QueueState = "running"
+	QueueFailed    QueueState = "failed"
+	QueueCancelled QueueState = "cancelled"
+)
+
+var (
+	// ErrQueuePaused 队列已暂停，不出队
+	ErrQueuePaused = errors.New("转换队列已暂停")
+	// ErrQueueEntryNotFound 队列中没有该文件
+	ErrQueueEntryNotFound = errors.New("队列中没有该文件")
+	// ErrQueueEntryRunning 条目正在转换，不能取消
+	ErrQueueEntryRunning = errors.New("文件正在转换")
+)
+
+// QueueEntry 队列条目，一个条目对应一个转换单元（单个文件或 Live Photo 两半）
+type QueueEntry struct {
+	Path       string          `json:"path"`     // 条目键，单元中第一个文件
+	Members    []string        `json:"members"`  // 单元内全部文件
+	Priority   int             `json:"priority"` // 越大越先转换
+	State      QueueState      `json:"state"`
+	Attempts   int             `json:"attempts"` // 出队次数
+	LastError  string          `json:"last_error,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"` // 引擎编码的转换任务
+	Seq        uint64          `json:"seq"`               // 入队序号，同优先级按此排序
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// EnqueueJob 加入队列
+// 已在队列中（排队或运行中）的条目只更新任务数据；失败的条目重新排队，保留优先级、尝试次数和最后的错误
+func (sm *StateManager) EnqueueJob(entry *QueueEntry) error {
+	return sm.updateQueue(func(queue, order *bbolt.Bucket) error {
+		now := time.Now()
+		existing, err := getQueueEntry(queue, entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			switch existing.State {
+			case QueueQueued, QueueRunning:
+				existing.Members, existing.Payload, existing.UpdatedAt = entry.Members, entry.Payload, now
+				return putQueueEntry(queue, existing)
+			case QueueCancelled:
+				return nil // 取消的文件需要显式重试
+			}
+			existing.Members, existing.Payload = entry.Members, entry.Payload
+			return requeueEntry(queue, order, existing)
+		}
+
+		seq, err := queue.NextSequence()
+		if err != nil {
+			return fmt.Errorf("分配队列序号失败: %w", err)
+		}
+		stored := &QueueEntry{
+			Path:       entry.Path,
+			Members:    entry.Members,
+			Priority:   clampPriority(entry.Priority),
+			State:      QueueQueued,
+			Payload:    entry.Payload,
+			Seq:        seq,
+			EnqueuedAt: now,
+			UpdatedAt:  now,
+		}
+		if err := order.Put(queueOrderKey(stored), []byte(stored.Path)); err != nil {
+			return fmt.Errorf("写入队列索引失败: %w", err)
+		}
+		return putQueueEntry(queue, stored)
+	})
+}
+
+// DequeueJob 取出 dir 下优先级最高的排队条目并标记为运行中，没有条目时返回 nil, nil
+// dir 为空时不限目录；队列暂停时返回 ErrQueuePaused
+func (sm *StateManager) DequeueJob(dir string) (*QueueEntry, error) {
+	var entry *QueueEntry
+	err := sm.updateQueue(func(queue, order *bbolt.Bucket) error {
+		if isQueuePaused(queue.Tx()) {
+			return ErrQueuePaused
+		}
+
+		cursor := order.Cursor()
+		for key, path := cursor.First(); key != nil; key, path = cursor.Next() {
+			if !underDir(string(path), dir) {
+				continue
+			}
+			found, err := getQueueEntry(queue, string(path))
+			if err != nil {
+				return err
+			}
+			if err := cursor.Delete(); err != nil {
+				return fmt.Errorf("删除队列索引失败: %w", err)
+			}
+			if found == nil {
+				continue // 索引残留
+			}
+			found.State = QueueRunning
+			found.Attempts++
+			found.UpdatedAt = time.Now()
+			entry = found
+			return putQueueEntry(queue, found)
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// CompleteJob 转换完成，从队列删除
+func (sm *StateManager) CompleteJob(path string) error {
+	return sm.updateQueue(func(queue, order *bbolt.Bucket) error {
+		entry, err := getQueueEntry(queue, path)
+		if err != nil || entry == nil {
+			return err
+		}
+		if entry.State == QueueQueued {
+			order.Delete(queueOrderKey(entry))
+		}
+		return queue.Delete([]byte(path))
+	})
+}
+
+// FailJob 记录转换失败，条目保留在队列中供重试
+func (sm *StateManager) FailJob(path, message string) error {
+	return sm.modifyJob(path, func(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+		if entry.State == QueueQueued {
+			order.Delete(queueOrderKey(entry))
+		}
+		entry.State = QueueFailed
+		entry.LastError = message
+		entry.UpdatedAt = time.Now()
+		return putQueueEntry(queue, entry)
+	})
+}
+
+// RequeueJob 运行中被中断（如取消）的条目放回队列原位置
+func (sm *StateManager) RequeueJob(path string) error {
+	return sm.modifyJob(path, func(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+		if entry.State != QueueRunning {
+			return nil
+		}
+		return requeueEntry(queue, order, entry)
+	})
+}
+
+// RetryJob 失败或取消的条目重新排队，尝试次数清零
+func (sm *StateManager) RetryJob(path string) error {
+	return sm.modifyJob(path, func(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+		if entry.State != QueueFailed && entry.State != QueueCancelled {
+			return fmt.Errorf("只能重试失败或已取消的文件（当前状态: %s）", entry.State)
+		}
+		entry.Attempts = 0
+		return requeueEntry(queue, order, entry)
+	})
+}
+
+// CancelJob 取消单个文件：排队或失败的条目标记为取消，之后扫描时不再入队，直到 RetryJob
+func (sm *StateManager) CancelJob(path string) error {
+	return sm.modifyJob(path, func(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+		switch entry.State {
+		case QueueRunning:
+			return ErrQueueEntryRunning
+		case QueueQueued:
+			if err := order.Delete(queueOrderKey(entry)); err != nil {
+				return fmt.Errorf("删除队列索引失败: %w", err)
+			}
+		}
+		entry.State = QueueCancelled
+		entry.UpdatedAt = time.Now()
+		return putQueueEntry(queue, entry)
+	})
+}
+
+// SetJobPriority 调整单个文件的优先级，排队中的条目立即按新优先级排序
+func (sm *StateManager) SetJobPriority(path string, priority int) error {
+	return sm.modifyJob(path, func(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+		queued := entry.State == QueueQueued
+		if queued {
+			if err := order.Delete(queueOrderKey(entry)); err != nil {
+				return fmt.Errorf("删除队列索引失败: %w", err)
+			}
+		}
+		entry.Priority = clampPriority(priority)
+		entry.UpdatedAt = time.Now()
+		if queued {
+			if err := order.Put(queueOrderKey(entry), []byte(entry.Path)); err != nil {
+				return fmt.Errorf("写入队列索引失败: %w", err)
+			}
+		}
+		return putQueueEntry(queue, entry)
+	})
+}
+
+// RecoverQueue 把 dir 下处于运行中的条目（上次进程中断时正在转换）放回队列
+// 中断次数达到 MaxQueueAttempts 的条目标记为失败；返回放回和标记失败的条目数
+func (sm *StateManager) RecoverQueue(dir string) (requeued, failed int, err error) {
+	err = sm.updateQueue(func(queue, order *bbolt.Bucket) error {
+		var running []*QueueEntry
+		if err := queue.ForEach(func(k, v []byte) error {
+			var entry QueueEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("反序列化队列条目失败: %w", err)
+			}
+			if entry.State == QueueRunning && underDir(entry.Path, dir) {
+				running = append(running, &entry)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, entry := range running {
+			if entry.Attempts >= MaxQueueAttempts {
+				entry.State = QueueFailed
+				entry.LastError = fmt.Sprintf("转换被中断 %d 次，不再自动重试", entry.Attempts)
+				entry.UpdatedAt = time.Now()
+				if err := putQueueEntry(queue, entry); err != nil {
+					return err
+				}
+				failed++
+				continue
+			}
+			if err := requeueEntry(queue, order, entry); err != nil {
+				return err
+			}
+			requeued++
+		}
+		return nil
+	})
+	return requeued, failed, err
+}
+
+// ListQueue 列出 dir 下的队列条目：排队中的按出队顺序在前，其余按路径排序
+func (sm *StateManager) ListQueue(dir string) ([]*QueueEntry, error) {
+	var entries []*QueueEntry
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		queue := tx.Bucket([]byte(JobQueueBucket))
+		if queue == nil {
+			return nil
+		}
+		return queue.ForEach(func(k, v []byte) error {
+			var entry QueueEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("反序列化队列条目失败: %w", err)
+			}
+			if underDir(entry.Path, dir) {
+				entries = append(entries, &entry)
+			}
+			return nil
+		})
+	})
+
+	rank := map[QueueState]int{QueueRunning: 0, QueueQueued: 1, QueueFailed: 2, QueueCancelled: 3}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if rank[a.State] != rank[b.State] {
+			return rank[a.State] < rank[b.State]
+		}
+		if a.State == QueueQueued && a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.State == QueueQueued {
+			return a.Seq < b.Seq
+		}
+		return a.Path < b.Path
+	})
+	return entries, err
+}
+
+// PauseQueue 暂停整个队列：正在转换的文件继续完成，之后不再出队，重启后仍保持暂停
+func (sm *StateManager) PauseQueue() error {
+	return sm.putQueueMeta(queuePausedKey, []byte("1"))
+}
+
+// ResumeQueue 恢复队列
+func (sm *StateManager) ResumeQueue() error {
+	return sm.putQueueMeta(queuePausedKey, nil)
+}
+
+// IsQueuePaused 队列是否已暂停
+func (sm *StateManager) IsQueuePaused() (bool, error) {
+	paused := false
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		paused = isQueuePaused(tx)
+		return nil
+	})
+	return paused, err
+}
+
+// MarkQueueScanned 记录 dir 已完整扫描，之后中断时可以直接从队列继续而不重新扫描
+func (sm *StateManager) MarkQueueScanned(dir string) error {
+	return sm.putQueueMeta(queueScannedPrefix+dir, []byte(time.Now().Format(time.RFC3339)))
+}
+
+// ClearQueueScanned 清除 dir 的扫描完成标记（运行正常结束时调用）
+func (sm *StateManager) ClearQueueScanned(dir string) error {
+	return sm.putQueueMeta(queueScannedPrefix+dir, nil)
+}
+
+// IsQueueScanned dir 上次运行是否已完整扫描
+func (sm *StateManager) IsQueueScanned(dir string) (bool, error) {
+	scanned := false
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		if meta := tx.Bucket([]byte(JobQueueMetaBucket)); meta != nil {
+			scanned = meta.Get([]byte(queueScannedPrefix+dir)) != nil
+		}
+		return nil
+	})
+	return scanned, err
+}
+
+// updateQueue 在写事务中操作队列 bucket
+func (sm *StateManager) updateQueue(fn func(queue, order *bbolt.Bucket) error) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		queue, err := tx.CreateBucketIfNotExists([]byte(JobQueueBucket))
+		if err != nil {
+			return fmt.Errorf("创建job_queue bucket失败: %w", err)
+		}
+		order, err := tx.CreateBucketIfNotExists([]byte(JobQueueOrderBucket))
+		if err != nil {
+			return fmt.Errorf("创建job_queue_order bucket失败: %w", err)
+		}
+		return fn(queue, order)
+	})
+}
+
+// modifyJob 修改已存在的条目，不存在时返回 ErrQueueEntryNotFound
+func (sm *StateManager) modifyJob(path string, fn func(queue, order *bbolt.Bucket, entry *QueueEntry) error) error {
+	return sm.updateQueue(func(queue, order *bbolt.Bucket) error {
+		entry, err := getQueueEntry(queue, path)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("%w: %s", ErrQueueEntryNotFound, path)
+		}
+		return fn(queue, order, entry)
+	})
+}
+
+// putQueueMeta 写入队列元数据，value 为 nil 时删除
+func (sm *StateManager) putQueueMeta(key string, value []byte) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(JobQueueMetaBucket))
+		if err != nil {
+			return fmt.Errorf("创建job_queue_meta bucket失败: %w", err)
+		}
+		if value == nil {
+			return meta.Delete([]byte(key))
+		}
+		return meta.Put([]byte(key), value)
+	})
+}
+
+func isQueuePaused(tx *bbolt.Tx) bool {
+	meta := tx.Bucket([]byte(JobQueueMetaBucket))
+	return meta != nil && meta.Get([]byte(queuePausedKey)) != nil
+}
+
+// requeueEntry 条目重新排队，保留原入队序号
+func requeueEntry(queue, order *bbolt.Bucket, entry *QueueEntry) error {
+	entry.State = QueueQueued
+	entry.UpdatedAt = time.Now()
+	if err := order.Put(queueOrderKey(entry), []byte(entry.Path)); err != nil {
+		return fmt.Errorf("写入队列索引失败: %w", err)
+	}
+	return putQueueEntry(queue, entry)
+}
+
+func getQueueEntry(queue *bbolt.Bucket, path string) (*QueueEntry, error) {
+	data := queue.Get([]byte(path))
+	if data == nil {
+		return nil, nil
+	}
+	var entry QueueEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("反序列化队列条目失败: %w", err)
+	}
+	return &entry, nil
+}
+
+func putQueueEntry(queue *bbolt.Bucket, entry *QueueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化队列条目失败: %w", err)
+	}
+	if err := queue.Put([]byte(entry.Path), data); err != nil {
+		return fmt.Errorf("保存队列条目失败: %w", err)
+	}
+	return nil
+}
+
+// queueOrderKey 出队顺序键：优先级反转后大端编码，使高优先级排在前面
+func queueOrderKey(entry *QueueEntry) []byte {
+	key := make([]byte, 12)
+	binary.BigEndian.PutUint32(key, uint32(MaxQueuePriority-entry.Priority))
+	binary.BigEndian.PutUint64(key[4:], entry.Seq)
+	return key
+}
+
+func clampPriority(priority int) int {
+	return max(-MaxQueuePriority, min(MaxQueuePriority, priority))
+}
+
+// underDir path 是否为 dir 本身或位于 dir 之下；dir 为空时总是成立
+func underDir(path, dir string) bool {
+	if dir == "" {
+		return true
+	}
+	dir = filepath.Clean(dir)
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return path+string(filepath.Separator) == dir || strings.HasPrefix(path, dir)
+}
@@ -18,6 +18,10 @@ const (
 	ResultsBucket    = "results"
 	MetadataBucket   = "metadata"
 	StatsBucket      = "stats"
+	VerifyBucket     = "verifications"
+	ScanIndexBucket  = "scan_index"
+	ProcessedBucket  = "processed_files"
+	DecisionsBucket  = "decisions"
 
 	// Keys
 	SessionKey       = "current_session"
@@ -89,6 +93,13 @@ func (sm *StateManager) initBuckets() error {
 			ResultsBucket,
 			MetadataBucket,
 			StatsBucket,
+			VerifyBucket,
+			ScanIndexBucket,
+			ProcessedBucket,
+			DecisionsBucket,
+			JobQueueBucket,
+			JobQueueOrderBucket,
+			JobQueueMetaBucket,
 		}
 
 		for _, bucket := range buckets {
@@ -193,6 +204,31 @@ func (sm *StateManager) SaveMediaFiles(files []*types.MediaInfo) error {
 	})
 }
 
+// SaveMediaFile 保存或覆盖单个媒体文件信息，不影响其他文件（流式处理逐个记录）
+func (sm *StateManager) SaveMediaFile(file *types.MediaInfo) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("序列化媒体文件失败: %w", err)
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(MediaFilesBucket))
+		if err != nil {
+			return fmt.Errorf("创建media_files bucket失败: %w", err)
+		}
+
+		if err := bucket.Put([]byte(file.Path), data); err != nil {
+			return fmt.Errorf("保存媒体文件失败: %w", err)
+		}
+
+		return sm.updateLastModified(tx)
+	})
+}
+
 // LoadMediaFiles 加载媒体文件信息
 func (sm *StateManager) LoadMediaFiles() ([]*types.MediaInfo, error) {
 	var files []*types.MediaInfo
@@ -216,6 +252,31 @@ func (sm *StateManager) LoadMediaFiles() ([]*types.MediaInfo, error) {
 	return files, err
 }
 
+// LoadMediaFile 加载单个媒体文件信息，不存在时返回 nil, nil
+func (sm *StateManager) LoadMediaFile(filePath string) (*types.MediaInfo, error) {
+	var file *types.MediaInfo
+
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(MediaFilesBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		data := bucket.Get([]byte(filePath))
+		if data == nil {
+			return nil
+		}
+
+		file = &types.MediaInfo{}
+		if err := json.Unmarshal(data, file); err != nil {
+			return fmt.Errorf("反序列化媒体文件失败: %w", err)
+		}
+		return nil
+	})
+
+	return file, err
+}
+
 // UpdateMediaFileStatus 更新媒体文件状态
 func (sm *StateManager) UpdateMediaFileStatus(filePath string, status types.ProcessingStatus) error {
 	if sm.readonly {
@@ -283,6 +344,217 @@ func (sm *StateManager) SaveResults(results []*types.ProcessingResult) error {
 	})
 }
 
+// SaveVerification 保存转换校验记录，同一源文件的记录会被覆盖
+// 校验记录用于审计，ClearSession 不会清除
+func (sm *StateManager) SaveVerification(record *types.VerificationRecord) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(VerifyBucket))
+		if err != nil {
+			return fmt.Errorf("创建verifications bucket失败: %w", err)
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("序列化校验记录失败: %w", err)
+		}
+
+		if err := bucket.Put([]byte(record.SourcePath), data); err != nil {
+			return fmt.Errorf("保存校验记录失败: %w", err)
+		}
+
+		return sm.updateLastModified(tx)
+	})
+}
+
+// LoadVerification 加载指定源文件的校验记录
+func (sm *StateManager) LoadVerification(sourcePath string) (*types.VerificationRecord, error) {
+	var record *types.VerificationRecord
+
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(VerifyBucket))
+		if bucket == nil {
+			return fmt.Errorf("校验记录不存在")
+		}
+
+		data := bucket.Get([]byte(sourcePath))
+		if data == nil {
+			return fmt.Errorf("校验记录不存在")
+		}
+
+		record = &types.VerificationRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return fmt.Errorf("反序列化校验记录失败: %w", err)
+		}
+		return nil
+	})
+
+	return record, err
+}
+
+// SaveScanIndexEntry 保存扫描索引条目（已编码的分析结果），以文件路径为键
+// 扫描索引用于跨运行复用分析结果，ClearSession 不会清除
+func (sm *StateManager) SaveScanIndexEntry(path string, data []byte) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(ScanIndexBucket))
+		if err != nil {
+			return fmt.Errorf("创建scan_index bucket失败: %w", err)
+		}
+
+		if err := bucket.Put([]byte(path), data); err != nil {
+			return fmt.Errorf("保存扫描索引失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// LoadScanIndexEntry 读取扫描索引条目，不存在时返回 nil, nil
+func (sm *StateManager) LoadScanIndexEntry(path string) ([]byte, error) {
+	var data []byte
+
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(ScanIndexBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		// bbolt 返回的切片只在事务内有效，需要复制
+		if value := bucket.Get([]byte(path)); value != nil {
+			data = append([]byte(nil), value...)
+		}
+		return nil
+	})
+
+	return data, err
+}
+
+// DeleteScanIndexEntry 删除扫描索引条目
+func (sm *StateManager) DeleteScanIndexEntry(path string) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法删除数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(ScanIndexBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(path))
+	})
+}
+
+// SaveProcessedFile 保存文件的处理记录（已编码），以文件路径为键
+// 监视模式据此跳过已处理且未变化的文件，ClearSession 不会清除
+func (sm *StateManager) SaveProcessedFile(path string, data []byte) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(ProcessedBucket))
+		if err != nil {
+			return fmt.Errorf("创建processed_files bucket失败: %w", err)
+		}
+
+		if err := bucket.Put([]byte(path), data); err != nil {
+			return fmt.Errorf("保存处理记录失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// LoadProcessedFile 读取文件的处理记录，不存在时返回 nil, nil
+func (sm *StateManager) LoadProcessedFile(path string) ([]byte, error) {
+	var data []byte
+
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(ProcessedBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		if value := bucket.Get([]byte(path)); value != nil {
+			data = append([]byte(nil), value...)
+		}
+		return nil
+	})
+
+	return data, err
+}
+
+// SaveDecisions 以新的决策轨迹替换文件已有的轨迹（文件开始新一轮评估时调用）
+// 决策轨迹供 pixly explain 查看，ClearSession 不会清除
+func (sm *StateManager) SaveDecisions(path string, records []types.DecisionRecord) error {
+	return sm.updateDecisions(path, func([]types.DecisionRecord) []types.DecisionRecord {
+		return records
+	})
+}
+
+// AppendDecisions 在文件的决策轨迹末尾追加记录，文件没有轨迹时新建
+func (sm *StateManager) AppendDecisions(path string, records ...types.DecisionRecord) error {
+	return sm.updateDecisions(path, func(existing []types.DecisionRecord) []types.DecisionRecord {
+		return append(existing, records...)
+	})
+}
+
+// LoadDecisions 读取文件的决策轨迹，不存在时返回 nil, nil
+func (sm *StateManager) LoadDecisions(path string) ([]types.DecisionRecord, error) {
+	var records []types.DecisionRecord
+
+	err := sm.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(DecisionsBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		if data := bucket.Get([]byte(path)); data != nil {
+			if err := json.Unmarshal(data, &records); err != nil {
+				return fmt.Errorf("反序列化决策轨迹失败: %w", err)
+			}
+		}
+		return nil
+	})
+
+	return records, err
+}
+
+// updateDecisions 在一个事务内读取、修改并写回文件的决策轨迹
+func (sm *StateManager) updateDecisions(path string, fn func([]types.DecisionRecord) []types.DecisionRecord) error {
+	if sm.readonly {
+		return fmt.Errorf("只读模式下无法保存数据")
+	}
+
+	return sm.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(DecisionsBucket))
+		if err != nil {
+			return fmt.Errorf("创建decisions bucket失败: %w", err)
+		}
+
+		var records []types.DecisionRecord
+		if data := bucket.Get([]byte(path)); data != nil {
+			if err := json.Unmarshal(data, &records); err != nil {
+				return fmt.Errorf("反序列化决策轨迹失败: %w", err)
+			}
+		}
+
+		data, err := json.Marshal(fn(records))
+		if err != nil {
+			return fmt.Errorf("序列化决策轨迹失败: %w", err)
+		}
+		if err := bucket.Put([]byte(path), data); err != nil {
+			return fmt.Errorf("保存决策轨迹失败: %w", err)
+		}
+		return nil
+	})
+}
+
 // LoadResults 加载处理结果
 func (sm *StateManager) LoadResults() ([]*types.ProcessingResult, error) {
 	var results []*types.ProcessingResult
@@ -496,7 +768,7 @@ func (sm *StateManager) GetDBInfo() (map[string]interface{}, error) {
 		}
 
 		// 获取bucket统计
-		buckets := []string{MediaFilesBucket, ResultsBucket, MetadataBucket, StatsBucket}
+		buckets := []string{MediaFilesBucket, ResultsBucket, MetadataBucket, StatsBucket, VerifyBucket}
 		for _, bucketName := range buckets {
 			bucket := tx.Bucket([]byte(bucketName))
 			if bucket != nil {
@@ -175,6 +175,19 @@ type ProcessingResult struct {
 	Mode         AppMode       `json:"mode"`
 }
 
+// VerificationRecord 转换结果校验记录（如JPEG无损转码的逐位重建校验）
+type VerificationRecord struct {
+	SourcePath          string    `json:"source_path"`
+	OutputPath          string    `json:"output_path"`
+	Kind                string    `json:"kind"` // 校验类型，如 "jpeg_reconstruction"
+	Passed              bool      `json:"passed"`
+	SourceSHA256        string    `json:"source_sha256,omitempty"`
+	ReconstructedSHA256 string    `json:"reconstructed_sha256,omitempty"`
+	Action              string    `json:"action"` // "accepted" 或 "kept_original"
+	Error               string    `json:"error,omitempty"`
+	VerifiedAt          time.Time `json:"verified_at"`
+}
+
 // Statistics 统计信息
 type Statistics struct {
 	TotalFiles      int                  `json:"total_files"`
@@ -366,8 +379,69 @@ type ConversionTask struct {
 
 // RoutingDecision 路由决策
 type RoutingDecision struct {
-	Strategy     string       `json:"strategy"`
+	Strategy     string       `json:"strategy"` // "convert", "skip", "keep", "delete"
 	TargetFormat string       `json:"target_format"`
 	QualityLevel QualityLevel `json:"quality_level"`
 	Reason       string       `json:"reason,omitempty"`
+	Rule         string       `json:"rule,omitempty"` // 做出决策的规则名，内置路由为 "builtin"
+
+	// 路由规则指定的编码参数，未指定时使用目标格式的默认值
+	Lossless *bool `json:"lossless,omitempty"`
+	Quality  int   `json:"quality,omitempty"`
+	Effort   int   `json:"effort,omitempty"`
+
+	// 路由过程中各阶段的决策记录（快速预判/深度分析、规则命中）
+	Trace []DecisionRecord `json:"trace,omitempty"`
+}
+
+// 决策阶段
+const (
+	DecisionStageAssessment    = "assessment"     // 品质评估与分级
+	DecisionStageOptimalFormat = "optimal_format" // 已是最优格式检查
+	DecisionStageMode          = "mode"           // 按处理模式和品质等级选择目标格式
+	DecisionStageRouting       = "routing"        // 自动模式+内置路由（快速预判/深度分析）
+	DecisionStageRoutingRule   = "routing_rule"   // 用户路由规则
+	DecisionStageConversion    = "conversion"     // 转换过程中的选择（有损/无损、目标质量、校验）
+	DecisionStageResult        = "result"         // 最终结果
+
+	DecisionStageWhitelist      = "whitelist"           // 格式白名单检查（支持、跳过及原因）
+	DecisionStageRecommendation = "mode_recommendation" // 按品质等级推荐处理模式
+	DecisionStageBatch          = "batch_decision"      // 损坏/极低品质文件的批量处理选择
+)
+
+// DecisionRecord 决策轨迹中的一条记录：某个阶段依据哪些测量值和阈值、走了哪个分支、得出什么结果
+type DecisionRecord struct {
+	Stage      string                 `json:"stage"`
+	Branch     string                 `json:"branch"`  // 命中的规则或分支
+	Outcome    string                 `json:"outcome"` // 决策结果，如品质等级、目标格式、skip、keep
+	Values     map[string]interface{} `json:"values,omitempty"`
+	Thresholds string                 `json:"thresholds,omitempty"` // 分支所用的阈值说明
+	Time       time.Time              `json:"time"`
+}
+
+// NewDecisionRecord 创建决策记录；values 中为 nil 的值表示未测量，不保存，测量到的零值照常保存
+func NewDecisionRecord(stage, branch, outcome string, values map[string]interface{}, thresholds string) DecisionRecord {
+	var measured map[string]interface{}
+	for key, value := range values {
+		if value == nil {
+			continue
+		}
+		if measured == nil {
+			measured = make(map[string]interface{}, len(values))
+		}
+		measured[key] = value
+	}
+	return DecisionRecord{
+		Stage:      stage,
+		Branch:     branch,
+		Outcome:    outcome,
+		Values:     measured,
+		Thresholds: thresholds,
+		Time:       time.Now(),
+	}
+}
+
+// DecisionRecorder 把决策记录追加到文件的决策轨迹，由 state.StateManager 实现
+type DecisionRecorder interface {
+	AppendDecisions(path string, records ...DecisionRecord) error
 }
@@ -0,0 +1,613 @@
+package distributed
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// CoordinatorOptions 协调节点选项
+type CoordinatorOptions struct {
+	LeaseTTL     time.Duration // 租约时长，超时未续约的单元重新分配
+	ReapInterval time.Duration // 检查过期租约的间隔
+}
+
+// Coordinator 协调节点：持有状态数据库和持久化队列，把队列中的转换单元租给工作节点
+//
+// 租约只保存在内存中；协调节点重启时上次租出的单元（队列中处于运行中）重新排队。
+type Coordinator struct {
+	logger *zap.Logger
+	state  *state.StateManager
+	dir    string
+	opts   CoordinatorOptions
+
+	mu      sync.Mutex
+	leases  map[string]*activeLease
+	planned bool
+	planErr error
+	stats   Status
+	done    chan struct{}
+}
+
+// activeLease 已租出的单元
+type activeLease struct {
+	Lease
+	worker   string
+	attempts int
+	uploads  map[int]*upload // 按源文件序号
+}
+
+// upload 已上传并校验的输出文件
+type upload struct {
+	tempPath string
+	name     string
+	checksum string
+}
+
+// NewCoordinator 创建协调节点，dir 为目标目录，stateManager 由调用方打开和关闭
+func NewCoordinator(logger *zap.Logger, stateManager *state.StateManager, dir string, opts CoordinatorOptions) *Coordinator {
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = DefaultLeaseTTL
+	}
+	if opts.ReapInterval <= 0 {
+		opts.ReapInterval = min(opts.LeaseTTL/4, 5*time.Second)
+	}
+	return &Coordinator{
+		logger: logger,
+		state:  stateManager,
+		dir:    dir,
+		opts:   opts,
+		leases: make(map[string]*activeLease),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run 运行 plan（扫描并评估，把转换单元写入队列），同时向工作节点分发租约，
+// 直到规划完成且队列中没有排队或租出的单元，或 ctx 取消
+func (c *Coordinator) Run(ctx context.Context, plan func(context.Context) error) (Status, error) {
+	if requeued, failed, err := c.state.RecoverQueue(c.dir); err != nil {
+		return Status{}, fmt.Errorf("恢复转换队列失败: %w", err)
+	} else if requeued+failed > 0 {
+		c.logger.Info("上次租出的单元重新排队", zap.Int("requeued", requeued), zap.Int("failed", failed))
+	}
+
+	reapCtx, stopReap := context.WithCancel(ctx)
+	defer stopReap()
+	go c.reapLoop(reapCtx)
+
+	go func() {
+		err := plan(ctx)
+		c.mu.Lock()
+		c.planned, c.planErr = true, err
+		c.mu.Unlock()
+		if err != nil {
+			c.logger.Error("规划转换任务失败", zap.Error(err))
+		}
+		c.checkDone()
+	}()
+
+	select {
+	case <-c.done:
+		if err := c.state.ClearQueueScanned(c.dir); err != nil {
+			c.logger.Debug("清除扫描完成标记失败", zap.Error(err))
+		}
+	case <-ctx.Done():
+		c.releaseAll()
+	}
+
+	status := c.Status()
+	c.mu.Lock()
+	planErr := c.planErr
+	c.mu.Unlock()
+	if planErr != nil {
+		return status, planErr
+	}
+	return status, ctx.Err()
+}
+
+// Done 全部单元完成时关闭
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Status 返回统计快照
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.stats
+	status.Planned = c.planned
+	status.ActiveLeases = len(c.leases)
+	status.Done = isDone(c.done)
+	if c.planErr != nil {
+		status.PlanError = c.planErr.Error()
+	}
+	return status
+}
+
+// Handler 返回 HTTP 路由（见包文档）
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /leases", c.handleLease)
+	mux.HandleFunc("POST /leases/{id}/heartbeat", c.withLease(c.handleHeartbeat))
+	mux.HandleFunc("GET /leases/{id}/files/{index}", c.withLease(c.handleDownload))
+	mux.HandleFunc("PUT /leases/{id}/outputs/{index}", c.withLease(c.handleUpload))
+	mux.HandleFunc("POST /leases/{id}/complete", c.withLease(c.handleComplete))
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+func (c *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体无效: %w", err))
+		return
+	}
+
+	if isDone(c.done) {
+		writeError(w, http.StatusGone, errors.New("全部转换已完成"))
+		return
+	}
+
+	entry, err := c.state.DequeueJob(c.dir)
+	switch {
+	case errors.Is(err, state.ErrQueuePaused):
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("读取转换队列失败: %w", err))
+		return
+	case entry == nil:
+		// 规划仍在进行或还有租约未完成（可能被重新分配），稍后再试
+		c.checkDone()
+		if isDone(c.done) {
+			writeError(w, http.StatusGone, errors.New("全部转换已完成"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var unit engine.QueuedUnit
+	if err := json.Unmarshal(entry.Payload, &unit); err != nil || len(unit.Tasks) == 0 {
+		c.state.FailJob(entry.Path, "无法解析队列任务")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	lease := &activeLease{
+		Lease: Lease{
+			ID:        newLeaseID(),
+			Members:   entry.Members,
+			Unit:      unit,
+			TTL:       c.opts.LeaseTTL,
+			ExpiresAt: time.Now().Add(c.opts.LeaseTTL),
+		},
+		worker:   req.Worker,
+		attempts: entry.Attempts,
+		uploads:  make(map[int]*upload),
+	}
+	c.mu.Lock()
+	c.leases[lease.ID] = lease
+	metrics.ActiveLeases.Set(float64(len(c.leases)))
+	c.mu.Unlock()
+	metrics.LeasesGranted.Inc()
+
+	c.logger.Info("租出转换单元",
+		zap.String("lease", lease.ID),
+		zap.String("worker", req.Worker),
+		zap.String("file", filepath.Base(entry.Path)),
+		zap.Int("attempt", entry.Attempts))
+	writeJSON(w, http.StatusOK, lease.Lease)
+}
+
+// withLease 解析路径中的租约，已过期或不存在时返回 410，工作节点应放弃该单元
+func (c *Coordinator) withLease(handler func(http.ResponseWriter, *http.Request, *activeLease)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		lease, ok := c.leases[r.PathValue("id")]
+		c.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusGone, fmt.Errorf("租约不存在或已过期: %s", r.PathValue("id")))
+			return
+		}
+		handler(w, r, lease)
+	}
+}
+
+func (c *Coordinator) handleHeartbeat(w http.ResponseWriter, r *http.Request, lease *activeLease) {
+	c.mu.Lock()
+	if c.leases[lease.ID] != lease {
+		c.mu.Unlock()
+		writeError(w, http.StatusGone, fmt.Errorf("租约不存在或已过期: %s", lease.ID))
+		return
+	}
+	lease.ExpiresAt = time.Now().Add(c.opts.LeaseTTL)
+	expires := lease.ExpiresAt
+	c.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]time.Time{"expires_at": expires})
+}
+
+// memberIndex 解析路径中的源文件序号
+func memberIndex(r *http.Request, lease *activeLease) (int, error) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(lease.Members) {
+		return 0, fmt.Errorf("无效的文件序号: %s", r.PathValue("index"))
+	}
+	return index, nil
+}
+
+// handleDownload 流式发送源文件，边发送边计算 SHA-256，结束后放入 trailer
+func (c *Coordinator) handleDownload(w http.ResponseWriter, r *http.Request, lease *activeLease) {
+	index, err := memberIndex(r, lease)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	file, err := os.Open(lease.Members[index])
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("打开源文件失败: %w", err))
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Trailer", ChecksumHeader)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), file); err != nil {
+		c.logger.Warn("发送源文件失败", zap.String("file", filepath.Base(lease.Members[index])), zap.Error(err))
+		return
+	}
+	w.Header().Set(ChecksumHeader, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// handleUpload 接收输出文件，写入源文件所在目录的临时文件并校验 SHA-256，提交结果时再改为正式文件名
+func (c *Coordinator) handleUpload(w http.ResponseWriter, r *http.Request, lease *activeLease) {
+	index, err := memberIndex(r, lease)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	name := filepath.Base(r.URL.Query().Get("name"))
+	if name == "." || name == string(filepath.Separator) || strings.HasPrefix(name, ".pixly_") {
+		writeError(w, http.StatusBadRequest, errors.New("无效的输出文件名"))
+		return
+	}
+	expected := strings.ToLower(r.Header.Get(ChecksumHeader))
+	if expected == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("缺少 %s 请求头", ChecksumHeader))
+		return
+	}
+
+	tempPath := filepath.Join(filepath.Dir(lease.Members[index]), fmt.Sprintf(".pixly_upload_%s_%d", lease.ID, index))
+	file, err := os.Create(tempPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("创建临时文件失败: %w", err))
+		return
+	}
+	hash := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(file, hash), r.Body)
+	closeErr := file.Close()
+	if err := errors.Join(copyErr, closeErr); err != nil {
+		os.Remove(tempPath)
+		writeError(w, http.StatusBadRequest, fmt.Errorf("接收输出文件失败: %w", err))
+		return
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		os.Remove(tempPath)
+		writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("校验和不一致: 期望 %s，实际 %s", expected, actual))
+		return
+	}
+
+	c.mu.Lock()
+	if c.leases[lease.ID] != lease {
+		c.mu.Unlock()
+		os.Remove(tempPath)
+		writeError(w, http.StatusGone, fmt.Errorf("租约不存在或已过期: %s", lease.ID))
+		return
+	}
+	if previous := lease.uploads[index]; previous != nil && previous.tempPath != tempPath {
+		os.Remove(previous.tempPath)
+	}
+	lease.uploads[index] = &upload{tempPath: tempPath, name: name, checksum: expected}
+	c.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"checksum": expected})
+}
+
+// handleComplete 确认输出文件并更新队列：全部成功时从队列删除，否则记录失败原因
+func (c *Coordinator) handleComplete(w http.ResponseWriter, r *http.Request, lease *activeLease) {
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体无效: %w", err))
+		return
+	}
+
+	// 先摘除租约，同一租约只能提交一次，且之后不会被当作过期重新分配
+	c.mu.Lock()
+	if c.leases[lease.ID] != lease {
+		c.mu.Unlock()
+		writeError(w, http.StatusGone, fmt.Errorf("租约不存在或已过期: %s", lease.ID))
+		return
+	}
+	delete(c.leases, lease.ID)
+	metrics.ActiveLeases.Set(float64(len(c.leases)))
+	c.mu.Unlock()
+
+	results := make(map[string]Result, len(req.Results))
+	for _, result := range req.Results {
+		results[result.Source] = result
+	}
+
+	var failure string
+	for index, source := range lease.Members {
+		result, ok := results[source]
+		if !ok {
+			result = Result{Source: source, Status: "failed", Message: "工作节点未返回结果"}
+		}
+		if result.Status != "failed" {
+			if err := c.acceptOutput(lease, index, &result); err != nil {
+				result.Status, result.Message = "failed", err.Error()
+			}
+		}
+		if result.Status == "failed" && failure == "" {
+			failure = result.Message
+		}
+		c.updateFileState(source, result.Status)
+		c.recordDecisions(source, lease.worker, result)
+		c.logger.Info("转换单元结果",
+			zap.String("lease", lease.ID),
+			zap.String("worker", lease.worker),
+			zap.String("file", filepath.Base(source)),
+			zap.String("status", result.Status),
+			zap.String("message", result.Message))
+	}
+	c.removeUploads(lease)
+
+	var err error
+	c.mu.Lock()
+	if failure == "" {
+		c.stats.Completed++
+		err = c.state.CompleteJob(lease.Members[0])
+	} else {
+		c.stats.Failed++
+		err = c.state.FailJob(lease.Members[0], failure)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.logger.Warn("更新转换队列失败", zap.String("file", lease.Members[0]), zap.Error(err))
+	}
+
+	c.checkDone()
+	writeJSON(w, http.StatusOK, map[string]bool{"accepted": failure == ""})
+}
+
+// acceptOutput 确认单个文件的输出
+// 流式传输的输出已在上传时校验，此处改为正式文件名（原位替换时覆盖源文件）；共享文件系统时重新计算输出文件的 SHA-256
+func (c *Coordinator) acceptOutput(lease *activeLease, index int, result *Result) error {
+	source := lease.Members[index]
+	switch {
+	case result.Output != "":
+		c.mu.Lock()
+		uploaded := lease.uploads[index]
+		delete(lease.uploads, index)
+		c.mu.Unlock()
+		if uploaded == nil || uploaded.name != result.Output || uploaded.checksum != result.Checksum {
+			if uploaded != nil {
+				os.Remove(uploaded.tempPath)
+			}
+			return fmt.Errorf("输出文件 %s 未上传或校验和不一致", result.Output)
+		}
+		target := uniquePath(filepath.Join(filepath.Dir(source), uploaded.name))
+		if result.Replaced {
+			target = source
+		}
+		if err := os.Rename(uploaded.tempPath, target); err != nil {
+			os.Remove(uploaded.tempPath)
+			return fmt.Errorf("保存输出文件失败: %w", err)
+		}
+		result.TargetPath = target
+	case result.Replaced:
+		return fmt.Errorf("替换源文件的输出未上传: %s", filepath.Base(source))
+	case result.TargetPath != "" && result.TargetPath != source:
+		actual, err := fileChecksum(result.TargetPath)
+		if err != nil {
+			return fmt.Errorf("读取输出文件失败（工作节点是否共享文件系统？）: %w", err)
+		}
+		if actual != result.Checksum {
+			return fmt.Errorf("输出文件校验和不一致: 期望 %s，实际 %s", result.Checksum, actual)
+		}
+	}
+	return nil
+}
+
+// reapLoop 定期回收过期租约：单元重新排队，交给其他工作节点
+func (c *Coordinator) reapLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.reapExpired(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Coordinator) reapExpired(now time.Time) {
+	c.mu.Lock()
+	var expired []*activeLease
+	for id, lease := range c.leases {
+		if now.After(lease.ExpiresAt) {
+			expired = append(expired, lease)
+			delete(c.leases, id)
+		}
+	}
+	metrics.ActiveLeases.Set(float64(len(c.leases)))
+	c.mu.Unlock()
+
+	for _, lease := range expired {
+		c.removeUploads(lease)
+		var err error
+		if lease.attempts >= state.MaxQueueAttempts {
+			err = c.state.FailJob(lease.Members[0], fmt.Sprintf("工作节点 %d 次未在租约时间内完成", lease.attempts))
+		} else {
+			err = c.state.RequeueJob(lease.Members[0])
+		}
+		if err != nil {
+			c.logger.Warn("回收租约失败", zap.String("lease", lease.ID), zap.Error(err))
+		}
+		c.mu.Lock()
+		c.stats.Reassigned++
+		c.mu.Unlock()
+		metrics.LeaseReassignments.Inc()
+		c.logger.Warn("租约过期，单元重新分配",
+			zap.String("lease", lease.ID),
+			zap.String("worker", lease.worker),
+			zap.String("file", filepath.Base(lease.Members[0])))
+	}
+	if len(expired) > 0 {
+		c.checkDone()
+	}
+}
+
+// releaseAll 协调节点退出时把租出的单元放回队列
+func (c *Coordinator) releaseAll() {
+	c.mu.Lock()
+	leases := c.leases
+	c.leases = make(map[string]*activeLease)
+	metrics.ActiveLeases.Set(0)
+	c.mu.Unlock()
+	for _, lease := range leases {
+		c.removeUploads(lease)
+		if err := c.state.RequeueJob(lease.Members[0]); err != nil {
+			c.logger.Warn("释放租约失败", zap.String("lease", lease.ID), zap.Error(err))
+		}
+	}
+}
+
+// checkDone 规划完成、没有租约且队列中没有排队的单元时结束
+func (c *Coordinator) checkDone() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.planned || len(c.leases) > 0 || isDone(c.done) {
+		return
+	}
+	entries, err := c.state.ListQueue(c.dir)
+	if err != nil {
+		c.logger.Warn("读取转换队列失败", zap.Error(err))
+		return
+	}
+	for _, entry := range entries {
+		if entry.State == state.QueueQueued || entry.State == state.QueueRunning {
+			return
+		}
+	}
+	close(c.done)
+	c.logger.Info("分布式转换完成", zap.Int("completed", c.stats.Completed), zap.Int("failed", c.stats.Failed))
+}
+
+func (c *Coordinator) removeUploads(lease *activeLease) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for index, uploaded := range lease.uploads {
+		os.Remove(uploaded.tempPath)
+		delete(lease.uploads, index)
+	}
+}
+
+func (c *Coordinator) updateFileState(path, status string) {
+	processing := types.StatusCompleted
+	switch status {
+	case "skipped", "kept":
+		processing = types.StatusSkipped
+	case "failed":
+		processing = types.StatusFailed
+	}
+	if err := c.state.UpdateMediaFileStatus(path, processing); err != nil {
+		c.logger.Debug("更新文件状态失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
+
+// recordDecisions 把工作节点的转换决策和最终结果追加到文件的决策轨迹
+func (c *Coordinator) recordDecisions(path, worker string, result Result) {
+	values := map[string]interface{}{"worker": worker}
+	if result.Message != "" {
+		values["message"] = result.Message
+	}
+	if result.OriginalSize > 0 {
+		values["original_size"] = result.OriginalSize
+		values["new_size"] = result.NewSize
+	}
+	records := append(result.Decisions, types.DecisionRecord{
+		Stage:   types.DecisionStageResult,
+		Branch:  result.Status,
+		Outcome: result.Status,
+		Values:  values,
+		Time:    time.Now(),
+	})
+	if err := c.state.AppendDecisions(path, records...); err != nil {
+		c.logger.Debug("追加决策轨迹失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
+
+// uniquePath 目标已存在时在文件名后追加序号
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+func isDone(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func newLeaseID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
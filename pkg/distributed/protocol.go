@@ -0,0 +1,94 @@
+// Package distributed 分布式转换：协调节点负责扫描、评估和状态数据库，
+// 通过 HTTP 把转换单元以租约形式分给其他机器上的工作节点。
+//
+// 协议（均为 JSON，除文件传输外）:
+//
+//	POST /leases                      申请租约 {"worker": "名称"}；200 返回租约，204 暂无任务，410 全部完成
+//	POST /leases/{id}/heartbeat       续约；租约已过期或被重新分配时返回 410
+//	GET  /leases/{id}/files/{n}       下载单元中第 n 个源文件，SHA-256 放在 HTTP trailer 中
+//	PUT  /leases/{id}/outputs/{n}     上传第 n 个文件的输出 ?name=输出文件名，请求头携带 SHA-256
+//	POST /leases/{id}/complete        提交结果 {"results": [...]}
+//	GET  /status                      协调节点统计
+//	GET  /metrics                     Prometheus 文本格式的运行指标
+//
+// 工作节点与协调节点共享文件系统（相同路径）时直接读写源目录，提交结果时附带输出文件的 SHA-256，
+// 协调节点重新计算后确认；否则通过上面的下载/上传接口传输文件内容。
+// 原位替换源文件的单元（平衡优化）总是在工作节点的临时目录中转换并上传输出，由协调节点替换源文件。
+package distributed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+)
+
+// ChecksumHeader 文件内容的 SHA-256（十六进制）
+const ChecksumHeader = "X-Pixly-Sha256"
+
+// DefaultLeaseTTL 默认租约时长，工作节点每隔三分之一租约时长发送一次心跳
+const DefaultLeaseTTL = time.Minute
+
+// LeaseRequest 申请租约
+type LeaseRequest struct {
+	Worker string `json:"worker"`
+}
+
+// Lease 一个转换单元的租约
+type Lease struct {
+	ID        string            `json:"id"`
+	Members   []string          `json:"members"` // 单元内的源文件（协调节点上的路径）
+	Unit      engine.QueuedUnit `json:"unit"`
+	TTL       time.Duration     `json:"ttl"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Result 单个源文件的转换结果
+type Result struct {
+	Source       string `json:"source"` // 源文件（协调节点上的路径）
+	Status       string `json:"status"` // success, skipped, kept, failed
+	Message      string `json:"message,omitempty"`
+	TargetPath   string `json:"target_path,omitempty"` // 共享文件系统：输出文件路径
+	Output       string `json:"output,omitempty"`      // 流式传输：已上传的输出文件名
+	Replaced     bool   `json:"replaced,omitempty"`    // 已上传的输出替换源文件（平衡优化）
+	Checksum     string `json:"checksum,omitempty"`    // 输出文件的 SHA-256
+	OriginalSize int64  `json:"original_size,omitempty"`
+	NewSize      int64  `json:"new_size,omitempty"`
+
+	Decisions []types.DecisionRecord `json:"decisions,omitempty"` // 工作节点转换阶段的决策记录
+}
+
+// CompleteRequest 提交租约结果
+type CompleteRequest struct {
+	Results []Result `json:"results"`
+}
+
+// Status 协调节点统计
+type Status struct {
+	Planned      bool   `json:"planned"`
+	PlanError    string `json:"plan_error,omitempty"`
+	ActiveLeases int    `json:"active_leases"`
+	Completed    int    `json:"completed"`
+	Failed       int    `json:"failed"`
+	Reassigned   int    `json:"reassigned"`
+	Done         bool   `json:"done"`
+}
+
+// fileChecksum 计算文件的 SHA-256
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
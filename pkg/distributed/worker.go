@@ -0,0 +1,448 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pixly/pkg/engine"
+
+	"go.uber.org/zap"
+)
+
+// errCoordinatorDone 协调节点报告全部完成
+var errCoordinatorDone = errors.New("协调节点已完成全部转换")
+
+// errLeaseLost 租约已过期或被重新分配
+var errLeaseLost = errors.New("租约已失效")
+
+// uploadAttempts 上传输出文件的最多尝试次数
+const uploadAttempts = 3
+
+// ConvertFunc 在本机转换一个单元，通常为 (*engine.ConversionEngine).ConvertUnit
+type ConvertFunc func(ctx context.Context, unit engine.QueuedUnit) []engine.ConversionResult
+
+// WorkerOptions 工作节点选项
+type WorkerOptions struct {
+	Coordinator  string        // 协调节点地址，如 http://10.0.0.2:8766
+	Name         string        // 工作节点名称，记录在协调节点日志中
+	SharedFS     bool          // 与协调节点共享文件系统（相同路径），不传输文件内容
+	Jobs         int           // 同时处理的单元数
+	WorkDir      string        // 流式传输时存放源文件和输出的临时目录
+	PollInterval time.Duration // 暂无任务或连接失败时的重试间隔
+	Client       *http.Client
+}
+
+// Worker 工作节点：向协调节点申请租约，在本机转换后提交结果
+type Worker struct {
+	logger  *zap.Logger
+	opts    WorkerOptions
+	convert ConvertFunc
+}
+
+// NewWorker 创建工作节点
+func NewWorker(logger *zap.Logger, opts WorkerOptions, convert ConvertFunc) *Worker {
+	opts.Coordinator = strings.TrimSuffix(opts.Coordinator, "/")
+	if opts.Name == "" {
+		host, _ := os.Hostname()
+		opts.Name = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = 1
+	}
+	if opts.WorkDir == "" {
+		opts.WorkDir = os.TempDir()
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	return &Worker{logger: logger, opts: opts, convert: convert}
+}
+
+// Run 持续处理租约，协调节点报告全部完成时返回 nil，ctx 取消时返回 ctx.Err()
+// 取消时正在处理的单元不再提交，租约过期后由协调节点重新分配
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, w.opts.Jobs)
+	for i := 0; i < w.opts.Jobs; i++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			errs[slot] = w.runSlot(ctx)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (w *Worker) runSlot(ctx context.Context) error {
+	for {
+		lease, err := w.acquire(ctx)
+		switch {
+		case errors.Is(err, errCoordinatorDone):
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			w.logger.Warn("申请租约失败", zap.Error(err))
+		case lease != nil:
+			w.process(ctx, lease)
+			continue
+		}
+
+		select {
+		case <-time.After(w.opts.PollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire 申请租约，暂无任务时返回 nil, nil
+func (w *Worker) acquire(ctx context.Context) (*Lease, error) {
+	resp, err := w.postJSON(ctx, "/leases", LeaseRequest{Worker: w.opts.Name})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var lease Lease
+		if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+			return nil, fmt.Errorf("解析租约失败: %w", err)
+		}
+		return &lease, nil
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusGone:
+		return nil, errCoordinatorDone
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// process 处理一个租约：心跳续约、准备源文件、转换、上传输出并提交结果
+func (w *Worker) process(ctx context.Context, lease *Lease) {
+	logger := w.logger.With(zap.String("lease", lease.ID), zap.String("file", filepath.Base(lease.Members[0])))
+	leaseCtx, cancel := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	defer func() { <-heartbeatDone }()
+	go func() {
+		defer close(heartbeatDone)
+		w.heartbeat(leaseCtx, lease, cancel, logger)
+	}()
+	defer cancel() // 先停止心跳再等待其退出
+
+	unit := lease.Unit
+	local := make(map[string]string, len(lease.Members)) // 本机路径 → 协调节点路径
+	for _, member := range lease.Members {
+		local[member] = member
+	}
+
+	// 原位替换源文件的单元即使共享文件系统也在临时目录中转换，输出上传后由协调节点替换源文件，
+	// 租约失效时源文件保持不变
+	staged := !w.opts.SharedFS || replacesSource(unit)
+	var downloaded map[string]string // 本机路径 → 下载时的 SHA-256
+	if staged {
+		workDir, err := os.MkdirTemp(w.opts.WorkDir, "pixly-lease-")
+		if err != nil {
+			w.complete(ctx, lease, failedResults(lease, fmt.Sprintf("创建临时目录失败: %v", err)), logger)
+			return
+		}
+		defer os.RemoveAll(workDir)
+
+		paths, checksums, err := w.download(leaseCtx, lease, workDir)
+		if err != nil {
+			if leaseCtx.Err() == nil {
+				w.complete(ctx, lease, failedResults(lease, err.Error()), logger)
+			}
+			return
+		}
+		local = make(map[string]string, len(paths))
+		downloaded = make(map[string]string, len(paths))
+		for i, path := range paths {
+			local[path] = lease.Members[i]
+			downloaded[path] = checksums[i]
+		}
+		unit = localizeUnit(unit, lease.Members, paths)
+	}
+
+	conversionResults := w.convert(leaseCtx, unit)
+	if leaseCtx.Err() != nil {
+		logger.Warn("租约已失效或工作节点退出，放弃结果")
+		return
+	}
+
+	results := make([]Result, 0, len(conversionResults))
+	for _, converted := range conversionResults {
+		source := local[converted.SourcePath]
+		result := Result{
+			Source:       source,
+			Status:       converted.Status,
+			Message:      converted.Message,
+			OriginalSize: converted.OriginalSize,
+			NewSize:      converted.NewSize,
+			Decisions:    converted.Decisions,
+		}
+		output := converted.Status != "failed" && converted.TargetPath != "" && converted.TargetPath != converted.SourcePath
+		if staged && converted.Status != "failed" && converted.TargetPath == converted.SourcePath {
+			// 原位替换：内容与下载时不同才需要上传（无法优化时源文件保持不变）
+			checksum, err := fileChecksum(converted.SourcePath)
+			if err != nil {
+				result.Status, result.Message = "failed", fmt.Sprintf("读取输出文件失败: %v", err)
+			} else if checksum != downloaded[converted.SourcePath] {
+				output, result.Replaced = true, true
+			}
+		}
+		if output {
+			if err := w.attachOutput(leaseCtx, lease, &result, converted.TargetPath, staged); err != nil {
+				if errors.Is(err, errLeaseLost) {
+					logger.Warn("租约已失效，放弃结果")
+					return
+				}
+				result.Status, result.Message = "failed", err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+	w.complete(ctx, lease, results, logger)
+}
+
+// heartbeat 每隔三分之一租约时长续约，租约失效时取消转换
+func (w *Worker) heartbeat(ctx context.Context, lease *Lease, cancel context.CancelFunc, logger *zap.Logger) {
+	interval := max(lease.TTL/3, 10*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		resp, err := w.postJSON(ctx, "/leases/"+lease.ID+"/heartbeat", nil)
+		if err != nil {
+			logger.Warn("心跳失败", zap.Error(err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			logger.Warn("租约已被重新分配，停止转换")
+			cancel()
+			return
+		}
+	}
+}
+
+// download 下载单元中的源文件并按 trailer 中的 SHA-256 校验，返回本机路径及其 SHA-256
+func (w *Worker) download(ctx context.Context, lease *Lease, workDir string) ([]string, []string, error) {
+	paths := make([]string, len(lease.Members))
+	checksums := make([]string, len(lease.Members))
+	for i, member := range lease.Members {
+		// 每个文件单独一个子目录，保留原文件名（扩展名决定转换方式）
+		dir := filepath.Join(workDir, fmt.Sprint(i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+		paths[i] = filepath.Join(dir, filepath.Base(member))
+		checksum, err := w.downloadFile(ctx, lease, i, paths[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("下载 %s 失败: %w", filepath.Base(member), err)
+		}
+		checksums[i] = checksum
+	}
+	return paths, checksums, nil
+}
+
+func (w *Worker) downloadFile(ctx context.Context, lease *Lease, index int, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/leases/%s/files/%d", w.opts.Coordinator, lease.ID, index), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err := errors.Join(copyErr, file.Close()); err != nil {
+		return "", err
+	}
+	expected := resp.Trailer.Get(ChecksumHeader)
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if expected == "" || actual != expected {
+		return "", fmt.Errorf("校验和不一致: 期望 %q，实际 %s", expected, actual)
+	}
+	return actual, nil
+}
+
+// attachOutput 直接在共享文件系统上转换时附带输出文件的 SHA-256；否则上传输出文件，校验失败时重试
+func (w *Worker) attachOutput(ctx context.Context, lease *Lease, result *Result, targetPath string, staged bool) error {
+	checksum, err := fileChecksum(targetPath)
+	if err != nil {
+		return fmt.Errorf("读取输出文件失败: %w", err)
+	}
+	result.Checksum = checksum
+	if !staged {
+		result.TargetPath = targetPath
+		return nil
+	}
+
+	index := -1
+	for i, member := range lease.Members {
+		if member == result.Source {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("结果不属于该租约: %s", result.Source)
+	}
+
+	name := filepath.Base(targetPath)
+	for attempt := 1; ; attempt++ {
+		err = w.upload(ctx, lease, index, name, targetPath, checksum)
+		if err == nil || errors.Is(err, errLeaseLost) || attempt >= uploadAttempts {
+			break
+		}
+		w.logger.Warn("上传输出文件失败，重试", zap.String("file", name), zap.Int("attempt", attempt), zap.Error(err))
+	}
+	if err != nil {
+		return err
+	}
+	result.Output = name
+	return nil
+}
+
+func (w *Worker) upload(ctx context.Context, lease *Lease, index int, name, path, checksum string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	endpoint := fmt.Sprintf("%s/leases/%s/outputs/%d?name=%s", w.opts.Coordinator, lease.ID, index, url.QueryEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(ChecksumHeader, checksum)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusGone:
+		return errLeaseLost
+	default:
+		return responseError(resp)
+	}
+}
+
+// complete 提交结果
+func (w *Worker) complete(ctx context.Context, lease *Lease, results []Result, logger *zap.Logger) {
+	resp, err := w.postJSON(ctx, "/leases/"+lease.ID+"/complete", CompleteRequest{Results: results})
+	if err != nil {
+		logger.Warn("提交结果失败", zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("提交结果被拒绝", zap.Error(responseError(resp)))
+		return
+	}
+	logger.Info("已提交转换结果", zap.Int("files", len(results)))
+}
+
+func (w *Worker) postJSON(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.Coordinator+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return w.opts.Client.Do(req)
+}
+
+// localizeUnit 把单元中的源文件路径替换为本机下载的路径
+func localizeUnit(unit engine.QueuedUnit, members, paths []string) engine.QueuedUnit {
+	mapping := make(map[string]string, len(members))
+	for i, member := range members {
+		mapping[member] = paths[i]
+	}
+	localized := engine.QueuedUnit{Tasks: make([]engine.ConversionTask, len(unit.Tasks))}
+	for i, task := range unit.Tasks {
+		task.SourcePath = mapping[task.SourcePath]
+		task.TargetPath = ""
+		localized.Tasks[i] = task
+	}
+	if unit.Pair != nil {
+		pair := *unit.Pair
+		pair.StillPath, pair.VideoPath = mapping[pair.StillPath], mapping[pair.VideoPath]
+		localized.Pair = &pair
+	}
+	return localized
+}
+
+// replacesSource 单元中是否有原位替换源文件的任务
+func replacesSource(unit engine.QueuedUnit) bool {
+	for _, task := range unit.Tasks {
+		if engine.ReplacesSource(task) {
+			return true
+		}
+	}
+	return false
+}
+
+func failedResults(lease *Lease, message string) []Result {
+	results := make([]Result, len(lease.Members))
+	for i, member := range lease.Members {
+		results[i] = Result{Source: member, Status: "failed", Message: message}
+	}
+	return results
+}
+
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Error == "" {
+		body.Error = resp.Status
+	}
+	return fmt.Errorf("协调节点返回 %d: %s", resp.StatusCode, body.Error)
+}
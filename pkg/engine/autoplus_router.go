@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"pixly/pkg/core/types"
 	"pixly/pkg/engine/quality"
+	"pixly/pkg/scanner"
 	"pixly/pkg/ui/interactive"
 
 	"go.uber.org/zap"
@@ -35,6 +37,9 @@ type AutoPlusRouter struct {
 	toolPaths        types.ToolCheckResults
 	debugMode        bool
 	routingStats     *RoutingStatistics
+	statsMutex       sync.Mutex         // 保护 RouteFile 并发累加统计
+	rules            *RoutingRuleSet    // 用户路由规则，优先于内置路由
+	scanIndex        *scanner.ScanIndex // 持久化扫描索引，未变化的文件深度分析时复用品质评估
 }
 
 // RoutingStatistics 路由统计
@@ -44,6 +49,7 @@ type RoutingStatistics struct {
 	DeepAnalyzedFiles int                               `json:"deep_analyzed_files"`
 	CorruptedFiles    int                               `json:"corrupted_files"`
 	LowQualityFiles   int                               `json:"low_quality_files"`
+	RuleHits          map[string]int                    `json:"rule_hits"` // 规则名 → 命中次数
 	RoutingDecisions  map[string]*types.RoutingDecision `json:"routing_decisions"`
 	ProcessingTime    time.Duration                     `json:"processing_time"`
 }
@@ -69,6 +75,7 @@ func NewAutoPlusRouter(logger *zap.Logger, qualityEngine *quality.QualityEngine,
 		toolPaths:        toolPaths,
 		debugMode:        debugMode,
 		routingStats: &RoutingStatistics{
+			RuleHits:         make(map[string]int),
 			RoutingDecisions: make(map[string]*types.RoutingDecision),
 		},
 	}
@@ -85,6 +92,7 @@ func (apr *AutoPlusRouter) RouteFiles(ctx context.Context, filePaths []string) (
 	// README要求：95%文件快速预判+5%可疑文件深度验证
 	fastRoutedCount := 0
 	deepAnalyzedCount := 0
+	ruleHits := make(map[string]int)
 
 	for i, filePath := range filePaths {
 		apr.logger.Debug("路由文件",
@@ -92,31 +100,15 @@ func (apr *AutoPlusRouter) RouteFiles(ctx context.Context, filePaths []string) (
 			zap.Int("progress", i+1),
 			zap.Int("total", len(filePaths)))
 
-		// 快速预判阶段
-		if decision := apr.fastRouting(filePath); decision != nil {
-			decisions[filePath] = decision
+		decision, deep := apr.routeOne(ctx, filePath)
+		decisions[filePath] = decision
+		ruleHits[decision.Rule]++
+		if deep {
+			deepAnalyzedCount++
+		} else {
 			fastRoutedCount++
-
-			// 检查是否为低质量文件
-			if decision.QualityLevel == types.QualityVeryLow {
-				lowQualityFiles = append(lowQualityFiles, filePath)
-			}
-			continue
 		}
 
-		// 深度验证阶段（约5%的可疑文件）
-		decision, err := apr.deepAnalysis(ctx, filePath)
-		if err != nil {
-			apr.logger.Warn("深度分析失败",
-				zap.String("file", filepath.Base(filePath)),
-				zap.Error(err))
-			// 使用默认决策
-			decision = apr.createDefaultDecision(filePath)
-		}
-
-		decisions[filePath] = decision
-		deepAnalyzedCount++
-
 		// 检查是否为低质量文件
 		if decision.QualityLevel == types.QualityVeryLow {
 			lowQualityFiles = append(lowQualityFiles, filePath)
@@ -128,6 +120,7 @@ func (apr *AutoPlusRouter) RouteFiles(ctx context.Context, filePaths []string) (
 	apr.routingStats.FastRoutedFiles = fastRoutedCount
 	apr.routingStats.DeepAnalyzedFiles = deepAnalyzedCount
 	apr.routingStats.LowQualityFiles = len(lowQualityFiles)
+	apr.routingStats.RuleHits = ruleHits
 	apr.routingStats.RoutingDecisions = decisions
 	apr.routingStats.ProcessingTime = time.Since(startTime)
 
@@ -141,6 +134,102 @@ func (apr *AutoPlusRouter) RouteFiles(ctx context.Context, filePaths []string) (
 	return decisions, lowQualityFiles, nil
 }
 
+// RouteFile 路由单个文件并累加统计，供流式管道的多个工作协程并发调用
+// 为避免内存随文件数增长，逐个路由时不在统计中保留每个文件的决策
+func (apr *AutoPlusRouter) RouteFile(ctx context.Context, filePath string) *types.RoutingDecision {
+	startTime := time.Now()
+	decision, deep := apr.routeOne(ctx, filePath)
+
+	apr.statsMutex.Lock()
+	defer apr.statsMutex.Unlock()
+
+	apr.routingStats.TotalFiles++
+	apr.routingStats.RuleHits[decision.Rule]++
+	if deep {
+		apr.routingStats.DeepAnalyzedFiles++
+	} else {
+		apr.routingStats.FastRoutedFiles++
+	}
+	if decision.QualityLevel == types.QualityVeryLow {
+		apr.routingStats.LowQualityFiles++
+	}
+	apr.routingStats.ProcessingTime += time.Since(startTime)
+
+	return decision
+}
+
+// routeOne 内置路由后按用户规则覆盖；deep 表示使用了深度分析
+func (apr *AutoPlusRouter) routeOne(ctx context.Context, filePath string) (decision *types.RoutingDecision, deep bool) {
+	decision, deep = apr.builtinRoute(ctx, filePath)
+	decision.Rule = BuiltinRoutingRule
+
+	if apr.rules == nil {
+		return decision, deep
+	}
+	facts := CollectRoutingFacts(ctx, filePath, decision.QualityLevel, apr.rules, apr.exiftoolPath())
+	factValues := map[string]interface{}{
+		"ext":           facts.Ext,
+		"size":          facts.Size,
+		"width":         measured(facts.Width, facts.Width > 0),
+		"height":        measured(facts.Height, facts.Height > 0),
+		"bit_depth":     measured(facts.BitDepth, facts.BitDepth > 0),
+		"quality_level": facts.QualityLevel.String(),
+	}
+	if facts.Alpha != nil {
+		factValues["alpha"] = fmt.Sprint(*facts.Alpha)
+	}
+	if facts.Animated != nil {
+		factValues["animated"] = fmt.Sprint(*facts.Animated)
+	}
+	for tag, value := range facts.Exif {
+		factValues["exif:"+tag] = value
+	}
+
+	if rule := apr.rules.Match(facts); rule != nil {
+		apr.logger.Debug("路由规则命中",
+			zap.String("file", filepath.Base(filePath)),
+			zap.String("rule", rule.Name),
+			zap.String("action", rule.Action.Type),
+			zap.String("format", rule.Action.Format))
+		trace := decision.Trace
+		decision = rule.Decision(decision.QualityLevel)
+		decision.Trace = trace
+		addRoutingTrace(decision, types.DecisionStageRoutingRule, rule.Name, factValues, "")
+		return decision, deep
+	}
+	addRoutingTrace(decision, types.DecisionStageRoutingRule, "未命中任何规则，使用内置路由", factValues, "")
+	return decision, deep
+}
+
+// builtinRoute 快速预判，无法预判时深度验证
+func (apr *AutoPlusRouter) builtinRoute(ctx context.Context, filePath string) (decision *types.RoutingDecision, deep bool) {
+	// 快速预判阶段
+	if decision := apr.fastRouting(filePath); decision != nil {
+		if len(decision.Trace) == 0 {
+			addRoutingTrace(decision, types.DecisionStageRouting, decision.Reason, map[string]interface{}{
+				"ext":  strings.ToLower(filepath.Ext(filePath)),
+				"name": filepath.Base(filePath),
+			}, "按扩展名或文件名（screenshot/屏幕截图、emoji/sticker）快速预判")
+		}
+		return decision, false
+	}
+
+	// 深度验证阶段（约5%的可疑文件）
+	decision, err := apr.deepAnalysis(ctx, filePath)
+	if err != nil {
+		apr.logger.Warn("深度分析失败",
+			zap.String("file", filepath.Base(filePath)),
+			zap.Error(err))
+		// 使用默认决策
+		decision = apr.createDefaultDecision(filePath)
+		addRoutingTrace(decision, types.DecisionStageRouting, decision.Reason, map[string]interface{}{
+			"ext":   strings.ToLower(filepath.Ext(filePath)),
+			"error": err.Error(),
+		}, "深度分析失败时按扩展名保守路由")
+	}
+	return decision, true
+}
+
 // fastRouting 快速路由 - 95%文件的快速预判
 func (apr *AutoPlusRouter) fastRouting(filePath string) *types.RoutingDecision {
 	ext := strings.ToLower(filepath.Ext(filePath))
@@ -155,9 +244,24 @@ func (apr *AutoPlusRouter) fastRouting(filePath string) *types.RoutingDecision {
 	// README要求的自动模式+路由逻辑
 	switch ext {
 	case ".jpg", ".jpeg", ".jpe", ".jfif":
-		// JPEG系列 -> JXL (lossless_jpeg=1)
+		// JPEG系列 -> JXL (lossless_jpeg=1)，品质等级来自量化表
+		header, err := quality.ParseJpegFile(filePath)
+		if err != nil {
+			// 头部无法解析的JPEG可能已损坏，交给深度分析
+			return nil
+		}
 		decision.TargetFormat = "jxl"
-		decision.QualityLevel = types.QualityMediumHigh
+		decision.QualityLevel = quality.ClassifyJpegQuality(header.EstimatedQuality, header.LikelyResaved)
+		decision.Reason = fmt.Sprintf("fast_routing_jpeg_q%d", header.EstimatedQuality)
+		if header.LikelyResaved {
+			decision.Reason += "_resaved"
+		}
+		addRoutingTrace(decision, types.DecisionStageRouting, "fast_routing_jpeg", map[string]interface{}{
+			"jpeg_quality":   header.EstimatedQuality,
+			"jpeg_resaved":   header.LikelyResaved,
+			"resave_signals": strings.Join(header.ResaveSignals, ","),
+			"quality_level":  decision.QualityLevel.String(),
+		}, quality.JpegQualityThresholds)
 		return decision
 
 	case ".png":
@@ -221,7 +325,7 @@ func (apr *AutoPlusRouter) deepAnalysis(ctx context.Context, filePath string) (*
 	apr.logger.Debug("开始深度分析", zap.String("file", filepath.Base(filePath)))
 
 	// 使用质量评估引擎进行深度分析
-	assessment, err := apr.qualityEngine.AssessFile(ctx, filePath)
+	assessment, err := apr.assess(ctx, filePath)
 	if err != nil {
 		return nil, fmt.Errorf("质量评估失败: %w", err)
 	}
@@ -278,6 +382,17 @@ func (apr *AutoPlusRouter) deepAnalysis(ctx context.Context, filePath string) (*
 		decision = apr.createDefaultDecision(filePath)
 	}
 
+	thresholds, _ := assessment.Details["thresholds"].(string)
+	classifiedBy, _ := assessment.Details["classified_by"].(string)
+	addRoutingTrace(decision, types.DecisionStageRouting, decision.Reason, map[string]interface{}{
+		"media_type":    assessment.MediaType.String(),
+		"quality_level": assessment.QualityLevel.String(),
+		"classified_by": measured(classifiedBy, classifiedBy != ""),
+		"score":         assessment.Score,
+		"pixel_density": measured(assessment.PixelDensity, assessment.Width > 0 && assessment.Height > 0),
+		"jpeg_quality":  measured(assessment.JpegQuality, assessment.JpegQuality > 0),
+	}, thresholds)
+
 	apr.logger.Debug("深度分析完成",
 		zap.String("file", filepath.Base(filePath)),
 		zap.String("quality", assessment.QualityLevel.String()),
@@ -287,6 +402,40 @@ func (apr *AutoPlusRouter) deepAnalysis(ctx context.Context, filePath string) (*
 	return decision, nil
 }
 
+// assess 评估文件品质；文件自上次评估后未变化时复用扫描索引中的结果，否则评估后写入索引
+func (apr *AutoPlusRouter) assess(ctx context.Context, filePath string) (*quality.QualityAssessment, error) {
+	var fingerprint *scanner.FileFingerprint
+	if apr.scanIndex != nil {
+		var entry *scanner.ScanIndexEntry
+		entry, fingerprint = apr.scanIndex.LookupFile(filePath)
+		if entry != nil && entry.Quality != nil {
+			return entry.Quality, nil
+		}
+	}
+
+	assessment, err := apr.qualityEngine.AssessFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint != nil {
+		if err := apr.scanIndex.Store(filePath, &scanner.ScanIndexEntry{Fingerprint: *fingerprint, Quality: assessment}); err != nil {
+			apr.logger.Debug("写入扫描索引失败", zap.String("file", filepath.Base(filePath)), zap.Error(err))
+		}
+	}
+	return assessment, nil
+}
+
+// addRoutingTrace 在路由决策的轨迹中追加一条记录，结果为决策的策略和目标格式
+func addRoutingTrace(decision *types.RoutingDecision, stage, branch string, values map[string]interface{}, thresholds string) {
+	outcome := decision.Strategy
+	if decision.TargetFormat != "" {
+		outcome += " → " + decision.TargetFormat
+	}
+	trace := &decisionTrace{records: decision.Trace}
+	trace.add(stage, branch, outcome, values, thresholds)
+	decision.Trace = trace.records
+}
+
 // createDefaultDecision 创建默认决策
 func (apr *AutoPlusRouter) createDefaultDecision(filePath string) *types.RoutingDecision {
 	ext := strings.ToLower(filepath.Ext(filePath))
@@ -318,17 +467,24 @@ func (apr *AutoPlusRouter) GenerateRoutingReport(decisions map[string]*types.Rou
 	totalFiles := len(decisions)
 	convertCount := 0
 	skipCount := 0
+	keepCount := 0
 	deleteCount := 0
 
 	formatCounts := make(map[string]int)
+	ruleCounts := make(map[string]int)
 
 	for _, decision := range decisions {
+		if decision.Rule != "" && decision.Rule != BuiltinRoutingRule {
+			ruleCounts[decision.Rule]++
+		}
 		switch decision.Strategy {
 		case "convert":
 			convertCount++
 			formatCounts[decision.TargetFormat]++
 		case "skip":
 			skipCount++
+		case "keep":
+			keepCount++
 		case "delete":
 			deleteCount++
 		}
@@ -338,6 +494,9 @@ func (apr *AutoPlusRouter) GenerateRoutingReport(decisions map[string]*types.Rou
 	report += fmt.Sprintf("📊 总文件数: %d\n", totalFiles)
 	report += fmt.Sprintf("✅ 转换: %d (%.1f%%)\n", convertCount, float64(convertCount)/float64(totalFiles)*100)
 	report += fmt.Sprintf("⏭️ 跳过: %d (%.1f%%)\n", skipCount, float64(skipCount)/float64(totalFiles)*100)
+	if keepCount > 0 {
+		report += fmt.Sprintf("🛡️ 保留原文件: %d (%.1f%%)\n", keepCount, float64(keepCount)/float64(totalFiles)*100)
+	}
 	report += fmt.Sprintf("🗑️ 删除: %d (%.1f%%)\n", deleteCount, float64(deleteCount)/float64(totalFiles)*100)
 
 	if len(formatCounts) > 0 {
@@ -347,6 +506,13 @@ func (apr *AutoPlusRouter) GenerateRoutingReport(decisions map[string]*types.Rou
 		}
 	}
 
+	if apr.rules != nil {
+		report += fmt.Sprintf("\n📜 路由规则命中:\n")
+		for _, rule := range apr.rules.Rules {
+			report += fmt.Sprintf("  %s: %d 个文件\n", rule.Name, ruleCounts[rule.Name])
+		}
+	}
+
 	report += fmt.Sprintf("\n⚡ 路由效率: %.1f%% 快速路由, %.1f%% 深度分析\n",
 		float64(apr.routingStats.FastRoutedFiles)/float64(totalFiles)*100,
 		float64(apr.routingStats.DeepAnalyzedFiles)/float64(totalFiles)*100)
@@ -359,8 +525,33 @@ func (apr *AutoPlusRouter) GetRoutingStatistics() *RoutingStatistics {
 	return apr.routingStats
 }
 
-// SetRoutingRules 设置自定义路由规则（扩展功能）
-func (apr *AutoPlusRouter) SetRoutingRules(rules map[string]string) {
-	// 用于未来扩展自定义路由规则
-	apr.logger.Debug("设置自定义路由规则", zap.Int("rule_count", len(rules)))
+// SetRoutingRules 设置用户路由规则，规则按顺序匹配，未命中时使用内置路由；传入nil时只使用内置路由
+func (apr *AutoPlusRouter) SetRoutingRules(rules *RoutingRuleSet) {
+	apr.rules = rules
+	if rules == nil {
+		return
+	}
+
+	apr.logger.Info("已加载路由规则", zap.Int("rule_count", len(rules.Rules)))
+	if len(rules.exifTags()) > 0 && apr.exiftoolPath() == "" {
+		apr.logger.Warn("exiftool不可用，带EXIF条件的路由规则不会命中")
+	}
+}
+
+// SetScanIndex 设置持久化扫描索引；传入nil时每次深度分析都重新评估
+func (apr *AutoPlusRouter) SetScanIndex(index *scanner.ScanIndex) {
+	apr.scanIndex = index
+}
+
+// RoutingRules 获取当前的用户路由规则
+func (apr *AutoPlusRouter) RoutingRules() *RoutingRuleSet {
+	return apr.rules
+}
+
+// exiftoolPath 读取规则所需EXIF时使用的exiftool路径
+func (apr *AutoPlusRouter) exiftoolPath() string {
+	if !apr.toolPaths.HasExiftool {
+		return ""
+	}
+	return apr.toolPaths.ExiftoolPath
 }
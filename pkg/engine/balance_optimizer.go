@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +20,11 @@ type BalanceOptimizer struct {
 	toolPaths types.ToolCheckResults
 	tempDir   string
 	debugMode bool
+	encoders  *EncoderRegistry
+
+	// 目标质量搜索（为nil时使用多点有损探测）
+	targetQuality *TargetQuality
+	scorer        PerceptualScorer
 }
 
 // OptimizationResult 优化结果
@@ -33,6 +38,22 @@ type OptimizationResult struct {
 	Quality      string // 质量参数
 	ProcessTime  time.Duration
 	Error        error
+
+	// 目标质量搜索结果
+	Metric        string  // 使用的感知指标
+	MetricScore   float64 // 最终输出的指标分数
+	ChosenQuality int     // 搜索选中的编码质量
+	Probes        int     // 探测次数
+}
+
+// TargetQuality 目标质量搜索配置 - 二分搜索使输出达到感知指标目标的最低编码质量
+type TargetQuality struct {
+	Metric     PerceptualMetric
+	Target     float64
+	Format     string // "jxl" 或 "avif"，默认 jxl
+	MinQuality int    // 搜索下限，默认 30
+	MaxQuality int    // 搜索上限，默认 99
+	MaxProbes  int    // 最大探测次数，默认 8
 }
 
 // OptimizationAttempt 单次优化尝试
@@ -50,7 +71,43 @@ func NewBalanceOptimizer(logger *zap.Logger, toolPaths types.ToolCheckResults, t
 		toolPaths: toolPaths,
 		tempDir:   tempDir,
 		debugMode: os.Getenv("PIXLY_DEBUG") == "true",
+		encoders:  NewDefaultEncoderRegistry(toolPaths, nil), // 探测编码不经过进程监控
+		scorer:    NewToolPerceptualScorer(toolPaths, tempDir),
+	}
+}
+
+// SetTargetQuality 启用目标质量搜索；传入nil恢复多点有损探测
+func (bo *BalanceOptimizer) SetTargetQuality(tq *TargetQuality) {
+	if tq != nil {
+		normalized := *tq
+		if normalized.Target == 0 {
+			normalized.Target = normalized.Metric.DefaultTarget()
+		}
+		if normalized.Format == "" {
+			normalized.Format = "jxl"
+		}
+		if normalized.MinQuality <= 0 {
+			normalized.MinQuality = 30
+		}
+		if normalized.MaxQuality <= 0 || normalized.MaxQuality > 100 {
+			normalized.MaxQuality = 99
+		}
+		if normalized.MaxProbes <= 0 {
+			normalized.MaxProbes = 8
+		}
+		tq = &normalized
 	}
+	bo.targetQuality = tq
+}
+
+// SetPerceptualScorer 替换感知分数计算器
+func (bo *BalanceOptimizer) SetPerceptualScorer(scorer PerceptualScorer) {
+	bo.scorer = scorer
+}
+
+// SetEncoderRegistry 替换探测使用的编码器注册表
+func (bo *BalanceOptimizer) SetEncoderRegistry(registry *EncoderRegistry) {
+	bo.encoders = registry
 }
 
 // OptimizeFile 执行平衡优化 - README要求的核心平衡优化逻辑
@@ -119,10 +176,17 @@ func (bo *BalanceOptimizer) OptimizeFile(ctx context.Context, filePath string, m
 		}
 	}
 
-	// 步骤3: 有损探测 - README要求的多点探测
+	// 步骤3: 有损探测 - 启用目标质量时二分搜索，否则使用README要求的多点探测
 	bo.logger.Debug("开始有损探测", zap.String("file", filepath.Base(filePath)))
 
-	bestResult := bo.performMultiPointLossyProbing(ctx, filePath, mediaType, originalSize)
+	var bestResult *OptimizationResult
+	if bo.targetQuality != nil && mediaType == types.MediaTypeImage {
+		bestResult = bo.performTargetQualitySearch(ctx, filePath, originalSize)
+		result.Metric = bestResult.Metric
+		result.Probes = bestResult.Probes
+	} else {
+		bestResult = bo.performMultiPointLossyProbing(ctx, filePath, mediaType, originalSize)
+	}
 	if bestResult != nil && bestResult.Success && bestResult.NewSize < originalSize {
 		bo.logger.Info("有损探测找到最优结果",
 			zap.String("file", filepath.Base(filePath)),
@@ -138,10 +202,17 @@ func (bo *BalanceOptimizer) OptimizeFile(ctx context.Context, filePath string, m
 		result.SpaceSaved = originalSize - bestResult.NewSize
 		result.Method = bestResult.Method
 		result.Quality = bestResult.Quality
+		result.MetricScore = bestResult.MetricScore
+		result.ChosenQuality = bestResult.ChosenQuality
 		result.ProcessTime = time.Since(startTime)
 		return result, nil
 	}
 
+	// 目标质量搜索产生的输出未能减小体积时清理
+	if bestResult != nil && bestResult.Success {
+		os.Remove(bestResult.OutputPath)
+	}
+
 	// 步骤4: 无法优化处理
 	bo.logger.Info("无法找到有效的优化方案",
 		zap.String("file", filepath.Base(filePath)),
@@ -149,6 +220,9 @@ func (bo *BalanceOptimizer) OptimizeFile(ctx context.Context, filePath string, m
 
 	result.Success = false
 	result.Error = fmt.Errorf("所有优化尝试均无法减小文件体积")
+	if bo.targetQuality != nil && bestResult != nil && bestResult.Error != nil {
+		result.Error = fmt.Errorf("目标质量搜索未成功: %w", bestResult.Error)
+	}
 	result.ProcessTime = time.Since(startTime)
 	return result, nil
 }
@@ -168,32 +242,14 @@ func (bo *BalanceOptimizer) tryLosslessRepack(ctx context.Context, filePath stri
 
 // tryJXLLosslessRepack 尝试JXL无损重新包装
 func (bo *BalanceOptimizer) tryJXLLosslessRepack(ctx context.Context, filePath string) *OptimizationResult {
-	outputPath := bo.generateTempPath(filePath, ".jxl")
-
 	// 使用cjxl的lossless_jpeg=1参数进行无损重新包装
-	cmd := exec.CommandContext(ctx, bo.toolPaths.CjxlPath,
-		"-d", "0", // 距离0表示无损
-		"--lossless_jpeg=1", // README要求的无损重新包装参数
-		"-e", "7",           // 默认effort 7
-		filePath,
-		outputPath)
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
-		return &OptimizationResult{Success: false, Error: err}
-	}
-
-	// 检查输出文件
-	if stat, err := os.Stat(outputPath); err == nil {
-		return &OptimizationResult{
-			Success:    true,
-			OutputPath: outputPath,
-			NewSize:    stat.Size(),
-		}
-	}
-
-	os.Remove(outputPath)
-	return &OptimizationResult{Success: false}
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderCjxl), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".jxl"),
+		OutputFormat: "jxl",
+		LosslessJPEG: true, // README要求的无损重新包装参数
+		Effort:       7,    // 默认effort 7
+	})
 }
 
 // tryMathematicalLossless 尝试数学无损压缩
@@ -206,31 +262,14 @@ func (bo *BalanceOptimizer) tryMathematicalLossless(ctx context.Context, filePat
 
 // tryJXLMathematicalLossless 尝试JXL数学无损压缩
 func (bo *BalanceOptimizer) tryJXLMathematicalLossless(ctx context.Context, filePath string) *OptimizationResult {
-	outputPath := bo.generateTempPath(filePath, ".jxl")
-
-	// 使用标准的数学无损压缩（距离=0）
-	cmd := exec.CommandContext(ctx, bo.toolPaths.CjxlPath,
-		"-d", "0", // 距离0表示无损
-		"-e", "7", // 默认effort 7
-		filePath,
-		outputPath)
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
-		return &OptimizationResult{Success: false, Error: err}
-	}
-
-	// 检查输出文件
-	if stat, err := os.Stat(outputPath); err == nil {
-		return &OptimizationResult{
-			Success:    true,
-			OutputPath: outputPath,
-			NewSize:    stat.Size(),
-		}
-	}
-
-	os.Remove(outputPath)
-	return &OptimizationResult{Success: false}
+	// 使用标准的数学无损压缩
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderCjxl), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".jxl"),
+		OutputFormat: "jxl",
+		Lossless:     true,
+		Effort:       7, // 默认effort 7
+	})
 }
 
 // performMultiPointLossyProbing 执行多点有损探测 - README要求的核心逻辑优化
@@ -302,6 +341,125 @@ func (bo *BalanceOptimizer) performMultiPointLossyProbing(ctx context.Context, f
 	return bestResult
 }
 
+// performTargetQualitySearch 二分搜索满足感知目标的最低编码质量
+// 假设编码质量越高感知分数越好，每次达标后继续向更低质量搜索以获得更小的体积
+func (bo *BalanceOptimizer) performTargetQualitySearch(ctx context.Context, filePath string, originalSize int64) *OptimizationResult {
+	tq := bo.targetQuality
+	searchResult := &OptimizationResult{Metric: string(tq.Metric)}
+
+	// 没有可用的指标工具时不做有损转换，以保证质量承诺
+	if bo.scorer == nil || !bo.scorer.Available(tq.Metric) {
+		bo.logger.Warn("感知指标工具不可用，跳过有损转换",
+			zap.String("file", filepath.Base(filePath)),
+			zap.String("metric", string(tq.Metric)))
+		searchResult.Error = fmt.Errorf("感知指标%s不可用", tq.Metric)
+		return searchResult
+	}
+
+	var best *OptimizationResult
+	lo, hi := tq.MinQuality, tq.MaxQuality
+	for lo <= hi && searchResult.Probes < tq.MaxProbes {
+		if ctx.Err() != nil {
+			break
+		}
+
+		quality := (lo + hi) / 2
+		probe := bo.encodeAtQuality(ctx, filePath, tq.Format, quality)
+		searchResult.Probes++
+		if !probe.Success {
+			bo.logger.Debug("目标质量探测编码失败",
+				zap.String("file", filepath.Base(filePath)),
+				zap.Int("quality", quality),
+				zap.Error(probe.Error))
+			searchResult.Error = probe.Error
+			break
+		}
+
+		score, err := bo.scorer.Score(ctx, tq.Metric, filePath, probe.OutputPath)
+		if err != nil {
+			os.Remove(probe.OutputPath)
+			searchResult.Error = err
+			break
+		}
+
+		bo.logger.Debug("目标质量探测结果",
+			zap.String("file", filepath.Base(filePath)),
+			zap.Int("quality", quality),
+			zap.String("metric", string(tq.Metric)),
+			zap.Float64("score", score),
+			zap.Int64("size", probe.NewSize))
+
+		if tq.Metric.Meets(score, tq.Target) {
+			if best != nil {
+				os.Remove(best.OutputPath)
+			}
+			best = probe
+			best.ChosenQuality = quality
+			best.MetricScore = score
+			hi = quality - 1
+		} else {
+			os.Remove(probe.OutputPath)
+			lo = quality + 1
+		}
+	}
+
+	if best == nil {
+		if searchResult.Error == nil {
+			searchResult.Error = fmt.Errorf("质量范围%d-%d内没有达到%s≥%.3g的结果", tq.MinQuality, tq.MaxQuality, tq.Metric, tq.Target)
+		}
+		return searchResult
+	}
+
+	best.Method = "target_quality_" + tq.Format
+	best.Quality = strconv.Itoa(best.ChosenQuality)
+	best.Metric = searchResult.Metric
+	best.Probes = searchResult.Probes
+
+	bo.logger.Info("目标质量搜索完成",
+		zap.String("file", filepath.Base(filePath)),
+		zap.String("metric", best.Metric),
+		zap.Float64("score", best.MetricScore),
+		zap.Int("quality", best.ChosenQuality),
+		zap.Int("probes", best.Probes),
+		zap.Int64("original_size", originalSize),
+		zap.Int64("new_size", best.NewSize))
+
+	return best
+}
+
+// encodeAtQuality 以指定质量编码一次探测输出
+func (bo *BalanceOptimizer) encodeAtQuality(ctx context.Context, filePath, format string, quality int) *OptimizationResult {
+	ext := filepath.Ext(filePath)
+	if format == "avif" {
+		return bo.runProbe(ctx, bo.encoders.ChainFor(ext, "avif"), &EncodeJob{
+			SourcePath:   filePath,
+			TargetPath:   bo.generateTempPath(filePath, ".avif"),
+			OutputFormat: "avif",
+			Quality:      quality,
+			Speed:        6,
+			VideoCodec:   "libaom-av1",
+			CRF:          qualityToCRF(quality),
+		})
+	}
+
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderCjxl), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".jxl"),
+		OutputFormat: "jxl",
+		Quality:      quality,
+		Effort:       7,
+	})
+}
+
+// qualityToCRF 将0-100质量映射到AV1的0-63 CRF
+func qualityToCRF(quality int) int {
+	crf := (100 - quality) * 63 / 100
+	if crf < 1 {
+		crf = 1
+	}
+	return crf
+}
+
 // generateSmartQualityAttempts 生成智能质量点尝试组合
 func (bo *BalanceOptimizer) generateSmartQualityAttempts(mediaType types.MediaType, fileSizeMB float64) []OptimizationAttempt {
 	var attempts []OptimizationAttempt
@@ -345,91 +503,58 @@ func (bo *BalanceOptimizer) generateSmartQualityAttempts(mediaType types.MediaTy
 
 // tryWebPLossyCompression 尝试WebP有损压缩
 func (bo *BalanceOptimizer) tryWebPLossyCompression(ctx context.Context, filePath string, params map[string]string) *OptimizationResult {
-	outputPath := bo.generateTempPath(filePath, ".webp")
-	quality := params["quality"]
+	quality, _ := strconv.Atoi(params["quality"])
 
 	// 使用FFmpeg进行WebP压缩
-	cmd := exec.CommandContext(ctx, bo.toolPaths.FfmpegStablePath,
-		"-i", filePath,
-		"-c:v", "libwebp",
-		"-quality", quality,
-		"-y",
-		outputPath)
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
-		return &OptimizationResult{Success: false, Error: err}
-	}
-
-	if stat, err := os.Stat(outputPath); err == nil {
-		return &OptimizationResult{
-			Success:    true,
-			OutputPath: outputPath,
-			NewSize:    stat.Size(),
-		}
-	}
-
-	os.Remove(outputPath)
-	return &OptimizationResult{Success: false}
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderFfmpegStable), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".webp"),
+		OutputFormat: "webp",
+		Quality:      quality,
+	})
 }
 
 // tryJXLLossyCompression 尝试JXL有损压缩
 func (bo *BalanceOptimizer) tryJXLLossyCompression(ctx context.Context, filePath string, params map[string]string) *OptimizationResult {
-	outputPath := bo.generateTempPath(filePath, ".jxl")
-	distance := params["distance"]
-
-	cmd := exec.CommandContext(ctx, bo.toolPaths.CjxlPath,
-		"-d", distance,
-		"-e", "7", // 固定effort
-		filePath,
-		outputPath)
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
-		return &OptimizationResult{Success: false, Error: err}
-	}
-
-	if stat, err := os.Stat(outputPath); err == nil {
-		return &OptimizationResult{
-			Success:    true,
-			OutputPath: outputPath,
-			NewSize:    stat.Size(),
-		}
-	}
-
-	os.Remove(outputPath)
-	return &OptimizationResult{Success: false}
+	distance, _ := strconv.ParseFloat(params["distance"], 64)
+
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderCjxl), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".jxl"),
+		OutputFormat: "jxl",
+		Distance:     distance,
+		Effort:       7, // 固定effort
+	})
 }
 
 // tryAVIFLossyCompression 尝试AVIF有损压缩
 func (bo *BalanceOptimizer) tryAVIFLossyCompression(ctx context.Context, filePath string, params map[string]string) *OptimizationResult {
-	outputPath := bo.generateTempPath(filePath, ".avif")
-	quality := params["quality"]
+	crf, _ := strconv.Atoi(params["crf"])
 
 	// 使用FFmpeg进行AVIF压缩
-	cmd := exec.CommandContext(ctx, bo.toolPaths.FfmpegStablePath,
-		"-i", filePath,
-		"-c:v", "libaom-av1",
-		"-crf", quality,
-		"-cpu-used", "6", // 平衡速度和质量
-		"-y",
-		outputPath)
-
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
+	return bo.runProbe(ctx, bo.encoders.Chain(EncoderFfmpegStable), &EncodeJob{
+		SourcePath:   filePath,
+		TargetPath:   bo.generateTempPath(filePath, ".avif"),
+		OutputFormat: "avif",
+		VideoCodec:   "libaom-av1",
+		CRF:          crf,
+		Speed:        6, // 平衡速度和质量
+	})
+}
+
+// runProbe 通过编码器后备链执行一次探测编码
+func (bo *BalanceOptimizer) runProbe(ctx context.Context, chain []Encoder, job *EncodeJob) *OptimizationResult {
+	result, err := RunEncoderChain(ctx, bo.logger, chain, job)
+	if err != nil {
+		os.Remove(job.TargetPath)
 		return &OptimizationResult{Success: false, Error: err}
 	}
 
-	if stat, err := os.Stat(outputPath); err == nil {
-		return &OptimizationResult{
-			Success:    true,
-			OutputPath: outputPath,
-			NewSize:    stat.Size(),
-		}
+	return &OptimizationResult{
+		Success:    true,
+		OutputPath: result.OutputPath,
+		NewSize:    result.OutputSize,
 	}
-
-	os.Remove(outputPath)
-	return &OptimizationResult{Success: false}
 }
 
 // generateTempPath 生成临时文件路径
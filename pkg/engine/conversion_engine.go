@@ -3,20 +3,24 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"pixly/pkg/core/config"
 	"pixly/pkg/core/state"
 	"pixly/pkg/core/types"
 	"pixly/pkg/engine/quality"
+	"pixly/pkg/ffmpegrouter"
 	"pixly/pkg/metamigrator"
+	"pixly/pkg/metrics"
 	"pixly/pkg/processmonitor"
+	"pixly/pkg/scanner"
 	"pixly/pkg/ui/interactive"
 	"pixly/pkg/ui/progress"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -36,6 +40,21 @@ type ConversionEngine struct {
 	cacheDir         string                         // 缓存目录
 	stateManager     *state.StateManager            // 状态管理器（断点续传）
 	processMonitor   *processmonitor.ProcessMonitor // 进程监控器（防卡死机制）
+	encoders         *EncoderRegistry               // 编码器注册表（后备链）
+	jpegVerifier     *JPEGReconstructionVerifier    // JPEG无损转码逐位重建校验
+	videoTranscoder  *VideoTranscodeMode            // 视频转码（为nil时视频只重包装）
+	livePhotoPairer  *LivePhotoPairer               // Live Photo 配对识别与配对信息保留
+	scanIndex        *scanner.ScanIndex             // 持久化扫描索引（未变化的文件跳过重复评估）
+	routingRulesErr  error                          // 路由规则文件加载失败的原因，执行前报告
+	pause            pauseGate                      // 暂停控制（HTTP 任务接口）
+	htmlReport       string                         // HTML 运行报告路径（为空时不生成）
+	reportThumbnails int                            // HTML 报告中前后对比缩略图的最大组数
+	runReport        *runReport                     // 本次运行为 HTML 报告收集的数据
+
+	reconstructionPassed atomic.Int64 // JPEG重建校验通过数
+	reconstructionKept   atomic.Int64 // JPEG重建校验未通过、保留原文件数
+	livePhotoPaired      atomic.Int64 // Live Photo 成对转换完成数
+	livePhotoRolledBack  atomic.Int64 // Live Photo 因任一半失败而整体回滚数
 }
 
 // InitStateManager 初始化状态管理器
@@ -51,6 +70,30 @@ func (e *ConversionEngine) InitStateManager() error {
 	return nil
 }
 
+// SetStateManager 使用外部打开的状态数据库（同一进程内多个引擎共用，bbolt 不允许重复打开）
+// 外部设置的状态管理器由调用方关闭
+func (e *ConversionEngine) SetStateManager(stateManager *state.StateManager) {
+	e.stateManager = stateManager
+}
+
+// openState 打开状态数据库，扫描索引与状态共用同一个bbolt数据库，跨运行保留
+// 返回状态数据库是否由本次调用打开（需要由调用方关闭）
+func (e *ConversionEngine) openState() bool {
+	opened := false
+	if e.stateManager == nil {
+		opened = e.InitStateManager() == nil
+	}
+	if e.scanIndex == nil && e.stateManager != nil {
+		e.scanIndex = scanner.NewScanIndex(e.logger, e.stateManager)
+		// 路由深度分析与 Live Photo 配对的输入同样按文件指纹缓存
+		e.autoPlusRouter.SetScanIndex(e.scanIndex)
+		if e.livePhotoPairer != nil {
+			e.livePhotoPairer.SetScanIndex(e.scanIndex)
+		}
+	}
+	return opened
+}
+
 // SaveState 保存状态到缓存
 func (e *ConversionEngine) SaveState(filename string, data interface{}) error {
 	if e.stateManager == nil {
@@ -179,16 +222,52 @@ func NewConversionEngine(logger *zap.Logger, modularCfg *config.Config, toolResu
 
 	// 创建平衡优化器
 	balanceOpt := NewBalanceOptimizer(logger, toolResults, tempDir)
+	if modularCfg.TargetMetric != "" {
+		if metric, err := ParsePerceptualMetric(modularCfg.TargetMetric); err == nil {
+			balanceOpt.SetTargetQuality(&TargetQuality{Metric: metric, Target: modularCfg.TargetScore})
+		} else {
+			logger.Warn("目标质量指标无效，使用多点有损探测", zap.Error(err))
+		}
+	}
 
 	// 创建自动模式+路由器
 	autoPlusRtr := NewAutoPlusRouter(logger, qualityEng, balanceOpt, uiInterface, toolResults, false)
 
+	// 路由规则文件无效时拒绝执行，避免按错误的策略处理整个目录
+	var routingRulesErr error
+	if modularCfg.RoutingRulesFile != "" {
+		if rules, err := LoadRoutingRules(modularCfg.RoutingRulesFile); err != nil {
+			routingRulesErr = err
+		} else {
+			autoPlusRtr.SetRoutingRules(rules)
+		}
+	}
+
 	// 创建进度管理器
 	progressMgr := progress.NewProgressManager(logger)
 
 	// 创建进程监控器（README要求的防卡死机制）
 	procMonitor := processmonitor.NewProcessMonitor(logger, false)
 
+	// 创建编码器注册表（cjxl/avifenc/FFmpeg均通过进程监控器执行）
+	encoders := NewDefaultEncoderRegistry(toolResults, procMonitor)
+
+	// 视频转码：按FFmpeg实际编译的编码器选择AV1/HEVC，路由器不可用时回退到重包装
+	var videoTranscoder *VideoTranscodeMode
+	if modularCfg.VideoMode == "transcode" {
+		if router, err := ffmpegrouter.NewFFmpegRouter(logger, nil); err != nil {
+			logger.Warn("FFmpeg路由器初始化失败，视频仅重包装", zap.Error(err))
+		} else {
+			videoTranscoder = NewVideoTranscodeMode(logger, router, "", procMonitor, VideoTranscodeOptionsFromConfig(modularCfg))
+		}
+	}
+
+	// Live Photo 配对：没有exiftool时只能按文件名配对，无法读写ContentIdentifier
+	exiftoolPath := ""
+	if toolResults.HasExiftool {
+		exiftoolPath = toolResults.ExiftoolPath
+	}
+
 	// 设置缓存目录
 	cacheDir := filepath.Join(modularCfg.TargetDir, ".pixly_cache")
 	os.MkdirAll(cacheDir, 0755)
@@ -205,9 +284,44 @@ func NewConversionEngine(logger *zap.Logger, modularCfg *config.Config, toolResu
 		cacheDir:         cacheDir,
 		stateManager:     nil, // 需要在InitStateManager中初始化
 		processMonitor:   procMonitor,
+		encoders:         encoders,
+		jpegVerifier:     NewJPEGReconstructionVerifier("", tempDir, procMonitor),
+		videoTranscoder:  videoTranscoder,
+		livePhotoPairer:  NewLivePhotoPairer(logger, exiftoolPath),
+		routingRulesErr:  routingRulesErr,
+		htmlReport:       modularCfg.HTMLReport,
+		reportThumbnails: modularCfg.ReportThumbnails,
+	}
+}
+
+// SetEncoderRegistry 替换编码器注册表（用于扩展编码器或在测试中注入假编码器）
+func (e *ConversionEngine) SetEncoderRegistry(registry *EncoderRegistry) {
+	e.encoders = registry
+}
+
+// EncoderRegistry 获取当前使用的编码器注册表
+func (e *ConversionEngine) EncoderRegistry() *EncoderRegistry {
+	return e.encoders
+}
+
+// SetVideoTranscoder 替换视频转码模式；传入nil时视频只重包装
+func (e *ConversionEngine) SetVideoTranscoder(transcoder *VideoTranscodeMode) {
+	e.videoTranscoder = transcoder
+}
+
+// SetLivePhotoPairer 替换Live Photo配对器；传入nil时不做配对处理
+func (e *ConversionEngine) SetLivePhotoPairer(pairer *LivePhotoPairer) {
+	e.livePhotoPairer = pairer
+	if pairer != nil && e.scanIndex != nil {
+		pairer.SetScanIndex(e.scanIndex)
 	}
 }
 
+// SetJPEGReconstructionVerifier 替换JPEG重建校验器
+func (e *ConversionEngine) SetJPEGReconstructionVerifier(verifier *JPEGReconstructionVerifier) {
+	e.jpegVerifier = verifier
+}
+
 // Execute 执行转换流程
 func (e *ConversionEngine) Execute(ctx context.Context) error {
 	e.logger.Info("转换引擎开始执行",
@@ -255,6 +369,10 @@ func (e *ConversionEngine) validateConfig() error {
 		e.config.ConcurrentJobs = 7 // 默认并发数
 	}
 
+	if e.routingRulesErr != nil {
+		return fmt.Errorf("路由规则无效: %w", e.routingRulesErr)
+	}
+
 	return nil
 }
 
@@ -307,93 +425,69 @@ func (e *ConversionEngine) executeConversionPipeline(ctx context.Context) error
 	defer pipelineCancel()
 
 	// 初始化状态管理器
-	if e.stateManager == nil {
-		e.InitStateManager()
+	if e.openState() {
+		defer e.stateManager.Close()
 	}
-	defer e.stateManager.Close()
 
 	// 保存初始会话信息
 	if err := e.stateManager.SaveSession(e.config.TargetDir); err != nil {
 		e.logger.Warn("保存会话信息失败", zap.Error(err))
 	}
 
-	// 步骤1: 扫描文件
-	mediaFiles, err := e.scanDirectory(e.config.TargetDir)
-	if err != nil {
-		return fmt.Errorf("文件扫描失败: %w", err)
+	// 清空上次运行的文件记录，之后每个文件在发现和处理时逐个记录
+	if err := e.stateManager.SaveMediaFiles(nil); err != nil {
+		e.logger.Warn("重置媒体文件信息失败", zap.Error(err))
 	}
 
-	// 将 []*types.MediaInfo 转换为 []string
-	var files []string
-	for _, mediaFile := range mediaFiles {
-		files = append(files, mediaFile.Path)
+	if err := e.checkQueuePaused(); err != nil {
+		return err
 	}
 
-	// 保存扫描的文件信息
-	// 注意：这里需要将 []*types.MediaInfo 转换为合适的格式
-	if err := e.stateManager.SaveMediaFiles(mediaFiles); err != nil {
-		e.logger.Warn("保存媒体文件信息失败", zap.Error(err))
+	e.runReport = newRunReport(e.htmlReport, e.config.Mode, e.toolCheck.FfmpegDevPath, e.reportThumbnails)
+
+	// 步骤1-4: 流式执行 扫描→评估→路由→转换，目录仍在遍历时已开始转换
+	results, counters, err := e.runStreamingPipeline(pipelineCtx, e.queueDiscovery(), e.config.ConcurrentJobs)
+	if err != nil {
+		return fmt.Errorf("转换管道执行失败: %w", err)
+	}
+	if pipelineCtx.Err() == nil {
+		e.setQueueScanned(false)
 	}
 
-	if len(files) == 0 {
+	if counters.discovered.Load() == 0 && len(results) == 0 {
 		e.logger.Info("未发现需要处理的媒体文件")
 		fmt.Println("📄 未发现需要处理的媒体文件")
 		return nil
 	}
 
-	e.logger.Info("文件扫描完成", zap.Int("total_files", len(files)))
-	fmt.Printf("📂 发现 %d 个媒体文件\n", len(files))
+	fmt.Printf("\r✅ 质量评估完成: %d 个文件，检测到 %d 个损坏文件，%d 个极低质量文件\n",
+		counters.assessed.Load()-counters.corrupted.Load(), counters.corrupted.Load(), counters.lowQuality.Load())
+	e.logger.Info("流式管道完成",
+		zap.Int64("discovered", counters.discovered.Load()),
+		zap.Int64("corrupted", counters.corrupted.Load()),
+		zap.Int64("low_quality", counters.lowQuality.Load()),
+		zap.Int64("converted_tasks", counters.queued.Load()))
 
-	// 步骤2: 评估文件质量和检测损坏文件
-	// 这里需要将 []string 转换回 []*types.MediaInfo
-	var mediaInfoFiles []*types.MediaInfo
-	for _, file := range files {
-		mediaInfoFiles = append(mediaInfoFiles, &types.MediaInfo{Path: file})
+	if e.scanIndex != nil {
+		hits, misses, stale := e.scanIndex.Stats()
+		fmt.Printf("🗂️ 扫描索引: 复用 %d, 新增 %d, 已变化 %d\n", hits, misses, stale)
 	}
-	
-	tasks, _, _, err := e.assessFiles(files)
-	if err != nil {
-		return fmt.Errorf("文件评估失败: %w", err)
-	}
-
-	// 步骤2.6: 使用自动模式+路由器处理智能路由（仅在自动模式+时）
-	if e.config.Mode == "auto+" {
-		e.logger.Info("启动自动模式+智能路由系统")
-
-		// 从任务中提取文件路径
-		filePaths := make([]string, len(tasks))
-		for i, task := range tasks {
-			filePaths[i] = task.SourcePath
-		}
-
-		// 执行智能路由
-		routingDecisions, _, err := e.autoPlusRouter.RouteFiles(pipelineCtx, filePaths)
-		if err != nil {
-			return fmt.Errorf("自动模式+路由失败: %w", err)
-		}
 
-		// 根据路由决策更新任务
-		tasks = e.applyRoutingDecisions(tasks, routingDecisions)
-
-		// 显示路由报告
-		if e.uiInterface != nil {
-			report := e.autoPlusRouter.GenerateRoutingReport(routingDecisions)
-			fmt.Println(report)
+	// 显示路由统计（逐个路由时不保留每个文件的决策）
+	if e.config.Mode == "auto+" && e.uiInterface != nil {
+		stats := e.autoPlusRouter.GetRoutingStatistics()
+		fmt.Printf("🎯 自动模式+路由: %d 个文件，快速预判 %d，深度分析 %d，极低品质 %d\n",
+			stats.TotalFiles, stats.FastRoutedFiles, stats.DeepAnalyzedFiles, stats.LowQualityFiles)
+		if rules := e.autoPlusRouter.RoutingRules(); rules != nil {
+			for _, rule := range rules.Rules {
+				fmt.Printf("   📜 规则 %s: %d 个文件\n", rule.Name, stats.RuleHits[rule.Name])
+			}
 		}
-
-		e.logger.Info("自动模式+路由完成",
-			zap.Int("total_tasks", len(tasks)))
 	}
 
-	// 步骤3: 根据模式路由任务
-	routedTasks := e.routeTasks(tasks)
-	e.logger.Info("任务路由完成", zap.Int("routed_tasks", len(routedTasks)))
-
-	// 步骤4: 执行转换
-	results := e.executeConversion(pipelineCtx, routedTasks)
-
 	// 步骤5: 生成报告
 	e.generateReport(results)
+	e.writeHTMLReport(results)
 
 	// 清理平衡优化器临时文件
 	e.CleanupBalanceOptimizer()
@@ -402,6 +496,15 @@ func (e *ConversionEngine) executeConversionPipeline(ctx context.Context) error
 	return nil
 }
 
+// scanSupportedExts 扫描时识别的媒体文件扩展名
+var scanSupportedExts = map[string]bool{
+	".jpg":  true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".heif": true, ".heic": true, ".avif": true,
+	".jxl":  true, ".tiff": true, ".tif": true, ".bmp": true,
+	".mp4":  true, ".mov": true, ".avi": true, ".mkv": true,
+	".webm": true, ".m4v": true,
+}
+
 // scanDirectory 扫描目录获取文件列表
 func (e *ConversionEngine) scanDirectory(dir string) ([]*types.MediaInfo, error) {
 	e.logger.Debug("开始扫描目录", zap.String("dir", dir))
@@ -411,15 +514,6 @@ func (e *ConversionEngine) scanDirectory(dir string) ([]*types.MediaInfo, error)
 		return nil, fmt.Errorf("目录不存在: %s", dir)
 	}
 
-	// 支持的文件扩展名
-	supportedExts := map[string]bool{
-		".jpg":  true, ".jpeg": true, ".png": true, ".gif": true,
-		".webp": true, ".heif": true, ".heic": true, ".avif": true,
-		".jxl":  true, ".tiff": true, ".tif": true, ".bmp": true,
-		".mp4":  true, ".mov": true, ".avi": true, ".mkv": true,
-		".webm": true, ".m4v": true,
-	}
-
 	var files []*types.MediaInfo
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -434,7 +528,7 @@ func (e *ConversionEngine) scanDirectory(dir string) ([]*types.MediaInfo, error)
 
 		// 检查文件扩展名
 		ext := strings.ToLower(filepath.Ext(path))
-		if supportedExts[ext] {
+		if scanSupportedExts[ext] {
 			files = append(files, &types.MediaInfo{
 				Path: path,
 				Size: info.Size(),
@@ -481,50 +575,19 @@ func (e *ConversionEngine) assessFiles(files []string) ([]ConversionTask, []stri
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
-			// 使用质量评估引擎进行详细评估
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-
-			assessment, err := e.qualityEngine.AssessFile(ctx, filePath)
-			if err != nil {
-				e.logger.Warn("文件评估失败", zap.String("file", filepath.Base(filePath)), zap.Error(err))
-				// 评估失败的文件认为可能损坏
+			task, lowQuality, corrupted := e.assessTask(context.Background(), filePath, nil)
+			if corrupted {
 				mu.Lock()
 				localCorruptedFiles = append(localCorruptedFiles, filePath)
 				mu.Unlock()
 				return
 			}
-
-			// 检测是否损坏
-			if assessment.IsCorrupted {
-				mu.Lock()
-				localCorruptedFiles = append(localCorruptedFiles, filePath)
-				mu.Unlock()
-				e.logger.Debug("检测到损坏文件", zap.String("file", filepath.Base(filePath)))
-				return
-			}
-
-			// 检测是否为极低质量文件（仅在自动模式+中检测）
-			if e.config.Mode == "auto+" && assessment.QualityLevel == types.QualityVeryLow {
+			if lowQuality {
 				mu.Lock()
 				localLowQualityFiles = append(localLowQualityFiles, filePath)
 				mu.Unlock()
-				e.logger.Debug("检测到极低质量文件", zap.String("file", filepath.Base(filePath)))
-				// 注意：低质量文件不直接return，仍需要创建任务，由用户决定如何处理
 			}
 
-			// 创建转换任务
-			task := ConversionTask{
-				SourcePath: filePath,
-				Mode:       e.config.Mode,
-				Status:     "pending",
-				Quality:    assessment.QualityLevel.String(),
-				MediaType:  assessment.MediaType.String(),
-			}
-
-			// 根据模式和质量设置初始的目标格式
-			task.TargetFormat = e.determineTargetFormatFromQualityAssessment(task, assessment)
-
 			mu.Lock()
 			tasks = append(tasks, task)
 			assessedCount++
@@ -552,6 +615,74 @@ func (e *ConversionEngine) assessFiles(files []string) ([]ConversionTask, []stri
 	return tasks, corruptedFiles, lowQualityFiles, nil
 }
 
+// assessTask 评估单个文件并生成初始转换任务
+// 评估失败的文件视为可能损坏，返回 corrupted=true；lowQuality 仅在自动模式+中检测
+// trace 非 nil 时记录分级和目标格式选择的依据，并随任务传给后续阶段
+func (e *ConversionEngine) assessTask(ctx context.Context, filePath string, trace *decisionTrace) (task ConversionTask, lowQuality, corrupted bool) {
+	// 文件自上次评估后未变化时直接复用索引中的结果
+	var fingerprint *scanner.FileFingerprint
+	var assessment *quality.QualityAssessment
+	if e.scanIndex != nil {
+		if info, err := os.Stat(filePath); err == nil {
+			fp := scanner.FingerprintOf(info)
+			fingerprint = &fp
+			if entry := e.scanIndex.Lookup(filePath, fp); entry != nil {
+				assessment = entry.Quality
+			}
+		}
+	}
+	cached := assessment != nil
+
+	if assessment == nil {
+		// 使用质量评估引擎进行详细评估
+		assessCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		var err error
+		assessment, err = e.qualityEngine.AssessFile(assessCtx, filePath)
+		if err != nil {
+			e.logger.Warn("文件评估失败", zap.String("file", filepath.Base(filePath)), zap.Error(err))
+			trace.add(types.DecisionStageAssessment, "assess_failed", "corrupted", map[string]interface{}{"error": err.Error()}, "")
+			return task, false, true
+		}
+
+		if fingerprint != nil {
+			if err := e.scanIndex.Store(filePath, &scanner.ScanIndexEntry{Fingerprint: *fingerprint, Quality: assessment}); err != nil {
+				e.logger.Debug("写入扫描索引失败", zap.String("file", filepath.Base(filePath)), zap.Error(err))
+			}
+		}
+	}
+
+	trace.traceAssessment(assessment, cached)
+
+	// 检测是否损坏
+	if assessment.IsCorrupted {
+		e.logger.Debug("检测到损坏文件", zap.String("file", filepath.Base(filePath)))
+		return task, false, true
+	}
+
+	// 检测是否为极低质量文件（仅在自动模式+中检测）
+	// 注意：低质量文件仍需要创建任务，由用户决定如何处理
+	if e.config.Mode == "auto+" && assessment.QualityLevel == types.QualityVeryLow {
+		lowQuality = true
+		e.logger.Debug("检测到极低质量文件", zap.String("file", filepath.Base(filePath)))
+	}
+
+	// 创建转换任务
+	task = ConversionTask{
+		SourcePath: filePath,
+		Mode:       e.config.Mode,
+		Status:     "pending",
+		Quality:    assessment.QualityLevel.String(),
+		MediaType:  assessment.MediaType.String(),
+		trace:      trace,
+	}
+
+	// 根据模式和质量设置初始的目标格式
+	task.TargetFormat = e.determineTargetFormatFromQualityAssessment(task, assessment)
+	return task, lowQuality, false
+}
+
 // assessFileQuality 使用FFmpeg评估文件质量
 func (e *ConversionEngine) assessFileQuality(filePath string) (string, string) {
 	// 简化的质量评估逻辑，基于文件大小和格式
@@ -630,7 +761,7 @@ func (e *ConversionEngine) determineTargetFormat(task ConversionTask) string {
 				return "avif_compressed" // 低质量使用AVIF压缩
 			}
 		} else if task.MediaType == "video" {
-			return "remux" // 视频使用重包装
+			return e.videoTargetFormat(task.SourcePath) // 视频重包装或转码
 		}
 	case "quality":
 		// 质量模式：全部无损
@@ -650,14 +781,19 @@ func (e *ConversionEngine) determineTargetFormat(task ConversionTask) string {
 	return "auto"
 }
 
-// determineTargetFormatFromQualityAssessment 根据评估结果确定目标格式
 // determineTargetFormatFromQualityAssessment 根据评估结果确定目标格式
 func (e *ConversionEngine) determineTargetFormatFromQualityAssessment(task ConversionTask, assessment *quality.QualityAssessment) string {
 	// 首先检查文件是否已经是目标格式，防止重复转换
 	ext := strings.ToLower(filepath.Ext(task.SourcePath))
 
 	// 检查文件是否已经是最优格式，避免无意义的重复转换
-	if e.isAlreadyOptimalFormat(ext, e.config.Mode, assessment) {
+	optimal, rule := e.isAlreadyOptimalFormat(ext, e.config.Mode, assessment)
+	outcome := "continue"
+	if optimal {
+		outcome = "skip"
+	}
+	task.trace.add(types.DecisionStageOptimalFormat, rule, outcome, map[string]interface{}{"ext": ext, "mode": e.config.Mode}, "")
+	if optimal {
 		e.logger.Debug("文件已经是最优格式，跳过转换",
 			zap.String("file", filepath.Base(task.SourcePath)),
 			zap.String("ext", ext),
@@ -665,46 +801,58 @@ func (e *ConversionEngine) determineTargetFormatFromQualityAssessment(task Conve
 		return "skip"
 	}
 
+	format, branch := e.targetFormatForMode(task, assessment)
+	task.trace.add(types.DecisionStageMode, branch, format, map[string]interface{}{
+		"mode":          e.config.Mode,
+		"quality_level": assessment.QualityLevel.String(),
+		"media_type":    assessment.MediaType.String(),
+	}, "")
+	return format
+}
+
+// targetFormatForMode 按处理模式和品质等级选择目标格式，返回格式和命中的分支
+func (e *ConversionEngine) targetFormatForMode(task ConversionTask, assessment *quality.QualityAssessment) (format, branch string) {
 	switch e.config.Mode {
 	case "auto+":
 		// 智能模式：根据质量选择策略
 		if assessment.MediaType == types.MediaTypeImage {
 			switch assessment.QualityLevel {
 			case types.QualityVeryHigh, types.QualityHigh:
-				return "jxl_lossless" // 高质量图片使用JXL无损
+				return "jxl_lossless", "auto+ 高品质图片使用JXL无损"
 			case types.QualityMediumHigh:
-				return "jxl_balanced" // 中等质量使用JXL平衡模式
+				return "jxl_balanced", "auto+ 中高品质图片使用JXL平衡模式"
 			default:
-				return "avif_compressed" // 低质量使用AVIF压缩
+				return "avif_compressed", "auto+ 低品质图片使用AVIF压缩"
 			}
 		} else if assessment.MediaType == types.MediaTypeVideo {
-			return "remux" // 视频使用重包装
+			return e.videoTargetFormat(task.SourcePath), "auto+ 视频重包装或转码"
 		}
 	case "quality":
 		// 质量模式：全部无损
 		if assessment.MediaType == types.MediaTypeImage {
-			return "jxl_lossless"
+			return "jxl_lossless", "quality 图片使用JXL无损"
 		} else if assessment.MediaType == types.MediaTypeVideo {
-			return "remux"
+			return "remux", "quality 视频重包装"
 		}
 	case "sticker":
 		// 表情包模式：所有图片转为AVIF
 		if assessment.MediaType == types.MediaTypeImage {
-			return "avif_compressed"
+			return "avif_compressed", "sticker 图片使用AVIF压缩"
 		} else {
-			return "skip" // 视频跳过
+			return "skip", "sticker 跳过非静图"
 		}
 	}
-	return "auto"
+	return "auto", "未匹配模式，转换时按文件类型决定"
 }
 
 // isAlreadyOptimalFormat 检查文件是否已经是最优格式，避免无意义的重复转换
-func (e *ConversionEngine) isAlreadyOptimalFormat(ext, mode string, assessment *quality.QualityAssessment) bool {
+// 同时返回所依据的规则说明，供决策轨迹使用
+func (e *ConversionEngine) isAlreadyOptimalFormat(ext, mode string, assessment *quality.QualityAssessment) (bool, string) {
 	// 如果文件大小为0，认为是损坏文件，跳过
 	if fileInfo, err := os.Stat(assessment.FilePath); err == nil && fileInfo.Size() == 0 {
 		e.logger.Debug("检测到空文件，跳过转换",
 			zap.String("file", filepath.Base(assessment.FilePath)))
-		return true
+		return true, "空文件"
 	}
 
 	switch mode {
@@ -714,37 +862,37 @@ func (e *ConversionEngine) isAlreadyOptimalFormat(ext, mode string, assessment *
 			switch assessment.QualityLevel {
 			case types.QualityVeryHigh, types.QualityHigh:
 				// 高质量文件应该使用JXL无损，如果已是JXL格式则跳过
-				return ext == ".jxl"
+				return ext == ".jxl", "auto+ 高品质图片的最优格式为 .jxl"
 			case types.QualityMediumHigh:
 				// 中等质量文件应该使用JXL平衡模式，如果已是JXL或AVIF则考虑跳过
-				return ext == ".jxl" || ext == ".avif"
+				return ext == ".jxl" || ext == ".avif", "auto+ 中高品质图片的最优格式为 .jxl/.avif"
 			default:
 				// 低质量文件应该使用AVIF，如果已是AVIF则跳过
-				return ext == ".avif"
+				return ext == ".avif", "auto+ 低品质图片的最优格式为 .avif"
 			}
 		}
-		return false
+		return false, "auto+ 非静图不检查"
 
 	case "quality":
 		// 质量模式中，所有图片都应该是JXL无损
 		if assessment.MediaType == types.MediaTypeImage {
-			return ext == ".jxl"
+			return ext == ".jxl", "quality 图片的最优格式为 .jxl"
 		}
-		return false
+		return false, "quality 非静图不检查"
 
 	case "sticker":
 		// 表情包模式中，所有图片都应该是AVIF
 		if assessment.MediaType == types.MediaTypeImage {
-			return ext == ".avif"
+			return ext == ".avif", "sticker 图片的最优格式为 .avif"
 		}
 		// 视频文件在表情包模式中应该被跳过
 		if assessment.MediaType == types.MediaTypeVideo {
-			return true // 统一跳过所有视频
+			return true, "sticker 跳过视频" // 统一跳过所有视频
 		}
-		return false
+		return false, "sticker 其他类型不检查"
 
 	default:
-		return false
+		return false, "模式 " + mode + " 不检查"
 	}
 }
 
@@ -755,39 +903,11 @@ func (e *ConversionEngine) routeTasks(tasks []ConversionTask) []ConversionTask {
 	var routedCount int
 
 	for i := range tasks {
-		// 如果任务已经有目标格式设置（比如低品质文件处理时设置的），则保持不变
-		if tasks[i].TargetFormat != "" &&
-			tasks[i].TargetFormat != "auto" &&
-			tasks[i].TargetFormat != "quality" &&
-			tasks[i].TargetFormat != "sticker" {
-			e.logger.Debug("任务已有目标格式，跳过路由",
-				zap.String("file", filepath.Base(tasks[i].SourcePath)),
-				zap.String("existing_format", tasks[i].TargetFormat))
-			continue
-		}
-
-		// 根据模式进行路由
-		switch e.config.Mode {
-		case "auto+":
-			// 智能模式：根据文件类型和质量选择最佳策略
-			tasks[i].TargetFormat = e.determineOptimalFormat(tasks[i])
-		case "quality":
-			// 品质模式：所有文件使用无损或最高品质转换
-			tasks[i].TargetFormat = e.determineQualityFormat(tasks[i])
-		case "sticker":
-			// 表情包模式：适用于网络分享的极限压缩
-			tasks[i].TargetFormat = e.determineStickerFormat(tasks[i])
-		default:
-			// 默认为自动模式
-			tasks[i].TargetFormat = e.determineOptimalFormat(tasks[i])
+		var routed bool
+		tasks[i], routed = e.routeTask(tasks[i])
+		if routed {
+			routedCount++
 		}
-
-		routedCount++
-		e.logger.Debug("任务路由完成",
-			zap.String("file", filepath.Base(tasks[i].SourcePath)),
-			zap.String("target_format", tasks[i].TargetFormat),
-			zap.String("quality", tasks[i].Quality),
-			zap.String("media_type", tasks[i].MediaType))
 	}
 
 	e.logger.Info("任务路由完成",
@@ -798,6 +918,48 @@ func (e *ConversionEngine) routeTasks(tasks []ConversionTask) []ConversionTask {
 	return tasks
 }
 
+// routeTask 根据模式为单个任务分配目标格式；任务已有明确目标格式时保持不变并返回 false
+func (e *ConversionEngine) routeTask(task ConversionTask) (ConversionTask, bool) {
+	// 如果任务已经有目标格式设置（比如低品质文件处理时设置的），则保持不变
+	if task.TargetFormat != "" &&
+		task.TargetFormat != "auto" &&
+		task.TargetFormat != "quality" &&
+		task.TargetFormat != "sticker" {
+		e.logger.Debug("任务已有目标格式，跳过路由",
+			zap.String("file", filepath.Base(task.SourcePath)),
+			zap.String("existing_format", task.TargetFormat))
+		return task, false
+	}
+
+	// 根据模式进行路由
+	switch e.config.Mode {
+	case "auto+":
+		// 智能模式：根据文件类型和质量选择最佳策略
+		task.TargetFormat = e.determineOptimalFormat(task)
+	case "quality":
+		// 品质模式：所有文件使用无损或最高品质转换
+		task.TargetFormat = e.determineQualityFormat(task)
+	case "sticker":
+		// 表情包模式：适用于网络分享的极限压缩
+		task.TargetFormat = e.determineStickerFormat(task)
+	default:
+		// 默认为自动模式
+		task.TargetFormat = e.determineOptimalFormat(task)
+	}
+
+	task.trace.add(types.DecisionStageMode, "按模式 "+e.config.Mode+" 路由", task.TargetFormat, map[string]interface{}{
+		"quality":    measured(task.Quality, task.Quality != ""),
+		"media_type": task.MediaType,
+	}, "")
+
+	e.logger.Debug("任务路由完成",
+		zap.String("file", filepath.Base(task.SourcePath)),
+		zap.String("target_format", task.TargetFormat),
+		zap.String("quality", task.Quality),
+		zap.String("media_type", task.MediaType))
+	return task, true
+}
+
 // determineOptimalFormat 自动模式+的最优格式选择
 func (e *ConversionEngine) determineOptimalFormat(task ConversionTask) string {
 	if task.MediaType == "image" {
@@ -814,12 +976,25 @@ func (e *ConversionEngine) determineOptimalFormat(task ConversionTask) string {
 			return "jxl_balanced"
 		}
 	} else if task.MediaType == "video" {
-		// 视频文件一般使用重包装或轻度压缩
-		return "remux"
+		// 视频文件使用重包装，配置了转码时使用AV1/HEVC重新编码
+		return e.videoTargetFormat(task.SourcePath)
 	}
 	return "auto" // 其他情况使用自动判断
 }
 
+// videoTargetFormat 视频目标格式：启用转码且源文件达到体积门槛时转码，否则重包装
+func (e *ConversionEngine) videoTargetFormat(sourcePath string) string {
+	if e.videoTranscoder == nil {
+		return "remux"
+	}
+	if minSize := e.videoTranscoder.Options().MinSourceSize; minSize > 0 {
+		if info, err := os.Stat(sourcePath); err == nil && info.Size() < minSize {
+			return "remux"
+		}
+	}
+	return "video_transcode"
+}
+
 // determineQualityFormat 品质模式的格式选择
 func (e *ConversionEngine) determineQualityFormat(task ConversionTask) string {
 	if task.MediaType == "image" {
@@ -851,10 +1026,21 @@ func (e *ConversionEngine) executeConversion(ctx context.Context, tasks []Conver
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
+	// Live Photo 的两半作为一个单元处理，其余任务各自为一个单元
+	pairsByStill, pairedVideos := e.findLivePhotoPairs(ctx, tasks)
+	tasksByPath := make(map[string]ConversionTask, len(tasks))
+	for _, task := range tasks {
+		tasksByPath[task.SourcePath] = task
+	}
+
 	// 使用工作池控制并发
 	semaphore := make(chan struct{}, e.config.ConcurrentJobs)
 
 	for _, task := range tasks {
+		if pairedVideos[task.SourcePath] {
+			continue // 随静态图一起处理
+		}
+
 		wg.Add(1)
 		go func(t ConversionTask) {
 			defer wg.Done()
@@ -862,12 +1048,17 @@ func (e *ConversionEngine) executeConversion(ctx context.Context, tasks []Conver
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
-			result := e.processTask(ctx, t)
+			var unitResults []ConversionResult
+			if pair, ok := pairsByStill[t.SourcePath]; ok {
+				unitResults = e.processLivePhotoPair(ctx, pair, t, tasksByPath[pair.VideoPath])
+			} else {
+				unitResults = []ConversionResult{e.processTask(ctx, t)}
+			}
 
 			mu.Lock()
-			results = append(results, result)
+			results = append(results, unitResults...)
 			// 更新转换进度
-			e.progressManager.UpdateProgress(progress.ProgressTypeConversion, 1)
+			e.progressManager.UpdateProgress(progress.ProgressTypeConversion, len(unitResults))
 			mu.Unlock()
 		}(task)
 	}
@@ -882,8 +1073,13 @@ func (e *ConversionEngine) executeConversion(ctx context.Context, tasks []Conver
 }
 
 // processTask 处理单个任务（带重试机制）
-func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask) ConversionResult {
-	result := ConversionResult{
+func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask) (result ConversionResult) {
+	// 转换阶段的决策记录随结果返回
+	trace := &decisionTrace{}
+	task.trace = trace
+	defer func() { result.Decisions = trace.records }()
+
+	result = ConversionResult{
 		SourcePath: task.SourcePath,
 		Status:     "success",
 		Message:    "转换完成",
@@ -899,6 +1095,18 @@ func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask)
 		return result
 	}
 
+	// 路由规则要求保留原文件
+	if task.TargetFormat == "keep" {
+		result.Status = "kept"
+		result.Message = fmt.Sprintf("路由规则 %v 要求保留原文件", task.Options["rule"])
+		if info, err := os.Stat(task.SourcePath); err == nil {
+			result.OriginalSize, result.NewSize = info.Size(), info.Size()
+		}
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime)
+		return result
+	}
+
 	// 记录开始处理
 	e.logger.Debug("开始处理任务",
 		zap.String("file", filepath.Base(task.SourcePath)),
@@ -942,6 +1150,7 @@ func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask)
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			// 重试前稍微等待，指数退避
+			metrics.Retries.Inc()
 			retryDelay := time.Duration(attempt*attempt) * 100 * time.Millisecond
 			e.logger.Info("重试转换任务",
 				zap.String("file", filepath.Base(task.SourcePath)),
@@ -964,6 +1173,20 @@ func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask)
 		// 尝试转换
 		taskCopy := task // 复制任务以防止修改原始任务
 		taskCopy, err = e.performActualConversionWithResult(ctx, taskCopy)
+
+		// 校验未通过时降级为保留原文件，重试不会改变结果
+		var keepErr *KeepOriginalError
+		if errors.As(err, &keepErr) {
+			trace.add(types.DecisionStageConversion, "保留原文件", "kept", map[string]interface{}{"reason": keepErr.Reason}, "")
+			result.Status = "kept"
+			result.Message = keepErr.Error()
+			result.OriginalSize = sourceInfo.Size()
+			result.NewSize = sourceInfo.Size()
+			result.EndTime = time.Now()
+			result.Duration = result.EndTime.Sub(result.StartTime)
+			return result
+		}
+
 		if err == nil {
 			// 转换成功
 			result.Message = "转换成功"
@@ -992,6 +1215,10 @@ func (e *ConversionEngine) processTask(ctx context.Context, task ConversionTask)
 
 		// 转换失败，记录错误
 		lastErr = err
+		trace.add(types.DecisionStageConversion, "转换尝试失败", "retry", map[string]interface{}{
+			"attempt": attempt + 1,
+			"error":   err.Error(),
+		}, fmt.Sprintf("最多重试 %d 次", maxRetries))
 		e.logger.Warn("转换尝试失败",
 			zap.String("file", filepath.Base(task.SourcePath)),
 			zap.Int("attempt", attempt+1),
@@ -1041,8 +1268,8 @@ func (e *ConversionEngine) performActualConversionWithResult(ctx context.Context
 		}
 	}
 
-	// 执行转换
-	err = e.performActualConversion(ctx, task)
+	// 执行转换；平衡优化原位替换源文件，实际输出路径以转换结果为准
+	outputPath, err := e.performActualConversion(ctx, task)
 	if err != nil {
 		// 转换失败时，如果有备份，尝试恢复
 		if backupPath != "" {
@@ -1058,6 +1285,7 @@ func (e *ConversionEngine) performActualConversionWithResult(ctx context.Context
 		}
 		return task, err
 	}
+	task.TargetPath = outputPath
 
 	// 转换成功，清理备份文件（如果用户配置了不保留备份）
 	if backupPath != "" && !e.config.KeepBackups {
@@ -1074,8 +1302,9 @@ func (e *ConversionEngine) performActualConversionWithResult(ctx context.Context
 	return task, nil
 }
 
-// performActualConversion 执行实际的文件转换
-func (e *ConversionEngine) performActualConversion(ctx context.Context, task ConversionTask) error {
+// performActualConversion 执行实际的文件转换，返回输出文件路径
+// 原位替换源文件时返回源文件路径，没有输出（跳过、模拟）时返回空串
+func (e *ConversionEngine) performActualConversion(ctx context.Context, task ConversionTask) (string, error) {
 	e.logger.Info("执行文件转换",
 		zap.String("source", filepath.Base(task.SourcePath)),
 		zap.String("format", task.TargetFormat))
@@ -1083,14 +1312,14 @@ func (e *ConversionEngine) performActualConversion(ctx context.Context, task Con
 	// 生成目标文件路径
 	targetPath, err := e.generateTargetPath(task.SourcePath, task.TargetFormat)
 	if err != nil {
-		return fmt.Errorf("生成目标路径失败: %w", err)
+		return "", fmt.Errorf("生成目标路径失败: %w", err)
 	}
 	task.TargetPath = targetPath
 
 	// 读取源文件信息
 	sourceInfo, err := os.Stat(task.SourcePath)
 	if err != nil {
-		return fmt.Errorf("无法获取源文件信息: %w", err)
+		return "", fmt.Errorf("无法获取源文件信息: %w", err)
 	}
 
 	// 获取源文件的创建时间和修改时间
@@ -1101,21 +1330,24 @@ func (e *ConversionEngine) performActualConversion(ctx context.Context, task Con
 	var conversionErr error
 	switch task.TargetFormat {
 	case "jxl_lossless", "jxl_balanced":
-		// 在JXL转换中保留ICC配置
-		iccProfile, err := e.stateManager.LoadICCProfile(task.SourcePath)
-		if err == nil && iccProfile != nil {
-			if task.Options == nil {
-				task.Options = make(map[string]interface{})
+		// 在JXL转换中保留ICC配置（分布式工作节点没有状态数据库）
+		if e.stateManager != nil {
+			if iccProfile, err := e.stateManager.LoadICCProfile(task.SourcePath); err == nil && iccProfile != nil {
+				if task.Options == nil {
+					task.Options = make(map[string]interface{})
+				}
+				task.Options["icc"] = string(iccProfile)
 			}
-			task.Options["icc"] = string(iccProfile)
 		}
 
 		conversionErr = e.convertToJXL(ctx, task, true) // 无损模式
+	case "jxl_lossy":
+		conversionErr = e.convertToJXL(ctx, task, false) // 路由规则指定的有损模式
 	case "avif_compressed":
 		conversionErr = e.convertToAVIF(ctx, task, "compressed") // 压缩模式
 	case "avif_balanced":
-		// README要求：AVIF也使用平衡优化逻辑
-		conversionErr = e.performBalanceOptimization(ctx, task)
+		// README要求：AVIF也使用平衡优化逻辑；优化结果原位替换源文件，无需再迁移元数据
+		return e.performBalanceOptimization(ctx, task)
 	case "remux":
 		// 在视频重包装中保留创建时间和修改时间
 		if task.Options == nil {
@@ -1126,10 +1358,12 @@ func (e *ConversionEngine) performActualConversion(ctx context.Context, task Con
 		task.Options["modification_time"] = modifyTime.Unix()
 
 		conversionErr = e.remuxVideo(ctx, task) // 视频重包装
+	case "video_transcode":
+		conversionErr = e.transcodeVideo(ctx, task) // 视频转码（AV1/HEVC）
 	case "skip":
 		// 跳过处理 - 用于表情包模式下的视频文件或其他需要跳过的情况
 		e.logger.Debug("跳过文件处理", zap.String("file", filepath.Base(task.SourcePath)), zap.String("reason", "skip_format"))
-		return nil
+		return "", nil
 	case "auto":
 		// 自动模式：根据文件类型选择默认转换
 		if task.MediaType == "image" {
@@ -1144,37 +1378,25 @@ func (e *ConversionEngine) performActualConversion(ctx context.Context, task Con
 		processingTime := time.Duration(100+len(task.SourcePath)%500) * time.Millisecond
 		select {
 		case <-time.After(processingTime):
-			return nil
+			return "", nil
 		case <-ctx.Done():
-			return ctx.Err()
+			return "", ctx.Err()
 		}
 	}
 
 	// 如果转换失败，直接返回错误
 	if conversionErr != nil {
-		return conversionErr
+		return "", conversionErr
 	}
 
 	// 转换成功后，进行元数据迁移
-	// README要求：强制迁移EXIF、ICC等元数据
-	if e.toolCheck.HasExiftool {
-		// 创建元数据迁移器
-		migrator := metamigrator.NewMetadataMigrator(e.logger, e.toolCheck.ExiftoolPath)
-		
-		// 执行元数据迁移
-		_, migrateErr := migrator.MigrateMetadata(ctx, task.SourcePath, task.TargetPath)
-		if migrateErr != nil {
-			e.logger.Warn("元数据迁移失败", 
-				zap.String("source", filepath.Base(task.SourcePath)),
-				zap.String("target", filepath.Base(task.TargetPath)),
-				zap.Error(migrateErr))
-		} else {
-			e.logger.Info("元数据迁移完成",
-				zap.String("source", filepath.Base(task.SourcePath)),
-				zap.String("target", filepath.Base(task.TargetPath)))
+	e.migrateMetadata(ctx, task.SourcePath, task.TargetPath)
+
+	// JPEG无损转码必须能逐位还原原文件；元数据迁移会改写JXL，校验放在迁移之后
+	if (task.TargetFormat == "jxl_lossless" || task.TargetFormat == "jxl_balanced") && isJPEGExt(task.SourcePath) {
+		if err := e.verifyLosslessJPEG(ctx, task.SourcePath, task.TargetPath); err != nil {
+			return "", err
 		}
-	} else {
-		e.logger.Warn("exiftool不可用，跳过元数据迁移")
 	}
 
 	// 保存文件的创建时间和修改时间
@@ -1184,9 +1406,14 @@ func (e *ConversionEngine) performActualConversion(ctx context.Context, task Con
 		ModifyTime: modifyTime,
 	}
 
-	e.stateManager.SaveMediaFiles([]*types.MediaInfo{mediaInfo})
+	// 只更新该文件的记录，SaveMediaFiles 会清空整个列表
+	if e.stateManager != nil {
+		if err := e.stateManager.SaveMediaFile(mediaInfo); err != nil {
+			e.logger.Warn("保存文件时间信息失败", zap.Error(err))
+		}
+	}
 
-	return nil
+	return task.TargetPath, nil
 }
 
 // generateTargetPath 生成目标文件路径
@@ -1196,14 +1423,14 @@ func (e *ConversionEngine) generateTargetPath(sourcePath, format string) (string
 
 	var ext string
 	switch format {
-	case "jxl_lossless", "jxl_balanced":
+	case "jxl_lossless", "jxl_balanced", "jxl_lossy":
 		ext = ".jxl"
 	case "avif_compressed":
 		ext = ".avif"
 	case "avif_balanced":
 		ext = ".avif"
-	case "remux":
-		// 视频重包装保持原格式或转为MP4
+	case "remux", "video_transcode":
+		// 视频重包装/转码保持原格式或转为MP4
 		originalExt := filepath.Ext(sourcePath)
 		if originalExt == ".mp4" {
 			ext = ".mp4" // 已经是MP4，保持不变
@@ -1244,111 +1471,35 @@ func (e *ConversionEngine) convertToJXL(ctx context.Context, task ConversionTask
 		zap.String("target", filepath.Base(task.TargetPath)),
 		zap.Bool("lossless", lossless))
 
-	// 检查cjxl工具可用性
-	if !e.toolCheck.HasCjxl {
-		return fmt.Errorf("cjxl工具不可用")
+	ext := strings.ToLower(filepath.Ext(task.SourcePath))
+	job := &EncodeJob{
+		SourcePath:   task.SourcePath,
+		TargetPath:   task.TargetPath,
+		OutputFormat: "jxl",
+		Operation:    "jxl_conversion",
+		Complexity:   processmonitor.ComplexityMedium,
+		Metadata:     map[string]string{"lossless": fmt.Sprintf("%t", lossless)},
 	}
 
-	// 构建命令参数
-	var args []string
-	args = append(args, task.SourcePath, task.TargetPath)
-
 	if lossless {
-		// 无损模式
-		ext := strings.ToLower(filepath.Ext(task.SourcePath))
 		if ext == ".jpg" || ext == ".jpeg" || ext == ".jpe" || ext == ".jfif" {
 			// JPEG无损模式
-			args = append(args, "--lossless_jpeg=1")
+			job.LosslessJPEG = true
 		} else {
 			// 其他格式无损模式
-			args = append(args, "-q", "100")
+			job.Lossless = true
 		}
-		args = append(args, "-e", "7") // 适中的努力值
+		job.Effort = 7 // 适中的努力值
 	} else {
 		// 平衡模式
-		args = append(args, "-q", "85", "-e", "8")
-	}
-
-	// 创建命令
-	cmd := exec.CommandContext(ctx, "cjxl", args...)
-
-	// 获取文件信息用于超时估算
-	fileInfo, err := os.Stat(task.SourcePath)
-	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
+		job.Quality = 85
+		job.Effort = 8
 	}
+	applyRuleEncodeOptions(job, task)
 
-	// 创建进程上下文
-	processCtx := &processmonitor.ProcessContext{
-		Operation:       "jxl_conversion",
-		SourceFile:      task.SourcePath,
-		FileSize:        fileInfo.Size(),
-		FileFormat:      "jxl",
-		ComplexityLevel: processmonitor.ComplexityMedium,
-		Priority:        processmonitor.PriorityNormal,
-		Metadata:        map[string]string{"lossless": fmt.Sprintf("%t", lossless)},
-	}
-
-	// 使用进程监控器执行命令
-	err = e.processMonitor.MonitorCommand(ctx, cmd, processCtx)
-	if err != nil {
-		// README要求：添加后备转换机制
-		// 当cjxl转换失败时，尝试使用FFmpeg作为后备方案
-		e.logger.Warn("JXL转换失败，尝试使用FFmpeg作为后备方案", 
-			zap.String("source", filepath.Base(task.SourcePath)), 
-			zap.Error(err))
-		
-		// 检查FFmpeg可用性
-		if !e.toolCheck.HasFfmpeg {
-			return fmt.Errorf("JXL转换失败且FFmpeg不可用: %w", err)
-		}
-		
-		// 使用FFmpeg进行JXL转换
-		ffmpegArgs := []string{"-i", task.SourcePath}
-		
-		// 根据是否无损设置参数
-		if lossless {
-			// FFmpeg的libjxl无损参数
-			ffmpegArgs = append(ffmpegArgs, "-c:v", "libjxl", "-q:v", "0", "-y", task.TargetPath)
-		} else {
-			// FFmpeg的libjxl有损参数
-			ffmpegArgs = append(ffmpegArgs, "-c:v", "libjxl", "-q:v", "85", "-y", task.TargetPath)
-		}
-		
-		// 创建FFmpeg命令
-		ffmpegCmd := exec.CommandContext(ctx, e.toolCheck.FfmpegDevPath, ffmpegArgs...)
-		
-		// 更新进程上下文
-		processCtx.Operation = "jxl_conversion_ffmpeg"
-		processCtx.Metadata["tool"] = "ffmpeg"
-		
-		// 使用进程监控器执行FFmpeg命令
-		ffmpegErr := e.processMonitor.MonitorCommand(ctx, ffmpegCmd, processCtx)
-		if ffmpegErr != nil {
-			// 尝试使用稳定版FFmpeg作为最终后备方案
-			e.logger.Warn("FFmpeg开发版JXL转换失败，尝试使用稳定版FFmpeg", 
-				zap.String("source", filepath.Base(task.SourcePath)), 
-				zap.Error(ffmpegErr))
-			
-			// 创建稳定版FFmpeg命令
-			stableFfmpegCmd := exec.CommandContext(ctx, e.toolCheck.FfmpegStablePath, ffmpegArgs...)
-			
-			// 更新进程上下文
-			processCtx.Operation = "jxl_conversion_ffmpeg_stable"
-			processCtx.Metadata["tool"] = "ffmpeg_stable"
-			
-			// 使用进程监控器执行稳定版FFmpeg命令
-			stableFfmpegErr := e.processMonitor.MonitorCommand(ctx, stableFfmpegCmd, processCtx)
-			if stableFfmpegErr != nil {
-				return fmt.Errorf("JXL转换失败，所有后备方案都失败: %w", stableFfmpegErr)
-			}
-			
-			e.logger.Info("稳定版FFmpeg后备转换成功", zap.String("target", filepath.Base(task.TargetPath)))
-			return nil
-		}
-		
-		e.logger.Info("FFmpeg后备转换成功", zap.String("target", filepath.Base(task.TargetPath)))
-		return nil
+	// README要求：后备转换机制 - cjxl → FFmpeg开发版 → FFmpeg稳定版
+	if _, err := RunEncoderChain(ctx, e.logger, e.encoders.ChainFor(ext, "jxl"), job); err != nil {
+		return err
 	}
 
 	e.logger.Debug("JXL转换完成", zap.String("target", filepath.Base(task.TargetPath)))
@@ -1362,134 +1513,69 @@ func (e *ConversionEngine) convertToAVIF(ctx context.Context, task ConversionTas
 		zap.String("target", filepath.Base(task.TargetPath)),
 		zap.String("mode", mode))
 
-	// 检查AVIF工具可用性（优先使用FFmpeg）
-	if !e.toolCheck.HasFfmpeg && !e.toolCheck.HasAvifenc {
-		return fmt.Errorf("AVIF转换工具不可用（需要FFmpeg或avifenc）")
+	job := &EncodeJob{
+		SourcePath:   task.SourcePath,
+		TargetPath:   task.TargetPath,
+		OutputFormat: "avif",
+		Container:    "avif", // README新增要求：明确指定AVIF容器格式
+		Operation:    "avif_conversion",
+		Complexity:   processmonitor.ComplexityHigh, // AVIF编码复杂度高
+		Metadata:     map[string]string{"mode": mode},
 	}
 
-	// 获取文件信息用于超时估算
-	fileInfo, err := os.Stat(task.SourcePath)
-	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
+	// 根据模式设置参数（avifenc 使用 Quality/Speed，FFmpeg 使用 VideoCodec/CRF）
+	switch mode {
+	case "compressed":
+		job.Quality, job.Speed = 50, 6
+		job.VideoCodec, job.CRF = "libaom-av1", 32
+	case "balanced":
+		job.Quality, job.Speed = 35, 8
+		job.VideoCodec, job.CRF = "libsvtav1", 28
+	default:
+		job.Quality, job.Speed = 25, 10
+		job.VideoCodec, job.CRF = "libaom-av1", 30
 	}
-
-	var cmd *exec.Cmd
-	var toolName string
+	applyRuleEncodeOptions(job, task)
 
 	// 根据README要求选择工具：动图使用FFmpeg，静图优先使用avifenc
-	if strings.Contains(strings.ToLower(task.MediaType), "video") || strings.Contains(strings.ToLower(task.MediaType), "animated") {
-		// 动图/视频：必须使用FFmpeg
-		if !e.toolCheck.HasFfmpeg {
-			return fmt.Errorf("动图/视频AVIF转换需要FFmpeg")
-		}
-
-		toolName = "ffmpeg"
-		var args []string
-		args = append(args, "-i", task.SourcePath)
+	var chain []Encoder
+	mediaType := strings.ToLower(task.MediaType)
+	if strings.Contains(mediaType, "video") || strings.Contains(mediaType, "animated") {
+		chain = e.encoders.Chain(EncoderFfmpegDev, EncoderFfmpegStable)
+	} else {
+		chain = e.encoders.ChainFor(filepath.Ext(task.SourcePath), "avif")
+	}
 
-		// 根据模式设置参数
-		switch mode {
-		case "compressed":
-			args = append(args, "-c:v", "libaom-av1", "-crf", "32")
-		case "balanced":
-			args = append(args, "-c:v", "libsvtav1", "-crf", "28")
-		default:
-			args = append(args, "-c:v", "libaom-av1", "-crf", "30")
+	if _, err := RunEncoderChain(ctx, e.logger, chain, job); err != nil {
+		// README要求：后备转换机制 - 原编码链失败时改用 libsvtav1 编码器重试
+		backupChain := e.encoders.Chain(EncoderFfmpegStable, EncoderFfmpegDev)
+		if len(backupChain) == 0 || ctx.Err() != nil {
+			return err
 		}
-		
-		// README新增要求：明确指定AVIF容器参数
-		args = append(args, "-f", "avif") // 明确指定AVIF容器格式
-		args = append(args, "-y", task.TargetPath)
-		cmd = exec.CommandContext(ctx, e.toolCheck.FfmpegDevPath, args...)
-
-	} else {
-		// 静图：优先使用avifenc
-		if e.toolCheck.HasAvifenc {
-			toolName = "avifenc"
-			var args []string
-			args = append(args, task.SourcePath, task.TargetPath)
+		e.logger.Warn("AVIF转换失败，尝试使用后备方案",
+			zap.String("source", filepath.Base(task.SourcePath)),
+			zap.Error(err))
 
-			// 根据模式设置参数
+		backup := *job
+		backup.VideoCodec = "libsvtav1"
+		if taskOptionInt(task.Options, "quality") == 0 { // 路由规则指定的品质优先
 			switch mode {
 			case "compressed":
-				args = append(args, "-q", "50", "-s", "6")
+				backup.CRF = 40
 			case "balanced":
-				args = append(args, "-q", "35", "-s", "8")
+				backup.CRF = 35
 			default:
-				args = append(args, "-q", "25", "-s", "10")
+				backup.CRF = 30
 			}
-
-			cmd = exec.CommandContext(ctx, e.toolCheck.AvifencPath, args...)
-
-		} else if e.toolCheck.HasFfmpeg {
-			// 回退到FFmpeg
-			toolName = "ffmpeg"
-			var args []string
-			args = append(args, "-i", task.SourcePath, "-c:v", "libaom-av1", "-crf", "30")
-			args = append(args, "-f", "avif") // 明确指定AVIF容器格式
-			args = append(args, "-y", task.TargetPath)
-			cmd = exec.CommandContext(ctx, e.toolCheck.FfmpegDevPath, args...)
-		} else {
-			return fmt.Errorf("没有可用的AVIF转换工具")
 		}
-	}
-
-	// 创建进程上下文
-	processCtx := &processmonitor.ProcessContext{
-		Operation:       "avif_conversion",
-		SourceFile:      task.SourcePath,
-		FileSize:        fileInfo.Size(),
-		FileFormat:      "avif",
-		ComplexityLevel: processmonitor.ComplexityHigh, // AVIF编码复杂度高
-		Priority:        processmonitor.PriorityNormal,
-		Metadata:        map[string]string{"tool": toolName, "mode": mode},
-	}
+		backup.Operation = "avif_conversion_backup"
+		backup.Metadata = map[string]string{"mode": mode, "operation": "avif_backup"}
 
-	// 使用进程监控器执行命令
-	err = e.processMonitor.MonitorCommand(ctx, cmd, processCtx)
-	if err != nil {
-		// README要求：添加后备转换机制
-		// 当AVIF转换失败时，尝试使用不同的编码器作为后备方案
-		e.logger.Warn("AVIF转换失败，尝试使用后备方案", 
-			zap.String("source", filepath.Base(task.SourcePath)), 
-			zap.Error(err))
-		
-		// 后备方案：使用不同的编码器
-		if toolName == "ffmpeg" {
-			var backupArgs []string
-			backupArgs = append(backupArgs, "-i", task.SourcePath)
-			
-			// 尝试使用libsvtav1编码器作为后备
-			switch mode {
-			case "compressed":
-				backupArgs = append(backupArgs, "-c:v", "libsvtav1", "-crf", "40")
-			case "balanced":
-				backupArgs = append(backupArgs, "-c:v", "libsvtav1", "-crf", "35")
-			default:
-				backupArgs = append(backupArgs, "-c:v", "libsvtav1", "-crf", "30")
-			}
-			
-			backupArgs = append(backupArgs, "-f", "avif")
-			backupArgs = append(backupArgs, "-y", task.TargetPath)
-			
-			// 创建后备命令
-			backupCmd := exec.CommandContext(ctx, e.toolCheck.FfmpegStablePath, backupArgs...)
-			
-			// 更新进程上下文
-			processCtx.Operation = "avif_conversion_backup"
-			processCtx.Metadata["operation"] = "avif_backup"
-			
-			// 使用进程监控器执行后备命令
-			backupErr := e.processMonitor.MonitorCommand(ctx, backupCmd, processCtx)
-			if backupErr != nil {
-				return fmt.Errorf("AVIF转换失败，后备方案也失败: %w", backupErr)
-			}
-			
-			e.logger.Info("AVIF转换后备方案成功", zap.String("target", filepath.Base(task.TargetPath)))
-			return nil
+		if _, backupErr := RunEncoderChain(ctx, e.logger, backupChain, &backup); backupErr != nil {
+			return fmt.Errorf("AVIF转换失败，后备方案也失败: %w", backupErr)
 		}
-		
-		return fmt.Errorf("AVIF转换失败: %w", err)
+		e.logger.Info("AVIF转换后备方案成功", zap.String("target", filepath.Base(task.TargetPath)))
+		return nil
 	}
 
 	e.logger.Debug("AVIF转换完成", zap.String("target", filepath.Base(task.TargetPath)))
@@ -1502,99 +1588,58 @@ func (e *ConversionEngine) remuxVideo(ctx context.Context, task ConversionTask)
 		zap.String("source", filepath.Base(task.SourcePath)),
 		zap.String("target", filepath.Base(task.TargetPath)))
 
-	// 检查FFmpeg可用性
-	if !e.toolCheck.HasFfmpeg {
+	ext := strings.ToLower(filepath.Ext(task.TargetPath))
+	chain := e.encoders.ChainFor(filepath.Ext(task.SourcePath), strings.TrimPrefix(ext, "."))
+	if len(chain) == 0 {
 		return fmt.Errorf("FFmpeg不可用，无法执行视频重包装")
 	}
 
-	// 获取文件信息用于超时估算
-	fileInfo, err := os.Stat(task.SourcePath)
-	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
-	}
-
-	// 构建命令参数：重包装不重新编码，只改变容器格式
-	var args []string
-	args = append(args, "-i", task.SourcePath)
-	args = append(args, "-c", "copy")                      // 复制流，不重新编码
-	args = append(args, "-avoid_negative_ts", "make_zero") // 处理时间戳
-	
 	// README新增要求：明确指定容器参数以解决"Could not find tag for codec"等错误
-	ext := strings.ToLower(filepath.Ext(task.TargetPath))
+	var container string
 	switch ext {
 	case ".mov":
-		args = append(args, "-f", "mov") // 明确指定MOV容器格式
+		container = "mov"
 	case ".mp4":
-		args = append(args, "-f", "mp4") // 明确指定MP4容器格式
+		container = "mp4"
 	case ".avi":
-		args = append(args, "-f", "avi") // 明确指定AVI容器格式
+		container = "avi"
 	case ".mkv":
-		args = append(args, "-f", "matroska") // 明确指定MKV容器格式
+		container = "matroska"
 	case ".webm":
-		args = append(args, "-f", "webm") // 明确指定WebM容器格式
+		container = "webm"
 	}
-	
-	args = append(args, "-y", task.TargetPath)             // 覆盖输出文件
-
-	// 创建命令
-	cmd := exec.CommandContext(ctx, e.toolCheck.FfmpegDevPath, args...)
 
-	// 创建进程上下文
-	processCtx := &processmonitor.ProcessContext{
-		Operation:       "video_remux",
-		SourceFile:      task.SourcePath,
-		FileSize:        fileInfo.Size(),
-		FileFormat:      "video",
-		ComplexityLevel: processmonitor.ComplexityLow, // 重包装复杂度低
-		Priority:        processmonitor.PriorityNormal,
-		Metadata:        map[string]string{"operation": "remux"},
+	// 重包装不重新编码，只改变容器格式
+	job := &EncodeJob{
+		SourcePath:   task.SourcePath,
+		TargetPath:   task.TargetPath,
+		OutputFormat: strings.TrimPrefix(ext, "."),
+		CopyStreams:  true,
+		Container:    container,
+		Operation:    "video_remux",
+		Complexity:   processmonitor.ComplexityLow, // 重包装复杂度低
+		Metadata:     map[string]string{"operation": "remux"},
 	}
 
-	// 使用进程监控器执行命令
-	err = e.processMonitor.MonitorCommand(ctx, cmd, processCtx)
-	if err != nil {
+	// 重包装只使用首选编码器，失败后直接进入重新编码后备方案
+	if _, err := RunEncoderChain(ctx, e.logger, chain[:1], job); err != nil {
 		// README要求：添加后备转换机制
-		// 当重包装失败时，尝试使用不同的参数进行后备转换
-		e.logger.Warn("视频重包装失败，尝试使用后备方案", 
-			zap.String("source", filepath.Base(task.SourcePath)), 
+		// 当重包装失败时，使用重新编码而非直接复制流
+		e.logger.Warn("视频重包装失败，尝试使用后备方案",
+			zap.String("source", filepath.Base(task.SourcePath)),
 			zap.Error(err))
-		
-		// 后备方案：使用重新编码而非直接复制流
-		var backupArgs []string
-		backupArgs = append(backupArgs, "-i", task.SourcePath)
-		backupArgs = append(backupArgs, "-c:v", "libx264", "-c:a", "aac") // 使用标准编码器
-		backupArgs = append(backupArgs, "-avoid_negative_ts", "make_zero")
-		
-		// 同样明确指定容器格式
-		switch ext {
-		case ".mov":
-			backupArgs = append(backupArgs, "-f", "mov")
-		case ".mp4":
-			backupArgs = append(backupArgs, "-f", "mp4")
-		case ".avi":
-			backupArgs = append(backupArgs, "-f", "avi")
-		case ".mkv":
-			backupArgs = append(backupArgs, "-f", "matroska")
-		case ".webm":
-			backupArgs = append(backupArgs, "-f", "webm")
-		}
-		
-		backupArgs = append(backupArgs, "-y", task.TargetPath)
-		
-		// 创建后备命令
-		backupCmd := exec.CommandContext(ctx, e.toolCheck.FfmpegDevPath, backupArgs...)
-		
-		// 更新进程上下文
-		processCtx.Operation = "video_remux_backup"
-		processCtx.ComplexityLevel = processmonitor.ComplexityHigh // 重新编码复杂度高
-		processCtx.Metadata["operation"] = "remux_backup"
-		
-		// 使用进程监控器执行后备命令
-		backupErr := e.processMonitor.MonitorCommand(ctx, backupCmd, processCtx)
-		if backupErr != nil {
+
+		job.CopyStreams = false
+		job.VideoCodec = "libx264" // 使用标准编码器
+		job.AudioCodec = "aac"
+		job.Operation = "video_remux_backup"
+		job.Complexity = processmonitor.ComplexityHigh // 重新编码复杂度高
+		job.Metadata["operation"] = "remux_backup"
+
+		if _, backupErr := RunEncoderChain(ctx, e.logger, chain[:1], job); backupErr != nil {
 			return fmt.Errorf("视频重包装失败，后备方案也失败: %w", backupErr)
 		}
-		
+
 		e.logger.Info("视频重包装后备方案成功", zap.String("target", filepath.Base(task.TargetPath)))
 		return nil
 	}
@@ -1603,11 +1648,28 @@ func (e *ConversionEngine) remuxVideo(ctx context.Context, task ConversionTask)
 	return nil
 }
 
+// transcodeVideo 视频转码；命中跳过规则或体积减少不足时保留原文件
+func (e *ConversionEngine) transcodeVideo(ctx context.Context, task ConversionTask) error {
+	if e.videoTranscoder == nil {
+		return e.remuxVideo(ctx, task)
+	}
+
+	result, err := e.videoTranscoder.Transcode(ctx, task.SourcePath, task.TargetPath)
+	if err != nil {
+		return err
+	}
+	if result.Skipped {
+		return &KeepOriginalError{SourcePath: task.SourcePath, Reason: result.SkipReason}
+	}
+	return nil
+}
+
 // generateReport 生成报告
 func (e *ConversionEngine) generateReport(results []ConversionResult) {
 	successCount := 0
 	failCount := 0
 	skippedCount := 0
+	var keptResults []ConversionResult
 	var totalOriginalSize int64
 	var totalNewSize int64
 	var totalDuration time.Duration
@@ -1622,6 +1684,8 @@ func (e *ConversionEngine) generateReport(results []ConversionResult) {
 			failCount++
 		case "skipped":
 			skippedCount++
+		case "kept":
+			keptResults = append(keptResults, result)
 		}
 		totalDuration += result.Duration
 	}
@@ -1647,6 +1711,18 @@ func (e *ConversionEngine) generateReport(results []ConversionResult) {
 	if skippedCount > 0 {
 		fmt.Printf("⏭️ 跳过处理: %d\n", skippedCount)
 	}
+	if len(keptResults) > 0 {
+		fmt.Printf("🛡️ 保留原文件: %d\n", len(keptResults))
+		for _, kept := range keptResults {
+			fmt.Printf("   - %s: %s\n", filepath.Base(kept.SourcePath), kept.Message)
+		}
+	}
+	if passed, kept := e.reconstructionPassed.Load(), e.reconstructionKept.Load(); passed+kept > 0 {
+		fmt.Printf("🔒 JPEG重建校验: 通过 %d, 未通过 %d\n", passed, kept)
+	}
+	if paired, rolledBack := e.livePhotoPaired.Load(), e.livePhotoRolledBack.Load(); paired+rolledBack > 0 {
+		fmt.Printf("📱 Live Photo: 成对完成 %d, 整体回滚 %d\n", paired, rolledBack)
+	}
 
 	if successCount > 0 {
 		fmt.Println(strings.Repeat("-", 30))
@@ -1683,6 +1759,11 @@ func (e *ConversionEngine) generateReport(results []ConversionResult) {
 		zap.Int("success", successCount),
 		zap.Int("failed", failCount),
 		zap.Int("skipped", skippedCount),
+		zap.Int("kept_original", len(keptResults)),
+		zap.Int64("jpeg_reconstruction_passed", e.reconstructionPassed.Load()),
+		zap.Int64("jpeg_reconstruction_kept", e.reconstructionKept.Load()),
+		zap.Int64("live_photo_paired", e.livePhotoPaired.Load()),
+		zap.Int64("live_photo_rolled_back", e.livePhotoRolledBack.Load()),
 		zap.Int64("original_size", totalOriginalSize),
 		zap.Int64("new_size", totalNewSize),
 		zap.Int64("space_saved", spaceSaved),
@@ -1717,6 +1798,8 @@ type ConversionTask struct {
 	Quality      string                 `json:"quality"`
 	MediaType    string                 `json:"media_type"`
 	Options      map[string]interface{} `json:"options,omitempty"`
+
+	trace *decisionTrace // 决策轨迹，不随任务持久化
 }
 
 // ConversionResult 转换结果
@@ -1730,6 +1813,8 @@ type ConversionResult struct {
 	Duration     time.Duration
 	OriginalSize int64 // 原始文件大小
 	NewSize      int64 // 转换后文件大小
+
+	Decisions []types.DecisionRecord // 转换阶段的决策记录（有损/无损选择、校验、重试）
 }
 
 // estimateFileCount 估算目录中的文件数量 - 新增方法
@@ -2026,6 +2111,11 @@ func (e *ConversionEngine) applyRoutingDecisions(tasks []ConversionTask, decisio
 
 	for _, task := range tasks {
 		if decision, exists := decisions[task.SourcePath]; exists {
+			task.trace.add(types.DecisionStageRouting, "应用路由决策", decision.Strategy, map[string]interface{}{
+				"rule":          measured(decision.Rule, decision.Rule != ""),
+				"target_format": measured(decision.TargetFormat, decision.TargetFormat != ""),
+			}, "")
+
 			// 根据路由决策更新任务
 			switch decision.Strategy {
 			case "skip":
@@ -2036,7 +2126,16 @@ func (e *ConversionEngine) applyRoutingDecisions(tasks []ConversionTask, decisio
 				os.Remove(task.SourcePath)
 				e.logger.Info("删除低品质文件", zap.String("file", filepath.Base(task.SourcePath)))
 				continue
+			case "keep":
+				// 路由规则要求保留原文件，记录为保留结果
+				task.TargetFormat = "keep"
+				task.Options = withTaskOption(task.Options, "rule", decision.Rule)
+				updatedTasks = append(updatedTasks, task)
 			default:
+				if decision.Rule != "" && decision.Rule != BuiltinRoutingRule {
+					updatedTasks = append(updatedTasks, e.applyRuleDecision(task, decision))
+					continue
+				}
 				// 更新任务的目标格式
 				task.TargetFormat = decision.TargetFormat
 				task.Quality = decision.QualityLevel.String()
@@ -2052,7 +2151,8 @@ func (e *ConversionEngine) applyRoutingDecisions(tasks []ConversionTask, decisio
 }
 
 // performBalanceOptimization 执行平衡优化 - 集成README要求的完整平衡优化逻辑
-func (e *ConversionEngine) performBalanceOptimization(ctx context.Context, task ConversionTask) error {
+// 优化结果原位替换源文件，返回源文件路径（无法优化时源文件保持不变）
+func (e *ConversionEngine) performBalanceOptimization(ctx context.Context, task ConversionTask) (string, error) {
 	e.logger.Debug("开始平衡优化", zap.String("file", filepath.Base(task.SourcePath)))
 
 	// 确定媒体类型
@@ -2071,20 +2171,48 @@ func (e *ConversionEngine) performBalanceOptimization(ctx context.Context, task
 	// 使用平衡优化器进行优化
 	result, err := e.balanceOptimizer.OptimizeFile(ctx, task.SourcePath, mediaType)
 	if err != nil {
-		return fmt.Errorf("平衡优化失败: %w", err)
+		return "", fmt.Errorf("平衡优化失败: %w", err)
 	}
 
 	if !result.Success {
+		task.trace.add(types.DecisionStageConversion, "平衡优化", "no_gain", map[string]interface{}{
+			"original_size": result.OriginalSize,
+		}, "所有尝试的输出都不小于原文件")
 		// README要求：无法优化时记录原因并标记为跳过
 		e.logger.Info("平衡优化无法减小文件体积",
 			zap.String("file", filepath.Base(task.SourcePath)),
 			zap.Int64("original_size", result.OriginalSize))
-		return nil // 不算错误，只是无法优化
+		return task.SourcePath, nil // 不算错误，只是无法优化，源文件保持不变
+	}
+
+	values := map[string]interface{}{
+		"method":        result.Method,
+		"quality":       result.Quality,
+		"original_size": result.OriginalSize,
+		"new_size":      result.NewSize,
+	}
+	var thresholds string
+	if result.Metric != "" {
+		values["metric"] = result.Metric
+		values["metric_score"] = result.MetricScore
+		values["chosen_quality"] = result.ChosenQuality
+		values["probes"] = result.Probes
+		thresholds = "目标质量搜索选取达到指标目标的最低编码质量"
+	}
+	task.trace.add(types.DecisionStageConversion, "平衡优化", result.Method, values, thresholds)
+
+	// 替换会覆盖原文件，元数据必须先迁移到输出；
+	// JPEG无损重新包装在迁移之后、替换（删除）原文件之前必须通过逐位重建校验
+	e.migrateMetadata(ctx, task.SourcePath, result.OutputPath)
+	if result.Method == "lossless_repack" && isJPEGExt(task.SourcePath) {
+		if err := e.verifyLosslessJPEG(ctx, task.SourcePath, result.OutputPath); err != nil {
+			return "", err
+		}
 	}
 
 	// 成功优化，替换原文件
 	if err := e.replaceOriginalFile(task.SourcePath, result.OutputPath); err != nil {
-		return fmt.Errorf("替换原文件失败: %w", err)
+		return "", fmt.Errorf("替换原文件失败: %w", err)
 	}
 
 	e.logger.Info("平衡优化成功",
@@ -2094,7 +2222,99 @@ func (e *ConversionEngine) performBalanceOptimization(ctx context.Context, task
 		zap.Int64("space_saved", result.SpaceSaved),
 		zap.Duration("process_time", result.ProcessTime))
 
-	return nil
+	if result.Metric != "" {
+		e.logger.Info("目标质量达成",
+			zap.String("file", filepath.Base(task.SourcePath)),
+			zap.String("metric", result.Metric),
+			zap.Float64("score", result.MetricScore),
+			zap.Int("chosen_quality", result.ChosenQuality),
+			zap.Int("probes", result.Probes))
+	}
+
+	return task.SourcePath, nil
+}
+
+// migrateMetadata 将源文件的EXIF、ICC等元数据迁移到输出文件
+// README要求：强制迁移元数据；迁移失败只记录警告，不影响转换结果
+func (e *ConversionEngine) migrateMetadata(ctx context.Context, sourcePath, targetPath string) {
+	if !e.toolCheck.HasExiftool {
+		e.logger.Warn("exiftool不可用，跳过元数据迁移")
+		return
+	}
+
+	migrator := metamigrator.NewMetadataMigrator(e.logger, e.toolCheck.ExiftoolPath)
+	if _, err := migrator.MigrateMetadata(ctx, sourcePath, targetPath); err != nil {
+		e.logger.Warn("元数据迁移失败",
+			zap.String("source", filepath.Base(sourcePath)),
+			zap.String("target", filepath.Base(targetPath)),
+			zap.Error(err))
+		return
+	}
+	e.logger.Info("元数据迁移完成",
+		zap.String("source", filepath.Base(sourcePath)),
+		zap.String("target", filepath.Base(targetPath)))
+}
+
+// verifyLosslessJPEG 校验JXL能否逐位重建原始JPEG，结果写入状态数据库
+// 校验失败或无法校验时删除JXL输出并返回 KeepOriginalError
+func (e *ConversionEngine) verifyLosslessJPEG(ctx context.Context, sourcePath, jxlPath string) error {
+	record := &types.VerificationRecord{
+		SourcePath: sourcePath,
+		OutputPath: jxlPath,
+		Kind:       "jpeg_reconstruction",
+		VerifiedAt: time.Now(),
+	}
+
+	var reason string
+	if e.jpegVerifier == nil {
+		reason = "未配置JPEG重建校验器"
+	} else if check, err := e.jpegVerifier.Verify(ctx, sourcePath, jxlPath); err != nil {
+		reason = err.Error()
+	} else {
+		record.SourceSHA256 = check.SourceSHA256
+		record.ReconstructedSHA256 = check.ReconstructedSHA256
+		if !check.Match {
+			reason = fmt.Sprintf("重建JPEG的SHA-256不一致 (原始 %.12s, 重建 %.12s)", check.SourceSHA256, check.ReconstructedSHA256)
+		}
+	}
+
+	if reason == "" {
+		record.Passed = true
+		record.Action = "accepted"
+		e.reconstructionPassed.Add(1)
+		e.recordVerification(record)
+		e.logger.Debug("JPEG重建校验通过",
+			zap.String("file", filepath.Base(sourcePath)),
+			zap.String("sha256", record.SourceSHA256))
+		return nil
+	}
+
+	record.Action = "kept_original"
+	record.Error = reason
+	e.reconstructionKept.Add(1)
+	e.recordVerification(record)
+
+	if err := os.Remove(jxlPath); err != nil && !os.IsNotExist(err) {
+		e.logger.Warn("删除未通过校验的JXL失败", zap.String("file", jxlPath), zap.Error(err))
+	}
+	e.logger.Warn("JPEG重建校验未通过，保留原文件",
+		zap.String("file", filepath.Base(sourcePath)),
+		zap.String("reason", reason))
+
+	return &KeepOriginalError{SourcePath: sourcePath, Reason: "JPEG重建校验未通过: " + reason}
+}
+
+// recordVerification 将校验记录写入状态数据库，未通过的记录同时计入HTML报告
+func (e *ConversionEngine) recordVerification(record *types.VerificationRecord) {
+	if !record.Passed {
+		e.runReport.addValidationFailure(verificationFailure(record))
+	}
+	if e.stateManager == nil {
+		return
+	}
+	if err := e.stateManager.SaveVerification(record); err != nil {
+		e.logger.Warn("保存校验记录失败", zap.String("file", record.SourcePath), zap.Error(err))
+	}
 }
 
 // replaceOriginalFile 安全地替换原文件
@@ -2123,80 +2343,3 @@ func (e *ConversionEngine) CleanupBalanceOptimizer() {
 		e.balanceOptimizer.CleanupTempFiles()
 	}
 }
-
-// SaveTasks 保存转换任务
-func (e *ConversionEngine) SaveTasks(tasks []ConversionTask) error {
-	e.logger.Debug("保存转换任务到状态管理器")
-
-	if e.stateManager == nil {
-		return fmt.Errorf("状态管理器未初始化")
-	}
-
-	// 转换为types.ProcessingResult并保存
-	var results []*types.ProcessingResult
-	for _, task := range tasks {
-		results = append(results, &types.ProcessingResult{
-			OriginalPath: task.SourcePath,
-			NewPath:      task.TargetPath,
-			Mode:         e.convertModeToAppMode(task.Mode), // 转换模式
-		})
-	}
-	
-	// 由于StateManager没有直接保存ConversionTask的方法，我们将其转换为ProcessingResult保存
-	// 这可能不是最佳方案，但可以暂时解决编译问题
-	return e.stateManager.SaveResults(results)
-}
-
-// LoadTasks 加载转换任务
-func (e *ConversionEngine) LoadTasks() ([]ConversionTask, error) {
-	e.logger.Debug("从状态管理器加载转换任务")
-
-	if e.stateManager == nil {
-		return nil, fmt.Errorf("状态管理器未初始化")
-	}
-
-	// 加载ProcessingResult并转换为ConversionTask
-	results, err := e.stateManager.LoadResults()
-	if err != nil {
-		return nil, err
-	}
-
-	var tasks []ConversionTask
-	for _, result := range results {
-		tasks = append(tasks, ConversionTask{
-			SourcePath: result.OriginalPath,
-			TargetPath: result.NewPath,
-			Mode:       e.convertAppModeToMode(result.Mode), // 转换模式
-		})
-	}
-	
-	return tasks, nil
-}
-
-// convertModeToAppMode 将字符串模式转换为AppMode
-func (e *ConversionEngine) convertModeToAppMode(mode string) types.AppMode {
-	switch mode {
-	case "auto+":
-		return types.ModeAutoPlus
-	case "quality":
-		return types.ModeQuality
-	case "sticker":
-		return types.ModeEmoji
-	default:
-		return types.ModeAutoPlus
-	}
-}
-
-// convertAppModeToMode 将AppMode转换为字符串模式
-func (e *ConversionEngine) convertAppModeToMode(mode types.AppMode) string {
-	switch mode {
-	case types.ModeAutoPlus:
-		return "auto+"
-	case types.ModeQuality:
-		return "quality"
-	case types.ModeEmoji:
-		return "sticker"
-	default:
-		return "auto+"
-	}
-}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"path/filepath"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine/quality"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 🧭 决策轨迹 - 记录单个文件在评估、路由和转换中每一步的依据，供 pixly explain 查看
+// =============================================================================
+//
+// 评估阶段的记录在文件写入队列时整体保存（替换上一轮的轨迹），转换阶段的记录
+// 随转换结果返回，与最终结果一起追加；从队列恢复的单元只追加转换和结果记录。
+
+// decisionTrace 单个文件累积的决策记录；nil 时不记录
+type decisionTrace struct {
+	records []types.DecisionRecord
+}
+
+// add 追加一条记录，values 中为 nil 的值（未测量）不保存
+func (t *decisionTrace) add(stage, branch, outcome string, values map[string]interface{}, thresholds string) {
+	if t == nil {
+		return
+	}
+	t.records = append(t.records, types.NewDecisionRecord(stage, branch, outcome, values, thresholds))
+}
+
+// measured ok 为 false（未测量）时返回 nil，使该值不写入轨迹
+func measured(value interface{}, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return value
+}
+
+// traceAssessment 记录品质分级与模式推荐：使用的依据、测量值和阈值
+func (t *decisionTrace) traceAssessment(assessment *quality.QualityAssessment, cached bool) {
+	branch, _ := assessment.Details["classified_by"].(string)
+	if branch == "" {
+		branch = "unknown" // 旧版本写入的扫描索引没有分级依据
+	}
+	thresholds, _ := assessment.Details["thresholds"].(string)
+	hasDimensions := assessment.Width > 0 && assessment.Height > 0
+	hasJpegQuality := assessment.JpegQuality > 0
+	t.add(types.DecisionStageAssessment, branch, assessment.QualityLevel.String(), map[string]interface{}{
+		"media_type":    assessment.MediaType.String(),
+		"format":        measured(assessment.Format, assessment.Format != ""),
+		"file_size":     assessment.FileSize,
+		"width":         measured(assessment.Width, hasDimensions),
+		"height":        measured(assessment.Height, hasDimensions),
+		"pixel_density": measured(assessment.PixelDensity, hasDimensions),
+		"jpeg_quality":  measured(assessment.JpegQuality, hasJpegQuality),
+		"jpeg_resaved":  measured(assessment.JpegResaved, hasJpegQuality),
+		"score":         assessment.Score,
+		"confidence":    assessment.Confidence,
+		"from_index":    cached,
+	}, thresholds)
+
+	recommendedBy, _ := assessment.Details["recommended_by"].(string)
+	if recommendedBy == "" {
+		recommendedBy = "unknown"
+	}
+	t.add(types.DecisionStageRecommendation, recommendedBy, assessment.RecommendedMode.String(), map[string]interface{}{
+		"quality_level": assessment.QualityLevel.String(),
+	}, quality.ModeRecommendationThresholds)
+}
+
+// traceResult 记录最终的转换结果
+func traceResult(result ConversionResult) types.DecisionRecord {
+	trace := &decisionTrace{}
+	trace.add(types.DecisionStageResult, result.Status, result.Status, map[string]interface{}{
+		"message":       result.Message,
+		"target_path":   measured(result.TargetPath, result.TargetPath != ""),
+		"original_size": result.OriginalSize,
+		"new_size":      result.NewSize,
+		"duration_ms":   result.Duration.Milliseconds(),
+	}, "")
+	return trace.records[0]
+}
+
+// saveDecisions 保存文件本轮评估的决策轨迹，替换上一轮的轨迹
+func (e *ConversionEngine) saveDecisions(path string, trace *decisionTrace) {
+	if e.stateManager == nil || trace == nil {
+		return
+	}
+	if err := e.stateManager.SaveDecisions(path, trace.records); err != nil {
+		e.logger.Debug("保存决策轨迹失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
+
+// appendDecisions 在文件的决策轨迹末尾追加转换和结果记录
+func (e *ConversionEngine) appendDecisions(path string, records ...types.DecisionRecord) {
+	if e.stateManager == nil || len(records) == 0 {
+		return
+	}
+	if err := e.stateManager.AppendDecisions(path, records...); err != nil {
+		e.logger.Debug("追加决策轨迹失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
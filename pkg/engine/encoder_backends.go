@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/metrics"
+	"pixly/pkg/processmonitor"
+)
+
+// =============================================================================
+// cjxl 编码器
+// =============================================================================
+
+// CjxlEncoder 基于 cjxl 的 JXL 编码器
+type CjxlEncoder struct {
+	path      string
+	available bool
+	runner    CommandRunner
+}
+
+// NewCjxlEncoder 创建 cjxl 编码器
+func NewCjxlEncoder(toolPaths types.ToolCheckResults, runner CommandRunner) *CjxlEncoder {
+	path := toolPaths.CjxlPath
+	if path == "" {
+		path = "cjxl" // 工具检查器未记录路径时从PATH中查找
+	}
+	return &CjxlEncoder{path: path, available: toolPaths.HasCjxl, runner: runner}
+}
+
+func (c *CjxlEncoder) Name() string { return EncoderCjxl }
+
+func (c *CjxlEncoder) SupportedInputs() []string {
+	return []string{"jpg", "jpeg", "jpe", "jfif", "png", "apng", "gif", "ppm", "pgm", "pfm", "exr"}
+}
+
+func (c *CjxlEncoder) SupportedOutputs() []string { return []string{"jxl"} }
+
+func (c *CjxlEncoder) Probe() bool { return c.available }
+
+func (c *CjxlEncoder) Encode(ctx context.Context, job *EncodeJob) (*EncodeResult, error) {
+	args := []string{job.SourcePath, job.TargetPath}
+
+	switch {
+	case job.LosslessJPEG:
+		args = append(args, "--lossless_jpeg=1")
+	case job.Lossless:
+		args = append(args, "-q", "100")
+	case job.Distance > 0:
+		args = append(args, "-d", strconv.FormatFloat(job.Distance, 'f', -1, 64))
+	case job.Quality > 0:
+		args = append(args, "-q", strconv.Itoa(job.Quality))
+	}
+	if job.Effort > 0 {
+		args = append(args, "-e", strconv.Itoa(job.Effort))
+	}
+
+	return runEncoderCommand(ctx, c.runner, c.Name(), c.path, args, job)
+}
+
+// =============================================================================
+// avifenc 编码器
+// =============================================================================
+
+// AvifencEncoder 基于 avifenc 的静态 AVIF 编码器
+type AvifencEncoder struct {
+	path      string
+	available bool
+	runner    CommandRunner
+}
+
+// NewAvifencEncoder 创建 avifenc 编码器
+func NewAvifencEncoder(toolPaths types.ToolCheckResults, runner CommandRunner) *AvifencEncoder {
+	return &AvifencEncoder{
+		path:      toolPaths.AvifencPath,
+		available: toolPaths.HasAvifenc && toolPaths.AvifencPath != "",
+		runner:    runner,
+	}
+}
+
+func (a *AvifencEncoder) Name() string { return EncoderAvifenc }
+
+// SupportedInputs avifenc 只接受静态输入，动图必须走 FFmpeg
+func (a *AvifencEncoder) SupportedInputs() []string {
+	return []string{"jpg", "jpeg", "jpe", "jfif", "png", "y4m"}
+}
+
+func (a *AvifencEncoder) SupportedOutputs() []string { return []string{"avif"} }
+
+func (a *AvifencEncoder) Probe() bool { return a.available }
+
+func (a *AvifencEncoder) Encode(ctx context.Context, job *EncodeJob) (*EncodeResult, error) {
+	args := []string{job.SourcePath, job.TargetPath}
+
+	if job.Lossless {
+		args = append(args, "--lossless")
+	} else if job.Quality > 0 {
+		args = append(args, "-q", strconv.Itoa(job.Quality))
+	}
+	if job.Speed > 0 {
+		args = append(args, "-s", strconv.Itoa(job.Speed))
+	}
+
+	return runEncoderCommand(ctx, a.runner, a.Name(), a.path, args, job)
+}
+
+// =============================================================================
+// FFmpeg 编码器（开发版 / 稳定版共用实现）
+// =============================================================================
+
+// FfmpegEncoder 基于 FFmpeg 的通用编码器
+type FfmpegEncoder struct {
+	name      string
+	path      string
+	available bool
+	runner    CommandRunner
+}
+
+// NewFfmpegEncoder 创建 FFmpeg 编码器，name 用于区分开发版与稳定版
+func NewFfmpegEncoder(name string, hasFfmpeg bool, path string, runner CommandRunner) *FfmpegEncoder {
+	return &FfmpegEncoder{
+		name:      name,
+		path:      path,
+		available: hasFfmpeg && path != "",
+		runner:    runner,
+	}
+}
+
+func (f *FfmpegEncoder) Name() string { return f.name }
+
+func (f *FfmpegEncoder) SupportedInputs() []string { return []string{"*"} }
+
+func (f *FfmpegEncoder) SupportedOutputs() []string {
+	return []string{"jxl", "avif", "webp", "mp4", "mov", "mkv", "webm", "avi"}
+}
+
+func (f *FfmpegEncoder) Probe() bool { return f.available }
+
+func (f *FfmpegEncoder) Encode(ctx context.Context, job *EncodeJob) (*EncodeResult, error) {
+	args := []string{"-i", job.SourcePath}
+
+	switch {
+	case job.CopyStreams:
+		args = append(args, "-c", "copy", "-avoid_negative_ts", "make_zero")
+	case job.OutputFormat == "jxl":
+		quality := "85"
+		if job.Lossless || job.LosslessJPEG {
+			quality = "0"
+		} else if job.Quality > 0 {
+			quality = strconv.Itoa(job.Quality)
+		}
+		args = append(args, "-c:v", "libjxl", "-q:v", quality)
+	case job.OutputFormat == "avif":
+		codec := job.VideoCodec
+		if codec == "" {
+			codec = "libaom-av1"
+		}
+		args = append(args, "-c:v", codec)
+		if job.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(job.CRF))
+		}
+		if job.Speed > 0 {
+			args = append(args, av1SpeedArgs(codec, job.Speed)...)
+		}
+	case job.OutputFormat == "webp":
+		args = append(args, "-c:v", "libwebp")
+		if job.Quality > 0 {
+			args = append(args, "-quality", strconv.Itoa(job.Quality))
+		}
+	default:
+		// 视频重新编码
+		if job.VideoCodec != "" {
+			args = append(args, "-c:v", job.VideoCodec)
+		}
+		if job.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(job.CRF))
+		}
+		if job.AudioCodec != "" {
+			args = append(args, "-c:a", job.AudioCodec)
+		}
+		args = append(args, "-avoid_negative_ts", "make_zero")
+	}
+
+	if job.Container != "" {
+		args = append(args, "-f", job.Container)
+	}
+	args = append(args, "-y", job.TargetPath)
+
+	return runEncoderCommand(ctx, f.runner, f.Name(), f.path, args, job)
+}
+
+// av1SpeedArgs 将 avifenc 的速度（-s 0-10）映射为 FFmpeg AV1 编码器的速度参数
+func av1SpeedArgs(codec string, speed int) []string {
+	switch codec {
+	case "libaom-av1":
+		// libaom 的 -cpu-used 只接受 0-8
+		return []string{"-cpu-used", strconv.Itoa(min(speed, 8))}
+	case "libsvtav1":
+		// SVT-AV1 使用 -preset（0-13）
+		return []string{"-preset", strconv.Itoa(min(speed, 13))}
+	default:
+		// 其他编码器（如由 FFmpeg 选择的 av1）保持默认速度
+		return nil
+	}
+}
+
+// runEncoderCommand 执行编码命令并收集结果（有 runner 时通过进程监控器执行）
+func runEncoderCommand(ctx context.Context, runner CommandRunner, name, path string, args []string, job *EncodeJob) (*EncodeResult, error) {
+	startTime := time.Now()
+
+	sourceInfo, err := os.Stat(job.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("获取源文件信息失败: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+
+	if runner != nil {
+		operation := job.Operation
+		if operation == "" {
+			operation = job.OutputFormat + "_conversion"
+		}
+		metadata := map[string]string{"tool": name}
+		for k, v := range job.Metadata {
+			metadata[k] = v
+		}
+		processCtx := &processmonitor.ProcessContext{
+			Operation:       operation,
+			SourceFile:      job.SourcePath,
+			TargetFile:      job.TargetPath,
+			FileSize:        sourceInfo.Size(),
+			FileFormat:      job.OutputFormat,
+			ComplexityLevel: job.Complexity,
+			Priority:        processmonitor.PriorityNormal,
+			Metadata:        metadata,
+		}
+		err = runner.MonitorCommand(ctx, cmd, processCtx)
+	} else {
+		err = cmd.Run()
+	}
+	status := "success"
+	if err != nil {
+		status = "failed"
+	}
+	metrics.EncoderDuration.WithLabelValues(name, status).ObserveDuration(time.Since(startTime))
+	if err != nil {
+		return nil, fmt.Errorf("%s编码失败: %w", name, err)
+	}
+
+	targetInfo, err := os.Stat(job.TargetPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s未生成输出文件: %w", name, err)
+	}
+
+	return &EncodeResult{
+		Encoder:    name,
+		OutputPath: job.TargetPath,
+		OutputSize: targetInfo.Size(),
+		Duration:   time.Since(startTime),
+	}, nil
+}
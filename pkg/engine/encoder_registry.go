@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/metrics"
+	"pixly/pkg/processmonitor"
+
+	"go.uber.org/zap"
+)
+
+// 内置编码器名称
+const (
+	EncoderCjxl         = "cjxl"
+	EncoderAvifenc      = "avifenc"
+	EncoderFfmpegDev    = "ffmpeg-dev"
+	EncoderFfmpegStable = "ffmpeg-stable"
+)
+
+// Encoder 编码器接口 - 将一次编码任务翻译为具体工具的调用
+type Encoder interface {
+	// Name 编码器名称（在注册表中唯一）
+	Name() string
+
+	// SupportedInputs 支持的输入格式（不带点的小写扩展名，"*" 表示任意）
+	SupportedInputs() []string
+
+	// SupportedOutputs 支持的输出格式（如 "jxl", "avif", "mp4"）
+	SupportedOutputs() []string
+
+	// Probe 能力探测：编码器当前是否可用
+	Probe() bool
+
+	// Encode 执行编码
+	Encode(ctx context.Context, job *EncodeJob) (*EncodeResult, error)
+}
+
+// EncodeJob 编码任务 - 与具体工具无关的编码参数描述
+type EncodeJob struct {
+	SourcePath   string
+	TargetPath   string
+	OutputFormat string // "jxl", "avif", "webp", "mp4", "mov" ...
+	MediaType    types.MediaType
+
+	Lossless     bool    // 数学无损
+	LosslessJPEG bool    // JPEG无损重新包装（仅cjxl可保证可逆）
+	Quality      int     // 质量参数，0表示使用编码器默认值
+	Distance     float64 // JXL distance，>0 时优先于 Quality
+	Effort       int     // cjxl -e
+	Speed        int     // avifenc -s（0-10），FFmpeg AV1 编码时按编码器映射
+	CRF          int     // ffmpeg -crf
+
+	VideoCodec  string // ffmpeg 视频编码器，如 libaom-av1
+	AudioCodec  string // ffmpeg 音频编码器
+	CopyStreams bool   // 仅复制流（视频重包装）
+	Container   string // ffmpeg -f 容器格式，为空时由ffmpeg推断
+
+	// 进程监控相关
+	Operation  string
+	Complexity processmonitor.ComplexityLevel
+	Metadata   map[string]string
+}
+
+// EncodeResult 编码结果
+type EncodeResult struct {
+	Encoder    string
+	OutputPath string
+	OutputSize int64
+	Duration   time.Duration
+}
+
+// CommandRunner 外部命令执行器 - ProcessMonitor 实现了该接口
+type CommandRunner interface {
+	MonitorCommand(ctx context.Context, cmd *exec.Cmd, processCtx *processmonitor.ProcessContext) error
+}
+
+// EncoderRegistry 编码器注册表 - 注册顺序即后备链的优先级
+type EncoderRegistry struct {
+	mu       sync.RWMutex
+	encoders map[string]Encoder
+	order    []string
+}
+
+// NewEncoderRegistry 创建空的编码器注册表
+func NewEncoderRegistry() *EncoderRegistry {
+	return &EncoderRegistry{
+		encoders: make(map[string]Encoder),
+	}
+}
+
+// NewDefaultEncoderRegistry 创建注册了内置编码器的注册表
+// 顺序：cjxl → avifenc → ffmpeg-dev → ffmpeg-stable
+func NewDefaultEncoderRegistry(toolPaths types.ToolCheckResults, runner CommandRunner) *EncoderRegistry {
+	registry := NewEncoderRegistry()
+	registry.Register(NewCjxlEncoder(toolPaths, runner))
+	registry.Register(NewAvifencEncoder(toolPaths, runner))
+	registry.Register(NewFfmpegEncoder(EncoderFfmpegDev, toolPaths.HasFfmpeg, toolPaths.FfmpegDevPath, runner))
+	registry.Register(NewFfmpegEncoder(EncoderFfmpegStable, toolPaths.HasFfmpeg, toolPaths.FfmpegStablePath, runner))
+	return registry
+}
+
+// Register 注册编码器；同名编码器会被替换并保留原有位置
+func (r *EncoderRegistry) Register(encoder Encoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := encoder.Name()
+	if _, exists := r.encoders[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.encoders[name] = encoder
+}
+
+// Unregister 移除编码器
+func (r *EncoderRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.encoders[name]; !exists {
+		return
+	}
+	delete(r.encoders, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Get 按名称获取编码器
+func (r *EncoderRegistry) Get(name string) (Encoder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	encoder, exists := r.encoders[name]
+	return encoder, exists
+}
+
+// Names 按注册顺序返回编码器名称
+func (r *EncoderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.order))
+	copy(names, r.order)
+	return names
+}
+
+// Chain 按给定名称顺序组成后备链，跳过未注册或探测失败的编码器
+func (r *EncoderRegistry) Chain(names ...string) []Encoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var chain []Encoder
+	for _, name := range names {
+		if encoder, exists := r.encoders[name]; exists && encoder.Probe() {
+			chain = append(chain, encoder)
+		}
+	}
+	return chain
+}
+
+// ChainFor 按注册顺序返回支持指定输入/输出格式且可用的编码器
+func (r *EncoderRegistry) ChainFor(inputFormat, outputFormat string) []Encoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inputFormat = normalizeFormat(inputFormat)
+	outputFormat = normalizeFormat(outputFormat)
+
+	var chain []Encoder
+	for _, name := range r.order {
+		encoder := r.encoders[name]
+		if !supportsFormat(encoder.SupportedInputs(), inputFormat) ||
+			!supportsFormat(encoder.SupportedOutputs(), outputFormat) {
+			continue
+		}
+		if encoder.Probe() {
+			chain = append(chain, encoder)
+		}
+	}
+	return chain
+}
+
+// RunEncoderChain 依次尝试后备链中的编码器，直到有一个成功
+func RunEncoderChain(ctx context.Context, logger *zap.Logger, chain []Encoder, job *EncodeJob) (*EncodeResult, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("没有可用的%s编码器", strings.ToUpper(job.OutputFormat))
+	}
+
+	var lastErr error
+	for i, encoder := range chain {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := encoder.Encode(ctx, job)
+		if err == nil {
+			if i > 0 {
+				logger.Info("后备编码器转换成功",
+					zap.String("encoder", encoder.Name()),
+					zap.String("target", filepath.Base(job.TargetPath)))
+			}
+			return result, nil
+		}
+
+		lastErr = err
+		// 清理失败编码器可能留下的部分输出
+		os.Remove(job.TargetPath)
+
+		if i < len(chain)-1 {
+			metrics.EncoderFallbacks.WithLabelValues(encoder.Name(), chain[i+1].Name()).Inc()
+			logger.Warn("编码器转换失败，尝试下一个后备编码器",
+				zap.String("encoder", encoder.Name()),
+				zap.String("next", chain[i+1].Name()),
+				zap.String("source", filepath.Base(job.SourcePath)),
+				zap.Error(err))
+		}
+	}
+
+	if len(chain) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("%s转换失败，所有后备编码器都失败: %w", strings.ToUpper(job.OutputFormat), lastErr)
+}
+
+// normalizeFormat 将扩展名规范化为不带点的小写格式名
+func normalizeFormat(format string) string {
+	return strings.TrimPrefix(strings.ToLower(format), ".")
+}
+
+// supportsFormat 检查格式列表是否包含指定格式（支持 "*" 通配）
+func supportsFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == "*" || f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/ui/progress"
+
+	"go.uber.org/zap"
+)
+
+// queuePollInterval 转换队列暂停或为空时重新检查的间隔
+const queuePollInterval = 500 * time.Millisecond
+
+// QueuedUnit 写入持久化队列的转换单元，分布式转换时原样交给工作节点
+type QueuedUnit struct {
+	Tasks []ConversionTask `json:"tasks"`
+	Pair  *LivePhotoPair   `json:"pair,omitempty"`
+}
+
+// conversionQueue 评估阶段与转换阶段之间的队列
+type conversionQueue interface {
+	// push 加入评估完成的单元
+	push(ctx context.Context, unit *pipelineUnit) error
+	// closeInput 评估阶段结束
+	closeInput()
+	// next 取下一个单元；评估结束且队列为空或 ctx 取消时返回 nil
+	next(ctx context.Context) *pipelineUnit
+	// finish 记录单元的转换结果
+	finish(ctx context.Context, unit *pipelineUnit, results []ConversionResult)
+}
+
+// memoryQueue 状态数据库不可用时使用的内存队列
+type memoryQueue struct {
+	units chan *pipelineUnit
+}
+
+func (q *memoryQueue) push(ctx context.Context, unit *pipelineUnit) error {
+	select {
+	case q.units <- unit:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *memoryQueue) closeInput() { close(q.units) }
+
+func (q *memoryQueue) next(ctx context.Context) *pipelineUnit {
+	select {
+	case unit := <-q.units:
+		return unit
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (q *memoryQueue) finish(context.Context, *pipelineUnit, []ConversionResult) {}
+
+// durableQueue 持久化转换队列：评估后的单元写入状态数据库，转换工作者按优先级出队
+// 进程中断后未完成的单元留在数据库中，下次运行时直接转换
+type durableQueue struct {
+	engine    *ConversionEngine
+	dir       string
+	notify    chan struct{} // 有新单元入队
+	inputDone chan struct{}
+	pausedLog chan struct{} // 关闭表示已提示过暂停
+}
+
+func (q *durableQueue) push(ctx context.Context, unit *pipelineUnit) error {
+	payload, err := json.Marshal(QueuedUnit{Tasks: unit.tasks, Pair: unit.pair})
+	if err != nil {
+		return fmt.Errorf("编码队列任务失败: %w", err)
+	}
+	members := make([]string, len(unit.tasks))
+	for i, task := range unit.tasks {
+		members[i] = task.SourcePath
+	}
+	if err := q.engine.stateManager.EnqueueJob(&state.QueueEntry{Path: members[0], Members: members, Payload: payload}); err != nil {
+		return err
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *durableQueue) closeInput() { close(q.inputDone) }
+
+func (q *durableQueue) next(ctx context.Context) *pipelineUnit {
+	for {
+		if q.engine.pause.wait(ctx) != nil {
+			return nil
+		}
+		// 先确认评估是否已结束，再出队：结束前入队的单元一定能取到
+		inputDone := isClosed(q.inputDone)
+		entry, err := q.engine.stateManager.DequeueJob(q.dir)
+		switch {
+		case errors.Is(err, state.ErrQueuePaused):
+			q.noticePaused()
+		case err != nil:
+			q.engine.logger.Warn("读取转换队列失败", zap.Error(err))
+			return nil
+		case entry != nil:
+			var payload QueuedUnit
+			if err := json.Unmarshal(entry.Payload, &payload); err != nil || len(payload.Tasks) == 0 {
+				q.engine.logger.Warn("无法解析队列任务", zap.String("file", filepath.Base(entry.Path)), zap.Error(err))
+				q.engine.stateManager.FailJob(entry.Path, "无法解析队列任务")
+				continue
+			}
+			return &pipelineUnit{tasks: payload.Tasks, pair: payload.Pair}
+		case inputDone:
+			return nil
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.inputDone:
+		case <-time.After(queuePollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// finish 全部成功时从队列删除；被取消时放回队列，下次运行继续；否则记录失败原因
+func (q *durableQueue) finish(ctx context.Context, unit *pipelineUnit, results []ConversionResult) {
+	path := unit.tasks[0].SourcePath
+	var failure *ConversionResult
+	for i := range results {
+		if results[i].Status == "failed" {
+			failure = &results[i]
+			break
+		}
+	}
+
+	var err error
+	switch {
+	case failure == nil && len(results) == len(unit.tasks):
+		err = q.engine.stateManager.CompleteJob(path)
+	case ctx.Err() != nil:
+		err = q.engine.stateManager.RequeueJob(path)
+	case failure != nil:
+		err = q.engine.stateManager.FailJob(path, failure.Message)
+	default:
+		err = q.engine.stateManager.FailJob(path, "转换未返回结果")
+	}
+	if err != nil {
+		q.engine.logger.Warn("更新转换队列失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
+
+func (q *durableQueue) noticePaused() {
+	if isClosed(q.pausedLog) {
+		return
+	}
+	close(q.pausedLog)
+	q.engine.logger.Info("转换队列已暂停，等待恢复")
+	fmt.Println("⏸️ 转换队列已暂停，等待恢复")
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// openConversionQueue 创建评估与转换之间的队列
+// 有状态数据库时使用持久化队列：先放回上次中断时正在转换的单元，已在队列中的单元计入转换总数；
+// 返回的集合为队列中排队、运行或已取消的文件，扫描时跳过。
+// recover 为 false 时（只规划）运行中的条目属于分布式工作节点的租约，不放回队列
+func (e *ConversionEngine) openConversionQueue(bufferSize int, recover bool, counters *pipelineCounters) (conversionQueue, map[string]bool) {
+	if e.stateManager == nil {
+		return &memoryQueue{units: make(chan *pipelineUnit, bufferSize)}, nil
+	}
+
+	dir := e.config.TargetDir
+	if recover {
+		requeued, failed, err := e.stateManager.RecoverQueue(dir)
+		if err != nil {
+			e.logger.Warn("恢复转换队列失败", zap.Error(err))
+		} else if requeued+failed > 0 {
+			e.logger.Info("恢复上次中断的转换", zap.Int("requeued", requeued), zap.Int("failed", failed))
+		}
+	}
+
+	skip := make(map[string]bool)
+	entries, err := e.stateManager.ListQueue(dir)
+	if err != nil {
+		e.logger.Warn("读取转换队列失败", zap.Error(err))
+	}
+	pending := 0
+	for _, entry := range entries {
+		if entry.State == state.QueueFailed {
+			continue // 失败的文件重新扫描后再次入队
+		}
+		for _, member := range entry.Members {
+			skip[member] = true
+		}
+		if entry.State == state.QueueQueued {
+			pending += len(entry.Members)
+		}
+	}
+	if pending > 0 {
+		counters.queued.Add(int64(pending))
+		e.progressManager.AddTotal(progress.ProgressTypeConversion, pending)
+	}
+
+	return &durableQueue{
+		engine:    e,
+		dir:       dir,
+		notify:    make(chan struct{}, 1),
+		inputDone: make(chan struct{}),
+		pausedLog: make(chan struct{}),
+	}, skip
+}
+
+// checkQueuePaused 队列已暂停时返回错误
+// 命令行运行期间数据库被本进程占用，无法从另一个进程恢复，因此在开始前检查；
+// 运行中暂停（HTTP 接口）时转换工作者等待恢复
+func (e *ConversionEngine) checkQueuePaused() error {
+	if e.stateManager == nil {
+		return nil
+	}
+	paused, err := e.stateManager.IsQueuePaused()
+	if err != nil {
+		return fmt.Errorf("读取转换队列状态失败: %w", err)
+	}
+	if paused {
+		return fmt.Errorf("%w，请先恢复队列（pixly queue resume 或 POST /queue/resume）", state.ErrQueuePaused)
+	}
+	return nil
+}
+
+// resumableQueue 上次运行已完整扫描且队列中还有未完成的单元时，本次直接从队列继续，不重新扫描
+func (e *ConversionEngine) resumableQueue() int {
+	if e.stateManager == nil {
+		return 0
+	}
+	scanned, err := e.stateManager.IsQueueScanned(e.config.TargetDir)
+	if err != nil || !scanned {
+		return 0
+	}
+	entries, err := e.stateManager.ListQueue(e.config.TargetDir)
+	if err != nil {
+		return 0
+	}
+	pending := 0
+	for _, entry := range entries {
+		if entry.State == state.QueueQueued || entry.State == state.QueueRunning {
+			pending++
+		}
+	}
+	return pending
+}
+
+// queueDiscovery 返回本次运行的发现阶段
+// 上次运行在扫描完成后中断时直接从队列继续，不重新扫描；否则完整扫描（已在队列中的文件跳过），完成后记录扫描完成标记
+func (e *ConversionEngine) queueDiscovery() discoverFunc {
+	if pending := e.resumableQueue(); pending > 0 {
+		e.logger.Info("从转换队列继续，跳过扫描", zap.Int("pending", pending))
+		fmt.Printf("📋 从转换队列继续上次未完成的 %d 个任务\n", pending)
+		return func(context.Context, func([]*types.MediaInfo) error) error { return nil }
+	}
+	return func(ctx context.Context, emit func([]*types.MediaInfo) error) error {
+		if err := e.walkTargetDir(ctx, emit); err != nil {
+			return err
+		}
+		e.setQueueScanned(true)
+		return nil
+	}
+}
+
+// Plan 扫描并评估目标目录，把转换单元写入持久化队列，不在本机转换
+// 分布式转换的协调节点使用：运行中的条目属于工作节点的租约，由协调节点负责放回队列
+func (e *ConversionEngine) Plan(ctx context.Context) error {
+	if err := e.validateConfig(); err != nil {
+		return fmt.Errorf("配置验证失败: %w", err)
+	}
+	if e.openState() {
+		defer e.stateManager.Close()
+	}
+	if e.stateManager == nil {
+		return fmt.Errorf("规划转换任务需要状态数据库")
+	}
+	if err := e.stateManager.SaveMediaFiles(nil); err != nil {
+		e.logger.Warn("重置媒体文件信息失败", zap.Error(err))
+	}
+
+	_, counters, err := e.runStreamingPipeline(ctx, e.queueDiscovery(), 0)
+	if err != nil {
+		return fmt.Errorf("规划转换任务失败: %w", err)
+	}
+	e.logger.Info("转换任务规划完成",
+		zap.Int64("discovered", counters.discovered.Load()),
+		zap.Int64("corrupted", counters.corrupted.Load()),
+		zap.Int64("queued", counters.queued.Load()))
+	return nil
+}
+
+// setQueueScanned 记录或清除目标目录的扫描完成标记
+func (e *ConversionEngine) setQueueScanned(scanned bool) {
+	if e.stateManager == nil {
+		return
+	}
+	var err error
+	if scanned {
+		err = e.stateManager.MarkQueueScanned(e.config.TargetDir)
+	} else {
+		err = e.stateManager.ClearQueueScanned(e.config.TargetDir)
+	}
+	if err != nil {
+		e.logger.Debug("更新扫描完成标记失败", zap.Error(err))
+	}
+}
+
+// queueFailed 单元无法入队时按转换失败记录
+func (e *ConversionEngine) queueFailed(unit *pipelineUnit, err error) {
+	e.logger.Warn("加入转换队列失败", zap.String("file", filepath.Base(unit.tasks[0].SourcePath)), zap.Error(err))
+	for _, task := range unit.tasks {
+		e.updateFileState(task.SourcePath, types.StatusFailed)
+		e.progressManager.UpdateProgress(progress.ProgressTypeConversion, 1)
+	}
+}
+
+// ConvertUnit 转换一个队列单元（分布式工作节点使用），Live Photo 两半整体处理
+func (e *ConversionEngine) ConvertUnit(ctx context.Context, unit QueuedUnit) []ConversionResult {
+	return e.convertUnit(ctx, &pipelineUnit{tasks: unit.Tasks, pair: unit.Pair})
+}
+
+// ReplacesSource 任务的输出是否原位替换源文件（平衡优化），此时结果的 TargetPath 等于 SourcePath
+func ReplacesSource(task ConversionTask) bool {
+	return task.TargetFormat == "avif_balanced"
+}
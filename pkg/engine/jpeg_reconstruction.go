@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pixly/pkg/processmonitor"
+)
+
+// JPEGReconstructionCheck JPEG逐位重建校验结果
+type JPEGReconstructionCheck struct {
+	SourceSHA256        string
+	ReconstructedSHA256 string
+	Match               bool
+	Duration            time.Duration
+}
+
+// JPEGReconstructionVerifier 使用 djxl 从 JXL 重建原始 JPEG 并比较 SHA-256
+//
+// cjxl --lossless_jpeg=1 会在 JXL 中保存 JPEG 重建数据（jbrd），
+// djxl 输出 .jpg 时优先使用这些数据逐位还原原始文件。
+type JPEGReconstructionVerifier struct {
+	djxlPath string
+	tempDir  string
+	runner   CommandRunner
+}
+
+// NewJPEGReconstructionVerifier 创建JPEG重建校验器；djxlPath 为空时从PATH中查找
+func NewJPEGReconstructionVerifier(djxlPath, tempDir string, runner CommandRunner) *JPEGReconstructionVerifier {
+	if djxlPath == "" {
+		djxlPath = lookPathOrEmpty("djxl")
+	}
+	return &JPEGReconstructionVerifier{djxlPath: djxlPath, tempDir: tempDir, runner: runner}
+}
+
+// Available djxl 是否可用
+func (v *JPEGReconstructionVerifier) Available() bool {
+	return v.djxlPath != ""
+}
+
+// Verify 从 jxlPath 重建 JPEG 并与 jpegPath 逐位比较
+func (v *JPEGReconstructionVerifier) Verify(ctx context.Context, jpegPath, jxlPath string) (*JPEGReconstructionCheck, error) {
+	startTime := time.Now()
+	if !v.Available() {
+		return nil, fmt.Errorf("djxl不可用，无法校验JPEG重建")
+	}
+
+	sourceHash, err := fileSHA256(jpegPath)
+	if err != nil {
+		return nil, fmt.Errorf("计算原始JPEG哈希失败: %w", err)
+	}
+
+	reconstructed, err := os.CreateTemp(v.tempDir, strings.TrimSuffix(filepath.Base(jpegPath), filepath.Ext(jpegPath))+"_reconstructed_*.jpg")
+	if err != nil {
+		return nil, fmt.Errorf("创建重建临时文件失败: %w", err)
+	}
+	reconstructedPath := reconstructed.Name()
+	reconstructed.Close()
+	defer os.Remove(reconstructedPath)
+
+	cmd := exec.CommandContext(ctx, v.djxlPath, jxlPath, reconstructedPath)
+	if v.runner != nil {
+		info, statErr := os.Stat(jxlPath)
+		if statErr != nil {
+			return nil, fmt.Errorf("获取JXL文件信息失败: %w", statErr)
+		}
+		err = v.runner.MonitorCommand(ctx, cmd, &processmonitor.ProcessContext{
+			Operation:       "jpeg_reconstruction",
+			SourceFile:      jxlPath,
+			TargetFile:      reconstructedPath,
+			FileSize:        info.Size(),
+			FileFormat:      "jxl",
+			ComplexityLevel: processmonitor.ComplexityLow,
+			Priority:        processmonitor.PriorityNormal,
+			Metadata:        map[string]string{"tool": "djxl"},
+		})
+	} else {
+		err = cmd.Run()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("djxl重建JPEG失败: %w", err)
+	}
+
+	reconstructedHash, err := fileSHA256(reconstructedPath)
+	if err != nil {
+		return nil, fmt.Errorf("计算重建JPEG哈希失败: %w", err)
+	}
+
+	return &JPEGReconstructionCheck{
+		SourceSHA256:        sourceHash,
+		ReconstructedSHA256: reconstructedHash,
+		Match:               sourceHash == reconstructedHash,
+		Duration:            time.Since(startTime),
+	}, nil
+}
+
+// KeepOriginalError 转换结果未通过校验，操作降级为保留原文件
+type KeepOriginalError struct {
+	SourcePath string
+	Reason     string
+}
+
+func (e *KeepOriginalError) Error() string {
+	return fmt.Sprintf("保留原文件 %s: %s", filepath.Base(e.SourcePath), e.Reason)
+}
+
+// fileSHA256 计算文件的SHA-256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// isJPEGExt 是否为JPEG扩展名
+func isJPEGExt(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".jpe", ".jfif":
+		return true
+	default:
+		return false
+	}
+}
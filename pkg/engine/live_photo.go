@@ -0,0 +1,444 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pixly/pkg/scanner"
+
+	"go.uber.org/zap"
+)
+
+// LivePhotoPair Live Photo 的静态图与视频两半
+type LivePhotoPair struct {
+	StillPath         string
+	VideoPath         string
+	ContentIdentifier string // Apple ContentIdentifier，仅按文件名配对且无元数据时为空
+	MatchedBy         string // "content_identifier" 或 "basename"
+}
+
+// livePhotoStillExts / livePhotoVideoExts Live Photo 两半可能的扩展名
+var (
+	livePhotoStillExts = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true}
+	livePhotoVideoExts = map[string]bool{".mov": true}
+)
+
+// exiftoolBatchSize 单次 exiftool 调用读取的文件数
+const exiftoolBatchSize = 100
+
+// LivePhotoPairer 按 ContentIdentifier 与同名文件识别 Live Photo，并在转换后保留配对信息
+//
+// 静态图的 ContentIdentifier 位于 Apple MakerNotes，视频的位于 QuickTime Keys，
+// 照片应用依靠两者一致来关联两半。
+type LivePhotoPairer struct {
+	logger       *zap.Logger
+	exiftoolPath string
+	scanIndex    *scanner.ScanIndex // 持久化扫描索引，未变化的文件不再读取 ContentIdentifier
+}
+
+// NewLivePhotoPairer 创建 Live Photo 配对器；exiftoolPath 为空时只按文件名配对
+func NewLivePhotoPairer(logger *zap.Logger, exiftoolPath string) *LivePhotoPairer {
+	return &LivePhotoPairer{logger: logger, exiftoolPath: exiftoolPath}
+}
+
+// SetScanIndex 设置持久化扫描索引；传入nil时每次配对都通过 exiftool 读取
+func (p *LivePhotoPairer) SetScanIndex(index *scanner.ScanIndex) {
+	p.scanIndex = index
+}
+
+// CanPreserveIdentifiers 是否能读写 ContentIdentifier
+func (p *LivePhotoPairer) CanPreserveIdentifiers() bool {
+	return p.exiftoolPath != ""
+}
+
+// FindPairs 在文件列表中查找 Live Photo 配对
+// 优先按 ContentIdentifier 匹配（可跨文件名），其次按同目录同名匹配；
+// 同名但 ContentIdentifier 不同的文件不视为一对
+func (p *LivePhotoPairer) FindPairs(ctx context.Context, paths []string) []*LivePhotoPair {
+	var stills, videos []string
+	for _, path := range paths {
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case livePhotoStillExts[ext]:
+			stills = append(stills, path)
+		case livePhotoVideoExts[ext]:
+			videos = append(videos, path)
+		}
+	}
+	if len(stills) == 0 || len(videos) == 0 {
+		return nil
+	}
+	sort.Strings(stills)
+	sort.Strings(videos)
+
+	var identifiers map[string]string
+	if p.CanPreserveIdentifiers() {
+		var err error
+		identifiers, err = p.cachedContentIdentifiers(ctx, append(append([]string{}, stills...), videos...))
+		if err != nil {
+			p.logger.Warn("读取ContentIdentifier失败，仅按文件名配对Live Photo", zap.Error(err))
+		}
+	}
+
+	used := make(map[string]bool)
+	var pairs []*LivePhotoPair
+
+	// 1. ContentIdentifier 匹配
+	videoByIdentifier := make(map[string]string)
+	for _, video := range videos {
+		if id := identifiers[video]; id != "" {
+			if _, exists := videoByIdentifier[id]; !exists {
+				videoByIdentifier[id] = video
+			}
+		}
+	}
+	for _, still := range stills {
+		id := identifiers[still]
+		if id == "" {
+			continue
+		}
+		if video, ok := videoByIdentifier[id]; ok && !used[video] {
+			used[still], used[video] = true, true
+			pairs = append(pairs, &LivePhotoPair{StillPath: still, VideoPath: video, ContentIdentifier: id, MatchedBy: "content_identifier"})
+		}
+	}
+
+	// 2. 同目录同名匹配
+	videoByBase := make(map[string]string)
+	for _, video := range videos {
+		if !used[video] {
+			videoByBase[livePhotoKey(video)] = video
+		}
+	}
+	for _, still := range stills {
+		if used[still] {
+			continue
+		}
+		video, ok := videoByBase[livePhotoKey(still)]
+		if !ok || used[video] {
+			continue
+		}
+		stillID, videoID := identifiers[still], identifiers[video]
+		if stillID != "" && videoID != "" && stillID != videoID {
+			continue
+		}
+		id := stillID
+		if id == "" {
+			id = videoID
+		}
+		used[still], used[video] = true, true
+		pairs = append(pairs, &LivePhotoPair{StillPath: still, VideoPath: video, ContentIdentifier: id, MatchedBy: "basename"})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].StillPath < pairs[j].StillPath })
+	return pairs
+}
+
+// cachedContentIdentifiers 读取 ContentIdentifier，未变化的文件使用扫描索引中的结果，其余读取后写入索引
+func (p *LivePhotoPairer) cachedContentIdentifiers(ctx context.Context, paths []string) (map[string]string, error) {
+	if p.scanIndex == nil {
+		return p.ReadContentIdentifiers(ctx, paths)
+	}
+
+	identifiers := make(map[string]string)
+	fingerprints := make(map[string]scanner.FileFingerprint)
+	var unread []string
+	for _, path := range paths {
+		entry, fingerprint := p.scanIndex.LookupFile(path)
+		switch {
+		case entry != nil && entry.ContentIdentifier != nil:
+			if *entry.ContentIdentifier != "" {
+				identifiers[path] = *entry.ContentIdentifier
+			}
+		case fingerprint != nil:
+			fingerprints[path] = *fingerprint
+			unread = append(unread, path)
+		default:
+			unread = append(unread, path)
+		}
+	}
+	if len(unread) == 0 {
+		return identifiers, nil
+	}
+
+	read, err := p.readContentIdentifiers(ctx, unread)
+	for path, id := range read {
+		if id != "" {
+			identifiers[path] = id
+		}
+		fingerprint, ok := fingerprints[path]
+		if !ok {
+			continue
+		}
+		if storeErr := p.scanIndex.Store(path, &scanner.ScanIndexEntry{Fingerprint: fingerprint, ContentIdentifier: &id}); storeErr != nil {
+			p.logger.Debug("写入扫描索引失败", zap.String("file", filepath.Base(path)), zap.Error(storeErr))
+		}
+	}
+	return identifiers, err
+}
+
+// ReadContentIdentifiers 批量读取文件的 ContentIdentifier，结果以传入的路径为键，未设置的文件不出现在结果中
+func (p *LivePhotoPairer) ReadContentIdentifiers(ctx context.Context, paths []string) (map[string]string, error) {
+	read, err := p.readContentIdentifiers(ctx, paths)
+	for path, id := range read {
+		if id == "" {
+			delete(read, path)
+		}
+	}
+	return read, err
+}
+
+// readContentIdentifiers 批量读取 ContentIdentifier，exiftool 输出中的每个文件都出现在结果中（未设置时为空串）
+func (p *LivePhotoPairer) readContentIdentifiers(ctx context.Context, paths []string) (map[string]string, error) {
+	identifiers := make(map[string]string)
+	if !p.CanPreserveIdentifiers() {
+		return identifiers, fmt.Errorf("exiftool不可用")
+	}
+
+	for start := 0; start < len(paths); start += exiftoolBatchSize {
+		batch := paths[start:min(start+exiftoolBatchSize, len(paths))]
+
+		readCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		args := append([]string{"-json", "-ContentIdentifier"}, batch...)
+		output, err := exec.CommandContext(readCtx, p.exiftoolPath, args...).Output()
+		cancel()
+		// exiftool 在部分文件无法读取时返回非0，但仍输出其余文件的结果
+		if err != nil && len(output) == 0 {
+			return identifiers, fmt.Errorf("exiftool读取失败: %w", err)
+		}
+
+		var entries []struct {
+			SourceFile        string `json:"SourceFile"`
+			ContentIdentifier string `json:"ContentIdentifier"`
+		}
+		if err := json.Unmarshal(output, &entries); err != nil {
+			return identifiers, fmt.Errorf("解析exiftool输出失败: %w", err)
+		}
+		for _, entry := range entries {
+			identifiers[entry.SourceFile] = entry.ContentIdentifier
+		}
+	}
+	return identifiers, nil
+}
+
+// PreservePairing 确保两个输出文件都带有配对的 ContentIdentifier
+// metadataSource 为静态图原始文件（或其备份），用于整体复制 Apple MakerNotes
+func (p *LivePhotoPairer) PreservePairing(ctx context.Context, pair *LivePhotoPair, metadataSource, stillOutput, videoOutput string) error {
+	if pair.ContentIdentifier == "" {
+		return nil // 仅靠文件名关联
+	}
+	if !p.CanPreserveIdentifiers() {
+		return fmt.Errorf("exiftool不可用，无法写入ContentIdentifier")
+	}
+
+	current, err := p.ReadContentIdentifiers(ctx, []string{stillOutput, videoOutput})
+	if err != nil {
+		return err
+	}
+
+	if current[stillOutput] != pair.ContentIdentifier {
+		// ContentIdentifier 属于 Apple MakerNotes，只能整块复制
+		if err := p.runExiftool(ctx, "-overwrite_original", "-TagsFromFile", metadataSource, "-MakerNotes", stillOutput); err != nil {
+			return fmt.Errorf("写入静态图配对信息失败: %w", err)
+		}
+	}
+	if current[videoOutput] != pair.ContentIdentifier {
+		if err := p.runExiftool(ctx, "-overwrite_original", "-Keys:ContentIdentifier="+pair.ContentIdentifier, videoOutput); err != nil {
+			return fmt.Errorf("写入视频配对信息失败: %w", err)
+		}
+	}
+
+	// 回读校验两半一致
+	written, err := p.ReadContentIdentifiers(ctx, []string{stillOutput, videoOutput})
+	if err != nil {
+		return err
+	}
+	for _, output := range []string{stillOutput, videoOutput} {
+		if got := written[output]; got != pair.ContentIdentifier {
+			return fmt.Errorf("%s 的ContentIdentifier为 %q，期望 %q", filepath.Base(output), got, pair.ContentIdentifier)
+		}
+	}
+	return nil
+}
+
+// runExiftool 执行 exiftool 写入命令
+func (p *LivePhotoPairer) runExiftool(ctx context.Context, args ...string) error {
+	writeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(writeCtx, p.exiftoolPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// livePhotoKey 同目录、不区分大小写的无扩展名文件名
+func livePhotoKey(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return filepath.Join(filepath.Dir(path), strings.ToLower(base))
+}
+
+// findLivePhotoPairs 在任务列表中识别 Live Photo，返回按静态图路径索引的配对和已配对的视频集合
+func (e *ConversionEngine) findLivePhotoPairs(ctx context.Context, tasks []ConversionTask) (map[string]*LivePhotoPair, map[string]bool) {
+	pairsByStill := make(map[string]*LivePhotoPair)
+	pairedVideos := make(map[string]bool)
+	if e.livePhotoPairer == nil {
+		return pairsByStill, pairedVideos
+	}
+
+	paths := make([]string, len(tasks))
+	for i, task := range tasks {
+		paths[i] = task.SourcePath
+	}
+
+	for _, pair := range e.livePhotoPairer.FindPairs(ctx, paths) {
+		pairsByStill[pair.StillPath] = pair
+		pairedVideos[pair.VideoPath] = true
+	}
+	if len(pairsByStill) > 0 {
+		e.logger.Info("识别到Live Photo配对",
+			zap.Int("pairs", len(pairsByStill)),
+			zap.Bool("content_identifier", e.livePhotoPairer.CanPreserveIdentifiers()))
+	}
+	return pairsByStill, pairedVideos
+}
+
+// processLivePhotoPair 成对转换 Live Photo：先静态图后视频，
+// 完成后确保两个输出带有相同的 ContentIdentifier；任一步失败则两半一起回滚
+func (e *ConversionEngine) processLivePhotoPair(ctx context.Context, pair *LivePhotoPair, stillTask, videoTask ConversionTask) []ConversionResult {
+	if e.config.DebugMode || e.config.DryRun {
+		return []ConversionResult{e.processTask(ctx, stillTask), e.processTask(ctx, videoTask)}
+	}
+
+	// 独立于单文件备份的成对备份，用于整体回滚和复制 MakerNotes
+	stillBackup, err := e.createPairBackup(pair.StillPath)
+	if err != nil {
+		return e.failLivePhotoPair(pair, fmt.Errorf("备份静态图失败: %w", err))
+	}
+	defer os.Remove(stillBackup)
+	videoBackup, err := e.createPairBackup(pair.VideoPath)
+	if err != nil {
+		return e.failLivePhotoPair(pair, fmt.Errorf("备份视频失败: %w", err))
+	}
+	defer os.Remove(videoBackup)
+
+	stillResult := e.processTask(ctx, stillTask)
+
+	var videoResult ConversionResult
+	var pairErr error
+	if stillResult.Status == "failed" {
+		pairErr = fmt.Errorf("静态图转换失败: %s", stillResult.Message)
+		videoResult = ConversionResult{SourcePath: pair.VideoPath, StartTime: time.Now()}
+	} else {
+		videoResult = e.processTask(ctx, videoTask)
+		if videoResult.Status == "failed" {
+			pairErr = fmt.Errorf("视频转换失败: %s", videoResult.Message)
+		} else {
+			pairErr = e.livePhotoPairer.PreservePairing(ctx, pair, stillBackup,
+				livePhotoOutputPath(stillResult), livePhotoOutputPath(videoResult))
+		}
+	}
+
+	if pairErr == nil {
+		e.livePhotoPaired.Add(1)
+		e.logger.Info("Live Photo成对转换完成",
+			zap.String("still", filepath.Base(pair.StillPath)),
+			zap.String("video", filepath.Base(pair.VideoPath)),
+			zap.String("matched_by", pair.MatchedBy))
+		return []ConversionResult{stillResult, videoResult}
+	}
+
+	e.rollbackLivePhotoPair(pair, []ConversionResult{stillResult, videoResult}, []string{stillBackup, videoBackup})
+	e.livePhotoRolledBack.Add(1)
+	e.runReport.addValidationFailure(livePhotoFailure(pair, pairErr))
+	e.logger.Warn("Live Photo转换失败，两半已整体回滚",
+		zap.String("still", filepath.Base(pair.StillPath)),
+		zap.String("video", filepath.Base(pair.VideoPath)),
+		zap.Error(pairErr))
+
+	for _, result := range []*ConversionResult{&stillResult, &videoResult} {
+		markLivePhotoRolledBack(result, pairErr)
+	}
+	return []ConversionResult{stillResult, videoResult}
+}
+
+// rollbackLivePhotoPair 删除两半已生成的输出，并把被改动的源文件恢复为备份
+func (e *ConversionEngine) rollbackLivePhotoPair(pair *LivePhotoPair, results []ConversionResult, backups []string) {
+	for _, result := range results {
+		if result.TargetPath != "" && result.TargetPath != result.SourcePath {
+			if err := os.Remove(result.TargetPath); err != nil && !os.IsNotExist(err) {
+				e.logger.Error("删除Live Photo输出失败", zap.String("file", result.TargetPath), zap.Error(err))
+			}
+		}
+	}
+
+	for i, source := range []string{pair.StillPath, pair.VideoPath} {
+		// 源文件未被改动时不重写，保留原有的修改时间
+		if current, err := fileSHA256(source); err == nil {
+			if original, err := fileSHA256(backups[i]); err == nil && current == original {
+				continue
+			}
+		}
+		if err := e.restoreFromBackup(backups[i], source); err != nil {
+			e.logger.Error("恢复Live Photo源文件失败", zap.String("file", source), zap.Error(err))
+		}
+	}
+}
+
+// failLivePhotoPair 成对处理开始前失败，两半都不处理
+func (e *ConversionEngine) failLivePhotoPair(pair *LivePhotoPair, err error) []ConversionResult {
+	e.livePhotoRolledBack.Add(1)
+	e.runReport.addValidationFailure(livePhotoFailure(pair, err))
+	e.logger.Warn("Live Photo处理失败", zap.String("still", filepath.Base(pair.StillPath)), zap.Error(err))
+
+	results := []ConversionResult{{SourcePath: pair.StillPath}, {SourcePath: pair.VideoPath}}
+	for i := range results {
+		results[i].StartTime = time.Now()
+		markLivePhotoRolledBack(&results[i], err)
+	}
+	return results
+}
+
+// createPairBackup 在源文件旁创建唯一命名的备份，不与 createBackup 的按秒命名冲突
+func (e *ConversionEngine) createPairBackup(filePath string) (string, error) {
+	backup, err := os.CreateTemp(filepath.Dir(filePath), ".pixly_livephoto_*_"+filepath.Base(filePath))
+	if err != nil {
+		return "", fmt.Errorf("无法创建备份文件: %w", err)
+	}
+	backupPath := backup.Name()
+	backup.Close()
+
+	if err := e.restoreFromBackup(filePath, backupPath); err != nil {
+		os.Remove(backupPath)
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// markLivePhotoRolledBack 将结果标记为因配对回滚而失败
+func markLivePhotoRolledBack(result *ConversionResult, err error) {
+	result.Status = "failed"
+	result.Message = fmt.Sprintf("Live Photo配对回滚: %v", err)
+	result.TargetPath = ""
+	result.NewSize = result.OriginalSize
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
+}
+
+// livePhotoOutputPath 一半处理后的实际文件：成功则为输出文件，否则仍是源文件
+func livePhotoOutputPath(result ConversionResult) string {
+	if result.Status == "success" && result.TargetPath != "" {
+		if _, err := os.Stat(result.TargetPath); err == nil {
+			return result.TargetPath
+		}
+	}
+	return result.SourcePath
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pixly/pkg/core/types"
+)
+
+// PerceptualMetric 感知质量指标
+type PerceptualMetric string
+
+const (
+	MetricSSIMULACRA2 PerceptualMetric = "ssimulacra2" // 越高越好，80以上视觉无损
+	MetricButteraugli PerceptualMetric = "butteraugli" // 越低越好，1.0左右为可察觉阈值
+	MetricSSIM        PerceptualMetric = "ssim"        // 越高越好，范围0-1
+)
+
+// ParsePerceptualMetric 解析指标名称
+func ParsePerceptualMetric(name string) (PerceptualMetric, error) {
+	switch PerceptualMetric(strings.ToLower(strings.TrimSpace(name))) {
+	case MetricSSIMULACRA2, "ssimulacra":
+		return MetricSSIMULACRA2, nil
+	case MetricButteraugli:
+		return MetricButteraugli, nil
+	case MetricSSIM:
+		return MetricSSIM, nil
+	default:
+		return "", fmt.Errorf("不支持的感知指标: %s (可选: ssimulacra2, butteraugli, ssim)", name)
+	}
+}
+
+// HigherIsBetter 指标是否越高越好
+func (m PerceptualMetric) HigherIsBetter() bool {
+	return m != MetricButteraugli
+}
+
+// Meets 判断分数是否达到目标
+func (m PerceptualMetric) Meets(score, target float64) bool {
+	if m.HigherIsBetter() {
+		return score >= target
+	}
+	return score <= target
+}
+
+// DefaultTarget 指标的默认目标值
+func (m PerceptualMetric) DefaultTarget() float64 {
+	switch m {
+	case MetricButteraugli:
+		return 1.5
+	case MetricSSIM:
+		return 0.98
+	default:
+		return 80
+	}
+}
+
+// PerceptualScorer 感知分数计算器
+type PerceptualScorer interface {
+	// Available 指标所需工具是否可用
+	Available(metric PerceptualMetric) bool
+
+	// Score 计算失真图相对参考图的分数
+	Score(ctx context.Context, metric PerceptualMetric, reference, distorted string) (float64, error)
+}
+
+// ToolPerceptualScorer 基于外部工具的感知分数计算器
+// ssimulacra2/butteraugli 使用 libjxl 附带的工具，SSIM 使用 FFmpeg 的 ssim 滤镜
+type ToolPerceptualScorer struct {
+	ffmpegPath      string
+	djxlPath        string
+	ssimulacra2Path string
+	butteraugliPath string
+	tempDir         string
+}
+
+// NewToolPerceptualScorer 创建基于外部工具的感知分数计算器
+func NewToolPerceptualScorer(toolPaths types.ToolCheckResults, tempDir string) *ToolPerceptualScorer {
+	ffmpegPath := toolPaths.FfmpegStablePath
+	if ffmpegPath == "" {
+		ffmpegPath = toolPaths.FfmpegDevPath
+	}
+	return &ToolPerceptualScorer{
+		ffmpegPath:      ffmpegPath,
+		djxlPath:        lookPathOrEmpty("djxl"),
+		ssimulacra2Path: lookPathOrEmpty("ssimulacra2"),
+		butteraugliPath: lookPathOrEmpty("butteraugli_main"),
+		tempDir:         tempDir,
+	}
+}
+
+// Available 指标所需工具是否可用
+func (s *ToolPerceptualScorer) Available(metric PerceptualMetric) bool {
+	switch metric {
+	case MetricSSIMULACRA2:
+		return s.ssimulacra2Path != "" && s.ffmpegPath != ""
+	case MetricButteraugli:
+		return s.butteraugliPath != "" && s.ffmpegPath != ""
+	case MetricSSIM:
+		return s.ffmpegPath != ""
+	default:
+		return false
+	}
+}
+
+// Score 计算失真图相对参考图的分数
+func (s *ToolPerceptualScorer) Score(ctx context.Context, metric PerceptualMetric, reference, distorted string) (float64, error) {
+	if !s.Available(metric) {
+		return 0, fmt.Errorf("感知指标%s所需工具不可用", metric)
+	}
+
+	// 指标工具只稳定支持PNG/JPEG输入，先将双方解码为PNG
+	refPNG, cleanupRef, err := s.decodeToPNG(ctx, reference)
+	if err != nil {
+		return 0, fmt.Errorf("解码参考图失败: %w", err)
+	}
+	defer cleanupRef()
+
+	distPNG, cleanupDist, err := s.decodeToPNG(ctx, distorted)
+	if err != nil {
+		return 0, fmt.Errorf("解码失真图失败: %w", err)
+	}
+	defer cleanupDist()
+
+	switch metric {
+	case MetricSSIMULACRA2:
+		output, err := exec.CommandContext(ctx, s.ssimulacra2Path, refPNG, distPNG).Output()
+		if err != nil {
+			return 0, fmt.Errorf("ssimulacra2执行失败: %w", err)
+		}
+		return parseFirstFloat(string(output))
+	case MetricButteraugli:
+		output, err := exec.CommandContext(ctx, s.butteraugliPath, refPNG, distPNG).Output()
+		if err != nil {
+			return 0, fmt.Errorf("butteraugli执行失败: %w", err)
+		}
+		return parseFirstFloat(string(output))
+	default:
+		return s.ffmpegSSIM(ctx, refPNG, distPNG)
+	}
+}
+
+var ssimAllPattern = regexp.MustCompile(`All:([0-9.]+)`)
+
+// ffmpegSSIM 使用FFmpeg的ssim滤镜计算SSIM
+func (s *ToolPerceptualScorer) ffmpegSSIM(ctx context.Context, reference, distorted string) (float64, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.ffmpegPath,
+		"-hide_banner", "-i", distorted, "-i", reference,
+		"-lavfi", "[0:v][1:v]ssim", "-f", "null", "-")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("FFmpeg SSIM计算失败: %w", err)
+	}
+
+	matches := ssimAllPattern.FindStringSubmatch(stderr.String())
+	if len(matches) < 2 {
+		return 0, fmt.Errorf("无法解析SSIM输出")
+	}
+	return strconv.ParseFloat(matches[1], 64)
+}
+
+// decodeToPNG 将图像解码为临时PNG；PNG/JPEG 原样返回
+func (s *ToolPerceptualScorer) decodeToPNG(ctx context.Context, path string) (string, func(), error) {
+	noop := func() {}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".png" || ext == ".jpg" || ext == ".jpeg" {
+		return path, noop, nil
+	}
+
+	baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	output := filepath.Join(s.tempDir, fmt.Sprintf("%s_metric_%d.png", baseName, time.Now().UnixNano()))
+	cleanup := func() { os.Remove(output) }
+
+	var cmd *exec.Cmd
+	if ext == ".jxl" && s.djxlPath != "" {
+		cmd = exec.CommandContext(ctx, s.djxlPath, path, output)
+	} else {
+		cmd = exec.CommandContext(ctx, s.ffmpegPath, "-v", "error", "-i", path, "-frames:v", "1", "-y", output)
+	}
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return output, cleanup, nil
+}
+
+var firstFloatPattern = regexp.MustCompile(`-?[0-9]+(?:\.[0-9]+)?(?:[eE][-+]?[0-9]+)?`)
+
+// parseFirstFloat 解析输出中的第一个浮点数
+func parseFirstFloat(output string) (float64, error) {
+	match := firstFloatPattern.FindString(output)
+	if match == "" {
+		return 0, fmt.Errorf("无法解析指标输出: %q", strings.TrimSpace(output))
+	}
+	return strconv.ParseFloat(match, 64)
+}
+
+// lookPathOrEmpty 查找可执行文件，找不到时返回空字符串
+func lookPathOrEmpty(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
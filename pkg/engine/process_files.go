@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/scanner"
+
+	"go.uber.org/zap"
+)
+
+// processedStatusOutput 处理记录中表示"本程序生成的输出文件"的状态
+const processedStatusOutput = "output"
+
+// processedRecord 持久化的文件处理记录
+// 文件指纹与记录一致说明处理后未再变化，再次出现（重启、输出文件触发事件）时直接跳过
+type processedRecord struct {
+	Fingerprint scanner.FileFingerprint `json:"fingerprint"`
+	Status      string                  `json:"status"` // success, skipped, kept, output
+	TargetPath  string                  `json:"target_path,omitempty"`
+	ProcessedAt time.Time               `json:"processed_at"`
+}
+
+// ProcessFiles 处理指定的文件（监视模式使用）
+//
+// 与 Execute 共用评估、路由、转换阶段和状态数据库，同一目录的文件作为一个批次，
+// Live Photo 两半同时到达时仍会配对。已处理且指纹（大小、修改时间、inode）未变化的文件
+// 以及本程序生成的输出文件直接跳过，重启后不会重复处理。失败的文件不记录，下次出现时重试。
+func (e *ConversionEngine) ProcessFiles(ctx context.Context, paths []string) ([]ConversionResult, error) {
+	if err := e.validateConfig(); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	e.openState()
+	if err := e.checkQueuePaused(); err != nil {
+		return nil, err
+	}
+
+	fingerprints := make(map[string]scanner.FileFingerprint, len(paths))
+	batches := make(map[string][]*types.MediaInfo)
+	var dirs []string
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), ".pixly_") || !scanSupportedExts[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		if _, seen := fingerprints[path]; seen {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		fingerprint := scanner.FingerprintOf(info)
+		if e.isProcessed(path, fingerprint) {
+			e.logger.Debug("文件已处理且未变化，跳过", zap.String("file", filepath.Base(path)))
+			continue
+		}
+		fingerprints[path] = fingerprint
+
+		dir := filepath.Dir(path)
+		if _, ok := batches[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		batches[dir] = append(batches[dir], &types.MediaInfo{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	if len(fingerprints) == 0 {
+		return nil, nil
+	}
+
+	results, _, err := e.runStreamingPipeline(ctx, func(ctx context.Context, emit func([]*types.MediaInfo) error) error {
+		for _, dir := range dirs {
+			if err := emit(batches[dir]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, e.config.ConcurrentJobs)
+
+	// 模拟运行不改变文件，不记录处理结果
+	if e.config.DryRun || e.config.DebugMode {
+		return results, err
+	}
+	for _, result := range results {
+		e.recordProcessed(result, fingerprints[result.SourcePath])
+		delete(fingerprints, result.SourcePath)
+	}
+	// 没有转换结果的文件已在评估或路由阶段处理完（跳过或损坏）；取消时可能只是未处理到
+	if ctx.Err() == nil {
+		for path, fingerprint := range fingerprints {
+			e.saveProcessedRecord(path, &processedRecord{Fingerprint: fingerprint, Status: "skipped"})
+		}
+	}
+	return results, err
+}
+
+// Close 关闭状态数据库
+func (e *ConversionEngine) Close() error {
+	if e.stateManager == nil {
+		return nil
+	}
+	return e.stateManager.Close()
+}
+
+// isProcessed 文件是否已处理（或为输出文件）且之后未变化
+func (e *ConversionEngine) isProcessed(path string, fingerprint scanner.FileFingerprint) bool {
+	if e.stateManager == nil {
+		return false
+	}
+	data, err := e.stateManager.LoadProcessedFile(path)
+	if err != nil || data == nil {
+		return false
+	}
+	var record processedRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return false
+	}
+	return record.Fingerprint == fingerprint
+}
+
+// recordProcessed 记录转换结果；转换成功时同时记录输出文件，避免输出文件再次进入处理
+func (e *ConversionEngine) recordProcessed(result ConversionResult, fingerprint scanner.FileFingerprint) {
+	if result.Status == "failed" {
+		return
+	}
+
+	record := &processedRecord{Fingerprint: fingerprint, Status: result.Status, TargetPath: result.TargetPath}
+	if result.TargetPath == "" || result.TargetPath == result.SourcePath {
+		// 原位替换时记录替换后的指纹
+		if info, err := os.Stat(result.SourcePath); err == nil {
+			record.Fingerprint = scanner.FingerprintOf(info)
+		}
+		e.saveProcessedRecord(result.SourcePath, record)
+		return
+	}
+
+	e.saveProcessedRecord(result.SourcePath, record)
+	if info, err := os.Stat(result.TargetPath); err == nil {
+		e.saveProcessedRecord(result.TargetPath, &processedRecord{
+			Fingerprint: scanner.FingerprintOf(info),
+			Status:      processedStatusOutput,
+		})
+	}
+}
+
+func (e *ConversionEngine) saveProcessedRecord(path string, record *processedRecord) {
+	if e.stateManager == nil {
+		return
+	}
+	record.ProcessedAt = time.Now()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if err := e.stateManager.SaveProcessedFile(path, data); err != nil {
+		e.logger.Debug("保存处理记录失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
@@ -42,6 +42,8 @@ type QualityAssessment struct {
 	Duration        float64                `json:"duration,omitempty"`
 	PixelDensity    float64                `json:"pixel_density"`
 	JpegQuality     int                    `json:"jpeg_quality,omitempty"`
+	JpegSubsampling string                 `json:"jpeg_subsampling,omitempty"`
+	JpegResaved     bool                   `json:"jpeg_resaved,omitempty"`
 	BitRate         int64                  `json:"bit_rate,omitempty"`
 	FrameRate       float64                `json:"frame_rate,omitempty"`
 	IsCorrupted     bool                   `json:"is_corrupted"`
@@ -185,6 +187,11 @@ func (qe *QualityEngine) performQuickPreAssessment(assessment *QualityAssessment
 	switch ext {
 	case ".jpg", ".jpeg":
 		assessment.Format = "jpeg"
+		// 优先读取量化表：只解析头部，开销与stat相当
+		if qe.applyJpegHeader(assessment, filePath) {
+			assessment.Score = float64(assessment.JpegQuality) / 100
+			break
+		}
 		// JPEG文件的快速品质预判 - 降低敏感度
 		if fileSizeMB > 3 {
 			assessment.Score = 0.8 // 预估高品质
@@ -440,7 +447,12 @@ func (qe *QualityEngine) parseAndUpdateMediaInfo(assessment *QualityAssessment,
 		assessment.JpegQuality = qe.estimateJpegQuality(assessment)
 	}
 
-	// 存储详细信息
+	// 存储详细信息（保留预判阶段记录的头部信息）
+	for key, value := range assessment.Details {
+		if _, exists := info[key]; !exists {
+			info[key] = value
+		}
+	}
 	assessment.Details = info
 
 	return nil
@@ -493,6 +505,7 @@ func (qe *QualityEngine) assessQuality(assessment *QualityAssessment) {
 		assessment.QualityLevel = qe.classifyImageQualityByREADMEStandard(assessment)
 	} else {
 		// 非静图使用通用分类 - 降低敏感度
+		noteClassification(assessment, ClassifiedByScore, scoreThresholds)
 		if score >= 0.85 {
 			assessment.QualityLevel = types.QualityVeryHigh
 		} else if score >= 0.65 {
@@ -516,25 +529,15 @@ func (qe *QualityEngine) classifyImageQualityByREADMEStandard(assessment *Qualit
 	// 中高/中低品质: 0.6 < 像素密度比 ≤ 2.5 或 50% ≤ JPEG品质 < 85%
 	// 低品质: 像素密度比 ≤ 0.6 或 JPEG品质 < 50%
 
-	// 优先使用JPEG品质判断（高置信度）
+	// 优先使用JPEG品质判断（高置信度），多次保存的文件下调一级
 	if assessment.JpegQuality > 0 {
-		if assessment.JpegQuality >= 90 {
-			return types.QualityVeryHigh
-		} else if assessment.JpegQuality >= 85 {
-			return types.QualityHigh
-		} else if assessment.JpegQuality >= 70 {
-			return types.QualityMediumHigh
-		} else if assessment.JpegQuality >= 50 {
-			return types.QualityMediumLow
-		} else if assessment.JpegQuality >= 30 {
-			return types.QualityLow
-		} else {
-			return types.QualityVeryLow
-		}
+		noteClassification(assessment, ClassifiedByJpegQuality, JpegQualityThresholds)
+		return ClassifyJpegQuality(assessment.JpegQuality, assessment.JpegResaved)
 	}
 
 	// 使用像素密度比判断
 	if assessment.PixelDensity > 0 {
+		noteClassification(assessment, ClassifiedByPixelDensity, pixelDensityThresholds)
 		if assessment.PixelDensity > 3.0 {
 			return types.QualityVeryHigh
 		} else if assessment.PixelDensity > 2.5 {
@@ -554,6 +557,7 @@ func (qe *QualityEngine) classifyImageQualityByREADMEStandard(assessment *Qualit
 	fileSizeMB := float64(assessment.FileSize) / (1024 * 1024)
 	if assessment.Format == "png" || assessment.Format == "heif" {
 		// 无损格式通常品质较高
+		noteClassification(assessment, ClassifiedByLosslessFileSize, losslessFileSizeThresholds)
 		if fileSizeMB > 5 {
 			return types.QualityVeryHigh
 		} else if fileSizeMB > 2 {
@@ -565,6 +569,7 @@ func (qe *QualityEngine) classifyImageQualityByREADMEStandard(assessment *Qualit
 		}
 	} else {
 		// 其他格式基于文件大小判断
+		noteClassification(assessment, ClassifiedByFileSize, fileSizeThresholds)
 		if fileSizeMB > 4 {
 			return types.QualityHigh
 		} else if fileSizeMB > 1.5 {
@@ -579,6 +584,33 @@ func (qe *QualityEngine) classifyImageQualityByREADMEStandard(assessment *Qualit
 	}
 }
 
+// 品质分级依据，记录在 Details["classified_by"] 中，阈值说明记录在 Details["thresholds"] 中
+const (
+	ClassifiedByJpegQuality      = "jpeg_quality"       // JPEG量化表估算的品质因子
+	ClassifiedByPixelDensity     = "pixel_density"      // 像素密度比
+	ClassifiedByLosslessFileSize = "lossless_file_size" // 无损格式（PNG/HEIF）按文件大小
+	ClassifiedByFileSize         = "file_size"          // 其他格式按文件大小
+	ClassifiedByScore            = "score"              // 非静图按评分
+)
+
+// 各分级依据的阈值说明，与判断分支保持一致；JpegQualityThresholds 对应 ClassifyJpegQuality
+const (
+	JpegQualityThresholds      = "品质 ≥90 极高, ≥85 高, ≥70 中高, ≥50 中低, ≥30 低, 其余极低; 多次保存下调一级"
+	pixelDensityThresholds     = "像素密度 >3.0 极高, >2.5 高, >1.5 中高, >0.6 中低, >0.3 低, 其余极低"
+	losslessFileSizeThresholds = "文件大小 >5MB 极高, >2MB 高, >0.5MB 中高, 其余中低"
+	fileSizeThresholds         = "文件大小 >4MB 高, >1.5MB 中高, >0.5MB 中低, >0.1MB 低, 其余极低"
+	scoreThresholds            = "评分 ≥0.85 极高, ≥0.65 高, ≥0.5 中高, ≥0.35 中低, ≥0.2 低, 其余极低"
+)
+
+// noteClassification 记录品质分级使用的依据和阈值，供决策轨迹使用
+func noteClassification(assessment *QualityAssessment, basis, thresholds string) {
+	if assessment.Details == nil {
+		assessment.Details = make(map[string]interface{})
+	}
+	assessment.Details["classified_by"] = basis
+	assessment.Details["thresholds"] = thresholds
+}
+
 // assessImageQualityPrecise 精确评估静图品质
 func (qe *QualityEngine) assessImageQualityPrecise(assessment *QualityAssessment) (float64, float64) {
 	var score float64
@@ -727,34 +759,63 @@ func (qe *QualityEngine) assessVideoQuality(assessment *QualityAssessment) (floa
 	return min(score, 1.0), confidence
 }
 
-// recommendMode 推荐处理模式 - 按照README要求的路由决策
+// 模式推荐依据，记录在 Details["recommended_by"] 中
+const (
+	RecommendedByHighQuality   = "high_quality"   // 极高/高品质 → 品质模式
+	RecommendedByMediumQuality = "medium_quality" // 中高/中低品质 → 自动模式+
+	RecommendedByLowQuality    = "low_quality"    // 低/极低品质 → 表情包模式
+	RecommendedByDefault       = "default"        // 其他等级（损坏、未知）→ 自动模式+
+)
+
+// ModeRecommendationThresholds 模式推荐的分支说明，与 recommendMode 保持一致
+const ModeRecommendationThresholds = "极高/高 品质模式, 中高/中低 自动模式+, 低/极低 表情包模式, 其余 自动模式+"
+
+// recommendMode 推荐处理模式 - 按照README要求的路由决策，命中的分支记录在 Details["recommended_by"] 中
 func (qe *QualityEngine) recommendMode(assessment *QualityAssessment) {
 	// README要求的“自动模式+”路由决策：
 	// 极高/高品质 -> 路由至品质模式的无损压缩逻辑
 	// 中高/中低品质 -> 路由至平衡优化逻辑
 	// 低品质 -> 触发极低品质决策流程
 
+	var basis string
 	switch assessment.QualityLevel {
 	case types.QualityVeryHigh, types.QualityHigh:
 		// README要求：高品质文件路由到品质模式
 		assessment.RecommendedMode = types.ModeQuality
+		basis = RecommendedByHighQuality
 
 	case types.QualityMediumHigh, types.QualityMediumLow:
 		// README要求：中等品质使用平衡优化（自动模式+）
 		assessment.RecommendedMode = types.ModeAutoPlus
+		basis = RecommendedByMediumQuality
 
 	case types.QualityLow, types.QualityVeryLow:
 		// README要求：低品质触发极低品质决策流程
 		// 用户可选择：跳过忽略、删除、强制转换、表情包模式
 		assessment.RecommendedMode = types.ModeEmoji // 默认建议表情包模式
+		basis = RecommendedByLowQuality
 
 	default:
 		assessment.RecommendedMode = types.ModeAutoPlus
+		basis = RecommendedByDefault
+	}
+
+	if assessment.Details == nil {
+		assessment.Details = make(map[string]interface{})
 	}
+	assessment.Details["recommended_by"] = basis
 }
 
 // estimateJpegQuality 估算JPEG品质
+// 优先使用量化表估算的libjpeg等效品质，头部无法解析时退回每像素字节数估算
 func (qe *QualityEngine) estimateJpegQuality(assessment *QualityAssessment) int {
+	if assessment.JpegQuality > 0 {
+		return assessment.JpegQuality
+	}
+	if qe.applyJpegHeader(assessment, assessment.FilePath) {
+		return assessment.JpegQuality
+	}
+
 	// 简化的JPEG品质估算基于文件大小和分辨率
 	if assessment.Width == 0 || assessment.Height == 0 || assessment.FileSize == 0 {
 		return 0
@@ -779,6 +840,46 @@ func (qe *QualityEngine) estimateJpegQuality(assessment *QualityAssessment) int
 	}
 }
 
+// applyJpegHeader 解析JPEG头部并写入评估结果，解析失败时返回false
+func (qe *QualityEngine) applyJpegHeader(assessment *QualityAssessment, filePath string) bool {
+	header, err := ParseJpegFile(filePath)
+	if err != nil {
+		qe.logger.Debug("JPEG头部解析失败",
+			zap.String("file", filepath.Base(filePath)),
+			zap.Error(err))
+		return false
+	}
+
+	assessment.JpegQuality = header.EstimatedQuality
+	assessment.JpegSubsampling = header.Subsampling
+	assessment.JpegResaved = header.LikelyResaved
+	if assessment.Width == 0 && assessment.Height == 0 {
+		assessment.Width = header.Width
+		assessment.Height = header.Height
+	}
+	if assessment.Width > 0 && assessment.Height > 0 && assessment.FileSize > 0 {
+		fileSizeMB := float64(assessment.FileSize) / (1024 * 1024)
+		assessment.PixelDensity = float64(assessment.Width*assessment.Height) / (fileSizeMB * 1000000)
+	}
+
+	// 与标准表完全一致时品质可精确还原
+	if header.StandardTables {
+		assessment.Confidence = max(assessment.Confidence, 0.95)
+	} else {
+		assessment.Confidence = max(assessment.Confidence, 0.9)
+	}
+
+	if assessment.Details != nil {
+		assessment.Details["jpeg_standard_tables"] = header.StandardTables
+		assessment.Details["jpeg_table_deviation"] = header.TableDeviation
+		assessment.Details["jpeg_progressive"] = header.Progressive
+		if len(header.ResaveSignals) > 0 {
+			assessment.Details["jpeg_resave_signals"] = header.ResaveSignals
+		}
+	}
+	return true
+}
+
 // BatchAssess 批量评估文件品质
 func (qe *QualityEngine) BatchAssess(ctx context.Context, filePaths []string, callback func(*QualityAssessment)) error {
 	for i, filePath := range filePaths {
@@ -0,0 +1,516 @@
+package quality
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pixly/pkg/core/types"
+)
+
+// JpegHeaderInfo JPEG头部解析结果
+//
+// 只读取SOS之前的段（DQT/SOF/APPn），不解码图像数据，单文件开销通常低于1ms。
+type JpegHeaderInfo struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Components  int    `json:"components"`
+	Precision   int    `json:"precision"`
+	Progressive bool   `json:"progressive"`
+	Subsampling string `json:"subsampling"` // "4:4:4", "4:2:2", "4:2:0", "4:4:0", "4:1:1", "gray"
+
+	// 量化表（自然顺序），索引为DQT中的表号
+	QuantTables map[int][64]uint16 `json:"-"`
+
+	// 估算结果
+	EstimatedQuality int     `json:"estimated_quality"` // libjpeg等效品质因子(1-100)
+	StandardTables   bool    `json:"standard_tables"`   // 量化表与libjpeg标准表缩放结果完全一致
+	TableDeviation   float64 `json:"table_deviation"`   // 与最接近的标准表的平均偏差
+
+	// 元数据线索
+	HasJFIF        bool        `json:"has_jfif"`
+	HasExif        bool        `json:"has_exif"`
+	HasAdobe       bool        `json:"has_adobe"`
+	HasPhotoshop   bool        `json:"has_photoshop"`
+	CameraMake     string      `json:"camera_make,omitempty"`
+	CameraModel    string      `json:"camera_model,omitempty"`
+	Software       string      `json:"software,omitempty"`
+	ThumbnailTable *[64]uint16 `json:"-"` // EXIF缩略图的亮度量化表
+
+	// 多次保存检测
+	LikelyResaved bool     `json:"likely_resaved"`
+	ResaveSignals []string `json:"resave_signals,omitempty"`
+}
+
+// libjpeg 标准亮度量化表（ITU-T T.81 Annex K，自然顺序）
+var stdLuminanceTable = [64]uint16{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// libjpeg 标准色度量化表（自然顺序）
+var stdChrominanceTable = [64]uint16{
+	17, 18, 24, 47, 99, 99, 99, 99,
+	18, 21, 26, 66, 99, 99, 99, 99,
+	24, 26, 56, 99, 99, 99, 99, 99,
+	47, 66, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+}
+
+// zigzagToNatural DQT中的之字形顺序到自然顺序的映射
+var zigzagToNatural = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// 常见的会重新编码JPEG的编辑软件（EXIF Software字段，小写匹配）
+var resavingSoftware = []string{
+	"photoshop", "lightroom", "gimp", "snapseed", "picasa", "paint.net",
+	"affinity", "pixelmator", "acdsee", "irfanview", "xnview", "imagemagick",
+	"graphicsmagick", "photos", "photoscape", "fotor", "meitu", "美图",
+}
+
+// ParseJpegFile 解析JPEG文件头部并估算品质
+func ParseJpegFile(path string) (*JpegHeaderInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseJpegHeader(file)
+}
+
+// ParseJpegHeader 解析JPEG头部（DQT/SOF/APPn）并估算libjpeg等效品质
+func ParseJpegHeader(r io.Reader) (*JpegHeaderInfo, error) {
+	info := &JpegHeaderInfo{QuantTables: make(map[int][64]uint16)}
+	if err := parseJpegSegments(bufio.NewReader(r), info, true); err != nil {
+		return nil, err
+	}
+	if len(info.QuantTables) == 0 {
+		return nil, fmt.Errorf("JPEG缺少量化表")
+	}
+
+	info.EstimatedQuality, info.StandardTables, info.TableDeviation = estimateQualityFromTables(info.QuantTables)
+	detectResave(info)
+	return info, nil
+}
+
+// parseJpegSegments 逐段解析直到SOS；withApp为false时只解析DQT/SOF（用于EXIF缩略图）
+func parseJpegSegments(r *bufio.Reader, info *JpegHeaderInfo, withApp bool) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return fmt.Errorf("读取JPEG头失败: %w", err)
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return fmt.Errorf("不是有效的JPEG文件")
+	}
+
+	for {
+		marker, err := nextMarker(r)
+		if err != nil {
+			return err
+		}
+
+		// 无长度的独立标记
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA { // EOI / SOS：头部结束
+			return nil
+		}
+
+		var lengthBuf [2]byte
+		if _, err := io.ReadFull(r, lengthBuf[:]); err != nil {
+			return fmt.Errorf("读取段长度失败: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(lengthBuf[:])) - 2
+		if length < 0 {
+			return fmt.Errorf("无效的段长度")
+		}
+
+		switch {
+		case marker == 0xDB:
+			payload, err := readPayload(r, length)
+			if err != nil {
+				return err
+			}
+			if err := parseDQT(payload, info); err != nil {
+				return err
+			}
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			payload, err := readPayload(r, length)
+			if err != nil {
+				return err
+			}
+			parseSOF(marker, payload, info)
+		case withApp && (marker == 0xE0 || marker == 0xE1 || marker == 0xED || marker == 0xEE):
+			payload, err := readPayload(r, length)
+			if err != nil {
+				return err
+			}
+			parseAPP(marker, payload, info)
+		default:
+			if _, err := r.Discard(length); err != nil {
+				return fmt.Errorf("跳过段失败: %w", err)
+			}
+		}
+	}
+}
+
+// nextMarker 读取下一个标记（跳过填充的0xFF）
+func nextMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("读取标记失败: %w", err)
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("无效的JPEG标记: 0x%02X", b)
+	}
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, fmt.Errorf("读取标记失败: %w", err)
+		}
+	}
+	return b, nil
+}
+
+func readPayload(r *bufio.Reader, length int) ([]byte, error) {
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("读取段数据失败: %w", err)
+	}
+	return payload, nil
+}
+
+// parseDQT 解析量化表段（一个段可包含多张表）
+func parseDQT(payload []byte, info *JpegHeaderInfo) error {
+	for len(payload) > 0 {
+		precision := payload[0] >> 4
+		id := int(payload[0] & 0x0F)
+		payload = payload[1:]
+
+		size := 64
+		if precision == 1 {
+			size = 128
+		}
+		if len(payload) < size {
+			return fmt.Errorf("量化表数据不完整")
+		}
+
+		var table [64]uint16
+		for i := 0; i < 64; i++ {
+			var v uint16
+			if precision == 1 {
+				v = binary.BigEndian.Uint16(payload[i*2:])
+			} else {
+				v = uint16(payload[i])
+			}
+			table[zigzagToNatural[i]] = v
+		}
+		info.QuantTables[id] = table
+		payload = payload[size:]
+	}
+	return nil
+}
+
+// parseSOF 解析帧头：尺寸、分量与采样因子
+func parseSOF(marker byte, payload []byte, info *JpegHeaderInfo) {
+	if len(payload) < 6 {
+		return
+	}
+	info.Precision = int(payload[0])
+	info.Height = int(binary.BigEndian.Uint16(payload[1:3]))
+	info.Width = int(binary.BigEndian.Uint16(payload[3:5]))
+	info.Components = int(payload[5])
+	info.Progressive = marker == 0xC2 || marker == 0xC6 || marker == 0xCA || marker == 0xCE
+
+	if info.Components == 1 {
+		info.Subsampling = "gray"
+		return
+	}
+	if len(payload) < 6+info.Components*3 || info.Components < 3 {
+		return
+	}
+
+	lumaH, lumaV := int(payload[7]>>4), int(payload[7]&0x0F)
+	chromaH, chromaV := int(payload[10]>>4), int(payload[10]&0x0F)
+	if chromaH == 0 || chromaV == 0 {
+		return
+	}
+
+	switch h, v := lumaH/chromaH, lumaV/chromaV; {
+	case h == 1 && v == 1:
+		info.Subsampling = "4:4:4"
+	case h == 2 && v == 1:
+		info.Subsampling = "4:2:2"
+	case h == 2 && v == 2:
+		info.Subsampling = "4:2:0"
+	case h == 1 && v == 2:
+		info.Subsampling = "4:4:0"
+	case h == 4 && v == 1:
+		info.Subsampling = "4:1:1"
+	default:
+		info.Subsampling = fmt.Sprintf("%dx%d", h, v)
+	}
+}
+
+// parseAPP 解析应用段中的来源线索
+func parseAPP(marker byte, payload []byte, info *JpegHeaderInfo) {
+	switch {
+	case marker == 0xE0 && bytes.HasPrefix(payload, []byte("JFIF\x00")):
+		info.HasJFIF = true
+	case marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+		info.HasExif = true
+		parseExifTIFF(payload[6:], info)
+	case marker == 0xED && bytes.HasPrefix(payload, []byte("Photoshop 3.0")):
+		info.HasPhotoshop = true
+	case marker == 0xEE && bytes.HasPrefix(payload, []byte("Adobe")):
+		info.HasAdobe = true
+	}
+}
+
+// parseExifTIFF 读取IFD0中的Make/Model/Software以及IFD1缩略图的量化表
+func parseExifTIFF(tiff []byte, info *JpegHeaderInfo) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	readIFD := func(offset uint32) (map[uint16][]byte, uint32) {
+		entries := make(map[uint16][]byte)
+		if int(offset)+2 > len(tiff) {
+			return entries, 0
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		pos := int(offset) + 2
+		for i := 0; i < count && pos+12 <= len(tiff); i++ {
+			entries[order.Uint16(tiff[pos:])] = tiff[pos : pos+12]
+			pos += 12
+		}
+		var next uint32
+		if pos+4 <= len(tiff) {
+			next = order.Uint32(tiff[pos:])
+		}
+		return entries, next
+	}
+
+	asciiValue := func(entry []byte) string {
+		if entry == nil || order.Uint16(entry[2:]) != 2 {
+			return ""
+		}
+		count := order.Uint32(entry[4:])
+		var raw []byte
+		if count <= 4 {
+			raw = entry[8 : 8+count]
+		} else {
+			offset := order.Uint32(entry[8:])
+			if uint64(offset)+uint64(count) > uint64(len(tiff)) {
+				return ""
+			}
+			raw = tiff[offset : offset+count]
+		}
+		return strings.TrimSpace(strings.TrimRight(string(raw), "\x00"))
+	}
+
+	longValue := func(entry []byte) uint32 {
+		if entry == nil {
+			return 0
+		}
+		if order.Uint16(entry[2:]) == 3 { // SHORT
+			return uint32(order.Uint16(entry[8:]))
+		}
+		return order.Uint32(entry[8:])
+	}
+
+	ifd0, next := readIFD(order.Uint32(tiff[4:]))
+	info.CameraMake = asciiValue(ifd0[0x010F])
+	info.CameraModel = asciiValue(ifd0[0x0110])
+	info.Software = asciiValue(ifd0[0x0131])
+
+	if next == 0 {
+		return
+	}
+	ifd1, _ := readIFD(next)
+	thumbOffset, thumbLength := longValue(ifd1[0x0201]), longValue(ifd1[0x0202])
+	if thumbOffset == 0 || thumbLength == 0 || uint64(thumbOffset)+uint64(thumbLength) > uint64(len(tiff)) {
+		return
+	}
+
+	thumb := &JpegHeaderInfo{QuantTables: make(map[int][64]uint16)}
+	thumbData := tiff[thumbOffset : thumbOffset+thumbLength]
+	if err := parseJpegSegments(bufio.NewReader(bytes.NewReader(thumbData)), thumb, false); err == nil {
+		if table, ok := thumb.QuantTables[0]; ok {
+			info.ThumbnailTable = &table
+		}
+	}
+}
+
+// scaleStandardTable 按libjpeg的jpeg_quality_scaling缩放标准表（force_baseline）
+func scaleStandardTable(base *[64]uint16, quality int) [64]uint16 {
+	var scale int
+	if quality < 50 {
+		scale = 5000 / quality
+	} else {
+		scale = 200 - quality*2
+	}
+
+	var table [64]uint16
+	for i, v := range base {
+		q := (int(v)*scale + 50) / 100
+		if q < 1 {
+			q = 1
+		} else if q > 255 {
+			q = 255
+		}
+		table[i] = uint16(q)
+	}
+	return table
+}
+
+// estimateQualityFromTables 找到与量化表最接近的libjpeg品质因子
+// 返回品质、是否与标准表完全一致、平均每系数偏差
+func estimateQualityFromTables(tables map[int][64]uint16) (int, bool, float64) {
+	luma, hasLuma := tables[0]
+	if !hasLuma {
+		for _, t := range tables {
+			luma = t
+			break
+		}
+	}
+	chroma, hasChroma := tables[1]
+
+	bestQuality, bestError := 0, -1
+	for q := 1; q <= 100; q++ {
+		stdLuma := scaleStandardTable(&stdLuminanceTable, q)
+		errSum := tableDistance(&luma, &stdLuma)
+		if hasChroma {
+			stdChroma := scaleStandardTable(&stdChrominanceTable, q)
+			errSum += tableDistance(&chroma, &stdChroma)
+		}
+		// 偏差相同时取更高的品质
+		if bestError < 0 || errSum <= bestError {
+			bestQuality, bestError = q, errSum
+		}
+	}
+
+	coefficients := 64.0
+	if hasChroma {
+		coefficients = 128.0
+	}
+	return bestQuality, bestError == 0, float64(bestError) / coefficients
+}
+
+func tableDistance(a, b *[64]uint16) int {
+	sum := 0
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return sum
+}
+
+// detectResave 基于头部线索判断图像是否经过多次保存
+//
+// 强信号：EXIF缩略图的量化表与主图不一致（主图在拍摄后被重新编码而缩略图保留原样）
+// 弱信号：EXIF中记录了编辑软件、Adobe/Photoshop段、剥离EXIF后的标准表中低品质（社交软件转存的典型特征）
+func detectResave(info *JpegHeaderInfo) {
+	var signals []string
+	strong := false
+
+	if info.ThumbnailTable != nil {
+		thumbQuality, _, _ := estimateQualityFromTables(map[int][64]uint16{0: *info.ThumbnailTable})
+		if luma, ok := info.QuantTables[0]; ok && thumbQuality != info.EstimatedQuality &&
+			tableDistance(&luma, info.ThumbnailTable) > 0 && info.CameraMake != "" {
+			signals = append(signals, fmt.Sprintf("thumbnail_quality_mismatch:%d", thumbQuality))
+			strong = true
+		}
+	}
+
+	if software := strings.ToLower(info.Software); software != "" {
+		for _, name := range resavingSoftware {
+			if strings.Contains(software, name) {
+				signals = append(signals, "editing_software:"+info.Software)
+				break
+			}
+		}
+	}
+
+	if info.HasPhotoshop || info.HasAdobe {
+		signals = append(signals, "adobe_segments")
+	}
+
+	if !info.HasExif && info.StandardTables && info.EstimatedQuality <= 85 {
+		signals = append(signals, "stripped_exif_standard_tables")
+	}
+
+	info.ResaveSignals = signals
+	info.LikelyResaved = strong || len(signals) >= 2
+}
+
+// ClassifyJpegQuality 按README标准将JPEG品质因子映射为品质等级；多次保存的文件下调一级
+func ClassifyJpegQuality(jpegQuality int, resaved bool) types.QualityLevel {
+	var level types.QualityLevel
+	switch {
+	case jpegQuality >= 90:
+		level = types.QualityVeryHigh
+	case jpegQuality >= 85:
+		level = types.QualityHigh
+	case jpegQuality >= 70:
+		level = types.QualityMediumHigh
+	case jpegQuality >= 50:
+		level = types.QualityMediumLow
+	case jpegQuality >= 30:
+		level = types.QualityLow
+	default:
+		level = types.QualityVeryLow
+	}
+
+	// 多次保存累积的失真不体现在量化表中
+	if resaved {
+		switch level {
+		case types.QualityVeryHigh:
+			level = types.QualityHigh
+		case types.QualityHigh:
+			level = types.QualityMediumHigh
+		case types.QualityMediumHigh:
+			level = types.QualityMediumLow
+		case types.QualityMediumLow:
+			level = types.QualityLow
+		case types.QualityLow:
+			level = types.QualityVeryLow
+		}
+	}
+	return level
+}
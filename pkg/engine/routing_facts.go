@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pixly/pkg/core/types"
+)
+
+// RoutingFacts 路由规则匹配使用的文件特征，未知的数值为 0、未知的布尔值为 nil
+type RoutingFacts struct {
+	Path         string
+	Ext          string
+	Size         int64
+	Width        int
+	Height       int
+	BitDepth     int
+	Alpha        *bool
+	Animated     *bool
+	QualityLevel types.QualityLevel
+	Exif         map[string]string
+}
+
+// routingVideoExts 视为动画的视频扩展名
+var routingVideoExts = map[string]bool{
+	".mp4": true, ".mov": true, ".avi": true, ".mkv": true, ".webm": true, ".m4v": true,
+}
+
+// CollectRoutingFacts 收集规则集需要的文件特征
+// 只在规则引用时读取图像头与 EXIF；PNG/GIF/WebP/JPEG 直接解析文件头，
+// 其他格式及 EXIF 标签通过 exiftool 读取（exiftoolPath 为空时保持未知）
+func CollectRoutingFacts(ctx context.Context, path string, qualityLevel types.QualityLevel, ruleSet *RoutingRuleSet, exiftoolPath string) *RoutingFacts {
+	facts := &RoutingFacts{
+		Path:         path,
+		Ext:          strings.ToLower(filepath.Ext(path)),
+		QualityLevel: qualityLevel,
+	}
+	if info, err := os.Stat(path); err == nil {
+		facts.Size = info.Size()
+	}
+
+	needsImageInfo := ruleSet.needsImageInfo()
+	if needsImageInfo {
+		if routingVideoExts[facts.Ext] {
+			facts.Animated = boolPtr(true)
+		} else {
+			readImageHeader(path, facts)
+		}
+	}
+
+	tags := ruleSet.exifTags()
+	incomplete := needsImageInfo && (facts.Width == 0 || facts.BitDepth == 0 || facts.Animated == nil)
+	if exiftoolPath != "" && (len(tags) > 0 || incomplete) {
+		readRoutingExif(ctx, exiftoolPath, facts, tags)
+	}
+	return facts
+}
+
+// readImageHeader 解析常见图片格式的文件头
+func readImageHeader(path string, facts *RoutingFacts) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	switch facts.Ext {
+	case ".png", ".apng":
+		readPNGHeader(reader, facts)
+	case ".gif":
+		readGIFHeader(reader, facts)
+	case ".webp":
+		readWebPHeader(reader, facts)
+	case ".jpg", ".jpeg", ".jpe", ".jfif":
+		if config, err := jpeg.DecodeConfig(reader); err == nil {
+			facts.Width, facts.Height, facts.BitDepth = config.Width, config.Height, 8
+			facts.Alpha, facts.Animated = boolPtr(false), boolPtr(false)
+		}
+	}
+}
+
+// readPNGHeader 读取 IHDR，并在 IDAT 之前查找 acTL（APNG）与 tRNS（调色板/灰度透明）
+func readPNGHeader(r *bufio.Reader, facts *RoutingFacts) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, []byte("\x89PNG\r\n\x1a\n")) {
+		return
+	}
+
+	alpha, animated := false, false
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[:4]))
+		switch string(chunk[4:8]) {
+		case "IHDR":
+			ihdr := make([]byte, 13)
+			if _, err := io.ReadFull(r, ihdr); err != nil {
+				return
+			}
+			facts.Width = int(binary.BigEndian.Uint32(ihdr[0:4]))
+			facts.Height = int(binary.BigEndian.Uint32(ihdr[4:8]))
+			facts.BitDepth = int(ihdr[8])
+			colorType := ihdr[9]
+			alpha = colorType == 4 || colorType == 6
+			length -= 13
+		case "acTL":
+			animated = true
+		case "tRNS":
+			alpha = true
+		case "IDAT", "IEND":
+			facts.Alpha, facts.Animated = boolPtr(alpha), boolPtr(animated)
+			return
+		}
+		// 跳过剩余数据与CRC
+		if _, err := io.CopyN(io.Discard, r, length+4); err != nil {
+			return
+		}
+	}
+}
+
+// readGIFHeader 遍历 GIF 数据块，出现第二帧即判定为动画；图形控制扩展带透明标志时视为有透明
+func readGIFHeader(r *bufio.Reader, facts *RoutingFacts) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("GIF8")) {
+		return
+	}
+	facts.Width = int(binary.LittleEndian.Uint16(header[6:8]))
+	facts.Height = int(binary.LittleEndian.Uint16(header[8:10]))
+	facts.BitDepth = 8
+	if packed := header[10]; packed&0x80 != 0 {
+		if _, err := io.CopyN(io.Discard, r, 3<<((packed&0x07)+1)); err != nil {
+			return
+		}
+	}
+
+	alpha, frames := false, 0
+	for frames < 2 {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			break
+		}
+		switch introducer {
+		case 0x21: // 扩展块
+			label, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			if label == 0xF9 {
+				gce := make([]byte, 6) // 块大小、标志、延时(2)、透明色索引、终止符
+				if _, err := io.ReadFull(r, gce); err != nil {
+					return
+				}
+				alpha = alpha || gce[1]&0x01 != 0
+				continue
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return
+			}
+		case 0x2C: // 图像描述符
+			frames++
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return
+			}
+			if packed := descriptor[8]; packed&0x80 != 0 {
+				if _, err := io.CopyN(io.Discard, r, 3<<((packed&0x07)+1)); err != nil {
+					return
+				}
+			}
+			if _, err := r.ReadByte(); err != nil { // LZW 最小码长
+				return
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return
+			}
+		default: // 0x3B 结束符或无法识别的数据
+			facts.Alpha, facts.Animated = boolPtr(alpha), boolPtr(frames > 1)
+			return
+		}
+	}
+	facts.Alpha, facts.Animated = boolPtr(alpha), boolPtr(frames > 1)
+}
+
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// readWebPHeader 解析 VP8X（扩展格式，含透明与动画标志）、VP8L（无损）与 VP8（有损）头
+func readWebPHeader(r *bufio.Reader, facts *RoutingFacts) {
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil ||
+		string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return
+	}
+	facts.BitDepth = 8
+
+	switch string(header[12:16]) {
+	case "VP8X":
+		flags := header[20]
+		facts.Alpha = boolPtr(flags&0x10 != 0)
+		facts.Animated = boolPtr(flags&0x02 != 0)
+		facts.Width = 1 + (int(header[24]) | int(header[25])<<8 | int(header[26])<<16)
+		facts.Height = 1 + (int(header[27]) | int(header[28])<<8 | int(header[29])<<16)
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		facts.Width = 1 + int(bits&0x3FFF)
+		facts.Height = 1 + int((bits>>14)&0x3FFF)
+		facts.Alpha = boolPtr(bits&(1<<28) != 0)
+		facts.Animated = boolPtr(false)
+	case "VP8 ":
+		facts.Width = int(binary.LittleEndian.Uint16(header[26:28]) & 0x3FFF)
+		facts.Height = int(binary.LittleEndian.Uint16(header[28:30]) & 0x3FFF)
+		facts.Alpha, facts.Animated = boolPtr(false), boolPtr(false)
+	}
+}
+
+// readRoutingExif 通过 exiftool 读取规则引用的标签，并补全文件头未能确定的宽高、位深度与帧数
+func readRoutingExif(ctx context.Context, exiftoolPath string, facts *RoutingFacts, tags []string) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	args := []string{"-json", "-n", "-ImageWidth", "-ImageHeight", "-BitsPerSample", "-BitDepth", "-FrameCount"}
+	for _, tag := range tags {
+		args = append(args, "-"+tag)
+	}
+	args = append(args, facts.Path)
+
+	output, err := exec.CommandContext(timeoutCtx, exiftoolPath, args...).Output()
+	if err != nil {
+		return
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(output, &records); err != nil || len(records) == 0 {
+		return
+	}
+	record := records[0]
+
+	facts.Exif = make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if value, ok := record[tag]; ok {
+			facts.Exif[tag] = exifValueString(value)
+		}
+	}
+
+	if facts.Width == 0 {
+		facts.Width = exifInt(record["ImageWidth"])
+		facts.Height = exifInt(record["ImageHeight"])
+	}
+	if facts.BitDepth == 0 {
+		facts.BitDepth = exifInt(record["BitsPerSample"])
+		if facts.BitDepth == 0 {
+			facts.BitDepth = exifInt(record["BitDepth"])
+		}
+	}
+	if facts.Animated == nil {
+		if frames := exifInt(record["FrameCount"]); frames > 0 {
+			facts.Animated = boolPtr(frames > 1)
+		}
+	}
+}
+
+// exifValueString 将 exiftool -json -n 输出的值转换为字符串
+func exifValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// exifInt 读取整数值；"8 8 8" 这类多通道值取第一个
+func exifInt(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	fields := strings.Fields(exifValueString(value))
+	if len(fields) == 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(fields[0])
+	return n
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,503 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pixly/pkg/core/types"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 📜 声明式路由规则 - 按顺序匹配文件特征，首个命中的规则决定处理方式
+// =============================================================================
+//
+// 规则文件为 JSON，示例：
+//
+//	{
+//	  "version": 1,
+//	  "rules": [
+//	    {"name": "scans", "match": {"path_globs": ["**/Scans/**"], "extensions": [".tif", ".png"]},
+//	     "action": {"type": "convert", "format": "jxl", "lossless": true, "effort": 9}},
+//	    {"name": "screenshots", "match": {"path_globs": ["Screenshot*"], "alpha": true},
+//	     "action": {"type": "convert", "format": "jxl", "lossless": true}},
+//	    {"name": "sony", "match": {"exif": {"Model": "ILCE-*"}, "min_size": "5MB"},
+//	     "action": {"type": "keep"}}
+//	  ]
+//	}
+//
+// 未命中任何规则的文件仍由内置路由决定。
+
+// RoutingRuleSetVersion 当前支持的规则文件版本
+const RoutingRuleSetVersion = 1
+
+// BuiltinRoutingRule 内置路由做出的决策记录的规则名
+const BuiltinRoutingRule = "builtin"
+
+// 规则动作类型
+const (
+	RuleActionConvert = "convert"
+	RuleActionSkip    = "skip"
+	RuleActionKeep    = "keep" // 保留原文件，不转换
+)
+
+// ruleActionFormats 规则可指定的目标格式：通用名称与引擎内部格式
+var ruleActionFormats = map[string]bool{
+	"jxl": true, "avif": true, "remux": true, "transcode": true,
+	"jxl_lossless": true, "jxl_lossy": true, "avif_compressed": true, "avif_balanced": true,
+	"video_transcode": true,
+}
+
+// ruleQualityLevels 规则中使用的品质等级名称
+var ruleQualityLevels = map[string]types.QualityLevel{
+	"unknown":     types.QualityUnknown,
+	"very_low":    types.QualityVeryLow,
+	"low":         types.QualityLow,
+	"medium_low":  types.QualityMediumLow,
+	"medium_high": types.QualityMediumHigh,
+	"high":        types.QualityHigh,
+	"very_high":   types.QualityVeryHigh,
+	"corrupted":   types.QualityCorrupted,
+}
+
+// RoutingRuleSet 有序的路由规则集合
+type RoutingRuleSet struct {
+	Version int           `json:"version"`
+	Rules   []RoutingRule `json:"rules"`
+}
+
+// RoutingRule 单条路由规则：Match 中的条件全部满足时执行 Action
+type RoutingRule struct {
+	Name   string     `json:"name"`
+	Match  RuleMatch  `json:"match"`
+	Action RuleAction `json:"action"`
+
+	globs []*regexp.Regexp
+}
+
+// RuleMatch 匹配条件，未设置的条件不参与匹配
+// 文件特征无法确定时（如非图片的位深度）相关条件视为不满足
+type RuleMatch struct {
+	Extensions    []string          `json:"extensions,omitempty"` // 如 ".png"，不区分大小写
+	PathGlobs     []string          `json:"path_globs,omitempty"` // 支持 ** ；不含 / 的模式只匹配文件名
+	MinSize       ByteSize          `json:"min_size,omitempty"`   // 字节数或 "500KB"、"10MB"
+	MaxSize       ByteSize          `json:"max_size,omitempty"`
+	MinWidth      int               `json:"min_width,omitempty"`
+	MaxWidth      int               `json:"max_width,omitempty"`
+	MinHeight     int               `json:"min_height,omitempty"`
+	MaxHeight     int               `json:"max_height,omitempty"`
+	MinBitDepth   int               `json:"min_bit_depth,omitempty"` // 每通道位深
+	MaxBitDepth   int               `json:"max_bit_depth,omitempty"`
+	Alpha         *bool             `json:"alpha,omitempty"`          // 是否带透明通道
+	Animated      *bool             `json:"animated,omitempty"`       // 是否为动图/视频
+	QualityLevels []string          `json:"quality_levels,omitempty"` // 见 ruleQualityLevels
+	Exif          map[string]string `json:"exif,omitempty"`           // exiftool 标签名 → 通配模式，如 "Model": "iPhone*"
+}
+
+// RuleAction 规则命中后的处理方式
+type RuleAction struct {
+	Type     string `json:"type"`               // "convert", "skip", "keep"
+	Format   string `json:"format,omitempty"`   // "jxl", "avif", "remux", "transcode" 或引擎内部格式
+	Lossless *bool  `json:"lossless,omitempty"` // JXL 默认无损
+	Quality  int    `json:"quality,omitempty"`  // 1-100，有损编码品质
+	Effort   int    `json:"effort,omitempty"`   // 1-9，JXL 为 -e，AVIF 换算为速度 10-effort
+}
+
+// ByteSize 文件大小，JSON 中可写为字节数或带单位的字符串
+type ByteSize int64
+
+// UnmarshalJSON 解析 1048576、"1048576"、"512KB"、"1.5MB"、"2GB"（以1024为进制）
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*b = ByteSize(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("无效的文件大小: %s", data)
+	}
+	size, err := parseByteSize(text)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func parseByteSize(text string) (ByteSize, error) {
+	upper := strings.ToUpper(strings.TrimSpace(text))
+	multiplier := float64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(upper, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("无效的文件大小: %q", text)
+	}
+	return ByteSize(value * multiplier), nil
+}
+
+// LoadRoutingRules 从文件加载并校验路由规则
+func LoadRoutingRules(path string) (*RoutingRuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取路由规则文件失败: %w", err)
+	}
+	rules, err := ParseRoutingRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRoutingRules 解析并校验路由规则
+func ParseRoutingRules(data []byte) (*RoutingRuleSet, error) {
+	var ruleSet RoutingRuleSet
+	if err := json.Unmarshal(data, &ruleSet); err != nil {
+		return nil, fmt.Errorf("解析路由规则失败: %w", err)
+	}
+	if ruleSet.Version == 0 {
+		ruleSet.Version = RoutingRuleSetVersion
+	}
+	if ruleSet.Version != RoutingRuleSetVersion {
+		return nil, fmt.Errorf("不支持的路由规则版本: %d (当前支持 %d)", ruleSet.Version, RoutingRuleSetVersion)
+	}
+
+	names := make(map[string]bool, len(ruleSet.Rules))
+	for i := range ruleSet.Rules {
+		rule := &ruleSet.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Name == BuiltinRoutingRule || names[rule.Name] {
+			return nil, fmt.Errorf("规则名重复或为保留名: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("规则 %s: %w", rule.Name, err)
+		}
+	}
+	return &ruleSet, nil
+}
+
+// compile 校验规则并预编译路径模式
+func (r *RoutingRule) compile() error {
+	for i, ext := range r.Match.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		r.Match.Extensions[i] = ext
+	}
+	for _, level := range r.Match.QualityLevels {
+		if _, ok := ruleQualityLevels[level]; !ok {
+			return fmt.Errorf("未知的品质等级: %s", level)
+		}
+	}
+	r.globs = r.globs[:0]
+	for _, pattern := range r.Match.PathGlobs {
+		glob, err := compilePathGlob(pattern)
+		if err != nil {
+			return err
+		}
+		r.globs = append(r.globs, glob)
+	}
+
+	action := &r.Action
+	switch action.Type {
+	case RuleActionConvert:
+		if !ruleActionFormats[action.Format] {
+			return fmt.Errorf("无效的目标格式: %q", action.Format)
+		}
+	case RuleActionSkip, RuleActionKeep:
+	default:
+		return fmt.Errorf("无效的动作类型: %q (可选: convert, skip, keep)", action.Type)
+	}
+	if action.Quality < 0 || action.Quality > 100 {
+		return fmt.Errorf("无效的品质: %d (应在 1-100 之间)", action.Quality)
+	}
+	if action.Effort < 0 || action.Effort > 9 {
+		return fmt.Errorf("无效的努力值: %d (应在 1-9 之间)", action.Effort)
+	}
+	return nil
+}
+
+// compilePathGlob 将路径通配模式转换为正则：** 匹配任意层目录，* 与 ? 不跨越 /
+// 不含 / 的模式只匹配文件名，否则匹配完整路径的结尾部分
+func compilePathGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = filepath.ToSlash(pattern)
+	var expr strings.Builder
+	if strings.Contains(pattern, "/") {
+		if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**") {
+			expr.WriteString("(^|/)")
+		} else {
+			expr.WriteString("^")
+		}
+	} else {
+		expr.WriteString("(^|/)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					expr.WriteString("(.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	glob, err := regexp.Compile("(?i)" + expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("无效的路径模式 %q: %w", pattern, err)
+	}
+	return glob, nil
+}
+
+// needsImageInfo 是否有规则需要宽高、位深度、透明或动画信息
+func (rs *RoutingRuleSet) needsImageInfo() bool {
+	for _, rule := range rs.Rules {
+		m := rule.Match
+		if m.MinWidth > 0 || m.MaxWidth > 0 || m.MinHeight > 0 || m.MaxHeight > 0 ||
+			m.MinBitDepth > 0 || m.MaxBitDepth > 0 || m.Alpha != nil || m.Animated != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// exifTags 规则引用的全部 EXIF 标签
+func (rs *RoutingRuleSet) exifTags() []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, rule := range rs.Rules {
+		for tag := range rule.Match.Exif {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// Match 返回第一条与文件特征匹配的规则，均不匹配时返回 nil
+func (rs *RoutingRuleSet) Match(facts *RoutingFacts) *RoutingRule {
+	for i := range rs.Rules {
+		if rs.Rules[i].matches(facts) {
+			return &rs.Rules[i]
+		}
+	}
+	return nil
+}
+
+// matches 判断规则是否匹配；损坏文件只匹配明确列出 "corrupted" 品质等级的规则
+func (r *RoutingRule) matches(facts *RoutingFacts) bool {
+	m := &r.Match
+
+	if len(m.Extensions) > 0 && !containsString(m.Extensions, facts.Ext) {
+		return false
+	}
+	if len(r.globs) > 0 {
+		path := filepath.ToSlash(facts.Path)
+		matched := false
+		for _, glob := range r.globs {
+			if glob.MatchString(path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if (m.MinSize > 0 && facts.Size < int64(m.MinSize)) || (m.MaxSize > 0 && facts.Size > int64(m.MaxSize)) {
+		return false
+	}
+	if !inRange(facts.Width, m.MinWidth, m.MaxWidth) ||
+		!inRange(facts.Height, m.MinHeight, m.MaxHeight) ||
+		!inRange(facts.BitDepth, m.MinBitDepth, m.MaxBitDepth) {
+		return false
+	}
+	if !boolMatches(m.Alpha, facts.Alpha) || !boolMatches(m.Animated, facts.Animated) {
+		return false
+	}
+
+	levelListed := false
+	for _, name := range m.QualityLevels {
+		if ruleQualityLevels[name] == facts.QualityLevel {
+			levelListed = true
+			break
+		}
+	}
+	if len(m.QualityLevels) > 0 && !levelListed {
+		return false
+	}
+	if facts.QualityLevel == types.QualityCorrupted && !levelListed {
+		return false
+	}
+
+	for tag, pattern := range m.Exif {
+		value, ok := facts.Exif[tag]
+		if !ok {
+			return false
+		}
+		if matched, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(value)); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Decision 由规则动作生成路由决策，品质等级沿用内置路由的评估结果
+func (r *RoutingRule) Decision(qualityLevel types.QualityLevel) *types.RoutingDecision {
+	decision := &types.RoutingDecision{
+		Strategy:     r.Action.Type,
+		QualityLevel: qualityLevel,
+		Reason:       "routing_rule",
+		Rule:         r.Name,
+	}
+	if r.Action.Type == RuleActionConvert {
+		decision.TargetFormat = r.Action.Format
+		decision.Lossless = r.Action.Lossless
+		decision.Quality = r.Action.Quality
+		decision.Effort = r.Action.Effort
+	}
+	return decision
+}
+
+// inRange 未设置上下限时总是满足；设置了任一边界而值未知（0）时不满足
+func inRange(value, minValue, maxValue int) bool {
+	if minValue <= 0 && maxValue <= 0 {
+		return true
+	}
+	if value <= 0 {
+		return false
+	}
+	return (minValue <= 0 || value >= minValue) && (maxValue <= 0 || value <= maxValue)
+}
+
+// boolMatches 未设置条件时总是满足；值未知时不满足
+func boolMatches(want, actual *bool) bool {
+	if want == nil {
+		return true
+	}
+	return actual != nil && *actual == *want
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRuleDecision 将规则的转换动作应用到任务：映射为引擎内部格式，并通过 Options 传递编码参数
+func (e *ConversionEngine) applyRuleDecision(task ConversionTask, decision *types.RoutingDecision) ConversionTask {
+	switch decision.TargetFormat {
+	case "jxl":
+		if decision.Lossless != nil && !*decision.Lossless {
+			task.TargetFormat = "jxl_lossy"
+		} else {
+			task.TargetFormat = "jxl_lossless"
+		}
+	case "avif":
+		task.TargetFormat = "avif_compressed"
+	case "transcode":
+		if e.videoTranscoder != nil {
+			task.TargetFormat = "video_transcode"
+		} else {
+			e.logger.Warn("未启用视频转码，规则指定的转码改为重包装",
+				zap.String("file", filepath.Base(task.SourcePath)),
+				zap.String("rule", decision.Rule))
+			task.TargetFormat = "remux"
+		}
+	default:
+		task.TargetFormat = decision.TargetFormat
+	}
+	task.Quality = decision.QualityLevel.String()
+
+	task.Options = withTaskOption(task.Options, "rule", decision.Rule)
+	if decision.Lossless != nil {
+		task.Options["lossless"] = *decision.Lossless
+	}
+	if decision.Quality > 0 {
+		task.Options["quality"] = decision.Quality
+	}
+	if decision.Effort > 0 {
+		task.Options["effort"] = decision.Effort
+	}
+	return task
+}
+
+// applyRuleEncodeOptions 应用路由规则指定的编码参数，未指定的参数保持格式默认值
+func applyRuleEncodeOptions(job *EncodeJob, task ConversionTask) {
+	if job.OutputFormat == "avif" {
+		if lossless, ok := task.Options["lossless"].(bool); ok && lossless {
+			job.Lossless = true
+		}
+	}
+	if quality := taskOptionInt(task.Options, "quality"); quality > 0 && !job.Lossless && !job.LosslessJPEG {
+		job.Quality = quality
+		if job.OutputFormat == "avif" {
+			job.CRF = (100 - quality) * 63 / 100 // FFmpeg AV1 的 CRF 范围为 0-63
+		}
+	}
+	if effort := taskOptionInt(task.Options, "effort"); effort > 0 {
+		if job.OutputFormat == "avif" {
+			job.Speed = 10 - effort
+		} else {
+			job.Effort = effort
+		}
+	}
+}
+
+// withTaskOption 设置任务选项，必要时创建 Options
+func withTaskOption(options map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	options[key] = value
+	return options
+}
+
+// taskOptionInt 读取整数选项；任务经 JSON 持久化后数值为 float64
+func taskOptionInt(options map[string]interface{}, key string) int {
+	switch v := options[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/report"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 📊 HTML 运行报告 - 配置了 html_report 时在运行结束后生成单文件报告
+// =============================================================================
+//
+// 报告汇总本次运行的转换结果，附带校验层未通过的文件和抽样的前后对比缩略图。
+// 转换可能原地替换源文件，缩略图的“转换前”一侧在转换开始前生成。
+
+// runReport 一次运行中为 HTML 报告收集的数据
+type runReport struct {
+	path      string
+	mode      string
+	startedAt time.Time
+	sampler   *report.Sampler
+
+	mu         sync.Mutex
+	validation []report.ValidationFailure
+}
+
+// newRunReport 每次运行开始时创建；未配置报告路径时返回 nil，没有 ffmpeg 时报告不含缩略图
+func newRunReport(path, mode, ffmpegPath string, thumbnails int) *runReport {
+	if path == "" {
+		return nil
+	}
+	r := &runReport{path: path, mode: mode, startedAt: time.Now()}
+	if ffmpegPath != "" && thumbnails > 0 {
+		r.sampler = report.NewSampler(report.NewThumbnailer(ffmpegPath, report.DefaultThumbnailWidth), thumbnails)
+	}
+	return r
+}
+
+// addValidationFailure 记录校验层未通过的文件
+func (r *runReport) addValidationFailure(failure report.ValidationFailure) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.validation = append(r.validation, failure)
+	r.mu.Unlock()
+}
+
+// sampleBefore 为抽中的任务生成转换前的缩略图，按源文件返回
+func (r *runReport) sampleBefore(ctx context.Context, tasks []ConversionTask, dryRun bool) map[string]*report.Pending {
+	if r == nil || r.sampler == nil || dryRun {
+		return nil
+	}
+	pending := make(map[string]*report.Pending, len(tasks))
+	for _, task := range tasks {
+		if p := r.sampler.Before(ctx, task.SourcePath); p != nil {
+			pending[task.SourcePath] = p
+		}
+	}
+	return pending
+}
+
+// sampleAfter 为转换成功的样本生成转换后的缩略图
+func (r *runReport) sampleAfter(ctx context.Context, pending map[string]*report.Pending, results []ConversionResult) {
+	if len(pending) == 0 {
+		return
+	}
+	for _, result := range results {
+		if p := pending[result.SourcePath]; p != nil && result.Status == "success" && result.TargetPath != "" {
+			r.sampler.After(ctx, p, result.TargetPath, result.OriginalSize, result.NewSize)
+		}
+	}
+}
+
+// writeHTMLReport 汇总结果并写入 HTML 报告，失败只记录日志
+func (e *ConversionEngine) writeHTMLReport(results []ConversionResult) {
+	r := e.runReport
+	if r == nil {
+		return
+	}
+
+	session := &report.Session{
+		TargetDir:  e.config.TargetDir,
+		Mode:       r.mode,
+		StartedAt:  r.startedAt,
+		FinishedAt: time.Now(),
+		Results:    make([]report.FileResult, 0, len(results)),
+	}
+	for _, result := range results {
+		session.Results = append(session.Results, report.FileResult{
+			Source:       result.SourcePath,
+			Target:       result.TargetPath,
+			Status:       result.Status,
+			Message:      result.Message,
+			OriginalSize: result.OriginalSize,
+			NewSize:      result.NewSize,
+			Duration:     result.Duration,
+		})
+	}
+	r.mu.Lock()
+	session.ValidationFailures = append([]report.ValidationFailure(nil), r.validation...)
+	r.mu.Unlock()
+	session.Thumbnails = r.sampler.Thumbnails()
+
+	path := report.ResolvePath(r.path, session.FinishedAt)
+	if err := report.Write(path, report.Build(session, report.DefaultTopN)); err != nil {
+		e.logger.Warn("生成HTML运行报告失败", zap.String("path", path), zap.Error(err))
+		fmt.Printf("⚠️ 生成HTML运行报告失败: %v\n", err)
+		return
+	}
+	e.logger.Info("HTML运行报告已生成", zap.String("path", path))
+	fmt.Printf("📊 HTML运行报告: %s\n", path)
+}
+
+// livePhotoFailure Live Photo 整体回滚的报告条目
+func livePhotoFailure(pair *LivePhotoPair, err error) report.ValidationFailure {
+	return report.ValidationFailure{
+		Source: pair.StillPath,
+		Output: pair.VideoPath,
+		Kind:   "live_photo_pairing",
+		Reason: err.Error(),
+	}
+}
+
+// verificationFailure 将未通过的校验记录转换为报告条目
+func verificationFailure(record *types.VerificationRecord) report.ValidationFailure {
+	return report.ValidationFailure{
+		Source: record.SourcePath,
+		Output: record.OutputPath,
+		Kind:   record.Kind,
+		Reason: record.Error,
+	}
+}
@@ -0,0 +1,467 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/metrics"
+	"pixly/pkg/ui/progress"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 🌊 流式转换管道 - 发现→配对→评估/路由→转换 各阶段通过有界通道并行运行
+// =============================================================================
+//
+// 每个阶段只持有通道容量内的文件，下游处理不过来时上游阻塞（背压），
+// 目录仍在遍历时已有文件开始转换。目录按“先读完整个目录再输出”的方式遍历：
+//   - 同一目录的文件一起输出，Live Photo 两半可以在同一批次内配对
+//   - 目录列表在转换开始前已读取，同目录新生成的输出文件不会被再次扫描
+//
+// 评估与转换之间是状态数据库中的持久化队列（见 job_queue.go），评估结果落盘后
+// 转换工作者按优先级取出；评估不受转换速度限制，中断后未转换的单元留在队列中。
+
+// streamAssessWorkers 评估阶段并发数，与 assessFiles 的限制一致
+const streamAssessWorkers = 3
+
+// pipelineUnit 管道中的处理单元：单个文件，或需要整体处理的 Live Photo 两半
+type pipelineUnit struct {
+	files []*types.MediaInfo
+	tasks []ConversionTask
+	pair  *LivePhotoPair
+}
+
+// pipelineCounters 流式管道统计
+type pipelineCounters struct {
+	discovered atomic.Int64
+	assessed   atomic.Int64
+	corrupted  atomic.Int64
+	lowQuality atomic.Int64
+	queued     atomic.Int64 // 进入转换队列的任务数（含上次运行未完成的任务）
+}
+
+// discoverFunc 文件发现阶段：按目录批次把媒体文件交给 emit
+type discoverFunc func(ctx context.Context, emit func([]*types.MediaInfo) error) error
+
+// walkTargetDir 遍历目标目录的发现阶段
+func (e *ConversionEngine) walkTargetDir(ctx context.Context, emit func([]*types.MediaInfo) error) error {
+	return e.walkMediaDirectories(ctx, e.config.TargetDir, emit)
+}
+
+// runStreamingPipeline 执行流式管道并返回全部转换结果
+// convertWorkers 为 0 时只扫描和评估，转换单元留在持久化队列中（见 Plan）
+func (e *ConversionEngine) runStreamingPipeline(ctx context.Context, discover discoverFunc, convertWorkers int) ([]ConversionResult, *pipelineCounters, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bufferSize := max(e.config.ConcurrentJobs*2, streamAssessWorkers*2)
+	counters := &pipelineCounters{}
+
+	// 总数在遍历过程中逐步确定，进度条以0创建后动态增加
+	e.progressManager.CreateAssessmentProgress(0)
+	e.progressManager.CreateConversionProgress(0)
+
+	// 阶段1: 文件发现 - 每个目录输出一个批次
+	batches := make(chan []*types.MediaInfo, bufferSize)
+	var walkErr error
+	go func() {
+		defer close(batches)
+		walkErr = discover(ctx, func(batch []*types.MediaInfo) error {
+			select {
+			case batches <- batch:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if walkErr == nil {
+			e.logger.Info("文件扫描完成", zap.Int64("total_files", counters.discovered.Load()))
+		}
+	}()
+
+	// 评估后的单元写入持久化队列，已在队列中的文件不再重复扫描
+	queue, queued := e.openConversionQueue(bufferSize, convertWorkers > 0, counters)
+
+	// 阶段2: 记录状态并按目录批次配对 Live Photo
+	units := make(chan *pipelineUnit, bufferSize)
+	go func() {
+		defer close(units)
+		for batch := range batches {
+			for _, unit := range e.planUnits(ctx, batch, queued, counters) {
+				select {
+				case units <- unit:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	// 阶段3: 质量评估与路由，结果加入转换队列
+	var assessWg sync.WaitGroup
+	for i := 0; i < streamAssessWorkers; i++ {
+		assessWg.Add(1)
+		go func() {
+			defer assessWg.Done()
+			for unit := range units {
+				if !e.assessUnit(ctx, unit, counters) {
+					continue
+				}
+				if err := queue.push(ctx, unit); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					e.queueFailed(unit, err)
+				}
+			}
+		}()
+	}
+	assessed := make(chan struct{})
+	go func() {
+		assessWg.Wait()
+		queue.closeInput()
+		close(assessed)
+	}()
+
+	// 阶段4: 转换 - 按队列优先级取单元
+	resultsCh := make(chan ConversionResult, bufferSize)
+	var convertWg sync.WaitGroup
+	for i := 0; i < convertWorkers; i++ {
+		convertWg.Add(1)
+		go func() {
+			defer convertWg.Done()
+			for unit := queue.next(ctx); unit != nil; unit = queue.next(ctx) {
+				results := e.convertUnit(ctx, unit)
+				queue.finish(ctx, unit, results)
+				for _, result := range results {
+					resultsCh <- result
+				}
+			}
+		}()
+	}
+	go func() {
+		convertWg.Wait()
+		close(resultsCh)
+	}()
+
+	// 阶段5: 逐个记录结果
+	var results []ConversionResult
+	for result := range resultsCh {
+		results = append(results, result)
+		e.progressManager.UpdateProgress(progress.ProgressTypeConversion, 1)
+		e.updateFileState(result.SourcePath, conversionStatusToProcessing(result.Status))
+	}
+
+	// 没有转换工作协程时（只规划）结果通道立即关闭，需等待评估阶段写完队列
+	<-assessed
+
+	e.progressManager.CompleteProgress(progress.ProgressTypeAssessment)
+	e.progressManager.CompleteProgress(progress.ProgressTypeConversion)
+
+	if walkErr != nil {
+		return results, counters, fmt.Errorf("扫描目录失败: %w", walkErr)
+	}
+	return results, counters, nil
+}
+
+// walkMediaDirectories 递归遍历目录，每个目录的媒体文件作为一个批次交给 emit
+// 无法读取的子目录记录警告后跳过；根目录无法读取时返回错误
+func (e *ConversionEngine) walkMediaDirectories(ctx context.Context, dir string, emit func([]*types.MediaInfo) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if dir == e.config.TargetDir {
+			return err
+		}
+		e.logger.Warn("访问目录时出错", zap.String("path", dir), zap.Error(err))
+		return nil // 继续扫描其他目录
+	}
+
+	var batch []*types.MediaInfo
+	var subdirs []string
+	for _, entry := range entries {
+		// 跳过备份、缓存等自身产生的文件
+		if strings.HasPrefix(entry.Name(), ".pixly_") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			subdirs = append(subdirs, path)
+			continue
+		}
+		if !scanSupportedExts[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			e.logger.Warn("访问文件时出错", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		batch = append(batch, &types.MediaInfo{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	if len(batch) > 0 {
+		if err := emit(batch); err != nil {
+			return err
+		}
+	}
+
+	for _, subdir := range subdirs {
+		if err := e.walkMediaDirectories(ctx, subdir, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planUnits 逐个记录发现的文件，并把同一目录中的 Live Photo 两半合为一个单元
+// 已在转换队列中的文件跳过
+func (e *ConversionEngine) planUnits(ctx context.Context, batch []*types.MediaInfo, queued map[string]bool, counters *pipelineCounters) []*pipelineUnit {
+	batch = slices.DeleteFunc(batch, func(file *types.MediaInfo) bool { return queued[file.Path] })
+	if len(batch) == 0 {
+		return nil
+	}
+	counters.discovered.Add(int64(len(batch)))
+	e.progressManager.AddTotal(progress.ProgressTypeAssessment, len(batch))
+
+	byPath := make(map[string]*types.MediaInfo, len(batch))
+	paths := make([]string, len(batch))
+	for i, file := range batch {
+		file.Status = types.StatusPending
+		e.saveFileState(file)
+		byPath[file.Path] = file
+		paths[i] = file.Path
+	}
+
+	var units []*pipelineUnit
+	paired := make(map[string]bool)
+	if e.livePhotoPairer != nil {
+		for _, pair := range e.livePhotoPairer.FindPairs(ctx, paths) {
+			paired[pair.StillPath], paired[pair.VideoPath] = true, true
+			units = append(units, &pipelineUnit{
+				files: []*types.MediaInfo{byPath[pair.StillPath], byPath[pair.VideoPath]},
+				pair:  pair,
+			})
+		}
+	}
+	for _, file := range batch {
+		if !paired[file.Path] {
+			units = append(units, &pipelineUnit{files: []*types.MediaInfo{file}})
+		}
+	}
+	return units
+}
+
+// assessUnit 评估并路由单元内的文件，返回是否还有需要转换的任务
+func (e *ConversionEngine) assessUnit(ctx context.Context, unit *pipelineUnit, counters *pipelineCounters) bool {
+	if e.pause.wait(ctx) != nil {
+		return false
+	}
+	for _, file := range unit.files {
+		e.updateFileState(file.Path, types.StatusAssessing)
+
+		trace := &decisionTrace{}
+		task, lowQuality, corrupted := e.assessTask(ctx, file.Path, trace)
+		counters.assessed.Add(1)
+		e.progressManager.UpdateProgress(progress.ProgressTypeAssessment, 1)
+		if corrupted {
+			counters.corrupted.Add(1)
+			metrics.FilesProcessed.WithLabelValues("corrupted", sourceFormat(file.Path)).Inc()
+			e.updateFileState(file.Path, types.StatusCorrupted)
+			e.saveDecisions(file.Path, trace)
+			continue
+		}
+		if lowQuality {
+			counters.lowQuality.Add(1)
+		}
+
+		// 自动模式+逐个文件执行智能路由
+		if e.config.Mode == "auto+" {
+			decision := e.autoPlusRouter.RouteFile(ctx, file.Path)
+			trace.records = append(trace.records, decision.Trace...)
+			routedTasks := e.applyRoutingDecisions([]ConversionTask{task}, map[string]*types.RoutingDecision{file.Path: decision})
+			if len(routedTasks) == 0 {
+				e.updateFileState(file.Path, types.StatusSkipped)
+				e.saveDecisions(file.Path, trace)
+				continue
+			}
+			task = routedTasks[0]
+		}
+
+		task, _ = e.routeTask(task)
+		e.saveDecisions(file.Path, trace)
+		unit.tasks = append(unit.tasks, task)
+	}
+
+	// 有一半被跳过或损坏时，另一半按单个文件处理
+	if unit.pair != nil && len(unit.tasks) != 2 {
+		unit.pair = nil
+	}
+
+	if len(unit.tasks) == 0 {
+		return false
+	}
+	counters.queued.Add(int64(len(unit.tasks)))
+	e.progressManager.AddTotal(progress.ProgressTypeConversion, len(unit.tasks))
+	return true
+}
+
+// convertUnit 转换一个单元，Live Photo 两半整体处理
+func (e *ConversionEngine) convertUnit(ctx context.Context, unit *pipelineUnit) []ConversionResult {
+	if e.pause.wait(ctx) != nil {
+		return nil
+	}
+	for _, task := range unit.tasks {
+		e.updateFileState(task.SourcePath, types.StatusConverting)
+	}
+	metrics.ActiveWorkers.Inc()
+	defer metrics.ActiveWorkers.Dec()
+
+	pending := e.runReport.sampleBefore(ctx, unit.tasks, e.config.DryRun)
+	var results []ConversionResult
+	if unit.pair != nil {
+		results = e.processLivePhotoPair(ctx, unit.pair, unit.tasks[0], unit.tasks[1])
+	} else {
+		results = make([]ConversionResult, 0, len(unit.tasks))
+		for _, task := range unit.tasks {
+			results = append(results, e.processTask(ctx, task))
+		}
+	}
+	for _, result := range results {
+		recordResultMetrics(result)
+		e.appendDecisions(result.SourcePath, append(result.Decisions, traceResult(result))...)
+	}
+	e.runReport.sampleAfter(ctx, pending, results)
+	return results
+}
+
+// recordResultMetrics 按结果状态和源格式累计文件数，成功时累计输入、输出和节省的字节数
+func recordResultMetrics(result ConversionResult) {
+	metrics.FilesProcessed.WithLabelValues(result.Status, sourceFormat(result.SourcePath)).Inc()
+	if result.Status != "success" {
+		return
+	}
+	metrics.InputBytes.Add(float64(result.OriginalSize))
+	metrics.OutputBytes.Add(float64(result.NewSize))
+	metrics.BytesSaved.Add(float64(result.OriginalSize - result.NewSize))
+}
+
+// sourceFormat 源文件格式（不带点的小写扩展名）
+func sourceFormat(path string) string {
+	if format := normalizeFormat(filepath.Ext(path)); format != "" {
+		return format
+	}
+	return "unknown"
+}
+
+// saveFileState 记录单个文件到状态数据库
+func (e *ConversionEngine) saveFileState(file *types.MediaInfo) {
+	if e.stateManager == nil {
+		return
+	}
+	if err := e.stateManager.SaveMediaFile(file); err != nil {
+		e.logger.Debug("保存文件状态失败", zap.String("file", filepath.Base(file.Path)), zap.Error(err))
+	}
+}
+
+// updateFileState 更新单个文件在状态数据库中的处理状态
+func (e *ConversionEngine) updateFileState(path string, status types.ProcessingStatus) {
+	if e.stateManager == nil {
+		return
+	}
+	if err := e.stateManager.UpdateMediaFileStatus(path, status); err != nil {
+		e.logger.Debug("更新文件状态失败", zap.String("file", filepath.Base(path)), zap.Error(err))
+	}
+}
+
+// conversionStatusToProcessing 将转换结果状态映射为持久化的处理状态
+func conversionStatusToProcessing(status string) types.ProcessingStatus {
+	switch status {
+	case "success":
+		return types.StatusCompleted
+	case "skipped", "kept":
+		return types.StatusSkipped
+	default:
+		return types.StatusFailed
+	}
+}
+
+// pauseGate 暂停控制：暂停期间新的单元在评估或转换前等待，进行中的文件继续完成
+type pauseGate struct {
+	mu     sync.Mutex
+	resume chan struct{} // 非 nil 表示已暂停，恢复时关闭
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil {
+		g.resume = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) unpause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume != nil {
+		close(g.resume)
+		g.resume = nil
+	}
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// wait 暂停时阻塞到恢复或 ctx 取消
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resume := g.resume
+	g.mu.Unlock()
+	if resume == nil {
+		return nil
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause 暂停处理：已开始的文件继续完成，其余文件等待 Resume
+func (e *ConversionEngine) Pause() {
+	e.pause.pause()
+}
+
+// Resume 恢复暂停的处理
+func (e *ConversionEngine) Resume() {
+	e.pause.unpause()
+}
+
+// IsPaused 是否处于暂停状态
+func (e *ConversionEngine) IsPaused() bool {
+	return e.pause.paused()
+}
+
+// ProgressStats 返回当前进度统计副本
+func (e *ConversionEngine) ProgressStats() *progress.ProgressStats {
+	return e.progressManager.GetStats()
+}
@@ -0,0 +1,629 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/types"
+	"pixly/pkg/ffmpegrouter"
+	"pixly/pkg/processmonitor"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 🎬 视频转码模式 (AV1/HEVC + CRF) - 重包装之外真正减小视频体积的处理策略
+// =============================================================================
+
+// VideoTranscodeOptions 视频转码参数
+type VideoTranscodeOptions struct {
+	Codec          string  // "auto", "av1", "hevc" 或具体编码器名（libsvtav1, libaom-av1, libx265）
+	CRF            int     // 按 x264/x265 刻度（0-51）配置，AV1 编码器按比例映射到 0-63
+	Preset         string  // 为空时使用编码器默认预设
+	Audio          string  // "auto"（容器兼容则直通，否则AAC）, "copy", "aac", "opus"
+	MinSourceSize  int64   // 小于该体积的视频不转码
+	MinSavingRatio float64 // 体积减少比例低于该值时丢弃转码结果、保留原文件
+	MinBitsPerPix  float64 // 源视频码率已低于该值（bit/像素/帧）时不转码
+}
+
+// DefaultVideoTranscodeOptions 默认视频转码参数
+func DefaultVideoTranscodeOptions() VideoTranscodeOptions {
+	return VideoTranscodeOptions{
+		Codec:          "auto",
+		CRF:            28,
+		Audio:          "auto",
+		MinSourceSize:  10 * 1024 * 1024,
+		MinSavingRatio: 0.10,
+		MinBitsPerPix:  0.05,
+	}
+}
+
+// videoEncoderSpec 视频编码器描述，videoEncoderSpecs 的顺序即 "auto" 时的优先级
+type videoEncoderSpec struct {
+	Encoder       string // FFmpeg 编码器名
+	Family        string // "av1" / "hevc"
+	MaxCRF        int    // 编码器CRF上限
+	PresetFlag    string // 速度预设参数
+	DefaultPreset string
+}
+
+var videoEncoderSpecs = []videoEncoderSpec{
+	{Encoder: "libsvtav1", Family: "av1", MaxCRF: 63, PresetFlag: "-preset", DefaultPreset: "6"},
+	{Encoder: "libaom-av1", Family: "av1", MaxCRF: 63, PresetFlag: "-cpu-used", DefaultPreset: "4"},
+	{Encoder: "libx265", Family: "hevc", MaxCRF: 51, PresetFlag: "-preset", DefaultPreset: "medium"},
+}
+
+// efficientVideoCodecs 已是高效编码的源视频，再次有损转码收益小且损失画质
+var efficientVideoCodecs = map[string]bool{"av1": true, "hevc": true, "vp9": true}
+
+// mp4AudioCodecs 可直接复制进MP4容器的音频编码
+var mp4AudioCodecs = map[string]bool{
+	"aac": true, "mp3": true, "alac": true, "ac3": true, "eac3": true, "opus": true, "flac": true,
+}
+
+// VideoProbe ffprobe 探测结果
+type VideoProbe struct {
+	VideoCodec string
+	PixFmt     string
+	BitDepth   int
+	Width      int
+	Height     int
+	FrameRate  float64
+	BitRate    int64 // 视频流码率，缺失时使用容器总码率
+	Duration   float64
+	AudioCodec string // 无音轨时为空
+}
+
+// BitsPerPixel 每像素每帧的比特数，无法计算时返回0
+func (p *VideoProbe) BitsPerPixel() float64 {
+	if p.BitRate <= 0 || p.Width <= 0 || p.Height <= 0 || p.FrameRate <= 0 {
+		return 0
+	}
+	return float64(p.BitRate) / (float64(p.Width*p.Height) * p.FrameRate)
+}
+
+// VideoTranscodePlan 单个视频的转码方案
+type VideoTranscodePlan struct {
+	Encoder       string
+	Family        string
+	FFmpegPath    string
+	FFmpegVersion string // 路由器中的版本ID
+	CRF           int    // 实际传给编码器的CRF
+	Preset        string
+	TenBit        bool
+	AudioCodec    string // "copy", "aac", "libopus" 或空（无音轨）
+	Args          []string
+}
+
+// VideoTranscodeResult 视频转码结果
+type VideoTranscodeResult struct {
+	Plan         *VideoTranscodePlan
+	Probe        *VideoProbe
+	OriginalSize int64
+	NewSize      int64
+	Skipped      bool   // 命中跳过规则，未产生输出
+	SkipReason   string // 跳过原因
+	Duration     time.Duration
+}
+
+// VideoTranscodeMode 视频转码模式 - 编码器由 FFmpeg 路由器按实际编译的编码器选择
+type VideoTranscodeMode struct {
+	logger      *zap.Logger
+	router      *ffmpegrouter.FFmpegRouter
+	ffprobePath string
+	runner      CommandRunner
+	options     VideoTranscodeOptions
+}
+
+// NewVideoTranscodeMode 创建视频转码模式；ffprobePath 为空时从PATH中查找
+func NewVideoTranscodeMode(logger *zap.Logger, router *ffmpegrouter.FFmpegRouter, ffprobePath string, runner CommandRunner, options VideoTranscodeOptions) *VideoTranscodeMode {
+	if ffprobePath == "" {
+		ffprobePath = lookPathOrEmpty("ffprobe")
+	}
+	if options.Codec == "" {
+		options.Codec = "auto"
+	}
+	if options.Audio == "" {
+		options.Audio = "auto"
+	}
+	return &VideoTranscodeMode{
+		logger:      logger,
+		router:      router,
+		ffprobePath: ffprobePath,
+		runner:      runner,
+		options:     options,
+	}
+}
+
+// Options 当前转码参数
+func (m *VideoTranscodeMode) Options() VideoTranscodeOptions {
+	return m.options
+}
+
+func (m *VideoTranscodeMode) GetModeName() string {
+	return "视频转码模式"
+}
+
+func (m *VideoTranscodeMode) ProcessFile(ctx context.Context, info *types.MediaInfo) (*types.ProcessingResult, error) {
+	ext := filepath.Ext(info.Path)
+	targetPath := strings.TrimSuffix(info.Path, ext) + ".mp4"
+
+	// 源文件本身就是MP4时先写入临时文件，成功后覆盖原文件
+	inPlace := strings.EqualFold(ext, ".mp4")
+	outputPath := targetPath
+	if inPlace {
+		outputPath = strings.TrimSuffix(info.Path, ext) + ".pixly_transcode.mp4"
+	}
+
+	result, err := m.Transcode(ctx, info.Path, outputPath)
+	if err != nil {
+		return &types.ProcessingResult{
+			OriginalPath: info.Path,
+			OriginalSize: info.Size,
+			NewSize:      info.Size,
+			Success:      false,
+			Error:        err.Error(),
+			Mode:         types.ModeAutoPlus,
+		}, nil
+	}
+	if result.Skipped {
+		return &types.ProcessingResult{
+			OriginalPath: info.Path,
+			OriginalSize: result.OriginalSize,
+			NewSize:      result.OriginalSize,
+			Success:      false,
+			Error:        result.SkipReason,
+			ProcessTime:  result.Duration,
+			Mode:         types.ModeAutoPlus,
+		}, nil
+	}
+
+	if inPlace {
+		if err := os.Rename(outputPath, targetPath); err != nil {
+			os.Remove(outputPath)
+			return nil, fmt.Errorf("替换原视频失败: %w", err)
+		}
+	}
+
+	return &types.ProcessingResult{
+		OriginalPath: info.Path,
+		NewPath:      targetPath,
+		OriginalSize: result.OriginalSize,
+		NewSize:      result.NewSize,
+		SpaceSaved:   result.OriginalSize - result.NewSize,
+		Success:      true,
+		ProcessTime:  result.Duration,
+		Mode:         types.ModeAutoPlus,
+	}, nil
+}
+
+func (m *VideoTranscodeMode) GetStrategy(info *types.MediaInfo) (*ProcessingStrategy, error) {
+	if skip, reason := m.ShouldSkipFile(info); skip {
+		return &ProcessingStrategy{
+			Mode:         types.ModeAutoPlus,
+			TargetFormat: "skip",
+			Quality:      "skip",
+			Confidence:   1.0,
+			Reason:       reason,
+		}, nil
+	}
+
+	version, spec, err := m.selectEncoder(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProcessingStrategy{
+		Mode:         types.ModeAutoPlus,
+		TargetFormat: "mp4",
+		Quality:      fmt.Sprintf("crf_%d", scaleCRF(m.options.CRF, spec.MaxCRF)),
+		ToolChain:    []string{"ffmpeg", spec.Encoder},
+		Parameters: map[string]interface{}{
+			"encoder":        spec.Encoder,
+			"crf":            scaleCRF(m.options.CRF, spec.MaxCRF),
+			"preset":         m.presetFor(spec),
+			"ffmpeg_version": version.ID,
+		},
+		Confidence: 0.85,
+		Reason:     fmt.Sprintf("%s转码（%s）", strings.ToUpper(spec.Family), spec.Encoder),
+	}, nil
+}
+
+func (m *VideoTranscodeMode) ShouldSkipFile(info *types.MediaInfo) (bool, string) {
+	// 检查文件是否损坏
+	if info.IsCorrupted {
+		return true, "文件已损坏"
+	}
+
+	if info.Type != types.MediaTypeVideo {
+		return true, "视频转码模式只处理视频"
+	}
+
+	// 小文件转码收益有限
+	if m.options.MinSourceSize > 0 && info.Size < m.options.MinSourceSize {
+		return true, fmt.Sprintf("文件过小（<%dMB）", m.options.MinSourceSize/(1024*1024))
+	}
+
+	return false, ""
+}
+
+// Transcode 将 sourcePath 转码到 targetPath
+// 命中跳过规则时返回 Skipped=true 且不留下输出文件；转码失败返回错误
+func (m *VideoTranscodeMode) Transcode(ctx context.Context, sourcePath, targetPath string) (*VideoTranscodeResult, error) {
+	startTime := time.Now()
+
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("获取源视频信息失败: %w", err)
+	}
+	result := &VideoTranscodeResult{OriginalSize: sourceInfo.Size(), NewSize: sourceInfo.Size()}
+
+	skip := func(reason string) (*VideoTranscodeResult, error) {
+		result.Skipped = true
+		result.SkipReason = reason
+		result.Duration = time.Since(startTime)
+		m.logger.Info("跳过视频转码",
+			zap.String("file", filepath.Base(sourcePath)),
+			zap.String("reason", reason))
+		return result, nil
+	}
+
+	if m.options.MinSourceSize > 0 && sourceInfo.Size() < m.options.MinSourceSize {
+		return skip(fmt.Sprintf("文件过小（<%dMB）", m.options.MinSourceSize/(1024*1024)))
+	}
+
+	probe, err := m.Probe(ctx, sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	result.Probe = probe
+
+	if efficientVideoCodecs[probe.VideoCodec] {
+		return skip(fmt.Sprintf("已是高效编码（%s）", probe.VideoCodec))
+	}
+	if bpp := probe.BitsPerPixel(); bpp > 0 && bpp < m.options.MinBitsPerPix {
+		return skip(fmt.Sprintf("码率已很低（%.3f bit/像素）", bpp))
+	}
+
+	plan, version, err := m.Plan(ctx, probe, sourcePath, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	result.Plan = plan
+
+	m.logger.Info("开始视频转码",
+		zap.String("file", filepath.Base(sourcePath)),
+		zap.String("encoder", plan.Encoder),
+		zap.String("ffmpeg", plan.FFmpegVersion),
+		zap.Int("crf", plan.CRF),
+		zap.String("preset", plan.Preset),
+		zap.Bool("10bit", plan.TenBit),
+		zap.String("audio", plan.AudioCodec))
+
+	job := &EncodeJob{
+		SourcePath:   sourcePath,
+		TargetPath:   targetPath,
+		OutputFormat: "mp4",
+		MediaType:    types.MediaTypeVideo,
+		CRF:          plan.CRF,
+		VideoCodec:   plan.Encoder,
+		AudioCodec:   plan.AudioCodec,
+		Container:    "mp4",
+		Operation:    "video_transcode",
+		Complexity:   processmonitor.ComplexityHigh,
+		Metadata:     map[string]string{"encoder": plan.Encoder, "crf": strconv.Itoa(plan.CRF)},
+	}
+	encodeResult, err := runEncoderCommand(ctx, m.runner, "ffmpeg:"+plan.Encoder, plan.FFmpegPath, plan.Args, job)
+	if m.router != nil {
+		m.router.HandleCommandResult(version.ID, err == nil, err)
+	}
+	if err != nil {
+		os.Remove(targetPath)
+		return nil, fmt.Errorf("视频转码失败: %w", err)
+	}
+
+	result.NewSize = encodeResult.OutputSize
+	result.Duration = time.Since(startTime)
+
+	// 体积减少不足时丢弃转码结果
+	saving := 1 - float64(result.NewSize)/float64(result.OriginalSize)
+	if saving < m.options.MinSavingRatio {
+		os.Remove(targetPath)
+		result.NewSize = result.OriginalSize
+		return skip(fmt.Sprintf("体积减少不足（%.1f%% < %.0f%%）", saving*100, m.options.MinSavingRatio*100))
+	}
+
+	m.logger.Info("视频转码完成",
+		zap.String("file", filepath.Base(sourcePath)),
+		zap.String("encoder", plan.Encoder),
+		zap.Int64("original_size", result.OriginalSize),
+		zap.Int64("new_size", result.NewSize),
+		zap.Float64("saving", saving),
+		zap.Duration("duration", result.Duration))
+
+	return result, nil
+}
+
+// Plan 根据探测结果和可用编码器生成转码方案
+func (m *VideoTranscodeMode) Plan(ctx context.Context, probe *VideoProbe, sourcePath, targetPath string) (*VideoTranscodePlan, *ffmpegrouter.FFmpegVersion, error) {
+	version, spec, err := m.selectEncoder(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &VideoTranscodePlan{
+		Encoder:       spec.Encoder,
+		Family:        spec.Family,
+		FFmpegPath:    version.Path,
+		FFmpegVersion: version.ID,
+		CRF:           scaleCRF(m.options.CRF, spec.MaxCRF),
+		Preset:        m.presetFor(spec),
+		TenBit:        probe.BitDepth >= 10,
+		AudioCodec:    m.audioCodecFor(probe, version),
+	}
+
+	args := []string{"-hide_banner", "-nostdin", "-i", sourcePath,
+		"-map", "0:v:0", "-map", "0:a?", "-map_metadata", "0",
+		"-c:v", spec.Encoder, "-crf", strconv.Itoa(plan.CRF), spec.PresetFlag, plan.Preset}
+	switch spec.Encoder {
+	case "libaom-av1":
+		// libaom 需要 -b:v 0 才是纯CRF模式
+		args = append(args, "-b:v", "0", "-row-mt", "1")
+	case "libx265":
+		// hvc1 标签让 Apple 设备识别 HEVC
+		args = append(args, "-tag:v", "hvc1")
+	}
+
+	// 保留10-bit，避免HDR/高位深素材出现色带
+	if plan.TenBit {
+		args = append(args, "-pix_fmt", "yuv420p10le")
+	} else {
+		args = append(args, "-pix_fmt", "yuv420p")
+	}
+
+	switch plan.AudioCodec {
+	case "":
+	case "copy":
+		args = append(args, "-c:a", "copy")
+	case "libopus":
+		args = append(args, "-c:a", "libopus", "-b:a", "128k")
+	default:
+		args = append(args, "-c:a", "aac", "-b:a", "192k")
+	}
+
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", "-y", targetPath)
+	plan.Args = args
+
+	return plan, version, nil
+}
+
+// Probe 使用 ffprobe 读取视频流与音频流参数
+func (m *VideoTranscodeMode) Probe(ctx context.Context, path string) (*VideoProbe, error) {
+	if m.ffprobePath == "" {
+		return nil, fmt.Errorf("ffprobe不可用，无法分析视频")
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(probeCtx, m.ffprobePath,
+		"-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe分析失败: %w", err)
+	}
+
+	var raw struct {
+		Streams []struct {
+			CodecType        string `json:"codec_type"`
+			CodecName        string `json:"codec_name"`
+			PixFmt           string `json:"pix_fmt"`
+			Width            int    `json:"width"`
+			Height           int    `json:"height"`
+			BitRate          string `json:"bit_rate"`
+			BitsPerRawSample string `json:"bits_per_raw_sample"`
+			AvgFrameRate     string `json:"avg_frame_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("解析ffprobe输出失败: %w", err)
+	}
+
+	probe := &VideoProbe{}
+	probe.Duration, _ = strconv.ParseFloat(raw.Format.Duration, 64)
+
+	hasVideo := false
+	for _, stream := range raw.Streams {
+		switch stream.CodecType {
+		case "video":
+			if hasVideo {
+				continue
+			}
+			hasVideo = true
+			probe.VideoCodec = stream.CodecName
+			probe.PixFmt = stream.PixFmt
+			probe.Width, probe.Height = stream.Width, stream.Height
+			probe.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			probe.BitRate, _ = strconv.ParseInt(stream.BitRate, 10, 64)
+			probe.BitDepth, _ = strconv.Atoi(stream.BitsPerRawSample)
+			if probe.BitDepth == 0 {
+				probe.BitDepth = bitDepthFromPixFmt(stream.PixFmt)
+			}
+		case "audio":
+			if probe.AudioCodec == "" {
+				probe.AudioCodec = stream.CodecName
+			}
+		}
+	}
+	if !hasVideo {
+		return nil, fmt.Errorf("未找到视频流")
+	}
+	if probe.BitRate == 0 {
+		probe.BitRate, _ = strconv.ParseInt(raw.Format.BitRate, 10, 64)
+	}
+
+	return probe, nil
+}
+
+// selectEncoder 按偏好顺序通过路由器选择编译了对应编码器的 FFmpeg 版本
+func (m *VideoTranscodeMode) selectEncoder(ctx context.Context) (*ffmpegrouter.FFmpegVersion, videoEncoderSpec, error) {
+	if m.router == nil {
+		return nil, videoEncoderSpec{}, fmt.Errorf("FFmpeg路由器未初始化")
+	}
+
+	candidates := m.candidateEncoders()
+	if len(candidates) == 0 {
+		return nil, videoEncoderSpec{}, fmt.Errorf("不支持的视频编码器: %s", m.options.Codec)
+	}
+
+	for _, spec := range candidates {
+		version, err := m.router.GetBestVersion(ctx, "video_transcode", "", spec.Encoder)
+		if err != nil || !version.HasEncoder(spec.Encoder) {
+			m.logger.Debug("FFmpeg未编译该编码器，尝试下一个",
+				zap.String("encoder", spec.Encoder))
+			continue
+		}
+		return version, spec, nil
+	}
+
+	names := make([]string, len(candidates))
+	for i, spec := range candidates {
+		names[i] = spec.Encoder
+	}
+	return nil, videoEncoderSpec{}, fmt.Errorf("没有可用的视频编码器（需要 %s 之一）", strings.Join(names, ", "))
+}
+
+// candidateEncoders 根据 Codec 选项返回候选编码器
+func (m *VideoTranscodeMode) candidateEncoders() []videoEncoderSpec {
+	codec := strings.ToLower(m.options.Codec)
+
+	var candidates []videoEncoderSpec
+	for _, spec := range videoEncoderSpecs {
+		switch codec {
+		case "auto":
+			candidates = append(candidates, spec)
+		case "av1":
+			if spec.Family == "av1" {
+				candidates = append(candidates, spec)
+			}
+		case "hevc", "h265":
+			if spec.Family == "hevc" {
+				candidates = append(candidates, spec)
+			}
+		default:
+			if spec.Encoder == codec {
+				candidates = append(candidates, spec)
+			}
+		}
+	}
+	return candidates
+}
+
+// presetFor 用户预设优先，否则使用编码器默认预设
+func (m *VideoTranscodeMode) presetFor(spec videoEncoderSpec) string {
+	if m.options.Preset != "" {
+		return m.options.Preset
+	}
+	return spec.DefaultPreset
+}
+
+// audioCodecFor 决定音频处理方式：直通或重新编码
+func (m *VideoTranscodeMode) audioCodecFor(probe *VideoProbe, version *ffmpegrouter.FFmpegVersion) string {
+	if probe.AudioCodec == "" {
+		return ""
+	}
+
+	switch m.options.Audio {
+	case "copy":
+		return "copy"
+	case "aac":
+		return "aac"
+	case "opus":
+		if version.HasEncoder("libopus") {
+			return "libopus"
+		}
+		return "aac"
+	default:
+		if mp4AudioCodecs[probe.AudioCodec] {
+			return "copy"
+		}
+		return "aac"
+	}
+}
+
+// scaleCRF 将 x264/x265 刻度的CRF映射到编码器自身的范围
+func scaleCRF(crf, maxCRF int) int {
+	if maxCRF == 51 {
+		return crf
+	}
+	return int(math.Round(float64(crf) * float64(maxCRF) / 51))
+}
+
+// parseFrameRate 解析 "30000/1001" 形式的帧率
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// pixFmtDepthPattern 平面格式末尾的位深后缀（yuv420p10le、gbrp12be、gray10le）
+var pixFmtDepthPattern = regexp.MustCompile(`(?:p|gray)(9|10|12|14|16)(?:le|be)?$`)
+
+// semiPlanarDepthPattern 高位深半平面格式（p010le、p216le）
+var semiPlanarDepthPattern = regexp.MustCompile(`^p[0-4](10|12|16)(?:le|be)?$`)
+
+// bitDepthFromPixFmt 从像素格式推断位深（yuv420p10le → 10）
+// 只识别位深后缀，nv12、yuvj420p 等名称中的数字不是位深
+func bitDepthFromPixFmt(pixFmt string) int {
+	if pixFmt == "" {
+		return 0
+	}
+	for _, pattern := range []*regexp.Regexp{pixFmtDepthPattern, semiPlanarDepthPattern} {
+		if match := pattern.FindStringSubmatch(pixFmt); match != nil {
+			depth, _ := strconv.Atoi(match[1])
+			return depth
+		}
+	}
+	return 8
+}
+
+// VideoTranscodeOptionsFromConfig 从应用配置生成视频转码参数
+func VideoTranscodeOptionsFromConfig(cfg *config.Config) VideoTranscodeOptions {
+	options := DefaultVideoTranscodeOptions()
+	if cfg.VideoCodec != "" {
+		options.Codec = cfg.VideoCodec
+	}
+	if cfg.CRF > 0 {
+		options.CRF = cfg.CRF
+	}
+	options.Preset = cfg.VideoPreset
+	if cfg.VideoAudio != "" {
+		options.Audio = cfg.VideoAudio
+	}
+	options.MinSourceSize = int64(cfg.VideoMinSizeMB) * 1024 * 1024
+	options.MinSavingRatio = float64(cfg.VideoMinSavingPct) / 100
+	return options
+}
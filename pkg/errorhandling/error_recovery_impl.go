@@ -172,37 +172,38 @@ func (erm *ErrorRecoveryManager) initializeStatistics() {
 
 // analyzeError 分析错误类型和严重程度
 func (erm *ErrorRecoveryManager) analyzeError(err error) (ErrorType, ErrorSeverity) {
-	errorMessage := strings.ToLower(err.Error())
-
-	// 错误模式匹配
-	patterns := map[string]struct {
-		errorType ErrorType
-		severity  ErrorSeverity
-	}{
-		"corrupted":     {ErrorTypeFileCorrupted, SeverityHigh},
-		"invalid":       {ErrorTypeFormatUnsupported, SeverityMedium},
-		"unsupported":   {ErrorTypeFormatUnsupported, SeverityMedium},
-		"out of memory": {ErrorTypeMemoryExhausted, SeverityCritical},
-		"memory":        {ErrorTypeMemoryExhausted, SeverityHigh},
-		"timeout":       {ErrorTypeProcessTimeout, SeverityMedium},
-		"deadline":      {ErrorTypeProcessTimeout, SeverityMedium},
-		"permission":    {ErrorTypePermissionDenied, SeverityHigh},
-		"access denied": {ErrorTypePermissionDenied, SeverityHigh},
-		"network":       {ErrorTypeNetworkFailure, SeverityMedium},
-		"connection":    {ErrorTypeNetworkFailure, SeverityMedium},
-		"ffmpeg":        {ErrorTypeFFmpegCrash, SeverityHigh},
-		"metadata":      {ErrorTypeMetadataCorrupted, SeverityLow},
-		"quality":       {ErrorTypeQualityTooLow, SeverityLow},
-		"too large":     {ErrorTypeFileTooLarge, SeverityMedium},
-		"file size":     {ErrorTypeFileTooLarge, SeverityMedium},
-	}
-
-	for pattern, info := range patterns {
-		if strings.Contains(errorMessage, pattern) {
-			return info.errorType, info.severity
+	return ClassifyError(err.Error())
+}
+
+// errorPatterns 错误信息匹配规则，按顺序匹配（"out of memory" 先于 "memory"）
+var errorPatterns = []struct {
+	patterns  []string
+	errorType ErrorType
+	severity  ErrorSeverity
+}{
+	{[]string{"out of memory", "内存不足"}, ErrorTypeMemoryExhausted, SeverityCritical},
+	{[]string{"corrupted", "损坏"}, ErrorTypeFileCorrupted, SeverityHigh},
+	{[]string{"invalid", "unsupported", "不支持", "无效"}, ErrorTypeFormatUnsupported, SeverityMedium},
+	{[]string{"memory", "内存"}, ErrorTypeMemoryExhausted, SeverityHigh},
+	{[]string{"timeout", "deadline", "超时"}, ErrorTypeProcessTimeout, SeverityMedium},
+	{[]string{"permission", "access denied", "权限"}, ErrorTypePermissionDenied, SeverityHigh},
+	{[]string{"network", "connection", "网络", "连接"}, ErrorTypeNetworkFailure, SeverityMedium},
+	{[]string{"ffmpeg"}, ErrorTypeFFmpegCrash, SeverityHigh},
+	{[]string{"metadata", "元数据"}, ErrorTypeMetadataCorrupted, SeverityLow},
+	{[]string{"quality", "品质"}, ErrorTypeQualityTooLow, SeverityLow},
+	{[]string{"too large", "file size", "过大"}, ErrorTypeFileTooLarge, SeverityMedium},
+}
+
+// ClassifyError 根据错误信息（英文或中文）判断错误类型和严重程度，未匹配时为未知错误
+func ClassifyError(message string) (ErrorType, ErrorSeverity) {
+	message = strings.ToLower(message)
+	for _, rule := range errorPatterns {
+		for _, pattern := range rule.patterns {
+			if strings.Contains(message, pattern) {
+				return rule.errorType, rule.severity
+			}
 		}
 	}
-
 	return ErrorTypeUnknown, SeverityMedium
 }
 
@@ -361,21 +361,28 @@ func (router *FFmpegRouter) getSupportedFormats(path string) map[string]bool {
 		return formats
 	}
 
-	// 解析编码器支持
+	// 解析编码器支持：每行为 "<6位能力标志> <编码器名> <描述>"，
+	// 标志首位 V/A 分别表示视频/音频编码器（如 "V....D libsvtav1"）
 	lines := strings.Split(string(output), "\n")
 	for _, line := range lines {
-		if strings.Contains(line, "V.....") { // 视频编码器
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				codec := parts[1]
-				formats[codec] = true
-			}
+		parts := strings.Fields(line)
+		// 跳过图例（" V..... = Video"）与分隔行
+		if len(parts) < 2 || len(parts[0]) != 6 || parts[1] == "=" || parts[0] == "------" {
+			continue
+		}
+		if parts[0][0] == 'V' || parts[0][0] == 'A' {
+			formats[parts[1]] = true
 		}
 	}
 
 	return formats
 }
 
+// HasEncoder 该版本是否编译了指定的编码器（如 libsvtav1、libx265、libopus）
+func (v *FFmpegVersion) HasEncoder(name string) bool {
+	return v.SupportedFormats[name]
+}
+
 func (router *FFmpegRouter) selectDefaultVersions() {
 	// README要求：优先选择系统版本作为默认版本
 	for id, version := range router.versions {
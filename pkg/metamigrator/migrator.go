@@ -326,22 +326,35 @@ func (mm *MetadataMigrator) MigrateMetadata(ctx context.Context, sourcePath, tar
 
 // extractMetadata 提取文件元数据
 func (mm *MetadataMigrator) extractMetadata(ctx context.Context, filePath string) (map[string]interface{}, error) {
+	// 提取所有元数据，包含二进制数据
+	return mm.runExtraction(ctx, filePath, "-all", "-binary")
+}
+
+// ExtractFields 只提取指定字段（如 "DateTimeOriginal"、"QuickTime:CreateDate"），
+// 日期和GPS坐标的格式与完整迁移时一致；不存在的字段不出现在结果中
+func (mm *MetadataMigrator) ExtractFields(ctx context.Context, filePath string, fields ...string) (map[string]interface{}, error) {
+	args := make([]string, 0, len(fields))
+	for _, field := range fields {
+		args = append(args, "-"+field)
+	}
+	return mm.runExtraction(ctx, filePath, args...)
+}
+
+// runExtraction 以JSON格式运行exiftool提取元数据
+func (mm *MetadataMigrator) runExtraction(ctx context.Context, filePath string, selectors ...string) (map[string]interface{}, error) {
 	if mm.exiftoolPath == "" {
 		return nil, fmt.Errorf("exiftool路径未设置")
 	}
 
-	// 使用exiftool提取所有元数据
 	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	args := []string{
-		"-json",
-		"-all",                 // 提取所有元数据
-		"-binary",              // 包含二进制数据
+	args := append([]string{"-json"}, selectors...)
+	args = append(args,
 		"-coordFormat", "%.6f", // GPS坐标格式
 		"-dateFormat", "%Y:%m:%d %H:%M:%S", // 日期格式标准化
 		filePath,
-	}
+	)
 
 	cmd := exec.CommandContext(timeoutCtx, mm.exiftoolPath, args...)
 	output, err := cmd.Output()
@@ -0,0 +1,377 @@
+// Package metrics 运行指标，以 Prometheus 文本格式（0.0.4）导出
+//
+// 指标在包级别定义（见 pixly.go），各模块直接累加；通过 Handler 暴露为 /metrics，
+// 由 pixly serve、分布式协调节点以及配置了 metrics_listen 的转换、监视和工作节点进程提供。
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 指标类型
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry 指标注册表
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default 默认注册表，pixly.go 中的指标均注册在这里
+var Default = NewRegistry()
+
+// family 同名指标及其按标签值区分的序列
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64      // 仅直方图
+	collect func() float64 // 读取时计算的 gauge
+
+	mu     sync.RWMutex
+	series map[string]*series // 按标签值拼接的键
+}
+
+// series 单个时间序列
+type series struct {
+	labelValues []string
+	value       atomicFloat
+	counts      []atomic.Uint64 // 直方图：各桶（不累积）计数，最后一个为 +Inf
+	sum         atomicFloat
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name]; exists {
+		panic("metrics: 重复注册指标 " + f.name)
+	}
+	f.series = make(map[string]*series)
+	r.families[f.name] = f
+	return f
+}
+
+// with 返回标签值对应的序列，不存在时创建
+func (f *family) with(values ...string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签值，实际 %d 个", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; !ok {
+		s = &series{labelValues: append([]string(nil), values...)}
+		if f.kind == typeHistogram {
+			s.counts = make([]atomic.Uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter 只增计数器
+type Counter struct{ s *series }
+
+// Inc 加一
+func (c Counter) Inc() { c.s.value.add(1) }
+
+// Add 增加 v，负数被忽略
+func (c Counter) Add(v float64) {
+	if v > 0 {
+		c.s.value.add(v)
+	}
+}
+
+// NewCounter 在默认注册表中创建没有标签的计数器
+func NewCounter(name, help string) Counter {
+	return Default.NewCounterVec(name, help).WithLabelValues()
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct{ f *family }
+
+// NewCounterVec 在默认注册表中创建计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec 创建计数器，没有标签时用 WithLabelValues() 取唯一序列
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, kind: typeCounter, labels: labels})}
+}
+
+// WithLabelValues 按标签值取计数器
+func (v *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{v.f.with(values...)}
+}
+
+// Gauge 可增可减的数值
+type Gauge struct{ s *series }
+
+// Set 设置数值
+func (g Gauge) Set(v float64) { g.s.value.store(v) }
+
+// Add 增加 v（可为负数）
+func (g Gauge) Add(v float64) { g.s.value.add(v) }
+
+// Inc 加一
+func (g Gauge) Inc() { g.s.value.add(1) }
+
+// Dec 减一
+func (g Gauge) Dec() { g.s.value.add(-1) }
+
+// NewGauge 在默认注册表中创建没有标签的 gauge
+func NewGauge(name, help string) Gauge {
+	return Default.NewGaugeVec(name, help).WithLabelValues()
+}
+
+// GaugeVec 带标签的 gauge
+type GaugeVec struct{ f *family }
+
+// NewGaugeVec 在默认注册表中创建 gauge
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec 创建 gauge
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, kind: typeGauge, labels: labels})}
+}
+
+// WithLabelValues 按标签值取 gauge
+func (v *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return Gauge{v.f.with(values...)}
+}
+
+// NewGaugeFunc 在默认注册表中创建读取时计算的 gauge
+func NewGaugeFunc(name, help string, collect func() float64) {
+	Default.NewGaugeFunc(name, help, collect)
+}
+
+// NewGaugeFunc 创建读取时计算的 gauge
+func (r *Registry) NewGaugeFunc(name, help string, collect func() float64) {
+	r.register(&family{name: name, help: help, kind: typeGauge, collect: collect})
+}
+
+// Histogram 直方图
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Observe 记录一次观测值
+func (h Histogram) Observe(v float64) {
+	index := sort.SearchFloat64s(h.buckets, v) // 第一个 >= v 的桶
+	h.s.counts[index].Add(1)
+	h.s.sum.add(v)
+}
+
+// ObserveDuration 以秒记录时长
+func (h Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct{ f *family }
+
+// NewHistogramVec 在默认注册表中创建直方图
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec 创建直方图，buckets 为递增的桶上界（不含 +Inf）
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: 直方图桶上界必须递增 " + name)
+	}
+	return &HistogramVec{r.register(&family{name: name, help: help, kind: typeHistogram, labels: labels, buckets: buckets})}
+}
+
+// WithLabelValues 按标签值取直方图
+func (v *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{s: v.f.with(values...), buckets: v.f.buckets}
+}
+
+// WriteText 按名称顺序以 Prometheus 文本格式写出全部指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(out)
+	}
+	return out.Flush()
+}
+
+func (f *family) write(out *bufio.Writer) {
+	fmt.Fprintf(out, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+	if f.collect != nil {
+		fmt.Fprintf(out, "%s %s\n", f.name, formatValue(f.collect()))
+		return
+	}
+
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+	// 没有标签的指标即使未被使用也输出 0，便于图表从一开始就有数据
+	if len(all) == 0 && len(f.labels) == 0 && f.kind != typeHistogram {
+		all = append(all, &series{})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+
+	for _, s := range all {
+		labels := formatLabels(f.labels, s.labelValues)
+		if f.kind != typeHistogram {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, labels, formatValue(s.value.load()))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i].Load()
+			fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, withLe(labels, formatValue(bound)), cumulative)
+		}
+		cumulative += s.counts[len(f.buckets)].Load()
+		fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, withLe(labels, "+Inf"), cumulative)
+		fmt.Fprintf(out, "%s_sum%s %s\n", f.name, labels, formatValue(s.sum.load()))
+		fmt.Fprintf(out, "%s_count%s %d\n", f.name, labels, cumulative)
+	}
+}
+
+// Handler 返回输出默认注册表的 HTTP 处理器
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Handler 返回输出注册表的 HTTP 处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// Serve 在 addr 上单独提供 /metrics，直到 ctx 取消
+func Serve(ctx context.Context, logger *zap.Logger, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("指标接口已启动", zap.String("address", "http://"+addr+"/metrics"))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("指标接口启动失败: %w", err)
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLe 在标签集合中追加 le 标签
+func withLe(labels, le string) string {
+	if labels == "" {
+		return `{le="` + le + `"}`
+	}
+	return labels[:len(labels)-1] + `,le="` + le + `"}`
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// atomicFloat 原子浮点数
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+func (f *atomicFloat) store(v float64) { f.bits.Store(math.Float64bits(v)) }
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import "runtime"
+
+// 编码耗时直方图的桶上界（秒）：覆盖小图片到长视频
+var encoderDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// 转换结果
+var (
+	// FilesProcessed 按结果状态（success, failed, skipped, kept, corrupted）和源格式统计的文件数
+	FilesProcessed = NewCounterVec("pixly_files_processed_total",
+		"转换引擎处理完成的文件数，按结果状态和源格式区分", "status", "format")
+
+	// InputBytes 成功转换的源文件总大小
+	InputBytes = NewCounter("pixly_input_bytes_total",
+		"成功转换的源文件总字节数")
+
+	// OutputBytes 成功转换的输出文件总大小
+	OutputBytes = NewCounter("pixly_output_bytes_total",
+		"成功转换的输出文件总字节数")
+
+	// BytesSaved 输出比源文件小的部分之和
+	BytesSaved = NewCounter("pixly_bytes_saved_total",
+		"输出小于源文件时节省的字节数")
+
+	// Retries 转换失败后的重试次数
+	Retries = NewCounter("pixly_conversion_retries_total",
+		"转换失败后的重试次数")
+
+	// ActiveWorkers 正在转换的工作协程数
+	ActiveWorkers = NewGauge("pixly_active_workers",
+		"正在转换的工作协程数")
+)
+
+// 编码器
+var (
+	// EncoderDuration 按编码器统计的单次编码耗时（秒）
+	EncoderDuration = NewHistogramVec("pixly_encoder_duration_seconds",
+		"单次编码器调用耗时（秒），按编码器和结果区分", encoderDurationBuckets, "encoder", "status")
+
+	// EncoderFallbacks 编码器失败后改用后备编码器的次数
+	EncoderFallbacks = NewCounterVec("pixly_encoder_fallbacks_total",
+		"编码器失败后改用后备链中下一个编码器的次数", "from", "to")
+)
+
+// 进程与资源
+var (
+	// HungProcesses 检测到的卡死外部进程数
+	HungProcesses = NewCounter("pixly_hung_processes_total",
+		"检测到的卡死外部进程数（活动超时内没有任何活动）")
+
+	// ProcessKills 被强制终止的外部进程数，reason 为 hung 或 timeout
+	ProcessKills = NewCounterVec("pixly_process_kills_total",
+		"进程监控器强制终止的外部进程数", "reason")
+
+	// MemoryPressureEvents 内存使用超过阈值的次数
+	MemoryPressureEvents = NewCounter("pixly_memory_pressure_events_total",
+		"内存使用超过阈值的次数")
+)
+
+// 分布式转换（协调节点）
+var (
+	// LeasesGranted 租给工作节点的单元数
+	LeasesGranted = NewCounter("pixly_leases_granted_total",
+		"协调节点租给工作节点的转换单元数")
+
+	// LeaseReassignments 租约过期后重新分配的次数
+	LeaseReassignments = NewCounter("pixly_lease_reassignments_total",
+		"工作节点未在租约时间内续约、单元重新排队的次数")
+
+	// ActiveLeases 当前租出的单元数
+	ActiveLeases = NewGauge("pixly_active_leases",
+		"协调节点当前租出的转换单元数")
+)
+
+func init() {
+	NewGaugeFunc("go_goroutines", "当前存在的协程数", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "堆上已分配且仍在使用的字节数", func() float64 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return float64(stats.HeapAlloc)
+	})
+}
@@ -12,6 +12,8 @@ import (
 	"time"
 	"bufio"
 
+	"pixly/pkg/metrics"
+
 	"go.uber.org/zap"
 	"github.com/shirou/gopsutil/v3/process"
 )
@@ -425,6 +427,7 @@ func (pm *ProcessMonitor) checkProcessActivity(process *MonitoredProcess) bool {
 
 // handleHungProcess 处理卡死进程 - README要求的用户交互
 func (pm *ProcessMonitor) handleHungProcess(process *MonitoredProcess) {
+	metrics.HungProcesses.Inc()
 	pm.logger.Warn("进程疑似卡死，根据策略处理",
 		zap.String("process_id", process.ID),
 		zap.String("operation", process.Context.Operation),
@@ -525,6 +528,11 @@ func (pm *ProcessMonitor) terminateProcess(process *MonitoredProcess, force bool
 				zap.String("process_id", process.ID),
 				zap.Error(err))
 		} else {
+			reason := "timeout"
+			if process.Status == StatusHung {
+				reason = "hung"
+			}
+			metrics.ProcessKills.WithLabelValues(reason).Inc()
 			pm.logger.Info("进程已强制终止", zap.String("process_id", process.ID))
 		}
 	}
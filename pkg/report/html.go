@@ -0,0 +1,238 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ResolvePath 解析报告输出路径：已存在的目录或以分隔符结尾的路径中生成带时间戳的文件名
+func ResolvePath(path string, now time.Time) string {
+	name := "pixly-report-" + now.Format("20060102-150405") + ".html"
+	if strings.HasSuffix(path, string(filepath.Separator)) || strings.HasSuffix(path, "/") {
+		return filepath.Join(path, name)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, name)
+	}
+	return path
+}
+
+// Write 渲染报告并写入文件，先写临时文件再重命名，避免留下不完整的报告
+func Write(path string, report *Report) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建报告目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pixly-report-*.html")
+	if err != nil {
+		return fmt.Errorf("创建报告文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := Render(tmp, report); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	return nil
+}
+
+// Render 将报告渲染为单文件 HTML
+func Render(w io.Writer, report *Report) error {
+	if err := reportTemplate.Execute(w, report); err != nil {
+		return fmt.Errorf("渲染报告失败: %w", err)
+	}
+	return nil
+}
+
+// errorClassNames 错误类别的通俗说明
+var errorClassNames = map[string]string{
+	"file_corrupted":     "文件已损坏",
+	"format_unsupported": "格式不受支持",
+	"memory_exhausted":   "内存不足",
+	"process_timeout":    "处理超时",
+	"permission_denied":  "没有访问权限",
+	"network_failure":    "网络错误",
+	"ffmpeg_crash":       "转换工具出错",
+	"metadata_corrupted": "元数据损坏",
+	"quality_too_low":    "品质过低",
+	"file_too_large":     "文件过大",
+	"unknown":            "其他错误",
+}
+
+// validationKindNames 校验类别的通俗说明
+var validationKindNames = map[string]string{
+	"jpeg_reconstruction": "JPEG 无损重建校验",
+	"live_photo_pairing":  "Live Photo 成对转换",
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"pct":   func(value float64) string { return fmt.Sprintf("%.1f%%", value) },
+	"ratio": func(original, current int64) string {
+		if original == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", float64(current)/float64(original)*100)
+	},
+	"width": func(value float64) template.CSS {
+		return template.CSS(fmt.Sprintf("width: %.1f%%", value))
+	},
+	"dataURI":    func(uri string) template.URL { return template.URL(uri) },
+	"base":       filepath.Base,
+	"errorClass": func(class string) string { return displayName(errorClassNames, class) },
+	"kind":       func(kind string) string { return displayName(validationKindNames, kind) },
+	"time":       func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"duration": func(start, end time.Time) string {
+		if start.IsZero() || end.IsZero() {
+			return "-"
+		}
+		return end.Sub(start).Round(time.Second).String()
+	},
+}).Parse(reportHTML))
+
+// displayName 返回内部名称对应的通俗说明，没有说明时原样返回
+func displayName(names map[string]string, key string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
+	return key
+}
+
+// formatBytes 以 1024 为进制格式化字节数，负数表示体积增加
+func formatBytes(size int64) string {
+	sign := ""
+	if size < 0 {
+		sign = "-"
+		size = -size
+	}
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%s%d B", sign, size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%s%.1f %cB", sign, float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+const reportHTML = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Pixly 运行报告</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 0; background: #f5f6f8; color: #222; }
+main { max-width: 1100px; margin: 0 auto; padding: 24px; }
+h1 { margin: 0 0 4px; }
+h2 { margin-top: 32px; border-bottom: 2px solid #e1e4e8; padding-bottom: 6px; }
+.muted { color: #666; font-size: 14px; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; margin-top: 16px; }
+.card { background: #fff; border-radius: 8px; padding: 14px 18px; min-width: 150px; box-shadow: 0 1px 3px rgba(0,0,0,.08); }
+.card .value { font-size: 24px; font-weight: 600; }
+.card .label { color: #666; font-size: 13px; }
+.good { color: #1a7f37; }
+.bad { color: #cf222e; }
+table { width: 100%; border-collapse: collapse; background: #fff; border-radius: 8px; overflow: hidden; box-shadow: 0 1px 3px rgba(0,0,0,.08); font-size: 14px; }
+th, td { padding: 8px 10px; text-align: left; border-bottom: 1px solid #eee; vertical-align: top; }
+th { background: #fafbfc; font-weight: 600; }
+td.num, th.num { text-align: right; white-space: nowrap; }
+td.path { word-break: break-all; }
+.bar { background: #e8eaed; border-radius: 4px; height: 14px; min-width: 120px; }
+.bar > div { background: #2f81f7; height: 100%; border-radius: 4px; }
+.bar.loss > div { background: #cf222e; }
+.thumbs { display: flex; flex-wrap: wrap; gap: 12px; }
+.thumb { background: #fff; border-radius: 8px; padding: 10px; box-shadow: 0 1px 3px rgba(0,0,0,.08); }
+.thumb .pair { display: flex; gap: 6px; }
+.thumb figure { margin: 0; text-align: center; font-size: 12px; color: #666; }
+.thumb img { display: block; max-width: 160px; border-radius: 4px; }
+.thumb .name { font-size: 12px; margin-top: 6px; max-width: 330px; word-break: break-all; }
+.empty { color: #666; font-style: italic; }
+</style>
+</head>
+<body>
+<main>
+<h1>Pixly 运行报告</h1>
+<div class="muted">
+{{with .Session}}目录：{{.TargetDir}} · 模式：{{.Mode}} · 开始：{{time .StartedAt}} · 用时：{{duration .StartedAt .FinishedAt}}{{end}}
+</div>
+
+<div class="cards">
+  <div class="card"><div class="value">{{.Totals.Files}}</div><div class="label">处理的文件</div></div>
+  <div class="card"><div class="value good">{{.Totals.Success}}</div><div class="label">成功转换</div></div>
+  <div class="card"><div class="value">{{.Totals.Skipped}}</div><div class="label">跳过</div></div>
+  <div class="card"><div class="value">{{.Totals.Kept}}</div><div class="label">保留原文件</div></div>
+  <div class="card"><div class="value{{if .Totals.Failed}} bad{{end}}">{{.Totals.Failed}}</div><div class="label">失败</div></div>
+  <div class="card"><div class="value">{{bytes .Totals.OriginalSize}} → {{bytes .Totals.NewSize}}</div><div class="label">转换前后的总大小</div></div>
+  <div class="card"><div class="value {{if lt .Totals.Saved 0}}bad{{else}}good{{end}}">{{bytes .Totals.Saved}}（{{pct .Totals.SavedPercent}}）</div><div class="label">节省的空间</div></div>
+</div>
+
+<h2>按格式</h2>
+{{template "groups" .ByFormat}}
+
+<h2>按目录</h2>
+{{template "groups" .ByDirectory}}
+
+<h2>压缩比分布</h2>
+<p class="muted">转换后的大小占原文件的比例，越小越省空间。</p>
+<table>
+<tr><th>新文件 / 原文件</th><th class="num">文件数</th><th></th></tr>
+{{range .Histogram}}<tr><td>{{.Label}}</td><td class="num">{{.Count}}</td><td><div class="bar{{if .Larger}} loss{{end}}"><div style="{{width .Percent}}"></div></div></td></tr>
+{{end}}</table>
+
+<h2>节省最多的文件</h2>
+{{template "changes" .Wins}}
+
+<h2>体积变大的文件</h2>
+{{template "changes" .Losses}}
+
+<h2>失败的文件</h2>
+{{if .Failures}}<table>
+<tr><th>文件</th><th>原因类别</th><th>详细信息</th></tr>
+{{range .Failures}}<tr><td class="path">{{.Source}}</td><td>{{errorClass .ErrorClass}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">没有失败的文件。</p>{{end}}
+
+<h2>校验未通过</h2>
+<p class="muted">转换后经校验与原文件不一致、已自动回退的文件，原文件保持不变。</p>
+{{if .Validation}}<table>
+<tr><th>文件</th><th>校验</th><th>原因</th></tr>
+{{range .Validation}}<tr><td class="path">{{.Source}}</td><td>{{kind .Kind}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">所有校验均已通过。</p>{{end}}
+
+<h2>转换前后对比</h2>
+{{if .Thumbnails}}<div class="thumbs">
+{{range .Thumbnails}}<div class="thumb">
+  <div class="pair">
+    <figure><img src="{{dataURI .Before}}" alt="转换前"><figcaption>转换前 · {{bytes .OriginalSize}}</figcaption></figure>
+    <figure><img src="{{dataURI .After}}" alt="转换后"><figcaption>转换后 · {{bytes .NewSize}}</figcaption></figure>
+  </div>
+  <div class="name">{{base .Source}} → {{base .Target}}</div>
+</div>
+{{end}}</div>{{else}}<p class="empty">没有抽样的缩略图。</p>{{end}}
+</main>
+</body>
+</html>
+{{define "groups"}}{{if .}}<table>
+<tr><th></th><th class="num">文件数</th><th class="num">成功</th><th class="num">失败</th><th class="num">转换前</th><th class="num">转换后</th><th class="num">节省</th><th class="num">节省比例</th></tr>
+{{range .}}<tr><td class="path">{{.Key}}</td><td class="num">{{.Files}}</td><td class="num">{{.Success}}</td><td class="num">{{.Failed}}</td><td class="num">{{bytes .OriginalSize}}</td><td class="num">{{bytes .NewSize}}</td><td class="num {{if lt .Saved 0}}bad{{else}}good{{end}}">{{bytes .Saved}}</td><td class="num">{{pct .SavedPercent}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">没有数据。</p>{{end}}{{end}}
+{{define "changes"}}{{if .}}<table>
+<tr><th>文件</th><th class="num">转换前</th><th class="num">转换后</th><th class="num">变化</th><th class="num">新 / 原</th></tr>
+{{range .}}<tr><td class="path">{{.Source}}{{if .Target}} → {{base .Target}}{{end}}</td><td class="num">{{bytes .OriginalSize}}</td><td class="num">{{bytes .NewSize}}</td><td class="num {{if lt .Delta 0}}bad{{else}}good{{end}}">{{bytes .Delta}}</td><td class="num">{{ratio .OriginalSize .NewSize}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">没有这样的文件。</p>{{end}}{{end}}
+`
@@ -0,0 +1,302 @@
+// Package report 生成单文件 HTML 运行报告：总量与节省空间（按格式和目录）、压缩比分布、
+// 节省最多和体积增加最多的文件、失败文件及错误类别、校验失败，以及抽样的前后对比缩略图。
+//
+// 报告不引用任何外部资源，缩略图以 data URI 内嵌，可以直接发给其他人打开。
+package report
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pixly/pkg/errorhandling"
+)
+
+// FileResult 单个文件的处理结果
+type FileResult struct {
+	Source       string
+	Target       string
+	Status       string // success, failed, skipped, kept
+	Message      string
+	OriginalSize int64
+	NewSize      int64
+	Duration     time.Duration
+}
+
+// ValidationFailure 校验层未通过的文件，如 JPEG 重建校验不一致
+type ValidationFailure struct {
+	Source string
+	Output string
+	Kind   string
+	Reason string
+}
+
+// Session 一次运行的输入数据
+type Session struct {
+	TargetDir          string
+	Mode               string
+	StartedAt          time.Time
+	FinishedAt         time.Time
+	Results            []FileResult
+	ValidationFailures []ValidationFailure
+	Thumbnails         []Thumbnail // 由 Sampler 采集
+}
+
+// Totals 总量统计
+type Totals struct {
+	Files        int
+	Success      int
+	Failed       int
+	Skipped      int
+	Kept         int
+	OriginalSize int64 // 成功转换的文件
+	NewSize      int64
+}
+
+// Saved 节省的字节数，体积增加时为负
+func (t Totals) Saved() int64 { return t.OriginalSize - t.NewSize }
+
+// SavedPercent 节省比例（%）
+func (t Totals) SavedPercent() float64 {
+	if t.OriginalSize == 0 {
+		return 0
+	}
+	return float64(t.Saved()) / float64(t.OriginalSize) * 100
+}
+
+// Group 按格式或目录分组的统计
+type Group struct {
+	Key string
+	Totals
+}
+
+// HistogramBucket 压缩比（输出/源文件）分布的一个区间
+type HistogramBucket struct {
+	Label   string
+	Count   int
+	Percent float64 // 占成功文件的比例，用于绘制条形
+	Larger  bool    // 输出比源文件大
+}
+
+// Change 单个文件的体积变化
+type Change struct {
+	Source       string
+	Target       string
+	OriginalSize int64
+	NewSize      int64
+}
+
+// Delta 节省的字节数，体积增加时为负
+func (c Change) Delta() int64 { return c.OriginalSize - c.NewSize }
+
+// Failure 失败的文件及错误类别
+type Failure struct {
+	Source     string
+	ErrorClass string
+	Message    string
+}
+
+// Report 报告内容
+type Report struct {
+	Session     *Session
+	Totals      Totals
+	ByFormat    []Group
+	ByDirectory []Group
+	Histogram   []HistogramBucket
+	Wins        []Change // 节省最多
+	Losses      []Change // 体积增加最多
+	Failures    []Failure
+	Validation  []ValidationFailure
+	Thumbnails  []Thumbnail
+}
+
+// DefaultTopN 节省最多/体积增加最多的文件列表长度
+const DefaultTopN = 10
+
+// histogramEdges 压缩比区间上界，最后一个区间为“体积增加”
+var histogramEdges = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0}
+
+// Build 汇总运行结果；topN 不大于 0 时使用 DefaultTopN
+func Build(session *Session, topN int) *Report {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+	report := &Report{
+		Session:    session,
+		Validation: session.ValidationFailures,
+		Thumbnails: session.Thumbnails,
+	}
+
+	byFormat := make(map[string]*Group)
+	byDirectory := make(map[string]*Group)
+	histogram := make([]int, len(histogramEdges)+1)
+	var changes []Change
+
+	for _, result := range session.Results {
+		report.Totals.add(result)
+		group(byFormat, formatKey(result)).add(result)
+		group(byDirectory, directoryKey(session.TargetDir, result.Source)).add(result)
+
+		switch result.Status {
+		case "success":
+			if result.OriginalSize > 0 {
+				histogram[histogramIndex(float64(result.NewSize)/float64(result.OriginalSize))]++
+			}
+			changes = append(changes, Change{
+				Source:       result.Source,
+				Target:       result.Target,
+				OriginalSize: result.OriginalSize,
+				NewSize:      result.NewSize,
+			})
+		case "failed":
+			errorType, _ := errorhandling.ClassifyError(result.Message)
+			report.Failures = append(report.Failures, Failure{
+				Source:     result.Source,
+				ErrorClass: errorType.String(),
+				Message:    result.Message,
+			})
+		}
+	}
+
+	report.ByFormat = sortedGroups(byFormat)
+	report.ByDirectory = sortedGroups(byDirectory)
+	report.Histogram = histogramBuckets(histogram, report.Totals.Success)
+	report.Wins, report.Losses = topChanges(changes, topN)
+	sort.Slice(report.Failures, func(i, j int) bool {
+		if report.Failures[i].ErrorClass != report.Failures[j].ErrorClass {
+			return report.Failures[i].ErrorClass < report.Failures[j].ErrorClass
+		}
+		return report.Failures[i].Source < report.Failures[j].Source
+	})
+	return report
+}
+
+func (t *Totals) add(result FileResult) {
+	t.Files++
+	switch result.Status {
+	case "success":
+		t.Success++
+		t.OriginalSize += result.OriginalSize
+		t.NewSize += result.NewSize
+	case "failed":
+		t.Failed++
+	case "skipped":
+		t.Skipped++
+	case "kept":
+		t.Kept++
+	}
+}
+
+func group(groups map[string]*Group, key string) *Group {
+	g, ok := groups[key]
+	if !ok {
+		g = &Group{Key: key}
+		groups[key] = g
+	}
+	return g
+}
+
+// formatKey 源格式 → 目标格式，未生成输出时只有源格式
+func formatKey(result FileResult) string {
+	source := extName(result.Source)
+	if result.Status != "success" || result.Target == "" {
+		return source
+	}
+	if target := extName(result.Target); target != source {
+		return source + " → " + target
+	}
+	return source
+}
+
+func extName(path string) string {
+	if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."); ext != "" {
+		return ext
+	}
+	return "unknown"
+}
+
+// directoryKey 相对于目标目录的目录名
+func directoryKey(root, path string) string {
+	dir := filepath.Dir(path)
+	if root != "" {
+		if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return dir
+}
+
+// sortedGroups 按节省字节数降序，其次按名称
+func sortedGroups(groups map[string]*Group) []Group {
+	sorted := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, *g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Saved() != sorted[j].Saved() {
+			return sorted[i].Saved() > sorted[j].Saved()
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+func histogramIndex(ratio float64) int {
+	for i, edge := range histogramEdges {
+		if ratio < edge {
+			return i
+		}
+	}
+	if ratio == 1.0 {
+		return len(histogramEdges) - 1
+	}
+	return len(histogramEdges)
+}
+
+func histogramBuckets(counts []int, total int) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(counts))
+	lower := 0.0
+	for i, count := range counts {
+		var label string
+		if i < len(histogramEdges) {
+			label = formatRatioRange(lower, histogramEdges[i])
+			lower = histogramEdges[i]
+		} else {
+			label = "> 100%（体积增加）"
+		}
+		buckets[i] = HistogramBucket{Label: label, Count: count, Larger: i == len(histogramEdges)}
+		if total > 0 {
+			buckets[i].Percent = float64(count) / float64(total) * 100
+		}
+	}
+	return buckets
+}
+
+func formatRatioRange(lower, upper float64) string {
+	return fmt.Sprintf("%.0f–%.0f%%", lower*100, upper*100)
+}
+
+// topChanges 节省最多的 n 个文件和体积增加最多的 n 个文件
+func topChanges(changes []Change, n int) (wins, losses []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Delta() != changes[j].Delta() {
+			return changes[i].Delta() > changes[j].Delta()
+		}
+		return changes[i].Source < changes[j].Source
+	})
+	for _, change := range changes {
+		if change.Delta() <= 0 || len(wins) == n {
+			break
+		}
+		wins = append(wins, change)
+	}
+	for i := len(changes) - 1; i >= 0 && len(losses) < n; i-- {
+		if changes[i].Delta() >= 0 {
+			break
+		}
+		losses = append(losses, changes[i])
+	}
+	return wins, losses
+}
@@ -0,0 +1,171 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThumbnailWidth 缩略图最大宽度（像素）
+const DefaultThumbnailWidth = 160
+
+// thumbnailTimeout 单个缩略图的生成超时
+const thumbnailTimeout = 20 * time.Second
+
+// Thumbnail 一组前后对比缩略图，Before/After 为 data URI
+type Thumbnail struct {
+	Source       string
+	Target       string
+	Before       string
+	After        string
+	OriginalSize int64
+	NewSize      int64
+}
+
+// Thumbnailer 使用 ffmpeg 抽取第一帧并缩放为 JPEG 缩略图
+type Thumbnailer struct {
+	ffmpegPath string
+	width      int
+}
+
+// NewThumbnailer 创建缩略图生成器；width 不大于 0 时使用 DefaultThumbnailWidth
+func NewThumbnailer(ffmpegPath string, width int) *Thumbnailer {
+	if width <= 0 {
+		width = DefaultThumbnailWidth
+	}
+	return &Thumbnailer{ffmpegPath: ffmpegPath, width: width}
+}
+
+// Render 生成文件的缩略图，返回 data URI
+func (t *Thumbnailer) Render(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.ffmpegPath,
+		"-v", "error",
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", t.width),
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("生成缩略图失败: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("生成缩略图失败: ffmpeg 没有输出")
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(stdout.Bytes()), nil
+}
+
+// Sampler 在运行过程中抽样生成前后对比缩略图，最多保留 limit 组。
+//
+// 文件总数事先未知，抽样间隔从 1 开始，超过上限时间隔加倍并丢弃不在新间隔上的样本，
+// 保证样本均匀分布在整个运行中。转换可能原地替换源文件，因此“转换前”的缩略图
+// 必须在转换开始前通过 Before 生成。
+type Sampler struct {
+	thumbnailer *Thumbnailer
+	limit       int
+
+	mu      sync.Mutex
+	seen    int
+	stride  int
+	samples []sample
+}
+
+type sample struct {
+	seq       int
+	thumbnail Thumbnail
+}
+
+// Pending 已生成“转换前”缩略图、等待转换结果的样本
+type Pending struct {
+	seq    int
+	source string
+	before string
+}
+
+// NewSampler 创建抽样器；limit 不大于 0 时不抽样
+func NewSampler(thumbnailer *Thumbnailer, limit int) *Sampler {
+	return &Sampler{thumbnailer: thumbnailer, limit: limit, stride: 1}
+}
+
+// Before 决定是否抽样该文件，抽中时生成转换前的缩略图；未抽中或生成失败时返回 nil
+func (s *Sampler) Before(ctx context.Context, source string) *Pending {
+	if s == nil || s.limit <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	seq := s.seen
+	s.seen++
+	selected := seq%s.stride == 0
+	s.mu.Unlock()
+	if !selected {
+		return nil
+	}
+
+	before, err := s.thumbnailer.Render(ctx, source)
+	if err != nil {
+		return nil
+	}
+	return &Pending{seq: seq, source: source, before: before}
+}
+
+// After 生成转换后的缩略图并保存样本；目标文件无法读取时丢弃该样本
+func (s *Sampler) After(ctx context.Context, pending *Pending, target string, originalSize, newSize int64) {
+	if s == nil || pending == nil {
+		return
+	}
+	after, err := s.thumbnailer.Render(ctx, target)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pending.seq%s.stride != 0 {
+		return // 转换期间间隔已加倍
+	}
+	s.samples = append(s.samples, sample{seq: pending.seq, thumbnail: Thumbnail{
+		Source:       pending.source,
+		Target:       target,
+		Before:       pending.before,
+		After:        after,
+		OriginalSize: originalSize,
+		NewSize:      newSize,
+	}})
+	for len(s.samples) > s.limit {
+		s.stride *= 2
+		kept := s.samples[:0]
+		for _, sample := range s.samples {
+			if sample.seq%s.stride == 0 {
+				kept = append(kept, sample)
+			}
+		}
+		s.samples = kept
+	}
+}
+
+// Thumbnails 按处理顺序返回已保存的样本
+func (s *Sampler) Thumbnails() []Thumbnail {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.samples, func(i, j int) bool { return s.samples[i].seq < s.samples[j].seq })
+	thumbnails := make([]Thumbnail, len(s.samples))
+	for i, sample := range s.samples {
+		thumbnails[i] = sample.thumbnail
+	}
+	return thumbnails
+}
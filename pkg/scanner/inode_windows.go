@@ -0,0 +1,8 @@
+package scanner
+
+import "os"
+
+// fileInode Windows 的 stat 结果不含文件索引号，指纹只使用大小和修改时间
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"pixly/pkg/engine/quality"
+
+	"go.uber.org/zap"
+)
+
+// ScanIndexSchemaVersion 扫描索引条目的格式版本
+// 分析结果的结构或判定逻辑变化时递增，旧版本条目会被视为未命中并重新分析
+const ScanIndexSchemaVersion = 1
+
+// FileFingerprint 判断文件自上次分析后是否变化的指纹
+// 路径相同但 inode 不同说明文件被替换（如原子重命名写入），同样视为变化；
+// 没有 inode 的平台（Windows）只比较大小和修改时间
+type FileFingerprint struct {
+	Size      int64  `json:"size"`
+	ModTimeNs int64  `json:"mtime_ns"`
+	Inode     uint64 `json:"inode"`
+}
+
+// FingerprintOf 由 stat 结果生成文件指纹
+func FingerprintOf(info os.FileInfo) FileFingerprint {
+	return FileFingerprint{
+		Size:      info.Size(),
+		ModTimeNs: info.ModTime().UnixNano(),
+		Inode:     fileInode(info),
+	}
+}
+
+// ScanIndexEntry 持久化的单个文件分析结果
+type ScanIndexEntry struct {
+	SchemaVersion int                        `json:"schema_version"`
+	Fingerprint   FileFingerprint            `json:"fingerprint"`
+	Morphology    *MorphologyResult          `json:"morphology,omitempty"`
+	Quality       *quality.QualityAssessment `json:"quality,omitempty"`
+	// ContentIdentifier Live Photo 配对读取的 Apple ContentIdentifier；nil 表示未读取，空串表示文件没有
+	ContentIdentifier *string   `json:"content_identifier,omitempty"`
+	IndexedAt         time.Time `json:"indexed_at"`
+}
+
+// ScanIndexStore 扫描索引的持久化存储，由 state.StateManager 实现（bbolt）
+type ScanIndexStore interface {
+	LoadScanIndexEntry(path string) ([]byte, error)
+	SaveScanIndexEntry(path string, data []byte) error
+	DeleteScanIndexEntry(path string) error
+}
+
+// ScanIndex 增量扫描索引 - 以路径为键、以 (大小, 修改时间, inode) 判定有效性
+//
+// 未变化的文件直接复用上次的形态分析、品质评估（也是自动模式+深度分析的输入）
+// 与 Live Photo 配对标识，重新扫描时只需 stat，不再调用 ffprobe/exiftool。
+type ScanIndex struct {
+	logger *zap.Logger
+	store  ScanIndexStore
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	stale  atomic.Int64 // 条目存在但文件已变化或版本过期
+}
+
+// NewScanIndex 创建扫描索引
+func NewScanIndex(logger *zap.Logger, store ScanIndexStore) *ScanIndex {
+	return &ScanIndex{logger: logger, store: store}
+}
+
+// Lookup 查找与指纹一致的索引条目；文件变化、版本过期或不存在时返回 nil
+func (idx *ScanIndex) Lookup(path string, fingerprint FileFingerprint) *ScanIndexEntry {
+	entry := idx.load(path)
+	switch {
+	case entry == nil:
+		idx.misses.Add(1)
+		return nil
+	case entry.SchemaVersion != ScanIndexSchemaVersion || entry.Fingerprint != fingerprint:
+		idx.stale.Add(1)
+		return nil
+	default:
+		idx.hits.Add(1)
+		return entry
+	}
+}
+
+// LookupFile stat 文件后查找与当前指纹一致的条目，不计入命中统计（供路由与配对读取附带结果）
+// 返回的指纹用于写入新结果；文件无法 stat 时两者均为 nil
+func (idx *ScanIndex) LookupFile(path string) (*ScanIndexEntry, *FileFingerprint) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil
+	}
+	fingerprint := FingerprintOf(info)
+	entry := idx.load(path)
+	if entry == nil || entry.SchemaVersion != ScanIndexSchemaVersion || entry.Fingerprint != fingerprint {
+		return nil, &fingerprint
+	}
+	return entry, &fingerprint
+}
+
+// Store 保存文件的分析结果
+// 已有条目指纹一致时，entry 中为 nil 的结果沿用已有条目（形态分析、品质评估与配对标识可分别写入）
+func (idx *ScanIndex) Store(path string, entry *ScanIndexEntry) error {
+	if existing := idx.load(path); existing != nil &&
+		existing.SchemaVersion == ScanIndexSchemaVersion &&
+		existing.Fingerprint == entry.Fingerprint {
+		if entry.Morphology == nil {
+			entry.Morphology = existing.Morphology
+		}
+		if entry.Quality == nil {
+			entry.Quality = existing.Quality
+		}
+		if entry.ContentIdentifier == nil {
+			entry.ContentIdentifier = existing.ContentIdentifier
+		}
+	}
+
+	entry.SchemaVersion = ScanIndexSchemaVersion
+	entry.IndexedAt = time.Now()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化扫描索引失败: %w", err)
+	}
+	return idx.store.SaveScanIndexEntry(path, data)
+}
+
+// Invalidate 删除文件的索引条目
+func (idx *ScanIndex) Invalidate(path string) error {
+	return idx.store.DeleteScanIndexEntry(path)
+}
+
+// Stats 返回命中、未命中与过期次数
+func (idx *ScanIndex) Stats() (hits, misses, stale int64) {
+	return idx.hits.Load(), idx.misses.Load(), idx.stale.Load()
+}
+
+// load 读取并解码索引条目，读取或解码失败按不存在处理
+func (idx *ScanIndex) load(path string) *ScanIndexEntry {
+	data, err := idx.store.LoadScanIndexEntry(path)
+	if err != nil {
+		idx.logger.Debug("读取扫描索引失败", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+
+	var entry ScanIndexEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		idx.logger.Debug("扫描索引条目损坏，将重新分析", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	return &entry
+}
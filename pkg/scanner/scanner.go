@@ -14,6 +14,10 @@ type FileInfo struct {
 	Size    int64
 	IsDir   bool
 	ModTime int64
+
+	// Fingerprint identifies this version of the file (size, mtime, inode)
+	// and is used to reuse analysis results from the persistent scan index.
+	Fingerprint FileFingerprint
 }
 
 // Scanner is responsible for scanning directories and finding media files.
@@ -31,7 +35,25 @@ func (s *Scanner) ScanDirectory(ctx context.Context, root string) ([]*FileInfo,
 	s.logger.Info("Starting directory scan", zap.String("root", root))
 	var files []*FileInfo
 
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	err := s.WalkDirectory(ctx, root, func(file *FileInfo) error {
+		files = append(files, file)
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Error("Directory scan failed", zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Info("Directory scan completed", zap.Int("files_found", len(files)))
+	return files, nil
+}
+
+// WalkDirectory walks the target directory and calls fn for every entry as it
+// is found, so callers can start processing before the walk completes.
+// Returning an error from fn stops the walk with that error.
+func (s *Scanner) WalkDirectory(ctx context.Context, root string, fn func(*FileInfo) error) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -45,20 +67,12 @@ func (s *Scanner) ScanDirectory(ctx context.Context, root string) ([]*FileInfo,
 			return nil // Continue scanning
 		}
 
-		files = append(files, &FileInfo{
-			Path:    path,
-			Size:    info.Size(),
-			IsDir:   d.IsDir(),
-			ModTime: info.ModTime().Unix(),
+		return fn(&FileInfo{
+			Path:        path,
+			Size:        info.Size(),
+			IsDir:       d.IsDir(),
+			ModTime:     info.ModTime().Unix(),
+			Fingerprint: FingerprintOf(info),
 		})
-		return nil
 	})
-
-	if err != nil {
-		s.logger.Error("Directory scan failed", zap.Error(err))
-		return nil, err
-	}
-
-	s.logger.Info("Directory scan completed", zap.Int("files_found", len(files)))
-	return files, nil
-}
\ No newline at end of file
+}
@@ -2,7 +2,6 @@ package scanner
 
 import (
 	"context"
-	"fmt"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -22,13 +21,13 @@ import (
 //   - 避免旧版边处理边分析的重复工作
 //   - 采用高并发扫描（CPU核心数 x 2）
 //   - 智能缓存机制，避免重复分析
-//   - 分阶段处理：扫描→分析→缓存→智能处理
+//   - 流式处理：每个文件扫描→分析→缓存后立即输出
 //   - 大幅提升效率，减少I/O操作
 //
-// 架构流程：
+// 架构流程（各阶段通过有界通道连接，逐个文件流动）：
 //
-//	阶段1: 文件发现 - 高并发目录遍历
-//	阶段2: 形态分析 - 并行文件类型识别
+//	阶段1: 文件发现 - 目录遍历
+//	阶段2: 形态分析 - 文件类型识别
 //	阶段3: 品质评估 - 智能品质判断
 //	阶段4: 结果缓存 - 持久化分析结果
 //	阶段5: 智能处理 - 基于缓存的快速决策
@@ -46,6 +45,7 @@ type UnifiedScanArchitecture struct {
 
 	// 性能统计
 	stats       *ScanStatistics // 扫描统计信息
+	statsMutex  sync.Mutex      // 保护流式扫描中并发更新的统计
 	enableStats bool            // 启用统计
 }
 
@@ -56,6 +56,7 @@ type ScanCacheManager struct {
 	memoryCache    map[string]*CachedScanResult // 内存缓存
 	persistentMode bool                         // 持久化模式
 	maxMemoryItems int                          // 最大内存缓存项数
+	index          *ScanIndex                   // 持久化扫描索引（为nil时仅内存缓存）
 	mutex          sync.RWMutex                 // 读写锁
 }
 
@@ -65,6 +66,7 @@ type CachedScanResult struct {
 	FileHash          string                     `json:"file_hash"`          // 文件哈希
 	LastModified      time.Time                  `json:"last_modified"`      // 最后修改时间
 	FileSize          int64                      `json:"file_size"`          // 文件大小
+	Fingerprint       FileFingerprint            `json:"fingerprint"`        // 文件指纹（大小、修改时间、inode）
 	MediaInfo         *types.MediaInfo           `json:"media_info"`         // 媒体信息
 	MorphologyResult  *MorphologyResult          `json:"morphology_result"`  // 形态分析结果
 	QualityAssessment *quality.QualityAssessment `json:"quality_assessment"` // 品质评估结果
@@ -183,291 +185,64 @@ func NewScanCacheManager(logger *zap.Logger, cacheDir string) *ScanCacheManager
 }
 
 // ExecuteUnifiedScan 执行统一扫描 - README要求的核心新流程
+//
+// 收集 StreamUnifiedScan 的流式输出：遍历、形态分析、品质评估与缓存逐个文件进行，
+// 全部完成后按路径排序生成统一结果。
 func (usa *UnifiedScanArchitecture) ExecuteUnifiedScan(ctx context.Context, targetDir string) (*UnifiedScanResult, error) {
-	usa.stats.StartTime = time.Now()
-	usa.logger.Info("开始执行统一扫描", zap.String("target_dir", targetDir))
-
-	// 阶段1: 文件发现 - 高并发目录遍历
-	phaseStart := time.Now()
-	files, err := usa.performFilesDiscovery(ctx, targetDir)
-	if err != nil {
-		return nil, fmt.Errorf("文件发现阶段失败: %w", err)
-	}
-	usa.stats.ProcessingTimeBreakdown["file_discovery"] = time.Since(phaseStart)
-	usa.stats.TotalFiles = len(files)
-
-	// 阶段2: 形态分析 - 并行文件类型识别
-	phaseStart = time.Now()
-	morphologyResults, err := usa.performMorphologyAnalysis(ctx, files)
-	if err != nil {
-		return nil, fmt.Errorf("形态分析阶段失败: %w", err)
-	}
-	usa.stats.ProcessingTimeBreakdown["morphology_analysis"] = time.Since(phaseStart)
+	scanStart := time.Now()
 
-	// 阶段3: 品质评估 - 智能品质判断
-	phaseStart = time.Now()
-	qualityResults, err := usa.performQualityAssessment(ctx, files, morphologyResults)
-	if err != nil {
-		return nil, fmt.Errorf("品质评估阶段失败: %w", err)
-	}
-	usa.stats.ProcessingTimeBreakdown["quality_assessment"] = time.Since(phaseStart)
-
-	// 阶段4: 结果缓存 - 持久化分析结果
-	phaseStart = time.Now()
-	if err := usa.cacheResults(files, morphologyResults, qualityResults); err != nil {
-		usa.logger.Warn("结果缓存失败", zap.Error(err))
-	}
-	usa.stats.ProcessingTimeBreakdown["result_caching"] = time.Since(phaseStart)
-
-	// 阶段5: 智能处理 - 基于缓存的快速决策
-	phaseStart = time.Now()
-	mediaFiles, err := usa.generateMediaInfoList(files, morphologyResults, qualityResults)
-	if err != nil {
-		return nil, fmt.Errorf("媒体信息生成失败: %w", err)
+	mediaStream, errs := usa.StreamUnifiedScan(ctx, targetDir, 0)
+	var mediaFiles []*types.MediaInfo
+	for mediaInfo := range mediaStream {
+		mediaFiles = append(mediaFiles, mediaInfo)
 	}
-	usa.stats.ProcessingTimeBreakdown["media_info_generation"] = time.Since(phaseStart)
-
-	// 生成最终结果
-	result := usa.generateUnifiedResult(mediaFiles)
-
-	usa.stats.EndTime = time.Now()
-	usa.stats.TotalDuration = usa.stats.EndTime.Sub(usa.stats.StartTime)
-
-	usa.logger.Info("统一扫描完成",
-		zap.Int("total_files", usa.stats.TotalFiles),
-		zap.Int("media_files", usa.stats.MediaFiles),
-		zap.Duration("total_duration", usa.stats.TotalDuration),
-		zap.Float64("cache_hit_rate", float64(usa.stats.CacheHits)/float64(usa.stats.CacheHits+usa.stats.CacheMisses)*100))
-
-	return result, nil
-}
-
-// performFilesDiscovery 执行文件发现 - 阶段1
-func (usa *UnifiedScanArchitecture) performFilesDiscovery(ctx context.Context, targetDir string) ([]*FileInfo, error) {
-	usa.logger.Debug("开始文件发现阶段")
-
-	// 使用现有的Scanner进行文件发现
-	files, err := usa.fileScanner.ScanDirectory(ctx, targetDir)
-	if err != nil {
+	if err := <-errs; err != nil {
 		return nil, err
 	}
-
-	// 过滤出媒体文件候选
-	var mediaFiles []*FileInfo
-	for _, file := range files {
-		if !file.IsDir && usa.isMediaFileCandidate(file.Path) {
-			mediaFiles = append(mediaFiles, file)
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	usa.logger.Debug("文件发现阶段完成",
-		zap.Int("total_files", len(files)),
-		zap.Int("media_candidates", len(mediaFiles)))
-
-	return mediaFiles, nil
-}
-
-// performMorphologyAnalysis 执行形态分析 - 阶段2
-func (usa *UnifiedScanArchitecture) performMorphologyAnalysis(ctx context.Context, files []*FileInfo) (map[string]*MorphologyResult, error) {
-	usa.logger.Debug("开始形态分析阶段", zap.Int("files", len(files)))
-
-	results := make(map[string]*MorphologyResult)
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-
-	// 创建工作通道
-	fileChan := make(chan *FileInfo, len(files))
-	for _, file := range files {
-		fileChan <- file
-	}
-	close(fileChan)
-
-	// 启动工作协程
-	for i := 0; i < usa.maxWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for file := range fileChan {
-				// 检查缓存
-				if cached := usa.cacheManager.GetCachedResult(file.Path); cached != nil && cached.IsValid {
-					mu.Lock()
-					results[file.Path] = cached.MorphologyResult
-					usa.stats.CacheHits++
-					mu.Unlock()
-					continue
-				}
-
-				// 执行形态分析
-				result, err := usa.morphologyClassifier.ClassifyFile(ctx, file.Path)
-				if err != nil {
-					usa.logger.Warn("形态分析失败",
-						zap.String("file", filepath.Base(file.Path)),
-						zap.Error(err))
-					continue
-				}
-
-				mu.Lock()
-				results[file.Path] = result
-				usa.stats.CacheMisses++
-				usa.stats.FileTypeDistribution[result.MediaType.String()]++
-				mu.Unlock()
-			}
-		}()
-	}
+	// 按路径排序
+	sort.Slice(mediaFiles, func(i, j int) bool {
+		return mediaFiles[i].Path < mediaFiles[j].Path
+	})
 
-	wg.Wait()
+	usa.statsMutex.Lock()
+	defer usa.statsMutex.Unlock()
+	usa.stats.ProcessingTimeBreakdown["streaming_scan"] = time.Since(scanStart)
 
-	usa.logger.Debug("形态分析阶段完成", zap.Int("results", len(results)))
-	return results, nil
+	return usa.generateUnifiedResult(mediaFiles), nil
 }
 
-// performQualityAssessment 执行品质评估 - 阶段3
-func (usa *UnifiedScanArchitecture) performQualityAssessment(ctx context.Context, files []*FileInfo, morphologyResults map[string]*MorphologyResult) (map[string]*quality.QualityAssessment, error) {
-	usa.logger.Debug("开始品质评估阶段")
-
-	results := make(map[string]*quality.QualityAssessment)
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-
-	// 只对媒体文件进行品质评估
-	var mediaFiles []*FileInfo
-	for _, file := range files {
-		if morphResult, exists := morphologyResults[file.Path]; exists {
-			if morphResult.MediaType != types.MediaTypeUnknown {
-				mediaFiles = append(mediaFiles, file)
-			}
-		}
+// newMediaInfo 由文件信息、形态分析和品质评估结果生成MediaInfo
+func newMediaInfo(file *FileInfo, morphResult *MorphologyResult, qualityResult *quality.QualityAssessment) *types.MediaInfo {
+	// 创建MediaInfo
+	mediaInfo := &types.MediaInfo{
+		Path:     file.Path,
+		Size:     file.Size,
+		ModTime:  time.Unix(file.ModTime, 0),
+		Type:     morphResult.MediaType,
+		Format:   morphResult.TrueFormat,
+		Status:   types.StatusPending,
+		Width:    morphResult.Width,
+		Height:   morphResult.Height,
+		Duration: morphResult.Duration,
 	}
 
-	// 创建工作通道
-	fileChan := make(chan *FileInfo, len(mediaFiles))
-	for _, file := range mediaFiles {
-		fileChan <- file
-	}
-	close(fileChan)
-
-	// 启动工作协程（使用较少的线程进行品质分析）
-	workerCount := usa.maxWorkers / 2
-	if workerCount < 1 {
-		workerCount = 1
-	}
-
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for file := range fileChan {
-				// 检查缓存
-				if cached := usa.cacheManager.GetCachedResult(file.Path); cached != nil && cached.IsValid && cached.QualityAssessment != nil {
-					mu.Lock()
-					results[file.Path] = cached.QualityAssessment
-					mu.Unlock()
-					continue
-				}
-
-				// 执行品质评估
-				assessment, err := usa.qualityEngine.AssessFile(ctx, file.Path)
-				if err != nil {
-					usa.logger.Warn("品质评估失败",
-						zap.String("file", filepath.Base(file.Path)),
-						zap.Error(err))
-					continue
-				}
-
-				mu.Lock()
-				results[file.Path] = assessment
-				usa.stats.QualityDistribution[assessment.QualityLevel]++
-				mu.Unlock()
-			}
-		}()
-	}
-
-	wg.Wait()
-
-	usa.logger.Debug("品质评估阶段完成", zap.Int("results", len(results)))
-	return results, nil
-}
-
-// cacheResults 缓存分析结果 - 阶段4
-func (usa *UnifiedScanArchitecture) cacheResults(files []*FileInfo, morphologyResults map[string]*MorphologyResult, qualityResults map[string]*quality.QualityAssessment) error {
-	usa.logger.Debug("开始结果缓存阶段")
-
-	for _, file := range files {
-		cachedResult := &CachedScanResult{
-			FilePath:     file.Path,
-			LastModified: time.Unix(file.ModTime, 0),
-			FileSize:     file.Size,
-			CacheTime:    time.Now(),
-			IsValid:      true,
-		}
-
-		// 添加形态分析结果
-		if morphResult, exists := morphologyResults[file.Path]; exists {
-			cachedResult.MorphologyResult = morphResult
-		}
-
-		// 添加品质评估结果
-		if qualityResult, exists := qualityResults[file.Path]; exists {
-			cachedResult.QualityAssessment = qualityResult
-		}
-
-		// 存储到缓存
-		usa.cacheManager.SetCachedResult(file.Path, cachedResult)
+	// 添加品质信息
+	if qualityResult != nil {
+		mediaInfo.Quality = qualityResult.QualityLevel
+		mediaInfo.PixelDensity = qualityResult.PixelDensity
+		mediaInfo.JpegQuality = qualityResult.JpegQuality
 	}
 
-	usa.logger.Debug("结果缓存阶段完成")
-	return nil
-}
-
-// generateMediaInfoList 生成媒体信息列表 - 阶段5
-func (usa *UnifiedScanArchitecture) generateMediaInfoList(files []*FileInfo, morphologyResults map[string]*MorphologyResult, qualityResults map[string]*quality.QualityAssessment) ([]*types.MediaInfo, error) {
-	var mediaFiles []*types.MediaInfo
-
-	for _, file := range files {
-		morphResult, hasMorph := morphologyResults[file.Path]
-		qualityResult, hasQuality := qualityResults[file.Path]
-
-		// 只处理识别为媒体文件的项
-		if !hasMorph || morphResult.MediaType == types.MediaTypeUnknown {
-			usa.stats.SkippedFiles++
-			continue
-		}
-
-		// 创建MediaInfo
-		mediaInfo := &types.MediaInfo{
-			Path:     file.Path,
-			Size:     file.Size,
-			ModTime:  time.Unix(file.ModTime, 0),
-			Type:     morphResult.MediaType,
-			Format:   morphResult.TrueFormat,
-			Status:   types.StatusPending,
-			Width:    morphResult.Width,
-			Height:   morphResult.Height,
-			Duration: morphResult.Duration,
-		}
-
-		// 添加品质信息
-		if hasQuality {
-			mediaInfo.Quality = qualityResult.QualityLevel
-			mediaInfo.PixelDensity = qualityResult.PixelDensity
-			mediaInfo.JpegQuality = qualityResult.JpegQuality
-		}
-
-		// 设置损坏标记
-		if morphResult.FrameCount == 0 && morphResult.Duration == 0 && morphResult.MediaType != types.MediaTypeImage {
-			mediaInfo.IsCorrupted = true
-		}
-
-		mediaFiles = append(mediaFiles, mediaInfo)
-		usa.stats.MediaFiles++
+	// 设置损坏标记
+	if morphResult.FrameCount == 0 && morphResult.Duration == 0 && morphResult.MediaType != types.MediaTypeImage {
+		mediaInfo.IsCorrupted = true
 	}
 
-	// 按路径排序
-	sort.Slice(mediaFiles, func(i, j int) bool {
-		return mediaFiles[i].Path < mediaFiles[j].Path
-	})
-
-	return mediaFiles, nil
+	return mediaInfo
 }
 
 // generateUnifiedResult 生成统一扫描结果
@@ -577,7 +352,52 @@ func (usa *UnifiedScanArchitecture) generateProcessingRecommendations(mediaFiles
 	}
 }
 
+// SetScanIndex 启用持久化扫描索引，未变化的文件跨运行复用分析结果
+func (usa *UnifiedScanArchitecture) SetScanIndex(index *ScanIndex) {
+	usa.cacheManager.SetIndex(index)
+}
+
 // 缓存管理器方法
+
+// SetIndex 设置持久化扫描索引
+func (scm *ScanCacheManager) SetIndex(index *ScanIndex) {
+	scm.mutex.Lock()
+	defer scm.mutex.Unlock()
+	scm.index = index
+}
+
+// Lookup 查找与文件当前指纹一致的分析结果：先查内存缓存，再查持久化索引
+func (scm *ScanCacheManager) Lookup(file *FileInfo) *CachedScanResult {
+	if cached := scm.GetCachedResult(file.Path); cached != nil && cached.IsValid && cached.Fingerprint == file.Fingerprint {
+		return cached
+	}
+
+	scm.mutex.RLock()
+	index := scm.index
+	scm.mutex.RUnlock()
+	if index == nil {
+		return nil
+	}
+
+	entry := index.Lookup(file.Path, file.Fingerprint)
+	if entry == nil {
+		return nil
+	}
+
+	result := &CachedScanResult{
+		FilePath:          file.Path,
+		LastModified:      time.Unix(file.ModTime, 0),
+		FileSize:          file.Size,
+		Fingerprint:       entry.Fingerprint,
+		MorphologyResult:  entry.Morphology,
+		QualityAssessment: entry.Quality,
+		CacheTime:         entry.IndexedAt,
+		IsValid:           true,
+	}
+	scm.storeInMemory(file.Path, result)
+	return result
+}
+
 func (scm *ScanCacheManager) GetCachedResult(filePath string) *CachedScanResult {
 	scm.mutex.RLock()
 	defer scm.mutex.RUnlock()
@@ -589,7 +409,29 @@ func (scm *ScanCacheManager) GetCachedResult(filePath string) *CachedScanResult
 	return nil
 }
 
+// SetCachedResult 写入内存缓存，启用了持久化索引时同时写入索引
 func (scm *ScanCacheManager) SetCachedResult(filePath string, result *CachedScanResult) {
+	scm.storeInMemory(filePath, result)
+
+	scm.mutex.RLock()
+	index := scm.index
+	scm.mutex.RUnlock()
+	if index == nil || !result.IsValid {
+		return
+	}
+
+	err := index.Store(filePath, &ScanIndexEntry{
+		Fingerprint: result.Fingerprint,
+		Morphology:  result.MorphologyResult,
+		Quality:     result.QualityAssessment,
+	})
+	if err != nil {
+		scm.logger.Warn("写入扫描索引失败", zap.String("file", filepath.Base(filePath)), zap.Error(err))
+	}
+}
+
+// storeInMemory 写入内存缓存，超出上限时淘汰最少访问的条目
+func (scm *ScanCacheManager) storeInMemory(filePath string, result *CachedScanResult) {
 	scm.mutex.Lock()
 	defer scm.mutex.Unlock()
 
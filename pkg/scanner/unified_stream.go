@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine/quality"
+
+	"go.uber.org/zap"
+)
+
+// StreamUnifiedScan 流式统一扫描 - 遍历与分析同时进行，每个文件分析完成后立即输出
+//
+// 各阶段之间使用容量为 bufferSize 的通道连接：消费者处理不过来时分析与遍历会被阻塞（背压），
+// 内存占用不随文件总数增长。ExecuteUnifiedScan 收集本方法的输出生成汇总结果。
+// 媒体文件通道关闭后，错误通道最多输出一个错误然后关闭。
+func (usa *UnifiedScanArchitecture) StreamUnifiedScan(ctx context.Context, targetDir string, bufferSize int) (<-chan *types.MediaInfo, <-chan error) {
+	if bufferSize <= 0 {
+		bufferSize = usa.maxWorkers
+	}
+
+	usa.statsMutex.Lock()
+	usa.stats.StartTime = time.Now()
+	usa.statsMutex.Unlock()
+	usa.logger.Info("开始执行流式统一扫描", zap.String("target_dir", targetDir))
+
+	candidates := make(chan *FileInfo, bufferSize)
+	mediaFiles := make(chan *types.MediaInfo, bufferSize)
+	errs := make(chan error, 1)
+	walkDone := make(chan struct{})
+
+	// 阶段1: 文件发现 - 边遍历边输出媒体文件候选
+	go func() {
+		defer close(walkDone)
+		defer close(candidates)
+
+		err := usa.fileScanner.WalkDirectory(ctx, targetDir, func(file *FileInfo) error {
+			if file.IsDir || !usa.isMediaFileCandidate(file.Path) {
+				return nil
+			}
+			select {
+			case candidates <- file:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errs <- fmt.Errorf("文件发现阶段失败: %w", err)
+		}
+	}()
+
+	// 阶段2-4: 形态分析、品质评估与结果缓存逐个文件进行（使用一半线程）
+	var wg sync.WaitGroup
+	workerCount := usa.maxWorkers / 2
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range candidates {
+				mediaInfo := usa.analyzeFile(ctx, file)
+				if mediaInfo == nil {
+					continue
+				}
+				select {
+				case mediaFiles <- mediaInfo:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		<-walkDone
+
+		usa.statsMutex.Lock()
+		usa.stats.EndTime = time.Now()
+		usa.stats.TotalDuration = usa.stats.EndTime.Sub(usa.stats.StartTime)
+		usa.logger.Info("流式统一扫描完成",
+			zap.Int("total_files", usa.stats.TotalFiles),
+			zap.Int("media_files", usa.stats.MediaFiles),
+			zap.Duration("total_duration", usa.stats.TotalDuration))
+		usa.statsMutex.Unlock()
+
+		close(mediaFiles)
+		close(errs)
+	}()
+
+	return mediaFiles, errs
+}
+
+// analyzeFile 对单个文件执行形态分析与品质评估并缓存结果，非媒体文件或分析失败返回nil
+func (usa *UnifiedScanArchitecture) analyzeFile(ctx context.Context, file *FileInfo) *types.MediaInfo {
+	var morphResult *MorphologyResult
+	var assessment *quality.QualityAssessment
+
+	// 检查缓存（含持久化索引），命中时只需要之前的 stat
+	cached := usa.cacheManager.Lookup(file)
+	if cached != nil {
+		morphResult = cached.MorphologyResult
+		assessment = cached.QualityAssessment
+	}
+	cacheHit := morphResult != nil
+
+	if morphResult == nil {
+		var err error
+		morphResult, err = usa.morphologyClassifier.ClassifyFile(ctx, file.Path)
+		if err != nil {
+			usa.logger.Warn("形态分析失败",
+				zap.String("file", filepath.Base(file.Path)),
+				zap.Error(err))
+			usa.recordStats(func(stats *ScanStatistics) {
+				stats.TotalFiles++
+				stats.SkippedFiles++
+			})
+			return nil
+		}
+	}
+
+	// 只对媒体文件进行品质评估
+	assessed := false
+	if assessment == nil && morphResult.MediaType != types.MediaTypeUnknown {
+		var err error
+		assessment, err = usa.qualityEngine.AssessFile(ctx, file.Path)
+		if err != nil {
+			usa.logger.Warn("品质评估失败",
+				zap.String("file", filepath.Base(file.Path)),
+				zap.Error(err))
+		}
+		assessed = assessment != nil
+	}
+
+	if !cacheHit || assessed {
+		usa.cacheManager.SetCachedResult(file.Path, &CachedScanResult{
+			FilePath:          file.Path,
+			LastModified:      time.Unix(file.ModTime, 0),
+			FileSize:          file.Size,
+			Fingerprint:       file.Fingerprint,
+			MorphologyResult:  morphResult,
+			QualityAssessment: assessment,
+			CacheTime:         time.Now(),
+			IsValid:           true,
+		})
+	}
+
+	isMedia := morphResult.MediaType != types.MediaTypeUnknown
+	usa.recordStats(func(stats *ScanStatistics) {
+		stats.TotalFiles++
+		if cacheHit {
+			stats.CacheHits++
+		} else {
+			stats.CacheMisses++
+		}
+		if !isMedia {
+			stats.SkippedFiles++
+			return
+		}
+		stats.MediaFiles++
+		stats.FileTypeDistribution[morphResult.MediaType.String()]++
+		if assessment != nil {
+			stats.QualityDistribution[assessment.QualityLevel]++
+		}
+	})
+
+	if !isMedia {
+		return nil
+	}
+	return newMediaInfo(file, morphResult, assessment)
+}
+
+// recordStats 在锁内更新扫描统计
+func (usa *UnifiedScanArchitecture) recordStats(update func(stats *ScanStatistics)) {
+	if !usa.enableStats {
+		return
+	}
+	usa.statsMutex.Lock()
+	defer usa.statsMutex.Unlock()
+	update(usa.stats)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/engine"
+	"pixly/pkg/ui/progress"
+)
+
+// JobState 任务状态
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobPaused    JobState = "paused"
+	JobCompleted JobState = "completed"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Terminal 任务是否已结束
+func (s JobState) Terminal() bool {
+	return s == JobCompleted || s == JobFailed || s == JobCancelled
+}
+
+// JobRequest 提交任务的请求体
+type JobRequest struct {
+	Dir     string                 `json:"dir"`
+	Profile string                 `json:"profile,omitempty"`
+	Config  map[string]interface{} `json:"config,omitempty"` // 以 JSON 键覆盖配置项，优先级同命令行参数
+}
+
+// JobStatus 任务状态快照
+type JobStatus struct {
+	ID         string                  `json:"id"`
+	Dir        string                  `json:"dir"`
+	Profile    string                  `json:"profile,omitempty"`
+	Mode       string                  `json:"mode"`
+	State      JobState                `json:"state"`
+	Error      string                  `json:"error,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	StartedAt  *time.Time              `json:"started_at,omitempty"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	Progress   *progress.ProgressStats `json:"progress,omitempty"`
+}
+
+// Job 一个转换任务，任务按提交顺序逐个执行
+type Job struct {
+	mu sync.Mutex
+
+	id        string
+	cfg       *config.Config
+	state     JobState
+	err       error
+	createdAt time.Time
+	started   time.Time
+	finished  time.Time
+
+	engine   *engine.ConversionEngine // 运行后设置
+	cancel   context.CancelFunc
+	progress *progress.ProgressStats // 结束时保留的最终进度
+	done     chan struct{}
+}
+
+func newJob(id string, cfg *config.Config) *Job {
+	return &Job{
+		id:        id,
+		cfg:       cfg,
+		state:     JobQueued,
+		createdAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+}
+
+// Status 返回任务状态快照
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := JobStatus{
+		ID:        j.id,
+		Dir:       j.cfg.TargetDir,
+		Profile:   j.cfg.ActiveProfile(),
+		Mode:      j.cfg.Mode,
+		State:     j.state,
+		CreatedAt: j.createdAt,
+		Progress:  j.progress,
+	}
+	if j.state == JobRunning && j.engine != nil && j.engine.IsPaused() {
+		status.State = JobPaused
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		status.StartedAt = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		status.FinishedAt = &finished
+	}
+	if j.engine != nil && j.progress == nil {
+		status.Progress = j.engine.ProgressStats()
+	}
+	return status
+}
+
+// Done 任务结束时关闭
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// start 标记开始运行；已取消的排队任务返回 false
+func (j *Job) start(conversionEngine *engine.ConversionEngine, cancel context.CancelFunc) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != JobQueued {
+		return false
+	}
+	j.state = JobRunning
+	j.started = time.Now()
+	j.engine = conversionEngine
+	j.cancel = cancel
+	return true
+}
+
+// finish 记录结果并保留最终进度
+func (j *Job) finish(err error, cancelled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case cancelled:
+		j.state = JobCancelled
+	case err != nil:
+		j.state, j.err = JobFailed, err
+	default:
+		j.state = JobCompleted
+	}
+	j.finished = time.Now()
+	if j.engine != nil {
+		j.progress = j.engine.ProgressStats()
+	}
+	close(j.done)
+}
+
+// pause 暂停运行中的任务
+func (j *Job) pause() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != JobRunning || j.engine == nil {
+		return false
+	}
+	j.engine.Pause()
+	return true
+}
+
+// resume 恢复暂停的任务
+func (j *Job) resume() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != JobRunning || j.engine == nil {
+		return false
+	}
+	j.engine.Resume()
+	return true
+}
+
+// requestCancel 取消任务：排队中的任务直接结束，运行中的任务取消上下文后由执行方结束
+func (j *Job) requestCancel() bool {
+	j.mu.Lock()
+	switch {
+	case j.state == JobQueued:
+		j.state = JobCancelled
+		j.finished = time.Now()
+		close(j.done)
+		j.mu.Unlock()
+		return true
+	case j.state == JobRunning:
+		j.cancel()
+		j.engine.Resume() // 暂停中的任务需要唤醒才能退出
+		j.mu.Unlock()
+		return true
+	default:
+		j.mu.Unlock()
+		return false
+	}
+}
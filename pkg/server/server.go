@@ -0,0 +1,448 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Options 服务选项
+type Options struct {
+	ConfigOptions config.LoadOptions // 任务配置的分层加载选项，Flags 由请求填充
+	EventInterval time.Duration      // SSE 进度推送间隔
+}
+
+// Server 本地 HTTP 任务接口 - 提交、查询、暂停/恢复/取消转换任务，通过 SSE 推送进度
+//
+// 任务按提交顺序逐个执行，全部任务共用服务打开的状态数据库；
+// 每个任务开始时引擎会重置文件记录，逐文件状态只保留最近一次运行的任务。
+type Server struct {
+	logger *zap.Logger
+	tools  types.ToolCheckResults
+	state  *state.StateManager
+	opts   Options
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	list []*Job        // 按提交顺序
+	wake chan struct{} // 有新任务时通知执行循环
+}
+
+// New 创建任务服务，stateManager 由调用方打开和关闭
+func New(logger *zap.Logger, toolResults types.ToolCheckResults, stateManager *state.StateManager, opts Options) *Server {
+	if opts.EventInterval <= 0 {
+		opts.EventInterval = 500 * time.Millisecond
+	}
+	return &Server{
+		logger: logger,
+		tools:  toolResults,
+		state:  stateManager,
+		opts:   opts,
+		jobs:   make(map[string]*Job),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Handler 返回 HTTP 路由
+//
+//	POST /jobs                 提交任务 {"dir": "...", "profile": "web", "config": {"crf": 30}}
+//	GET  /jobs                 列出任务
+//	GET  /jobs/{id}            任务状态与进度
+//	GET  /jobs/{id}/files      逐文件状态（来自状态数据库）
+//	GET  /jobs/{id}/events     SSE 进度流，任务结束时发送 done 事件
+//	POST /jobs/{id}/pause      暂停
+//	POST /jobs/{id}/resume     恢复
+//	POST /jobs/{id}/cancel     取消
+//	GET  /queue                持久化转换队列 ?dir= 限定目录
+//	POST /queue/pause          暂停整个队列（运行中的任务在当前文件完成后等待）
+//	POST /queue/resume         恢复队列
+//	POST /queue/cancel         取消单个文件 {"path": "..."}
+//	POST /queue/retry          重新排队失败或已取消的文件 {"path": "..."}
+//	POST /queue/priority       调整单个文件的优先级 {"path": "...", "priority": 10}
+//	GET  /metrics              Prometheus 文本格式的运行指标
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleSubmit)
+	mux.HandleFunc("GET /jobs", s.handleList)
+	mux.HandleFunc("GET /jobs/{id}", s.withJob(s.handleStatus))
+	mux.HandleFunc("GET /jobs/{id}/files", s.withJob(s.handleFiles))
+	mux.HandleFunc("GET /jobs/{id}/events", s.withJob(s.handleEvents))
+	mux.HandleFunc("POST /jobs/{id}/pause", s.withJob(s.handleControl((*Job).pause, "任务未在运行")))
+	mux.HandleFunc("POST /jobs/{id}/resume", s.withJob(s.handleControl((*Job).resume, "任务未在运行")))
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.withJob(s.handleControl((*Job).requestCancel, "任务已结束")))
+	mux.HandleFunc("GET /queue", s.handleQueue)
+	mux.HandleFunc("POST /queue/pause", s.handleQueueToggle(s.state.PauseQueue))
+	mux.HandleFunc("POST /queue/resume", s.handleQueueToggle(s.state.ResumeQueue))
+	mux.HandleFunc("POST /queue/cancel", s.handleQueueEntry(func(req queueRequest) error { return s.state.CancelJob(req.Path) }))
+	mux.HandleFunc("POST /queue/retry", s.handleQueueEntry(func(req queueRequest) error { return s.state.RetryJob(req.Path) }))
+	mux.HandleFunc("POST /queue/priority", s.handleQueueEntry(func(req queueRequest) error { return s.state.SetJobPriority(req.Path, req.Priority) }))
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+// Run 逐个执行排队的任务，直到 ctx 取消（运行中的任务随之取消）
+func (s *Server) Run(ctx context.Context) {
+	for {
+		if job := s.nextQueued(); job != nil {
+			s.runJob(ctx, job)
+			continue
+		}
+		select {
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Submit 校验配置并加入队列
+func (s *Server) Submit(req JobRequest) (*Job, error) {
+	cfg, err := s.loadJobConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	job := newJob(newJobID(), cfg)
+	s.mu.Lock()
+	s.jobs[job.id] = job
+	s.list = append(s.list, job)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	s.logger.Info("任务已提交", zap.String("job", job.id), zap.String("dir", cfg.TargetDir))
+	return job, nil
+}
+
+// Job 按 ID 查找任务
+func (s *Server) Job(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+func (s *Server) nextQueued() *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.list {
+		if job.Status().State == JobQueued {
+			return job
+		}
+	}
+	return nil
+}
+
+func (s *Server) runJob(ctx context.Context, job *Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conversionEngine := engine.NewConversionEngine(s.logger.With(zap.String("job", job.id)), job.cfg, s.tools, nil)
+	conversionEngine.SetStateManager(s.state)
+	if !job.start(conversionEngine, cancel) {
+		return // 排队期间已取消
+	}
+
+	s.logger.Info("任务开始", zap.String("job", job.id))
+	err := conversionEngine.Execute(jobCtx)
+	job.finish(err, jobCtx.Err() != nil)
+	s.logger.Info("任务结束", zap.String("job", job.id), zap.String("state", string(job.Status().State)), zap.Error(err))
+}
+
+// loadJobConfig 按与命令行相同的分层规则加载任务配置，请求中的覆盖项位于参数层
+func (s *Server) loadJobConfig(req JobRequest) (*config.Config, error) {
+	if req.Dir == "" {
+		return nil, errors.New("缺少 dir")
+	}
+	dir, err := filepath.Abs(req.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("解析目录失败: %w", err)
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("访问目录失败: %w", err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("不是目录: %s", dir)
+	}
+
+	overrides := &config.FlagOverrides{Profile: req.Profile}
+	overrides.Set("target_dir", dir)
+	for key, value := range req.Config {
+		if key == "target_dir" {
+			return nil, errors.New("请使用 dir 指定目录")
+		}
+		switch v := value.(type) {
+		case string:
+			overrides.Set(key, v)
+		case bool:
+			overrides.Set(key, strconv.FormatBool(v))
+		case float64:
+			overrides.Set(key, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("配置项 %s 的值必须是字符串、数字或布尔值", key)
+		}
+	}
+
+	opts := s.opts.ConfigOptions
+	opts.Flags = overrides
+	cfg, err := config.Load(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ValidateAndNormalize(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func newJobID() string {
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	return fmt.Sprintf("job-%s", hex.EncodeToString(buf))
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体无效: %w", err))
+		return
+	}
+	job, err := s.Submit(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, job.Status())
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	statuses := make([]JobStatus, 0, len(s.list))
+	for _, job := range s.list {
+		statuses = append(statuses, job.Status())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// withJob 解析路径中的任务 ID
+func (s *Server) withJob(handler func(http.ResponseWriter, *http.Request, *Job)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := s.Job(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("任务不存在: %s", r.PathValue("id")))
+			return
+		}
+		handler(w, r, job)
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, job *Job) {
+	writeJSON(w, http.StatusOK, job.Status())
+}
+
+// handleControl 暂停、恢复、取消；当前状态不允许时返回 409
+func (s *Server) handleControl(action func(*Job) bool, conflict string) func(http.ResponseWriter, *http.Request, *Job) {
+	return func(w http.ResponseWriter, r *http.Request, job *Job) {
+		if !action(job) {
+			writeError(w, http.StatusConflict, errors.New(conflict))
+			return
+		}
+		writeJSON(w, http.StatusOK, job.Status())
+	}
+}
+
+// FileStatus 单个文件的处理状态
+type FileStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// statusNames 处理状态的接口名称
+var statusNames = map[types.ProcessingStatus]string{
+	types.StatusPending:    "pending",
+	types.StatusScanning:   "scanning",
+	types.StatusAssessing:  "assessing",
+	types.StatusConverting: "converting",
+	types.StatusCompleted:  "completed",
+	types.StatusSkipped:    "skipped",
+	types.StatusFailed:     "failed",
+	types.StatusCorrupted:  "corrupted",
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request, job *Job) {
+	files, err := s.state.LoadMediaFiles()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("读取状态数据库失败: %w", err))
+		return
+	}
+
+	prefix := job.cfg.TargetDir + string(filepath.Separator)
+	statuses := make([]FileStatus, 0)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Path, prefix) {
+			continue
+		}
+		statuses = append(statuses, FileStatus{
+			Path:   file.Path,
+			Status: statusNames[file.Status],
+			Size:   file.Size,
+			Error:  file.ErrorMessage,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleEvents 以 SSE 推送任务状态，任务结束后发送 done 事件并关闭连接
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request, job *Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("不支持流式响应"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(s.opts.EventInterval)
+	defer ticker.Stop()
+	for {
+		status := job.Status()
+		event := "progress"
+		if status.State.Terminal() {
+			event = "done"
+		}
+		data, _ := json.Marshal(status)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+		if event == "done" {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-job.Done():
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// QueueStatus 转换队列快照
+type QueueStatus struct {
+	Paused  bool                `json:"paused"`
+	Entries []*state.QueueEntry `json:"entries"`
+}
+
+// queueRequest 单个文件的队列操作
+type queueRequest struct {
+	Path     string `json:"path"`
+	Priority int    `json:"priority"`
+}
+
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	dir := r.URL.Query().Get("dir")
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("解析目录失败: %w", err))
+			return
+		}
+		dir = abs
+	}
+
+	paused, err := s.state.IsQueuePaused()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("读取状态数据库失败: %w", err))
+		return
+	}
+	entries, err := s.state.ListQueue(dir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("读取状态数据库失败: %w", err))
+		return
+	}
+	for _, entry := range entries {
+		entry.Payload = nil // 内部编码的转换任务不对外输出
+	}
+	if entries == nil {
+		entries = []*state.QueueEntry{}
+	}
+	writeJSON(w, http.StatusOK, QueueStatus{Paused: paused, Entries: entries})
+}
+
+// handleQueueToggle 暂停或恢复整个队列
+func (s *Server) handleQueueToggle(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := action(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.handleQueue(w, r)
+	}
+}
+
+// handleQueueEntry 单个文件的队列操作：文件不在队列中返回 404，正在转换时取消返回 409
+func (s *Server) handleQueueEntry(action func(queueRequest) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req queueRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("请求体无效: %w", err))
+			return
+		}
+		if req.Path == "" {
+			writeError(w, http.StatusBadRequest, errors.New("缺少 path"))
+			return
+		}
+		path, err := filepath.Abs(req.Path)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("解析路径失败: %w", err))
+			return
+		}
+		req.Path = path
+
+		switch err := action(req); {
+		case errors.Is(err, state.ErrQueueEntryNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, state.ErrQueueEntryRunning):
+			writeError(w, http.StatusConflict, err)
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeJSON(w, http.StatusOK, map[string]string{"path": req.Path})
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -44,6 +44,7 @@ type ProgressManager struct {
 	bars      map[ProgressType]*mpb.Bar
 	mutex     sync.RWMutex
 	paused    bool
+	pending   map[ProgressType]int // 暂停期间累积的总数增量，恢复时一并应用
 	logger    *zap.Logger
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -192,6 +193,50 @@ func (pm *ProgressManager) CreateConversionProgress(total int) {
 	pm.bars[ProgressTypeConversion] = bar
 }
 
+// AddTotal 增加进度条总数，用于总数在处理过程中才逐步确定的流式处理
+// 暂停期间的增量先排队，Resume 时再应用，避免恢复后总数偏小；进度条不存在时忽略
+func (pm *ProgressManager) AddTotal(progressType ProgressType, delta int) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if bar, exists := pm.bars[progressType]; !exists || bar == nil {
+		return
+	}
+
+	if pm.paused {
+		if pm.pending == nil {
+			pm.pending = make(map[ProgressType]int)
+		}
+		pm.pending[progressType] += delta
+		return
+	}
+
+	pm.applyTotal(progressType, delta)
+}
+
+// applyTotal 把增量计入统计并更新进度条总数，调用方需持有写锁
+func (pm *ProgressManager) applyTotal(progressType ProgressType, delta int) {
+	bar, exists := pm.bars[progressType]
+	if !exists || bar == nil {
+		return
+	}
+
+	var total int
+	switch progressType {
+	case ProgressTypeScan:
+		pm.stats.TotalFound += delta
+		total = pm.stats.TotalFound
+	case ProgressTypeAssessment:
+		pm.stats.TotalToAssess += delta
+		total = pm.stats.TotalToAssess
+	case ProgressTypeConversion:
+		pm.stats.TotalToConvert += delta
+		total = pm.stats.TotalToConvert
+	}
+
+	bar.SetTotal(int64(total), false)
+}
+
 // UpdateProgress 更新进度
 func (pm *ProgressManager) UpdateProgress(progressType ProgressType, increment int) {
 	pm.mutex.RLock()
@@ -320,6 +365,10 @@ func (pm *ProgressManager) Resume() {
 	defer pm.mutex.Unlock()
 
 	pm.paused = false
+	for progressType, delta := range pm.pending {
+		pm.applyTotal(progressType, delta)
+	}
+	pm.pending = nil
 	pm.logger.Debug("进度显示已恢复")
 }
 
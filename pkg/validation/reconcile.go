@@ -0,0 +1,458 @@
+package validation
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/utils"
+
+	"go.uber.org/zap"
+)
+
+// =============================================================================
+// 🔗 源文件与转换输出的等价性核对（pixly reconcile）
+// =============================================================================
+//
+// 中断的运行、跨盘复制和恢复备份之后，目录中可能同时存在 IMG_1.jpg 和 IMG_1.jxl。
+// 核对按状态数据库中的转换记录（来源）和同名文件（基本名）配对源文件与输出，
+// 再验证两者是否等价：JPEG → 无损JXL 通过 djxl 逐位重建原始JPEG，
+// 无损源（PNG等）→ JXL 比较解码后的像素哈希。只有验证等价的源文件才允许删除。
+// 像素哈希只覆盖单帧画面，APNG、多页TIFF等多帧文件一律视为无法验证。
+
+// ReconcileStatus 配对的核对结论
+type ReconcileStatus string
+
+const (
+	ReconcileEquivalent    ReconcileStatus = "equivalent"     // 验证等价，源文件冗余
+	ReconcileNotEquivalent ReconcileStatus = "not_equivalent" // 内容不同，两者都需保留
+	ReconcileUnverified    ReconcileStatus = "unverified"     // 无法验证（有损目标格式、缺少工具等）
+)
+
+// 等价性验证方式
+const (
+	ReconcileMethodJPEGReconstruction = "jpeg_reconstruction"
+	ReconcileMethodPixelHash          = "pixel_hash"
+)
+
+// 配对依据
+const (
+	ReconcileMatchedByProvenance = "provenance" // 状态数据库中记录的转换输出
+	ReconcileMatchedByBasename   = "basename"   // 同目录同名、扩展名不同
+)
+
+// JPEGReconstructionFunc 从JXL重建JPEG并与原始文件逐位比较
+type JPEGReconstructionFunc func(ctx context.Context, jpegPath, jxlPath string) (bool, error)
+
+// ReconcileOptions 核对参数
+type ReconcileOptions struct {
+	TargetFormats []string // 视为转换输出的格式，默认 jxl、avif
+	Delete        bool     // 删除验证等价的源文件
+}
+
+// ReconcilePair 一对源文件与转换输出
+type ReconcilePair struct {
+	Source      string          `json:"source"`
+	Target      string          `json:"target"`
+	MatchedBy   string          `json:"matched_by"`
+	Method      string          `json:"method,omitempty"`
+	Status      ReconcileStatus `json:"status"`
+	Reason      string          `json:"reason,omitempty"`
+	SourceSize  int64           `json:"source_size"`
+	TargetSize  int64           `json:"target_size"`
+	Deleted     bool            `json:"deleted,omitempty"`
+	DeleteError string          `json:"delete_error,omitempty"`
+}
+
+// ReconcileResult 核对结果
+type ReconcileResult struct {
+	Pairs         []ReconcilePair `json:"pairs"`
+	Equivalent    int             `json:"equivalent"`
+	NotEquivalent int             `json:"not_equivalent"`
+	Unverified    int             `json:"unverified"`
+	Deleted       int             `json:"deleted"`
+	FreedBytes    int64           `json:"freed_bytes"`
+}
+
+// Reconciler 源文件与转换输出的等价性核对器
+type Reconciler struct {
+	logger       *zap.Logger
+	validator    *PostProcessingValidator
+	stateManager *state.StateManager
+	verifyJPEG   JPEGReconstructionFunc
+	djxlPath     string
+	ffmpegPath   string
+}
+
+// NewReconciler 创建核对器；verifyJPEG 为 nil 时 JPEG → JXL 配对无法验证
+func NewReconciler(logger *zap.Logger, verifyJPEG JPEGReconstructionFunc) *Reconciler {
+	return &Reconciler{
+		logger:     logger,
+		validator:  NewPostProcessingValidator(logger),
+		verifyJPEG: verifyJPEG,
+		djxlPath:   lookPath("djxl"),
+		ffmpegPath: lookPath("ffmpeg"),
+	}
+}
+
+// SetStateManager 使用状态数据库中的转换记录配对（可选）
+func (r *Reconciler) SetStateManager(stateManager *state.StateManager) {
+	r.stateManager = stateManager
+}
+
+// SetTools 指定解码工具路径（为空时保持PATH中查找到的路径）
+func (r *Reconciler) SetTools(djxlPath, ffmpegPath string) {
+	if djxlPath != "" {
+		r.djxlPath = djxlPath
+	}
+	if ffmpegPath != "" {
+		r.ffmpegPath = ffmpegPath
+	}
+}
+
+// ReconcileDirectory 配对目录中的源文件与转换输出，逐对验证等价性
+func (r *Reconciler) ReconcileDirectory(ctx context.Context, dir string, opts ReconcileOptions) (*ReconcileResult, error) {
+	targetFormats := opts.TargetFormats
+	if len(targetFormats) == 0 {
+		targetFormats = []string{"jxl", "avif"}
+	}
+
+	allFiles, err := r.validator.scanAllFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("扫描文件失败: %w", err)
+	}
+	sort.Strings(allFiles)
+
+	result := &ReconcileResult{}
+	for _, pair := range r.pairFiles(allFiles, targetFormats) {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		r.verifyPair(ctx, &pair)
+		switch pair.Status {
+		case ReconcileEquivalent:
+			result.Equivalent++
+			if opts.Delete {
+				r.deleteSource(&pair)
+				if pair.Deleted {
+					result.Deleted++
+					result.FreedBytes += pair.SourceSize
+				}
+			}
+		case ReconcileNotEquivalent:
+			result.NotEquivalent++
+		default:
+			result.Unverified++
+		}
+		r.logger.Info("核对源文件与转换输出",
+			zap.String("source", pair.Source),
+			zap.String("target", pair.Target),
+			zap.String("matched_by", pair.MatchedBy),
+			zap.String("status", string(pair.Status)),
+			zap.String("reason", pair.Reason))
+		result.Pairs = append(result.Pairs, pair)
+	}
+	return result, nil
+}
+
+// pairFiles 为每个源文件找到对应的转换输出：优先使用状态数据库中记录的输出，其次按同名配对
+func (r *Reconciler) pairFiles(allFiles []string, targetFormats []string) []ReconcilePair {
+	var pairs []ReconcilePair
+	paired := make(map[string]bool)
+
+	for _, format := range targetFormats {
+		processed, _, _, _ := r.validator.analyzeFiles(allFiles, format)
+		for _, source := range processed {
+			if isTargetFormat(source, targetFormats) || paired[source] {
+				continue
+			}
+			target, matchedBy := r.provenanceTarget(source), ReconcileMatchedByProvenance
+			if target == "" {
+				target, matchedBy = r.validator.getTargetPath(source, format), ReconcileMatchedByBasename
+			}
+			paired[source] = true
+			pairs = append(pairs, ReconcilePair{Source: source, Target: target, MatchedBy: matchedBy})
+		}
+	}
+
+	// 来源记录中的输出可能不同名（如冲突时追加序号），按同名未配对的源文件也要检查
+	for _, source := range allFiles {
+		if paired[source] || isTargetFormat(source, targetFormats) || !r.validator.isSupportedSourceFormat(strings.ToLower(filepath.Ext(source))) {
+			continue
+		}
+		if target := r.provenanceTarget(source); target != "" {
+			paired[source] = true
+			pairs = append(pairs, ReconcilePair{Source: source, Target: target, MatchedBy: ReconcileMatchedByProvenance})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Source < pairs[j].Source })
+	return pairs
+}
+
+// provenanceTarget 状态数据库中记录的、仍然存在的转换输出
+func (r *Reconciler) provenanceTarget(source string) string {
+	if r.stateManager == nil {
+		return ""
+	}
+	candidates := []string{}
+	if record, err := r.stateManager.LoadVerification(source); err == nil && record != nil && record.Passed {
+		candidates = append(candidates, record.OutputPath)
+	}
+	if records, err := r.stateManager.LoadDecisions(source); err == nil {
+		for i := len(records) - 1; i >= 0; i-- {
+			if records[i].Stage == types.DecisionStageResult && records[i].Outcome == "success" {
+				if target, ok := records[i].Values["target_path"].(string); ok {
+					candidates = append(candidates, target)
+				}
+				break
+			}
+		}
+	}
+	for _, target := range candidates {
+		if target == "" || target == source {
+			continue
+		}
+		if info, err := os.Stat(target); err == nil && !info.IsDir() {
+			return target
+		}
+	}
+	return ""
+}
+
+// verifyPair 按源格式和目标格式选择验证方式
+func (r *Reconciler) verifyPair(ctx context.Context, pair *ReconcilePair) {
+	if info, err := os.Stat(pair.Source); err == nil {
+		pair.SourceSize = info.Size()
+	}
+	if info, err := os.Stat(pair.Target); err == nil {
+		pair.TargetSize = info.Size()
+	}
+
+	sourceExt := strings.ToLower(filepath.Ext(pair.Source))
+	targetExt := strings.ToLower(filepath.Ext(pair.Target))
+	if targetExt != ".jxl" {
+		pair.Status, pair.Reason = ReconcileUnverified, fmt.Sprintf("%s 为有损格式，无法验证等价", targetExt)
+		return
+	}
+
+	switch {
+	case sourceExt == ".jpg" || sourceExt == ".jpeg":
+		pair.Method = ReconcileMethodJPEGReconstruction
+		if r.verifyJPEG == nil {
+			pair.Status, pair.Reason = ReconcileUnverified, "未配置JPEG重建校验"
+			return
+		}
+		match, err := r.verifyJPEG(ctx, pair.Source, pair.Target)
+		switch {
+		case err != nil:
+			pair.Status, pair.Reason = ReconcileUnverified, err.Error()
+		case match:
+			pair.Status, pair.Reason = ReconcileEquivalent, "JXL可逐位重建原始JPEG"
+		default:
+			pair.Status, pair.Reason = ReconcileNotEquivalent, "重建的JPEG与原始文件不一致"
+		}
+	case losslessSourceExts[sourceExt]:
+		pair.Method = ReconcileMethodPixelHash
+		sourceHash, targetHash, err := r.pixelHashes(ctx, pair.Source, pair.Target)
+		switch {
+		case err != nil:
+			pair.Status, pair.Reason = ReconcileUnverified, err.Error()
+		case sourceHash == targetHash:
+			pair.Status, pair.Reason = ReconcileEquivalent, "解码后像素完全一致"
+		default:
+			pair.Status, pair.Reason = ReconcileNotEquivalent, fmt.Sprintf("解码后像素不一致 (源 %.12s, 输出 %.12s)", sourceHash, targetHash)
+		}
+	default:
+		pair.Status, pair.Reason = ReconcileUnverified, fmt.Sprintf("%s 源文件无法验证等价", sourceExt)
+	}
+}
+
+// losslessSourceExts 可通过解码后像素哈希验证的无损静态源格式
+var losslessSourceExts = map[string]bool{".png": true, ".bmp": true, ".tif": true, ".tiff": true}
+
+// pixelHashes 解码源文件和JXL输出，分别计算像素哈希
+func (r *Reconciler) pixelHashes(ctx context.Context, source, target string) (string, string, error) {
+	if r.djxlPath == "" {
+		return "", "", fmt.Errorf("djxl不可用，无法解码JXL")
+	}
+	tempDir, err := os.MkdirTemp("", "pixly_reconcile_*")
+	if err != nil {
+		return "", "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := requireSingleFrame(source); err != nil {
+		return "", "", fmt.Errorf("源文件%w", err)
+	}
+	sourcePNG := source
+	if strings.ToLower(filepath.Ext(source)) != ".png" {
+		if r.ffmpegPath == "" {
+			return "", "", fmt.Errorf("ffmpeg不可用，无法解码 %s", filepath.Ext(source))
+		}
+		sourcePNG = filepath.Join(tempDir, "source.png")
+		if output, err := exec.CommandContext(ctx, r.ffmpegPath, "-v", "error", "-i", source, "-frames:v", "1", sourcePNG).CombinedOutput(); err != nil {
+			return "", "", fmt.Errorf("ffmpeg解码源文件失败: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	targetPNG := filepath.Join(tempDir, "target.png")
+	if output, err := exec.CommandContext(ctx, r.djxlPath, target, targetPNG).CombinedOutput(); err != nil {
+		return "", "", fmt.Errorf("djxl解码失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	// 动画JXL由djxl解码为APNG
+	if err := requireSingleFrame(targetPNG); err != nil {
+		return "", "", fmt.Errorf("输出%w", err)
+	}
+
+	sourceHash, err := decodedPixelHash(sourcePNG)
+	if err != nil {
+		return "", "", fmt.Errorf("解码源文件失败: %w", err)
+	}
+	targetHash, err := decodedPixelHash(targetPNG)
+	if err != nil {
+		return "", "", fmt.Errorf("解码输出失败: %w", err)
+	}
+	return sourceHash, targetHash, nil
+}
+
+// decodedPixelHash 计算PNG解码后像素的哈希，与反作弊验证使用同一实现
+func decodedPixelHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return "", err
+	}
+	return utils.PixelHash(img), nil
+}
+
+// requireSingleFrame 确认文件只有一帧；多帧或无法判断帧数时返回错误
+func requireSingleFrame(path string) error {
+	frames, err := frameCount(path)
+	if err != nil {
+		return fmt.Errorf("无法读取帧数: %w", err)
+	}
+	if frames > 1 {
+		return fmt.Errorf("包含 %d 帧，像素哈希只能比较单帧画面", frames)
+	}
+	return nil
+}
+
+// frameCount 读取PNG（APNG的acTL块）和TIFF（IFD链）的帧数，其他格式视为单帧
+func frameCount(path string) (int, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		return pngFrameCount(data)
+	case ".tif", ".tiff":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		return tiffPageCount(data)
+	default:
+		return 1, nil
+	}
+}
+
+// pngFrameCount 在图像数据之前查找APNG动画控制块，没有时为单帧
+func pngFrameCount(data []byte) (int, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return 0, fmt.Errorf("不是有效的PNG文件")
+	}
+	for pos := len(signature); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunk := string(data[pos+4 : pos+8])
+		body := data[pos+8:]
+		switch chunk {
+		case "acTL":
+			if len(body) < 4 {
+				return 0, fmt.Errorf("acTL块不完整")
+			}
+			return int(binary.BigEndian.Uint32(body)), nil
+		case "IDAT", "IEND":
+			return 1, nil
+		}
+		pos += 12 + length // 长度 + 类型 + 数据 + CRC
+	}
+	return 0, fmt.Errorf("PNG在图像数据之前结束")
+}
+
+// tiffPageCount 沿IFD链统计TIFF页数（不支持BigTIFF）
+func tiffPageCount(data []byte) (int, error) {
+	if len(data) < 8 {
+		return 0, fmt.Errorf("不是有效的TIFF文件")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("不是有效的TIFF文件")
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return 0, fmt.Errorf("不支持的TIFF版本 %d", order.Uint16(data[2:]))
+	}
+
+	pages := 0
+	visited := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:]); offset != 0; pages++ {
+		if visited[offset] || int(offset)+2 > len(data) {
+			return 0, fmt.Errorf("TIFF目录偏移无效: %d", offset)
+		}
+		visited[offset] = true
+		next := int(offset) + 2 + 12*int(order.Uint16(data[offset:]))
+		if next+4 > len(data) {
+			return 0, fmt.Errorf("TIFF目录不完整")
+		}
+		offset = order.Uint32(data[next:])
+	}
+	return pages, nil
+}
+
+// deleteSource 通过 SafeDelete 删除验证等价的源文件
+func (r *Reconciler) deleteSource(pair *ReconcilePair) {
+	if err := utils.SafeDelete(pair.Source, pair.Target, r.logger.Sugar().Infof); err != nil {
+		pair.DeleteError = err.Error()
+		r.logger.Warn("删除冗余源文件失败", zap.String("source", pair.Source), zap.Error(err))
+		return
+	}
+	pair.Deleted = true
+}
+
+// isTargetFormat 文件是否为转换输出格式
+func isTargetFormat(path string, targetFormats []string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	for _, format := range targetFormats {
+		if ext == strings.TrimPrefix(strings.ToLower(format), ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookPath 在PATH中查找工具，找不到时返回空字符串
+func lookPath(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+// inotifyMask 关注的事件：写入完成、修改、创建、移入，以及目录自身被删除或移走
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// notifyBackend 基于 inotify 的变化检测，递归监视每个子目录
+type notifyBackend struct {
+	logger *zap.Logger
+	root   string
+	file   *os.File // 非阻塞 inotify 描述符，关闭后 Read 立即返回
+	fd     int
+	dirs   map[int32]string // watch 描述符 -> 目录
+}
+
+func newNotifyBackend(logger *zap.Logger, root string) (*notifyBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("初始化 inotify 失败: %w", err)
+	}
+	b := &notifyBackend{
+		logger: logger,
+		root:   root,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dirs:   make(map[int32]string),
+	}
+	if err := b.addWatch(root); err != nil {
+		b.file.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *notifyBackend) name() string {
+	return "inotify"
+}
+
+func (b *notifyBackend) addWatch(dir string) error {
+	wd, err := syscall.InotifyAddWatch(b.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("监视目录 %s 失败: %w", dir, err)
+	}
+	b.dirs[int32(wd)] = dir
+	return nil
+}
+
+// addTree 监视目录及其子目录，并报告其中已有的文件（监视建立前可能已写入）
+func (b *notifyBackend) addTree(ctx context.Context, dir string, events chan<- string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != b.root && strings.HasPrefix(info.Name(), ".pixly_") {
+				return filepath.SkipDir
+			}
+			if err := b.addWatch(path); err != nil {
+				b.logger.Warn("无法监视子目录", zap.String("dir", path), zap.Error(err))
+			}
+			return nil
+		}
+		select {
+		case events <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func (b *notifyBackend) run(ctx context.Context, events chan<- string) error {
+	go func() {
+		<-ctx.Done()
+		b.file.Close()
+	}()
+
+	if err := b.addTree(ctx, b.root, events); err != nil {
+		return nil // 已取消
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("读取 inotify 事件失败: %w", err)
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// 事件队列溢出，重新报告全部文件
+				b.logger.Warn("inotify 事件队列溢出，重新扫描目录")
+				if err := b.addTree(ctx, b.root, events); err != nil {
+					return nil
+				}
+				continue
+			}
+
+			dir, ok := b.dirs[event.Wd]
+			if !ok {
+				continue
+			}
+			if event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0 {
+				delete(b.dirs, event.Wd)
+				if dir == b.root && event.Mask&syscall.IN_IGNORED == 0 {
+					return fmt.Errorf("监视目录已被删除或移走: %s", dir)
+				}
+				continue
+			}
+
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			if name == "" {
+				continue
+			}
+			path := filepath.Join(dir, name)
+
+			if event.Mask&syscall.IN_ISDIR != 0 {
+				// 新建或移入的子目录：建立监视并报告其中已有的文件
+				if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && !strings.HasPrefix(name, ".pixly_") {
+					if err := b.addTree(ctx, path, events); err != nil {
+						return nil
+					}
+				}
+				continue
+			}
+
+			select {
+			case events <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// notifyBackend 非 Linux 平台没有 inotify，监视器使用轮询
+type notifyBackend struct{}
+
+func newNotifyBackend(logger *zap.Logger, root string) (*notifyBackend, error) {
+	return nil, errors.New("当前平台不支持 inotify")
+}
+
+func (b *notifyBackend) name() string {
+	return "inotify"
+}
+
+func (b *notifyBackend) run(ctx context.Context, events chan<- string) error {
+	return nil
+}
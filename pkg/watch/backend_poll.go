@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pollBackend 定期扫描目录，比较大小与修改时间发现新建或修改的文件
+type pollBackend struct {
+	logger   *zap.Logger
+	root     string
+	interval time.Duration
+}
+
+func newPollBackend(logger *zap.Logger, root string, interval time.Duration) *pollBackend {
+	return &pollBackend{logger: logger, root: root, interval: interval}
+}
+
+func (b *pollBackend) name() string {
+	return "polling"
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func (b *pollBackend) run(ctx context.Context, events chan<- string) error {
+	known := make(map[string]fileState)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		seen := make(map[string]fileState, len(known))
+		var changed []string
+		walkFiles(b.root, func(path string, info os.FileInfo) {
+			state := fileState{size: info.Size(), modTime: info.ModTime()}
+			seen[path] = state
+			if previous, ok := known[path]; !ok || previous != state {
+				changed = append(changed, path)
+			}
+		})
+		known = seen
+
+		for _, path := range changed {
+			select {
+			case events <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ProcessFunc 处理一批已稳定的文件
+type ProcessFunc func(ctx context.Context, paths []string) error
+
+// Options 监视选项
+type Options struct {
+	Debounce     time.Duration // 最后一次文件事件后至少等待的时间
+	StableFor    time.Duration // 文件大小与修改时间保持不变的时长，达到后视为写入完成
+	PollInterval time.Duration // 轮询模式的目录扫描间隔
+	ForcePolling bool          // 不使用 inotify，始终轮询
+	Include      []string      // 只处理匹配的文件（为空时处理全部），匹配文件名或相对路径
+	Exclude      []string      // 跳过匹配的文件，优先于 Include
+}
+
+// DefaultOptions 返回默认监视选项
+func DefaultOptions() Options {
+	return Options{
+		Debounce:     2 * time.Second,
+		StableFor:    5 * time.Second,
+		PollInterval: 10 * time.Second,
+	}
+}
+
+// backend 文件变化来源：启动时报告已有文件，之后报告新建或修改的文件
+type backend interface {
+	run(ctx context.Context, events chan<- string) error
+	name() string
+}
+
+// pendingFile 等待写入完成的文件
+type pendingFile struct {
+	lastEvent   time.Time
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+	checked     bool
+}
+
+// Watcher 目录监视器 - 新建或修改的文件在写入完成（大小稳定）后成批交给 ProcessFunc
+//
+// 事件去抖后再检查稳定性：文件在 Debounce 内没有新事件、且 StableFor 内大小和修改时间不变，
+// 才认为相机导入或下载已完成。同一时刻只处理一批，处理期间到达的文件进入下一批。
+type Watcher struct {
+	logger  *zap.Logger
+	root    string
+	opts    Options
+	process ProcessFunc
+	backend backend
+
+	pending map[string]*pendingFile
+}
+
+// New 创建目录监视器，Linux 上使用 inotify，不可用时退回轮询
+func New(logger *zap.Logger, root string, opts Options, process ProcessFunc) (*Watcher, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("解析监视目录失败: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("访问监视目录失败: %w", err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("监视路径不是目录: %s", root)
+	}
+
+	defaults := DefaultOptions()
+	if opts.Debounce < 0 {
+		opts.Debounce = 0
+	}
+	if opts.StableFor <= 0 {
+		opts.StableFor = defaults.StableFor
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的匹配模式 %q: %w", pattern, err)
+		}
+	}
+
+	w := &Watcher{
+		logger:  logger,
+		root:    root,
+		opts:    opts,
+		process: process,
+		pending: make(map[string]*pendingFile),
+	}
+
+	if !opts.ForcePolling {
+		if b, err := newNotifyBackend(logger, root); err == nil {
+			w.backend = b
+		} else {
+			logger.Warn("inotify 不可用，改用轮询", zap.Error(err))
+		}
+	}
+	if w.backend == nil {
+		w.backend = newPollBackend(logger, root, opts.PollInterval)
+	}
+	return w, nil
+}
+
+// Backend 返回使用的变化检测方式（inotify 或 polling）
+func (w *Watcher) Backend() string {
+	return w.backend.name()
+}
+
+// Run 监视目录直到 ctx 取消，等待进行中的批次结束后返回
+func (w *Watcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan string, 256)
+	backendErr := make(chan error, 1)
+	go func() {
+		backendErr <- w.backend.run(ctx, events)
+	}()
+
+	w.logger.Info("开始监视目录",
+		zap.String("dir", w.root),
+		zap.String("backend", w.backend.name()),
+		zap.Duration("debounce", w.opts.Debounce),
+		zap.Duration("stable_for", w.opts.StableFor))
+
+	ticker := time.NewTicker(w.checkInterval())
+	defer ticker.Stop()
+
+	var batchDone chan error
+	for {
+		select {
+		case path := <-events:
+			w.touch(path, time.Now())
+
+		case <-ticker.C:
+			if batchDone != nil {
+				continue
+			}
+			if ready := w.collectReady(time.Now()); len(ready) > 0 {
+				batchDone = make(chan error, 1)
+				go func(done chan<- error) {
+					w.logger.Info("处理新文件", zap.Int("files", len(ready)))
+					done <- w.process(ctx, ready)
+				}(batchDone)
+			}
+
+		case err := <-batchDone:
+			batchDone = nil
+			if err != nil && ctx.Err() == nil {
+				w.logger.Error("处理批次失败", zap.Error(err))
+			}
+
+		case err := <-backendErr:
+			if batchDone != nil {
+				<-batchDone
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("监视目录失败: %w", err)
+
+		case <-ctx.Done():
+			if batchDone != nil {
+				<-batchDone
+			}
+			return nil
+		}
+	}
+}
+
+// checkInterval 稳定性检查间隔，取去抖与稳定时长中较短者的一半
+func (w *Watcher) checkInterval() time.Duration {
+	interval := w.opts.StableFor
+	if w.opts.Debounce > 0 && w.opts.Debounce < interval {
+		interval = w.opts.Debounce
+	}
+	return max(interval/2, 50*time.Millisecond)
+}
+
+// touch 记录文件事件，重置去抖计时
+func (w *Watcher) touch(path string, now time.Time) {
+	if !w.matches(path) {
+		return
+	}
+	if p, ok := w.pending[path]; ok {
+		p.lastEvent = now
+		return
+	}
+	w.pending[path] = &pendingFile{lastEvent: now}
+}
+
+// collectReady 返回已写入完成的文件（按路径排序），并从等待列表移除
+func (w *Watcher) collectReady(now time.Time) []string {
+	var ready []string
+	for path, p := range w.pending {
+		if now.Sub(p.lastEvent) < w.opts.Debounce {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			delete(w.pending, path) // 已删除或被移走
+			continue
+		}
+		if !p.checked || info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+			p.size, p.modTime, p.stableSince, p.checked = info.Size(), info.ModTime(), now, true
+			continue
+		}
+		if now.Sub(p.stableSince) >= w.opts.StableFor {
+			ready = append(ready, path)
+			delete(w.pending, path)
+		}
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+// matches 按 Include/Exclude 过滤，并跳过本程序的备份与临时文件
+func (w *Watcher) matches(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".pixly_") || strings.Contains(name, ".pixly_backup") {
+		return false
+	}
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+
+	matchAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if matchAny(w.opts.Exclude) {
+		return false
+	}
+	return len(w.opts.Include) == 0 || matchAny(w.opts.Include)
+}
+
+// walkFiles 递归列出目录下的文件，跳过本程序生成的 .pixly_ 目录
+func walkFiles(root string, fn func(path string, info os.FileInfo)) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".pixly_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(path, info)
+		return nil
+	})
+}
@@ -1,7 +1,7 @@
 package whitelist
-package whitelist
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 
@@ -29,6 +29,9 @@ type FormatWhitelist struct {
 	
 	// 统计信息
 	whitelistStats          *WhitelistStats
+
+	// 检查结果写入文件的决策轨迹，nil 时只附在检查结果中
+	recorder types.DecisionRecorder
 }
 
 // FormatInfo 格式信息
@@ -113,6 +116,7 @@ type CheckResult struct {
 	SkipReason    *SkipReason      // 跳过原因（如果跳过）
 	TargetFormat  string           // 在指定模式下的目标格式
 	Notes         []string         // 额外说明
+	Decision      types.DecisionRecord // 白名单检查的决策记录
 }
 
 // NewFormatWhitelist 创建格式白名单管理器
@@ -451,8 +455,42 @@ func (fw *FormatWhitelist) initializeTargetFormats() {
 	}
 }
 
-// CheckFile 检查单个文件
+// SetDecisionRecorder 设置决策轨迹记录器（通常为状态数据库），检查结果追加到文件的决策轨迹
+func (fw *FormatWhitelist) SetDecisionRecorder(recorder types.DecisionRecorder) {
+	fw.recorder = recorder
+}
+
+// CheckFile 检查单个文件，检查依据作为决策记录附在结果中并写入决策轨迹
 func (fw *FormatWhitelist) CheckFile(filePath string, mode types.AppMode) *CheckResult {
+	result := fw.checkFile(filePath, mode)
+
+	branch, outcome, thresholds := "supported", "convert", ""
+	if result.SkipReason != nil {
+		branch, thresholds = result.SkipReason.Category.String(), result.SkipReason.Description
+	}
+	if result.ShouldSkip {
+		outcome = "skip"
+	}
+	var mediaType interface{}
+	if result.MediaType != types.MediaTypeUnknown {
+		mediaType = result.MediaType.String()
+	}
+	result.Decision = types.NewDecisionRecord(types.DecisionStageWhitelist, branch, outcome, map[string]interface{}{
+		"ext":        strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), ".")),
+		"mode":       mode.String(),
+		"media_type": mediaType,
+	}, thresholds)
+
+	if fw.recorder != nil {
+		if err := fw.recorder.AppendDecisions(filePath, result.Decision); err != nil {
+			fw.logger.Debug("追加决策轨迹失败", zap.String("file_path", filePath), zap.Error(err))
+		}
+	}
+	return result
+}
+
+// checkFile 按隐藏文件、目标格式、跳过规则、支持格式的顺序检查单个文件
+func (fw *FormatWhitelist) checkFile(filePath string, mode types.AppMode) *CheckResult {
 	fw.whitelistStats.TotalFilesChecked++
 	
 	result := &CheckResult{
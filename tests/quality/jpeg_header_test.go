@@ -0,0 +1,130 @@
+package quality
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine/quality"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// encodeTestJpeg 使用标准库编码测试JPEG（标准库使用libjpeg标准表的缩放结果）
+func encodeTestJpeg(t *testing.T, img image.Image, q int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}))
+	return buf.Bytes()
+}
+
+func gradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	return img
+}
+
+// insertSegments 在SOI之后插入APP段
+func insertSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func appSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifWithSoftware 构造只包含IFD0 Software字段的EXIF段
+func exifWithSoftware(software string) []byte {
+	value := append([]byte(software), 0)
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0131)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(len(value)))
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8+2+12+4)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, value...)
+	return appSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// TestParseJpegHeader_Quality 测试量化表还原libjpeg品质因子
+func TestParseJpegHeader_Quality(t *testing.T) {
+	img := gradientImage(64, 48)
+
+	for _, q := range []int{10, 35, 50, 75, 85, 92, 100} {
+		header, err := quality.ParseJpegHeader(bytes.NewReader(encodeTestJpeg(t, img, q)))
+		require.NoError(t, err)
+
+		assert.Equal(t, q, header.EstimatedQuality, "quality %d", q)
+		assert.True(t, header.StandardTables, "quality %d", q)
+		assert.Zero(t, header.TableDeviation)
+		assert.Equal(t, 64, header.Width)
+		assert.Equal(t, 48, header.Height)
+		assert.Equal(t, 3, header.Components)
+		assert.Equal(t, "4:2:0", header.Subsampling)
+		assert.False(t, header.LikelyResaved)
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	header, err := quality.ParseJpegHeader(bytes.NewReader(encodeTestJpeg(t, gray, 60)))
+	require.NoError(t, err)
+	assert.Equal(t, 60, header.EstimatedQuality)
+	assert.Equal(t, "gray", header.Subsampling)
+
+	_, err = quality.ParseJpegHeader(bytes.NewReader([]byte("not a jpeg")))
+	assert.Error(t, err)
+}
+
+// TestParseJpegHeader_ResaveSignals 测试编辑软件与Adobe段的多次保存判定
+func TestParseJpegHeader_ResaveSignals(t *testing.T) {
+	data := encodeTestJpeg(t, gradientImage(32, 32), 90)
+	data = insertSegments(data,
+		exifWithSoftware("Adobe Photoshop 25.0"),
+		appSegment(0xED, []byte("Photoshop 3.0\x00")))
+
+	header, err := quality.ParseJpegHeader(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 90, header.EstimatedQuality)
+	assert.True(t, header.HasExif)
+	assert.Equal(t, "Adobe Photoshop 25.0", header.Software)
+	assert.True(t, header.LikelyResaved)
+	assert.Len(t, header.ResaveSignals, 2)
+
+	assert.Equal(t, types.QualityVeryHigh, quality.ClassifyJpegQuality(header.EstimatedQuality, false))
+	assert.Equal(t, types.QualityHigh, quality.ClassifyJpegQuality(header.EstimatedQuality, true))
+	assert.Equal(t, types.QualityVeryLow, quality.ClassifyJpegQuality(20, true))
+}
+
+// TestQualityEngine_JpegHeader 测试品质引擎使用量化表估算结果
+func TestQualityEngine_JpegHeader(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	require.NoError(t, os.WriteFile(path, encodeTestJpeg(t, gradientImage(64, 64), 40), 0644))
+
+	engine := quality.NewQualityEngine(logger, "", "", true)
+	assessment, err := engine.AssessFile(context.Background(), path)
+	require.NoError(t, err)
+
+	assert.Equal(t, 40, assessment.JpegQuality)
+	assert.Equal(t, "4:2:0", assessment.JpegSubsampling)
+	assert.Equal(t, 64, assessment.Width)
+	assert.Equal(t, types.QualityLow, assessment.QualityLevel)
+}
@@ -0,0 +1,115 @@
+package quality
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// qualityEchoEncoder 假cjxl：拒绝无损任务，有损任务把质量写入输出文件
+type qualityEchoEncoder struct{}
+
+func (qualityEchoEncoder) Name() string               { return engine.EncoderCjxl }
+func (qualityEchoEncoder) SupportedInputs() []string  { return []string{"*"} }
+func (qualityEchoEncoder) SupportedOutputs() []string { return []string{"jxl"} }
+func (qualityEchoEncoder) Probe() bool                { return true }
+
+func (qualityEchoEncoder) Encode(ctx context.Context, job *engine.EncodeJob) (*engine.EncodeResult, error) {
+	if job.Lossless || job.LosslessJPEG {
+		return nil, fmt.Errorf("lossless not supported by fake")
+	}
+	data := []byte(fmt.Sprintf("q=%d", job.Quality))
+	if err := os.WriteFile(job.TargetPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return &engine.EncodeResult{Encoder: "fake", OutputPath: job.TargetPath, OutputSize: int64(len(data))}, nil
+}
+
+// qualityEchoScorer 假指标：分数等于编码质量
+type qualityEchoScorer struct{}
+
+func (qualityEchoScorer) Available(metric engine.PerceptualMetric) bool { return true }
+
+func (qualityEchoScorer) Score(ctx context.Context, metric engine.PerceptualMetric, reference, distorted string) (float64, error) {
+	data, err := os.ReadFile(distorted)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimPrefix(string(data), "q="), 64)
+}
+
+// TestTargetQualitySearch 测试二分搜索选出达到目标的最低质量
+func TestTargetQualitySearch(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "photo.png")
+	require.NoError(t, os.WriteFile(source, make([]byte, 4096), 0644))
+
+	registry := engine.NewEncoderRegistry()
+	registry.Register(qualityEchoEncoder{})
+
+	optimizer := engine.NewBalanceOptimizer(logger, types.ToolCheckResults{}, dir)
+	optimizer.SetEncoderRegistry(registry)
+	optimizer.SetPerceptualScorer(qualityEchoScorer{})
+	optimizer.SetTargetQuality(&engine.TargetQuality{Metric: engine.MetricSSIMULACRA2, Target: 80})
+
+	result, err := optimizer.OptimizeFile(context.Background(), source, types.MediaTypeImage)
+	require.NoError(t, err)
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, 80, result.ChosenQuality)
+	assert.Equal(t, 80.0, result.MetricScore)
+	assert.Equal(t, "ssimulacra2", result.Metric)
+	assert.Equal(t, "target_quality_jxl", result.Method)
+	assert.LessOrEqual(t, result.Probes, 8)
+	assert.Greater(t, result.Probes, 1)
+}
+
+// TestTargetQualitySearch_Unreachable 测试目标无法达到时保留原文件
+func TestTargetQualitySearch_Unreachable(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "photo.png")
+	require.NoError(t, os.WriteFile(source, make([]byte, 4096), 0644))
+
+	registry := engine.NewEncoderRegistry()
+	registry.Register(qualityEchoEncoder{})
+
+	optimizer := engine.NewBalanceOptimizer(logger, types.ToolCheckResults{}, dir)
+	optimizer.SetEncoderRegistry(registry)
+	optimizer.SetPerceptualScorer(qualityEchoScorer{})
+	optimizer.SetTargetQuality(&engine.TargetQuality{Metric: engine.MetricButteraugli, Target: 1.5})
+
+	result, err := optimizer.OptimizeFile(context.Background(), source, types.MediaTypeImage)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Error(t, result.Error)
+	assert.Equal(t, "butteraugli", result.Metric)
+}
+
+// TestPerceptualMetricDirection 测试指标方向判断
+func TestPerceptualMetricDirection(t *testing.T) {
+	assert.True(t, engine.MetricSSIMULACRA2.Meets(85, 80))
+	assert.False(t, engine.MetricSSIMULACRA2.Meets(79.9, 80))
+	assert.True(t, engine.MetricButteraugli.Meets(1.2, 1.5))
+	assert.False(t, engine.MetricButteraugli.Meets(1.6, 1.5))
+	assert.True(t, engine.MetricSSIM.Meets(0.985, 0.98))
+
+	metric, err := engine.ParsePerceptualMetric("SSIMULACRA2")
+	require.NoError(t, err)
+	assert.Equal(t, engine.MetricSSIMULACRA2, metric)
+
+	_, err = engine.ParsePerceptualMetric("vmaf")
+	assert.Error(t, err)
+}
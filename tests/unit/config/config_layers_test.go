@@ -0,0 +1,185 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layerDirs 创建系统、用户与项目目录
+func layerDirs(t *testing.T) (systemDir, userDir, projectDir string) {
+	root := t.TempDir()
+	systemDir = filepath.Join(root, "etc")
+	userDir = filepath.Join(root, "home")
+	projectDir = filepath.Join(root, "photos")
+	for _, dir := range []string{systemDir, userDir, projectDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	return systemDir, userDir, projectDir
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func parseFlags(t *testing.T, args ...string) *config.FlagOverrides {
+	fs := flag.NewFlagSet("pixly", flag.ContinueOnError)
+	overrides := config.RegisterFlags(fs)
+	require.NoError(t, fs.Parse(args))
+	return overrides
+}
+
+func TestConfigLayerPrecedence(t *testing.T) {
+	systemDir, userDir, projectDir := layerDirs(t)
+	writeConfigFile(t, filepath.Join(systemDir, "config.yaml"),
+		"crf: 20\nmax_retries: 1\njxl_effort: 5\nlog_level: warn\n")
+	writeConfigFile(t, filepath.Join(userDir, "config.json"),
+		`{"crf": 22, "max_retries": 3, "target_dir": "`+projectDir+`"}`)
+	writeConfigFile(t, filepath.Join(projectDir, ".pixly.yaml"), "crf: 24\navif_speed: 4\n")
+
+	cfg, err := config.Load(config.LoadOptions{
+		SystemDir: systemDir,
+		UserDir:   userDir,
+		Env:       []string{"PIXLY_AVIF_SPEED=8", "PIXLY_DRY_RUN=true", "PIXLY_LAUNCHED_BY=launcher", "HOME=/root"},
+		Flags:     parseFlags(t, "--avif-speed", "9", "--overwrite"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, 5, cfg.JXLEffort)
+	assert.Equal(t, 3, cfg.MaxRetries)
+	assert.Equal(t, 24, cfg.CRF)
+	assert.Equal(t, 9, cfg.AVIFSpeed)
+	assert.True(t, cfg.DryRun)
+	assert.True(t, cfg.Overwrite)
+	assert.Equal(t, projectDir, cfg.TargetDir)
+
+	assert.Equal(t, config.LayerSystem, cfg.SourceOf("jxl_effort").Layer)
+	assert.Equal(t, config.LayerUser, cfg.SourceOf("max_retries").Layer)
+	assert.Equal(t, config.Source{Layer: config.LayerProject, Location: filepath.Join(projectDir, ".pixly.yaml")}, cfg.SourceOf("crf"))
+	assert.Equal(t, config.Source{Layer: config.LayerEnv, Location: "PIXLY_DRY_RUN"}, cfg.SourceOf("dry_run"))
+	assert.Equal(t, config.Source{Layer: config.LayerFlag, Location: "--avif-speed"}, cfg.SourceOf("avif_speed"))
+	assert.Equal(t, config.LayerDefault, cfg.SourceOf("mode").Layer)
+}
+
+func TestConfigProfiles(t *testing.T) {
+	systemDir, userDir, projectDir := layerDirs(t)
+	writeConfigFile(t, filepath.Join(userDir, "config.yaml"), `
+profile: archive
+jxl_effort: 6
+profiles:
+  web:
+    target_score: 80
+  thumbnails:
+    mode: auto+
+    crf: 35
+`)
+
+	t.Run("file_selects_builtin_profile", func(t *testing.T) {
+		cfg, err := config.Load(config.LoadOptions{SystemDir: systemDir, UserDir: userDir, Env: []string{}})
+		require.NoError(t, err)
+		assert.Equal(t, "archive", cfg.ActiveProfile())
+		assert.Equal(t, "quality", cfg.Mode)
+		assert.Equal(t, 9, cfg.JXLEffort, "配置档覆盖文件顶层设置")
+		assert.True(t, cfg.KeepBackups)
+		assert.Equal(t, config.Source{Layer: config.LayerProfile, Location: "archive"}, cfg.SourceOf("jxl_effort"))
+	})
+
+	t.Run("flag_overrides_env_profile", func(t *testing.T) {
+		cfg, err := config.Load(config.LoadOptions{
+			SystemDir: systemDir,
+			UserDir:   userDir,
+			Env:       []string{"PIXLY_PROFILE=sticker"},
+			Flags:     parseFlags(t, "--profile", "web"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "web", cfg.ActiveProfile())
+		assert.Equal(t, "ssimulacra2", cfg.TargetMetric)
+		assert.Equal(t, 80.0, cfg.TargetScore, "文件中的同名段覆盖内置配置档")
+		assert.Equal(t, "transcode", cfg.VideoMode)
+	})
+
+	t.Run("env_overrides_profile", func(t *testing.T) {
+		cfg, err := config.Load(config.LoadOptions{
+			SystemDir: systemDir,
+			UserDir:   userDir,
+			Env:       []string{"PIXLY_PROFILE=thumbnails", "PIXLY_CRF=30"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "thumbnails", cfg.ActiveProfile())
+		assert.Equal(t, 30, cfg.CRF)
+		assert.Equal(t, config.LayerEnv, cfg.SourceOf("crf").Layer)
+	})
+
+	t.Run("unknown_profile", func(t *testing.T) {
+		_, err := config.Load(config.LoadOptions{
+			SystemDir: systemDir,
+			UserDir:   projectDir,
+			Env:       []string{},
+			Flags:     parseFlags(t, "--profile", "missing"),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing")
+		assert.Contains(t, err.Error(), "archive, sticker, web")
+	})
+}
+
+func TestConfigLoadErrors(t *testing.T) {
+	systemDir, userDir, _ := layerDirs(t)
+
+	writeConfigFile(t, filepath.Join(userDir, "config.yaml"), "crf: 20\nunknown_key: 1\n")
+	_, err := config.Load(config.LoadOptions{SystemDir: systemDir, UserDir: userDir, Env: []string{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown_key")
+	assert.Contains(t, err.Error(), filepath.Join(userDir, "config.yaml"))
+
+	writeConfigFile(t, filepath.Join(userDir, "config.yaml"), "crf: high\n")
+	_, err = config.Load(config.LoadOptions{SystemDir: systemDir, UserDir: userDir, Env: []string{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "crf")
+
+	_, err = config.Load(config.LoadOptions{SystemDir: systemDir, UserDir: systemDir, Env: []string{"PIXLY_CONCURRENT_JOBS=many"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PIXLY_CONCURRENT_JOBS")
+}
+
+func TestValidateAndNormalizeReportsLayer(t *testing.T) {
+	systemDir, userDir, projectDir := layerDirs(t)
+	writeConfigFile(t, filepath.Join(userDir, "config.yaml"), "crf: 70\nmax_workers: 0\n")
+
+	cfg, err := config.Load(config.LoadOptions{
+		SystemDir: systemDir,
+		UserDir:   userDir,
+		Env:       []string{"PIXLY_JXL_EFFORT=12"},
+		Flags:     parseFlags(t, "--mode", "fast", projectDir),
+	})
+	require.NoError(t, err)
+
+	err = config.ValidateAndNormalize(cfg)
+	require.Error(t, err)
+
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	sources := make(map[string]config.Source)
+	for _, fieldErr := range validationErr.Errors {
+		sources[fieldErr.Key] = fieldErr.Source
+	}
+	assert.Len(t, sources, 3, "零值视为自动，由标准化填充")
+	assert.Equal(t, config.LayerUser, sources["crf"].Layer)
+	assert.Equal(t, config.Source{Layer: config.LayerEnv, Location: "PIXLY_JXL_EFFORT"}, sources["jxl_effort"])
+	assert.Equal(t, config.Source{Layer: config.LayerFlag, Location: "--mode"}, sources["mode"])
+	assert.Contains(t, err.Error(), "无效的CRF值: 70")
+	assert.Contains(t, err.Error(), "来源: env PIXLY_JXL_EFFORT")
+
+	// 未经分层加载的配置保持原有行为：先标准化再验证
+	legacy := &config.Config{CRF: 70, JXLEffort: 12, MaxRetries: -1}
+	require.NoError(t, config.ValidateAndNormalize(legacy))
+	assert.Equal(t, 28, legacy.CRF)
+}
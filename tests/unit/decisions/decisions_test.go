@@ -0,0 +1,272 @@
+package decisions_test
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pixly/pkg/batchdecision"
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/engine/quality"
+	"pixly/pkg/whitelist"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeProbe 假ffprobe：输出一个 64x64 的静态图像流
+const fakeProbe = `#!/bin/sh
+echo '{"streams": [{"codec_name": "mjpeg", "width": 64, "height": 64}], "format": {"format_name": "image2"}}'
+`
+
+func openState(t *testing.T) *state.StateManager {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+	return sm
+}
+
+func writeJPEG(t *testing.T, path string, quality int) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, 64, 64)), &jpeg.Options{Quality: quality}))
+}
+
+// stages 返回轨迹中各记录的阶段
+func stages(records []types.DecisionRecord) []string {
+	result := make([]string, len(records))
+	for i, record := range records {
+		result[i] = record.Stage
+	}
+	return result
+}
+
+// TestStateManager_DecisionTrace 测试决策轨迹的保存、追加和替换
+func TestStateManager_DecisionTrace(t *testing.T) {
+	sm := openState(t)
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+
+	records, err := sm.LoadDecisions(path)
+	require.NoError(t, err)
+	assert.Nil(t, records)
+	file, err := sm.LoadMediaFile(path)
+	require.NoError(t, err)
+	assert.Nil(t, file)
+
+	// 从队列恢复时文件可能没有评估阶段的轨迹，追加时新建
+	require.NoError(t, sm.AppendDecisions(path, types.DecisionRecord{Stage: types.DecisionStageResult, Outcome: "failed"}))
+	require.NoError(t, sm.SaveDecisions(path, []types.DecisionRecord{
+		{Stage: types.DecisionStageAssessment, Branch: quality.ClassifiedByJpegQuality, Outcome: "高品质",
+			Values: map[string]interface{}{"jpeg_quality": 88}, Thresholds: quality.JpegQualityThresholds},
+	}))
+	require.NoError(t, sm.AppendDecisions(path,
+		types.DecisionRecord{Stage: types.DecisionStageConversion, Branch: "平衡优化", Outcome: "lossless_repack"},
+		types.DecisionRecord{Stage: types.DecisionStageResult, Branch: "success", Outcome: "success"}))
+
+	records, err = sm.LoadDecisions(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{types.DecisionStageAssessment, types.DecisionStageConversion, types.DecisionStageResult}, stages(records),
+		"新一轮评估替换旧轨迹，之后的记录按顺序追加")
+	assert.EqualValues(t, 88, records[0].Values["jpeg_quality"])
+	assert.Equal(t, quality.JpegQualityThresholds, records[0].Thresholds)
+
+	require.NoError(t, sm.ClearSession())
+	records, err = sm.LoadDecisions(path)
+	require.NoError(t, err)
+	assert.Len(t, records, 3, "ClearSession 不清除决策轨迹")
+}
+
+// TestEngine_RecordsDecisionTrace 测试流式管道为每个文件记录评估、格式选择和结果
+func TestEngine_RecordsDecisionTrace(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "photo.jpg")
+	writeJPEG(t, source, 90)
+	optimal := filepath.Join(dir, "done.jxl")
+	require.NoError(t, os.WriteFile(optimal, make([]byte, 2000), 0644))
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = dir
+	cfg.DryRun = true
+	cfg.Mode = "quality"
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	probe := filepath.Join(t.TempDir(), "ffprobe")
+	require.NoError(t, os.WriteFile(probe, []byte(fakeProbe), 0755))
+
+	tools := types.ToolCheckResults{HasFfmpeg: true, FfmpegStablePath: probe}
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, tools, nil)
+	conversionEngine.SetStateManager(sm)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, conversionEngine.Execute(ctx))
+
+	records, err := sm.LoadDecisions(source)
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	assert.Equal(t, []string{
+		types.DecisionStageAssessment,
+		types.DecisionStageRecommendation,
+		types.DecisionStageOptimalFormat,
+		types.DecisionStageMode,
+		types.DecisionStageResult,
+	}, stages(records))
+
+	assessment := records[0]
+	assert.Equal(t, quality.ClassifiedByJpegQuality, assessment.Branch)
+	assert.Equal(t, quality.JpegQualityThresholds, assessment.Thresholds)
+	assert.EqualValues(t, 90, assessment.Values["jpeg_quality"])
+	assert.Equal(t, types.QualityVeryHigh.String(), assessment.Outcome)
+	assert.Equal(t, false, assessment.Values["jpeg_resaved"], "测量到的零值同样记录")
+	assert.Equal(t, false, assessment.Values["from_index"])
+
+	recommendation := records[1]
+	assert.Equal(t, quality.RecommendedByHighQuality, recommendation.Branch)
+	assert.Equal(t, types.ModeQuality.String(), recommendation.Outcome)
+	assert.Equal(t, quality.ModeRecommendationThresholds, recommendation.Thresholds)
+
+	assert.Equal(t, "continue", records[2].Outcome)
+	assert.Equal(t, "jxl_lossless", records[3].Outcome)
+	assert.Equal(t, "success", records[4].Outcome)
+	assert.Equal(t, "模拟转换完成", records[4].Values["message"])
+	assert.NotContains(t, records[4].Values, "target_path", "模拟转换没有输出文件")
+
+	// 已是最优格式的文件记录命中的检查规则
+	records, err = sm.LoadDecisions(optimal)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(records), 3)
+	assert.Equal(t, types.DecisionStageOptimalFormat, records[2].Stage)
+	assert.Equal(t, "skip", records[2].Outcome)
+	assert.Equal(t, "quality 图片的最优格式为 .jxl", records[2].Branch)
+	assert.Equal(t, "skipped", records[len(records)-1].Outcome)
+}
+
+// TestAutoPlusRouter_TraceRecordsRuleMatch 测试自动模式+路由记录内置路由和规则匹配的依据
+func TestAutoPlusRouter_TraceRecordsRuleMatch(t *testing.T) {
+	rules, err := engine.ParseRoutingRules([]byte(`{"rules": [
+	  {"name": "small-jpeg", "match": {"extensions": ["jpg"], "max_width": 100}, "action": {"type": "keep"}}
+	]}`))
+	require.NoError(t, err)
+	logger := zaptest.NewLogger(t)
+	router := engine.NewAutoPlusRouter(logger, quality.NewQualityEngine(logger, "", "", true), nil, nil, types.ToolCheckResults{}, false)
+	router.SetRoutingRules(rules)
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "photo.jpg")
+	writeJPEG(t, source, 75)
+
+	decision := router.RouteFile(context.Background(), source)
+	require.Len(t, decision.Trace, 2)
+
+	builtin := decision.Trace[0]
+	assert.Equal(t, types.DecisionStageRouting, builtin.Stage)
+	assert.Equal(t, "fast_routing_jpeg", builtin.Branch)
+	assert.Equal(t, "convert → jxl", builtin.Outcome)
+	assert.EqualValues(t, 75, builtin.Values["jpeg_quality"])
+	assert.Equal(t, quality.JpegQualityThresholds, builtin.Thresholds)
+
+	rule := decision.Trace[1]
+	assert.Equal(t, types.DecisionStageRoutingRule, rule.Stage)
+	assert.Equal(t, "small-jpeg", rule.Branch)
+	assert.Equal(t, "keep", rule.Outcome)
+	assert.Equal(t, ".jpg", rule.Values["ext"])
+	assert.EqualValues(t, 64, rule.Values["width"])
+}
+
+// TestNewDecisionRecord_KeepsMeasuredZeros 测试决策记录只去掉未测量（nil）的值，测量到的零值保留
+func TestNewDecisionRecord_KeepsMeasuredZeros(t *testing.T) {
+	record := types.NewDecisionRecord(types.DecisionStageAssessment, "score", "low", map[string]interface{}{
+		"score":      0.0,
+		"file_size":  int64(0),
+		"resaved":    false,
+		"format":     "",
+		"unmeasured": nil,
+	}, "")
+	assert.Equal(t, map[string]interface{}{"score": 0.0, "file_size": int64(0), "resaved": false, "format": ""}, record.Values)
+
+	record = types.NewDecisionRecord(types.DecisionStageResult, "success", "success", map[string]interface{}{"target_path": nil}, "")
+	assert.Nil(t, record.Values, "没有测量值时不保存空表")
+}
+
+// TestFormatWhitelist_CheckFileRecordsDecision 测试白名单检查的依据写入文件的决策轨迹
+func TestFormatWhitelist_CheckFileRecordsDecision(t *testing.T) {
+	sm := openState(t)
+	fw := whitelist.NewFormatWhitelist(zaptest.NewLogger(t))
+	fw.SetDecisionRecorder(sm)
+
+	// 白名单按路径判断系统目录（/tmp/ 等），用相对路径检查普通文件；目录名唯一，避免与其他测试的轨迹混在一起
+	dir := filepath.Base(t.TempDir())
+	tests := []struct {
+		name    string
+		path    string
+		branch  string
+		outcome string
+	}{
+		{"支持的格式", filepath.Join(dir, "photo.png"), "supported", "convert"},
+		{"隐藏文件", filepath.Join(dir, ".hidden.png"), whitelist.SkipSystemHidden.String(), "skip"},
+		{"已是目标格式", filepath.Join(dir, "photo.jxl"), whitelist.SkipTargetFormat.String(), "skip"},
+		{"未知格式", filepath.Join(dir, "notes.xyz"), whitelist.SkipUnsupported.String(), "skip"},
+		{"系统目录", filepath.Join("/tmp", dir, "photo.png"), whitelist.SkipSystemHidden.String(), "skip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fw.CheckFile(tt.path, types.ModeQuality)
+			assert.Equal(t, types.DecisionStageWhitelist, result.Decision.Stage)
+			assert.Equal(t, tt.branch, result.Decision.Branch)
+			assert.Equal(t, tt.outcome, result.Decision.Outcome)
+			assert.Equal(t, types.ModeQuality.String(), result.Decision.Values["mode"])
+			if result.SkipReason != nil {
+				assert.Equal(t, result.SkipReason.Description, result.Decision.Thresholds)
+			}
+
+			records, err := sm.LoadDecisions(tt.path)
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, tt.branch, records[0].Branch)
+			assert.Equal(t, tt.outcome, records[0].Outcome)
+		})
+	}
+}
+
+// TestBatchDecisionManager_RecordsFileDecisions 测试批量决策为每个文件记录选择、是否默认选项和测量值
+func TestBatchDecisionManager_RecordsFileDecisions(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	corrupted := filepath.Join(dir, "broken.jpg")
+	lowQuality := filepath.Join(dir, "tiny.jpg")
+	require.NoError(t, os.WriteFile(corrupted, []byte("not a jpeg"), 0644))
+
+	manager := batchdecision.NewBatchDecisionManager(zaptest.NewLogger(t), false)
+	manager.SetDecisionRecorder(sm)
+	manager.AddCorruptedFile(corrupted, batchdecision.CorruptionFileHeader, "缺少SOI标记", false)
+	require.NoError(t, manager.AddLowQualityFile(&batchdecision.LowQualityFile{FilePath: lowQuality, QualityScore: 0}))
+
+	_, err := manager.ProcessBatchDecisions(context.Background())
+	require.NoError(t, err)
+
+	records, err := sm.LoadDecisions(corrupted)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, types.DecisionStageBatch, records[0].Stage)
+	assert.Equal(t, batchdecision.DecisionTypeCorruptedFiles.String(), records[0].Branch)
+	assert.Equal(t, batchdecision.CorruptedChoiceIgnore.String(), records[0].Outcome)
+	assert.Equal(t, true, records[0].Values["is_default"])
+	assert.Equal(t, "file_header", records[0].Values["corruption_type"])
+	assert.Equal(t, false, records[0].Values["can_repair"])
+	assert.Contains(t, records[0].Thresholds, batchdecision.CorruptedChoiceIgnore.String())
+
+	records, err = sm.LoadDecisions(lowQuality)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, batchdecision.LowQualityChoiceSkip.String(), records[0].Outcome)
+	assert.EqualValues(t, 0, records[0].Values["quality_score"], "测量到的零分同样记录")
+}
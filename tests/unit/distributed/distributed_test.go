@@ -0,0 +1,244 @@
+package distributed_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/distributed"
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func openState(t *testing.T) *state.StateManager {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+	return sm
+}
+
+// writeSources 创建源文件，返回路径
+func writeSources(t *testing.T, dir string, count int) []string {
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("photo%d.png", i))
+		require.NoError(t, os.WriteFile(paths[i], []byte(fmt.Sprintf("image %d", i)), 0644))
+	}
+	return paths
+}
+
+// planFor 返回把每个源文件作为一个单元写入队列的规划函数
+func planFor(sm *state.StateManager, paths []string) func(context.Context) error {
+	return planFormat(sm, paths, "jxl")
+}
+
+// planFormat 同 planFor，任务使用指定的目标格式
+func planFormat(sm *state.StateManager, paths []string, format string) func(context.Context) error {
+	return func(context.Context) error {
+		for _, path := range paths {
+			payload, err := json.Marshal(engine.QueuedUnit{Tasks: []engine.ConversionTask{{SourcePath: path, TargetFormat: format, Mode: "quality", MediaType: "image"}}})
+			if err != nil {
+				return err
+			}
+			if err := sm.EnqueueJob(&state.QueueEntry{Path: path, Members: []string{path}, Payload: payload}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// fakeConvert 在源文件旁写入 .jxl 输出，内容为源文件内容加后缀
+func fakeConvert(_ context.Context, unit engine.QueuedUnit) []engine.ConversionResult {
+	results := make([]engine.ConversionResult, 0, len(unit.Tasks))
+	for _, task := range unit.Tasks {
+		result := engine.ConversionResult{SourcePath: task.SourcePath, Status: "success"}
+		data, err := os.ReadFile(task.SourcePath)
+		if err == nil {
+			result.TargetPath = strings.TrimSuffix(task.SourcePath, filepath.Ext(task.SourcePath)) + ".jxl"
+			err = os.WriteFile(result.TargetPath, append(data, []byte(" as jxl")...), 0644)
+		}
+		if err != nil {
+			result.Status, result.Message = "failed", err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// startCoordinator 启动协调节点，返回地址和等待 Run 结束的函数
+func startCoordinator(t *testing.T, sm *state.StateManager, dir string, opts distributed.CoordinatorOptions, plan func(context.Context) error) (*distributed.Coordinator, string, func() distributed.Status) {
+	coordinator := distributed.NewCoordinator(zaptest.NewLogger(t), sm, dir, opts)
+	server := httptest.NewServer(coordinator.Handler())
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	type outcome struct {
+		status distributed.Status
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		status, err := coordinator.Run(ctx, plan)
+		done <- outcome{status, err}
+	}()
+	return coordinator, server.URL, func() distributed.Status {
+		result := <-done
+		require.NoError(t, result.err)
+		return result.status
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestDistributed_WorkersConvertAllUnits 测试多个工作节点（流式传输和共享文件系统）共同完成全部单元
+func TestDistributed_WorkersConvertAllUnits(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	sources := writeSources(t, dir, 6)
+	_, url, wait := startCoordinator(t, sm, dir, distributed.CoordinatorOptions{}, planFor(sm, sources))
+
+	var wg sync.WaitGroup
+	for i, shared := range []bool{false, false, true} {
+		worker := distributed.NewWorker(zaptest.NewLogger(t), distributed.WorkerOptions{
+			Coordinator:  url,
+			Name:         fmt.Sprintf("worker-%d", i),
+			SharedFS:     shared,
+			Jobs:         2,
+			WorkDir:      t.TempDir(),
+			PollInterval: 10 * time.Millisecond,
+		}, fakeConvert)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, worker.Run(context.Background()))
+		}()
+	}
+	wg.Wait()
+
+	status := wait()
+	assert.Equal(t, len(sources), status.Completed)
+	assert.Zero(t, status.Failed)
+	assert.True(t, status.Done)
+
+	for i, source := range sources {
+		data, err := os.ReadFile(strings.TrimSuffix(source, ".png") + ".jxl")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("image %d as jxl", i), string(data))
+	}
+	entries, err := sm.ListQueue(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	leftovers, err := filepath.Glob(filepath.Join(dir, ".pixly_upload_*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers, "临时上传文件已清理")
+}
+
+// TestCoordinator_ReassignsExpiredLease 测试工作节点停止心跳后租约过期，单元交给其他工作节点
+func TestCoordinator_ReassignsExpiredLease(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	sources := writeSources(t, dir, 1)
+	opts := distributed.CoordinatorOptions{LeaseTTL: 100 * time.Millisecond, ReapInterval: 10 * time.Millisecond}
+	coordinator, url, wait := startCoordinator(t, sm, dir, opts, planFor(sm, sources))
+
+	// 租到单元后“崩溃”：不发送心跳也不提交
+	var lease distributed.Lease
+	require.Eventually(t, func() bool {
+		resp, err := http.Post(url+"/leases", "application/json", strings.NewReader(`{"worker":"crashed"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&lease))
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, sources, lease.Members)
+
+	require.Eventually(t, func() bool { return coordinator.Status().Reassigned == 1 }, 5*time.Second, 10*time.Millisecond)
+	resp, err := http.Post(url+"/leases/"+lease.ID+"/heartbeat", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode, "过期租约不能续约")
+
+	worker := distributed.NewWorker(zaptest.NewLogger(t), distributed.WorkerOptions{
+		Coordinator:  url,
+		WorkDir:      t.TempDir(),
+		PollInterval: 10 * time.Millisecond,
+	}, fakeConvert)
+	require.NoError(t, worker.Run(context.Background()))
+
+	status := wait()
+	assert.Equal(t, 1, status.Completed)
+	assert.FileExists(t, filepath.Join(dir, "photo0.jxl"))
+}
+
+// TestCoordinator_VerifiesUploadChecksum 测试上传内容与校验和不一致时拒绝，提交结果时只接受已校验的输出
+func TestCoordinator_VerifiesUploadChecksum(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	sources := writeSources(t, dir, 1)
+	_, url, wait := startCoordinator(t, sm, dir, distributed.CoordinatorOptions{}, planFor(sm, sources))
+
+	var lease distributed.Lease
+	require.Eventually(t, func() bool {
+		resp, err := http.Post(url+"/leases", "application/json", strings.NewReader(`{"worker":"manual"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&lease))
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	output := []byte("converted")
+	put := func(sum string) int {
+		req, err := http.NewRequest(http.MethodPut, url+"/leases/"+lease.ID+"/outputs/0?name=photo0.jxl", bytes.NewReader(output))
+		require.NoError(t, err)
+		req.Header.Set(distributed.ChecksumHeader, sum)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, put(checksum([]byte("corrupted"))))
+	assert.NoFileExists(t, filepath.Join(dir, "photo0.jxl"))
+	assert.Equal(t, http.StatusOK, put(checksum(output)))
+
+	body, err := json.Marshal(distributed.CompleteRequest{Results: []distributed.Result{{
+		Source: sources[0], Status: "success", Output: "photo0.jxl", Checksum: checksum(output),
+	}}})
+	require.NoError(t, err)
+	resp, err := http.Post(url+"/leases/"+lease.ID+"/complete", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status := wait()
+	assert.Equal(t, 1, status.Completed)
+	data, err := os.ReadFile(filepath.Join(dir, "photo0.jxl"))
+	require.NoError(t, err)
+	assert.Equal(t, output, data)
+}
@@ -0,0 +1,109 @@
+package distributed_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/types"
+	"pixly/pkg/distributed"
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// 工作节点子进程的环境变量：协调节点地址、是否共享文件系统、假 cjxl 路径
+const (
+	workerCoordinatorEnv = "PIXLY_TEST_WORKER_COORDINATOR"
+	workerSharedFSEnv    = "PIXLY_TEST_WORKER_SHARED_FS"
+	workerCjxlEnv        = "PIXLY_TEST_WORKER_CJXL"
+)
+
+// fakeCjxl 假 cjxl：输出源文件的前 16 字节，大文件因此“压缩”成功，小文件无法优化
+const fakeCjxl = `#!/bin/sh
+head -c 16 "$1" > "$2"
+`
+
+// TestWorkerProcess 不是独立测试：由 runWorkerProcess 在子进程中启动，使用真实转换引擎运行工作节点
+func TestWorkerProcess(t *testing.T) {
+	coordinator := os.Getenv(workerCoordinatorEnv)
+	if coordinator == "" {
+		t.Skip("仅在工作节点子进程中运行")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = t.TempDir()
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+	tools := types.ToolCheckResults{HasCjxl: true, CjxlPath: os.Getenv(workerCjxlEnv)}
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, tools, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	worker := distributed.NewWorker(zaptest.NewLogger(t), distributed.WorkerOptions{
+		Coordinator:  coordinator,
+		SharedFS:     os.Getenv(workerSharedFSEnv) == "1",
+		WorkDir:      t.TempDir(),
+		PollInterval: 10 * time.Millisecond,
+	}, conversionEngine.ConvertUnit)
+	require.NoError(t, worker.Run(ctx))
+}
+
+// runWorkerProcess 重新执行测试二进制，在独立进程中运行 TestWorkerProcess
+func runWorkerProcess(t *testing.T, coordinator string, sharedFS bool) {
+	cjxl := filepath.Join(t.TempDir(), "cjxl")
+	require.NoError(t, os.WriteFile(cjxl, []byte(fakeCjxl), 0755))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWorkerProcess$", "-test.count=1")
+	cmd.Env = append(os.Environ(),
+		workerCoordinatorEnv+"="+coordinator,
+		workerCjxlEnv+"="+cjxl,
+		fmt.Sprintf("%s=%d", workerSharedFSEnv, map[bool]int{false: 0, true: 1}[sharedFS]))
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "工作节点进程失败:\n%s", output)
+}
+
+// TestDistributed_BalancedOutputReplacesSource 测试平衡优化原位替换源文件时，
+// 工作节点进程把优化结果交给协调节点替换源文件（流式传输和共享文件系统），无法优化的文件保持不变
+func TestDistributed_BalancedOutputReplacesSource(t *testing.T) {
+	for _, sharedFS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shared_fs=%v", sharedFS), func(t *testing.T) {
+			sm := openState(t)
+			dir := t.TempDir()
+			large := filepath.Join(dir, "large.png")
+			small := filepath.Join(dir, "small.png")
+			largeData := append([]byte("optimized prefix"), make([]byte, 4096)...)
+			require.NoError(t, os.WriteFile(large, largeData, 0644))
+			require.NoError(t, os.WriteFile(small, []byte("tiny"), 0644))
+
+			sources := []string{large, small}
+			_, url, wait := startCoordinator(t, sm, dir, distributed.CoordinatorOptions{}, planFormat(sm, sources, "avif_balanced"))
+			runWorkerProcess(t, url, sharedFS)
+
+			status := wait()
+			assert.Equal(t, len(sources), status.Completed)
+			assert.Zero(t, status.Failed)
+
+			data, err := os.ReadFile(large)
+			require.NoError(t, err)
+			assert.Equal(t, "optimized prefix", string(data), "源文件已替换为优化结果")
+			data, err = os.ReadFile(small)
+			require.NoError(t, err)
+			assert.Equal(t, "tiny", string(data), "无法优化的源文件保持不变")
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			assert.ElementsMatch(t, []string{"large.png", "small.png"}, names, "没有多余的输出或临时上传文件")
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package encoder_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFfmpeg 测试用假 FFmpeg：逐行记录参数并创建最后一个参数指定的输出文件
+const fakeFfmpeg = `#!/bin/sh
+for arg in "$@"; do echo "$arg"; done > "$FAKE_FFMPEG_ARGS"
+for arg in "$@"; do target="$arg"; done
+echo avif > "$target"
+`
+
+// TestFfmpegEncoder_AVIFArgs 测试 avifenc 速度按 AV1 编码器映射为 FFmpeg 参数
+func TestFfmpegEncoder_AVIFArgs(t *testing.T) {
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	require.NoError(t, os.WriteFile(ffmpeg, []byte(fakeFfmpeg), 0755))
+	source := filepath.Join(dir, "in.gif")
+	require.NoError(t, os.WriteFile(source, []byte("gif"), 0644))
+	argsFile := filepath.Join(dir, "args")
+	t.Setenv("FAKE_FFMPEG_ARGS", argsFile)
+
+	tests := []struct {
+		name  string
+		codec string
+		speed int
+		want  []string
+	}{
+		{name: "libaom速度上限为8", codec: "libaom-av1", speed: 10, want: []string{"-c:v", "libaom-av1", "-crf", "30", "-cpu-used", "8"}},
+		{name: "libaom速度范围内", codec: "libaom-av1", speed: 6, want: []string{"-c:v", "libaom-av1", "-crf", "30", "-cpu-used", "6"}},
+		{name: "libsvtav1使用preset", codec: "libsvtav1", speed: 10, want: []string{"-c:v", "libsvtav1", "-crf", "30", "-preset", "10"}},
+		{name: "其他编码器不传速度", codec: "av1", speed: 10, want: []string{"-c:v", "av1", "-crf", "30"}},
+		{name: "未指定编码器时使用libaom", speed: 8, want: []string{"-c:v", "libaom-av1", "-crf", "30", "-cpu-used", "8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(dir, "out.avif")
+			encoder := engine.NewFfmpegEncoder(engine.EncoderFfmpegStable, true, ffmpeg, nil)
+			job := &engine.EncodeJob{
+				SourcePath:   source,
+				TargetPath:   target,
+				OutputFormat: "avif",
+				Container:    "avif",
+				VideoCodec:   tt.codec,
+				CRF:          30,
+				Speed:        tt.speed,
+			}
+			_, err := encoder.Encode(context.Background(), job)
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(argsFile)
+			require.NoError(t, err)
+			want := append([]string{"-i", source}, tt.want...)
+			want = append(want, "-f", "avif", "-y", target)
+			assert.Equal(t, want, strings.Fields(string(data)))
+		})
+	}
+}
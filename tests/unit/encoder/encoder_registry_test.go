@@ -0,0 +1,113 @@
+package encoder_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeEncoder 测试用假编码器：写出固定内容或返回预设错误
+type fakeEncoder struct {
+	name      string
+	inputs    []string
+	outputs   []string
+	available bool
+	err       error
+	calls     int
+}
+
+func (f *fakeEncoder) Name() string               { return f.name }
+func (f *fakeEncoder) SupportedInputs() []string  { return f.inputs }
+func (f *fakeEncoder) SupportedOutputs() []string { return f.outputs }
+func (f *fakeEncoder) Probe() bool                { return f.available }
+
+func (f *fakeEncoder) Encode(ctx context.Context, job *engine.EncodeJob) (*engine.EncodeResult, error) {
+	f.calls++
+	if f.err != nil {
+		// 模拟崩溃时留下的部分输出
+		os.WriteFile(job.TargetPath, []byte("partial"), 0644)
+		return nil, f.err
+	}
+	data := []byte("encoded by " + f.name)
+	if err := os.WriteFile(job.TargetPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return &engine.EncodeResult{Encoder: f.name, OutputPath: job.TargetPath, OutputSize: int64(len(data))}, nil
+}
+
+// TestEncoderRegistry_ChainFor 测试按格式筛选后备链并保持注册顺序
+func TestEncoderRegistry_ChainFor(t *testing.T) {
+	registry := engine.NewEncoderRegistry()
+	registry.Register(&fakeEncoder{name: "primary", inputs: []string{"png"}, outputs: []string{"jxl"}, available: true})
+	registry.Register(&fakeEncoder{name: "offline", inputs: []string{"*"}, outputs: []string{"jxl"}, available: false})
+	registry.Register(&fakeEncoder{name: "webp-only", inputs: []string{"*"}, outputs: []string{"webp"}, available: true})
+	registry.Register(&fakeEncoder{name: "generic", inputs: []string{"*"}, outputs: []string{"jxl", "avif"}, available: true})
+
+	names := func(chain []engine.Encoder) []string {
+		var out []string
+		for _, enc := range chain {
+			out = append(out, enc.Name())
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"primary", "generic"}, names(registry.ChainFor(".PNG", "jxl")))
+	assert.Equal(t, []string{"generic"}, names(registry.ChainFor("gif", "jxl")))
+	assert.Empty(t, registry.ChainFor("png", "mp4"))
+	assert.Equal(t, []string{"generic", "primary"}, names(registry.Chain("generic", "missing", "offline", "primary")))
+
+	// 同名注册替换实现但保留位置
+	registry.Register(&fakeEncoder{name: "primary", inputs: []string{"*"}, outputs: []string{"avif"}, available: true})
+	assert.Equal(t, []string{"primary", "offline", "webp-only", "generic"}, registry.Names())
+	assert.Equal(t, []string{"primary", "generic"}, names(registry.ChainFor("png", "avif")))
+}
+
+// TestRunEncoderChain_Fallback 测试首选编码器失败后回退到下一个编码器
+func TestRunEncoderChain_Fallback(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.png")
+	require.NoError(t, os.WriteFile(source, []byte("png"), 0644))
+
+	failing := &fakeEncoder{name: "failing", err: errors.New("crash")}
+	working := &fakeEncoder{name: "working"}
+
+	job := &engine.EncodeJob{SourcePath: source, TargetPath: filepath.Join(dir, "out.jxl"), OutputFormat: "jxl"}
+	result, err := engine.RunEncoderChain(context.Background(), logger, []engine.Encoder{failing, working}, job)
+	require.NoError(t, err)
+	assert.Equal(t, "working", result.Encoder)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 1, working.calls)
+
+	data, err := os.ReadFile(job.TargetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "encoded by working", string(data))
+}
+
+// TestRunEncoderChain_AllFail 测试所有编码器失败时返回错误并清理部分输出
+func TestRunEncoderChain_AllFail(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	dir := t.TempDir()
+
+	job := &engine.EncodeJob{SourcePath: filepath.Join(dir, "in.png"), TargetPath: filepath.Join(dir, "out.jxl"), OutputFormat: "jxl"}
+	chain := []engine.Encoder{
+		&fakeEncoder{name: "a", err: errors.New("a failed")},
+		&fakeEncoder{name: "b", err: errors.New("b failed")},
+	}
+
+	_, err := engine.RunEncoderChain(context.Background(), logger, chain, job)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b failed")
+	assert.NoFileExists(t, job.TargetPath)
+
+	_, err = engine.RunEncoderChain(context.Background(), logger, nil, job)
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package jobqueue_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func openState(t *testing.T) *state.StateManager {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+	return sm
+}
+
+func enqueue(t *testing.T, sm *state.StateManager, path string, priority int) {
+	require.NoError(t, sm.EnqueueJob(&state.QueueEntry{Path: path, Members: []string{path}, Priority: priority, Payload: json.RawMessage(`{}`)}))
+}
+
+func dequeuePath(t *testing.T, sm *state.StateManager, dir string) string {
+	entry, err := sm.DequeueJob(dir)
+	require.NoError(t, err)
+	if entry == nil {
+		return ""
+	}
+	assert.Equal(t, state.QueueRunning, entry.State)
+	return entry.Path
+}
+
+// TestJobQueue_PriorityOrder 测试高优先级先出队，同优先级先进先出，只取指定目录下的条目
+func TestJobQueue_PriorityOrder(t *testing.T) {
+	sm := openState(t)
+	dir, other := t.TempDir(), t.TempDir()
+
+	enqueue(t, sm, filepath.Join(dir, "a.jpg"), 0)
+	enqueue(t, sm, filepath.Join(other, "x.jpg"), 100)
+	enqueue(t, sm, filepath.Join(dir, "b.jpg"), 0)
+	enqueue(t, sm, filepath.Join(dir, "c.jpg"), 5)
+	enqueue(t, sm, filepath.Join(dir, "a.jpg"), 50) // 重复入队不改变位置
+
+	assert.Equal(t, filepath.Join(dir, "c.jpg"), dequeuePath(t, sm, dir))
+	assert.Equal(t, filepath.Join(dir, "a.jpg"), dequeuePath(t, sm, dir))
+	assert.Equal(t, filepath.Join(dir, "b.jpg"), dequeuePath(t, sm, dir))
+	assert.Empty(t, dequeuePath(t, sm, dir))
+	assert.Equal(t, filepath.Join(other, "x.jpg"), dequeuePath(t, sm, other))
+
+	require.NoError(t, sm.CompleteJob(filepath.Join(dir, "a.jpg")))
+	entries, err := sm.ListQueue(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "完成的条目从队列删除")
+}
+
+// TestJobQueue_UserControls 测试暂停整个队列、取消和调整单个文件
+func TestJobQueue_UserControls(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg"), filepath.Join(dir, "c.jpg")
+	for _, path := range []string{a, b, c} {
+		enqueue(t, sm, path, 0)
+	}
+
+	require.NoError(t, sm.PauseQueue())
+	_, err := sm.DequeueJob(dir)
+	assert.ErrorIs(t, err, state.ErrQueuePaused)
+	require.NoError(t, sm.ResumeQueue())
+
+	require.NoError(t, sm.CancelJob(a))
+	require.NoError(t, sm.SetJobPriority(c, 10))
+	assert.ErrorIs(t, sm.SetJobPriority(filepath.Join(dir, "missing.jpg"), 1), state.ErrQueueEntryNotFound)
+
+	assert.Equal(t, c, dequeuePath(t, sm, dir))
+	assert.ErrorIs(t, sm.CancelJob(c), state.ErrQueueEntryRunning)
+	assert.Equal(t, b, dequeuePath(t, sm, dir))
+	assert.Empty(t, dequeuePath(t, sm, dir), "取消的文件不再出队")
+
+	// 取消的文件再次扫描时不入队，显式重试后恢复
+	enqueue(t, sm, a, 0)
+	assert.Empty(t, dequeuePath(t, sm, dir))
+	require.NoError(t, sm.RetryJob(a))
+	assert.Equal(t, a, dequeuePath(t, sm, dir))
+}
+
+// TestJobQueue_SurvivesRestart 测试优先级、尝试次数和错误在重新打开数据库后保留，中断的条目重新排队
+func TestJobQueue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")
+
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	enqueue(t, sm, a, 3)
+	enqueue(t, sm, b, 1)
+	require.Equal(t, a, dequeuePath(t, sm, dir))
+	require.Equal(t, b, dequeuePath(t, sm, dir))
+	require.NoError(t, sm.FailJob(b, "编码失败"))
+	require.NoError(t, sm.Close()) // a 处于运行中时进程退出
+
+	sm = openState(t)
+	requeued, failed, err := sm.RecoverQueue(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	assert.Equal(t, 0, failed)
+
+	entries, err := sm.ListQueue(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, a, entries[0].Path)
+	assert.Equal(t, state.QueueQueued, entries[0].State)
+	assert.Equal(t, 3, entries[0].Priority)
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.Equal(t, state.QueueFailed, entries[1].State)
+	assert.Equal(t, "编码失败", entries[1].LastError)
+
+	// 反复中断的条目不再自动重试
+	failed = 0
+	for attempts := entries[0].Attempts; attempts < state.MaxQueueAttempts; attempts++ {
+		require.Equal(t, a, dequeuePath(t, sm, dir))
+		_, failed, err = sm.RecoverQueue(dir)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, failed)
+	assert.Empty(t, dequeuePath(t, sm, dir))
+}
+
+// TestEngine_ResumesFromQueue 测试扫描完成后中断的运行在重启时直接从队列继续，不重新扫描
+func TestEngine_ResumesFromQueue(t *testing.T) {
+	sm := openState(t)
+	dir := t.TempDir()
+	queued, unscanned := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	for _, path := range []string{queued, unscanned} {
+		require.NoError(t, os.WriteFile(path, []byte("not really an image"), 0644))
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"tasks": []engine.ConversionTask{{SourcePath: queued, TargetFormat: "jxl", Mode: "quality", MediaType: "image"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, sm.EnqueueJob(&state.QueueEntry{Path: queued, Members: []string{queued}, Payload: payload}))
+	require.NoError(t, sm.MarkQueueScanned(dir))
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = dir
+	cfg.DryRun = true
+	cfg.Mode = "quality"
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	run := func() {
+		conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, types.ToolCheckResults{HasFfmpeg: true}, nil)
+		conversionEngine.SetStateManager(sm)
+		require.NoError(t, conversionEngine.Execute(context.Background()))
+	}
+
+	run()
+	entries, err := sm.ListQueue(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "队列中的任务已完成")
+	scanned, err := sm.IsQueueScanned(dir)
+	require.NoError(t, err)
+	assert.False(t, scanned, "正常结束后清除扫描完成标记")
+	assert.NotContains(t, mediaPaths(t, sm), unscanned, "从队列继续时不扫描目录")
+
+	// 队列为空时正常扫描
+	run()
+	assert.Contains(t, mediaPaths(t, sm), unscanned)
+
+	// 队列暂停时拒绝开始
+	require.NoError(t, sm.PauseQueue())
+	t.Cleanup(func() { sm.ResumeQueue() })
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, types.ToolCheckResults{HasFfmpeg: true}, nil)
+	conversionEngine.SetStateManager(sm)
+	assert.ErrorIs(t, conversionEngine.Execute(context.Background()), state.ErrQueuePaused)
+}
+
+func mediaPaths(t *testing.T, sm *state.StateManager) []string {
+	files, err := sm.LoadMediaFiles()
+	require.NoError(t, err)
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	return paths
+}
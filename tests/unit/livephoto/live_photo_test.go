@@ -0,0 +1,142 @@
+package livephoto_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeExiftool 假exiftool：文件的 ContentIdentifier 保存在旁边的 <文件>.cid 中
+//   - -json 读取：逐个输出 SourceFile 与 ContentIdentifier
+//   - -Keys:ContentIdentifier=X 写入：写入最后一个参数对应的 .cid
+//   - -TagsFromFile src -MakerNotes 写入：复制 src 的 .cid（FAKE_EXIFTOOL_DROP_MAKERNOTES 非空时不复制）
+const fakeExiftool = `#!/bin/sh
+if [ "$1" = "-json" ]; then
+  shift 2
+  printf '['
+  sep=''
+  for f in "$@"; do
+    printf '%s{"SourceFile": "%s"' "$sep" "$f"
+    if [ -f "$f.cid" ]; then printf ', "ContentIdentifier": "%s"' "$(cat "$f.cid")"; fi
+    printf '}'
+    sep=','
+  done
+  printf ']\n'
+  exit 0
+fi
+for last; do :; done
+case "$2" in
+  -Keys:ContentIdentifier=*) printf '%s' "${2#-Keys:ContentIdentifier=}" > "$last.cid" ;;
+  -TagsFromFile)
+    if [ -z "$FAKE_EXIFTOOL_DROP_MAKERNOTES" ] && [ -f "$3.cid" ]; then cp "$3.cid" "$last.cid"; fi ;;
+esac
+`
+
+type livePhotoEnv struct {
+	dir      string
+	exiftool string
+}
+
+func setupLivePhotoEnv(t *testing.T) *livePhotoEnv {
+	dir := t.TempDir()
+	exiftool := filepath.Join(dir, "exiftool")
+	require.NoError(t, os.WriteFile(exiftool, []byte(fakeExiftool), 0755))
+	return &livePhotoEnv{dir: dir, exiftool: exiftool}
+}
+
+// addFile 创建媒体文件，cid 非空时设置其 ContentIdentifier
+func (env *livePhotoEnv) addFile(t *testing.T, name, cid string) string {
+	path := filepath.Join(env.dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	if cid != "" {
+		require.NoError(t, os.WriteFile(path+".cid", []byte(cid), 0644))
+	}
+	return path
+}
+
+// TestLivePhotoPairer_BasenameWithoutExiftool 测试没有exiftool时按同目录同名配对
+func TestLivePhotoPairer_BasenameWithoutExiftool(t *testing.T) {
+	env := setupLivePhotoEnv(t)
+	still := env.addFile(t, "IMG_0001.HEIC", "")
+	video := env.addFile(t, "IMG_0001.mov", "")
+	env.addFile(t, "IMG_0002.heic", "")
+	env.addFile(t, "other/IMG_0003.jpg", "")
+	env.addFile(t, "IMG_0003.MOV", "")
+
+	pairer := engine.NewLivePhotoPairer(zaptest.NewLogger(t), "")
+	pairs := pairer.FindPairs(context.Background(), []string{
+		still, video,
+		filepath.Join(env.dir, "IMG_0002.heic"),
+		filepath.Join(env.dir, "other", "IMG_0003.jpg"),
+		filepath.Join(env.dir, "IMG_0003.MOV"),
+	})
+
+	require.Len(t, pairs, 1)
+	assert.Equal(t, still, pairs[0].StillPath)
+	assert.Equal(t, video, pairs[0].VideoPath)
+	assert.Equal(t, "basename", pairs[0].MatchedBy)
+	assert.Empty(t, pairs[0].ContentIdentifier)
+}
+
+// TestLivePhotoPairer_ContentIdentifier 测试按ContentIdentifier跨文件名配对，以及同名但标识不同时不配对
+func TestLivePhotoPairer_ContentIdentifier(t *testing.T) {
+	env := setupLivePhotoEnv(t)
+	renamedStill := env.addFile(t, "IMG_0010.jpg", "AAAA")
+	renamedVideo := env.addFile(t, "IMG_0010 (1).mov", "AAAA")
+	conflictStill := env.addFile(t, "IMG_0020.heic", "BBBB")
+	conflictVideo := env.addFile(t, "IMG_0020.mov", "CCCC")
+	halfStill := env.addFile(t, "IMG_0030.heic", "DDDD")
+	halfVideo := env.addFile(t, "IMG_0030.mov", "")
+
+	pairer := engine.NewLivePhotoPairer(zaptest.NewLogger(t), env.exiftool)
+	pairs := pairer.FindPairs(context.Background(), []string{
+		renamedStill, renamedVideo, conflictStill, conflictVideo, halfStill, halfVideo,
+	})
+
+	require.Len(t, pairs, 2)
+	assert.Equal(t, renamedStill, pairs[0].StillPath)
+	assert.Equal(t, renamedVideo, pairs[0].VideoPath)
+	assert.Equal(t, "AAAA", pairs[0].ContentIdentifier)
+	assert.Equal(t, "content_identifier", pairs[0].MatchedBy)
+
+	// 只有一半带标识时按文件名配对，并沿用该标识
+	assert.Equal(t, halfStill, pairs[1].StillPath)
+	assert.Equal(t, halfVideo, pairs[1].VideoPath)
+	assert.Equal(t, "DDDD", pairs[1].ContentIdentifier)
+	assert.Equal(t, "basename", pairs[1].MatchedBy)
+}
+
+// TestLivePhotoPairer_PreservePairing 测试转换输出写回ContentIdentifier并回读校验
+func TestLivePhotoPairer_PreservePairing(t *testing.T) {
+	env := setupLivePhotoEnv(t)
+	still := env.addFile(t, "IMG_0040.heic", "EEEE")
+	video := env.addFile(t, "IMG_0040.mov", "EEEE")
+	stillOut := env.addFile(t, "IMG_0040.jxl", "")
+	videoOut := env.addFile(t, "IMG_0040.mp4", "")
+
+	pairer := engine.NewLivePhotoPairer(zaptest.NewLogger(t), env.exiftool)
+	pairs := pairer.FindPairs(context.Background(), []string{still, video})
+	require.Len(t, pairs, 1)
+
+	require.NoError(t, pairer.PreservePairing(context.Background(), pairs[0], still, stillOut, videoOut))
+
+	ids, err := pairer.ReadContentIdentifiers(context.Background(), []string{stillOut, videoOut})
+	require.NoError(t, err)
+	assert.Equal(t, "EEEE", ids[stillOut])
+	assert.Equal(t, "EEEE", ids[videoOut])
+
+	// 静态图输出无法写入MakerNotes时校验失败，由调用方整体回滚
+	t.Setenv("FAKE_EXIFTOOL_DROP_MAKERNOTES", "1")
+	otherStillOut := env.addFile(t, "IMG_0040_2.avif", "")
+	err = pairer.PreservePairing(context.Background(), pairs[0], still, otherStillOut, videoOut)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "IMG_0040_2.avif")
+}
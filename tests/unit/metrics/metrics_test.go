@@ -0,0 +1,105 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func render(t *testing.T, registry *metrics.Registry) string {
+	var out bytes.Buffer
+	require.NoError(t, registry.WriteText(&out))
+	return out.String()
+}
+
+// TestRegistry_TextFormat 测试计数器、gauge 和直方图的 Prometheus 文本输出
+func TestRegistry_TextFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+	files := registry.NewCounterVec("test_files_total", "处理的文件数", "status", "format")
+	workers := registry.NewGaugeVec("test_workers", "工作协程数")
+	durations := registry.NewHistogramVec("test_duration_seconds", "耗时", []float64{1, 5}, "encoder")
+
+	files.WithLabelValues("success", "png").Add(2)
+	files.WithLabelValues("failed", `we"ird`).Inc()
+	files.WithLabelValues("success", "png").Add(-5) // 计数器不减少
+	workers.WithLabelValues().Set(3)
+	workers.WithLabelValues().Dec()
+	for _, seconds := range []float64{0.5, 1, 3, 60} {
+		durations.WithLabelValues("cjxl").Observe(seconds)
+	}
+
+	text := render(t, registry)
+	assert.Contains(t, text, "# HELP test_files_total 处理的文件数\n# TYPE test_files_total counter\n")
+	assert.Contains(t, text, `test_files_total{status="success",format="png"} 2`+"\n")
+	assert.Contains(t, text, `test_files_total{status="failed",format="we\"ird"} 1`+"\n")
+	assert.Contains(t, text, "# TYPE test_workers gauge\ntest_workers 2\n")
+	assert.Contains(t, text, strings.Join([]string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{encoder="cjxl",le="1"} 2`,
+		`test_duration_seconds_bucket{encoder="cjxl",le="5"} 3`,
+		`test_duration_seconds_bucket{encoder="cjxl",le="+Inf"} 4`,
+		`test_duration_seconds_sum{encoder="cjxl"} 64.5`,
+		`test_duration_seconds_count{encoder="cjxl"} 4`,
+	}, "\n"))
+	assert.Less(t, strings.Index(text, "test_duration_seconds"), strings.Index(text, "test_files_total"), "按名称排序")
+
+	assert.Panics(t, func() { registry.NewCounterVec("test_files_total", "重复") })
+	assert.Panics(t, func() { files.WithLabelValues("success") })
+}
+
+// TestEngine_RecordsMetrics 测试转换结果计入默认注册表，并通过 /metrics 输出
+func TestEngine_RecordsMetrics(t *testing.T) {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.png")
+	require.NoError(t, os.WriteFile(source, make([]byte, 1000), 0644))
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = dir
+	cfg.DryRun = true
+	cfg.Mode = "quality"
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, types.ToolCheckResults{HasFfmpeg: true}, nil)
+	conversionEngine.SetStateManager(sm)
+	before := render(t, metrics.Default)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, conversionEngine.Execute(ctx))
+
+	server := httptest.NewServer(metrics.Handler())
+	t.Cleanup(server.Close)
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	var body bytes.Buffer
+	_, err = body.ReadFrom(resp.Body)
+	require.NoError(t, err)
+	after := body.String()
+
+	assert.NotEqual(t, before, after)
+	assert.Regexp(t, `pixly_files_processed_total\{status="(success|corrupted)",format="png"\} [1-9]`, after)
+	assert.Contains(t, after, "pixly_active_workers 0\n", "转换结束后没有活动的工作协程")
+	assert.Contains(t, after, "# TYPE pixly_encoder_duration_seconds histogram")
+	assert.Contains(t, after, "# TYPE go_goroutines gauge")
+}
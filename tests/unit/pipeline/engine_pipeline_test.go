@@ -0,0 +1,206 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/engine/quality"
+	"pixly/pkg/scanner"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// pipelineDirs 每个目录一个文件，遍历按目录输出批次，背压以目录为单位生效
+const pipelineDirs = 60
+
+// gatedProbe 假ffprobe：除 first.png 外，等到 GATE 文件存在后才输出结果
+const gatedProbe = `#!/bin/sh
+for arg; do file="$arg"; done
+case "$file" in
+  */first.png) ;;
+  *) while [ ! -e "%s" ]; do sleep 0.01; done ;;
+esac
+echo '{"streams": [{"codec_name": "png", "codec_type": "video", "width": 64, "height": 64, "nb_frames": "1"}], "format": {"format_name": "png_pipe"}}'
+`
+
+// blockingEncoder 假编码器：写出固定内容，每次编码前调用 onEncode
+type blockingEncoder struct {
+	onEncode func()
+}
+
+func (b *blockingEncoder) Name() string               { return "fake" }
+func (b *blockingEncoder) SupportedInputs() []string  { return []string{"*"} }
+func (b *blockingEncoder) SupportedOutputs() []string { return []string{"jxl", "avif"} }
+func (b *blockingEncoder) Probe() bool                { return true }
+
+func (b *blockingEncoder) Encode(ctx context.Context, job *engine.EncodeJob) (*engine.EncodeResult, error) {
+	if b.onEncode != nil {
+		b.onEncode()
+	}
+	if err := os.WriteFile(job.TargetPath, []byte("fake output"), 0644); err != nil {
+		return nil, err
+	}
+	return &engine.EncodeResult{Encoder: b.Name(), OutputPath: job.TargetPath, OutputSize: 11}, nil
+}
+
+// pipelineEnv 目录树、假工具与使用假编码器的引擎
+type pipelineEnv struct {
+	dir    string
+	gate   string
+	engine *engine.ConversionEngine
+}
+
+func setupPipeline(t *testing.T, encoder *blockingEncoder) *pipelineEnv {
+	env := &pipelineEnv{dir: t.TempDir(), gate: filepath.Join(t.TempDir(), "open")}
+	for i := 0; i < pipelineDirs; i++ {
+		name := "img.png"
+		if i == 0 {
+			name = "first.png"
+		}
+		path := filepath.Join(env.dir, fmt.Sprintf("d%02d", i), name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, make([]byte, 4096), 0644))
+	}
+
+	probe := filepath.Join(t.TempDir(), "ffprobe")
+	require.NoError(t, os.WriteFile(probe, []byte(fmt.Sprintf(gatedProbe, env.gate)), 0755))
+
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = env.dir
+	cfg.Mode = "quality"
+	cfg.ConcurrentJobs = 1
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	tools := types.ToolCheckResults{HasFfmpeg: true, FfmpegStablePath: probe}
+	env.engine = engine.NewConversionEngine(zaptest.NewLogger(t), cfg, tools, nil)
+	env.engine.SetStateManager(sm)
+	registry := engine.NewEncoderRegistry()
+	registry.Register(encoder)
+	env.engine.SetEncoderRegistry(registry)
+	return env
+}
+
+func (env *pipelineEnv) openGate(t *testing.T) {
+	require.NoError(t, os.WriteFile(env.gate, nil, 0644))
+}
+
+func (env *pipelineEnv) execute(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- env.engine.Execute(ctx) }()
+	return done
+}
+
+// TestEngine_ConvertsBeforeWalkFinishes 测试目录仍在遍历时第一个文件已开始转换
+func TestEngine_ConvertsBeforeWalkFinishes(t *testing.T) {
+	var once sync.Once
+	var env *pipelineEnv
+	discoveredAtFirstEncode := -1
+	encoder := &blockingEncoder{}
+	encoder.onEncode = func() {
+		once.Do(func() {
+			discoveredAtFirstEncode = env.engine.ProgressStats().TotalToAssess
+			env.openGate(t) // 其余文件的评估在第一个文件转换之后才能完成
+		})
+	}
+	env = setupPipeline(t, encoder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	require.NoError(t, <-env.execute(ctx))
+
+	require.GreaterOrEqual(t, discoveredAtFirstEncode, 1, "应至少转换一个文件")
+	assert.Less(t, discoveredAtFirstEncode, pipelineDirs, "第一个文件开始转换时遍历尚未完成")
+
+	stats := env.engine.ProgressStats()
+	assert.Equal(t, pipelineDirs, stats.TotalToAssess)
+	assert.Equal(t, pipelineDirs, stats.AssessmentProgress)
+	assert.Equal(t, pipelineDirs, stats.ConversionProgress)
+}
+
+// TestEngine_PipelineBackpressure 测试评估停滞时遍历被有界通道阻塞，恢复后全部处理完
+func TestEngine_PipelineBackpressure(t *testing.T) {
+	env := setupPipeline(t, &blockingEncoder{})
+	env.openGate(t)
+	env.engine.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	done := env.execute(ctx)
+
+	// 暂停时评估工作者各持有一个单元，之后遍历只能填满各阶段之间的通道
+	var plateau int
+	require.Eventually(t, func() bool {
+		before := env.engine.ProgressStats().TotalToAssess
+		time.Sleep(100 * time.Millisecond)
+		plateau = env.engine.ProgressStats().TotalToAssess
+		return plateau > 0 && plateau == before
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Less(t, plateau, pipelineDirs/2, "已发现的文件数应受通道容量限制")
+	assert.Zero(t, env.engine.ProgressStats().AssessmentProgress, "暂停期间不应评估")
+
+	select {
+	case err := <-done:
+		t.Fatalf("暂停期间管道不应结束: %v", err)
+	default:
+	}
+
+	env.engine.Resume()
+	require.NoError(t, <-done)
+
+	stats := env.engine.ProgressStats()
+	assert.Equal(t, pipelineDirs, stats.TotalToAssess)
+	assert.Equal(t, pipelineDirs, stats.ConversionProgress)
+}
+
+// TestUnifiedScan_ExecuteCollectsStream 测试统一扫描收集流式分析结果并按路径排序
+func TestUnifiedScan_ExecuteCollectsStream(t *testing.T) {
+	root := createTree(t, "z.png", "a.png", "sub/m.png", "notes.txt")
+	probe := filepath.Join(t.TempDir(), "ffprobe")
+	gate := filepath.Join(t.TempDir(), "open")
+	require.NoError(t, os.WriteFile(gate, nil, 0644))
+	require.NoError(t, os.WriteFile(probe, []byte(fmt.Sprintf(gatedProbe, gate)), 0755))
+
+	logger := zaptest.NewLogger(t)
+	arch := scanner.NewUnifiedScanArchitecture(logger,
+		scanner.NewScanner(logger),
+		scanner.NewFileMorphologyClassifier(logger, probe, probe),
+		quality.NewQualityEngine(logger, probe, "", false),
+		t.TempDir())
+
+	result, err := arch.ExecuteUnifiedScan(context.Background(), root)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, file := range result.MediaFiles {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(root, "a.png"),
+		filepath.Join(root, "sub", "m.png"),
+		filepath.Join(root, "z.png"),
+	}, paths)
+	assert.Equal(t, 3, result.Summary.MediaFiles)
+	assert.Equal(t, 3, result.Statistics.TotalFiles)
+	assert.Contains(t, result.Statistics.ProcessingTimeBreakdown, "streaming_scan")
+
+	// 取消时返回错误而不是部分结果
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = arch.ExecuteUnifiedScan(ctx, root)
+	assert.Error(t, err)
+}
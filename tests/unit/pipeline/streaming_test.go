@@ -0,0 +1,130 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/scanner"
+	"pixly/pkg/ui/progress"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func createTree(t *testing.T, files ...string) string {
+	root := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+	return root
+}
+
+// TestScanner_WalkDirectoryStreams 测试遍历逐个回调，回调返回错误时立即停止
+func TestScanner_WalkDirectoryStreams(t *testing.T) {
+	root := createTree(t, "a.jpg", "b.png", "sub/c.mov", "sub/deeper/d.heic")
+	s := scanner.NewScanner(zaptest.NewLogger(t))
+
+	var seen []string
+	err := s.WalkDirectory(context.Background(), root, func(file *scanner.FileInfo) error {
+		if !file.IsDir {
+			seen = append(seen, filepath.Base(file.Path))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.jpg", "b.png", "c.mov", "d.heic"}, seen)
+
+	// 下游停止接收时遍历随之停止
+	stop := errors.New("stop")
+	count := 0
+	err = s.WalkDirectory(context.Background(), root, func(file *scanner.FileInfo) error {
+		if file.IsDir {
+			return nil
+		}
+		count++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, count)
+
+	// 取消后不再遍历
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = s.WalkDirectory(ctx, root, func(*scanner.FileInfo) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestStateManager_SaveMediaFilePerItem 测试逐个保存文件不会清空其他记录
+func TestStateManager_SaveMediaFilePerItem(t *testing.T) {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	require.NoError(t, sm.SaveMediaFiles(nil))
+	require.NoError(t, sm.SaveMediaFile(&types.MediaInfo{Path: "/photos/a.jpg", Size: 10}))
+	require.NoError(t, sm.SaveMediaFile(&types.MediaInfo{Path: "/photos/b.jpg", Size: 20}))
+	require.NoError(t, sm.UpdateMediaFileStatus("/photos/a.jpg", types.StatusCompleted))
+
+	// 同一路径再次保存时覆盖
+	require.NoError(t, sm.SaveMediaFile(&types.MediaInfo{Path: "/photos/b.jpg", Size: 25, Status: types.StatusFailed}))
+
+	files, err := sm.LoadMediaFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	byPath := map[string]*types.MediaInfo{}
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+	assert.Equal(t, types.StatusCompleted, byPath["/photos/a.jpg"].Status)
+	assert.Equal(t, int64(25), byPath["/photos/b.jpg"].Size)
+	assert.Equal(t, types.StatusFailed, byPath["/photos/b.jpg"].Status)
+}
+
+// TestProgressManager_AddTotal 测试流式处理中进度总数逐步增加
+func TestProgressManager_AddTotal(t *testing.T) {
+	pm := progress.NewProgressManager(zaptest.NewLogger(t))
+	defer pm.Stop()
+
+	pm.CreateConversionProgress(0)
+	pm.AddTotal(progress.ProgressTypeConversion, 3)
+	pm.UpdateProgress(progress.ProgressTypeConversion, 2)
+	pm.AddTotal(progress.ProgressTypeConversion, 4)
+
+	stats := pm.GetStats()
+	assert.Equal(t, 7, stats.TotalToConvert)
+	assert.Equal(t, 2, stats.ConversionProgress)
+
+	// 未创建的进度条不受影响
+	pm.AddTotal(progress.ProgressTypeScan, 5)
+	assert.Equal(t, 0, pm.GetStats().TotalFound)
+}
+
+// TestProgressManager_AddTotalWhilePaused 测试暂停期间增加的总数在恢复后应用
+func TestProgressManager_AddTotalWhilePaused(t *testing.T) {
+	pm := progress.NewProgressManager(zaptest.NewLogger(t))
+	defer pm.Stop()
+
+	pm.CreateAssessmentProgress(0)
+	pm.AddTotal(progress.ProgressTypeAssessment, 2)
+	pm.Pause()
+	pm.AddTotal(progress.ProgressTypeAssessment, 3)
+	pm.AddTotal(progress.ProgressTypeAssessment, 4)
+	assert.Equal(t, 2, pm.GetStats().TotalToAssess, "暂停期间只排队，不更新")
+
+	pm.Resume()
+	assert.Equal(t, 9, pm.GetStats().TotalToAssess)
+
+	// 已应用的增量不会在下次恢复时重复计入
+	pm.Pause()
+	pm.Resume()
+	assert.Equal(t, 9, pm.GetStats().TotalToAssess)
+}
@@ -0,0 +1,228 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/report"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeFfmpeg 假ffmpeg：向标准输出写入几个 JPEG 字节
+const fakeFfmpeg = `#!/bin/sh
+printf '\377\330\377\340thumb'
+`
+
+// fakeProbe 假ffprobe：输出一个 64x64 的静态图像流
+const fakeProbe = `#!/bin/sh
+echo '{"streams": [{"codec_name": "png", "width": 64, "height": 64}], "format": {"format_name": "png_pipe"}}'
+`
+
+func writeScript(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	return path
+}
+
+func sampleSession() *report.Session {
+	return &report.Session{
+		TargetDir:  "/photos",
+		Mode:       "auto+",
+		StartedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		FinishedAt: time.Date(2026, 1, 2, 3, 6, 5, 0, time.UTC),
+		Results: []report.FileResult{
+			{Source: "/photos/a.png", Target: "/photos/a.jxl", Status: "success", OriginalSize: 1000, NewSize: 250},
+			{Source: "/photos/b.jpg", Target: "/photos/b.jxl", Status: "success", OriginalSize: 2000, NewSize: 1600},
+			{Source: "/photos/trip/c.png", Target: "/photos/trip/c.avif", Status: "success", OriginalSize: 500, NewSize: 600},
+			{Source: "/photos/trip/d.gif", Status: "failed", Message: "转换超时: context deadline exceeded"},
+			{Source: "/photos/trip/e.jpg", Status: "failed", Message: "文件已损坏，无法解码"},
+			{Source: "/photos/f.jxl", Status: "skipped", Message: "已是最优格式"},
+		},
+		ValidationFailures: []report.ValidationFailure{
+			{Source: "/photos/g.jpg", Output: "/photos/g.jxl", Kind: "jpeg_reconstruction", Reason: "重建JPEG的SHA-256不一致"},
+		},
+	}
+}
+
+// TestBuild_Statistics 测试总量、按格式和目录分组、压缩比分布、节省/增加排行和失败分类
+func TestBuild_Statistics(t *testing.T) {
+	r := report.Build(sampleSession(), 0)
+
+	assert.Equal(t, 6, r.Totals.Files)
+	assert.Equal(t, 3, r.Totals.Success)
+	assert.Equal(t, 2, r.Totals.Failed)
+	assert.Equal(t, 1, r.Totals.Skipped)
+	assert.EqualValues(t, 3500, r.Totals.OriginalSize)
+	assert.EqualValues(t, 2450, r.Totals.NewSize)
+	assert.EqualValues(t, 1050, r.Totals.Saved())
+	assert.InDelta(t, 30.0, r.Totals.SavedPercent(), 0.01)
+
+	formats := make(map[string]report.Group)
+	for _, g := range r.ByFormat {
+		formats[g.Key] = g
+	}
+	assert.EqualValues(t, 750, formats["png → jxl"].Saved())
+	assert.EqualValues(t, -100, formats["png → avif"].Saved())
+	assert.Equal(t, 1, formats["gif"].Failed)
+	assert.Equal(t, "png → jxl", r.ByFormat[0].Key, "按节省字节数降序")
+
+	require.Len(t, r.ByDirectory, 2)
+	assert.Equal(t, ".", r.ByDirectory[0].Key)
+	assert.EqualValues(t, 1150, r.ByDirectory[0].Saved())
+	assert.Equal(t, "trip", r.ByDirectory[1].Key)
+	assert.Equal(t, 3, r.ByDirectory[1].Files)
+
+	require.Len(t, r.Histogram, 11)
+	assert.Equal(t, 1, r.Histogram[2].Count, "25% 落在 20–30%")
+	assert.Equal(t, 1, r.Histogram[8].Count, "80% 落在 80–90%")
+	assert.Equal(t, 1, r.Histogram[10].Count, "120% 计入体积增加")
+	assert.True(t, r.Histogram[10].Larger)
+	assert.InDelta(t, 33.3, r.Histogram[10].Percent, 0.1)
+
+	require.Len(t, r.Wins, 2)
+	assert.Equal(t, "/photos/a.png", r.Wins[0].Source)
+	require.Len(t, r.Losses, 1)
+	assert.Equal(t, "/photos/trip/c.png", r.Losses[0].Source)
+	assert.EqualValues(t, -100, r.Losses[0].Delta())
+
+	require.Len(t, r.Failures, 2)
+	classes := map[string]string{}
+	for _, failure := range r.Failures {
+		classes[filepath.Base(failure.Source)] = failure.ErrorClass
+	}
+	assert.Equal(t, "process_timeout", classes["d.gif"])
+	assert.Equal(t, "file_corrupted", classes["e.jpg"])
+	assert.Len(t, r.Validation, 1)
+
+	assert.Len(t, report.Build(sampleSession(), 1).Wins, 1, "topN 限制排行长度")
+}
+
+// TestSampler_SpreadsSamples 测试抽样数量不超过上限，样本均匀分布且按处理顺序返回
+func TestSampler_SpreadsSamples(t *testing.T) {
+	thumbnailer := report.NewThumbnailer(writeScript(t, "ffmpeg", fakeFfmpeg), 0)
+	sampler := report.NewSampler(thumbnailer, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		source := fmt.Sprintf("/photos/%02d.png", i)
+		if pending := sampler.Before(ctx, source); pending != nil {
+			sampler.After(ctx, pending, strings.TrimSuffix(source, ".png")+".jxl", 100, 50)
+		}
+	}
+
+	thumbnails := sampler.Thumbnails()
+	require.Len(t, thumbnails, 3)
+	var sources []string
+	for _, thumbnail := range thumbnails {
+		sources = append(sources, filepath.Base(thumbnail.Source))
+		assert.True(t, strings.HasPrefix(thumbnail.Before, "data:image/jpeg;base64,"))
+		assert.True(t, strings.HasPrefix(thumbnail.After, "data:image/jpeg;base64,"))
+	}
+	assert.Equal(t, []string{"00.png", "04.png", "08.png"}, sources)
+
+	var disabled *report.Sampler
+	assert.Nil(t, disabled.Before(ctx, "/photos/00.png"))
+	assert.Nil(t, report.NewSampler(thumbnailer, 0).Before(ctx, "/photos/00.png"))
+
+	failing := report.NewThumbnailer(writeScript(t, "ffmpeg", "#!/bin/sh\nexit 1\n"), 0)
+	assert.Nil(t, report.NewSampler(failing, 3).Before(ctx, "/photos/00.png"), "缩略图生成失败时不抽样")
+}
+
+// TestRender_SelfContained 测试报告包含各个部分，缩略图内嵌且不引用外部资源
+func TestRender_SelfContained(t *testing.T) {
+	session := sampleSession()
+	session.Thumbnails = []report.Thumbnail{{
+		Source: "/photos/a.png", Target: "/photos/a.jxl",
+		Before: "data:image/jpeg;base64,AAAA", After: "data:image/jpeg;base64,BBBB",
+		OriginalSize: 1000, NewSize: 250,
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, report.Render(&out, report.Build(session, 0)))
+	html := out.String()
+
+	for _, section := range []string{"按格式", "按目录", "压缩比分布", "节省最多的文件", "体积变大的文件", "失败的文件", "校验未通过", "转换前后对比"} {
+		assert.Contains(t, html, "<h2>"+section+"</h2>")
+	}
+	assert.Contains(t, html, `src="data:image/jpeg;base64,AAAA"`)
+	assert.Contains(t, html, `src="data:image/jpeg;base64,BBBB"`)
+	assert.Contains(t, html, "png → jxl")
+	assert.Contains(t, html, "处理超时")
+	assert.Contains(t, html, "文件已损坏")
+	assert.Contains(t, html, "JPEG 无损重建校验")
+	assert.Contains(t, html, "1.0 KB")
+	assert.NotContains(t, html, "http://")
+	assert.NotContains(t, html, "https://")
+	assert.NotContains(t, html, "ZgotmplZ", "模板转义不得替换内嵌内容")
+}
+
+// TestResolvePath 测试目录中生成带时间戳的文件名
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, filepath.Join(dir, "pixly-report-20260102-030405.html"), report.ResolvePath(dir, now))
+	assert.Equal(t, filepath.Join(dir, "new", "pixly-report-20260102-030405.html"), report.ResolvePath(filepath.Join(dir, "new")+"/", now))
+	assert.Equal(t, filepath.Join(dir, "run.html"), report.ResolvePath(filepath.Join(dir, "run.html"), now))
+}
+
+// TestEngine_WritesHTMLReport 测试配置 html_report 后转换结束生成报告
+func TestEngine_WritesHTMLReport(t *testing.T) {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), make([]byte, 1000), 0644))
+	reportDir := t.TempDir()
+
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = dir
+	cfg.DryRun = true
+	cfg.Mode = "quality"
+	cfg.HTMLReport = reportDir
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	tools := types.ToolCheckResults{
+		HasFfmpeg:        true,
+		FfmpegDevPath:    writeScript(t, "ffmpeg", fakeFfmpeg),
+		FfmpegStablePath: writeScript(t, "ffprobe", fakeProbe),
+	}
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, tools, nil)
+	conversionEngine.SetStateManager(sm)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, conversionEngine.Execute(ctx))
+
+	reports, err := filepath.Glob(filepath.Join(reportDir, "pixly-report-*.html"))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	content, err := os.ReadFile(reports[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Pixly 运行报告")
+	assert.Contains(t, string(content), dir)
+	assert.Contains(t, string(content), "没有抽样的缩略图", "模拟运行不生成缩略图")
+}
+
+// TestConfig_ReportThumbnails 测试缩略图数量的默认值和校验
+func TestConfig_ReportThumbnails(t *testing.T) {
+	cfg := config.DefaultConfig()
+	assert.Equal(t, 12, cfg.ReportThumbnails)
+	assert.Empty(t, cfg.HTMLReport, "默认不生成报告")
+
+	cfg.TargetDir = t.TempDir()
+	cfg.ReportThumbnails = -1
+	assert.Error(t, config.ValidateAndNormalize(cfg))
+}
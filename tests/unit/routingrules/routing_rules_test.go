@@ -0,0 +1,203 @@
+package routingrules_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/engine/quality"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeExiftool 假exiftool：相机型号保存在 <文件>.model 中
+const fakeExiftool = `#!/bin/sh
+for last; do :; done
+if [ -f "$last.model" ]; then
+  printf '[{"SourceFile": "%s", "Model": "%s"}]\n' "$last" "$(cat "$last.model")"
+else
+  printf '[{"SourceFile": "%s"}]\n' "$last"
+fi
+`
+
+const testRules = `{
+  "version": 1,
+  "rules": [
+    {"name": "sony", "match": {"exif": {"Model": "ILCE-*"}},
+     "action": {"type": "keep"}},
+    {"name": "screenshots", "match": {"path_globs": ["**/Screenshots/**"], "alpha": true},
+     "action": {"type": "convert", "format": "jxl", "lossless": true, "effort": 9}},
+    {"name": "deep-png", "match": {"extensions": ["PNG"], "min_bit_depth": 16},
+     "action": {"type": "convert", "format": "jxl", "lossless": false, "quality": 95}},
+    {"name": "animations", "match": {"animated": true, "max_size": "1MB"},
+     "action": {"type": "convert", "format": "avif", "quality": 60}},
+    {"name": "tiny", "match": {"max_width": 64, "max_height": 64},
+     "action": {"type": "skip"}}
+  ]
+}`
+
+type rulesEnv struct {
+	dir    string
+	router *engine.AutoPlusRouter
+}
+
+func setupRulesEnv(t *testing.T) *rulesEnv {
+	dir := t.TempDir()
+	exiftool := filepath.Join(dir, "exiftool")
+	require.NoError(t, os.WriteFile(exiftool, []byte(fakeExiftool), 0755))
+
+	rules, err := engine.ParseRoutingRules([]byte(testRules))
+	require.NoError(t, err)
+
+	logger := zaptest.NewLogger(t)
+	router := engine.NewAutoPlusRouter(logger, quality.NewQualityEngine(logger, "", "", true), nil, nil,
+		types.ToolCheckResults{HasExiftool: true, ExiftoolPath: exiftool}, false)
+	router.SetRoutingRules(rules)
+	return &rulesEnv{dir: dir, router: router}
+}
+
+func (env *rulesEnv) path(t *testing.T, name string) string {
+	path := filepath.Join(env.dir, "library", name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	return path
+}
+
+func (env *rulesEnv) writePNG(t *testing.T, name string, img image.Image) string {
+	path := env.path(t, name)
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, png.Encode(file, img))
+	return path
+}
+
+func (env *rulesEnv) writeJPEG(t *testing.T, name string, size int) string {
+	path := env.path(t, name)
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, size, size)), &jpeg.Options{Quality: 90}))
+	return path
+}
+
+func opaqueImage(size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+	return img
+}
+
+// TestRoutingRules_FirstMatchWins 测试规则按顺序匹配、记录命中的规则与动作参数
+func TestRoutingRules_FirstMatchWins(t *testing.T) {
+	env := setupRulesEnv(t)
+	ctx := context.Background()
+
+	// 透明截图：路径与透明通道同时满足
+	screenshot := env.writePNG(t, "Screenshots/shot.png", image.NewNRGBA(image.Rect(0, 0, 200, 100)))
+	decision := env.router.RouteFile(ctx, screenshot)
+	assert.Equal(t, "screenshots", decision.Rule)
+	assert.Equal(t, "convert", decision.Strategy)
+	assert.Equal(t, "jxl", decision.TargetFormat)
+	require.NotNil(t, decision.Lossless)
+	assert.True(t, *decision.Lossless)
+	assert.Equal(t, 9, decision.Effort)
+	assert.Equal(t, types.QualityHigh, decision.QualityLevel, "品质等级沿用内置评估")
+
+	// 同目录不透明的图片不命中截图规则
+	opaque := env.writePNG(t, "Screenshots/opaque.png", opaqueImage(200))
+	assert.Equal(t, engine.BuiltinRoutingRule, env.router.RouteFile(ctx, opaque).Rule)
+
+	// 16位PNG
+	deep := env.writePNG(t, "scan.png", image.NewRGBA64(image.Rect(0, 0, 200, 200)))
+	decision = env.router.RouteFile(ctx, deep)
+	assert.Equal(t, "deep-png", decision.Rule)
+	require.NotNil(t, decision.Lossless)
+	assert.False(t, *decision.Lossless)
+	assert.Equal(t, 95, decision.Quality)
+
+	// EXIF相机型号优先于之后的尺寸规则
+	sony := env.writeJPEG(t, "DSC0001.jpg", 32)
+	require.NoError(t, os.WriteFile(sony+".model", []byte("ILCE-7M3"), 0644))
+	decision = env.router.RouteFile(ctx, sony)
+	assert.Equal(t, "sony", decision.Rule)
+	assert.Equal(t, "keep", decision.Strategy)
+
+	// 其他相机的小图命中尺寸规则
+	tiny := env.writeJPEG(t, "IMG_0001.jpg", 32)
+	require.NoError(t, os.WriteFile(tiny+".model", []byte("iPhone 15"), 0644))
+	decision = env.router.RouteFile(ctx, tiny)
+	assert.Equal(t, "tiny", decision.Rule)
+	assert.Equal(t, "skip", decision.Strategy)
+
+	stats := env.router.GetRoutingStatistics()
+	assert.Equal(t, 5, stats.TotalFiles)
+	assert.Equal(t, 1, stats.RuleHits["screenshots"])
+	assert.Equal(t, 1, stats.RuleHits[engine.BuiltinRoutingRule])
+}
+
+// TestRoutingRules_AnimatedGIF 测试GIF帧数识别：多帧命中动画规则，单帧不命中
+func TestRoutingRules_AnimatedGIF(t *testing.T) {
+	env := setupRulesEnv(t)
+	palette := color.Palette{color.Black, color.White}
+
+	writeGIF := func(name string, frames int) string {
+		anim := &gif.GIF{}
+		for i := 0; i < frames; i++ {
+			anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 100, 100), palette))
+			anim.Delay = append(anim.Delay, 10)
+		}
+		path := env.path(t, name)
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		defer file.Close()
+		require.NoError(t, gif.EncodeAll(file, anim))
+		return path
+	}
+
+	decision := env.router.RouteFile(context.Background(), writeGIF("anim.gif", 3))
+	assert.Equal(t, "animations", decision.Rule)
+	assert.Equal(t, "avif", decision.TargetFormat)
+	assert.Equal(t, 60, decision.Quality)
+
+	assert.Equal(t, engine.BuiltinRoutingRule, env.router.RouteFile(context.Background(), writeGIF("still.gif", 1)).Rule)
+}
+
+// TestRoutingRules_Validation 测试规则文件校验
+func TestRoutingRules_Validation(t *testing.T) {
+	invalid := map[string]string{
+		"未知动作":   `{"rules": [{"action": {"type": "delete"}}]}`,
+		"未知格式":   `{"rules": [{"action": {"type": "convert", "format": "bmp"}}]}`,
+		"重复规则名":  `{"rules": [{"name": "a", "action": {"type": "skip"}}, {"name": "a", "action": {"type": "skip"}}]}`,
+		"保留规则名":  `{"rules": [{"name": "builtin", "action": {"type": "skip"}}]}`,
+		"未知品质等级": `{"rules": [{"match": {"quality_levels": ["great"]}, "action": {"type": "skip"}}]}`,
+		"努力值越界":  `{"rules": [{"action": {"type": "convert", "format": "jxl", "effort": 12}}]}`,
+		"版本不支持":  `{"version": 2, "rules": []}`,
+		"大小无效":   `{"rules": [{"match": {"min_size": "lots"}, "action": {"type": "skip"}}]}`,
+	}
+	for name, data := range invalid {
+		_, err := engine.ParseRoutingRules([]byte(data))
+		assert.Error(t, err, name)
+	}
+
+	rules, err := engine.ParseRoutingRules([]byte(`{"rules": [
+		{"match": {"min_size": "1.5MB", "max_size": 4096}, "action": {"type": "skip"}}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "rule-1", rules.Rules[0].Name)
+	assert.Equal(t, engine.ByteSize(1536*1024), rules.Rules[0].Match.MinSize)
+	assert.Equal(t, engine.ByteSize(4096), rules.Rules[0].Match.MaxSize)
+
+	_, err = engine.LoadRoutingRules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,239 @@
+package scanindex_test
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+	"pixly/pkg/engine/quality"
+	"pixly/pkg/scanner"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeProbe 假ffprobe/exiftool：每次调用在 FAKE_TOOL_LOG 中追加一行，并输出一个静态图像流
+const fakeProbe = `#!/bin/sh
+echo "$(basename "$0") $*" >> "$FAKE_TOOL_LOG"
+cat <<'JSON'
+{"streams": [{"index": 0, "codec_name": "mjpeg", "codec_type": "video", "width": 800, "height": 600, "nb_frames": "1"}],
+ "format": {"format_name": "image2", "duration": "0", "size": "4096"}}
+JSON
+`
+
+// fakeExiftool 假exiftool：记录调用，并为每个文件输出同一个 ContentIdentifier
+const fakeExiftool = `#!/bin/sh
+echo "$(basename "$0") $*" >> "$FAKE_TOOL_LOG"
+printf '['
+sep=''
+for arg; do
+  case "$arg" in -*) continue ;; esac
+  printf '%s{"SourceFile": "%s", "ContentIdentifier": "LIVE-1"}' "$sep" "$arg"
+  sep=','
+done
+printf ']\n'
+`
+
+type indexEnv struct {
+	dir      string
+	ffprobe  string
+	exiftool string
+	toolLog  string
+	state    *state.StateManager
+}
+
+func setupIndexEnv(t *testing.T) *indexEnv {
+	toolsDir := t.TempDir()
+	env := &indexEnv{
+		dir:      t.TempDir(),
+		ffprobe:  filepath.Join(toolsDir, "ffprobe"),
+		exiftool: filepath.Join(toolsDir, "exiftool"),
+		toolLog:  filepath.Join(toolsDir, "calls.log"),
+	}
+	require.NoError(t, os.WriteFile(env.ffprobe, []byte(fakeProbe), 0755))
+	require.NoError(t, os.WriteFile(env.exiftool, []byte(fakeProbe), 0755))
+	t.Setenv("FAKE_TOOL_LOG", env.toolLog)
+
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+	env.state = sm
+	return env
+}
+
+func (env *indexEnv) writeFile(t *testing.T, name string, size int) string {
+	path := filepath.Join(env.dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	data := make([]byte, size)
+	copy(data, []byte{0xFF, 0xD8, 0xFF, 0xE0})
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// toolCalls 返回并清空工具调用记录
+func (env *indexEnv) toolCalls(t *testing.T) []string {
+	data, err := os.ReadFile(env.toolLog)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(env.toolLog))
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// scan 每次使用全新的扫描架构（无内存缓存），只共享持久化索引
+func (env *indexEnv) scan(t *testing.T) int {
+	logger := zaptest.NewLogger(t)
+	arch := scanner.NewUnifiedScanArchitecture(logger,
+		scanner.NewScanner(logger),
+		scanner.NewFileMorphologyClassifier(logger, env.ffprobe, env.exiftool),
+		quality.NewQualityEngine(logger, env.ffprobe, "", false),
+		t.TempDir())
+	arch.SetScanIndex(scanner.NewScanIndex(logger, env.state))
+
+	result, err := arch.ExecuteUnifiedScan(context.Background(), env.dir)
+	require.NoError(t, err)
+	return len(result.MediaFiles)
+}
+
+// TestScanIndex_UnchangedLibrarySkipsProbing 测试重新扫描未变化的目录不再调用ffprobe/exiftool
+func TestScanIndex_UnchangedLibrarySkipsProbing(t *testing.T) {
+	env := setupIndexEnv(t)
+	env.writeFile(t, "a.jpg", 4096)
+	changed := env.writeFile(t, "sub/b.jpg", 4096)
+	env.writeFile(t, "sub/c.png", 4096)
+
+	assert.Equal(t, 3, env.scan(t))
+	assert.NotEmpty(t, env.toolCalls(t), "首次扫描应调用分析工具")
+
+	assert.Equal(t, 3, env.scan(t))
+	assert.Empty(t, env.toolCalls(t), "未变化的文件不应再次分析")
+
+	// 只有变化的文件被重新分析
+	require.NoError(t, os.WriteFile(changed, make([]byte, 8192), 0644))
+	assert.Equal(t, 3, env.scan(t))
+	calls := env.toolCalls(t)
+	require.NotEmpty(t, calls)
+	for _, call := range calls {
+		assert.Contains(t, call, "b.jpg")
+	}
+}
+
+// TestScanIndex_Fingerprint 测试大小、修改时间、inode 与格式版本任一变化即失效
+func TestScanIndex_Fingerprint(t *testing.T) {
+	env := setupIndexEnv(t)
+	path := env.writeFile(t, "photo.jpg", 4096)
+	index := scanner.NewScanIndex(zaptest.NewLogger(t), env.state)
+
+	fingerprintOf := func() scanner.FileFingerprint {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		return scanner.FingerprintOf(info)
+	}
+
+	original := fingerprintOf()
+	assert.NotZero(t, original.Inode)
+	assert.Nil(t, index.Lookup(path, original))
+
+	morphology := &scanner.MorphologyResult{FilePath: path, TrueFormat: "jpeg"}
+	require.NoError(t, index.Store(path, &scanner.ScanIndexEntry{Fingerprint: original, Morphology: morphology}))
+
+	// 分别写入的品质评估与已有的形态分析合并
+	require.NoError(t, index.Store(path, &scanner.ScanIndexEntry{Fingerprint: original, Quality: &quality.QualityAssessment{FilePath: path, Score: 80}}))
+	entry := index.Lookup(path, original)
+	require.NotNil(t, entry)
+	assert.Equal(t, scanner.ScanIndexSchemaVersion, entry.SchemaVersion)
+	require.NotNil(t, entry.Morphology)
+	assert.Equal(t, "jpeg", entry.Morphology.TrueFormat)
+	require.NotNil(t, entry.Quality)
+	assert.Equal(t, 80.0, entry.Quality.Score)
+
+	// 修改时间变化
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, later, later))
+	assert.Nil(t, index.Lookup(path, fingerprintOf()))
+
+	// 原子替换：大小与修改时间相同但inode不同
+	replacement := path + ".tmp"
+	require.NoError(t, os.WriteFile(replacement, make([]byte, 4096), 0644))
+	require.NoError(t, os.Chtimes(replacement, later, later))
+	before := fingerprintOf()
+	require.NoError(t, index.Store(path, &scanner.ScanIndexEntry{Fingerprint: before, Morphology: morphology}))
+	require.NotNil(t, index.Lookup(path, before))
+	require.NoError(t, os.Rename(replacement, path))
+	after := fingerprintOf()
+	assert.Equal(t, before.Size, after.Size)
+	assert.Equal(t, before.ModTimeNs, after.ModTimeNs)
+	assert.NotEqual(t, before.Inode, after.Inode)
+	assert.Nil(t, index.Lookup(path, after), "inode变化的文件不应命中")
+
+	hits, misses, stale := index.Stats()
+	assert.Equal(t, int64(2), hits)
+	assert.Equal(t, int64(1), misses)
+	assert.Equal(t, int64(2), stale)
+
+	// 删除后重新未命中
+	require.NoError(t, index.Invalidate(path))
+	assert.Nil(t, index.Lookup(path, original))
+}
+
+// convert 每次使用全新的引擎按自动模式+模拟运行，只共享状态数据库
+func (env *indexEnv) convert(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.TargetDir = env.dir
+	cfg.Mode = "auto+"
+	cfg.DryRun = true
+	require.NoError(t, config.ValidateAndNormalize(cfg))
+
+	tools := types.ToolCheckResults{
+		HasFfmpeg: true, FfmpegStablePath: env.ffprobe,
+		HasExiftool: true, ExiftoolPath: env.exiftool,
+	}
+	conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, tools, nil)
+	conversionEngine.SetStateManager(env.state)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, conversionEngine.Execute(ctx))
+}
+
+// TestScanIndex_ConversionSkipsProbingUnchangedFiles 测试转换流程中未变化的文件不再为评估、
+// 自动模式+深度分析或 Live Photo 配对调用 ffprobe/exiftool
+func TestScanIndex_ConversionSkipsProbingUnchangedFiles(t *testing.T) {
+	env := setupIndexEnv(t)
+	require.NoError(t, os.WriteFile(env.exiftool, []byte(fakeExiftool), 0755))
+
+	still := filepath.Join(env.dir, "IMG_0001.jpg")
+	file, err := os.Create(still)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, 64, 64)), &jpeg.Options{Quality: 90}))
+	require.NoError(t, file.Close())
+	env.writeFile(t, "IMG_0001.mov", 4096)
+	deep := env.writeFile(t, "clip.mkv", 4096) // 扩展名无法快速预判，需要深度分析
+
+	env.convert(t)
+	calls := strings.Join(env.toolCalls(t), "\n")
+	assert.Contains(t, calls, "ffprobe", "首次运行应评估文件")
+	assert.Contains(t, calls, "exiftool -json -ContentIdentifier", "首次运行应读取Live Photo配对标识")
+
+	env.convert(t)
+	assert.Empty(t, env.toolCalls(t), "未变化的文件不应再次评估、深度分析或读取配对标识")
+
+	// 只有变化的文件被重新分析
+	require.NoError(t, os.WriteFile(deep, make([]byte, 8192), 0644))
+	env.convert(t)
+	changed := env.toolCalls(t)
+	require.NotEmpty(t, changed)
+	for _, call := range changed {
+		assert.Contains(t, call, "clip.mkv")
+	}
+}
@@ -0,0 +1,213 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type testServer struct {
+	*server.Server
+	url   string
+	state *state.StateManager
+}
+
+func newTestServer(t *testing.T) *testServer {
+	stateManager, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { stateManager.Close() })
+
+	configDir := t.TempDir()
+	jobServer := server.New(zaptest.NewLogger(t), types.ToolCheckResults{HasFfmpeg: true}, stateManager, server.Options{
+		ConfigOptions: config.LoadOptions{SystemDir: configDir, UserDir: configDir, Env: []string{}},
+		EventInterval: 20 * time.Millisecond,
+	})
+	httpServer := httptest.NewServer(jobServer.Handler())
+	t.Cleanup(httpServer.Close)
+	return &testServer{Server: jobServer, url: httpServer.URL, state: stateManager}
+}
+
+// startRunner 启动任务执行循环
+func (s *testServer) startRunner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func (s *testServer) post(t *testing.T, path string, body interface{}) (*http.Response, map[string]interface{}) {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := http.Post(s.url+path, "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var decoded map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+	return resp, decoded
+}
+
+func mediaDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really an image"), 0644))
+	}
+	return dir
+}
+
+func TestServerRunsJobAndStreamsProgress(t *testing.T) {
+	srv := newTestServer(t)
+	dir := mediaDir(t)
+
+	resp, job := srv.post(t, "/jobs", map[string]interface{}{
+		"dir":    dir,
+		"config": map[string]interface{}{"dry_run": true, "mode": "quality", "concurrent_jobs": 1},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "queued", job["state"])
+	id := job["id"].(string)
+
+	srv.startRunner(t)
+
+	events, err := http.Get(srv.url + "/jobs/" + id + "/events")
+	require.NoError(t, err)
+	defer events.Body.Close()
+	assert.Equal(t, "text/event-stream", events.Header.Get("Content-Type"))
+
+	var lastEvent, lastData string
+	scanner := bufio.NewScanner(events.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			lastEvent = name
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			lastData = data
+		}
+	}
+	require.Equal(t, "done", lastEvent)
+
+	var status server.JobStatus
+	require.NoError(t, json.Unmarshal([]byte(lastData), &status))
+	assert.Equal(t, server.JobCompleted, status.State, status.Error)
+	require.NotNil(t, status.Progress)
+	assert.Equal(t, 2, status.Progress.AssessmentProgress)
+
+	filesResp, err := http.Get(srv.url + "/jobs/" + id + "/files")
+	require.NoError(t, err)
+	defer filesResp.Body.Close()
+	var files []server.FileStatus
+	require.NoError(t, json.NewDecoder(filesResp.Body).Decode(&files))
+	require.Len(t, files, 2)
+	assert.Equal(t, filepath.Join(dir, "a.png"), files[0].Path)
+	assert.NotEqual(t, "pending", files[0].Status)
+
+	resp, _ = srv.post(t, "/jobs/"+id+"/pause", nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "已结束的任务不能暂停")
+
+	listResp, err := http.Get(srv.url + "/jobs")
+	require.NoError(t, err)
+	defer listResp.Body.Close()
+	var list []server.JobStatus
+	require.NoError(t, json.NewDecoder(listResp.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, id, list[0].ID)
+}
+
+func TestServerCancelsQueuedJob(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, job := srv.post(t, "/jobs", map[string]interface{}{"dir": mediaDir(t), "profile": "archive"})
+	id := job["id"].(string)
+	assert.Equal(t, "archive", job["profile"])
+	assert.Equal(t, "quality", job["mode"])
+
+	resp, cancelled := srv.post(t, "/jobs/"+id+"/cancel", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "cancelled", cancelled["state"])
+
+	resp, _ = srv.post(t, "/jobs/"+id+"/cancel", nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// 已取消的任务不会被执行
+	srv.startRunner(t)
+	jobRef, ok := srv.Job(id)
+	require.True(t, ok)
+	select {
+	case <-jobRef.Done():
+	default:
+		t.Fatal("取消的任务应已结束")
+	}
+	assert.Nil(t, jobRef.Status().StartedAt)
+}
+
+func TestServerRejectsInvalidJobs(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := srv.post(t, "/jobs", map[string]interface{}{"dir": mediaDir(t), "config": map[string]interface{}{"crf": 80}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "无效的CRF值")
+	assert.Contains(t, body["error"], "来源: flag crf")
+
+	resp, body = srv.post(t, "/jobs", map[string]interface{}{"dir": mediaDir(t), "profile": "nope"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "nope")
+
+	resp, _ = srv.post(t, "/jobs", map[string]interface{}{"dir": filepath.Join(t.TempDir(), "missing")})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	notFound, err := http.Get(srv.url + "/jobs/job-unknown")
+	require.NoError(t, err)
+	notFound.Body.Close()
+	assert.Equal(t, http.StatusNotFound, notFound.StatusCode)
+}
+
+func TestServerQueueControls(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jpg")
+	require.NoError(t, srv.state.EnqueueJob(&state.QueueEntry{Path: path, Members: []string{path}}))
+
+	resp, _ := srv.post(t, "/queue/priority", map[string]interface{}{"path": path, "priority": 7})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = srv.post(t, "/queue/cancel", map[string]interface{}{"path": filepath.Join(dir, "missing.jpg")})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body := srv.post(t, "/queue/pause", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, body["paused"])
+	resp, _ = srv.post(t, "/queue/resume", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	queueResp, err := http.Get(srv.url + "/queue?dir=" + dir)
+	require.NoError(t, err)
+	defer queueResp.Body.Close()
+	var status server.QueueStatus
+	require.NoError(t, json.NewDecoder(queueResp.Body).Decode(&status))
+	assert.False(t, status.Paused)
+	require.Len(t, status.Entries, 1)
+	assert.Equal(t, 7, status.Entries[0].Priority)
+	assert.Equal(t, state.QueueQueued, status.Entries[0].State)
+}
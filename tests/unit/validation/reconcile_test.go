@@ -0,0 +1,251 @@
+package validation_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/state"
+	"pixly/pkg/core/types"
+	"pixly/pkg/validation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeDjxl 假djxl：测试中的 .jxl 文件直接保存 PNG 字节，“解码”即复制
+const fakeDjxl = `#!/bin/sh
+cp "$1" "$2"
+`
+
+func writeScript(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	return path
+}
+
+// encodePNG 生成 4x4 纯色 PNG；paletted 为 true 时使用调色板编码，像素相同而字节不同
+func encodePNG(t *testing.T, c color.NRGBA, paletted bool) []byte {
+	var img image.Image
+	if paletted {
+		img = image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{c})
+	} else {
+		rgba := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				rgba.SetNRGBA(x, y, c)
+			}
+		}
+		img = rgba
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// animatePNG 在IHDR之后插入声明 frames 帧的acTL块，得到APNG头部
+func animatePNG(data []byte, frames uint32) []byte {
+	const ihdrEnd = 8 + 12 + 13 // 签名 + IHDR块
+	body := append([]byte("acTL"), binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, frames), 0)...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+
+	animated := append([]byte{}, data[:ihdrEnd]...)
+	animated = append(animated, chunk...)
+	return append(animated, data[ihdrEnd:]...)
+}
+
+// tiffPages 生成只有 pages 个空IFD的小端TIFF
+func tiffPages(pages int) []byte {
+	data := []byte{'I', 'I', 42, 0}
+	offset := uint32(8)
+	data = binary.LittleEndian.AppendUint32(data, offset)
+	for i := 0; i < pages; i++ {
+		next := offset + 6
+		if i == pages-1 {
+			next = 0
+		}
+		data = binary.LittleEndian.AppendUint16(data, 0)
+		data = binary.LittleEndian.AppendUint32(data, next)
+		offset = next
+	}
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func newReconciler(t *testing.T, jpegMatches map[string]bool) *validation.Reconciler {
+	reconciler := validation.NewReconciler(zaptest.NewLogger(t), func(ctx context.Context, jpegPath, jxlPath string) (bool, error) {
+		return jpegMatches[filepath.Base(jpegPath)], nil
+	})
+	reconciler.SetTools(writeScript(t, "djxl", fakeDjxl), "")
+	return reconciler
+}
+
+func pairsBySource(result *validation.ReconcileResult) map[string]validation.ReconcilePair {
+	pairs := make(map[string]validation.ReconcilePair)
+	for _, pair := range result.Pairs {
+		pairs[filepath.Base(pair.Source)] = pair
+	}
+	return pairs
+}
+
+// TestReconcile_VerifiesPairs 测试按同名配对，JPEG重建和像素哈希分别给出等价/不一致结论
+func TestReconcile_VerifiesPairs(t *testing.T) {
+	dir := t.TempDir()
+	red := color.NRGBA{R: 255, A: 255}
+	writeFile(t, filepath.Join(dir, "same.png"), encodePNG(t, red, false))
+	writeFile(t, filepath.Join(dir, "same.jxl"), encodePNG(t, red, true))
+	writeFile(t, filepath.Join(dir, "edited.png"), encodePNG(t, red, false))
+	writeFile(t, filepath.Join(dir, "edited.jxl"), encodePNG(t, color.NRGBA{B: 255, A: 255}, false))
+	writeFile(t, filepath.Join(dir, "photo.jpg"), []byte("jpeg"))
+	writeFile(t, filepath.Join(dir, "photo.jxl"), []byte("jxl"))
+	writeFile(t, filepath.Join(dir, "other.jpg"), []byte("jpeg"))
+	writeFile(t, filepath.Join(dir, "other.jxl"), []byte("jxl"))
+	writeFile(t, filepath.Join(dir, "lossy.png"), encodePNG(t, red, false))
+	writeFile(t, filepath.Join(dir, "lossy.avif"), []byte("avif"))
+	writeFile(t, filepath.Join(dir, "alone.png"), encodePNG(t, red, false))
+
+	result, err := newReconciler(t, map[string]bool{"photo.jpg": true}).
+		ReconcileDirectory(context.Background(), dir, validation.ReconcileOptions{})
+	require.NoError(t, err)
+
+	pairs := pairsBySource(result)
+	require.Len(t, pairs, 5, "没有输出的源文件不参与配对")
+	assert.Equal(t, validation.ReconcileEquivalent, pairs["same.png"].Status, "调色板与真彩色编码的相同像素视为等价")
+	assert.Equal(t, validation.ReconcileMethodPixelHash, pairs["same.png"].Method)
+	assert.Equal(t, validation.ReconcileMatchedByBasename, pairs["same.png"].MatchedBy)
+	assert.Equal(t, validation.ReconcileNotEquivalent, pairs["edited.png"].Status)
+	assert.Equal(t, validation.ReconcileEquivalent, pairs["photo.jpg"].Status)
+	assert.Equal(t, validation.ReconcileMethodJPEGReconstruction, pairs["photo.jpg"].Method)
+	assert.Equal(t, validation.ReconcileNotEquivalent, pairs["other.jpg"].Status)
+	assert.Equal(t, validation.ReconcileUnverified, pairs["lossy.png"].Status, "有损输出无法验证")
+
+	assert.Equal(t, 2, result.Equivalent)
+	assert.Equal(t, 2, result.NotEquivalent)
+	assert.Equal(t, 1, result.Unverified)
+	assert.Zero(t, result.Deleted)
+	assert.FileExists(t, filepath.Join(dir, "same.png"), "未指定删除时只报告")
+}
+
+// TestReconcile_DeletesOnlyEquivalent 测试 --delete 只删除验证等价的源文件
+func TestReconcile_DeletesOnlyEquivalent(t *testing.T) {
+	dir := t.TempDir()
+	red := color.NRGBA{R: 255, A: 255}
+	same := encodePNG(t, red, false)
+	writeFile(t, filepath.Join(dir, "same.png"), same)
+	writeFile(t, filepath.Join(dir, "same.jxl"), same)
+	writeFile(t, filepath.Join(dir, "edited.png"), same)
+	writeFile(t, filepath.Join(dir, "edited.jxl"), encodePNG(t, color.NRGBA{G: 255, A: 255}, false))
+	writeFile(t, filepath.Join(dir, "photo.jpg"), []byte("jpeg"))
+	writeFile(t, filepath.Join(dir, "photo.jxl"), []byte("jxl"))
+
+	result, err := newReconciler(t, nil).
+		ReconcileDirectory(context.Background(), dir, validation.ReconcileOptions{Delete: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Deleted)
+	assert.EqualValues(t, len(same), result.FreedBytes)
+	assert.NoFileExists(t, filepath.Join(dir, "same.png"))
+	assert.FileExists(t, filepath.Join(dir, "same.jxl"))
+	assert.FileExists(t, filepath.Join(dir, "edited.png"))
+	assert.FileExists(t, filepath.Join(dir, "photo.jpg"))
+}
+
+// TestReconcile_MissingDecoder 测试没有 djxl 时像素哈希配对标记为无法验证
+func TestReconcile_MissingDecoder(t *testing.T) {
+	dir := t.TempDir()
+	data := encodePNG(t, color.NRGBA{R: 255, A: 255}, false)
+	writeFile(t, filepath.Join(dir, "same.png"), data)
+	writeFile(t, filepath.Join(dir, "same.jxl"), data)
+
+	reconciler := validation.NewReconciler(zaptest.NewLogger(t), nil)
+	reconciler.SetTools(writeScript(t, "djxl", "#!/bin/sh\nexit 1\n"), "")
+	result, err := reconciler.ReconcileDirectory(context.Background(), dir, validation.ReconcileOptions{Delete: true})
+	require.NoError(t, err)
+
+	require.Len(t, result.Pairs, 1)
+	assert.Equal(t, validation.ReconcileUnverified, result.Pairs[0].Status)
+	assert.FileExists(t, filepath.Join(dir, "same.png"), "无法验证时不删除")
+}
+
+// TestReconcile_Provenance 测试按状态数据库中的转换记录配对不同名的输出
+func TestReconcile_Provenance(t *testing.T) {
+	sm, err := state.NewStateManager(false)
+	require.NoError(t, err)
+	t.Cleanup(func() { sm.Close() })
+
+	dir := t.TempDir()
+	data := encodePNG(t, color.NRGBA{R: 255, A: 255}, false)
+	source := filepath.Join(dir, "scan.png")
+	target := filepath.Join(dir, "converted", "scan_1.jxl")
+	writeFile(t, source, data)
+	writeFile(t, target, data)
+	require.NoError(t, sm.SaveDecisions(source, []types.DecisionRecord{{
+		Stage:   types.DecisionStageResult,
+		Branch:  "success",
+		Outcome: "success",
+		Values:  map[string]interface{}{"target_path": target},
+	}}))
+
+	reconciler := newReconciler(t, nil)
+	reconciler.SetStateManager(sm)
+	result, err := reconciler.ReconcileDirectory(context.Background(), dir, validation.ReconcileOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, result.Pairs, 1)
+	assert.Equal(t, target, result.Pairs[0].Target)
+	assert.Equal(t, validation.ReconcileMatchedByProvenance, result.Pairs[0].MatchedBy)
+	assert.Equal(t, validation.ReconcileEquivalent, result.Pairs[0].Status)
+}
+
+// TestReconcile_MultiFrameUnverified 测试APNG、多页TIFF和动画输出只比较首帧不足以证明等价，不删除源文件
+func TestReconcile_MultiFrameUnverified(t *testing.T) {
+	dir := t.TempDir()
+	still := encodePNG(t, color.NRGBA{R: 255, A: 255}, false)
+	animated := animatePNG(still, 2)
+	writeFile(t, filepath.Join(dir, "anim.png"), animated)
+	writeFile(t, filepath.Join(dir, "anim.jxl"), animated)
+	writeFile(t, filepath.Join(dir, "pages.tif"), tiffPages(3))
+	writeFile(t, filepath.Join(dir, "pages.jxl"), still)
+	writeFile(t, filepath.Join(dir, "still.png"), still)
+	writeFile(t, filepath.Join(dir, "still.jxl"), animated)
+	writeFile(t, filepath.Join(dir, "single.png"), animatePNG(still, 1))
+	writeFile(t, filepath.Join(dir, "single.jxl"), still)
+
+	result, err := newReconciler(t, nil).
+		ReconcileDirectory(context.Background(), dir, validation.ReconcileOptions{Delete: true})
+	require.NoError(t, err)
+
+	pairs := pairsBySource(result)
+	tests := []struct {
+		source string
+		reason string
+	}{
+		{source: "anim.png", reason: "包含 2 帧"},
+		{source: "pages.tif", reason: "包含 3 帧"},
+		{source: "still.png", reason: "输出包含 2 帧"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			assert.Equal(t, validation.ReconcileUnverified, pairs[tt.source].Status)
+			assert.Contains(t, pairs[tt.source].Reason, tt.reason)
+			assert.FileExists(t, filepath.Join(dir, tt.source))
+		})
+	}
+
+	assert.Equal(t, validation.ReconcileEquivalent, pairs["single.png"].Status, "只有一帧的APNG按静态图比较")
+	assert.Equal(t, 1, result.Deleted)
+}
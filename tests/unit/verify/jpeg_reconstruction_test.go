@@ -0,0 +1,126 @@
+package verify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pixly/pkg/core/config"
+	"pixly/pkg/core/types"
+	"pixly/pkg/engine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// writeFakeDjxl 写出假djxl：把"JXL"文件内容原样作为重建结果
+func writeFakeDjxl(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "djxl")
+	script := "#!/bin/sh\ncp \"$1\" \"$2\"\n"
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+// TestJPEGReconstructionVerifier 测试重建结果与原始JPEG的SHA-256比较
+func TestJPEGReconstructionVerifier(t *testing.T) {
+	dir := t.TempDir()
+	verifier := engine.NewJPEGReconstructionVerifier(writeFakeDjxl(t, dir), dir, nil)
+	require.True(t, verifier.Available())
+
+	jpegPath := filepath.Join(dir, "photo.jpg")
+	require.NoError(t, os.WriteFile(jpegPath, []byte("\xff\xd8original jpeg bytes\xff\xd9"), 0644))
+
+	exact := filepath.Join(dir, "exact.jxl")
+	require.NoError(t, os.WriteFile(exact, []byte("\xff\xd8original jpeg bytes\xff\xd9"), 0644))
+	check, err := verifier.Verify(context.Background(), jpegPath, exact)
+	require.NoError(t, err)
+	assert.True(t, check.Match)
+	assert.Equal(t, check.SourceSHA256, check.ReconstructedSHA256)
+	assert.Len(t, check.SourceSHA256, 64)
+
+	drifted := filepath.Join(dir, "drifted.jxl")
+	require.NoError(t, os.WriteFile(drifted, []byte("\xff\xd8original jpeg bytez\xff\xd9"), 0644))
+	check, err = verifier.Verify(context.Background(), jpegPath, drifted)
+	require.NoError(t, err)
+	assert.False(t, check.Match)
+	assert.NotEqual(t, check.SourceSHA256, check.ReconstructedSHA256)
+
+	// 重建失败（djxl退出码非0）返回错误
+	_, err = verifier.Verify(context.Background(), jpegPath, filepath.Join(dir, "missing.jxl"))
+	assert.Error(t, err)
+}
+
+// TestKeepOriginalError 测试保留原文件错误可被识别
+func TestKeepOriginalError(t *testing.T) {
+	var err error = fmt.Errorf("wrapped: %w", &engine.KeepOriginalError{SourcePath: "/a/photo.jpg", Reason: "mismatch"})
+
+	var keepErr *engine.KeepOriginalError
+	require.True(t, errors.As(err, &keepErr))
+	assert.Contains(t, keepErr.Error(), "photo.jpg")
+	assert.Contains(t, keepErr.Error(), "mismatch")
+}
+
+// fakeCjxl 假cjxl：把JPEG原样写入"JXL"，配合假djxl可逐位重建
+const fakeCjxl = "#!/bin/sh\ncp \"$1\" \"$2\"\n"
+
+// fakeExiftool 假exiftool：读取时输出一个字段；写入时若设置了 FAKE_EXIFTOOL_APPEND，
+// 就在目标文件末尾追加该内容，模拟元数据写入改写JXL
+const fakeExiftool = `#!/bin/sh
+for last; do :; done
+case "$1" in
+  -json) echo '[{"SourceFile": "'"$last"'", "Make": "Pixly"}]'; exit 0 ;;
+esac
+if [ -n "$FAKE_EXIFTOOL_APPEND" ]; then printf '%s' "$FAKE_EXIFTOOL_APPEND" >> "$last"; fi
+`
+
+// TestConvertUnit_VerifiesAfterMetadataMigration 测试JPEG重建校验针对元数据迁移后的最终JXL
+func TestConvertUnit_VerifiesAfterMetadataMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		append string
+		status string
+	}{
+		{name: "迁移不改变重建结果", status: "success"},
+		{name: "迁移破坏重建数据", append: "exif", status: "kept"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tools := t.TempDir()
+			cjxl := filepath.Join(tools, "cjxl")
+			exiftool := filepath.Join(tools, "exiftool")
+			require.NoError(t, os.WriteFile(cjxl, []byte(fakeCjxl), 0755))
+			require.NoError(t, os.WriteFile(exiftool, []byte(fakeExiftool), 0755))
+			t.Setenv("FAKE_EXIFTOOL_APPEND", tt.append)
+
+			source := filepath.Join(dir, "photo.jpg")
+			require.NoError(t, os.WriteFile(source, []byte("\xff\xd8original jpeg bytes\xff\xd9"), 0644))
+
+			cfg := config.DefaultConfig()
+			cfg.TargetDir = dir
+			conversionEngine := engine.NewConversionEngine(zaptest.NewLogger(t), cfg, types.ToolCheckResults{
+				HasCjxl: true, CjxlPath: cjxl, HasExiftool: true, ExiftoolPath: exiftool,
+			}, nil)
+			conversionEngine.SetJPEGReconstructionVerifier(engine.NewJPEGReconstructionVerifier(writeFakeDjxl(t, tools), tools, nil))
+
+			results := conversionEngine.ConvertUnit(context.Background(), engine.QueuedUnit{Tasks: []engine.ConversionTask{
+				{SourcePath: source, TargetFormat: "jxl_lossless", MediaType: "image"},
+			}})
+			require.Len(t, results, 1)
+			assert.Equal(t, tt.status, results[0].Status, results[0].Message)
+
+			target := filepath.Join(dir, "photo.jxl")
+			if tt.status == "success" {
+				assert.FileExists(t, target)
+			} else {
+				assert.NoFileExists(t, target, "未通过校验的JXL被删除")
+			}
+			assert.FileExists(t, source)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package video_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pixly/pkg/engine"
+	"pixly/pkg/ffmpegrouter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeFfmpeg 假ffmpeg：-encoders 输出 FAKE_FFMPEG_ENCODERS 中的编码器，
+// 转码时把参数写入 <输出>.args 并生成 FAKE_FFMPEG_OUT_SIZE 字节的输出
+const fakeFfmpeg = `#!/bin/sh
+case "$1" in
+  -version) echo "ffmpeg version 7.1-test Copyright (c) the FFmpeg developers"; exit 0 ;;
+  -encoders)
+    echo "Encoders:"
+    echo " V..... = Video"
+    echo " A..... = Audio"
+    echo " ------"
+    for enc in $FAKE_FFMPEG_ENCODERS; do echo " V....D $enc   test encoder"; done
+    echo " A....D aac   AAC (Advanced Audio Coding)"
+    exit 0 ;;
+esac
+for last; do :; done
+echo "$@" > "$last.args"
+head -c "${FAKE_FFMPEG_OUT_SIZE:-1000}" /dev/zero > "$last"
+`
+
+// fakeFfprobe 假ffprobe：输出 FAKE_FFPROBE_JSON 指向的文件
+const fakeFfprobe = `#!/bin/sh
+cat "$FAKE_FFPROBE_JSON"
+`
+
+const probeH264TenBit = `{
+  "streams": [
+    {"codec_type": "video", "codec_name": "h264", "pix_fmt": "yuv420p10le", "width": 1920, "height": 1080,
+     "bit_rate": "20000000", "avg_frame_rate": "30/1"},
+    {"codec_type": "audio", "codec_name": "aac"}
+  ],
+  "format": {"duration": "12.5", "bit_rate": "20200000"}
+}`
+
+type videoEnv struct {
+	dir     string
+	ffprobe string
+	source  string
+}
+
+// setupVideoEnv 写出假工具并创建4000字节的源视频
+func setupVideoEnv(t *testing.T, encoders string, probeJSON string) *videoEnv {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(fakeFfmpeg), 0755))
+	ffprobe := filepath.Join(dir, "ffprobe")
+	require.NoError(t, os.WriteFile(ffprobe, []byte(fakeFfprobe), 0755))
+
+	probePath := filepath.Join(dir, "probe.json")
+	require.NoError(t, os.WriteFile(probePath, []byte(probeJSON), 0644))
+
+	source := filepath.Join(dir, "clip.mov")
+	require.NoError(t, os.WriteFile(source, make([]byte, 4000), 0644))
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_FFMPEG_ENCODERS", encoders)
+	t.Setenv("FAKE_FFPROBE_JSON", probePath)
+	return &videoEnv{dir: dir, ffprobe: ffprobe, source: source}
+}
+
+func newTranscoder(t *testing.T, env *videoEnv, options engine.VideoTranscodeOptions) *engine.VideoTranscodeMode {
+	logger := zaptest.NewLogger(t)
+	router, err := ffmpegrouter.NewFFmpegRouter(logger, &ffmpegrouter.RouterConfig{
+		PreferSystemVersion: true,
+		MaxFailureCount:     3,
+		SystemSearchPaths:   []string{env.dir},
+	})
+	require.NoError(t, err)
+	return engine.NewVideoTranscodeMode(logger, router, env.ffprobe, nil, options)
+}
+
+func testOptions() engine.VideoTranscodeOptions {
+	options := engine.DefaultVideoTranscodeOptions()
+	options.MinSourceSize = 0
+	return options
+}
+
+// TestFFmpegRouter_EncoderDiscovery 测试从 -encoders 输出识别编码器
+func TestFFmpegRouter_EncoderDiscovery(t *testing.T) {
+	env := setupVideoEnv(t, "libx265 libsvtav1", probeH264TenBit)
+
+	router, err := ffmpegrouter.NewFFmpegRouter(zaptest.NewLogger(t), &ffmpegrouter.RouterConfig{
+		PreferSystemVersion: true,
+		SystemSearchPaths:   []string{env.dir},
+	})
+	require.NoError(t, err)
+
+	version, err := router.GetBestVersion(context.Background(), "video_transcode", "", "libsvtav1")
+	require.NoError(t, err)
+	assert.True(t, version.HasEncoder("libsvtav1"))
+	assert.True(t, version.HasEncoder("libx265"))
+	assert.True(t, version.HasEncoder("aac"))
+	assert.False(t, version.HasEncoder("libaom-av1"))
+	assert.False(t, version.HasEncoder("="))
+}
+
+// TestVideoTranscode_SelectsAvailableEncoder 测试按可用编码器选择、CRF映射、10-bit与音频直通
+func TestVideoTranscode_SelectsAvailableEncoder(t *testing.T) {
+	env := setupVideoEnv(t, "libx265", probeH264TenBit)
+	transcoder := newTranscoder(t, env, testOptions())
+
+	target := filepath.Join(env.dir, "clip.mp4")
+	result, err := transcoder.Transcode(context.Background(), env.source, target)
+	require.NoError(t, err)
+	require.False(t, result.Skipped, result.SkipReason)
+
+	assert.Equal(t, "libx265", result.Plan.Encoder)
+	assert.Equal(t, 28, result.Plan.CRF)
+	assert.Equal(t, "medium", result.Plan.Preset)
+	assert.True(t, result.Plan.TenBit)
+	assert.Equal(t, "copy", result.Plan.AudioCodec)
+	assert.Equal(t, int64(4000), result.OriginalSize)
+	assert.Equal(t, int64(1000), result.NewSize)
+
+	args, err := os.ReadFile(target + ".args")
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-c:v libx265 -crf 28 -preset medium -tag:v hvc1")
+	assert.Contains(t, string(args), "-pix_fmt yuv420p10le")
+	assert.Contains(t, string(args), "-c:a copy")
+
+	// 同时有SVT-AV1时优先AV1，CRF按比例映射到0-63
+	env = setupVideoEnv(t, "libx265 libsvtav1", probeH264TenBit)
+	transcoder = newTranscoder(t, env, testOptions())
+	result, err = transcoder.Transcode(context.Background(), env.source, filepath.Join(env.dir, "clip.mp4"))
+	require.NoError(t, err)
+	assert.Equal(t, "libsvtav1", result.Plan.Encoder)
+	assert.Equal(t, 35, result.Plan.CRF)
+
+	// 指定的编码族不可用时报错
+	options := testOptions()
+	options.Codec = "av1"
+	env = setupVideoEnv(t, "libx265", probeH264TenBit)
+	transcoder = newTranscoder(t, env, options)
+	_, err = transcoder.Transcode(context.Background(), env.source, filepath.Join(env.dir, "clip.mp4"))
+	assert.Error(t, err)
+}
+
+// TestVideoTranscode_SkipRules 测试体积、编码与节省比例的跳过规则
+func TestVideoTranscode_SkipRules(t *testing.T) {
+	// 已是HEVC
+	env := setupVideoEnv(t, "libx265", strings.Replace(probeH264TenBit, `"h264"`, `"hevc"`, 1))
+	result, err := newTranscoder(t, env, testOptions()).Transcode(context.Background(), env.source, filepath.Join(env.dir, "clip.mp4"))
+	require.NoError(t, err)
+	assert.True(t, result.Skipped)
+	assert.Contains(t, result.SkipReason, "hevc")
+
+	// 源文件小于最小体积
+	env = setupVideoEnv(t, "libx265", probeH264TenBit)
+	options := testOptions()
+	options.MinSourceSize = 1024 * 1024
+	result, err = newTranscoder(t, env, options).Transcode(context.Background(), env.source, filepath.Join(env.dir, "clip.mp4"))
+	require.NoError(t, err)
+	assert.True(t, result.Skipped)
+
+	// 体积减少不足10%时丢弃输出
+	env = setupVideoEnv(t, "libx265", probeH264TenBit)
+	t.Setenv("FAKE_FFMPEG_OUT_SIZE", "3900")
+	target := filepath.Join(env.dir, "clip.mp4")
+	result, err = newTranscoder(t, env, testOptions()).Transcode(context.Background(), env.source, target)
+	require.NoError(t, err)
+	assert.True(t, result.Skipped)
+	assert.NoFileExists(t, target)
+	assert.Equal(t, result.OriginalSize, result.NewSize)
+}
+
+// TestVideoTranscode_AudioReencode 测试MP4不兼容的音频被重新编码为AAC，8-bit源保持8-bit
+func TestVideoTranscode_AudioReencode(t *testing.T) {
+	probe := strings.NewReplacer(`"aac"`, `"pcm_s16le"`, `"yuv420p10le"`, `"yuv420p"`).Replace(probeH264TenBit)
+	env := setupVideoEnv(t, "libx265", probe)
+
+	target := filepath.Join(env.dir, "clip.mp4")
+	result, err := newTranscoder(t, env, testOptions()).Transcode(context.Background(), env.source, target)
+	require.NoError(t, err)
+	assert.Equal(t, "aac", result.Plan.AudioCodec)
+	assert.False(t, result.Plan.TenBit)
+
+	args, err := os.ReadFile(target + ".args")
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-pix_fmt yuv420p ")
+	assert.Contains(t, string(args), "-c:a aac -b:a 192k")
+}
+
+// TestVideoTranscode_BitDepthFromPixFmt 测试只按位深后缀识别10-bit源，nv12 等名称中的数字不算
+func TestVideoTranscode_BitDepthFromPixFmt(t *testing.T) {
+	tests := []struct {
+		pixFmt string
+		tenBit bool
+	}{
+		{pixFmt: "yuv420p", tenBit: false},
+		{pixFmt: "nv12", tenBit: false},
+		{pixFmt: "yuvj420p", tenBit: false},
+		{pixFmt: "yuv420p10le", tenBit: true},
+		{pixFmt: "yuv422p12be", tenBit: true},
+		{pixFmt: "gray10le", tenBit: true},
+		{pixFmt: "p010le", tenBit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pixFmt, func(t *testing.T) {
+			env := setupVideoEnv(t, "libx265", strings.Replace(probeH264TenBit, `"yuv420p10le"`, `"`+tt.pixFmt+`"`, 1))
+			result, err := newTranscoder(t, env, testOptions()).Transcode(context.Background(), env.source, filepath.Join(env.dir, "clip.mp4"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.tenBit, result.Plan.TenBit)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package watch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pixly/pkg/watch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// recorder 记录每个批次
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *recorder) process(ctx context.Context, paths []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, append([]string(nil), paths...))
+	return nil
+}
+
+func (r *recorder) files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var files []string
+	for _, batch := range r.batches {
+		files = append(files, batch...)
+	}
+	return files
+}
+
+func testOptions(polling bool) watch.Options {
+	return watch.Options{
+		Debounce:     100 * time.Millisecond,
+		StableFor:    300 * time.Millisecond,
+		PollInterval: 50 * time.Millisecond,
+		ForcePolling: polling,
+		Exclude:      []string{"*.tmp", "skip/*"},
+	}
+}
+
+// startWatcher 启动监视器，测试结束时停止
+func startWatcher(t *testing.T, dir string, opts watch.Options) (*recorder, *watch.Watcher) {
+	rec := &recorder{}
+	watcher, err := watch.New(zaptest.NewLogger(t), dir, opts, rec.process)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+	return rec, watcher
+}
+
+func TestWatcherWaitsForStableFiles(t *testing.T) {
+	for _, backend := range []string{"inotify", "polling"} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			existing := filepath.Join(dir, "existing.jpg")
+			require.NoError(t, os.WriteFile(existing, []byte("old"), 0644))
+
+			rec, watcher := startWatcher(t, dir, testOptions(backend == "polling"))
+			assert.Equal(t, backend, watcher.Backend())
+
+			// 分段写入，写入期间不应被处理
+			growing := filepath.Join(dir, "camera", "IMG_0001.jpg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(growing), 0755))
+			file, err := os.Create(growing)
+			require.NoError(t, err)
+			for i := 0; i < 5; i++ {
+				_, err := file.Write([]byte("chunk"))
+				require.NoError(t, err)
+				time.Sleep(80 * time.Millisecond)
+				assert.NotContains(t, rec.files(), growing)
+			}
+			require.NoError(t, file.Close())
+
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "download.tmp"), []byte("x"), 0644))
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "skip"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "skip", "a.jpg"), []byte("x"), 0644))
+
+			require.Eventually(t, func() bool {
+				files := rec.files()
+				return len(files) >= 2
+			}, 5*time.Second, 20*time.Millisecond)
+			time.Sleep(500 * time.Millisecond)
+
+			assert.ElementsMatch(t, []string{existing, growing}, rec.files(), "每个文件只处理一次，排除模式生效")
+		})
+	}
+}
+
+func TestWatcherRejectsInvalidOptions(t *testing.T) {
+	dir := t.TempDir()
+	_, err := watch.New(zaptest.NewLogger(t), dir, watch.Options{Include: []string{"[a-"}}, nil)
+	require.Error(t, err)
+
+	_, err = watch.New(zaptest.NewLogger(t), filepath.Join(dir, "missing"), watch.DefaultOptions(), nil)
+	require.Error(t, err)
+}